@@ -1,9 +1,11 @@
 package tray
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"net/url"
-	"sort"
 	"sync"
 	"time"
 
@@ -11,9 +13,9 @@ import (
 	"github.com/pydio/systray"
 
 	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
 	"github.com/pydio/cells/common/log"
 	"github.com/pydio/cells/common/service"
-	"github.com/pydio/cells/common/sync/model"
 )
 
 // StatusMessage provides an int representation of Connected/Disconnected status
@@ -24,26 +26,29 @@ const (
 	StatusDisconnected
 )
 
+// summaryInterval is the delay between two polls of the status summary
+const summaryInterval = 3 * time.Second
+
 // Client is an auto-reconnecting WebSocket client connected to the http server.
 type Client struct {
 	sync.Mutex
-	conn    *websocket.Conn
-	Status  chan StatusMessage
-	Errors  chan error
-	Tasks   chan []*common.ConcreteSyncState
-	done    chan bool
-	closing bool
-	tasks   map[string]*common.ConcreteSyncState
+	conn          *websocket.Conn
+	Status        chan StatusMessage
+	Errors        chan error
+	Summary       chan *common.StatusSummary
+	Notifications chan *common.Notification
+	done          chan bool
+	closing       bool
 }
 
 // NewClient creates a client
 func NewClient() *Client {
 	c := &Client{
-		Status: make(chan StatusMessage, 10),
-		Errors: make(chan error, 10),
-		Tasks:  make(chan []*common.ConcreteSyncState, 1),
-		done:   make(chan bool),
-		tasks:  make(map[string]*common.ConcreteSyncState),
+		Status:        make(chan StatusMessage, 10),
+		Errors:        make(chan error, 10),
+		Summary:       make(chan *common.StatusSummary, 1),
+		Notifications: make(chan *common.Notification, 10),
+		done:          make(chan bool),
 	}
 	return c
 }
@@ -58,6 +63,11 @@ func (c *Client) Reconnect() {
 		for {
 			select {
 			case <-ticker.C:
+				// The server may have restarted on another port
+				if info, e := config.ReadRuntimeInfo(); e == nil && info.URL != "" && info.URL != uxUrl {
+					log.Logger(trayCtx).Info("Server address changed to " + info.URL)
+					uxUrl = info.URL
+				}
 				log.Logger(trayCtx).Info("Trying to reconnect...")
 				c.Connect()
 			case s := <-c.Status:
@@ -78,6 +88,8 @@ func (c *Client) Connect() error {
 		parsed.Scheme = "ws"
 	}
 	parsed.Path = "/status"
+	// Task states are polled from the summary, only receive notifications
+	parsed.RawQuery = "events=notifications"
 	return service.Retry(func() error {
 		conn, _, err := websocket.DefaultDialer.Dial(parsed.String(), nil)
 		if err == nil {
@@ -100,20 +112,36 @@ func (c *Client) Close() {
 	}
 }
 
-// SendOrderedTasks sends the lists of tasks
-func (c *Client) SendOrderedTasks() {
-	var tasks []*common.ConcreteSyncState
-	c.Lock()
-	for _, t := range c.tasks {
-		tasks = append(tasks, t)
+// PollSummary regularly loads the status summary from the http server and sends it on the Summary channel
+// when it changed. It should be called as a goroutine.
+func (c *Client) PollSummary() {
+	parsed, _ := url.Parse(uxUrl)
+	parsed.Path = "/summary"
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(summaryInterval)
+	defer ticker.Stop()
+	var last []byte
+	for range ticker.C {
+		if c.closing {
+			return
+		}
+		resp, e := client.Get(parsed.String())
+		if e != nil {
+			continue
+		}
+		data, e := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if e != nil || resp.StatusCode != http.StatusOK || bytes.Equal(data, last) {
+			continue
+		}
+		var summary common.StatusSummary
+		if e := json.Unmarshal(data, &summary); e != nil {
+			log.Logger(trayCtx).Error("Cannot parse status summary: " + e.Error())
+			continue
+		}
+		last = data
+		c.Summary <- &summary
 	}
-	c.Unlock()
-	sort.Slice(tasks, func(i, j int) bool {
-		t1 := tasks[i]
-		t2 := tasks[j]
-		return t1.Config.Label < t2.Config.Label
-	})
-	c.Tasks <- tasks
 }
 
 func (c *Client) bindConn(conn *websocket.Conn) {
@@ -136,27 +164,10 @@ func (c *Client) bindConn(conn *websocket.Conn) {
 			if messageType == websocket.TextMessage {
 				m := common.MessageFromData(message)
 				switch m.Type {
-				case "STATE":
-					content, ok := m.Content.(*common.ConcreteSyncState)
-					if ok {
-						log.Logger(trayCtx).Debug(fmt.Sprintf("Got state for sync %s - Status %d", content.Config.Label, content.Status))
-						c.Lock()
-						prev, hasPrev := c.tasks[content.Config.Uuid]
-						if content.Status == model.TaskStatusRemoved && hasPrev {
-							delete(c.tasks, content.Config.Uuid)
-						} else {
-							c.tasks[content.Config.Uuid] = content
-						}
-						c.Unlock()
-						if !hasPrev || (prev.Status != content.Status || prev.LeftInfo.Connected != content.LeftInfo.Connected || prev.RightInfo.Connected != content.RightInfo.Connected) {
-							c.SendOrderedTasks()
-						}
+				case "NOTIFICATION":
+					if n, ok := m.Content.(*common.Notification); ok {
+						c.Notifications <- n
 					}
-				case "PONG":
-					c.Lock()
-					c.tasks = make(map[string]*common.ConcreteSyncState)
-					c.Unlock()
-					c.SendOrderedTasks()
 				case "ERROR":
 					log.Logger(trayCtx).Error("Could not parse message")
 				}
@@ -176,6 +187,16 @@ func (c *Client) SendCmd(content *common.CmdContent) {
 	log.Logger(trayCtx).Error("No active connection for sending message")
 }
 
+// SendNotificationAction sends the action chosen by the user on a notification.
+func (c *Client) SendNotificationAction(response *common.NotificationResponse) {
+	if c.conn != nil {
+		if e := c.conn.WriteJSON(&common.Message{Type: "NOTIFICATION_ACTION", Content: response}); e == nil {
+			return
+		}
+	}
+	log.Logger(trayCtx).Error("No active connection for sending message")
+}
+
 // SendRoute sends a target route to the websocket. When the WebView is already opened, it will switch the
 // current screen instead of reopening the webview.
 func (c *Client) SendRoute(route string) {
@@ -187,6 +208,16 @@ func (c *Client) SendRoute(route string) {
 	log.Logger(trayCtx).Error("No active connection for sending message")
 }
 
+// SendSafeQuit asks the server to pause all tasks and quit once running syncs are done.
+// The parent process of the systray will close it when stopping, which may take a while.
+func (c *Client) SendSafeQuit() {
+	if viewCancel != nil {
+		viewCancel()
+		viewCancel = nil
+	}
+	c.SendCmd(&common.CmdContent{Cmd: "stop-all"})
+}
+
 // SendHalt sends a Quit command to the server. The parent process of the systray should be then killed by the server.
 // If send fails or if it is still running after 3 seconds, quit directly this process.
 func (c *Client) SendHalt() {
@@ -20,18 +20,74 @@ package tray
 
 import (
 	"os/exec"
+	"strings"
+
+	"github.com/pydio/cells-sync/common"
 )
 
+// maxDialogButtons is the number of buttons accepted by AppleScript "display dialog".
+const maxDialogButtons = 3
+
+// runScript executes an AppleScript "run" handler with the given arguments. Texts are passed as arguments instead of
+// being inserted in the script, so that they cannot break out of string literals. The first argument is a fixed
+// word ending option parsing, so texts starting with a dash are not taken as options: it is ignored by scripts.
+func runScript(script string, args ...string) ([]byte, error) {
+	osa, err := exec.LookPath("osascript")
+	if err != nil {
+		return nil, err
+	}
+	var cmdArgs []string
+	for _, line := range strings.Split(script, "\n") {
+		cmdArgs = append(cmdArgs, "-e", line)
+	}
+	cmdArgs = append(cmdArgs, "cells-sync")
+	cmdArgs = append(cmdArgs, args...)
+	return exec.Command(osa, cmdArgs...).Output()
+}
+
 // Notify sends desktop notification.
 //
 // On macOS this executes AppleScript with `osascript` binary.
 // Inspired by github.com/gen2brain/beep
 func notify(title, message string) error {
-	osa, err := exec.LookPath("osascript")
+	_, err := runScript(`on run argv
+	display notification (item 2 of argv) with title (item 3 of argv)
+end run`, message, title)
+	return err
+}
+
+// notifyActions displays a dialog with one button per action and returns the chosen action id, or an
+// empty string if the user dismissed it. A dialog has at most 3 buttons: with less than 3 actions, an "Ignore"
+// button cancels it, otherwise it is ignored by letting it expire.
+func notifyActions(n *common.Notification) (string, error) {
+	actions := n.Actions
+	if len(actions) > maxDialogButtons {
+		actions = actions[:maxDialogButtons]
+	}
+	args := []string{n.Message, n.Title}
+	for _, a := range actions {
+		args = append(args, a.Label)
+	}
+	out, err := runScript(`on run argv
+	set labels to items 4 thru -1 of argv
+	if (count of labels) < 3 then
+		set end of labels to "Ignore"
+		set r to display dialog (item 2 of argv) with title (item 3 of argv) buttons labels default button "Ignore" cancel button "Ignore" giving up after 120
+	else
+		set r to display dialog (item 2 of argv) with title (item 3 of argv) buttons labels giving up after 120
+	end if
+	if gave up of r then return ""
+	return button returned of r
+end run`, args...)
 	if err != nil {
-		return err
+		// User cancelled the dialog
+		return "", nil
 	}
-
-	cmd := exec.Command(osa, "-e", `display notification "`+message+`" with title "`+title+`"`)
-	return cmd.Run()
+	result := strings.TrimSpace(string(out))
+	for _, a := range actions {
+		if result == a.Label {
+			return a.Id, nil
+		}
+	}
+	return "", nil
 }
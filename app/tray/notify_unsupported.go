@@ -1,4 +1,4 @@
-// +build !darwin
+// +build !darwin,!windows
 
 /*
  * Copyright 2019 Abstrium SAS
@@ -21,6 +21,12 @@
 
 package tray
 
+import "github.com/pydio/cells-sync/common"
+
 func notify(title, message string) error {
 	return ErrNotSupported
 }
+
+func notifyActions(n *common.Notification) (string, error) {
+	return "", ErrNotSupported
+}
@@ -0,0 +1,59 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tray
+
+import (
+	"strings"
+
+	"gopkg.in/toast.v1"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/i18n"
+)
+
+// notify sends a Windows toast notification.
+func notify(title, message string) error {
+	n := toast.Notification{
+		AppID:   i18n.T("application.title"),
+		Title:   title,
+		Message: message,
+	}
+	return n.Push()
+}
+
+// notifyActions sends a toast with protocol actions pointing to the local http server: the response
+// is handled by the server when the user clicks, so this function does not return any action.
+func notifyActions(n *common.Notification) (string, error) {
+	t := toast.Notification{
+		AppID:   i18n.T("application.title"),
+		Title:   n.Title,
+		Message: n.Message,
+	}
+	for _, a := range n.Actions {
+		t.Actions = append(t.Actions, toast.Action{
+			Type:      "protocol",
+			Label:     a.Label,
+			Arguments: strings.TrimRight(uxUrl, "/") + "/notifications/" + n.Id + "/" + a.Id,
+		})
+	}
+	return "", t.Push()
+}
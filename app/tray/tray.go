@@ -44,23 +44,32 @@ import (
 
 var (
 	viewCancel context.CancelFunc
-	uxUrl      = "http://localhost:3636"
+	uxUrl      = config.DefaultHttpURL
 	cancelling bool
 	ws         *Client
 	stateSlots []*systray.MenuItem
 
 	firstRun    bool
+	openAtStart bool
+	// Set when attached to an agent running as a Windows service, that must not be stopped with the tray
+	attached    bool
 	pauseToggle bool
 	trayCtx     = servicecontext.WithServiceColor(servicecontext.WithServiceName(context.Background(), "systray"), servicecontext.ServiceColorOther)
 
 	ErrNotSupported = fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 )
 
-// Run opens the system tray
-func Run(url string) {
+// Run opens the system tray. If open is true, the main window is opened once connected to the server.
+func Run(url string, open bool) {
 	if url != "" {
 		uxUrl = url
+	} else {
+		uxUrl = config.DiscoverHttpURL()
 	}
+	if info, e := config.ReadPipeRuntimeInfo(); e == nil && info.Service {
+		attached = true
+	}
+	openAtStart = open
 	checkFirstRun()
 	systray.Run(onReady, onExit)
 }
@@ -133,6 +142,7 @@ func onReady() {
 	systray.AddSeparator()
 	mResync := systray.AddMenuItem(i18n.T("main.all.resync"), i18n.T("main.all.resync.legend"))
 	mAbout := systray.AddMenuItem(i18n.T("nav.about"), "")
+	mSafeQuit := systray.AddMenuItem(i18n.T("tray.menu.stopall"), i18n.T("tray.menu.stopall.legend"))
 	mQuit := systray.AddMenuItem(i18n.T("tray.menu.exit"), i18n.T("tray.menu.exit.legend"))
 	ws = NewClient()
 
@@ -151,6 +161,10 @@ func onReady() {
 			case s := <-ws.Status:
 				systray.SetTitle("")
 				if s == StatusConnected {
+					if openAtStart && !firstRun {
+						openAtStart = false
+						go spawnWebView()
+					}
 					mOpen.Enable()
 					mNewTasks.Enable()
 					for _, slot := range stateSlots {
@@ -164,7 +178,8 @@ func onReady() {
 						slot.Enable()
 					}
 				}
-			case tasks := <-ws.Tasks:
+			case summary := <-ws.Summary:
+				tasks := summary.Tasks
 				i := 0
 				if len(tasks) == 0 {
 					setIconIdle()
@@ -179,7 +194,7 @@ func onReady() {
 				var hasProcessing bool
 				allPaused := true
 				for _, t := range tasks {
-					label := t.Config.Label
+					label := t.Label
 					switch t.Status {
 					case model.TaskStatusDisabled:
 						label += " (" + i18n.T("tray.task.status.disabled") + ")"
@@ -192,13 +207,13 @@ func onReady() {
 						label += " (" + i18n.T("tray.task.status.error") + ")"
 						hasError = true
 					}
-					if !hasError && (!t.LeftInfo.Connected || !t.RightInfo.Connected) {
+					if !hasError && !t.Connected {
 						label += " (" + i18n.T("tray.task.status.disconnected") + ")"
 						hasError = true
 					}
 					allPaused = allPaused && (t.Status == model.TaskStatusPaused)
 					stateSlots[i].SetTitle(label)
-					stateSlots[i].SetTooltip(t.Config.Uuid)
+					stateSlots[i].SetTooltip(t.UUID)
 					stateSlots[i].Show()
 					if mOpen.Disabled() {
 						stateSlots[i].Disable()
@@ -222,6 +237,7 @@ func onReady() {
 						slot.Hide()
 					}
 				}
+				systray.SetTooltip(summaryTooltip(summary))
 				if len(tasks) > 0 && allPaused {
 					setIconPause()
 					mPause.SetTitle(i18n.T("main.all.resume"))
@@ -232,6 +248,8 @@ func onReady() {
 					mPause.SetTooltip(i18n.T("main.all.pause.legend"))
 					pauseToggle = false
 				}
+			case n := <-ws.Notifications:
+				go showNotification(n)
 			case e := <-ws.Errors:
 				log.Logger(trayCtx).Error("Received error from client " + e.Error())
 			case <-mOpen.ClickedCh:
@@ -270,13 +288,67 @@ func onReady() {
 				}
 			case <-mQuit.ClickedCh:
 				log.Logger(trayCtx).Info("Closing systray now...")
+				if attached {
+					// Syncs keep running in the service
+					beforeExit()
+					systray.Quit()
+					return
+				}
 				ws.SendHalt()
 				return
+			case <-mSafeQuit.ClickedCh:
+				log.Logger(trayCtx).Info("Stopping all syncs before quitting...")
+				mSafeQuit.Disable()
+				ws.SendSafeQuit()
+				if attached {
+					// The service stops on its own, no need to wait for it
+					beforeExit()
+					systray.Quit()
+					return
+				}
 			}
 		}
 	}()
 
 	ws.Connect()
+	go ws.PollSummary()
+}
+
+// summaryTooltip describes the pending items, transfer rates and authentication problems of all tasks.
+func summaryTooltip(summary *common.StatusSummary) string {
+	tooltip := i18n.T("application.title")
+	if summary.Pending > 0 {
+		tooltip += " - " + fmt.Sprintf(i18n.T("tray.tooltip.pending"), summary.Pending)
+	}
+	if summary.UpRate > 0 || summary.DownRate > 0 {
+		tooltip += " - " + fmt.Sprintf(i18n.T("tray.tooltip.rates"), control.FormatSize(summary.UpRate), control.FormatSize(summary.DownRate))
+	}
+	if summary.AuthProblems > 0 {
+		tooltip += " - " + fmt.Sprintf(i18n.T("tray.tooltip.auth"), summary.AuthProblems)
+	}
+	return tooltip
+}
+
+// showNotification displays a notification and forwards the chosen action to the server.
+func showNotification(n *common.Notification) {
+	if len(n.Actions) == 0 {
+		notify(n.Title, n.Message)
+		return
+	}
+	action, e := notifyActions(n)
+	if e != nil {
+		if e != ErrNotSupported {
+			log.Logger(trayCtx).Error("Cannot display notification: " + e.Error())
+		}
+		return
+	}
+	if action == "" {
+		return
+	}
+	if action == control.ActionLogin {
+		go spawnWebView("/servers")
+	}
+	ws.SendNotificationAction(&common.NotificationResponse{Id: n.Id, Action: action})
 }
 
 func beforeExit() {
@@ -17,7 +17,7 @@
  *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
  */
 import React from 'react';
-import {Customizer, Stack, createTheme } from 'office-ui-fabric-react';
+import {Customizer, Stack, createTheme, MessageBar, MessageBarType } from 'office-ui-fabric-react';
 import {FluentCustomizations, Depths} from '@uifabric/fluent-theme';
 //import { initializeIcons } from '@uifabric/icons';
 import { BrowserRouter as Router, Route} from 'react-router-dom'
@@ -116,7 +116,7 @@ class App extends React.Component{
     }
 
     render(){
-        const {socket, connected, connecting, maxAttemptsReached, firstAttempt, syncTasks} = this.state;
+        const {socket, connected, connecting, maxAttemptsReached, firstAttempt, syncTasks, configError} = this.state;
         const fontCusto = {
             settings: {
                 theme: createTheme({
@@ -150,6 +150,11 @@ class App extends React.Component{
                             socket={socket}
                         />
                         <div style={{position:'absolute', top:0, left: 0, right:0, bottom: 0, overflow:'hidden', display:'flex', flexDirection:'column'}}>
+                            {configError &&
+                                <MessageBar messageBarType={MessageBarType.error} onDismiss={() => socket.setState({configError: null})}>
+                                    {configError.Error}
+                                </MessageBar>
+                            }
                             <Stack horizontal styles={{root:{flex: 2}}}>
                                 <Stack.Item align={"stretch"} styles={{root:{boxShadow:Depths.depth4, zIndex: 2, backgroundColor:'rgba(236,239,241,0.6)', display:'flex', flexDirection:'column'}}}>
                                     <NavMenu/>
@@ -33,6 +33,7 @@ import {
 import moment from 'moment'
 import parse from "url-parse";
 import {withRouter} from 'react-router-dom'
+import buildUrl from "../models/Url";
 
 /*
 const sampleServer = {
@@ -128,10 +129,35 @@ class AccountsList extends Component{
 
     loginToNewServer(){
         const {newUrl} = this.state;
+        const {t} = this.props;
         // Remove path part
         const ll = parse(newUrl, {}, true);
         ll.pathname = "";
-        Storage.signin(ll.toString());
+        const serverUrl = ll.toString();
+        if (ll.protocol !== 'https:') {
+            Storage.signin(serverUrl);
+            return;
+        }
+        // Certificates not trusted by the system are pinned at first login: show the fingerprint to the user first
+        window.fetch(buildUrl('/certificate'), {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            credentials: 'omit',
+            body: JSON.stringify({URI: serverUrl})
+        }).then(response => response.json()).then(cert => {
+            if (cert.error) {
+                window.alert(cert.error);
+                return;
+            }
+            if (!cert.Trusted && !window.confirm(t('server.certificate.confirm').replace('%1', cert.Subject).replace('%2', cert.Issuer).replace('%3', cert.Fingerprint))) {
+                return;
+            }
+            Storage.signin(serverUrl);
+        }).catch(() => {
+            Storage.signin(serverUrl);
+        });
     }
 
     render() {
@@ -54,6 +54,7 @@ class EditorPanel extends React.Component {
                                         history.push('/')
                                     }}
                                     socket={socket}
+                                    syncTasks={syncTasks}
                                 />
                             }/>
                             <Route path={"/edit/:uuid"} render={({match, history}) =>
@@ -64,6 +65,7 @@ class EditorPanel extends React.Component {
                                             history.push('/')
                                         }}
                                         socket={socket}
+                                        syncTasks={syncTasks}
                                     /> :
                                     <Redirect to={"/"}/>
                             }/>
@@ -19,12 +19,16 @@
 import React from 'react'
 import {Page, PageBlock} from "./Page";
 import Settings from '../models/Settings'
+import buildUrl from '../models/Url'
+import humanize from 'humanize'
 import 'observable-slim/proxy'
 import ObservableSlim from 'observable-slim'
 import {
     TextField,
     Toggle,
-    Dropdown
+    Dropdown,
+    IconButton,
+    DefaultButton
 } from "office-ui-fabric-react";
 import {withTranslation} from "react-i18next";
 
@@ -50,7 +54,19 @@ class PageSettings extends React.Component {
             this.setState({settings: proxy, loading: false, revert: copy, dirty: false});
         }).catch(reason => {
             this.setState({error: reason.message, loading: false});
-        })
+        });
+        window.fetch(buildUrl('/network'), {method: 'GET', credentials: 'omit'}).then(r => r.json()).then(network => {
+            this.setState({network});
+        }).catch(() => {});
+    }
+
+    addNetworkRule() {
+        const {settings, network} = this.state;
+        if (!settings.Bandwidth.Rules) {
+            settings.Bandwidth.Rules = [];
+        }
+        const name = network && network.Current ? (network.Current.SSID || network.Current.Interface) : '';
+        settings.Bandwidth.Rules.push({Network: name, RateKB: 0});
     }
 
     revert() {
@@ -81,7 +97,7 @@ class PageSettings extends React.Component {
 
     render() {
         const {t} = this.props;
-        const {settings, loading, dirty} = this.state;
+        const {settings, loading, dirty, network} = this.state;
         let cmdBarItems = [
             {
                 key:'cancel',
@@ -160,6 +176,169 @@ class PageSettings extends React.Component {
                             settings.Service.AutoStart = !settings.Service.AutoStart;
                         }}
                     />
+                    <Toggle
+                        label={t('settings.autostart.minimized')}
+                        checked={settings.Service.StartMinimized}
+                        onText={t('settings.autostart.minimized.on')}
+                        offText={t('settings.autostart.minimized.off')}
+                        onChange={(e, v) => {
+                            settings.Service.StartMinimized = !settings.Service.StartMinimized;
+                        }}
+                    />
+                    <Toggle
+                        label={t('settings.autostart.background')}
+                        checked={settings.Service.Background}
+                        onText={t('settings.autostart.background.on')}
+                        offText={t('settings.autostart.background.off')}
+                        onChange={(e, v) => {
+                            settings.Service.Background = !settings.Service.Background;
+                        }}
+                    />
+                </PageBlock>
+                <PageBlock style={{paddingBottom: 40}}>
+                    <h3>{t('settings.section.activity')}</h3>
+                    <Toggle
+                        label={t('settings.activity.toggle')}
+                        checked={settings.Activity.Enabled}
+                        onText={t('settings.activity.on')}
+                        offText={t('settings.activity.off')}
+                        onChange={(e, v) => {
+                            settings.Activity.Enabled = !settings.Activity.Enabled;
+                        }}
+                    />
+                    {settings.Activity.Enabled &&
+                    <React.Fragment>
+                        <TextField
+                            label={t('settings.activity.idle')}
+                            type={"number"}
+                            value={settings.Activity.IdleMinutes}
+                            onChange={(e, v) => {settings.Activity.IdleMinutes = parseInt(v)}}
+                        />
+                        <TextField
+                            label={t('settings.activity.rate')}
+                            type={"number"}
+                            value={settings.Activity.ActiveRateKB}
+                            onChange={(e, v) => {settings.Activity.ActiveRateKB = parseInt(v)}}
+                        />
+                    </React.Fragment>
+                    }
+                </PageBlock>
+                <PageBlock style={{paddingBottom: 40}}>
+                    <h3>{t('settings.section.startup')}</h3>
+                    <TextField
+                        label={t('settings.startup.scans')}
+                        type={"number"}
+                        value={settings.Startup.MaxConcurrentScans}
+                        onChange={(e, v) => {settings.Startup.MaxConcurrentScans = parseInt(v)}}
+                    />
+                    <TextField
+                        label={t('settings.startup.stagger')}
+                        type={"number"}
+                        value={settings.Startup.StaggerSeconds}
+                        onChange={(e, v) => {settings.Startup.StaggerSeconds = parseInt(v)}}
+                    />
+                </PageBlock>
+                <PageBlock style={{paddingBottom: 40}}>
+                    <h3>{t('settings.section.bandwidth')}</h3>
+                    <Toggle
+                        label={t('settings.bandwidth.toggle')}
+                        checked={settings.Bandwidth.Enabled}
+                        onText={t('settings.bandwidth.on')}
+                        offText={t('settings.bandwidth.off')}
+                        onChange={(e, v) => {
+                            settings.Bandwidth.Enabled = !settings.Bandwidth.Enabled;
+                        }}
+                    />
+                    {settings.Bandwidth.Enabled &&
+                    <React.Fragment>
+                        {network && network.Current &&
+                        <div style={{marginBottom: 8}}>{t('settings.bandwidth.current').replace('%1', network.Current.SSID || network.Current.Interface)}</div>
+                        }
+                        {(settings.Bandwidth.Rules || []).map((rule, i) =>
+                            <div key={i} style={{display:'flex', alignItems:'flex-end'}}>
+                                <TextField
+                                    styles={{root:{flex: 2, marginRight: 8}}}
+                                    label={t('settings.bandwidth.rule.network')}
+                                    value={rule.Network}
+                                    onChange={(e, v) => {rule.Network = v}}
+                                />
+                                <TextField
+                                    styles={{root:{flex: 1}}}
+                                    label={t('settings.bandwidth.rule.rate')}
+                                    type={"number"}
+                                    value={rule.RateKB}
+                                    onChange={(e, v) => {rule.RateKB = parseInt(v) || 0}}
+                                />
+                                <IconButton
+                                    iconProps={{iconName:'Delete'}}
+                                    title={t('settings.bandwidth.rule.remove')}
+                                    onClick={() => {settings.Bandwidth.Rules.splice(i, 1)}}
+                                />
+                            </div>
+                        )}
+                        <DefaultButton
+                            styles={{root:{marginTop: 8}}}
+                            text={t('settings.bandwidth.rule.add')}
+                            onClick={() => this.addNetworkRule()}
+                        />
+                        <TextField
+                            label={t('settings.bandwidth.default')}
+                            type={"number"}
+                            value={settings.Bandwidth.DefaultRateKB}
+                            onChange={(e, v) => {settings.Bandwidth.DefaultRateKB = parseInt(v) || 0}}
+                        />
+                    </React.Fragment>
+                    }
+                    {network && network.Usages && network.Usages.length > 0 &&
+                    <div style={{marginTop: 16}}>
+                        <div>{t('settings.bandwidth.usage')}</div>
+                        {network.Usages.map(u =>
+                            <div key={u.Network} style={{fontSize: 12}}>
+                                {t('settings.bandwidth.usage.line').replace('%1', u.Network).replace('%2', humanize.filesize(u.Up)).replace('%3', humanize.filesize(u.Down))}
+                            </div>
+                        )}
+                    </div>
+                    }
+                </PageBlock>
+                <PageBlock style={{paddingBottom: 40}}>
+                    <h3>{t('settings.section.proxy')}</h3>
+                    <TextField
+                        label={t('settings.proxy.url')}
+                        placeholder={t('settings.proxy.url.placeholder')}
+                        value={settings.Proxy.URL}
+                        onChange={(e,v)=>{settings.Proxy.URL = v}}
+                    />
+                    {settings.Proxy.URL && settings.Proxy.URL !== 'direct' &&
+                    <React.Fragment>
+                        <Dropdown
+                            label={t('settings.proxy.auth')}
+                            selectedKey={settings.Proxy.Auth || 'basic'}
+                            onChange={(e, item)=>{settings.Proxy.Auth = item.key}}
+                            options={[
+                                { key: 'basic', text: t('settings.proxy.auth.basic')},
+                                { key: 'ntlm', text: t('settings.proxy.auth.ntlm')},
+                                { key: 'negotiate', text: t('settings.proxy.auth.negotiate')},
+                            ]}
+                        />
+                        <TextField
+                            label={t('settings.proxy.username')}
+                            value={settings.Proxy.Username}
+                            onChange={(e,v)=>{settings.Proxy.Username = v}}
+                        />
+                        <TextField
+                            label={t('settings.proxy.password')}
+                            type={"password"}
+                            value={settings.Proxy.Password}
+                            onChange={(e,v)=>{settings.Proxy.Password = v}}
+                        />
+                        <TextField
+                            label={t('settings.proxy.noproxy')}
+                            placeholder={t('settings.proxy.noproxy.placeholder')}
+                            value={settings.Proxy.NoProxy}
+                            onChange={(e,v)=>{settings.Proxy.NoProxy = v}}
+                        />
+                    </React.Fragment>
+                    }
                 </PageBlock>
                 <PageBlock style={{paddingBottom: 40}}>
                     <h3>{t('settings.section.logs')}</h3>
@@ -189,6 +368,15 @@ class PageSettings extends React.Component {
                         value={settings.Logs.MaxAgeDays}
                         onChange={(e, v) => {settings.Logs.MaxAgeDays = parseInt(v)}}
                     />
+                    <Toggle
+                        label={t('settings.logs.remote')}
+                        checked={!!(settings.Logs.Remote && settings.Logs.Remote.Enabled)}
+                        onText={t('settings.logs.remote.on')}
+                        offText={t('settings.logs.remote.off')}
+                        onChange={(e, v) => {
+                            settings.Logs.Remote = {...(settings.Logs.Remote || {}), Enabled: v};
+                        }}
+                    />
                     <Toggle
                         label={t('settings.show.debug')}
                         checked={settings.Debugging.ShowPanels}
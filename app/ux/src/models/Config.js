@@ -107,4 +107,42 @@ class DefaultDirLoader {
     }
 }
 
-export {Config, DefaultDirLoader}
\ No newline at end of file
+// Local folders proposed for a new task, best first, depending on the workspace of the server URI
+function loadFolderSuggestions(serverURI){
+    return window.fetch(buildUrl('/local/suggestions'), {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        credentials: 'omit',
+        body: JSON.stringify({
+            ServerURI: serverURI || "",
+        })
+    }).then(response => {
+        if (response.status !== 200) {
+            return [];
+        }
+        return response.json();
+    }).then(data => data || []).catch(reason => {
+        console.log(reason);
+        return [];
+    });
+}
+
+// Named filters defined in the global config, that tasks can reference
+function loadFilterSets(){
+    return window.fetch(buildUrl('/filter-sets'), {
+        method: 'GET',
+        credentials: 'omit',
+    }).then(response => {
+        if (response.status !== 200) {
+            return [];
+        }
+        return response.json();
+    }).then(data => data || []).catch(reason => {
+        console.log(reason);
+        return [];
+    });
+}
+
+export {Config, DefaultDirLoader, loadFolderSuggestions, loadFilterSets}
\ No newline at end of file
@@ -41,6 +41,29 @@ class Settings {
     };
     Service =  {
         AutoStart: false,
+        StartMinimized: false,
+        Background: false,
+    };
+    Activity = {
+        Enabled: false,
+        IdleMinutes: 5,
+        ActiveRateKB: 1024
+    };
+    Proxy = {
+        URL: "",
+        Username: "",
+        Password: "",
+        Auth: "basic",
+        NoProxy: ""
+    };
+    Bandwidth = {
+        Enabled: false,
+        DefaultRateKB: 0,
+        Rules: []
+    };
+    Startup = {
+        MaxConcurrentScans: 2,
+        StaggerSeconds: 10
     };
 
     constructor(data) {
@@ -56,6 +79,18 @@ class Settings {
         if (data && data.Service){
             this.Service = data.Service;
         }
+        if (data && data.Activity){
+            this.Activity = data.Activity;
+        }
+        if (data && data.Proxy){
+            this.Proxy = data.Proxy;
+        }
+        if (data && data.Bandwidth){
+            this.Bandwidth = data.Bandwidth;
+        }
+        if (data && data.Startup){
+            this.Startup = data.Startup;
+        }
     }
 
     parseResponse(prom) {
@@ -75,6 +110,10 @@ class Settings {
             this.Updates = data.Updates;
             this.Debugging = data.Debugging || {};
             this.Service = data.Service || {};
+            this.Activity = data.Activity || {};
+            this.Proxy = data.Proxy || {};
+            this.Bandwidth = data.Bandwidth || {Rules: []};
+            this.Startup = data.Startup || {};
             Settings.notify(this);
             return this;
         });
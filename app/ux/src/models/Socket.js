@@ -26,6 +26,8 @@ export default class Socket {
         this.onTasks = onTasks;
         this.onUpdate = [];
         this.onAuthorities = [];
+        // Last journaled message received, kept across UI reloads to resume the subscription
+        this.lastSeq = parseInt(sessionStorage.getItem('socket.lastSeq')) || 0;
 
         this.state = {
             syncTasks: {},
@@ -74,6 +76,24 @@ export default class Socket {
         }
     }
 
+    /**
+     * Apply a JSON merge patch (RFC 7386) on a task state, returning a new object.
+     */
+    static mergePatch(target, patch){
+        if (patch === null || typeof patch !== 'object' || Array.isArray(patch)) {
+            return patch;
+        }
+        const result = (target !== null && typeof target === 'object' && !Array.isArray(target)) ? {...target} : {};
+        Object.keys(patch).forEach(k => {
+            if (patch[k] === null) {
+                delete(result[k]);
+            } else {
+                result[k] = Socket.mergePatch(result[k], patch[k]);
+            }
+        });
+        return result;
+    }
+
     start() {
         this.ws = new Sockette( buildUrl('/status', true) , {
             timeout: 3e3,
@@ -123,6 +143,10 @@ export default class Socket {
 
     onMessage(msg) {
         const data = this.read(msg);
+        if (data.Seq && data.Seq > this.lastSeq) {
+            this.lastSeq = data.Seq;
+            sessionStorage.setItem('socket.lastSeq', data.Seq);
+        }
         if (data.Type === 'PONG'){
             console.log('Correctly connected!', data)
         } else if(data.Type === 'STATE') {
@@ -134,6 +158,14 @@ export default class Socket {
                 syncTasks[UUID] = data.Content;
             }
             this.setState({syncTasks});
+        } else if(data.Type === 'STATE_DIFF') {
+            const {syncTasks} = this.state;
+            const {UUID, Patch} = data.Content;
+            // Diffs are only sent after a full state, the next full state will catch up otherwise
+            if (syncTasks[UUID]) {
+                syncTasks[UUID] = Socket.mergePatch(syncTasks[UUID], Patch);
+                this.setState({syncTasks});
+            }
         } else if(data.Type === 'UPDATE') {
             this.onUpdate.forEach(cb => {
                 cb(data.Content);
@@ -142,6 +174,8 @@ export default class Socket {
             this.onAuthorities.forEach(cb => {
                 cb(data.Content);
             })
+        } else if(data.Type === 'CONFIG_ERROR') {
+            this.setState({configError: data.Content});
         } else if(data.Type === 'WEBVIEW_ROUTE') {
             if(this.onExternalRoute) {
                 this.onExternalRoute(data.Content);
@@ -174,7 +208,7 @@ export default class Socket {
     }
 
     triggerTasksStatus() {
-        this.sendMessage('PING')
+        this.sendMessage('PING', {LastSeq: this.lastSeq})
     }
 
     deleteTask(config) {
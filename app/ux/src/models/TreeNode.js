@@ -101,6 +101,9 @@ class TreeNode {
         if(child && child.MetaStore && child.MetaStore['ws_label']) {
             c.label = child.MetaStore['ws_label'].replace(/"/g, '');
         }
+        if(child && child.MetaStore && child.MetaStore['ws_scope']) {
+            c.scope = child.MetaStore['ws_scope'].replace(/"/g, '');
+        }
         if(child && child.MetaStore && child.MetaStore && child.MetaStore["FROM_TREE"]){
             c.fromTree = child.MetaStore["FROM_TREE"];
         }
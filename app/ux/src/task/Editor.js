@@ -21,10 +21,12 @@ import 'observable-slim/proxy'
 import ObservableSlim from 'observable-slim'
 import parse from 'url-parse'
 import basename from 'basename'
-import { Label, TextField, Dropdown, Separator, Stack, DefaultButton, PrimaryButton, Toggle, Icon, TooltipHost, TooltipDelay, DirectionalHint } from 'office-ui-fabric-react';
-import {Config, DefaultDirLoader} from '../models/Config'
+import { Label, Link, TextField, Dropdown, Separator, Stack, DefaultButton, PrimaryButton, Toggle, Icon, TooltipHost, TooltipDelay, DirectionalHint } from 'office-ui-fabric-react';
+import {Config, loadFolderSuggestions, loadFilterSets} from '../models/Config'
 import EndpointPicker from './EndpointPicker'
 import SelectiveFolders from "./SelectiveFolders";
+import SyncPreview from "./SyncPreview";
+import FilterPreview from "./FilterPreview";
 import {renderOptionWithIcon, renderTitleWithIcon} from "../components/DropdownRender";
 import {withTranslation} from 'react-i18next'
 import Schedule from './Schedule'
@@ -65,15 +67,35 @@ class Editor extends React.Component {
         if(isNew){
             this.state.LeftURIInvalid = true;
             this.state.RightURIInvalid = true;
-            DefaultDirLoader.getInstance().onDefaultDir().then(defaultPath => {
-                if(defaultPath){
-                    const p = parse(proxy.Config.RightURI, {}, true);
-                    p.set('pathname', defaultPath);
-                    proxy.Config.RightURI = p.toString();
-                    this.setState({RightURIInvalid: false});
-                }
-            })
+            this.suggestFolders(proxy, proxy.Config.LeftURI);
         }
+        loadFilterSets().then(filterSets => this.setState({filterSets}));
+    }
+
+    // Proposes local folders matching the server side, and applies the best one unless the user picked another folder
+    suggestFolders(task, serverURI){
+        loadFolderSuggestions(serverURI).then(suggestions => {
+            const {suggestedPath} = this.state;
+            const p = parse(task.Config.RightURI, {}, true);
+            const untouched = p.protocol === 'fs:' && (p.pathname === '' || p.pathname === '/' || p.pathname === suggestedPath);
+            const s = {folderSuggestions: suggestions};
+            if(untouched && suggestions.length){
+                p.set('pathname', suggestions[0].URIPath);
+                task.Config.RightURI = p.toString();
+                s.suggestedPath = suggestions[0].URIPath;
+                s.RightURIInvalid = false;
+                s.RightURIInvalidMsg = undefined;
+            }
+            this.setState(s);
+        });
+    }
+
+    applySuggestion(suggestion){
+        const {task} = this.state;
+        const p = parse(task.Config.RightURI, {}, true);
+        p.set('pathname', suggestion.URIPath);
+        this.setState({suggestedPath: suggestion.URIPath});
+        this.onChangeURI('RightURI', p.toString());
     }
 
     save(){
@@ -143,6 +165,9 @@ class Editor extends React.Component {
             s[field + 'InvalidMsg'] = undefined
         }
         this.setState(s);
+        if(this.state.isNew && field === 'LeftURI' && parsed.protocol.indexOf('http') === 0){
+            this.suggestFolders(task, value);
+        }
     }
 
     recomputeLabel(uri){
@@ -156,8 +181,8 @@ class Editor extends React.Component {
 
     render() {
         const {task, isNew, editRightType, editLeftType, editDir, showAdvanced, LeftURIInvalid, RightURIInvalid,
-            LeftURIInvalidMsg, RightURIInvalidMsg, leftServerError, rightServerError} = this.state;
-        const {onDismiss, t, socket} = this.props;
+            LeftURIInvalidMsg, RightURIInvalidMsg, leftServerError, rightServerError, folderSuggestions, filterSets} = this.state;
+        const {onDismiss, t, socket, syncTasks} = this.props;
         const leftType = parse(task.Config.LeftURI, {}, true)['protocol'].replace(":", "");
         const rightType = parse(task.Config.RightURI, {}, true)['protocol'].replace(":", "");
         const sectionStyles = {root:{backgroundColor:'rgb(243, 245, 246)', borderRadius: 8, padding: 16, paddingTop: 8}};
@@ -221,7 +246,24 @@ class Editor extends React.Component {
                             invalid={RightURIInvalidMsg}
                             serverError={rightServerError}
                         />
+                        {isNew && rightType === 'fs' && folderSuggestions && folderSuggestions.length > 1 &&
+                            <div style={{marginTop: 5, fontSize: 12}}>
+                                {t('editor.suggestions')}{' '}
+                                {folderSuggestions.filter(f => f.URIPath !== parse(task.Config.RightURI, {}, true).pathname).map(f =>
+                                    <Link key={f.Kind} title={f.Path} style={{marginRight: 10}} onClick={() => this.applySuggestion(f)}>{t('editor.suggestions.' + f.Kind)}</Link>
+                                )}
+                            </div>
+                        }
                     </Stack.Item>
+                    {isNew && !LeftURIInvalid && !RightURIInvalid &&
+                    <Stack.Item styles={sectionStyles}>
+                        <SyncPreview
+                            leftURI={task.Config.LeftURI}
+                            rightURI={task.Config.RightURI}
+                            direction={task.Config.Direction}
+                        />
+                    </Stack.Item>
+                    }
                 </Stack>
                 <Separator alignContent={"center"} styles={{root:{marginTop: 20, marginBottom: 20}}}>
                     <div style={{fontSize: 16, cursor:'pointer'}} onClick={() => {this.setState({showAdvanced:!showAdvanced})}}>{t('editor.section.advanced')} <Icon styles={{root:{fontSize: 11}}} iconName={showAdvanced?"ChevronDown":"ChevronRight"}/></div>
@@ -229,7 +271,10 @@ class Editor extends React.Component {
                 {showAdvanced &&
                     <Stack vertical tokens={{childrenGap: 8}} styles={sectionStyles}>
                         <Stack.Item>
-                            {task.Config.LeftURI && task.Config.RightURI &&
+                            {task.Config.File &&
+                            <Label>{t('editor.file').replace('%s', task.Config.File)}</Label>
+                            }
+                            {!task.Config.File && task.Config.LeftURI && task.Config.RightURI &&
                             <SelectiveFolders
                                     leftURI={task.Config.LeftURI}
                                     rightURI={task.Config.RightURI}
@@ -238,6 +283,40 @@ class Editor extends React.Component {
                                 />
                             }
                         </Stack.Item>
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.triggers.manual')}
+                                defaultChecked={task.Config.Manual}
+                                onText={t('editor.triggers.manual.enabled')}
+                                offText={t('editor.triggers.manual.disabled')}
+                                onChange={(e, v) => {task.Config.Manual = v}}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.triggers.audit')}
+                                defaultChecked={!!task.Config.AuditOnly}
+                                onText={t('editor.triggers.audit.enabled')}
+                                offText={t('editor.triggers.audit.disabled')}
+                                onChange={(e, v) => {task.Config.AuditOnly = v}}
+                            />
+                        </Stack.Item>
+                        {syncTasks && Object.keys(syncTasks).filter(k => k !== task.Config.Uuid).length > 0 &&
+                        <Stack.Item>
+                            <Dropdown
+                                label={t('editor.triggers.after')}
+                                defaultSelectedKey={task.Config.After || ''}
+                                onChange={(e, item) => {task.Config.After = item.key}}
+                                options={[
+                                    { key: '', text: t('editor.triggers.after.none') },
+                                    ...Object.keys(syncTasks).filter(k => k !== task.Config.Uuid).map(k => {
+                                        return {key: k, text: syncTasks[k].Config.Label}
+                                    })
+                                ]}
+                            />
+                        </Stack.Item>
+                        }
+                        {!task.Config.Manual && !task.Config.After &&
                         <Stack.Item>
                             <Toggle
                                 label={t('editor.triggers.realtime')}
@@ -247,8 +326,9 @@ class Editor extends React.Component {
                                 onChange={(e, v) => {task.Config.Realtime = v}}
                             />
                         </Stack.Item>
+                        }
                         <Stack.Item>
-                            {!task.Config.Realtime &&
+                            {!task.Config.Realtime && !task.Config.Manual &&
                             <Schedule
                                 label={t('editor.triggers.syncloop')}
                                 schedule={task.Config.LoopInterval}
@@ -256,6 +336,18 @@ class Editor extends React.Component {
                             />
                             }
                         </Stack.Item>
+                        {!task.Config.Realtime && !task.Config.Manual &&
+                        <Stack.Item>
+                            <TextField
+                                label={t('editor.triggers.cron')}
+                                placeholder={"0 2 * * *"}
+                                description={t('editor.triggers.cron.description')}
+                                defaultValue={task.Config.Cron}
+                                onChange={(e, v) => {task.Config.Cron = v.trim()}}
+                            />
+                        </Stack.Item>
+                        }
+                        {!task.Config.Manual &&
                         <Stack.Item>
                             <Toggle
                                 label={t('editor.triggers.hard')}
@@ -280,6 +372,371 @@ class Editor extends React.Component {
                                 }}
                             />
                         </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Dropdown
+                                label={t('editor.hidden')}
+                                defaultSelectedKey={task.Config.HiddenFiles || 'sync'}
+                                onChange={(e, item) => {task.Config.HiddenFiles = item.key}}
+                                options={[
+                                    { key: 'sync', text: t('editor.hidden.sync') },
+                                    { key: 'ignore', text: t('editor.hidden.ignore') },
+                                    { key: 'download-only', text: t('editor.hidden.download-only') },
+                                ]}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <Dropdown
+                                label={t('editor.conflicts')}
+                                defaultSelectedKey={task.Config.ConflictPolicy || 'ask'}
+                                onChange={(e, item) => {task.Config.ConflictPolicy = item.key}}
+                                options={[
+                                    { key: 'ask', text: t('editor.conflicts.ask') },
+                                    { key: 'keep-both', text: t('editor.conflicts.keep-both') },
+                                    { key: 'newest', text: t('editor.conflicts.newest') },
+                                    { key: 'keep-local', text: t('editor.conflicts.keep-local') },
+                                    { key: 'keep-remote', text: t('editor.conflicts.keep-remote') },
+                                ]}
+                            />
+                        </Stack.Item>
+                        {['Create', 'Update', 'DeleteEdit'].map(kind => (
+                            <Stack.Item key={kind}>
+                                <Dropdown
+                                    label={t('editor.conflicts.' + kind)}
+                                    defaultSelectedKey={(task.Config.ConflictDefaults && task.Config.ConflictDefaults[kind]) || ''}
+                                    onChange={(e, item) => {task.Config.ConflictDefaults = {...task.Config.ConflictDefaults, [kind]: item.key}}}
+                                    options={[
+                                        { key: '', text: t('editor.conflicts.inherit') },
+                                        { key: 'ask', text: t('editor.conflicts.ask') },
+                                        { key: 'keep-both', text: t('editor.conflicts.keep-both') },
+                                        { key: 'newest', text: t('editor.conflicts.newest') },
+                                        { key: 'keep-local', text: t('editor.conflicts.keep-local') },
+                                        { key: 'keep-remote', text: t('editor.conflicts.keep-remote') },
+                                        ...(kind === 'DeleteEdit' ? [
+                                            { key: 'keep-edit', text: t('editor.conflicts.keep-edit') },
+                                            { key: 'keep-deletion', text: t('editor.conflicts.keep-deletion') },
+                                        ] : []),
+                                    ]}
+                                />
+                            </Stack.Item>
+                        ))}
+                        <Stack.Item>
+                            <Dropdown
+                                label={t('editor.profile')}
+                                defaultSelectedKey={task.Config.Profile || 'default'}
+                                onChange={(e, item) => {task.Config.Profile = item.key === 'default' ? '' : item.key}}
+                                options={[
+                                    { key: 'default', text: t('editor.profile.default') },
+                                    { key: 'low-power', text: t('editor.profile.low-power') },
+                                ]}
+                            />
+                        </Stack.Item>
+                        {task.Config.Profile === 'low-power' &&
+                        <Stack.Item>
+                            <TextField
+                                type={"number"}
+                                label={t('editor.profile.scan-minutes')}
+                                defaultValue={task.Config.ScanMinutes || 15}
+                                onChange={(e, v) => {task.Config.ScanMinutes = parseInt(v) || 0}}
+                            />
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.cloud-compat')}
+                                defaultChecked={!!task.Config.CloudCompat}
+                                onText={t('editor.cloud-compat.enabled')}
+                                offText={t('editor.cloud-compat.disabled')}
+                                onChange={(e, v) => {task.Config.CloudCompat = v ? {} : null}}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.track-actors')}
+                                defaultChecked={!!task.Config.TrackActors}
+                                onText={t('editor.track-actors.enabled')}
+                                offText={t('editor.track-actors.disabled')}
+                                onChange={(e, v) => {task.Config.TrackActors = v}}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.privacy')}
+                                defaultChecked={!!task.Config.Privacy}
+                                onText={t('editor.privacy.enabled')}
+                                offText={t('editor.privacy.disabled')}
+                                onChange={(e, v) => {task.Config.Privacy = v}}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.digests')}
+                                defaultChecked={!!task.Config.Digests}
+                                onText={t('editor.digests.enabled')}
+                                offText={t('editor.digests.disabled')}
+                                onChange={(e, v) => {task.Config.Digests = v}}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <TextField
+                                label={t('editor.manifest')}
+                                placeholder={t('editor.manifest.placeholder')}
+                                defaultValue={task.Config.ManifestPath}
+                                onChange={(e, v) => {task.Config.ManifestPath = v}}
+                            />
+                        </Stack.Item>
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.trash')}
+                                defaultChecked={!!task.Config.Trash}
+                                onText={t('editor.trash.enabled')}
+                                offText={t('editor.trash.disabled')}
+                                onChange={(e, v) => {task.Config.Trash = v ? {KeepDays: 30, MaxSizeGB: 0} : null}}
+                            />
+                        </Stack.Item>
+                        {task.Config.Trash &&
+                        <Stack.Item>
+                            <Stack horizontal tokens={{childrenGap: 8}}>
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.trash.days')}
+                                    defaultValue={task.Config.Trash.KeepDays}
+                                    onChange={(e, v) => {task.Config.Trash.KeepDays = parseInt(v) || 0}}
+                                />
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.trash.size')}
+                                    defaultValue={task.Config.Trash.MaxSizeGB}
+                                    onChange={(e, v) => {task.Config.Trash.MaxSizeGB = parseFloat(v) || 0}}
+                                />
+                            </Stack>
+                        </Stack.Item>
+                        }
+                        {task.Config.Direction !== 'Bi' &&
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.consistent-reads')}
+                                defaultChecked={!!task.Config.ConsistentReads}
+                                onText={t('editor.consistent-reads.enabled')}
+                                offText={t('editor.consistent-reads.disabled')}
+                                onChange={(e, v) => {task.Config.ConsistentReads = v}}
+                            />
+                        </Stack.Item>
+                        }
+                        {task.Config.Direction !== 'Bi' &&
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.append-only')}
+                                defaultChecked={!!task.Config.AppendOnly}
+                                onText={t('editor.append-only.enabled')}
+                                offText={t('editor.append-only.disabled')}
+                                onChange={(e, v) => {task.Config.AppendOnly = v}}
+                            />
+                        </Stack.Item>
+                        }
+                        {task.Config.Direction !== 'Bi' &&
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.retention')}
+                                defaultChecked={!!task.Config.Retention}
+                                onText={t('editor.retention.enabled')}
+                                offText={t('editor.retention.disabled')}
+                                onChange={(e, v) => {task.Config.Retention = v ? {KeepDeletedDays: 30, KeepVersionsDays: 30, MaxSizeGB: 0} : null}}
+                            />
+                        </Stack.Item>
+                        }
+                        {task.Config.Direction !== 'Bi' && task.Config.Retention &&
+                        <Stack.Item>
+                            <Stack horizontal tokens={{childrenGap: 8}}>
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.retention.deleted')}
+                                    defaultValue={task.Config.Retention.KeepDeletedDays}
+                                    onChange={(e, v) => {task.Config.Retention.KeepDeletedDays = parseInt(v) || 0}}
+                                />
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.retention.versions')}
+                                    defaultValue={task.Config.Retention.KeepVersionsDays}
+                                    onChange={(e, v) => {task.Config.Retention.KeepVersionsDays = parseInt(v) || 0}}
+                                />
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.retention.max-size')}
+                                    defaultValue={task.Config.Retention.MaxSizeGB}
+                                    onChange={(e, v) => {task.Config.Retention.MaxSizeGB = parseFloat(v) || 0}}
+                                />
+                            </Stack>
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.transfers')}
+                                defaultChecked={!!task.Config.Transfers}
+                                onText={t('editor.transfers.enabled')}
+                                offText={t('editor.transfers.disabled')}
+                                onChange={(e, v) => {task.Config.Transfers = v ? {UploadKB: 0, DownloadKB: 0, Parallel: 0} : null}}
+                            />
+                        </Stack.Item>
+                        {task.Config.Transfers &&
+                        <Stack.Item>
+                            <Stack horizontal tokens={{childrenGap: 8}}>
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.transfers.upload')}
+                                    defaultValue={task.Config.Transfers.UploadKB}
+                                    onChange={(e, v) => {task.Config.Transfers.UploadKB = parseInt(v) || 0}}
+                                />
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.transfers.download')}
+                                    defaultValue={task.Config.Transfers.DownloadKB}
+                                    onChange={(e, v) => {task.Config.Transfers.DownloadKB = parseInt(v) || 0}}
+                                />
+                                <TextField
+                                    type={"number"}
+                                    label={t('editor.transfers.parallel')}
+                                    defaultValue={task.Config.Transfers.Parallel}
+                                    onChange={(e, v) => {task.Config.Transfers.Parallel = parseInt(v) || 0}}
+                                />
+                            </Stack>
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.import')}
+                                defaultChecked={!!task.Config.Import}
+                                onText={t('editor.import.enabled')}
+                                offText={t('editor.import.disabled')}
+                                onChange={(e, v) => {task.Config.Import = v ? {Template: ''} : null}}
+                            />
+                        </Stack.Item>
+                        {task.Config.Import &&
+                        <Stack.Item>
+                            <TextField
+                                label={t('editor.import.template')}
+                                placeholder={"Photos/{{.Year}}/{{.Month}}/{{.Name}}{{.Ext}}"}
+                                description={t('editor.import.template.description')}
+                                defaultValue={task.Config.Import.Template}
+                                onChange={(e, v) => {task.Config.Import.Template = v}}
+                            />
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.archive')}
+                                defaultChecked={!!task.Config.Archive}
+                                onText={t('editor.archive.enabled')}
+                                offText={t('editor.archive.disabled')}
+                                onChange={(e, v) => {task.Config.Archive = v ? {Format: 'zip'} : null}}
+                            />
+                        </Stack.Item>
+                        {task.Config.Archive &&
+                        <Stack.Item>
+                            <Stack horizontal tokens={{childrenGap: 8}} verticalAlign={"end"}>
+                                <Dropdown
+                                    label={t('editor.archive.format')}
+                                    defaultSelectedKey={task.Config.Archive.Format || 'zip'}
+                                    onChange={(e, item) => {task.Config.Archive.Format = item.key}}
+                                    options={[
+                                        {key:'zip', text:'ZIP'},
+                                        {key:'tar', text:'TAR'},
+                                        {key:'tar.gz', text:'TAR.GZ'},
+                                    ]}
+                                />
+                                <TextField
+                                    label={t('editor.archive.name')}
+                                    placeholder={task.Config.Label}
+                                    defaultValue={task.Config.Archive.Name}
+                                    onChange={(e, v) => {task.Config.Archive.Name = v}}
+                                />
+                                <TextField
+                                    label={t('editor.archive.versions')}
+                                    defaultValue={task.Config.Archive.Versions}
+                                    onChange={(e, v) => {task.Config.Archive.Versions = parseInt(v) || 0}}
+                                />
+                            </Stack>
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Toggle
+                                label={t('editor.permissions')}
+                                defaultChecked={!!task.Config.Permissions}
+                                onText={t('editor.permissions.enabled')}
+                                offText={t('editor.permissions.disabled')}
+                                onChange={(e, v) => {task.Config.Permissions = v ? {FileMode: '0640', DirMode: '0750', Inherit: false} : null}}
+                            />
+                        </Stack.Item>
+                        {task.Config.Permissions &&
+                        <Stack.Item>
+                            <Stack horizontal tokens={{childrenGap: 8}} verticalAlign={"end"}>
+                                <TextField
+                                    label={t('editor.permissions.file')}
+                                    disabled={task.Config.Permissions.Inherit}
+                                    defaultValue={task.Config.Permissions.FileMode}
+                                    onChange={(e, v) => {task.Config.Permissions.FileMode = v}}
+                                />
+                                <TextField
+                                    label={t('editor.permissions.dir')}
+                                    disabled={task.Config.Permissions.Inherit}
+                                    defaultValue={task.Config.Permissions.DirMode}
+                                    onChange={(e, v) => {task.Config.Permissions.DirMode = v}}
+                                />
+                                <Toggle
+                                    label={t('editor.permissions.inherit')}
+                                    defaultChecked={task.Config.Permissions.Inherit}
+                                    onChange={(e, v) => {task.Config.Permissions.Inherit = v}}
+                                />
+                            </Stack>
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <TextField
+                                label={t('editor.ignores')}
+                                multiline={true}
+                                autoAdjustHeight={true}
+                                placeholder={"*.tmp\nnode_modules/\n.git/"}
+                                description={t('editor.ignores.description')}
+                                defaultValue={(task.Config.Ignores || []).join('\n')}
+                                onChange={(e, v) => {task.Config.Ignores = v.split('\n').map(l => l.trim()).filter(l => l)}}
+                            />
+                        </Stack.Item>
+                        {filterSets && filterSets.length > 0 &&
+                        <Stack.Item>
+                            <Dropdown
+                                label={t('editor.filter-sets')}
+                                placeholder={t('editor.filter-sets.placeholder')}
+                                multiSelect={true}
+                                defaultSelectedKeys={task.Config.FilterSets || []}
+                                onChange={(e, item) => {
+                                    const sets = (task.Config.FilterSets || []).filter(n => n !== item.key);
+                                    task.Config.FilterSets = item.selected ? [...sets, item.key] : sets;
+                                }}
+                                options={filterSets.map(f => ({key: f.Name, text: f.Name}))}
+                            />
+                        </Stack.Item>
+                        }
+                        <Stack.Item>
+                            <Dropdown
+                                label={t('editor.excluded')}
+                                defaultSelectedKey={task.Config.ExcludedPolicy || 'keep'}
+                                onChange={(e, item) => {task.Config.ExcludedPolicy = item.key}}
+                                options={[
+                                    { key: 'keep', text: t('editor.excluded.keep') },
+                                    { key: 'delete-local', text: t('editor.excluded.delete-local') },
+                                    { key: 'delete-remote', text: t('editor.excluded.delete-remote') },
+                                ]}
+                            />
+                        </Stack.Item>
+                        {!isNew &&
+                        <Stack.Item>
+                            <FilterPreview
+                                uuid={task.Config.Uuid}
+                                selectiveRoots={task.Config.SelectiveRoots}
+                                ignores={task.Config.Ignores}
+                            />
+                        </Stack.Item>
+                        }
                         {!isNew &&
                         <Stack.Item>
                             <Label htmlFor={"uuid"}>{t('editor.uuid')}</Label>
@@ -0,0 +1,145 @@
+/**
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+import React from 'react'
+import {Label} from "office-ui-fabric-react/lib/Label"
+import {Spinner, SpinnerSize} from "office-ui-fabric-react/lib/Spinner"
+import humanize from 'humanize'
+import {withTranslation} from 'react-i18next'
+import buildUrl from "../models/Url";
+
+/**
+ * Shows the files that would be excluded or included by the filters edited on an existing task, before saving.
+ */
+class FilterPreview extends React.Component {
+
+    constructor(props) {
+        super(props);
+        this.state = {loading: false};
+    }
+
+    componentDidUpdate(prevProps) {
+        const {selectiveRoots, ignores} = this.props;
+        if (JSON.stringify(prevProps.selectiveRoots) !== JSON.stringify(selectiveRoots) || JSON.stringify(prevProps.ignores) !== JSON.stringify(ignores)) {
+            this.load();
+        }
+    }
+
+    componentWillUnmount() {
+        this.cancel();
+    }
+
+    cancel() {
+        if (this.timer) {
+            clearTimeout(this.timer);
+        }
+        if (this.controller) {
+            this.controller.abort();
+            this.controller = null;
+        }
+    }
+
+    load() {
+        const {uuid, selectiveRoots, ignores} = this.props;
+        this.cancel();
+        // Wait for the user to stop typing before walking both roots
+        this.timer = setTimeout(() => {
+            this.controller = new AbortController();
+            this.setState({loading: true, preview: null, error: null});
+            window.fetch(buildUrl('/preview/filters/' + uuid), {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                credentials: 'omit',
+                signal: this.controller.signal,
+                body: JSON.stringify({SelectiveRoots: selectiveRoots || [], Ignores: ignores || []})
+            }).then(response => {
+                return response.json().then(data => {
+                    if (response.status === 500) {
+                        throw new Error(data.error);
+                    }
+                    return data;
+                });
+            }).then(preview => {
+                this.setState({loading: false, preview});
+            }).catch(e => {
+                if (e.name !== 'AbortError') {
+                    this.setState({loading: false, error: e.message});
+                }
+            });
+        }, 1000);
+    }
+
+    renderFiles(files, count) {
+        const {t} = this.props;
+        return (
+            <div style={{fontSize: 12, color: '#666', maxHeight: 150, overflowY: 'auto'}}>
+                {files.map(f => (
+                    <div key={f.Path} style={{whiteSpace:'nowrap', overflow:'hidden', textOverflow:'ellipsis'}}>
+                        {f.Path} ({humanize.filesize(f.Size)}) - {t('editor.filters.effect.' + f.Effect)}
+                    </div>
+                ))}
+                {count > files.length && <div>{t('editor.filters.more').replace('%s', count - files.length)}</div>}
+            </div>
+        );
+    }
+
+    render() {
+        const {t} = this.props;
+        const {loading, preview, error} = this.state;
+        let content;
+        if (loading) {
+            content = <Spinner size={SpinnerSize.small} label={t('editor.preview.loading')} labelPosition={"right"}/>;
+        } else if (error) {
+            content = <span style={{color: '#a4262c'}}>{t('editor.preview.error')} : {error}</span>;
+        } else if (preview) {
+            content = (
+                <div>
+                    {preview.ExcludedCount > 0 &&
+                        <div>
+                            <div>{t('editor.filters.excluded').replace('%1', preview.ExcludedCount).replace('%2', humanize.filesize(preview.ExcludedBytes))}</div>
+                            {this.renderFiles(preview.Excluded || [], preview.ExcludedCount)}
+                        </div>
+                    }
+                    {preview.IncludedCount > 0 &&
+                        <div>
+                            <div>{t('editor.filters.included').replace('%1', preview.IncludedCount).replace('%2', humanize.filesize(preview.IncludedBytes))}</div>
+                            {this.renderFiles(preview.Included || [], preview.IncludedCount)}
+                        </div>
+                    }
+                    {!preview.ExcludedCount && !preview.IncludedCount &&
+                        <div>{t('editor.filters.nothing')}</div>
+                    }
+                </div>
+            );
+        } else {
+            return null;
+        }
+        return (
+            <div>
+                <Label>{t('editor.filters.preview')}</Label>
+                {content}
+            </div>
+        );
+    }
+
+}
+
+FilterPreview = withTranslation()(FilterPreview);
+export default FilterPreview
@@ -0,0 +1,130 @@
+/**
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+import React from 'react'
+import {Label} from "office-ui-fabric-react/lib/Label"
+import {Spinner, SpinnerSize} from "office-ui-fabric-react/lib/Spinner"
+import humanize from 'humanize'
+import {withTranslation} from 'react-i18next'
+import buildUrl from "../models/Url";
+
+/**
+ * Estimates the volume transferred by the first sync of a new task, once both roots are selected.
+ */
+class SyncPreview extends React.Component {
+
+    constructor(props) {
+        super(props);
+        this.state = {loading: false};
+    }
+
+    componentDidMount() {
+        this.load();
+    }
+
+    componentDidUpdate(prevProps) {
+        const {leftURI, rightURI, direction} = this.props;
+        if (prevProps.leftURI !== leftURI || prevProps.rightURI !== rightURI || prevProps.direction !== direction) {
+            this.load();
+        }
+    }
+
+    componentWillUnmount() {
+        this.cancel();
+    }
+
+    cancel() {
+        if (this.timer) {
+            clearTimeout(this.timer);
+        }
+        if (this.controller) {
+            this.controller.abort();
+            this.controller = null;
+        }
+    }
+
+    load() {
+        const {leftURI, rightURI, direction} = this.props;
+        this.cancel();
+        // Wait for the user to stop typing before walking both roots
+        this.timer = setTimeout(() => {
+            this.controller = new AbortController();
+            this.setState({loading: true, preview: null, error: null});
+            window.fetch(buildUrl('/preview'), {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                credentials: 'omit',
+                signal: this.controller.signal,
+                body: JSON.stringify({LeftURI: leftURI, RightURI: rightURI, Direction: direction})
+            }).then(response => {
+                return response.json().then(data => {
+                    if (response.status === 500) {
+                        throw new Error(data.error);
+                    }
+                    return data;
+                });
+            }).then(preview => {
+                this.setState({loading: false, preview});
+            }).catch(e => {
+                if (e.name !== 'AbortError') {
+                    this.setState({loading: false, error: e.message});
+                }
+            });
+        }, 1000);
+    }
+
+    render() {
+        const {t} = this.props;
+        const {loading, preview, error} = this.state;
+        let content;
+        if (loading) {
+            content = <Spinner size={SpinnerSize.small} label={t('editor.preview.loading')} labelPosition={"right"}/>;
+        } else if (error) {
+            content = <span style={{color: '#a4262c'}}>{t('editor.preview.error')} : {error}</span>;
+        } else if (preview) {
+            content = (
+                <div>
+                    {preview.ToRight.Files > 0 &&
+                        <div>{t('editor.preview.right').replace('%1', preview.ToRight.Files).replace('%2', humanize.filesize(preview.ToRight.Bytes))}</div>
+                    }
+                    {preview.ToLeft.Files > 0 &&
+                        <div>{t('editor.preview.left').replace('%1', preview.ToLeft.Files).replace('%2', humanize.filesize(preview.ToLeft.Bytes))}</div>
+                    }
+                    {preview.Conflicts > 0 &&
+                        <div>{t('editor.preview.conflicts').replace('%s', preview.Conflicts)}</div>
+                    }
+                    {!preview.ToRight.Files && !preview.ToLeft.Files && !preview.Conflicts &&
+                        <div>{t('editor.preview.nothing')}</div>
+                    }
+                </div>
+            );
+        }
+        return (
+            <div>
+                <Label>{t('editor.preview')}</Label>
+                {content}
+            </div>
+        );
+    }
+
+}
+
+SyncPreview = withTranslation()(SyncPreview);
+export default SyncPreview
@@ -114,12 +114,90 @@ class SyncTask extends React.Component {
 
     }
 
+    renderActiveFiles() {
+        const {state, t} = this.props;
+        const {ActiveFiles} = state;
+        if (!ActiveFiles || !ActiveFiles.length) {
+            return null;
+        }
+        const processing = ActiveFiles.filter(f => f.Phase !== 'queued').slice(0, 3);
+        const queued = ActiveFiles.filter(f => f.Phase === 'queued').length;
+        return (
+            <div style={{fontSize: 12, color: '#666'}}>
+                {processing.map(f => (
+                    <div key={f.Path} style={{whiteSpace:'nowrap', overflow:'hidden', textOverflow:'ellipsis'}}>
+                        {t('task.file.' + f.Phase)} {f.Path}
+                        {f.Total > 0 && <span> ({Math.round(f.Bytes / f.Total * 100)}%)</span>}
+                    </div>
+                ))}
+                {queued > 0 && <div>{t('task.file.queued.count').replace('%s', queued)}</div>}
+            </div>
+        );
+    }
+
+    renderErrors() {
+        const {state, socket, t} = this.props;
+        const {Errors} = state;
+        if (!Errors || !Errors.length) {
+            return null;
+        }
+        const snooze = (err) => {
+            socket.sendMessage('ERROR_SNOOZE', {UUID: state.UUID, Fingerprint: err.Fingerprint});
+        };
+        return (
+            <div style={{fontSize: 12, color: '#666'}}>
+                {Errors.map(err => {
+                    const key = 'error.' + err.Code;
+                    let msg = t(key);
+                    if (msg === key) {
+                        msg = err.Message;
+                    } else {
+                        (err.Params || []).forEach(p => {msg = msg.replace('%s', p)});
+                    }
+                    return (
+                        <div key={err.Code} style={{whiteSpace:'nowrap', overflow:'hidden', textOverflow:'ellipsis'}}>
+                            {msg}{err.Count > 1 && <span> {t('error.count').replace('%s', err.Count - 1)}</span>}
+                            {err.Occurrences > 1 && <span> - {t('error.occurrences').replace('%s', err.Occurrences)}</span>}
+                            {err.Fingerprint && <span> - <Link title={t('error.snooze.title')} onClick={() => snooze(err)}>{t('error.snooze')}</Link></span>}
+                        </div>
+                    );
+                })}
+            </div>
+        );
+    }
+
+    renderConflictCopies() {
+        const {state, socket, t} = this.props;
+        const {ConflictCopies} = state;
+        if (!ConflictCopies || !ConflictCopies.length) {
+            return null;
+        }
+        const resolve = (c, keep) => {
+            socket.sendMessage('CONFLICT_COPY', {UUID: state.UUID, Path: c.Path, Copy: c.Copy, Keep: keep});
+        };
+        return (
+            <Fragment>
+                <Label styles={{root:styles.label}}>{t('task.conflicts')}</Label>
+                {ConflictCopies.map(c => (
+                    <div key={c.Copy} style={{fontSize: 12, whiteSpace:'nowrap', overflow:'hidden', textOverflow:'ellipsis'}}>
+                        <Link onClick={() => this.openPath(c.Path, false)}>{c.Path}</Link> / <Link onClick={() => this.openPath(c.Copy, false)}>{c.Copy.split('/').pop()}</Link>
+                        &nbsp;-&nbsp;<Link onClick={() => resolve(c, 'keep-original')}>{t('task.conflicts.keep-original')}</Link>
+                        &nbsp;|&nbsp;<Link onClick={() => resolve(c, 'keep-copy')}>{t('task.conflicts.keep-copy')}</Link>
+                    </div>
+                ))}
+            </Fragment>
+        );
+    }
+
     computeStatus() {
         const {state, t} = this.props;
-        const {LastProcessStatus, Status, LastSyncTime, LastOpsTime} = state;
+        const {LastProcessStatus, Status, LastSyncTime, LastOpsTime, NextScheduledRun, MaintenanceUntil, DegradedUntil} = state;
 
         switch (Status) {
             case StatusPaused:
+                if (MaintenanceUntil) {
+                    return <span>{t('task.status.maintenance').replace('%s', moment(MaintenanceUntil).fromNow())}</span>;
+                }
                 return <span>{t('task.status.paused')}</span>;
 
             case StatusRestarting:
@@ -136,6 +214,7 @@ class SyncTask extends React.Component {
                         {LastOpsTime && LastOpsTime !== emptyTime &&
                             <span>&nbsp;-&nbsp;<Link onClick={()=>{this.setState({lastPatch:true})}}>{"Display errors"}</Link></span>
                         }
+                        {this.renderErrors()}
                     </Fragment>
                 );
 
@@ -144,6 +223,7 @@ class SyncTask extends React.Component {
                     return (
                         <div>
                             <ProgressIndicator label={t('task.status.processing')} description={LastProcessStatus.StatusString} percentComplete={LastProcessStatus && LastProcessStatus.Progress}/>
+                            {this.renderActiveFiles()}
                         </div>
                     );
                 } else {
@@ -163,6 +243,12 @@ class SyncTask extends React.Component {
                         {LastOpsTime && LastOpsTime !== emptyTime &&
                             <span> - {t('task.last-ops')} : <Link onClick={()=>{this.setState({lastPatch:true})}}>{moment(LastOpsTime).fromNow()}</Link></span>
                         }
+                        {NextScheduledRun &&
+                            <span> - {t('task.next-run')} : {moment(NextScheduledRun).calendar()}</span>
+                        }
+                        {DegradedUntil &&
+                            <span> - {t('task.status.degraded').replace('%s', moment(DegradedUntil).fromNow())}</span>
+                        }
                     </Fragment>
                 );
         }
@@ -254,6 +340,7 @@ class SyncTask extends React.Component {
                                     {stats}
                                 </Fragment>
                             }
+                            {this.renderConflictCopies()}
                         </div>
                     </div>
                     <ActionBar triggerAction={this.triggerAction.bind(this)} LeftConnected={LeftInfo.Connected} RightConnected={RightInfo.Connected} Status={Status}/>
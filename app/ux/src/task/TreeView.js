@@ -212,7 +212,11 @@ class TreeView extends React.Component {
                     if (isSelected && group.node && group.node.fromTree && group.node.fromTree !== "both") {
                         create = <span style={{opacity:.47, fontStyle:'italic'}}>{this.creationLabel(group.node)}</span>
                     }
-                    return <div>{label} {create}</div>
+                    let room;
+                    if (group.node && group.node.scope === 'ROOM') {
+                        room = <span style={{opacity:.47, fontStyle:'italic'}}>({this.props.t('tree.workspace.room')})</span>
+                    }
+                    return <div>{label} {room} {create}</div>
                 }
             }}
         />
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+var (
+	auditTask   string
+	auditFrom   string
+	auditTo     string
+	auditFormat string
+	auditFile   string
+)
+
+// AuditCmd exports the operations applied by a task.
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Export the operations applied by a task",
+	Long: `Export the audit log of a task: all operations applied over a date range, with their path, direction,
+action, size, hashes before and after, and result.
+
+Dates are given as YYYY-MM-DD (whole days) or RFC3339. The format is guessed from the --file extension
+(.csv or .jsonl) unless --format is set. This command can run while Cells Sync is running: the log is then read
+through the agent, as its history storage may be locked.
+
+ cells-sync audit --task UUID --from 2024-01-01 --to 2024-03-31 --file q1.csv
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if auditTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		var found bool
+		for _, t := range config.Default().Tasks {
+			found = found || t.Uuid == auditTask
+		}
+		if !found {
+			log.Fatal("Cannot find task " + auditTask)
+		}
+		from, e := control.ParseAuditDate(auditFrom, false)
+		if e != nil {
+			log.Fatal(e)
+		}
+		to, e := control.ParseAuditDate(auditTo, true)
+		if e != nil {
+			log.Fatal(e)
+		}
+		records, e := agentAuditRecords()
+		if e != nil {
+			// Agent is not running, read the history directly
+			history, er := control.OpenTaskHistory(auditTask)
+			if er != nil {
+				log.Fatal(er)
+			}
+			records, e = endpoint.ReadAudit(history, from, to)
+			history.Close()
+		}
+		if e != nil {
+			log.Fatal(e)
+		}
+		format := auditFormat
+		if format == "" {
+			format = endpoint.FormatFromFilename(auditFile)
+		}
+		out := os.Stdout
+		if auditFile != "" {
+			f, e := os.Create(auditFile)
+			if e != nil {
+				log.Fatal(e)
+			}
+			defer f.Close()
+			out = f
+		}
+		if e := endpoint.WriteAuditRecords(records, format, out); e != nil {
+			log.Fatal(e)
+		}
+		if auditFile != "" {
+			fmt.Printf("Exported %d operations to %s\n", len(records), auditFile)
+		}
+	},
+}
+
+// agentAuditRecords loads the audit log through the running agent.
+func agentAuditRecords() ([]*endpoint.AuditRecord, error) {
+	query := url.Values{"format": {endpoint.ExportFormatJSON}, "from": {auditFrom}, "to": {auditTo}}
+	resp, e := http.Get(strings.TrimRight(config.DiscoverHttpURL(), "/") + "/audit/" + auditTask + "?" + query.Encode())
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned %d", resp.StatusCode)
+	}
+	var records []*endpoint.AuditRecord
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var r endpoint.AuditRecord
+		if e := dec.Decode(&r); e != nil {
+			break
+		}
+		records = append(records, &r)
+	}
+	return records, nil
+}
+
+func init() {
+	AuditCmd.Flags().StringVarP(&auditTask, "task", "t", "", "UUID of the task")
+	AuditCmd.Flags().StringVarP(&auditFrom, "from", "", "", "Start date (YYYY-MM-DD or RFC3339)")
+	AuditCmd.Flags().StringVarP(&auditTo, "to", "", "", "End date (YYYY-MM-DD or RFC3339)")
+	AuditCmd.Flags().StringVarP(&auditFormat, "format", "", "", "Export format (jsonl or csv)")
+	AuditCmd.Flags().StringVarP(&auditFile, "file", "f", "", "File to export to, stdout by default")
+	RootCmd.AddCommand(AuditCmd)
+}
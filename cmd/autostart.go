@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var (
+	autostartMinimized  bool
+	autostartBackground bool
+)
+
+// AutostartCmd registers or removes the automatic startup of Cells Sync with the user session.
+var AutostartCmd = &cobra.Command{
+	Use:   "autostart [enable|disable|status]",
+	Short: "Start Cells Sync automatically with the user session",
+	Long: `Register Cells Sync to start with the user session: a desktop entry in ~/.config/autostart on Linux,
+a shortcut in the Startup folder on Windows, and a login service on macOS.
+
+ - enable:  Register the automatic startup
+ - disable: Remove the automatic startup
+ - status:  Print the current startup options
+
+Options set with --minimized and --background are saved in the configuration:
+
+ - minimized:  Only show the system tray icon when started with the session
+ - background: Never start the system tray or the main window, for kiosk or server use
+`,
+	ValidArgs: []string{"enable", "disable", "status"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := config.Default()
+		switch args[0] {
+		case "enable", "disable":
+			if e := conf.SetAutoStart(args[0] == "enable"); e != nil {
+				log.Fatal("Cannot " + args[0] + " automatic startup: " + e.Error())
+			}
+		case "status":
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+		if cmd.Flags().Changed("minimized") || cmd.Flags().Changed("background") {
+			service := *conf.Service
+			if cmd.Flags().Changed("minimized") {
+				service.StartMinimized = autostartMinimized
+			}
+			if cmd.Flags().Changed("background") {
+				service.Background = autostartBackground
+			}
+			if e := conf.UpdateGlobals(nil, nil, nil, &service, nil, nil, nil, nil, nil, nil); e != nil {
+				log.Fatal("Cannot save startup options: " + e.Error())
+			}
+		}
+		fmt.Printf("Automatic startup: %t\n", conf.Service.AutoStart)
+		fmt.Printf("Start minimized:   %t\n", conf.Service.StartMinimized)
+		fmt.Printf("Background only:   %t\n", conf.Service.Background)
+	},
+}
+
+func init() {
+	AutostartCmd.Flags().BoolVar(&autostartMinimized, "minimized", false, "Only show the system tray icon when started with the session")
+	AutostartCmd.Flags().BoolVar(&autostartBackground, "background", false, "Do not start any UI process")
+	RootCmd.AddCommand(AutostartCmd)
+}
@@ -28,6 +28,7 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
 	"github.com/pydio/cells/common/log"
 )
 
@@ -38,15 +39,18 @@ var BgStartCmd = &cobra.Command{
 	PreRun: func(cmd *cobra.Command, args []string) {
 		logs := config.Default().Logs
 		os.MkdirAll(logs.Folder, 0755)
-		log.RegisterWriteSyncer(zapcore.AddSync(&lumberjack.Logger{
+		log.RegisterWriteSyncer(control.RedactLogs(zapcore.AddSync(&lumberjack.Logger{
 			Filename:   filepath.Join(logs.Folder, "sync.log"),
 			MaxAge:     logs.MaxAgeDays,   // days
 			MaxSize:    logs.MaxFilesSize, // megabytes
 			MaxBackups: logs.MaxFilesNumber,
-		}))
+		})))
+		log.RegisterWriteSyncer(control.RemoteLogs())
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		config.SetMacService(true)
+		// The service is started at login
+		startAutostart = true
 		s, err := config.GetAppService(runner)
 		if err != nil {
 			log.Fatal(err.Error())
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var (
+	clientCertAuthority string
+	clientCertFile      string
+	clientKeyFile       string
+)
+
+// ClientCertCmd configures the client certificates presented to servers.
+var ClientCertCmd = &cobra.Command{
+	Use:   "client-cert [list|set|clear]",
+	Short: "Configure client certificates (mTLS) per server",
+	Long: `Some reverse proxies require clients to present a certificate. Certificates and keys are read from PEM files,
+the key may be bundled in the certificate file.
+
+ - list:  Print the client certificate configured for each server
+ - set:   Use --cert and --key for the server given with --authority
+ - clear: Remove the client certificate of the server given with --authority
+
+Cells Sync must be restarted after a change.
+`,
+	ValidArgs: []string{"list", "set", "clear"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "list":
+			for _, a := range config.Default().PublicAuthorities() {
+				cert := a.ClientCert
+				if cert == "" {
+					cert = "(none)"
+				} else if a.ClientKey != "" {
+					cert += ", key " + a.ClientKey
+				}
+				fmt.Println(a.Id + ": " + cert)
+			}
+		case "set", "clear":
+			if clientCertAuthority == "" {
+				log.Fatal("Please provide a server with --authority (see client-cert list)")
+			}
+			if args[0] == "set" && clientCertFile == "" {
+				log.Fatal("Please provide a certificate with --cert")
+			}
+			if args[0] == "clear" {
+				clientCertFile, clientKeyFile = "", ""
+			}
+			if e := config.Default().SetClientCertificate(clientCertAuthority, clientCertFile, clientKeyFile); e != nil {
+				log.Fatal(e)
+			}
+			fmt.Println("Client certificate updated for " + clientCertAuthority)
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+	},
+}
+
+func init() {
+	ClientCertCmd.Flags().StringVarP(&clientCertAuthority, "authority", "a", "", "Id of the server, as printed by client-cert list")
+	ClientCertCmd.Flags().StringVar(&clientCertFile, "cert", "", "Path to the PEM encoded client certificate")
+	ClientCertCmd.Flags().StringVar(&clientKeyFile, "key", "", "Path to the PEM encoded private key, if not bundled with the certificate")
+	RootCmd.AddCommand(ClientCertCmd)
+}
@@ -21,6 +21,7 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 
 	"github.com/manifoldco/promptui"
@@ -32,6 +33,13 @@ import (
 	"github.com/pydio/cells-sync/config"
 )
 
+var (
+	configTask      string
+	configLeft      string
+	configRight     string
+	configDirection string
+)
+
 func exit(err error) {
 	if err != nil && err.Error() != "" {
 		log.Logger(context.Background()).Error(err.Error())
@@ -62,31 +70,37 @@ Example
  - RightUri: "fs:///Users/name/Pydio/folder"
  - Direction: "Bi"
 
+Values are prompted for, unless they are passed with --left, --right and --direction.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		t := &config.Task{
-			Uuid: uuid.New(),
+			Uuid:      uuid.New(),
+			LeftURI:   configLeft,
+			RightURI:  configRight,
+			Direction: configDirection,
 		}
 		var e error
-		l := &promptui.Prompt{Label: "Left endpoint URI"}
-		r := &promptui.Prompt{Label: "Right endpoint URI"}
-		s := promptui.Select{Label: "Sync Direction", Items: []string{"Bi", "Left", "Right"}}
-		t.LeftURI, e = l.Run()
-		if e != nil {
-			exit(e)
+		if t.LeftURI == "" {
+			l := &promptui.Prompt{Label: "Left endpoint URI"}
+			if t.LeftURI, e = l.Run(); e != nil {
+				exit(e)
+			}
 		}
-		t.RightURI, e = r.Run()
-		if e != nil {
-			exit(e)
+		if t.RightURI == "" {
+			r := &promptui.Prompt{Label: "Right endpoint URI"}
+			if t.RightURI, e = r.Run(); e != nil {
+				exit(e)
+			}
 		}
-		_, t.Direction, e = s.Run()
-		if e != nil {
-			exit(e)
+		if t.Direction == "" {
+			s := promptui.Select{Label: "Sync Direction", Items: []string{"Bi", "Left", "Right"}}
+			if _, t.Direction, e = s.Run(); e != nil {
+				exit(e)
+			}
 		}
 
-		config.Default().Tasks = append(config.Default().Tasks, t)
-		er := config.Save()
+		er := config.Default().CreateTask(t)
 		if er != nil {
 			exit(er)
 		}
@@ -98,30 +112,46 @@ Example
 var EditCmd = &cobra.Command{
 	Use:   "edit",
 	Short: "Exit existing sync via command line",
+	Long: `Edit the endpoints and direction of a task.
+
+Without --task, the task and its values are prompted for. With --task, only the values passed with --left,
+--right and --direction are changed, without prompting.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
-		tS := promptui.Select{Label: "Select Sync to Edit", Items: config.Default().Items()}
-		i, _, e := tS.Run()
+		i, e := selectTask("Select Sync to Edit")
 		if e != nil {
 			exit(e)
 		}
 
-		task := config.Default().Tasks[i]
-		l := &promptui.Prompt{Label: "Left endpoint URI", Default: task.LeftURI}
-		r := &promptui.Prompt{Label: "Right endpoint URI", Default: task.RightURI}
-		s := promptui.Select{Label: "Sync Direction", Items: []string{"Bi", "Left", "Right"}}
-		task.LeftURI, e = l.Run()
-		if e != nil {
-			exit(e)
+		task := *config.Default().Tasks[i]
+		if configTask != "" {
+			if configLeft != "" {
+				task.LeftURI = configLeft
+			}
+			if configRight != "" {
+				task.RightURI = configRight
+			}
+			if configDirection != "" {
+				task.Direction = configDirection
+			}
+		} else {
+			l := &promptui.Prompt{Label: "Left endpoint URI", Default: task.LeftURI}
+			r := &promptui.Prompt{Label: "Right endpoint URI", Default: task.RightURI}
+			s := promptui.Select{Label: "Sync Direction", Items: []string{"Bi", "Left", "Right"}}
+			task.LeftURI, e = l.Run()
+			if e != nil {
+				exit(e)
+			}
+			task.RightURI, e = r.Run()
+			if e != nil {
+				exit(e)
+			}
+			_, task.Direction, e = s.Run()
+			if e != nil {
+				exit(e)
+			}
 		}
-		task.RightURI, e = r.Run()
-		if e != nil {
-			exit(e)
-		}
-		_, task.Direction, e = s.Run()
-		if e != nil {
-			exit(e)
-		}
-		er := config.Save()
+		er := config.Default().UpdateTask(&task)
 		if er != nil {
 			exit(er)
 		}
@@ -132,20 +162,14 @@ var EditCmd = &cobra.Command{
 var DeleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete existing sync via command line",
+	Long: `Delete a task. The task is prompted for, unless it is passed with --task.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
-		tS := promptui.Select{Label: "Select Sync to Edit", Items: config.Default().Items()}
-		i, _, e := tS.Run()
+		i, e := selectTask("Select Sync to Delete")
 		if e != nil {
 			exit(e)
 		}
-		tasks := config.Default().Tasks
-		last := len(tasks) - 1
-		lastTask := tasks[last]
-		tasks[last] = tasks[i]
-		tasks[i] = lastTask
-		tasks = tasks[:last]
-		config.Default().Tasks = tasks
-		er := config.Save()
+		er := config.Default().RemoveTask(config.Default().Tasks[i])
 		if er != nil {
 			exit(er)
 		}
@@ -153,6 +177,29 @@ var DeleteCmd = &cobra.Command{
 	},
 }
 
+// selectTask returns the index of the task passed with --task, or prompts for it.
+func selectTask(label string) (int, error) {
+	if configTask != "" {
+		for i, t := range config.Default().Tasks {
+			if t.Uuid == configTask {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("cannot find task %s", configTask)
+	}
+	tS := promptui.Select{Label: label, Items: config.Default().Items()}
+	i, _, e := tS.Run()
+	return i, e
+}
+
 func init() {
+	for _, c := range []*cobra.Command{AddCmd, EditCmd} {
+		c.Flags().StringVarP(&configLeft, "left", "l", "", "Left endpoint URI")
+		c.Flags().StringVarP(&configRight, "right", "r", "", "Right endpoint URI")
+		c.Flags().StringVarP(&configDirection, "direction", "d", "", "Sync direction: Bi, Left or Right")
+	}
+	for _, c := range []*cobra.Command{EditCmd, DeleteCmd} {
+		c.Flags().StringVarP(&configTask, "task", "t", "", "UUID of the task")
+	}
 	RootCmd.AddCommand(AddCmd, EditCmd, DeleteCmd)
 }
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+)
+
+var (
+	conflictsTask     string
+	conflictsStrategy string
+	conflictsGlob     string
+	conflictsURL      string
+)
+
+// ConflictsCmd lists and resolves the conflicts of a task through the running agent.
+var ConflictsCmd = &cobra.Command{
+	Use:   "conflicts [list|resolve]",
+	Short: "List or resolve the conflicts of a task in bulk",
+	Long: `List or resolve the conflicts of a task in one command. Cells Sync must be running.
+
+ - list:    Print the conflicting paths of the task
+ - resolve: Resolve all conflicts with the same --strategy:
+            keep-local (override the server version), keep-remote (override the local version)
+            or keep-both (keep the local version as a copy named after this device)
+
+Use --path-glob to restrict to matching paths, e.g. --path-glob="/Documents/**"
+`,
+	ValidArgs: []string{"list", "resolve"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if conflictsTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		if conflictsURL == "" {
+			conflictsURL = config.DiscoverHttpURL()
+		}
+		endpoint := strings.TrimRight(conflictsURL, "/") + "/conflicts/" + conflictsTask
+		var resp *http.Response
+		var e error
+		switch args[0] {
+		case "list":
+			resp, e = http.Get(endpoint + "?glob=" + url.QueryEscape(conflictsGlob))
+		case "resolve":
+			if conflictsStrategy == "" {
+				log.Fatal("Please provide a --strategy")
+			}
+			body, _ := json.Marshal(&control.ConflictsRequest{Strategy: conflictsStrategy, PathGlob: conflictsGlob})
+			resp, e = http.Post(endpoint, "application/json", bytes.NewReader(body))
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var result control.ConflictsResponse
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			log.Fatal(e)
+		}
+		for _, p := range result.Paths {
+			fmt.Println(p)
+		}
+		if args[0] == "resolve" {
+			fmt.Printf("Submitted %d conflicts for resolution (%s)\n", len(result.Paths), conflictsStrategy)
+		} else {
+			fmt.Printf("%d conflicts\n", len(result.Paths))
+		}
+	},
+}
+
+func init() {
+	ConflictsCmd.Flags().StringVarP(&conflictsTask, "task", "t", "", "UUID of the task")
+	ConflictsCmd.Flags().StringVarP(&conflictsStrategy, "strategy", "s", "", "Resolution strategy: keep-local, keep-remote or keep-both")
+	ConflictsCmd.Flags().StringVarP(&conflictsGlob, "path-glob", "g", "", "Only process conflicts matching this glob")
+	ConflictsCmd.Flags().StringVarP(&conflictsURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(ConflictsCmd)
+}
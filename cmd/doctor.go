@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+)
+
+var doctorAuthority string
+
+// DoctorCmd checks the network path to each server.
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the servers can be reached",
+	Long: `For each server (or the one given with --authority), print the proxy used to reach it, then check that a
+connection can be opened through this proxy and that the server answers over HTTP(S).
+
+If Cells Sync is running, the open files, folder watches and memory it uses are printed with their limits.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config.InstallSharedTransport()
+		if e := config.RefreshSystemProxy(); e != nil {
+			fmt.Println("Cannot read system proxy settings: " + e.Error())
+		}
+		var found bool
+		for _, a := range config.Default().PublicAuthorities() {
+			if doctorAuthority != "" && a.Id != doctorAuthority {
+				continue
+			}
+			found = true
+			fmt.Println(a.Id)
+			doctorCheck(a.URI)
+		}
+		if !found {
+			log.Fatal("No server found, see the accounts configured in the application")
+		}
+		doctorResources()
+	},
+}
+
+// doctorResources prints the resource usage of the running agent.
+func doctorResources() {
+	fmt.Println("Resources")
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, e := client.Get(strings.TrimRight(config.DiscoverHttpURL(), "/") + "/resources")
+	if e != nil {
+		fmt.Println("  [--] Cells Sync is not running")
+		return
+	}
+	defer resp.Body.Close()
+	var usage common.ResourceUsage
+	if e := json.NewDecoder(resp.Body).Decode(&usage); e != nil {
+		fmt.Println("  [KO] Cannot read resource usage: " + e.Error())
+		return
+	}
+	figure := func(label string, value, limit int64, unit int64) {
+		if value < 0 {
+			return
+		}
+		status := "OK"
+		if limit > 0 && float64(value) >= 0.8*float64(limit) {
+			status = "!!"
+		}
+		if limit > 0 {
+			fmt.Printf("  [%s] %s: %d / %d\n", status, label, value/unit, limit/unit)
+		} else {
+			fmt.Printf("  [%s] %s: %d\n", status, label, value/unit)
+		}
+	}
+	figure("Open files", int64(usage.OpenFiles), int64(usage.MaxFiles), 1)
+	figure("Folder watches", int64(usage.Watches), int64(usage.MaxWatches), 1)
+	figure("Memory (MB)", usage.RSS, usage.MaxRSS, 1024*1024)
+	for _, w := range usage.Warnings {
+		fmt.Println("  " + w)
+	}
+}
+
+func doctorCheck(uri string) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		fmt.Println("  [KO] Invalid URL: " + e.Error())
+		return
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	p, e := config.ProxyFor(addr)
+	if e != nil {
+		fmt.Println("  [KO] Proxy configuration: " + e.Error())
+		return
+	}
+	if p == nil {
+		fmt.Println("  [OK] Proxy: none, direct connection")
+	} else {
+		auth := p.Auth
+		if auth == "" {
+			auth = config.ProxyAuthBasic
+		}
+		fmt.Printf("  [OK] Proxy: %s (%s authentication)\n", p.Redacted(), auth)
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, e := config.DialContext(ctx, "tcp", addr)
+	if e != nil {
+		fmt.Println("  [KO] Connection to " + addr + ": " + e.Error())
+		return
+	}
+	conn.Close()
+	fmt.Printf("  [OK] Connection to %s (%s)\n", addr, time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, e := client.Get(uri)
+	if e != nil {
+		fmt.Println("  [KO] Request to " + uri + ": " + e.Error())
+		return
+	}
+	resp.Body.Close()
+	fmt.Printf("  [OK] Server answered %s (%s)\n", resp.Status, time.Since(start).Round(time.Millisecond))
+}
+
+func init() {
+	DoctorCmd.Flags().StringVarP(&doctorAuthority, "authority", "a", "", "Id of the server to check")
+	RootCmd.AddCommand(DoctorCmd)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+var (
+	findTask    string
+	findName    string
+	findSince   string
+	findContent string
+)
+
+// FindCmd searches the files of a task.
+var FindCmd = &cobra.Command{
+	Use:   "find",
+	Short: "Search the files of a task by name, date or content",
+	Long: `Search the files of a sync task. Local files are read directly, and files only known from the remote
+snapshot (e.g. outside the selective roots) are listed as remote. Content search on remote files is delegated
+to the server search engine.
+
+--modified-since accepts Go durations (12h) or a number of days (7d). Name and content are matched
+case-insensitively.
+
+ cells-sync find --task UUID --name '*.xlsx' --modified-since 7d --content budget
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if findTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		var task *config.Task
+		for _, t := range config.Default().Tasks {
+			if t.Uuid == findTask {
+				task = t
+			}
+		}
+		if task == nil {
+			log.Fatal("Cannot find task " + findTask)
+		}
+		since, e := endpoint.ParseSince(findSince)
+		if e != nil {
+			log.Fatal(e)
+		}
+		q := &endpoint.FindQuery{Name: findName, ModifiedSince: since, Content: findContent}
+		remoteSide, localURI, remoteURI := "right", task.LeftURI, task.RightURI
+		localRoot, ok := endpoint.LocalPathForURI(localURI)
+		if !ok {
+			remoteSide, localURI, remoteURI = "left", task.RightURI, task.LeftURI
+			if localRoot, ok = endpoint.LocalPathForURI(localURI); !ok {
+				log.Fatal("Task does not have a local folder")
+			}
+		}
+		ignores := append([]string{}, endpoint.DefaultIgnores...)
+		if task.HiddenFiles == endpoint.HiddenFilesIgnore {
+			ignores = append(ignores, endpoint.HiddenFilesIgnores()...)
+		}
+		results, e := endpoint.FindLocal(localRoot, q, endpoint.FilterMatcher(task.SelectiveRoots, ignores))
+		if e != nil {
+			log.Fatal(e)
+		}
+		configPath := filepath.Join(config.SyncClientDataDir(), task.Uuid)
+		if entries, er := endpoint.LoadSnapshotEntries(configPath, remoteSide); er != nil {
+			log.Println("Cannot read remote snapshot, only local files are listed: " + er.Error())
+		} else if remote, er := endpoint.FindRemoteOnly(entries, localRoot, remoteURI, q); er != nil {
+			log.Println("Cannot search remote files: " + er.Error())
+		} else {
+			results = append(results, remote...)
+		}
+		for _, r := range results {
+			location := "local"
+			if !r.Local {
+				location = "remote"
+			}
+			fmt.Printf("%s\t%d\t%s\t%s\n", r.MTime.Format("2006-01-02 15:04"), r.Size, location, r.Path)
+		}
+		fmt.Printf("%d files found\n", len(results))
+	},
+}
+
+func init() {
+	FindCmd.Flags().StringVarP(&findTask, "task", "t", "", "UUID of the task")
+	FindCmd.Flags().StringVarP(&findName, "name", "n", "", "Glob pattern matched against file names")
+	FindCmd.Flags().StringVarP(&findSince, "modified-since", "", "", "Only files modified during this period (e.g. 7d, 12h)")
+	FindCmd.Flags().StringVarP(&findContent, "content", "c", "", "Keyword searched in files content")
+	RootCmd.AddCommand(FindCmd)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+)
+
+var (
+	holdTask    string
+	holdMinutes int
+	holdURL     string
+)
+
+// HoldCmd holds the local changes of a task during a big reorganization.
+var HoldCmd = &cobra.Command{
+	Use:   "hold [start|release]",
+	Short: "Hold local changes while reorganizing a synced folder",
+	Long: `Stop processing the local changes of a task while files are reorganized, e.g. when renaming or moving many
+folders at once. Changes are buffered and collapsed, and only their net result is processed on release:
+renamed files and folders are synced as moves rather than as thousands of deletions and creations.
+
+ - start:   Start buffering local changes, they are released automatically after --minutes (60 by default)
+ - release: Process the net result of the buffered changes
+
+Server changes are still applied while local changes are held. Cells Sync must be running.
+`,
+	ValidArgs: []string{"start", "release"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if holdTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		request := &control.HoldRequest{Minutes: holdMinutes}
+		switch args[0] {
+		case "start":
+		case "release":
+			request.Release = true
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+		if holdURL == "" {
+			holdURL = config.DiscoverHttpURL()
+		}
+		body, _ := json.Marshal(request)
+		resp, e := http.Post(strings.TrimRight(holdURL, "/")+"/hold/"+holdTask, "application/json", bytes.NewReader(body))
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var result control.HoldResponse
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			log.Fatal(e)
+		}
+		switch {
+		case result.Held:
+			fmt.Println("Local changes are held until released, at most until " + result.Until.Local().Format("15:04"))
+		case result.Overflow:
+			fmt.Println("Too many changes were held, a full resync was triggered")
+		default:
+			fmt.Printf("Released %d local change(s)\n", result.Released)
+		}
+	},
+}
+
+func init() {
+	HoldCmd.Flags().StringVarP(&holdTask, "task", "t", "", "UUID of the task")
+	HoldCmd.Flags().IntVarP(&holdMinutes, "minutes", "m", 0, "Release the hold automatically after this number of minutes (60 by default)")
+	HoldCmd.Flags().StringVarP(&holdURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(HoldCmd)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var (
+	loginURL      string
+	loginUser     string
+	loginToken    string
+	loginExpires  string
+	loginInsecure bool
+)
+
+// LoginCmd registers a server using a Personal Access Token, for hosts where the browser login is not available.
+var LoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Connect to a server using a Personal Access Token",
+	Long: `Register a server account without going through the browser login, e.g. on a NAS or a headless server.
+
+Generate a Personal Access Token for your user on the server, then pass it with --token, or type it when
+prompted to keep it out of the shell history. Personal Access Tokens are not refreshed: if it was generated with
+an expiration date, pass it with --expires to be warned when it expires.
+
+Cells Sync must be restarted to use the new account.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if loginURL == "" || loginUser == "" {
+			log.Fatal("Please provide the server URL with --url and your login with --user")
+		}
+		if loginToken == "" {
+			fmt.Print("Personal Access Token: ")
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			loginToken = strings.TrimSpace(line)
+		}
+		var expires time.Time
+		if loginExpires != "" {
+			var e error
+			if expires, e = time.ParseInLocation("2006-01-02", loginExpires, time.Local); e != nil {
+				log.Fatal("Cannot parse expiration date, use YYYY-MM-DD format")
+			}
+		}
+		a, e := config.Default().CreatePersonalTokenAuthority(strings.TrimRight(loginURL, "/"), loginUser, loginToken, expires, loginInsecure)
+		if e != nil {
+			log.Fatal(e)
+		}
+		fmt.Println("Logged in to " + a.Id)
+	},
+}
+
+func init() {
+	LoginCmd.Flags().StringVarP(&loginURL, "url", "u", "", "Server URL, e.g. https://cells.example.com")
+	LoginCmd.Flags().StringVarP(&loginUser, "user", "l", "", "User login")
+	LoginCmd.Flags().StringVarP(&loginToken, "token", "t", "", "Personal Access Token (prompted if empty)")
+	LoginCmd.Flags().StringVarP(&loginExpires, "expires", "e", "", "Expiration date of the token (YYYY-MM-DD)")
+	LoginCmd.Flags().BoolVar(&loginInsecure, "insecure", false, "Skip server certificate verification")
+	RootCmd.AddCommand(LoginCmd)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+)
+
+var (
+	openURLRegister   bool
+	openURLUnregister bool
+)
+
+// agentStartTimeout is the time given to the agent to start when a link is opened while it is not running.
+const agentStartTimeout = 30 * time.Second
+
+// OpenURLCmd opens cellssync:// links, and registers Cells Sync as their handler.
+var OpenURLCmd = &cobra.Command{
+	Use:   "open-url [link]",
+	Short: "Open a cellssync:// link sent by the Cells web interface",
+	Long: `Open a cellssync:// link, as sent by the "Sync to my computer" action of the Cells web interface. The task
+editor opens with the server and the remote folder filled in, only the local folder has to be chosen. Cells Sync
+is started if it is not running.
+
+Use --register to make Cells Sync the handler of cellssync:// links for the current user (a desktop entry on
+Linux, a registry key on Windows). On macOS, links are declared by the application bundle.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if openURLRegister || openURLUnregister {
+			action, do := "register", config.RegisterURLHandler
+			if openURLUnregister {
+				action, do = "unregister", config.UnregisterURLHandler
+			}
+			if e := do(); e != nil {
+				log.Fatal("Cannot " + action + " links handler: " + e.Error())
+			}
+			fmt.Printf("Links handler %sed for %s://\n", action, config.URLScheme)
+			return
+		}
+		if len(args) == 0 {
+			log.Fatal("Please provide a link to open")
+		}
+		if _, e := control.ParseSyncLink(args[0]); e != nil {
+			log.Fatal(e)
+		}
+		base, e := agentURL()
+		if e != nil {
+			log.Fatal(e)
+		}
+		body, _ := json.Marshal(&control.SyncLinkRequest{Link: args[0]})
+		resp, e := http.Post(strings.TrimRight(base, "/")+"/links", "application/json", bytes.NewReader(body))
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync: " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var result control.SyncLinkResponse
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			log.Fatal(e)
+		}
+		view := exec.Command(config.ProcessName(os.Args[0]), "webview", "--url", strings.TrimRight(base, "/")+result.Route)
+		view.Stdout = os.Stdout
+		view.Stderr = os.Stderr
+		if e := view.Run(); e != nil {
+			log.Fatal("Cannot open the task editor: " + e.Error())
+		}
+	},
+}
+
+// agentURL returns the URL of the running agent, starting it in the background if it does not answer.
+func agentURL() (string, error) {
+	ping := func() (string, bool) {
+		base := config.DiscoverHttpURL()
+		client := &http.Client{Timeout: 2 * time.Second}
+		if resp, e := client.Get(strings.TrimRight(base, "/") + "/summary"); e == nil {
+			resp.Body.Close()
+			return base, resp.StatusCode == http.StatusOK
+		}
+		return base, false
+	}
+	if base, ok := ping(); ok {
+		return base, nil
+	}
+	if e := exec.Command(config.ProcessName(os.Args[0]), "start").Start(); e != nil {
+		return "", fmt.Errorf("cannot start Cells Sync: %s", e.Error())
+	}
+	deadline := time.Now().Add(agentStartTimeout)
+	for time.Now().Before(deadline) {
+		<-time.After(time.Second)
+		if base, ok := ping(); ok {
+			return base, nil
+		}
+	}
+	return "", fmt.Errorf("Cells Sync did not start after %s", agentStartTimeout)
+}
+
+func init() {
+	OpenURLCmd.Flags().BoolVar(&openURLRegister, "register", false, "Register Cells Sync as the handler of cellssync:// links")
+	OpenURLCmd.Flags().BoolVar(&openURLUnregister, "unregister", false, "Remove the handler of cellssync:// links")
+	RootCmd.AddCommand(OpenURLCmd)
+}
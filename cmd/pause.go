@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+)
+
+var (
+	pauseTask  string
+	pauseUntil string
+	pauseFor   string
+	pauseURL   string
+)
+
+// PauseCmd pauses a task until a given time through the running agent.
+var PauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause a task until a given time, it resumes automatically afterwards",
+	Long: `Pause a task until a date or for a duration. The pause survives a restart of Cells Sync, and once it
+expires the task resumes and catches up with the changes made in the meantime. Resuming the task earlier
+cancels the pause.
+
+Examples:
+ cells-sync pause --task UUID --until "monday 9:00"
+ cells-sync pause --task UUID --until "2026-10-19 09:00"
+ cells-sync pause --task UUID --for 2h
+ cells-sync pause --task UUID --for 3d
+
+Cells Sync must be running.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if pauseTask == "" || (pauseUntil == "" && pauseFor == "") {
+			log.Fatal("Please provide a task UUID with --task and a date with --until or a duration with --for")
+		}
+		if pauseURL == "" {
+			pauseURL = config.DiscoverHttpURL()
+		}
+		body, _ := json.Marshal(&control.PauseUntilRequest{Until: pauseUntil, Duration: pauseFor})
+		resp, e := http.Post(strings.TrimRight(pauseURL, "/")+"/pause/"+pauseTask, "application/json", bytes.NewReader(body))
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var result control.PauseUntil
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			log.Fatal(e)
+		}
+		fmt.Println("Task paused until " + result.Until.Local().Format("Mon 2 Jan 2006 15:04"))
+	},
+}
+
+func init() {
+	PauseCmd.Flags().StringVarP(&pauseTask, "task", "t", "", "UUID of the task")
+	PauseCmd.Flags().StringVarP(&pauseUntil, "until", "u", "", "End of the pause: a date, a time of day or a weekday with an optional time")
+	PauseCmd.Flags().StringVarP(&pauseFor, "for", "f", "", "Duration of the pause, e.g. 90m, 2h or 3d")
+	PauseCmd.Flags().StringVarP(&pauseURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(PauseCmd)
+}
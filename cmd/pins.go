@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var pinsAuthority string
+
+// PinsCmd reviews and resets the certificates pinned for each server.
+var PinsCmd = &cobra.Command{
+	Use:   "pins [list|reset|remove]",
+	Short: "Review and reset pinned server certificates",
+	Long: `Certificates of servers that are not trusted by the system (e.g. signed by a private CA) are pinned at first
+login, and connections are refused if they change.
+
+ - list:   Print the pinned fingerprint of each server and the one it currently presents
+ - reset:  Pin the certificate currently presented by the server given with --authority
+ - remove: Remove the pin of the server given with --authority
+
+Cells Sync must be restarted after a reset or remove.
+`,
+	ValidArgs: []string{"list", "reset", "remove"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "list":
+			for _, a := range config.Default().PublicAuthorities() {
+				pin := a.CertificatePin
+				if pin == "" {
+					pin = "(not pinned)"
+				}
+				fmt.Println(a.Id)
+				fmt.Println("  Pinned:  " + pin)
+				if info, e := config.FetchCertificate(a.URI); e == nil {
+					fmt.Println("  Current: " + info.Fingerprint)
+					fmt.Printf("  Subject: %s, issued by %s, expires %s\n", info.Subject, info.Issuer, info.NotAfter.Format("2006-01-02"))
+				} else {
+					fmt.Println("  Current: " + e.Error())
+				}
+			}
+		case "reset", "remove":
+			if pinsAuthority == "" {
+				log.Fatal("Please provide a server with --authority (see pins list)")
+			}
+			pin, e := config.Default().ResetCertificatePin(pinsAuthority, args[0] == "remove")
+			if e != nil {
+				log.Fatal(e)
+			}
+			if pin == "" {
+				fmt.Println("Pin removed for " + pinsAuthority)
+			} else {
+				fmt.Println("Pinned " + pin + " for " + pinsAuthority)
+			}
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+	},
+}
+
+func init() {
+	PinsCmd.Flags().StringVarP(&pinsAuthority, "authority", "a", "", "Id of the server, as printed by pins list")
+	RootCmd.AddCommand(PinsCmd)
+}
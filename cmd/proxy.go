@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var (
+	proxyAuthority string
+	proxyOverride  = &config.Proxy{}
+)
+
+// ProxyCmd configures per-server proxy overrides.
+var ProxyCmd = &cobra.Command{
+	Use:   "proxy [list|set|clear]",
+	Short: "Override the proxy used for a given server",
+	Long: `The global proxy is configured in the application settings. It can be overridden for a given server, e.g. to
+reach an intranet server directly (--url direct) or through a dedicated proxy.
+
+ - list:  Print the proxy override of each server
+ - set:   Override the proxy of the server given with --authority
+ - clear: Remove the override of the server given with --authority
+
+Use "cells-sync doctor" to check the result. Cells Sync must be restarted after a change.
+`,
+	ValidArgs: []string{"list", "set", "clear"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "list":
+			for _, a := range config.Default().Authorities {
+				override := "(global settings)"
+				if a.Proxy != nil {
+					override = a.Proxy.Redacted()
+				}
+				fmt.Println(a.Id + ": " + override)
+			}
+		case "set", "clear":
+			if proxyAuthority == "" {
+				log.Fatal("Please provide a server with --authority (see proxy list)")
+			}
+			p := proxyOverride
+			if args[0] == "clear" {
+				p = nil
+			} else if p.URL == "" {
+				log.Fatal("Please provide a proxy with --url")
+			}
+			if e := config.Default().SetAuthorityProxy(proxyAuthority, p); e != nil {
+				log.Fatal(e)
+			}
+			fmt.Println("Proxy updated for " + proxyAuthority)
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+	},
+}
+
+func init() {
+	ProxyCmd.Flags().StringVarP(&proxyAuthority, "authority", "a", "", "Id of the server, as printed by proxy list")
+	ProxyCmd.Flags().StringVar(&proxyOverride.URL, "url", "", "Proxy URL (http://, https://, socks5://) or direct")
+	ProxyCmd.Flags().StringVar(&proxyOverride.Auth, "auth", config.ProxyAuthBasic, "Authentication for http(s) proxies: basic, ntlm or negotiate")
+	ProxyCmd.Flags().StringVar(&proxyOverride.Username, "username", "", "Proxy username (DOMAIN\\user for ntlm)")
+	ProxyCmd.Flags().StringVar(&proxyOverride.Password, "password", "", "Proxy password")
+	ProxyCmd.Flags().StringVar(&proxyOverride.NoProxy, "no-proxy", "", "Comma-separated list of hosts contacted directly")
+	RootCmd.AddCommand(ProxyCmd)
+}
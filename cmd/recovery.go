@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+var (
+	recoveryTask    string
+	recoveryIDs     string
+	recoveryMaxRisk string
+	recoveryURL     string
+)
+
+// RecoveryCmd reviews and applies the recovery plan of a task through the running agent.
+var RecoveryCmd = &cobra.Command{
+	Use:   "recovery [show|apply]",
+	Short: "Review and apply the operations needed to bring a task back in sync",
+	Long: `Recovery plans are generated when "state verify" or a failed sync find that the snapshots of a task do not
+match the actual contents anymore. They list the operations needed to reconverge, classified by risk:
+
+ - low:    nothing is replaced or removed, e.g. downloading a missing file
+ - medium: local contents change, previous versions are kept, e.g. keeping the local version as a copy
+ - high:   contents are replaced on the server
+
+Cells Sync must be running.
+
+ - show:  Print the pending operations of the plan
+ - apply: Apply the operations listed with --ids (e.g. --ids=1,4,5), and/or all operations up to --max-risk
+`,
+	ValidArgs: []string{"show", "apply"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if recoveryTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		if recoveryURL == "" {
+			recoveryURL = config.DiscoverHttpURL()
+		}
+		target := strings.TrimRight(recoveryURL, "/") + "/recovery/" + recoveryTask
+		var resp *http.Response
+		var e error
+		switch args[0] {
+		case "show":
+			resp, e = http.Get(target)
+		case "apply":
+			approval := &control.RecoveryApproval{MaxRisk: recoveryMaxRisk}
+			for _, id := range strings.Split(recoveryIDs, ",") {
+				if id = strings.TrimSpace(id); id == "" {
+					continue
+				}
+				i, er := strconv.Atoi(id)
+				if er != nil {
+					log.Fatal("Invalid operation ID " + id)
+				}
+				approval.IDs = append(approval.IDs, i)
+			}
+			if len(approval.IDs) == 0 && approval.MaxRisk == "" {
+				log.Fatal("Please approve operations with --ids or --max-risk")
+			}
+			if approval.MaxRisk != "" && endpoint.RiskRank(approval.MaxRisk) > endpoint.RiskRank(endpoint.RiskHigh) {
+				log.Fatal("Unknown risk level " + approval.MaxRisk + ", use low, medium or high")
+			}
+			body, _ := json.Marshal(approval)
+			resp, e = http.Post(target, "application/json", bytes.NewReader(body))
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var result control.RecoveryResponse
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			log.Fatal(e)
+		}
+		if args[0] == "apply" {
+			printRecoveryOperations(result.Operations)
+			fmt.Printf("Submitted %d operations, check the logs of the task for their outcome\n", len(result.Operations))
+			return
+		}
+		if result.Plan == nil || len(result.Plan.Pending()) == 0 {
+			fmt.Println("No recovery needed for this task")
+			return
+		}
+		fmt.Printf("Plan generated by %s on %s\n", result.Plan.Origin, result.Plan.Created.Format("2006-01-02 15:04"))
+		printRecoveryOperations(result.Plan.Pending())
+		fmt.Printf("%d pending operations\n", len(result.Plan.Pending()))
+	},
+}
+
+func printRecoveryOperations(ops []*endpoint.RecoveryOperation) {
+	for _, op := range ops {
+		fmt.Printf("%4d  %-6s  %-9s  %s\n", op.ID, op.Risk, op.Action, op.Path)
+		fmt.Println("      " + op.Reason)
+		if op.Error != "" {
+			fmt.Println("      Last attempt failed: " + op.Error)
+		}
+	}
+}
+
+func init() {
+	RecoveryCmd.Flags().StringVarP(&recoveryTask, "task", "t", "", "UUID of the task")
+	RecoveryCmd.Flags().StringVarP(&recoveryIDs, "ids", "", "", "Comma-separated IDs of the operations to apply")
+	RecoveryCmd.Flags().StringVarP(&recoveryMaxRisk, "max-risk", "", "", "Apply all operations up to this risk level: low, medium or high")
+	RecoveryCmd.Flags().StringVarP(&recoveryURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(RecoveryCmd)
+}
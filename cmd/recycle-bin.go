@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+var (
+	recycleTask string
+	recyclePath string
+	recycleURL  string
+)
+
+// RecycleBinCmd lists and restores the deletions sent to the server recycle bin.
+var RecycleBinCmd = &cobra.Command{
+	Use:   "recycle-bin [list|restore]",
+	Short: "List and restore files deleted from the server by a task",
+	Long: `Files and folders deleted locally are moved to the recycle bin of the server rather than deleted
+permanently, unless the task uses the PermanentDeletes option or the server does not support it.
+
+ - list:    Print the deletions of the task that can still be restored
+ - restore: Move the path given with --path back from the server recycle bin, it is synced again afterwards
+
+Cells Sync must be running.
+`,
+	ValidArgs: []string{"list", "restore"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if recycleTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		if recycleURL == "" {
+			recycleURL = config.DiscoverHttpURL()
+		}
+		endpointURL := strings.TrimRight(recycleURL, "/") + "/recycle-bin/" + recycleTask
+		var resp *http.Response
+		var e error
+		switch args[0] {
+		case "list":
+			resp, e = http.Get(endpointURL)
+		case "restore":
+			if recyclePath == "" {
+				log.Fatal("Please provide a path with --path (see recycle-bin list)")
+			}
+			body, _ := json.Marshal(&control.RecycleRestoreRequest{Path: recyclePath})
+			resp, e = http.Post(endpointURL, "application/json", bytes.NewReader(body))
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var nodes []*endpoint.RecycledNode
+		if e := json.NewDecoder(resp.Body).Decode(&nodes); e != nil {
+			log.Fatal(e)
+		}
+		if args[0] == "restore" {
+			for _, n := range nodes {
+				fmt.Println("Restored " + n.Path)
+			}
+			return
+		}
+		if len(nodes) == 0 {
+			fmt.Println("No deletion to restore")
+		}
+		for _, n := range nodes {
+			fmt.Println(n.Deleted.Local().Format("2006-01-02 15:04") + "  " + n.Path)
+		}
+	},
+}
+
+func init() {
+	RecycleBinCmd.Flags().StringVarP(&recycleTask, "task", "t", "", "UUID of the task")
+	RecycleBinCmd.Flags().StringVarP(&recyclePath, "path", "p", "", "File or folder to restore, relative to the task roots")
+	RecycleBinCmd.Flags().StringVarP(&recycleURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(RecycleBinCmd)
+}
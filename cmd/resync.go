@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+)
+
+var (
+	resyncTask      string
+	resyncPath      string
+	resyncDirection string
+	resyncURL       string
+)
+
+// ResyncCmd verifies again one folder of a task through the running agent.
+var ResyncCmd = &cobra.Command{
+	Use:   "resync",
+	Short: "Verify again one folder of a task, when it is suspected to be out of sync",
+	Long: `Drop the snapshot entries under a folder and compare it again on both sides, without resyncing the whole
+task. Files found on one side only are copied to the other side, and files differing on both sides become
+conflicts, unless a direction is forced:
+
+ - download: local files are replaced by the server versions
+ - upload:   server files are replaced by the local versions
+
+Cells Sync must be running and the task must be idle.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if resyncTask == "" || resyncPath == "" {
+			log.Fatal("Please provide a task UUID with --task and a folder with --path")
+		}
+		if resyncURL == "" {
+			resyncURL = config.DiscoverHttpURL()
+		}
+		body, _ := json.Marshal(&control.SubtreeResync{Path: resyncPath, Direction: resyncDirection})
+		resp, e := http.Post(strings.TrimRight(resyncURL, "/")+"/resync/"+resyncTask, "application/json", bytes.NewReader(body))
+		if e != nil {
+			log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			log.Fatal(errResp["error"])
+		}
+		var result control.SubtreeResyncResponse
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			log.Fatal(e)
+		}
+		r := result.Report
+		fmt.Printf("Compared %s: %d items on the left, %d on the right\n", result.Path, r.LeftNodes, r.RightNodes)
+		for _, p := range r.OnlyLeft {
+			fmt.Println("  left only   " + p)
+		}
+		for _, p := range r.OnlyRight {
+			fmt.Println("  right only  " + p)
+		}
+		for _, p := range r.Different {
+			fmt.Println("  different   " + p)
+		}
+		fmt.Println("Snapshots were invalidated under " + result.Path + ", a sync pass was triggered")
+	},
+}
+
+func init() {
+	ResyncCmd.Flags().StringVarP(&resyncTask, "task", "t", "", "UUID of the task")
+	ResyncCmd.Flags().StringVarP(&resyncPath, "path", "p", "", "Folder to verify, relative to the task roots")
+	ResyncCmd.Flags().StringVarP(&resyncDirection, "direction", "d", "", "Force different files to be downloaded or uploaded: download or upload")
+	ResyncCmd.Flags().StringVarP(&resyncURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(ResyncCmd)
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+)
+
+// Exit codes of the run command
+const (
+	runExitSuccess      = 0
+	runExitFailure      = 1
+	runExitPartial      = 2
+	runExitConflicts    = 3
+	runExitUnauthorized = 4
+	runExitTimeout      = 5
+)
+
+var (
+	runTask    string
+	runWait    bool
+	runTimeout time.Duration
+	runURL     string
+)
+
+// RunCmd triggers a sync pass of a task through the running agent, and optionally waits for its outcome.
+var RunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Trigger a sync pass, for cron jobs and CI pipelines",
+	Long: `Trigger a sync pass of a task. Cells Sync must be running.
+
+With --wait, the command blocks until the pass completes and exits with a code describing its outcome:
+
+ 0  success
+ 1  the pass could not be triggered (Cells Sync is not running, unknown task...)
+ 2  partial: some files could not be synced
+ 3  conflicts need to be resolved
+ 4  authentication failed, log in again to the server
+ 5  the pass did not complete before --timeout
+
+ cells-sync run --task=UUID --wait --timeout=30m
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if runTask == "" {
+			exitRun(runExitFailure, "Please provide a task UUID with --task")
+		}
+		if runURL == "" {
+			runURL = config.DiscoverHttpURL()
+		}
+		query := url.Values{}
+		if runWait {
+			query.Set("wait", "true")
+			query.Set("timeout", runTimeout.String())
+		}
+		endpoint := strings.TrimRight(runURL, "/") + "/run/" + runTask + "?" + query.Encode()
+		// Leave some time for the agent to answer after its own timeout
+		client := &http.Client{Timeout: runTimeout + time.Minute}
+		resp, e := client.Post(endpoint, "application/json", nil)
+		if e != nil {
+			exitRun(runExitFailure, "Cannot contact Cells Sync, is it running? "+e.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+			var errResp map[string]string
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			exitRun(runExitFailure, errResp["error"])
+		}
+		var result control.RunResult
+		if e := json.NewDecoder(resp.Body).Decode(&result); e != nil {
+			exitRun(runExitFailure, e.Error())
+		}
+		switch result.Outcome {
+		case control.RunOutcomeStarted:
+			fmt.Println("Sync pass triggered")
+			exitRun(runExitSuccess, "")
+		case control.RunOutcomeTimeout:
+			exitRun(runExitTimeout, fmt.Sprintf("Sync pass did not complete after %s", runTimeout))
+		}
+		fmt.Printf("Processed %d files and folders, %d conflicts, %d errors\n", result.Processed, result.Conflicts, result.Errors)
+		for _, m := range result.ErrorMessages {
+			fmt.Fprintln(os.Stderr, m)
+		}
+		switch result.Outcome {
+		case control.RunOutcomeUnauthorized:
+			exitRun(runExitUnauthorized, "Authentication failed, please log in again")
+		case control.RunOutcomeConflicts:
+			exitRun(runExitConflicts, "Conflicts must be resolved, see cells-sync conflicts list")
+		case control.RunOutcomePartial:
+			exitRun(runExitPartial, "Some files could not be synced")
+		}
+		exitRun(runExitSuccess, "")
+	},
+}
+
+// exitRun prints a message on stderr, if any, and exits with the given code.
+func exitRun(code int, message string) {
+	if message != "" {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	os.Exit(code)
+}
+
+func init() {
+	RunCmd.Flags().StringVarP(&runTask, "task", "t", "", "UUID of the task")
+	RunCmd.Flags().BoolVarP(&runWait, "wait", "w", false, "Wait for the pass to complete and exit with a code describing its outcome")
+	RunCmd.Flags().DurationVar(&runTimeout, "timeout", 30*time.Minute, "Maximum time to wait for the pass with --wait")
+	RunCmd.Flags().StringVarP(&runURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(RunCmd)
+}
@@ -22,8 +22,11 @@
 package cmd
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"runtime"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap/zapcore"
@@ -34,10 +37,21 @@ import (
 	"github.com/pydio/cells/common/log"
 )
 
-var startNoUi bool
+var (
+	startNoUi      bool
+	startAutostart bool
+	startPaused    bool
+	startSimulate  bool
+)
 
 func runner() {
+	if startSimulate {
+		// Time only moves when advanced through the /debug/clock API
+		config.SetClock(config.NewSimulatedClock(time.Now()))
+	}
 	s := control.NewSupervisor(startNoUi)
+	s.SetAutoStarted(startAutostart)
+	s.SetStartPaused(startPaused)
 	s.Serve()
 }
 
@@ -48,20 +62,48 @@ var StartCmd = &cobra.Command{
 	PreRun: func(cmd *cobra.Command, args []string) {
 		logs := config.Default().Logs
 		os.MkdirAll(logs.Folder, 0755)
-		log.RegisterWriteSyncer(zapcore.AddSync(&lumberjack.Logger{
+		log.RegisterWriteSyncer(control.RedactLogs(zapcore.AddSync(&lumberjack.Logger{
 			Filename:   filepath.Join(logs.Folder, "sync.log"),
 			MaxAge:     logs.MaxAgeDays,   // days
 			MaxSize:    logs.MaxFilesSize, // megabytes
 			MaxBackups: logs.MaxFilesNumber,
-		}))
+		})))
+		log.RegisterWriteSyncer(control.RemoteLogs())
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		s := control.NewSupervisor(startNoUi)
-		s.Serve()
+		if config.RunningAsWindowsService() {
+			// Started by the service manager in session 0, the UI is attached from the user sessions
+			runService()
+			return
+		}
+		if runtime.GOOS == "windows" && !startNoUi && config.ServiceRunning() {
+			// Sync engine is already running as a service, only attach the UI of the user session
+			log.Logger(context.Background()).Info("Cells Sync service is running, starting system tray only")
+			SystrayCmd.Run(cmd, args)
+			return
+		}
+		runner()
 	},
 }
 
+// runService runs the supervisor under the control of the service manager.
+func runService() {
+	s, err := config.GetAppService(runner)
+	if err != nil {
+		log.Fatal(err.Error())
+		return
+	}
+	if err := s.Run(); err != nil {
+		log.Logger(context.Background()).Error("Service stopped on error: " + err.Error())
+	}
+}
+
 func init() {
 	StartCmd.Flags().BoolVar(&startNoUi, "headless", false, "Start sync tasks without UI components")
+	StartCmd.Flags().BoolVar(&startAutostart, "autostart", false, "Set when started with the user session")
+	StartCmd.Flags().MarkHidden("autostart")
+	StartCmd.Flags().BoolVar(&startPaused, "paused", false, "Start with all sync tasks paused, until they are resumed")
+	StartCmd.Flags().BoolVar(&startSimulate, "simulate", false, "Use a simulated clock, fast-forwarded through the /debug/clock API (testing only)")
+	StartCmd.Flags().MarkHidden("simulate")
 	RootCmd.AddCommand(StartCmd)
 }
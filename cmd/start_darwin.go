@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -35,10 +36,21 @@ import (
 	"github.com/pydio/cells/common/log"
 )
 
-var startNoUi bool
+var (
+	startNoUi      bool
+	startAutostart bool
+	startPaused    bool
+	startSimulate  bool
+)
 
 func runner() {
+	if startSimulate {
+		// Time only moves when advanced through the /debug/clock API
+		config.SetClock(config.NewSimulatedClock(time.Now()))
+	}
 	s := control.NewSupervisor(startNoUi)
+	s.SetAutoStarted(startAutostart)
+	s.SetStartPaused(startPaused)
 	s.Serve()
 }
 
@@ -49,12 +61,13 @@ var StartCmd = &cobra.Command{
 	PreRun: func(cmd *cobra.Command, args []string) {
 		logs := config.Default().Logs
 		os.MkdirAll(logs.Folder, 0755)
-		log.RegisterWriteSyncer(zapcore.AddSync(&lumberjack.Logger{
+		log.RegisterWriteSyncer(control.RedactLogs(zapcore.AddSync(&lumberjack.Logger{
 			Filename:   filepath.Join(logs.Folder, "sync.log"),
 			MaxAge:     logs.MaxAgeDays,   // days
 			MaxSize:    logs.MaxFilesSize, // megabytes
 			MaxBackups: logs.MaxFilesNumber,
-		}))
+		})))
+		log.RegisterWriteSyncer(control.RemoteLogs())
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if config.ServiceInstalled() {
@@ -69,5 +82,10 @@ var StartCmd = &cobra.Command{
 
 func init() {
 	StartCmd.Flags().BoolVar(&startNoUi, "headless", false, "Start sync tasks without UI components")
+	StartCmd.Flags().BoolVar(&startAutostart, "autostart", false, "Set when started with the user session")
+	StartCmd.Flags().MarkHidden("autostart")
+	StartCmd.Flags().BoolVar(&startPaused, "paused", false, "Start with all sync tasks paused, until they are resumed")
+	StartCmd.Flags().BoolVar(&startSimulate, "simulate", false, "Use a simulated clock, fast-forwarded through the /debug/clock API (testing only)")
+	StartCmd.Flags().MarkHidden("simulate")
 	RootCmd.AddCommand(StartCmd)
 }
@@ -0,0 +1,420 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+var (
+	stateTask   string
+	stateSide   string
+	stateFormat string
+	stateFile   string
+	stateSample int
+	stateDryRun bool
+)
+
+// StateCmd provides maintenance tools for the snapshots of the sync tasks.
+var StateCmd = &cobra.Command{
+	Use:   "state [check|compact|export|import|diff|seed|invalidate|rehash|verify|migrate|rollback]",
+	Short: "Check, compact, export or import the tasks snapshots and hash caches",
+	Long: `Maintenance tools for the snapshots DB of the tasks. Cells Sync must be stopped before running them.
+
+ - check:   Verify snapshots integrity and report their size
+ - compact: Rewrite snapshots to reclaim space, removing entries for paths outside the task selective roots or filters
+ - export:  Write the content of one snapshot (--side) to --file (or stdout), as JSON lines or CSV
+ - import:  Seed one snapshot (--side) of a task from an export --file, e.g. when setting up a new machine
+ - diff:    Compare two exports: cells-sync state diff export1.jsonl export2.jsonl
+ - seed:    Bootstrap a task from a disk copy of an already synced folder plus an export of its snapshot: the local
+            copy is validated (existence, sizes and a --sample of hashes) before both snapshots are initialized,
+            so that data is not downloaded again
+ - invalidate: Clear the hash cache of the local folder of a task, so that all files are hashed again on next start
+ - rehash:  Clear the hash cache and hash all files of the local folder of a task right away
+ - verify:  Compare the local folder of a task with the checksums computed by the server, without downloading
+            any content. Differences are written to a recovery plan, see the recovery command
+ - migrate: Upgrade snapshots to the schema of this version, as done when tasks start. With --dry-run, only
+            report the entries that would be dropped or rewritten
+ - rollback: Restore the snapshots backed up before their last migration, and reinstall the binary replaced by
+            the last update. Cells Sync must be restarted afterwards
+
+Use --task to restrict to one task UUID, otherwise all tasks are processed. Export, import, seed and verify require --task.
+Invalidate and rehash process both local sides of the task unless --side is set.
+Format is guessed from the file extension (.csv or .jsonl) unless --format is set.
+`,
+	ValidArgs: []string{"check", "compact", "export", "import", "diff", "seed", "invalidate", "rehash", "verify", "migrate", "rollback"},
+	Args:      cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "check", "compact":
+			maintainSnapshots(args[0] == "compact")
+		case "export":
+			exportSnapshot()
+		case "import":
+			importSnapshot()
+		case "seed":
+			seedSnapshots()
+		case "invalidate", "rehash":
+			maintainHashCaches(args[0] == "rehash", cmd.Flags().Changed("side"))
+		case "verify":
+			verifyRemote()
+		case "migrate":
+			migrateSnapshots()
+		case "rollback":
+			rollbackSnapshots()
+		case "diff":
+			if len(args) != 3 {
+				log.Fatal("Please provide two export files to compare")
+			}
+			diffSnapshots(args[1], args[2])
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+	},
+}
+
+func stateFileFormat() string {
+	if stateFormat != "" {
+		return stateFormat
+	}
+	return endpoint.FormatFromFilename(stateFile)
+}
+
+func stateTaskPath() string {
+	if stateTask == "" {
+		log.Fatal("Please provide a task UUID with --task")
+	}
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == stateTask {
+			return filepath.Join(config.SyncClientDataDir(), t.Uuid)
+		}
+	}
+	log.Fatal("Cannot find task " + stateTask)
+	return ""
+}
+
+func maintainSnapshots(compact bool) {
+	var found bool
+	for _, t := range config.Default().Tasks {
+		if stateTask != "" && t.Uuid != stateTask {
+			continue
+		}
+		found = true
+		fmt.Println("Task " + t.Label + " (" + t.Uuid + ")")
+		configPath := filepath.Join(config.SyncClientDataDir(), t.Uuid)
+		ignores := append([]string{}, endpoint.DefaultIgnores...)
+		if t.HiddenFiles == endpoint.HiddenFilesIgnore {
+			ignores = append(ignores, endpoint.HiddenFilesIgnores()...)
+		}
+		keep := endpoint.FilterMatcher(t.SelectiveRoots, ignores)
+		for name, p := range endpoint.SnapshotFiles(configPath) {
+			var report *endpoint.SnapshotReport
+			var e error
+			if compact {
+				report, e = endpoint.CompactSnapshot(name, p, keep)
+			} else {
+				report, e = endpoint.CheckSnapshot(name, p)
+			}
+			if report != nil {
+				fmt.Println(report.String())
+			}
+			if e != nil {
+				log.Fatal(e)
+			}
+		}
+	}
+	if !found {
+		log.Fatal("Cannot find any task to process")
+	}
+}
+
+func migrateSnapshots() {
+	var found bool
+	for _, t := range config.Default().Tasks {
+		if stateTask != "" && t.Uuid != stateTask {
+			continue
+		}
+		found = true
+		fmt.Println("Task " + t.Label + " (" + t.Uuid + ")")
+		configPath := filepath.Join(config.SyncClientDataDir(), t.Uuid)
+		var reports []*endpoint.SnapshotMigrationReport
+		var e error
+		if stateDryRun {
+			reports, e = endpoint.PlanSnapshotMigration(configPath)
+		} else {
+			reports, e = endpoint.MigrateSnapshots(configPath, common.Version)
+		}
+		for _, r := range reports {
+			fmt.Println(r.String())
+		}
+		if e != nil {
+			log.Fatal(e)
+		}
+		if len(reports) == 0 {
+			fmt.Printf("Snapshots are up to date (schema %d)\n", endpoint.SnapshotSchemaVersion)
+		}
+	}
+	if !found {
+		log.Fatal("Cannot find any task to process")
+	}
+}
+
+func rollbackSnapshots() {
+	var found bool
+	for _, t := range config.Default().Tasks {
+		if stateTask != "" && t.Uuid != stateTask {
+			continue
+		}
+		found = true
+		configPath := filepath.Join(config.SyncClientDataDir(), t.Uuid)
+		schema, e := endpoint.RestoreSnapshotBackup(configPath)
+		if e != nil {
+			fmt.Println("Task " + t.Label + " (" + t.Uuid + "): " + e.Error())
+			continue
+		}
+		fmt.Printf("Task %s (%s): snapshots restored to schema %d\n", t.Label, t.Uuid, schema.Version)
+	}
+	if !found {
+		log.Fatal("Cannot find any task to process")
+	}
+	previous, e := control.RollbackBinary()
+	if e != nil {
+		log.Fatal(e)
+	}
+	fmt.Println("Previous binary reinstalled from " + previous + ", please restart Cells Sync")
+}
+
+func exportSnapshot() {
+	configPath := stateTaskPath()
+	if _, ok := endpoint.SnapshotFiles(configPath)[stateSide]; !ok {
+		log.Fatal("Cannot find snapshot " + stateSide + " for this task")
+	}
+	out := os.Stdout
+	if stateFile != "" {
+		f, e := os.Create(stateFile)
+		if e != nil {
+			log.Fatal(e)
+		}
+		defer f.Close()
+		out = f
+	}
+	count, e := endpoint.ExportSnapshot(configPath, stateSide, stateFileFormat(), out)
+	if e != nil {
+		log.Fatal(e)
+	}
+	if stateFile != "" {
+		fmt.Printf("Exported %d entries to %s\n", count, stateFile)
+	}
+}
+
+func importSnapshot() {
+	configPath := stateTaskPath()
+	if stateFile == "" {
+		log.Fatal("Please provide an export file with --file")
+	}
+	if _, ok := endpoint.SnapshotFiles(configPath)[stateSide]; ok {
+		log.Fatal("Snapshot " + stateSide + " already exists for this task, it must be removed before importing")
+	}
+	entries := readSnapshotExport(stateFile)
+	if e := os.MkdirAll(configPath, 0755); e != nil {
+		log.Fatal(e)
+	}
+	if e := endpoint.ImportSnapshot(configPath, stateSide, entries); e != nil {
+		log.Fatal(e)
+	}
+	fmt.Printf("Imported %d entries in snapshot %s\n", len(entries), stateSide)
+}
+
+func seedSnapshots() {
+	configPath := stateTaskPath()
+	if stateFile == "" {
+		log.Fatal("Please provide an export file with --file")
+	}
+	if len(endpoint.SnapshotFiles(configPath)) > 0 {
+		log.Fatal("Snapshots already exist for this task, seeding is only possible on a new task")
+	}
+	var task *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == stateTask {
+			task = t
+		}
+	}
+	localSide, remoteSide := "left", "right"
+	localRoot, ok := endpoint.LocalPathForURI(task.LeftURI)
+	if !ok {
+		localSide, remoteSide = "right", "left"
+		if localRoot, ok = endpoint.LocalPathForURI(task.RightURI); !ok {
+			log.Fatal("Task does not have a local folder")
+		}
+	}
+	entries := readSnapshotExport(stateFile)
+	fmt.Println("Validating local copy in " + localRoot)
+	report, localEntries := endpoint.ValidateSeed(localRoot, entries, stateSample)
+	fmt.Println(report.String())
+	if !report.Valid() {
+		log.Fatal("Local copy does not match the export, snapshots were not initialized")
+	}
+	if e := os.MkdirAll(configPath, 0755); e != nil {
+		log.Fatal(e)
+	}
+	if e := endpoint.ImportSnapshot(configPath, remoteSide, entries); e != nil {
+		log.Fatal(e)
+	}
+	if e := endpoint.ImportSnapshot(configPath, localSide, localEntries); e != nil {
+		log.Fatal(e)
+	}
+	fmt.Println("Snapshots initialized, the task will only sync changes made since the export")
+}
+
+func maintainHashCaches(rebuild, sideSet bool) {
+	configPath := stateTaskPath()
+	var task *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == stateTask {
+			task = t
+		}
+	}
+	var found bool
+	for side, uri := range map[string]string{"left": task.LeftURI, "right": task.RightURI} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok || (sideSet && side != stateSide) {
+			continue
+		}
+		found = true
+		if !rebuild {
+			if e := endpoint.InvalidateHashCache(configPath, side); e != nil {
+				log.Fatal(e)
+			}
+			fmt.Println("Cleared hash cache " + side)
+			continue
+		}
+		cache, e := endpoint.OpenHashCache(configPath, side, root)
+		if e != nil {
+			log.Fatal(e)
+		}
+		fmt.Println("Hashing files of " + root)
+		count, e := cache.Rebuild(context.Background())
+		cache.Close()
+		if e != nil {
+			log.Fatal(e)
+		}
+		fmt.Printf("Hash cache %s rebuilt with %d files\n", side, count)
+	}
+	if !found {
+		log.Fatal("Task does not have a local folder")
+	}
+}
+
+func verifyRemote() {
+	configPath := stateTaskPath()
+	var task *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == stateTask {
+			task = t
+		}
+	}
+	localSide, localURI, remoteURI := "left", task.LeftURI, task.RightURI
+	localRoot, ok := endpoint.LocalPathForURI(localURI)
+	if !ok {
+		localSide, localURI, remoteURI = "right", task.RightURI, task.LeftURI
+		if localRoot, ok = endpoint.LocalPathForURI(localURI); !ok {
+			log.Fatal("Task does not have a local folder")
+		}
+	}
+	remote, e := endpoint.EndpointFromURI(remoteURI, localURI, true)
+	if e != nil {
+		log.Fatal(e)
+	}
+	source, ok := remote.(model.PathSyncSource)
+	if !ok {
+		log.Fatal("Cannot list the remote side of this task")
+	}
+	var hashes *endpoint.HashCache
+	if c, er := endpoint.OpenHashCache(configPath, localSide, localRoot); er == nil {
+		hashes = c
+		defer c.Close()
+	}
+	ignores := append([]string{}, endpoint.DefaultIgnores...)
+	if task.HiddenFiles == endpoint.HiddenFilesIgnore {
+		ignores = append(ignores, endpoint.HiddenFilesIgnores()...)
+	}
+	fmt.Println("Verifying " + localRoot + " against server checksums")
+	report, e := endpoint.VerifyRemote(context.Background(), source, localRoot, hashes, endpoint.FilterMatcher(task.SelectiveRoots, ignores))
+	if e != nil {
+		log.Fatal(e)
+	}
+	fmt.Println(report.String())
+	if !report.Valid() {
+		snapshot, _ := endpoint.LoadSnapshotEntries(configPath, localSide)
+		plan := endpoint.PlanFromVerify(report, localRoot, snapshot)
+		if e := endpoint.SaveRecoveryPlan(configPath, plan); e != nil {
+			log.Fatal(e)
+		}
+		fmt.Printf("Recovery plan with %d operations written, review it with: cells-sync recovery show --task %s\n", len(plan.Operations), task.Uuid)
+		os.Exit(1)
+	}
+}
+
+func diffSnapshots(a, b string) {
+	lines := endpoint.DiffSnapshotEntries(readSnapshotExport(a), readSnapshotExport(b))
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	fmt.Printf("%d differences\n", len(lines))
+}
+
+func readSnapshotExport(name string) []endpoint.SnapshotEntry {
+	f, e := os.Open(name)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer f.Close()
+	format := stateFormat
+	if format == "" {
+		format = endpoint.FormatFromFilename(name)
+	}
+	entries, e := endpoint.ReadSnapshotEntries(format, f)
+	if e != nil {
+		log.Fatal(e)
+	}
+	return entries
+}
+
+func init() {
+	StateCmd.Flags().StringVarP(&stateTask, "task", "t", "", "UUID of the task to process")
+	StateCmd.Flags().StringVarP(&stateSide, "side", "s", "left", "Snapshot or hash cache to process (left or right)")
+	StateCmd.Flags().StringVarP(&stateFormat, "format", "", "", "Export format (jsonl or csv)")
+	StateCmd.Flags().StringVarP(&stateFile, "file", "f", "", "File to export to or import from")
+	StateCmd.Flags().IntVarP(&stateSample, "sample", "", 100, "Number of files to hash when seeding")
+	StateCmd.Flags().BoolVar(&stateDryRun, "dry-run", false, "Only report the changes of a migration")
+	RootCmd.AddCommand(StateCmd)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+var (
+	statusWatch    bool
+	statusInterval time.Duration
+	statusTask     string
+	statusURL      string
+)
+
+// StatusCmd prints the status of the tasks of the running agent, one line per task.
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the status of the sync tasks",
+	Long: `Print the status of the sync tasks of the running agent, one line per task. Cells Sync must be running.
+
+With --watch, a new line is printed each time the status of a task changes, prefixed with the time. Lines are
+never rewritten nor cleared, so that the output can be followed by a screen reader or piped to a log file.
+Colors are only used when the output is a terminal, and can be disabled with the NO_COLOR variable.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if statusURL == "" {
+			statusURL = config.DiscoverHttpURL()
+		}
+		endpoint := strings.TrimRight(statusURL, "/") + "/summary"
+		color := colorOutput(os.Stdout)
+		last := make(map[string]string)
+		for {
+			summary, e := fetchSummary(endpoint)
+			if e != nil {
+				if !statusWatch {
+					log.Fatal("Cannot contact Cells Sync, is it running? " + e.Error())
+				}
+				if last[""] != "unreachable" {
+					last[""] = "unreachable"
+					fmt.Println(time.Now().Format("15:04:05") + " Cells Sync is not reachable: " + e.Error())
+				}
+			} else {
+				delete(last, "")
+				for _, t := range summary.Tasks {
+					if statusTask != "" && t.UUID != statusTask {
+						continue
+					}
+					line := statusLine(t, color)
+					if statusWatch {
+						if last[t.UUID] == line {
+							continue
+						}
+						last[t.UUID] = line
+						line = time.Now().Format("15:04:05") + " " + line
+					}
+					fmt.Println(line)
+				}
+			}
+			if !statusWatch {
+				return
+			}
+			<-time.After(statusInterval)
+		}
+	},
+}
+
+// fetchSummary reads the status summary of the running agent.
+func fetchSummary(endpoint string) (*common.StatusSummary, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, e := client.Get(endpoint)
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var summary common.StatusSummary
+	if e := json.NewDecoder(resp.Body).Decode(&summary); e != nil {
+		return nil, e
+	}
+	return &summary, nil
+}
+
+// statusLine describes the status of one task on a single line.
+func statusLine(t *common.TaskSummary, color bool) string {
+	status := common.StatusLabel(t.Status)
+	if !t.Connected && t.Status != model.TaskStatusDisabled && t.Status != model.TaskStatusPaused {
+		status = "disconnected"
+	}
+	if color {
+		switch status {
+		case "error", "disconnected":
+			status = "\033[31m" + status + "\033[0m"
+		case "processing":
+			status = "\033[33m" + status + "\033[0m"
+		case "idle":
+			status = "\033[32m" + status + "\033[0m"
+		}
+	}
+	line := t.Label + ": " + status
+	if t.Pending > 0 {
+		line += fmt.Sprintf(", %d files pending", t.Pending)
+	}
+	if t.Message != "" {
+		line += ". " + t.Message
+	}
+	return line
+}
+
+// colorOutput checks if ANSI colors can be written to f: it must be a terminal, and colors must not be disabled
+// with NO_COLOR or a dumb terminal.
+func colorOutput(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, e := f.Stat()
+	return e == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func init() {
+	StatusCmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "Keep running and print a line each time a task status changes")
+	StatusCmd.Flags().DurationVar(&statusInterval, "interval", 2*time.Second, "Polling interval with --watch")
+	StatusCmd.Flags().StringVarP(&statusTask, "task", "t", "", "Only print the status of the task with this UUID")
+	StatusCmd.Flags().StringVarP(&statusURL, "url", "", "", "Cells Sync web server URL, discovered from the running agent by default")
+	RootCmd.AddCommand(StatusCmd)
+}
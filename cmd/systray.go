@@ -29,11 +29,14 @@ var SystrayCmd = &cobra.Command{
 	Use:   "systray",
 	Short: "Launch Systray",
 	Run: func(cmd *cobra.Command, args []string) {
-		tray.Run(url)
+		tray.Run(url, trayOpen)
 	},
 }
 
+var trayOpen bool
+
 func init() {
-	SystrayCmd.PersistentFlags().StringVar(&url, "url", "http://localhost:3636", "WebServer URL")
+	SystrayCmd.PersistentFlags().StringVar(&url, "url", "", "WebServer URL, discovered from the running agent by default")
+	SystrayCmd.PersistentFlags().BoolVar(&trayOpen, "open", false, "Open the main window once connected")
 	RootCmd.AddCommand(SystrayCmd)
 }
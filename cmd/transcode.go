@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+var (
+	transcodeTask   string
+	transcodeSource string
+	transcodeApply  bool
+)
+
+// TranscodeCmd fixes file names written in a legacy encoding.
+var TranscodeCmd = &cobra.Command{
+	Use:   "transcode",
+	Short: "Fix file names written in a legacy encoding (Latin-1, Windows-1252) in the local folder of a task",
+	Long: `Find the files of the local folder of a task whose names were written in a legacy encoding by old systems
+and appear as mojibake, and report how they would be renamed. Use --apply to rename them: running tasks
+sync the renames as moves.
+
+--source is "latin1", "cp1252" or "auto" (default, which also fixes names converted to UTF-8 twice). It defaults
+to the Encoding rule of the task if set. Set Encoding.Apply in the task config to apply the rule on every start.
+
+ cells-sync transcode --task UUID
+ cells-sync transcode --task UUID --source latin1 --apply
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if transcodeTask == "" {
+			log.Fatal("Please provide a task UUID with --task")
+		}
+		var task *config.Task
+		for _, t := range config.Default().Tasks {
+			if t.Uuid == transcodeTask {
+				task = t
+			}
+		}
+		if task == nil {
+			log.Fatal("Cannot find task " + transcodeTask)
+		}
+		source := transcodeSource
+		if !cmd.Flags().Changed("source") && task.Encoding != nil && task.Encoding.Source != "" {
+			source = task.Encoding.Source
+		}
+		ignores := append([]string{}, endpoint.DefaultIgnores...)
+		if task.HiddenFiles == endpoint.HiddenFilesIgnore {
+			ignores = append(ignores, endpoint.HiddenFilesIgnores()...)
+		}
+		keep := endpoint.FilterMatcher(task.SelectiveRoots, ignores)
+		var found bool
+		for _, uri := range []string{task.LeftURI, task.RightURI} {
+			root, ok := endpoint.LocalPathForURI(uri)
+			if !ok {
+				continue
+			}
+			found = true
+			fmt.Println("Checking file names in " + root)
+			report, e := endpoint.PlanTranscode(root, source, keep)
+			if e != nil {
+				log.Fatal(e)
+			}
+			fmt.Println(report.String())
+			if !transcodeApply || len(report.Renames) == 0 {
+				continue
+			}
+			applied, errs := endpoint.ApplyTranscode(root, report)
+			for _, er := range errs {
+				fmt.Println("Error: " + er.Error())
+			}
+			fmt.Printf("Renamed %d files\n", len(applied))
+		}
+		if !found {
+			log.Fatal("Task does not have a local folder")
+		}
+		if !transcodeApply {
+			fmt.Println("Dry run, use --apply to rename the files")
+		}
+	},
+}
+
+func init() {
+	TranscodeCmd.Flags().StringVarP(&transcodeTask, "task", "t", "", "UUID of the task")
+	TranscodeCmd.Flags().StringVarP(&transcodeSource, "source", "s", endpoint.EncodingAuto, "Legacy encoding of the names (auto, latin1 or cp1252)")
+	TranscodeCmd.Flags().BoolVarP(&transcodeApply, "apply", "", false, "Rename the files instead of only reporting them")
+	RootCmd.AddCommand(TranscodeCmd)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var (
+	urlsAuthority string
+	urlsAlternate []string
+	urlsRewrites  []string
+)
+
+// UrlsCmd manages the alternate URLs and the rewrite rules of a server.
+var UrlsCmd = &cobra.Command{
+	Use:   "urls [list|set|rewrite]",
+	Short: "Declare alternate URLs and address rewrites for a server",
+	Long: `A server can be reachable under several URLs, e.g. a LAN URL at the office and a public URL from home. When
+alternate URLs are declared, the first reachable one is used, and the choice is made again each time the network
+changes. The URL found reachable on a network is tried first the next time this network is used.
+
+ - list:    Print the URLs of each server, the one currently used and the address rewrites
+ - set:     Set the alternate URLs of the server given with --authority, with one --url flag per URL. Without
+            --url, alternate URLs are removed.
+ - rewrite: Set the address rewrites of the server given with --authority, with one --map from=to flag per rule,
+            e.g. --map minio.internal:9000=cells.example.com:443. Connections to the first address, typically
+            found in presigned or redirect URLs, are sent to the second one. Without --map, rules are removed.
+
+Cells Sync must be restarted after a change.
+`,
+	ValidArgs: []string{"list", "set", "rewrite"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "list":
+			for _, a := range config.Default().PublicAuthorities() {
+				fmt.Println(a.Id)
+				fmt.Println("  Main URL:   " + a.URI)
+				if len(a.AlternateURIs) > 0 {
+					fmt.Println("  Alternates: " + strings.Join(a.AlternateURIs, ", "))
+				}
+				fmt.Println("  Used:       " + a.BaseURL())
+				for _, r := range a.Rewrites {
+					fmt.Println("  Rewrite:    " + r.From + " -> " + r.To)
+				}
+			}
+		case "set":
+			if urlsAuthority == "" {
+				log.Fatal("Please provide a server with --authority (see urls list)")
+			}
+			for i, u := range urlsAlternate {
+				urlsAlternate[i] = strings.TrimRight(u, "/")
+			}
+			if e := config.Default().SetAlternateURIs(urlsAuthority, urlsAlternate); e != nil {
+				log.Fatal(e)
+			}
+			fmt.Printf("Set %d alternate URLs for %s\n", len(urlsAlternate), urlsAuthority)
+		case "rewrite":
+			if urlsAuthority == "" {
+				log.Fatal("Please provide a server with --authority (see urls list)")
+			}
+			var rules []*config.URLRewrite
+			for _, m := range urlsRewrites {
+				parts := strings.SplitN(m, "=", 2)
+				if len(parts) != 2 {
+					log.Fatal("Invalid rewrite " + m + ", use from=to")
+				}
+				rules = append(rules, &config.URLRewrite{From: parts[0], To: parts[1]})
+			}
+			if e := config.Default().SetURLRewrites(urlsAuthority, rules); e != nil {
+				log.Fatal(e)
+			}
+			fmt.Printf("Set %d address rewrites for %s\n", len(rules), urlsAuthority)
+		default:
+			log.Fatal("Unknown action " + args[0])
+		}
+	},
+}
+
+func init() {
+	UrlsCmd.Flags().StringVarP(&urlsAuthority, "authority", "a", "", "Id of the server, as printed by urls list")
+	UrlsCmd.Flags().StringSliceVarP(&urlsAlternate, "url", "u", nil, "Alternate URL of the server, e.g. https://cells.lan")
+	UrlsCmd.Flags().StringSliceVarP(&urlsRewrites, "map", "m", nil, "Address rewrite as from=to, each side being host:port or a URL")
+	RootCmd.AddCommand(UrlsCmd)
+}
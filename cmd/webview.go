@@ -20,13 +20,16 @@
 package cmd
 
 import (
+	"strings"
+
+	"github.com/pydio/cells-sync/config"
 	"github.com/pydio/cells-sync/i18n"
 	"github.com/skratchdot/open-golang/open"
 	"github.com/spf13/cobra"
 	"github.com/zserge/webview"
 )
 
-var url string
+var webviewURL string
 
 // LinkOpener is bound to JS inside the webview
 type LinkOpener struct{}
@@ -41,16 +44,24 @@ var WebviewCmd = &cobra.Command{
 	Use:   "webview",
 	Short: "Launch WebView",
 	Run: func(cmd *cobra.Command, args []string) {
+		if webviewURL == "" {
+			webviewURL = config.DiscoverHttpURL()
+		}
 		lang := i18n.JsonLang()
 		if lang != "" {
-			url += "?lang=" + lang
+			// Routes may already carry a query, e.g. /create?id=...
+			sep := "?"
+			if strings.Contains(webviewURL, "?") {
+				sep = "&"
+			}
+			webviewURL += sep + "lang=" + lang
 		}
 		w := webview.New(webview.Settings{
 			Width:     900,
 			Height:    600,
 			Resizable: true,
 			Title:     i18n.T("application.title"),
-			URL:       url,
+			URL:       webviewURL,
 			Debug:     true, // Enable JS Debugger
 			ExternalInvokeCallback: func(w webview.WebView, data string) {
 				switch data {
@@ -70,7 +81,7 @@ var WebviewCmd = &cobra.Command{
 }
 
 func init() {
-	WebviewCmd.PersistentFlags().StringVar(&url, "url", "http://localhost:3636", "Web server URL")
+	WebviewCmd.PersistentFlags().StringVar(&webviewURL, "url", "", "Web server URL, discovered from the running agent by default")
 
 	RootCmd.AddCommand(WebviewCmd)
 }
@@ -47,6 +47,23 @@ type EndpointInfo struct {
 	Connected      bool
 	WatcherActive  bool
 	LastConnection time.Time
+	Capabilities   *Capabilities `json:"Capabilities,omitempty"`
+}
+
+// Capabilities describes features of an endpoint that are probed once and cached.
+type Capabilities struct {
+	// Version of the endpoint (server or client version), capabilities are probed again when it changes
+	Version        string
+	HashAlgorithm  string
+	MTimePrecision time.Duration
+	RangedReads    bool
+	CaseSensitive  bool
+	// Transfers lists the ways contents can be moved to or from the endpoint, by order of preference
+	Transfers []string `json:"Transfers,omitempty"`
+	// TusPath is the path of the tus.io endpoint of the server, and TusChecksum the algorithm of its checksum extension
+	TusPath     string `json:"TusPath,omitempty"`
+	TusChecksum string `json:"TusChecksum,omitempty"`
+	ProbedAt    time.Time
 }
 
 // SyncState provides information about a sync task
@@ -65,6 +82,40 @@ type SyncState struct {
 	// Endpoints Current Info
 	LeftInfo  *EndpointInfo
 	RightInfo *EndpointInfo
+
+	// Live transfer rates
+	Throughput *ThroughputInfo `json:"Throughput,omitempty"`
+
+	// Server policy violations
+	PolicyViolations []string `json:"PolicyViolations,omitempty"`
+
+	// Remote folders ignored after a permission error
+	AccessDenied []string `json:"AccessDenied,omitempty"`
+
+	// Set while the server responds with 429 Too Many Requests
+	ThrottledUntil *time.Time `json:"ThrottledUntil,omitempty"`
+
+	// Set while the server announced a maintenance
+	MaintenanceUntil *time.Time `json:"MaintenanceUntil,omitempty"`
+
+	// Set while an endpoint keeps reconnecting, the next sync is delayed until then
+	DegradedUntil *time.Time `json:"DegradedUntil,omitempty"`
+
+	// Downloaded files moved to quarantine by the content scanner
+	Quarantined []string `json:"Quarantined,omitempty"`
+
+	// Files currently being processed, with their phase
+	ActiveFiles []*FileProgress `json:"ActiveFiles,omitempty"`
+
+	// Local copies created when keeping both versions of a conflicting file
+	ConflictCopies []*ConflictCopy `json:"ConflictCopies,omitempty"`
+
+	// Errors of the last sync pass, grouped by code
+	Errors []*ErrorInfo `json:"Errors,omitempty"`
+
+	// Last and next runs of the task cron schedule
+	LastScheduledRun *time.Time `json:"LastScheduledRun,omitempty"`
+	NextScheduledRun *time.Time `json:"NextScheduledRun,omitempty"`
 }
 
 // ConcreteSyncState is used for unmarshaling
@@ -83,12 +134,140 @@ type ConcreteSyncState struct {
 	// Endpoints Current Info
 	LeftInfo  *EndpointInfo
 	RightInfo *EndpointInfo
+
+	// Live transfer rates
+	Throughput *ThroughputInfo `json:"Throughput,omitempty"`
+
+	// Server policy violations
+	PolicyViolations []string `json:"PolicyViolations,omitempty"`
+
+	// Remote folders ignored after a permission error
+	AccessDenied []string `json:"AccessDenied,omitempty"`
+
+	// Set while the server responds with 429 Too Many Requests
+	ThrottledUntil *time.Time `json:"ThrottledUntil,omitempty"`
+
+	// Set while the server announced a maintenance
+	MaintenanceUntil *time.Time `json:"MaintenanceUntil,omitempty"`
+
+	// Set while an endpoint keeps reconnecting, the next sync is delayed until then
+	DegradedUntil *time.Time `json:"DegradedUntil,omitempty"`
+
+	// Downloaded files moved to quarantine by the content scanner
+	Quarantined []string `json:"Quarantined,omitempty"`
+
+	// Files currently being processed, with their phase
+	ActiveFiles []*FileProgress `json:"ActiveFiles,omitempty"`
+
+	// Local copies created when keeping both versions of a conflicting file
+	ConflictCopies []*ConflictCopy `json:"ConflictCopies,omitempty"`
+
+	// Errors of the last sync pass, grouped by code
+	Errors []*ErrorInfo `json:"Errors,omitempty"`
+}
+
+// StatusLabel returns a short, stable, lowercase label for a task status.
+func StatusLabel(s model.TaskStatus) string {
+	switch s {
+	case model.TaskStatusIdle:
+		return "idle"
+	case model.TaskStatusPaused:
+		return "paused"
+	case model.TaskStatusDisabled:
+		return "disabled"
+	case model.TaskStatusProcessing:
+		return "processing"
+	case model.TaskStatusError:
+		return "error"
+	case model.TaskStatusRestarting:
+		return "restarting"
+	case model.TaskStatusStopping:
+		return "stopping"
+	case model.TaskStatusRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// ThroughputInfo provides live transfer rates in bytes per second. Samples cover the last minute,
+// one value per second, ordered from the oldest to the most recent.
+type ThroughputInfo struct {
+	UpRate      int64
+	DownRate    int64
+	UpSamples   []int64
+	DownSamples []int64
+}
+
+// Active returns true if any bytes were transferred during the sampled period.
+func (t *ThroughputInfo) Active() bool {
+	if t == nil {
+		return false
+	}
+	for i := range t.UpSamples {
+		if t.UpSamples[i] > 0 || t.DownSamples[i] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusSummary is a compact view of all tasks, cheap to poll by the system tray. Status is the worst status
+// of all tasks, Pending the number of files being processed, and AuthProblems the number of servers or tasks
+// that require a new login.
+type StatusSummary struct {
+	Status       model.TaskStatus
+	Tasks        []*TaskSummary
+	Pending      int
+	UpRate       int64
+	DownRate     int64
+	AuthProblems int
+	// ResourceWarnings are raised when the agent approaches the limits of open files, watches or memory
+	ResourceWarnings []string `json:"ResourceWarnings,omitempty"`
+}
+
+// ResourceUsage describes the resources used by the agent process against their limits: open file descriptors,
+// inotify watches and resident memory. Values are -1 when they cannot be measured on the platform.
+type ResourceUsage struct {
+	OpenFiles  int
+	MaxFiles   int
+	Watches    int
+	MaxWatches int
+	RSS        int64
+	MaxRSS     int64
+	Warnings   []string `json:"Warnings,omitempty"`
+}
+
+// TaskSummary is the status of a single task in a StatusSummary.
+type TaskSummary struct {
+	UUID      string
+	Label     string
+	Status    model.TaskStatus
+	Connected bool
+	Pending   int    `json:"Pending,omitempty"`
+	Message   string `json:"Message,omitempty"`
+}
+
+// FileProgress describes the processing phase of a single file: queued, hashing, transferring, verifying
+// or committing. Bytes and Total are only set while transferring.
+type FileProgress struct {
+	Path  string
+	Phase string
+	Bytes int64 `json:"Bytes,omitempty"`
+	Total int64 `json:"Total,omitempty"`
 }
 
-// Message is a generic container for RPC
+// Message is a generic container for RPC. Seq is set on messages recorded in the status journal, so that
+// clients can resume their subscription after a reconnection.
 type Message struct {
 	Type    string
 	Content interface{}
+	Seq     uint64 `json:"Seq,omitempty"`
+}
+
+// ResumeRequest is sent by clients with PING to receive the journaled messages they missed.
+type ResumeRequest struct {
+	LastSeq uint64
 }
 
 // CmdContent is a generic container for a Cmd sent via RPC
@@ -104,6 +283,82 @@ type ConfigContent struct {
 	Authority *config.Authority
 }
 
+// ConfigError is sent back to a client whose config change was rejected. Conflict is set if the task was
+// modified concurrently and must be reloaded.
+type ConfigError struct {
+	UUID     string
+	Error    string
+	Conflict bool
+}
+
+// StateDiff is sent instead of a full SyncState when only a few fields of a task state changed. Patch is a JSON
+// merge patch (RFC 7386) to apply on the last state received for the task: changed fields carry their new value,
+// removed fields are null.
+type StateDiff struct {
+	UUID  string
+	Patch map[string]interface{}
+}
+
+// NotificationAction is a button proposed to the user on an actionable notification
+type NotificationAction struct {
+	Id    string
+	Label string
+}
+
+// Notification is sent by the service to the UI clients for displaying desktop notifications
+type Notification struct {
+	Id       string
+	Type     string
+	TaskUuid string `json:"TaskUuid,omitempty"`
+	Path     string `json:"Path,omitempty"`
+	Title    string
+	Message  string
+	Actions  []*NotificationAction `json:"Actions,omitempty"`
+
+	// Suggested path for path-limit notifications
+	Suggested string `json:"Suggested,omitempty"`
+}
+
+// NotificationResponse is sent back by a UI client when the user clicked on a notification action
+type NotificationResponse struct {
+	Id     string
+	Action string
+}
+
+// ErrorInfo describes an error with a stable code and its parameters, so that clients can translate it and link
+// it to the documentation. Count is the number of operations that failed with the same code. Fingerprint
+// identifies the first error of the group, and Occurrences is the number of times it was seen across sync passes.
+type ErrorInfo struct {
+	Code        string
+	Params      []string
+	Message     string
+	Count       int
+	Fingerprint string `json:"Fingerprint,omitempty"`
+	Occurrences int    `json:"Occurrences,omitempty"`
+}
+
+// ConflictCopy links a file to the copy of its local version created on conflict.
+type ConflictCopy struct {
+	Path string
+	Copy string
+}
+
+// ConflictCopyResolution is sent by the UI to keep either the original file or its conflict copy.
+type ConflictCopyResolution struct {
+	UUID string
+	Path string
+	Copy string
+	Keep string
+}
+
+// ErrorSnoozeRequest is sent by the UI to hide an error of a task for a number of days.
+type ErrorSnoozeRequest struct {
+	UUID        string
+	Fingerprint string
+	Path        string
+	Days        int
+}
+
 // Various messages for communicating with service
 type UpdateMessage interface {
 	UpdateMessage()
@@ -188,6 +443,46 @@ func MessageFromData(d []byte) *Message {
 			} else {
 				log.Logger(context.Background()).Error("Cannot unmarshal ConcreteSyncState: " + e.Error() + ":" + string(d))
 			}
+		} else if m.Type == "NOTIFICATION" {
+			d, _ := json.Marshal(m.Content)
+			var notification Notification
+			if e := json.Unmarshal(d, &notification); e == nil {
+				m.Content = &notification
+			} else {
+				log.Logger(context.Background()).Error("Cannot unmarshal Notification: " + e.Error() + ":" + string(d))
+			}
+		} else if m.Type == "PING" {
+			if _, ok := m.Content.(map[string]interface{}); ok {
+				d, _ := json.Marshal(m.Content)
+				var resume ResumeRequest
+				if e := json.Unmarshal(d, &resume); e == nil {
+					m.Content = &resume
+				}
+			}
+		} else if m.Type == "NOTIFICATION_ACTION" {
+			d, _ := json.Marshal(m.Content)
+			var response NotificationResponse
+			if e := json.Unmarshal(d, &response); e == nil {
+				m.Content = &response
+			} else {
+				log.Logger(context.Background()).Error("Cannot unmarshal NotificationResponse: " + e.Error() + ":" + string(d))
+			}
+		} else if m.Type == "CONFLICT_COPY" {
+			d, _ := json.Marshal(m.Content)
+			var resolution ConflictCopyResolution
+			if e := json.Unmarshal(d, &resolution); e == nil {
+				m.Content = &resolution
+			} else {
+				log.Logger(context.Background()).Error("Cannot unmarshal ConflictCopyResolution: " + e.Error() + ":" + string(d))
+			}
+		} else if m.Type == "ERROR_SNOOZE" {
+			d, _ := json.Marshal(m.Content)
+			var snooze ErrorSnoozeRequest
+			if e := json.Unmarshal(d, &snooze); e == nil {
+				m.Content = &snooze
+			} else {
+				log.Logger(context.Background()).Error("Cannot unmarshal ErrorSnoozeRequest: " + e.Error() + ":" + string(d))
+			}
 		} else if m.Type == "UPDATE" {
 			d, _ := json.Marshal(m.Content)
 			var checkRequest UpdateCheckRequest
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+)
+
+// urlProbeTimeout is the maximum time to wait for a server answer when probing the URLs of an authority.
+const urlProbeTimeout = 5 * time.Second
+
+// BaseURL returns the URL currently used to reach the server: the reachable URL selected for the current
+// network, or the main URI.
+func (a *Authority) BaseURL() string {
+	if a.ActiveURI != "" {
+		return a.ActiveURI
+	}
+	return a.URI
+}
+
+// CandidateURIs lists the URLs of an authority in the order they are probed: the one last reachable on this
+// network first, then the main URI and the alternate ones.
+func (a *Authority) CandidateURIs(network string) (uris []string) {
+	seen := make(map[string]bool)
+	add := func(u string) {
+		u = strings.TrimRight(u, "/")
+		if u != "" && !seen[u] {
+			seen[u] = true
+			uris = append(uris, u)
+		}
+	}
+	if network != "" {
+		add(a.NetworkURIs[network])
+	}
+	add(a.URI)
+	for _, u := range a.AlternateURIs {
+		add(u)
+	}
+	return
+}
+
+// probeURI checks that the server answers on uri. Any response but a server error means it is reachable.
+func (a *Authority) probeURI(uri string) bool {
+	client := *a.getHttpClient()
+	client.Timeout = urlProbeTimeout
+	resp, e := client.Get(uri + "/a/frontend/bootconf")
+	if e != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+// Reachable checks that the server answers on the URL currently used.
+func (a *Authority) Reachable() bool {
+	return a.probeURI(strings.TrimRight(a.BaseURL(), "/"))
+}
+
+// AuthorityForURI returns the authority of a remote task URI, or nil.
+func (g *Global) AuthorityForURI(uri string) *Authority {
+	for _, a := range g.Authorities {
+		if a.MatchesURI(uri) {
+			return a
+		}
+	}
+	return nil
+}
+
+// SelectAuthorityURIs probes the URLs of the authorities declaring alternate ones, and switches each of them to
+// the first reachable URL. The choice is remembered for the network, so that it is probed first next time. It
+// emits an AuthChange event of type "url" for each authority whose URL changed.
+func (g *Global) SelectAuthorityURIs(network string) (changed []*Authority) {
+	var save bool
+	for _, a := range g.Authorities {
+		if len(a.AlternateURIs) == 0 {
+			continue
+		}
+		var selected string
+		for _, u := range a.CandidateURIs(network) {
+			if a.probeURI(u) {
+				selected = u
+				break
+			}
+		}
+		if selected == "" {
+			log.Logger(oidcContext).Warn("No URL of " + a.Id + " is reachable, keeping " + a.BaseURL())
+			continue
+		}
+		if network != "" && a.NetworkURIs[network] != selected {
+			if a.NetworkURIs == nil {
+				a.NetworkURIs = make(map[string]string)
+			}
+			a.NetworkURIs[network] = selected
+			save = true
+		}
+		if selected == strings.TrimRight(a.BaseURL(), "/") {
+			continue
+		}
+		log.Logger(oidcContext).Info("Switching " + a.Id + " to " + selected)
+		a.ActiveURI = selected
+		if selected == strings.TrimRight(a.URI, "/") {
+			a.ActiveURI = ""
+		}
+		changed = append(changed, a)
+		save = true
+	}
+	if !save {
+		return
+	}
+	if e := Save(); e != nil {
+		log.Logger(oidcContext).Error("Cannot save selected server URLs: " + e.Error())
+	}
+	for _, a := range changed {
+		g.notifyAuthChange("url", a)
+	}
+	return
+}
+
+// SetAlternateURIs sets the URLs under which the server of an authority can also be reached, e.g. a LAN URL in
+// addition to the public one. An empty list removes them.
+func (g *Global) SetAlternateURIs(id string, uris []string) error {
+	for _, u := range uris {
+		if p, e := url.Parse(u); e != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			return fmt.Errorf("invalid server URL %s", u)
+		}
+	}
+	for _, a := range g.Authorities {
+		if a.key() != id && a.Id != id {
+			continue
+		}
+		a.AlternateURIs = uris
+		a.ActiveURI = ""
+		a.NetworkURIs = nil
+		return Save()
+	}
+	return fmt.Errorf("cannot find authority %s", id)
+}
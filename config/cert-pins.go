@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CertificateInfo describes the certificate presented by a server.
+type CertificateInfo struct {
+	Fingerprint string
+	Subject     string
+	Issuer      string
+	NotAfter    time.Time
+	// Trusted is true if the certificate chain is valid for the system roots
+	Trusted bool
+}
+
+// CertificateChangedError is returned when a server presents a certificate that does not match the pinned one.
+type CertificateChangedError struct {
+	URI     string
+	Pinned  string
+	Current string
+}
+
+// Error implements error interface.
+func (c *CertificateChangedError) Error() string {
+	return fmt.Sprintf("certificate of %s has changed (pinned %s, got %s), review it with \"cells-sync pins\"", c.URI, c.Pinned, c.Current)
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of a certificate, as colon-separated hex bytes.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// FetchCertificate connects to an https server and returns information about its certificate, without
+// verifying it.
+func FetchCertificate(uri string) (*CertificateInfo, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return nil, e
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("%s does not use TLS", uri)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	conn, e := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", host, &tls.Config{InsecureSkipVerify: true})
+	if e != nil {
+		return nil, e
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s did not present any certificate", uri)
+	}
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, verifyErr := leaf.Verify(x509.VerifyOptions{DNSName: u.Hostname(), Intermediates: intermediates})
+	return &CertificateInfo{
+		Fingerprint: CertificateFingerprint(leaf),
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		NotAfter:    leaf.NotAfter,
+		Trusted:     verifyErr == nil,
+	}, nil
+}
+
+// pinFirstUse pins the certificate of a new authority if it is not trusted by the system roots, typically for
+// self-hosted servers using a private CA. Certificates from public CAs are renewed often and are not pinned.
+func (a *Authority) pinFirstUse() {
+	if a.CertificatePin != "" || !strings.HasPrefix(a.URI, "https://") {
+		return
+	}
+	if info, e := FetchCertificate(a.URI); e == nil && !info.Trusted {
+		a.CertificatePin = info.Fingerprint
+	}
+}
+
+// VerifyCertificatePin checks that the server still presents the pinned certificate.
+func (a *Authority) VerifyCertificatePin() error {
+	if a.CertificatePin == "" {
+		return nil
+	}
+	info, e := FetchCertificate(a.BaseURL())
+	if e != nil {
+		return e
+	}
+	if info.Fingerprint != a.CertificatePin {
+		return &CertificateChangedError{URI: a.URI, Pinned: a.CertificatePin, Current: info.Fingerprint}
+	}
+	return nil
+}
+
+// pinnedTLSConfig accepts the pinned certificate only, whatever its issuer.
+func (a *Authority) pinnedTLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no certificate presented")
+			}
+			cert, e := x509.ParseCertificate(rawCerts[0])
+			if e != nil {
+				return e
+			}
+			if fp := CertificateFingerprint(cert); fp != a.CertificatePin {
+				return &CertificateChangedError{URI: a.URI, Pinned: a.CertificatePin, Current: fp}
+			}
+			return nil
+		},
+	}
+}
+
+// ResetCertificatePin pins the certificate currently presented by the server of an authority, or removes the pin
+// if unpin is true. It returns the new pin.
+func (g *Global) ResetCertificatePin(id string, unpin bool) (string, error) {
+	for _, a := range g.Authorities {
+		if a.key() != id && a.Id != id {
+			continue
+		}
+		if unpin {
+			a.CertificatePin = ""
+		} else {
+			info, e := FetchCertificate(a.URI)
+			if e != nil {
+				return "", e
+			}
+			a.CertificatePin = info.Fingerprint
+		}
+		return a.CertificatePin, Save()
+	}
+	return "", fmt.Errorf("cannot find authority %s", id)
+}
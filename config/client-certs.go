@@ -0,0 +1,153 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storeRefPrefix marks a reference to a certificate of the OS store instead of a PEM file.
+const storeRefPrefix = "store:"
+
+var installTransport sync.Once
+
+// clientCertificate loads the client certificate configured for the authority, or returns nil if there is none.
+func (a *Authority) clientCertificate() (*tls.Certificate, error) {
+	if a.ClientCert == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(a.ClientCert, storeRefPrefix) {
+		return nil, fmt.Errorf("OS certificate store references (%s) are not supported, please export the certificate and key as PEM files", a.ClientCert)
+	}
+	key := a.ClientKey
+	if key == "" {
+		// Certificate and key may be bundled in the same PEM file
+		key = a.ClientCert
+	}
+	cert, e := tls.LoadX509KeyPair(a.ClientCert, key)
+	if e != nil {
+		return nil, e
+	}
+	return &cert, nil
+}
+
+// tlsConfig builds the TLS configuration used to contact the authority server: pinned certificate or skip verify,
+// and client certificate. It returns nil if the defaults apply.
+func (a *Authority) tlsConfig() (*tls.Config, error) {
+	var conf *tls.Config
+	if a.CertificatePin != "" {
+		conf = a.pinnedTLSConfig()
+	} else if a.InsecureSkipVerify {
+		conf = &tls.Config{InsecureSkipVerify: true}
+	}
+	cert, e := a.clientCertificate()
+	if e != nil {
+		return nil, e
+	}
+	if cert != nil {
+		if conf == nil {
+			conf = &tls.Config{}
+		}
+		conf.Certificates = []tls.Certificate{*cert}
+	}
+	return conf, nil
+}
+
+// SetClientCertificate configures the client certificate and key sent to the server of an authority, typically
+// required by a reverse proxy. The pair is checked before saving. Empty values remove the client certificate.
+func (g *Global) SetClientCertificate(id, cert, key string) error {
+	for _, a := range g.Authorities {
+		if a.key() != id && a.Id != id {
+			continue
+		}
+		a.ClientCert = cert
+		a.ClientKey = key
+		if _, e := a.clientCertificate(); e != nil {
+			return e
+		}
+		return Save()
+	}
+	return fmt.Errorf("cannot find authority %s", id)
+}
+
+// InstallSharedTransport sets up the default HTTP transport so that connections to the servers go through the
+// configured proxies, and TLS connections to the server of an authority use its specific TLS configuration, in
+// particular its client certificate. It must be called before the transport is wrapped by other round trippers.
+func InstallSharedTransport() {
+	installTransport.Do(func() {
+		t, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return
+		}
+		// Proxies are handled by DialContext, so that the TLS handshake always happens end-to-end
+		t.Proxy = nil
+		t.DialContext = DialContext
+		t.DialTLS = func(network, addr string) (net.Conn, error) {
+			host, _, e := net.SplitHostPort(addr)
+			if e != nil {
+				return nil, e
+			}
+			conf := &tls.Config{}
+			if a := authorityForAddr(addr); a != nil {
+				ac, e := a.tlsConfig()
+				if e != nil {
+					return nil, e
+				}
+				if ac != nil {
+					conf = ac
+				}
+			}
+			conf = conf.Clone()
+			conf.ServerName = host
+			conn, e := DialContext(context.Background(), network, addr)
+			if e != nil {
+				return nil, e
+			}
+			tlsConn := tls.Client(conn, conf)
+			conn.SetDeadline(time.Now().Add(t.TLSHandshakeTimeout))
+			if e := tlsConn.Handshake(); e != nil {
+				conn.Close()
+				return nil, e
+			}
+			conn.SetDeadline(time.Time{})
+			return tlsConn, nil
+		}
+	})
+}
+
+// authorityForAddr finds the authority whose server listens on addr (host:port), under its main URL or one of
+// its alternate URLs.
+func authorityForAddr(addr string) *Authority {
+	for _, a := range Default().Authorities {
+		for _, uri := range a.CandidateURIs("") {
+			if host, e := normalizeAddr(uri); e == nil && host == addr {
+				return a
+			}
+		}
+	}
+	return nil
+}
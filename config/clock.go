@@ -0,0 +1,257 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and timers. Time-based logic (schedules, debouncing, token refresh) uses the
+// clock returned by GetClock, so that tests and the simulate mode can fast-forward time deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a Clock timer, similar to time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a Clock ticker, similar to time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+var (
+	clock     Clock = systemClock{}
+	clockLock sync.RWMutex
+)
+
+// GetClock returns the clock currently used by the application.
+func GetClock() Clock {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return clock
+}
+
+// SetClock replaces the application clock. It must be called before services are started.
+func SetClock(c Clock) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	clock = c
+}
+
+// systemClock is the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTimer(d time.Duration) Timer         { return &systemTimer{time.NewTimer(d)} }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return &systemTicker{time.NewTicker(d)} }
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct{ *time.Timer }
+
+func (t *systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+type systemTicker struct{ *time.Ticker }
+
+func (t *systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// SimulatedClock is a Clock whose time only moves when Advance is called. Timers and tickers fire in order of
+// their deadlines while time is advanced.
+type SimulatedClock struct {
+	sync.Mutex
+	now     time.Time
+	waiters []*simulatedTimer
+	changed *sync.Cond
+}
+
+// NewSimulatedClock creates a SimulatedClock starting at the given time.
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	s := &SimulatedClock{now: start}
+	s.changed = sync.NewCond(&s.Mutex)
+	return s
+}
+
+// Now implements Clock interface.
+func (s *SimulatedClock) Now() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.now
+}
+
+// After implements Clock interface.
+func (s *SimulatedClock) After(d time.Duration) <-chan time.Time {
+	return s.NewTimer(d).C()
+}
+
+// NewTimer implements Clock interface.
+func (s *SimulatedClock) NewTimer(d time.Duration) Timer {
+	t := &simulatedTimer{clock: s, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker implements Clock interface.
+func (s *SimulatedClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &simulatedTimer{clock: s, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return &simulatedTicker{t}
+}
+
+// AfterFunc implements Clock interface.
+func (s *SimulatedClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &simulatedTimer{clock: s, f: f}
+	t.Reset(d)
+	return t
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, so that a caller can make sure that the code
+// under test armed its timers before advancing the time.
+func (s *SimulatedClock) BlockUntil(n int) {
+	s.Lock()
+	defer s.Unlock()
+	for len(s.waiters) < n {
+		s.changed.Wait()
+	}
+}
+
+// BlockUntilDeadline waits until a timer or ticker is pending with the given deadline, so that a caller can make
+// sure that the code under test re-armed a timer before advancing the time.
+func (s *SimulatedClock) BlockUntilDeadline(deadline time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for {
+		for _, w := range s.waiters {
+			if w.deadline.Equal(deadline) {
+				return
+			}
+		}
+		s.changed.Wait()
+	}
+}
+
+// Advance moves the time forward, firing the timers and tickers whose deadline is reached. Functions of AfterFunc
+// timers are run before Advance returns, and channels receive the time without blocking, like with real timers.
+// Use BlockUntil to wait for the timers that receivers create in turn.
+func (s *SimulatedClock) Advance(d time.Duration) {
+	s.Lock()
+	target := s.now.Add(d)
+	s.Unlock()
+	for {
+		s.Lock()
+		sort.SliceStable(s.waiters, func(i, j int) bool { return s.waiters[i].deadline.Before(s.waiters[j].deadline) })
+		if len(s.waiters) == 0 || s.waiters[0].deadline.After(target) {
+			s.now = target
+			s.Unlock()
+			return
+		}
+		w := s.waiters[0]
+		s.now = w.deadline
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+		} else {
+			s.waiters = s.waiters[1:]
+		}
+		now := s.now
+		s.Unlock()
+		if w.f != nil {
+			w.f()
+		} else {
+			w.fire(now)
+		}
+	}
+}
+
+// remove unregisters a timer, the lock must be held.
+func (s *SimulatedClock) remove(t *simulatedTimer) bool {
+	for i, w := range s.waiters {
+		if w == t {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type simulatedTimer struct {
+	clock    *SimulatedClock
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+	f        func()
+}
+
+// fire runs the function of an AfterFunc timer, or sends the time on the channel without blocking.
+func (t *simulatedTimer) fire(now time.Time) {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *simulatedTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *simulatedTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *simulatedTimer) Reset(d time.Duration) bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	active := t.clock.remove(t)
+	if d <= 0 && t.period == 0 {
+		t.fire(t.clock.now)
+		return active
+	}
+	t.deadline = t.clock.now.Add(d)
+	t.clock.waiters = append(t.clock.waiters, t)
+	t.clock.changed.Broadcast()
+	return active
+}
+
+type simulatedTicker struct{ *simulatedTimer }
+
+func (t *simulatedTicker) Stop() {
+	t.simulatedTimer.Stop()
+}
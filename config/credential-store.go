@@ -0,0 +1,262 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/pydio/cells/common/log"
+)
+
+// credentialStore persists secrets outside of the config file.
+type credentialStore interface {
+	Set(key, value string) error
+	Get(key string) (string, error)
+	Delete(key string) error
+}
+
+// CredentialsPassphraseEnv is the environment variable holding the passphrase of the credentials file, used
+// when the OS keychain is not available.
+const CredentialsPassphraseEnv = "CELLS_SYNC_CREDENTIALS_PASSPHRASE"
+
+const (
+	credentialsSaltSize   = 16
+	credentialsIterations = 200000
+)
+
+var (
+	credentialsOnce  sync.Once
+	credentialsStore credentialStore
+	errNoCredential  = errors.New("credential not found")
+	errNoPassphrase  = errors.New("OS keychain is not available, set " + CredentialsPassphraseEnv + " to store secrets in an encrypted file")
+)
+
+// credentials returns the store used for authorities tokens: the OS keychain (macOS Keychain, Windows
+// Credential Manager, Secret Service on Linux), falling back to a file encrypted with a user passphrase in the
+// application data dir when the keychain is not available.
+func credentials() credentialStore {
+	credentialsOnce.Do(func() {
+		dir := SyncClientDataDir()
+		credentialsStore = &fallbackStore{
+			primary:  keyringStore{},
+			fallback: &fileStore{path: filepath.Join(dir, "credentials.enc")},
+		}
+	})
+	return credentialsStore
+}
+
+// keyringStore uses the OS keychain.
+type keyringStore struct{}
+
+func (keyringStore) Set(key, value string) error {
+	return keyring.Set(keyringService, key, value)
+}
+
+func (keyringStore) Get(key string) (string, error) {
+	return keyring.Get(keyringService, key)
+}
+
+func (keyringStore) Delete(key string) error {
+	return keyring.Delete(keyringService, key)
+}
+
+// fallbackStore writes to the primary store if possible, and to the fallback store otherwise.
+type fallbackStore struct {
+	primary  credentialStore
+	fallback credentialStore
+	warned   bool
+}
+
+func (f *fallbackStore) Set(key, value string) error {
+	e := f.primary.Set(key, value)
+	if e == nil {
+		// Remove a copy written while the keychain was not available
+		f.fallback.Delete(key)
+		return nil
+	}
+	if fe := f.fallback.Set(key, value); fe != nil {
+		if !f.warned {
+			log.Logger(oidcContext).Warn("OS keychain is not available (" + e.Error() + ") and secrets cannot be encrypted: " + fe.Error() + ". Tokens are kept in the config file in plain text.")
+			f.warned = true
+		}
+		return fe
+	}
+	return nil
+}
+
+func (f *fallbackStore) Get(key string) (string, error) {
+	if value, e := f.primary.Get(key); e == nil {
+		return value, nil
+	}
+	return f.fallback.Get(key)
+}
+
+func (f *fallbackStore) Delete(key string) error {
+	e1 := f.primary.Delete(key)
+	e2 := f.fallback.Delete(key)
+	if e1 != nil && e2 != nil {
+		return e1
+	}
+	return nil
+}
+
+// fileStore keeps secrets in a file encrypted with AES-GCM, only readable by the current user. The key is derived
+// from the passphrase given in the CredentialsPassphraseEnv environment variable, with a random salt stored in the
+// file header: nothing stored on disk is enough to decrypt it. Without passphrase, the store refuses secrets and
+// tokens stay in the config file. The OS keychain is always tried first.
+type fileStore struct {
+	sync.Mutex
+	path string
+	// salt and key cache the last derivation, as it is slow on purpose
+	salt []byte
+	key  []byte
+}
+
+func (f *fileStore) Set(key, value string) error {
+	f.Lock()
+	defer f.Unlock()
+	values, e := f.load()
+	if e != nil {
+		return e
+	}
+	values[key] = value
+	return f.save(values)
+}
+
+func (f *fileStore) Get(key string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+	values, e := f.load()
+	if e != nil {
+		return "", e
+	}
+	if value, ok := values[key]; ok {
+		return value, nil
+	}
+	return "", errNoCredential
+}
+
+func (f *fileStore) Delete(key string) error {
+	f.Lock()
+	defer f.Unlock()
+	values, e := f.load()
+	if e != nil {
+		return e
+	}
+	if _, ok := values[key]; !ok {
+		return errNoCredential
+	}
+	delete(values, key)
+	return f.save(values)
+}
+
+// pbkdf2 derives a 32 bytes key from a passphrase (PBKDF2-HMAC-SHA256, RFC 8018, single block).
+func pbkdf2(passphrase, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, passphrase)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	key := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// cipher derives the encryption key for a salt.
+func (f *fileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	passphrase := os.Getenv(CredentialsPassphraseEnv)
+	if passphrase == "" {
+		return nil, errNoPassphrase
+	}
+	if f.key == nil || !bytes.Equal(f.salt, salt) {
+		f.salt, f.key = salt, pbkdf2([]byte(passphrase), salt, credentialsIterations)
+	}
+	block, e := aes.NewCipher(f.key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+func (f *fileStore) load() (map[string]string, error) {
+	values := make(map[string]string)
+	data, e := ioutil.ReadFile(f.path)
+	if os.IsNotExist(e) {
+		return values, nil
+	} else if e != nil {
+		return nil, e
+	}
+	if len(data) < credentialsSaltSize {
+		return nil, errors.New("invalid credentials file")
+	}
+	gcm, e := f.cipher(data[:credentialsSaltSize])
+	if e != nil {
+		return nil, e
+	}
+	data = data[credentialsSaltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid credentials file")
+	}
+	plain, e := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if e != nil {
+		return nil, e
+	}
+	return values, json.Unmarshal(plain, &values)
+}
+
+func (f *fileStore) save(values map[string]string) error {
+	salt := make([]byte, credentialsSaltSize)
+	if _, e := io.ReadFull(rand.Reader, salt); e != nil {
+		return e
+	}
+	gcm, e := f.cipher(salt)
+	if e != nil {
+		return e
+	}
+	plain, e := json.Marshal(values)
+	if e != nil {
+		return e
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, e := io.ReadFull(rand.Reader, nonce); e != nil {
+		return e
+	}
+	return ioutil.WriteFile(f.path, gcm.Seal(append(salt, nonce...), nonce, plain, nil), 0600)
+}
@@ -22,6 +22,7 @@ package config
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	"github.com/shibukawa/configdir"
@@ -47,3 +48,24 @@ func SyncClientDataDir() string {
 
 	return f
 }
+
+// AgentDirectories lists the folders written by the agent itself: application data (configs, state and snapshot
+// DBs), logs, quarantine folders and the updater temporary folder. They must never be synced.
+func AgentDirectories() []string {
+	dirs := []string{SyncClientDataDir(), filepath.Join(os.TempDir(), "pydio-update")}
+	g := Default()
+	if g.Logs != nil && g.Logs.Folder != "" {
+		dirs = append(dirs, g.Logs.Folder)
+	}
+	for _, t := range g.Tasks {
+		if t.Scanner != nil && t.Scanner.Quarantine != "" {
+			dirs = append(dirs, t.Scanner.Quarantine)
+		}
+	}
+	for i, d := range dirs {
+		if abs, e := filepath.Abs(d); e == nil {
+			dirs[i] = abs
+		}
+	}
+	return dirs
+}
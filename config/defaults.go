@@ -23,7 +23,11 @@ package config
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/pborman/uuid"
 
 	"github.com/pydio/cells/common/log"
 )
@@ -36,12 +40,27 @@ const (
 
 // Global is the main struct representing configs.
 type Global struct {
+	DeviceId    string
+	DeviceName  string
 	Tasks       []*Task
 	Authorities []*Authority
 	Logs        *Logs
 	Updates     *Updates
 	Debugging   *Debugging
 	Service     *Service
+	Smtp        *Smtp
+	Mqtt        *Mqtt
+	Activity    *Activity
+	Proxy       *Proxy
+	Bandwidth   *Bandwidth
+	Startup     *Startup
+	Storage     *Storage
+	Fleet       *Fleet       `json:"Fleet,omitempty"`
+	Devices     *Devices     `json:"Devices,omitempty"`
+	Managed     *Managed     `json:"Managed,omitempty"`
+	DiskSpace   *DiskSpace   `json:"DiskSpace,omitempty"`
+	Helpers     []*Helper    `json:"Helpers,omitempty"`
+	FilterSets  []*FilterSet `json:"FilterSets,omitempty"`
 	changes     []chan interface{}
 }
 
@@ -51,6 +70,11 @@ type TaskChange struct {
 	Task *Task
 }
 
+// GlobalChange is an event sent when a global section of the configs changes.
+type GlobalChange struct {
+	Section string
+}
+
 // Tasks represents a sync task configuration.
 type Task struct {
 	Uuid           string
@@ -60,9 +84,407 @@ type Task struct {
 	Direction      string
 	SelectiveRoots []string
 
+	// File restricts the task to a single file of the root folders (e.g. a password database). It is set when
+	// a task is saved with the URI of a file: the URI is then replaced by its parent folder.
+	File string `json:"File,omitempty"`
+
+	// Revision is incremented on each update. Updates carrying an older revision are rejected with a
+	// RevisionConflictError, so that concurrent edits do not overwrite each other.
+	Revision int `json:"Revision,omitempty"`
+
 	Realtime     bool
 	LoopInterval string
 	HardInterval string
+
+	// ReconnectDelay is the number of seconds both sides must stay connected after a reconnection before the task
+	// syncs (default 10). The delay grows exponentially while an endpoint keeps reconnecting.
+	ReconnectDelay int `json:"ReconnectDelay,omitempty"`
+
+	// Cron triggers a sync loop on a 5-field cron expression in local time (e.g. "0 2 * * *" every day at 02:00).
+	// Combined with Realtime false, the task stays idle between runs.
+	Cron string `json:"Cron,omitempty"`
+
+	// Manual only syncs the task when the user runs it: the task never watches the folders and ignores the
+	// loop, resync and cron schedules. It is not even scanned at startup, until its first run.
+	Manual bool `json:"Manual,omitempty"`
+
+	// AuditOnly never applies any operation: both sides are compared on the task schedule (LoopInterval,
+	// HardInterval or Cron) and the differences are reported, e.g. to monitor folders that must stay identical.
+	AuditOnly bool `json:"AuditOnly,omitempty"`
+
+	// After chains the task to the task with this Uuid (e.g. server to laptop, then laptop to external drive): the
+	// task does not watch its folders and runs once after each pass of the previous task that changed files.
+	After string `json:"After,omitempty"`
+
+	// Managed tasks are provisioned by the organization policy of the managed mode: they are created, updated
+	// and removed when the policy changes, local edits are overwritten
+	Managed bool `json:"Managed,omitempty"`
+
+	// HiddenFiles is the policy for files starting with a dot: "sync" (default), "ignore" or "download-only"
+	HiddenFiles string `json:"HiddenFiles,omitempty"`
+
+	Report *TaskReport   `json:"Report,omitempty"`
+	Rescan *RescanPolicy `json:"Rescan,omitempty"`
+
+	// Integrity re-hashes a random sample of the local files on a schedule to detect silent corruption
+	Integrity *IntegritySampling `json:"Integrity,omitempty"`
+
+	// Blackouts are schedules during which the task stays paused
+	Blackouts []*Blackout `json:"Blackouts,omitempty"`
+
+	// Hooks are commands run on individual file events
+	Hooks []*Hook `json:"Hooks,omitempty"`
+
+	// MergeDrivers merge both versions of conflicting files of known formats instead of creating conflict copies
+	MergeDrivers []*MergeDriver `json:"MergeDrivers,omitempty"`
+
+	// Scanner checks downloaded files before they are moved into place
+	Scanner *Scanner `json:"Scanner,omitempty"`
+
+	// UploadRules block local files from being uploaded
+	UploadRules *UploadRules `json:"UploadRules,omitempty"`
+
+	// CloudCompat tunes local change detection for folders managed by another sync client
+	CloudCompat *CloudCompat `json:"CloudCompat,omitempty"`
+
+	// Standby is a mirror server used while the remote side of the task is unreachable
+	Standby *Standby `json:"Standby,omitempty"`
+
+	// ConsistentReads reads local files from a filesystem snapshot (VSS, APFS) during one-way backups
+	ConsistentReads bool `json:"ConsistentReads,omitempty"`
+
+	// AppendOnly never overwrites nor deletes files on the remote target of a one-way task
+	AppendOnly bool `json:"AppendOnly,omitempty"`
+
+	// Transforms change the contents of local files while they are uploaded, e.g. to strip the location of photos
+	Transforms []*Transform `json:"Transforms,omitempty"`
+
+	// PermanentDeletes removes the files deleted locally from the server, instead of moving them to its recycle bin
+	PermanentDeletes bool `json:"PermanentDeletes,omitempty"`
+
+	// Retention keeps the files deleted or replaced on the target of a one-way task for a while
+	Retention *Retention `json:"Retention,omitempty"`
+
+	// Trash moves the files deleted from the local folders into a recycle area instead of removing them
+	Trash *LocalTrash `json:"Trash,omitempty"`
+
+	// Import turns the task into a one-shot photo import instead of a synchronization
+	Import *ImportTask `json:"Import,omitempty"`
+
+	// Archive turns the task into a periodic export of the remote folder into a local archive
+	Archive *ArchiveTask `json:"Archive,omitempty"`
+
+	// Permissions sets the mode bits of the files and folders created in the local folder
+	Permissions *Permissions `json:"Permissions,omitempty"`
+
+	// ConflictPolicy resolves conflicts automatically: "keep-both", "newest", "keep-local" or "keep-remote".
+	// Default "ask" leaves them to the user. "newest" also asks when both versions were modified within two
+	// minutes, as the clocks of this machine and of the server may differ.
+	ConflictPolicy string `json:"ConflictPolicy,omitempty"`
+
+	// ConflictDefaults overrides ConflictPolicy depending on the kind of conflict
+	ConflictDefaults *ConflictDefaults `json:"ConflictDefaults,omitempty"`
+
+	// Ignores are gitignore-like patterns excluded from the sync, in addition to the .pydio-ignore file found
+	// at the root of the local folder
+	Ignores []string `json:"Ignores,omitempty"`
+
+	// FilterSets are the names of global filter sets applied on top of the task Ignores and UploadRules
+	FilterSets []string `json:"FilterSets,omitempty"`
+
+	// ExcludedPolicy tells what happens to the files that become excluded when the selective roots or the ignore
+	// patterns are edited: "keep" (default) leaves both copies in place, "delete-local" removes the local copies
+	// and "delete-remote" removes the copies on the server.
+	ExcludedPolicy string `json:"ExcludedPolicy,omitempty"`
+
+	// Privacy encrypts the file names of the task in its states, logs, reports and recent files, so that they can
+	// be shared with support without revealing document names. The key stays on the device to reveal them.
+	Privacy bool `json:"Privacy,omitempty"`
+
+	// Digests notify a summary of the files transferred after each burst of activity, grouped by top-level folder
+	Digests bool `json:"Digests,omitempty"`
+
+	// ManifestPath is a file where a SHA-256 manifest (sha256sum format) of the local folder is written after each
+	// sync pass, as an externally verifiable record of the delivered files
+	ManifestPath string `json:"ManifestPath,omitempty"`
+
+	// DiskSpace overrides the global free space thresholds for the local volume of this task
+	DiskSpace *DiskSpace `json:"DiskSpace,omitempty"`
+
+	// TrackActors records the local processes and OS users changing files in the audit log, where the platform
+	// allows it (Linux with administrative privileges)
+	TrackActors bool `json:"TrackActors,omitempty"`
+
+	// ContentCacheMB keeps up to this amount of the server files recently read by the task in a local cache, so
+	// that they are not downloaded again while they did not change on the server. Disabled if 0.
+	ContentCacheMB int `json:"ContentCacheMB,omitempty"`
+
+	// Transfers limits the throughput and the number of parallel transfers of the task
+	Transfers *TransferLimits `json:"Transfers,omitempty"`
+
+	// Profile tunes the task for the host it runs on. ProfileLowPower disables the realtime watcher and scans
+	// the task every ScanMinutes instead (default 15), with a single transfer at a time and smaller caches.
+	Profile     string `json:"Profile,omitempty"`
+	ScanMinutes int    `json:"ScanMinutes,omitempty"`
+
+	// Encoding renames local files whose names were written in a legacy encoding
+	Encoding *FilenameEncoding `json:"Encoding,omitempty"`
+}
+
+const (
+	// ProfileLowPower is the task profile for small devices like a Raspberry Pi or a NAS.
+	ProfileLowPower = "low-power"
+	// DefaultScanMinutes is the scan interval of tasks using the low-power profile.
+	DefaultScanMinutes = 15
+)
+
+// LowPower returns true if the task uses the low-power profile.
+func (t *Task) LowPower() bool {
+	return t.Profile == ProfileLowPower
+}
+
+// ScanInterval returns the duration between two scans of a task using the low-power profile.
+func (t *Task) ScanInterval() time.Duration {
+	if t.ScanMinutes > 0 {
+		return time.Duration(t.ScanMinutes) * time.Minute
+	}
+	return DefaultScanMinutes * time.Minute
+}
+
+// TransferLimits sets the maximum upload and download rates of a task, and its number of parallel transfers.
+// Zero values mean no limit.
+type TransferLimits struct {
+	UploadKB   int64
+	DownloadKB int64
+	Parallel   int
+}
+
+// TaskReport configures summary emails sent for a task. Frequency is either "run" (one mail after each
+// sync pass that changed something) or "daily". Subject and Body are text/template strings.
+type TaskReport struct {
+	Enabled    bool
+	Frequency  string
+	Recipients []string
+	Subject    string
+	Body       string
+}
+
+// RescanPolicy restricts when scheduled full rescans (HardInterval) may run. Windows are "HH:MM-HH:MM" ranges
+// in local time. If WhenIdle is set, rescans may also run when no user input was detected for IdleMinutes.
+// During BusinessHours, scheduled rescans read local data at most at BusinessRateKB KB/s (0 for no limit).
+// Manual resyncs always run immediately and without limit.
+type RescanPolicy struct {
+	Windows        []string
+	WhenIdle       bool
+	IdleMinutes    int
+	BusinessHours  string
+	BusinessRateKB int64
+}
+
+// IntegritySampling configures the spot checks of the local files: every IntervalDays (default 7), Percent of the
+// files (default 1) that were not modified since their last sync are hashed again and compared to their synced
+// checksum. Sampling is enabled unless Disabled is set.
+type IntegritySampling struct {
+	Disabled     bool    `json:"Disabled,omitempty"`
+	Percent      float64 `json:"Percent,omitempty"`
+	IntervalDays int     `json:"IntervalDays,omitempty"`
+}
+
+// Options returns the sampled ratio of files (0 if disabled) and the interval between two samplings.
+func (i *IntegritySampling) Options() (ratio float64, interval time.Duration) {
+	ratio, interval = 0.01, 7*24*time.Hour
+	if i == nil {
+		return
+	}
+	if i.Disabled {
+		return 0, interval
+	}
+	if i.Percent > 0 && i.Percent <= 100 {
+		ratio = i.Percent / 100
+	}
+	if i.IntervalDays > 0 {
+		interval = time.Duration(i.IntervalDays) * 24 * time.Hour
+	}
+	return
+}
+
+// Blackout is a recurring time window during which a task does not sync. Window is a "HH:MM-HH:MM" range
+// in local time, Days a list of week days ("mon", "tue", ...) on which it starts. Empty Days means every day.
+type Blackout struct {
+	Days   []string
+	Window string
+}
+
+// Hook runs an external command when a file event matches. Event is one of "download", "upload" or "delete"
+// (empty for all), Pattern a glob matched against the file name, or the full path if it contains a slash.
+// Arguments of Command may use the {path} (absolute local path), {rel} (path relative to the task root) and
+// {event} placeholders.
+type Hook struct {
+	Event   string
+	Pattern string
+	Command []string
+}
+
+// MergeDriver runs a three-way merge on conflicting files whose name matches Pattern (e.g. "*.ics"), using the
+// version of the last sync as base. Driver is "ics" (calendar events merged by UID), "lines" (plain-text lists) or
+// "command": Command then receives the {base}, {local} and {remote} placeholders, must write the result to {local}
+// and exit with 0 if the merge succeeded (e.g. keepassxc-cli merge for KeePass databases).
+type MergeDriver struct {
+	Pattern string
+	Driver  string
+	Command []string `json:"Command,omitempty"`
+}
+
+// Scanner configures a content scanner for downloaded files, either an external Command (exit code 0 for clean
+// files, 1 for infected ones, {path} is replaced by the file to scan) or an ICAP service URL like
+// icap://host:1344/avscan. Infected files are moved to the Quarantine folder.
+type Scanner struct {
+	Command    []string `json:"Command,omitempty"`
+	ICAP       string   `json:"ICAP,omitempty"`
+	Quarantine string   `json:"Quarantine,omitempty"`
+}
+
+// UploadRules are evaluated on local files before they are uploaded. MaxSize is in bytes (0 for no limit),
+// BlockedExtensions are like ".exe", BlockedMimeTypes like "application/x-msdownload" or "video/*", and
+// BlockedSignatures are hexadecimal prefixes of the file content (e.g. "4d5a" for Windows executables).
+type UploadRules struct {
+	MaxSize           int64    `json:"MaxSize,omitempty"`
+	BlockedExtensions []string `json:"BlockedExtensions,omitempty"`
+	BlockedMimeTypes  []string `json:"BlockedMimeTypes,omitempty"`
+	BlockedSignatures []string `json:"BlockedSignatures,omitempty"`
+}
+
+// ConflictDefaults sets the resolution of each kind of conflict: files created on both sides (Create), files
+// modified on both sides (Update), and files deleted on one side while modified on the other (DeleteEdit). Values
+// are the ones of the task ConflictPolicy, DeleteEdit also accepts "keep-edit" and "keep-deletion". Empty values
+// fall back to the task ConflictPolicy.
+type ConflictDefaults struct {
+	Create     string `json:"Create,omitempty"`
+	Update     string `json:"Update,omitempty"`
+	DeleteEdit string `json:"DeleteEdit,omitempty"`
+}
+
+// Transform changes the contents of local files while they are uploaded. Type is "strip-gps" (location removed
+// from the EXIF data of JPEG photos), "line-endings" (converted to LineEnding "lf" by default, or "crlf") or
+// "command" (Command is run with {in} replaced by the original file and {out} by the file to upload). Extensions
+// restrict the transformed files, like ".pdf". By default, strip-gps applies to .jpg and .jpeg files,
+// line-endings to .txt, .csv and .md files, and command to all files.
+type Transform struct {
+	Type       string
+	Extensions []string `json:"Extensions,omitempty"`
+	LineEnding string   `json:"LineEnding,omitempty"`
+	Command    []string `json:"Command,omitempty"`
+}
+
+// CloudCompat is a compatibility mode for local roots that live inside a OneDrive, Dropbox or iCloud folder:
+// local events are only forwarded once the folder has been quiet for DebounceSeconds (default 30), and the
+// task is re-synced every PollMinutes (default 5) to catch changes applied by the other client without events.
+type CloudCompat struct {
+	PollMinutes     int
+	DebounceSeconds int
+}
+
+// Standby declares a mirror of the remote side of a task. When the primary server has been unreachable for
+// ThresholdMinutes (default 15), the task syncs with the URI of the mirror, with its own snapshots. Once the
+// primary answers again, the task switches back and runs a full resync to merge the changes made meanwhile.
+type Standby struct {
+	URI              string
+	ThresholdMinutes int
+}
+
+// Proxy configures the proxy used to reach the servers. The URL scheme is http, https or socks5 (e.g.
+// socks5://host:1080), or "direct" to bypass any proxy. Auth applies to http(s) proxies and is one of basic
+// (default), ntlm or negotiate. NoProxy is a comma-separated list of hosts that are contacted directly.
+// When no proxy is configured, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used, then
+// the system settings (including PAC scripts) on Windows and macOS.
+type Proxy struct {
+	URL      string
+	Username string
+	Password string
+	Auth     string
+	NoProxy  string
+}
+
+// Bandwidth limits the transfer rate depending on the network in use. The first rule whose Network matches the
+// Wi-Fi SSID or the interface name applies, otherwise DefaultRateKB. A rate of 0 means no limit.
+type Bandwidth struct {
+	Enabled       bool
+	DefaultRateKB int64
+	Rules         []*NetworkRule
+}
+
+// NetworkRule sets the rate limit for a given network (SSID or interface name).
+type NetworkRule struct {
+	Network string
+	RateKB  int64
+}
+
+// Retention moves the files deleted or overwritten on the target of a one-way task into a stash folder on that
+// target instead of losing them. Deleted files are kept KeepDeletedDays, previous versions KeepVersionsDays, and
+// the oldest entries are pruned when the stash grows over MaxSizeGB. Zero values mean no limit. Rules are enforced
+// on the Interval ISO8601 schedule (daily by default).
+type Retention struct {
+	KeepDeletedDays  int
+	KeepVersionsDays int
+	MaxSizeGB        float64
+	Interval         string `json:"Interval,omitempty"`
+}
+
+// LocalTrash moves the files deleted by the sync from a local folder into its .pydio-trash folder, from where they
+// can be restored. Items are purged after KeepDays, and the oldest ones when the trash grows over MaxSizeGB. Zero
+// values mean no limit. The trash is purged on the same schedule as the retention rules (daily by default).
+// It cannot be combined with Retention, whose stash already keeps the deleted files of the target.
+type LocalTrash struct {
+	KeepDays  int
+	MaxSizeGB float64
+}
+
+// checkTrash rejects a task enabling both the local trash and the retention rules: deleted files would only go to
+// the stash, and the trash settings would be silently ignored.
+func checkTrash(t *Task) error {
+	if t.Trash != nil && t.Retention != nil {
+		return fmt.Errorf("the local trash cannot be used with retention rules, deleted files are already kept in the stash")
+	}
+	return nil
+}
+
+// FilenameEncoding renames the files of the local folders whose names were written in a legacy encoding by old
+// systems and appear as mojibake. Source is "latin1", "cp1252" or "auto" (default), which also fixes names that
+// were converted to UTF-8 twice. Renames are only applied on start if Apply is set: "cells-sync transcode"
+// reports them first.
+type FilenameEncoding struct {
+	Source string `json:"Source,omitempty"`
+	Apply  bool   `json:"Apply,omitempty"`
+}
+
+// ImportTask uploads the files found in the local folder of a task (typically a camera card mount) into its
+// remote folder, following a path Template rendered from the EXIF capture date. Template is a text/template
+// using .Year, .Month, .Day, .Camera, .Name (without extension) and .Ext, e.g. "Photos/{{.Year}}/{{.Month}}/{{.Name}}{{.Ext}}".
+// Only files matching Extensions are imported (common photo and video formats by default). Files whose content
+// was already imported are skipped, and the local folder is never modified.
+type ImportTask struct {
+	Template   string
+	Extensions []string `json:"Extensions,omitempty"`
+}
+
+// ArchiveTask packages the remote folder into an archive written in the local folder on each run of the task,
+// instead of mirroring the tree. Format is "zip" (default), "tar" or "tar.gz". The archive is
+// named after Name (default the task label) and replaced on each run, unless Versions is greater than 1: each run
+// then writes a dated archive and only the last Versions ones are kept. Files unchanged since the previous run are
+// copied from the previous archive instead of being downloaded again, except for the "tar.gz" format.
+type ArchiveTask struct {
+	Format   string `json:"Format,omitempty"`
+	Name     string `json:"Name,omitempty"`
+	Versions int    `json:"Versions,omitempty"`
+}
+
+// Permissions are the mode bits applied to the files and folders created locally by a task, as octal strings
+// (e.g. "0640" and "0750"). If Inherit is set, new entries copy the mode of their parent folder instead, without
+// the executable bits for files. Empty values keep the process umask.
+type Permissions struct {
+	FileMode string `json:"FileMode,omitempty"`
+	DirMode  string `json:"DirMode,omitempty"`
+	Inherit  bool   `json:"Inherit,omitempty"`
 }
 
 // Logs represents the logs configuration.
@@ -71,6 +493,16 @@ type Logs struct {
 	MaxFilesNumber int
 	MaxFilesSize   int
 	MaxAgeDays     int
+	Remote         *RemoteLogs `json:"Remote,omitempty"`
+}
+
+// RemoteLogs configures the opt-in shipping of client logs to the Cells servers used by the tasks, so that their
+// administrators can troubleshoot sync problems. Only lines of Level or above (default "warn") are sent, at most
+// MaxPerMinute (default 20), with local paths and credentials filtered out.
+type RemoteLogs struct {
+	Enabled      bool
+	Level        string `json:"Level,omitempty"`
+	MaxPerMinute int    `json:"MaxPerMinute,omitempty"`
 }
 
 // Updates represents the update-mechanism configuration.
@@ -87,9 +519,116 @@ type Debugging struct {
 	ShowPanels bool
 }
 
-// Service is a simple section for enabling/disabling shortcuts or service (depending on OS).
+// Service is a simple section for enabling/disabling shortcuts or service (depending on OS). StartMinimized only
+// shows the tray icon when started with the session, and Background starts no UI process at all.
 type Service struct {
-	AutoStart bool
+	AutoStart      bool
+	StartMinimized bool
+	Background     bool
+}
+
+// Smtp configures the mail server used for sending task reports. Password is only used to set a new password:
+// it is kept in the credential store, and HasPassword tells clients that one is stored. Sending HasPassword
+// false without a Password removes it.
+type Smtp struct {
+	Host        string
+	Port        int
+	User        string
+	Password    string `json:",omitempty"`
+	HasPassword bool
+	From        string
+}
+
+// Mqtt configures the publication of tasks states to an MQTT broker. Like for Smtp, Password is only used to set
+// a new password, which is kept in the credential store.
+type Mqtt struct {
+	Enabled     bool
+	BrokerUrl   string
+	ClientId    string
+	Username    string
+	Password    string `json:",omitempty"`
+	HasPassword bool
+	TopicPrefix string
+	Retain      bool
+}
+
+// Fleet configures the opt-in reporting of tasks summaries to a central collector hosted by the administrators
+// of a fleet of installs. Summaries are posted as JSON to CollectorUrl every IntervalMinutes (default 15), with
+// Token as a bearer token if set.
+type Fleet struct {
+	Enabled         bool
+	CollectorUrl    string
+	Token           string
+	IntervalMinutes int
+}
+
+// Devices configures the registration of this device on the servers. Stock Cells servers do not expose a devices
+// API: ApiPath (default "/a/sync-devices") must point to a server extension answering PUT {ApiPath}/{deviceId}
+// and GET {ApiPath}/{deviceId}/revocation. Servers answering 404 or 501 are not asked again. The local copies of
+// a revoked device are deleted, unless KeepRevokedData is set: they are then only renamed.
+type Devices struct {
+	ApiPath         string `json:"ApiPath,omitempty"`
+	KeepRevokedData bool   `json:"KeepRevokedData,omitempty"`
+}
+
+// Helper is an auxiliary process started with the agent and restarted when it exits, e.g. a shell extension host
+// or a scanner bridge. Command is the executable followed by its arguments. The agent gives up after MaxRetries
+// consecutive crashes (default 10, -1 for no limit).
+type Helper struct {
+	Name       string
+	Command    []string
+	MaxRetries int `json:"MaxRetries,omitempty"`
+}
+
+// Managed enables the managed mode: a signed policy listing the tasks to provision is pulled from PolicyUrl
+// every IntervalMinutes (default 60), and verified with PublicKey (RSA, PEM format). AppliedRevision is the
+// revision of the last applied policy, older policies are rejected.
+type Managed struct {
+	Enabled         bool
+	PolicyUrl       string
+	PublicKey       string
+	IntervalMinutes int
+	AppliedRevision int `json:"AppliedRevision,omitempty"`
+}
+
+// NewMqtt creates defaults for Mqtt.
+func NewMqtt() *Mqtt {
+	return &Mqtt{
+		ClientId:    "cells-sync",
+		TopicPrefix: "cells-sync",
+		Retain:      true,
+	}
+}
+
+// Activity configures the throttling of heavy work (hashing, transfers) while the user is active.
+// The user is considered idle when no input was detected for IdleMinutes.
+type Activity struct {
+	Enabled      bool
+	IdleMinutes  int
+	ActiveRateKB int64
+}
+
+// Startup staggers the initial scans of the tasks when the agent starts, smallest tasks first, so that they do not
+// all hit the disk at the same time. MaxConcurrentScans 0 means no limit.
+type Startup struct {
+	MaxConcurrentScans int
+	StaggerSeconds     int
+}
+
+// NewStartup creates defaults for Startup.
+func NewStartup() *Startup {
+	return &Startup{
+		MaxConcurrentScans: 2,
+		StaggerSeconds:     10,
+	}
+}
+
+// NewActivity creates defaults for Activity.
+func NewActivity() *Activity {
+	return &Activity{
+		IdleMinutes:  5,
+		ActiveRateKB: 1024,
+	}
 }
 
 // ShortcutOptions defines where to create shortcuts.
@@ -128,8 +667,19 @@ func NewUpdates() *Updates {
 
 // CreateTask adds a Task to the config and emits a TaskChange event "create".
 func (g *Global) CreateTask(t *Task) error {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	g.syncSavedTasks()
+	if e := checkChain(g.Tasks, t); e != nil {
+		return e
+	}
+	if e := checkTrash(t); e != nil {
+		return e
+	}
+	splitFileRoot(t)
+	t.Revision = 1
 	g.Tasks = append(g.Tasks, t)
-	e := Save()
+	e := save()
 	if e == nil {
 		go func() {
 			for _, c := range g.changes {
@@ -142,14 +692,24 @@ func (g *Global) CreateTask(t *Task) error {
 
 // RemoveTask removes a Task from the config and emits a TaskChange event "remove".
 func (g *Global) RemoveTask(task *Task) error {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	g.syncSavedTasks()
 	var newTasks []*Task
+	var found bool
 	for _, t := range g.Tasks {
 		if t.Uuid != task.Uuid {
 			newTasks = append(newTasks, t)
+		} else {
+			found = true
 		}
 	}
+	if !found {
+		// Already removed by another process
+		return nil
+	}
 	g.Tasks = newTasks
-	e := Save()
+	e := save()
 	if e == nil {
 		go func() {
 			for _, c := range g.changes {
@@ -160,8 +720,33 @@ func (g *Global) RemoveTask(task *Task) error {
 	return e
 }
 
-// UpdateTask updates a Task inside the config and emits a TaskChange event "update".
+// UpdateTask updates a Task inside the config and emits a TaskChange event "update". The task must carry the
+// revision it was read with: if the task was modified since, a RevisionConflictError is returned and nothing is
+// saved. The revision of the task is incremented otherwise.
 func (g *Global) UpdateTask(task *Task) error {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	g.syncSavedTasks()
+	var current *Task
+	for _, t := range g.Tasks {
+		if t.Uuid == task.Uuid {
+			current = t
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("cannot find task %s", task.Uuid)
+	}
+	if task.Revision != current.Revision {
+		return &RevisionConflictError{Uuid: task.Uuid, Revision: task.Revision, Current: current.Revision}
+	}
+	if e := checkChain(g.Tasks, task); e != nil {
+		return e
+	}
+	if e := checkTrash(task); e != nil {
+		return e
+	}
+	splitFileRoot(task)
+	task.Revision = current.Revision + 1
 	var newTasks []*Task
 	for _, t := range g.Tasks {
 		if t.Uuid == task.Uuid {
@@ -171,7 +756,7 @@ func (g *Global) UpdateTask(task *Task) error {
 		}
 	}
 	g.Tasks = newTasks
-	e := Save()
+	e := save()
 	if e == nil {
 		go func() {
 			for _, c := range g.changes {
@@ -182,8 +767,42 @@ func (g *Global) UpdateTask(task *Task) error {
 	return e
 }
 
+// RestartTask emits a TaskChange event "update" for a task without modifying it, so that it is restarted with
+// settings that are not stored in its config, e.g. when its server policy changed.
+func (g *Global) RestartTask(uuid string) {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	for _, t := range g.Tasks {
+		if t.Uuid != uuid {
+			continue
+		}
+		task := t
+		go func() {
+			for _, c := range g.changes {
+				c <- &TaskChange{Type: "update", Task: task}
+			}
+		}()
+	}
+}
+
+// SetTransferLimits changes the transfer limits of a task without emitting a TaskChange event, as they are
+// applied to the running task through the bus.
+func (g *Global) SetTransferLimits(uuid string, limits *TransferLimits) error {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	g.syncSavedTasks()
+	for _, t := range g.Tasks {
+		if t.Uuid == uuid {
+			t.Transfers = limits
+			t.Revision++
+			return save()
+		}
+	}
+	return fmt.Errorf("cannot find task %s", uuid)
+}
+
 // UpdateGlobals updates various sections of config (each parameter can be nil).
-func (g *Global) UpdateGlobals(logs *Logs, updates *Updates, debugging *Debugging, service *Service) error {
+func (g *Global) UpdateGlobals(logs *Logs, updates *Updates, debugging *Debugging, service *Service, smtp *Smtp, mqtt *Mqtt, activity *Activity, proxy *Proxy, bandwidth *Bandwidth, startup *Startup) error {
 	if logs != nil {
 		g.Logs = logs
 	}
@@ -203,6 +822,54 @@ func (g *Global) UpdateGlobals(logs *Logs, updates *Updates, debugging *Debuggin
 		}
 		g.Service = service
 	}
+	if smtp != nil {
+		if e := storeSecret(smtpPasswordKey, &smtp.Password, &smtp.HasPassword); e != nil {
+			return e
+		}
+		g.Smtp = smtp
+	}
+	if mqtt != nil {
+		if e := storeSecret(mqttPasswordKey, &mqtt.Password, &mqtt.HasPassword); e != nil {
+			return e
+		}
+		g.Mqtt = mqtt
+	}
+	if activity != nil {
+		g.Activity = activity
+	}
+	if proxy != nil {
+		g.Proxy = proxy
+	}
+	if bandwidth != nil {
+		g.Bandwidth = bandwidth
+	}
+	if startup != nil {
+		g.Startup = startup
+	}
+	e := Save()
+	if e == nil && mqtt != nil {
+		go func() {
+			for _, c := range g.changes {
+				c <- &GlobalChange{Section: "mqtt"}
+			}
+		}()
+	}
+	return e
+}
+
+// UpdateDeviceName changes the name used to register this device on the servers.
+func (g *Global) UpdateDeviceName(name string) error {
+	g.DeviceName = name
+	return Save()
+}
+
+// SetAutoStart registers or removes the automatic startup of the application with the session, and saves
+// the new value.
+func (g *Global) SetAutoStart(autoStart bool) error {
+	if e := g.setAutoStartValue(autoStart); e != nil {
+		return e
+	}
+	g.Service.AutoStart = autoStart
 	return Save()
 }
 
@@ -221,7 +888,8 @@ func (g *Global) setAutoStartValue(autoStart bool) error {
 	var e error
 	if sI := GetOSShortcutInstaller(); sI != nil {
 		if autoStart {
-			e = sI.Install(ShortcutOptions{AutoStart: true, Shortcut: true})
+			// Application shortcuts are installed system-wide and require admin rights, only register the autostart
+			e = sI.Install(ShortcutOptions{AutoStart: true})
 		} else {
 			e = sI.Uninstall()
 		}
@@ -257,7 +925,9 @@ var def *Global
 // Default provides a usable config object. It is loaded from a JSON file.
 func Default() *Global {
 	if def == nil {
+		stamp := statFile()
 		if c, e := LoadFromFile(); e == nil {
+			setStamp(stamp)
 			def = c
 		} else {
 			def = &Global{}
@@ -274,6 +944,30 @@ func Default() *Global {
 		if def.Service == nil {
 			def.Service = &Service{}
 		}
+		if def.Smtp == nil {
+			def.Smtp = &Smtp{Port: 25}
+		} else if def.Smtp.Password != "" {
+			// Password stored in the config file by a previous version
+			if e := storeSecret(smtpPasswordKey, &def.Smtp.Password, &def.Smtp.HasPassword); e == nil {
+				Save()
+			}
+		}
+		if def.Mqtt == nil {
+			def.Mqtt = NewMqtt()
+		} else if def.Mqtt.Password != "" {
+			if e := storeSecret(mqttPasswordKey, &def.Mqtt.Password, &def.Mqtt.HasPassword); e == nil {
+				Save()
+			}
+		}
+		if def.Activity == nil {
+			def.Activity = NewActivity()
+		}
+		if def.Startup == nil {
+			def.Startup = NewStartup()
+		}
+		if def.Storage == nil {
+			def.Storage = NewStorage()
+		}
 		// Dynamically read autoStart value
 		def.Service.AutoStart = def.readAutoStartValue()
 		if len(def.Authorities) > 0 {
@@ -281,12 +975,29 @@ func Default() *Global {
 				a.AfterLoad()
 			}
 		}
+		// Generate a unique identifier for this device
+		if def.DeviceId == "" {
+			def.DeviceId = uuid.New()
+			Save()
+		}
+		if def.DeviceName == "" {
+			def.DeviceName, _ = os.Hostname()
+		}
 	}
 	return def
 }
 
-// Save writes the config to the JSON file.
+// Save writes the config to the JSON file. Tasks saved by another process in the meantime are picked up first,
+// so that their changes are not overwritten.
 func Save() error {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	def.syncSavedTasks()
+	return save()
+}
+
+// save writes the config to the JSON file, tasksLock must be held.
+func save() error {
 	// Copy def and update Authorities before saving
 	toSave := *def
 	toSave.Authorities = []*Authority{}
@@ -62,11 +62,10 @@ type ubuntuTplConf struct {
 
 // Install will install .desktop files under /usr/share/applications/ and ${HOME}/.config/autostart on Linux.
 func (u ubuntuInstaller) Install(options ShortcutOptions) error {
-	cwd, _ := os.Getwd()
 	conf := &ubuntuTplConf{
 		Name:        "Cells Sync",
 		Description: "Synchronization client for Pydio Cells",
-		Executable:  filepath.Join(cwd, "cells-sync") + " systray",
+		Executable:  ProcessName(os.Args[0]) + " start --autostart",
 	}
 	if options.Shortcut {
 		tpl := template.New("app")
@@ -83,7 +82,8 @@ func (u ubuntuInstaller) Install(options ShortcutOptions) error {
 		tpl := template.New("start")
 		t, _ := tpl.Parse(ubuntuStartTpl)
 		us, _ := user.Current()
-		if target, e := os.OpenFile(filepath.Join(us.HomeDir, ".config", "autostart", "cells-sync.desktop"), os.O_WRONLY|os.O_CREATE, 0755); e == nil {
+		os.MkdirAll(filepath.Join(us.HomeDir, ".config", "autostart"), 0755)
+		if target, e := os.OpenFile(filepath.Join(us.HomeDir, ".config", "autostart", "cells-sync.desktop"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755); e == nil {
 			if er := t.Execute(target, conf); er != nil {
 				return er
 			}
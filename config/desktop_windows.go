@@ -70,6 +70,10 @@ func (w winShortcuts) Install(options ShortcutOptions) error {
 	if err != nil {
 		return err
 	}
+	_, err = oleutil.PutProperty(idispatch, "Arguments", "start --autostart")
+	if err != nil {
+		return err
+	}
 	_, err = oleutil.CallMethod(idispatch, "Save")
 	return err
 }
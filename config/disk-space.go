@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+const (
+	// DefaultDiskWarnMB is the free space below which the user is warned.
+	DefaultDiskWarnMB = 5 * 1024
+	// DefaultDiskPauseMB is the free space below which downloads are paused.
+	DefaultDiskPauseMB = 1024
+)
+
+// DiskSpace sets the free space thresholds of the local volumes hosting synced folders. Below WarnMB, the user is
+// warned. Below PauseMB, downloads are paused until space is freed. It is set globally and can be overridden per
+// task: zero values inherit, negative values disable the threshold.
+type DiskSpace struct {
+	WarnMB  int `json:"WarnMB,omitempty"`
+	PauseMB int `json:"PauseMB,omitempty"`
+}
+
+// WarnBytes returns the warning threshold in bytes, 0 if disabled.
+func (d *DiskSpace) WarnBytes() uint64 {
+	if d.WarnMB <= 0 {
+		return 0
+	}
+	return uint64(d.WarnMB) * 1024 * 1024
+}
+
+// PauseBytes returns the pause threshold in bytes, 0 if disabled.
+func (d *DiskSpace) PauseBytes() uint64 {
+	if d.PauseMB <= 0 {
+		return 0
+	}
+	return uint64(d.PauseMB) * 1024 * 1024
+}
+
+// DiskSpaceFor resolves the thresholds of a task: defaults, overridden by the global section, overridden by the task.
+func (g *Global) DiskSpaceFor(t *Task) *DiskSpace {
+	d := &DiskSpace{WarnMB: DefaultDiskWarnMB, PauseMB: DefaultDiskPauseMB}
+	for _, o := range []*DiskSpace{g.DiskSpace, t.DiskSpace} {
+		if o == nil {
+			continue
+		}
+		if o.WarnMB != 0 {
+			d.WarnMB = o.WarnMB
+		}
+		if o.PauseMB != 0 {
+			d.PauseMB = o.PauseMB
+		}
+	}
+	return d
+}
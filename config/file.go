@@ -22,7 +22,21 @@ package config
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileStamp identifies a version of the config file, to detect writes made by another process without reading it.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+var (
+	stampLock sync.Mutex
+	lastStamp fileStamp
 )
 
 func getPath() string {
@@ -49,5 +63,32 @@ func WriteToFile(config *Global) error {
 	if e != nil {
 		return e
 	}
-	return ioutil.WriteFile(getPath(), data, 0755)
+	if e := ioutil.WriteFile(getPath(), data, 0755); e != nil {
+		return e
+	}
+	setStamp(statFile())
+	return nil
+}
+
+// statFile returns the current stamp of the config file.
+func statFile() fileStamp {
+	if s, e := os.Stat(getPath()); e == nil {
+		return fileStamp{mod: s.ModTime(), size: s.Size()}
+	}
+	return fileStamp{}
+}
+
+// setStamp records the stamp of the config file version that was last read or written.
+func setStamp(s fileStamp) {
+	stampLock.Lock()
+	defer stampLock.Unlock()
+	lastStamp = s
+}
+
+// fileChanged tells whether the config file was written by someone else since it was last read or written.
+func fileChanged() bool {
+	s := statFile()
+	stampLock.Lock()
+	defer stampLock.Unlock()
+	return !s.mod.Equal(lastStamp.mod) || s.size != lastStamp.size
 }
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterSet is a named group of filters defined once in the global config and referenced by tasks through
+// their FilterSets names. Ignores are gitignore-like patterns, MaxSize (in bytes) and BlockedExtensions are
+// applied to uploads like the task UploadRules.
+type FilterSet struct {
+	Name              string
+	Ignores           []string `json:"Ignores,omitempty"`
+	MaxSize           int64    `json:"MaxSize,omitempty"`
+	BlockedExtensions []string `json:"BlockedExtensions,omitempty"`
+}
+
+// FilterSet finds a filter set by its name, case-insensitively.
+func (g *Global) FilterSet(name string) *FilterSet {
+	for _, f := range g.FilterSets {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// CheckFilterSets returns an error if a task references an unknown filter set.
+func (g *Global) CheckFilterSets(t *Task) error {
+	for _, name := range t.FilterSets {
+		if g.FilterSet(name) == nil {
+			return fmt.Errorf("unknown filter set %s", name)
+		}
+	}
+	return nil
+}
+
+// TaskIgnores returns the ignore patterns of a task followed by the ones of its filter sets.
+func (g *Global) TaskIgnores(t *Task) []string {
+	if len(t.FilterSets) == 0 {
+		return t.Ignores
+	}
+	ignores := append([]string{}, t.Ignores...)
+	for _, name := range t.FilterSets {
+		if f := g.FilterSet(name); f != nil {
+			ignores = append(ignores, f.Ignores...)
+		}
+	}
+	return ignores
+}
+
+// TaskUploadRules merges the upload rules of a task with its filter sets: the smallest size limit applies, and
+// extensions blocked by any of them are blocked. It returns nil if there are no rules at all.
+func (g *Global) TaskUploadRules(t *Task) *UploadRules {
+	var sets []*FilterSet
+	for _, name := range t.FilterSets {
+		if f := g.FilterSet(name); f != nil && (f.MaxSize > 0 || len(f.BlockedExtensions) > 0) {
+			sets = append(sets, f)
+		}
+	}
+	if len(sets) == 0 {
+		return t.UploadRules
+	}
+	rules := &UploadRules{}
+	if t.UploadRules != nil {
+		r := *t.UploadRules
+		r.BlockedExtensions = append([]string{}, r.BlockedExtensions...)
+		rules = &r
+	}
+	for _, f := range sets {
+		if f.MaxSize > 0 && (rules.MaxSize == 0 || f.MaxSize < rules.MaxSize) {
+			rules.MaxSize = f.MaxSize
+		}
+		rules.BlockedExtensions = append(rules.BlockedExtensions, f.BlockedExtensions...)
+	}
+	return rules
+}
+
+// UpdateFilterSet creates or replaces a filter set, and emits a TaskChange event "update" for each task
+// referencing it, so that they are restarted with the new filters.
+func (g *Global) UpdateFilterSet(set *FilterSet) error {
+	if strings.TrimSpace(set.Name) == "" {
+		return fmt.Errorf("please provide a name for the filter set")
+	}
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	g.syncSavedTasks()
+	var sets []*FilterSet
+	for _, f := range g.FilterSets {
+		if !strings.EqualFold(f.Name, set.Name) {
+			sets = append(sets, f)
+		}
+	}
+	g.FilterSets = append(sets, set)
+	if e := save(); e != nil {
+		return e
+	}
+	var changed []*Task
+	for _, t := range g.Tasks {
+		for _, name := range t.FilterSets {
+			if strings.EqualFold(name, set.Name) {
+				changed = append(changed, t)
+				break
+			}
+		}
+	}
+	go func() {
+		for _, t := range changed {
+			for _, c := range g.changes {
+				c <- &TaskChange{Type: "update", Task: t}
+			}
+		}
+	}()
+	return nil
+}
+
+// RemoveFilterSet deletes a filter set. It fails if a task still references it.
+func (g *Global) RemoveFilterSet(name string) error {
+	tasksLock.Lock()
+	defer tasksLock.Unlock()
+	g.syncSavedTasks()
+	if g.FilterSet(name) == nil {
+		return fmt.Errorf("cannot find filter set %s", name)
+	}
+	for _, t := range g.Tasks {
+		for _, n := range t.FilterSets {
+			if strings.EqualFold(n, name) {
+				return fmt.Errorf("filter set %s is used by task %s", name, t.Label)
+			}
+		}
+	}
+	var sets []*FilterSet
+	for _, f := range g.FilterSets {
+		if !strings.EqualFold(f.Name, name) {
+			sets = append(sets, f)
+		}
+	}
+	g.FilterSets = sets
+	return save()
+}
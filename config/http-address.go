@@ -20,17 +20,39 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
+// DefaultHttpURL is used by clients when no running agent is found in the runtime file.
+const DefaultHttpURL = "http://localhost:3636"
+
 var (
 	httpAddress string
 	noAvail     error
 	httpOnce    = &sync.Once{}
 )
 
+// RuntimeInfo is written by the running agent so that the CLI, the systray and the webview can discover the
+// address actually used by the http server. Service is set when the agent runs as a Windows service.
+type RuntimeInfo struct {
+	Pid     int
+	Address string
+	URL     string
+	Started time.Time
+	Service bool `json:"Service,omitempty"`
+	// GrpcAddress is the address of the gRPC variant of the control API
+	GrpcAddress string `json:"GrpcAddress,omitempty"`
+}
+
 // GetHttpProtocol returns the protocol to use for binding. Currently only http is supported.
 func GetHttpProtocol() string {
 	return "http"
@@ -38,7 +60,8 @@ func GetHttpProtocol() string {
 
 // GetHttpAddress tries to bind to an available port between 3636 and 3666 and returns the first port available.
 // This range of port is important for the OAuth2 authentication mechanism as the associated redirect_uris are
-// automatically registered inside the server.
+// automatically registered inside the server. If all ports of the range are taken, a random free port is used,
+// with which the UI works but logins to new servers fail.
 func GetHttpAddress() (string, error) {
 	httpOnce.Do(func() {
 		// Todo : allowing outbound connection could be set up in configs - leave host empty in that case
@@ -51,11 +74,105 @@ func GetHttpAddress() (string, error) {
 				break
 			}
 		}
-		if port > 3666 {
-			noAvail = fmt.Errorf("cannot get any available port between 3636 and 3666, this will be a problem for oidc callback registered in server")
-		} else {
+		if port <= 3666 {
 			httpAddress = fmt.Sprintf("%s:%d", hostname, port)
+			return
 		}
+		l, err := net.Listen("tcp", hostname+":0")
+		if err != nil {
+			noAvail = fmt.Errorf("cannot get any available port: %v", err)
+			return
+		}
+		httpAddress = l.Addr().String()
+		l.Close()
+		noAvail = fmt.Errorf("cannot get any available port between 3636 and 3666, using %s: logins to new servers will fail", httpAddress)
 	})
 	return httpAddress, noAvail
 }
+
+// ResetHttpAddress forgets the address computed by GetHttpAddress, so that a new free port is looked up if the
+// previous one was taken in the meantime.
+func ResetHttpAddress() {
+	httpAddress, noAvail = "", nil
+	httpOnce = &sync.Once{}
+}
+
+func runtimeFile() string {
+	return filepath.Join(SyncClientDataDir(), "runtime.json")
+}
+
+// WriteRuntimeInfo records the addresses of the http and gRPC servers of the current process.
+func WriteRuntimeInfo(address string, grpcAddress string) error {
+	info := &RuntimeInfo{
+		Pid:         os.Getpid(),
+		Address:     address,
+		URL:         fmt.Sprintf("%s://%s", GetHttpProtocol(), address),
+		Started:     time.Now(),
+		Service:     RunningAsWindowsService(),
+		GrpcAddress: grpcAddress,
+	}
+	data, e := json.Marshal(info)
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(runtimeFile(), data, 0644)
+}
+
+// RemoveRuntimeInfo removes the runtime file if it was written by the current process.
+func RemoveRuntimeInfo() {
+	if info, e := ReadRuntimeInfo(); e == nil && info.Pid == os.Getpid() {
+		os.Remove(runtimeFile())
+	}
+}
+
+// ReadRuntimeInfo loads the runtime file written by the running agent.
+func ReadRuntimeInfo() (*RuntimeInfo, error) {
+	data, e := ioutil.ReadFile(runtimeFile())
+	if e != nil {
+		return nil, e
+	}
+	var info RuntimeInfo
+	if e := json.Unmarshal(data, &info); e != nil {
+		return nil, e
+	}
+	return &info, nil
+}
+
+// ReadPipeRuntimeInfo asks the agent running as a Windows service for its runtime info over the named pipe.
+func ReadPipeRuntimeInfo() (*RuntimeInfo, error) {
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return DialPipe(ctx)
+			},
+		},
+	}
+	resp, e := client.Get("http://localhost/runtime")
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	var info RuntimeInfo
+	if e := json.NewDecoder(resp.Body).Decode(&info); e != nil {
+		return nil, e
+	}
+	return &info, nil
+}
+
+// DiscoverHttpURL returns the URL of the http server of the running agent, as recorded in the runtime file or
+// served on the named pipe by the Windows service. It falls back to DefaultHttpURL if no agent answers.
+func DiscoverHttpURL() string {
+	if info, e := ReadRuntimeInfo(); e == nil && info.Address != "" {
+		if conn, e := net.DialTimeout("tcp", info.Address, time.Second); e == nil {
+			conn.Close()
+			return info.URL
+		}
+	}
+	if PipeName != "" {
+		if info, e := ReadPipeRuntimeInfo(); e == nil && info.URL != "" {
+			return info.URL
+		}
+	}
+	return DefaultHttpURL
+}
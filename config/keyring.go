@@ -23,8 +23,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/zalando/go-keyring"
-
 	"github.com/pydio/cells/common/log"
 )
 
@@ -33,12 +31,13 @@ var (
 	tokenSeparator = "__//__"
 )
 
-// AuthToKeyring tries to store tokens in local keychain and remove them from the conf
+// AuthToKeyring tries to store tokens in local keychain (or in the encrypted credentials file) and remove them
+// from the conf
 func AuthToKeyring(a Authority) (Authority, error) {
-	if a.AccessToken != "" && a.RefreshToken != "" {
+	if a.AccessToken != "" && (a.RefreshToken != "" || a.IsPersonalToken()) {
 		key := a.Id + "::AccessToken"
 		value := strings.Join([]string{a.AccessToken, a.IdToken, a.RefreshToken}, tokenSeparator)
-		if e := keyring.Set(keyringService, key, value); e != nil {
+		if e := credentials().Set(key, value); e != nil {
 			return a, e
 		}
 		log.Logger(oidcContext).Debug("Saved token in keyring for authority " + a.Id)
@@ -49,11 +48,12 @@ func AuthToKeyring(a Authority) (Authority, error) {
 	return a, nil
 }
 
-// AuthFromKeyring tries to find tokens inside local keychain and feed the conf with them
+// AuthFromKeyring tries to find tokens inside local keychain (or in the encrypted credentials file) and feed the
+// conf with them
 func AuthFromKeyring(a Authority) (Authority, error) {
 	// If nothing is provided, consider it is stored in keyring
 	if a.AccessToken == "" && a.RefreshToken == "" {
-		if value, e := keyring.Get(keyringService, a.Id+"::AccessToken"); e == nil {
+		if value, e := credentials().Get(a.Id + "::AccessToken"); e == nil {
 			parts := strings.Split(value, tokenSeparator)
 			if len(parts) != 3 {
 				return a, fmt.Errorf("wrong format stored in keyring")
@@ -72,7 +72,7 @@ func AuthFromKeyring(a Authority) (Authority, error) {
 // ClearKeyring removes tokens from local keychain, if they are present
 func ClearKeyring(a *Authority) error {
 	// Try to delete creds from keyring
-	err := keyring.Delete(keyringService, a.Id+"::AccessToken")
+	err := credentials().Delete(a.Id + "::AccessToken")
 	if err == nil {
 		log.Logger(oidcContext).Info("Removed tokens from keyring")
 	}
@@ -21,9 +21,9 @@ package config
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -51,6 +51,23 @@ type Authority struct {
 	Id                 string `json:"id"`
 	URI                string `json:"uri"`
 	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	// CertificatePin is the SHA-256 fingerprint of the server certificate, pinned at first use
+	CertificatePin string `json:"certificatePin,omitempty"`
+	// ClientCert and ClientKey are paths to PEM files presented to servers requiring client certificates
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	// Proxy overrides the global proxy configuration for this server
+	Proxy *Proxy `json:"proxy,omitempty"`
+	// AuthType is either AuthTypeOIDC (default) or AuthTypePersonalToken
+	AuthType string `json:"authType,omitempty"`
+	// AlternateURIs are other URLs of the same server (e.g. a LAN URL). The first reachable one is used, and
+	// remembered for each network in NetworkURIs. ActiveURI is the one currently used, if not URI. A pinned
+	// certificate must be presented on all of them.
+	AlternateURIs []string          `json:"alternateUris,omitempty"`
+	ActiveURI     string            `json:"activeUri,omitempty"`
+	NetworkURIs   map[string]string `json:"networkUris,omitempty"`
+	// Rewrites redirect connections to addresses returned by the server that are not reachable from this network
+	Rewrites []*URLRewrite `json:"rewrites,omitempty"`
 
 	ServerLabel string    `json:"serverLabel"`
 	Username    string    `json:"username"`
@@ -58,6 +75,9 @@ type Authority struct {
 	RefreshDate time.Time `json:"refreshDate"`
 	TokenStatus string    `json:"tokenStatus"`
 	TasksCount  int       `json:"tasksCount"`
+	// DevicesManaged is set once the server answered a revocation check, rejected sessions are then handled as
+	// a revocation of this device
+	DevicesManaged bool `json:"devicesManaged,omitempty"`
 
 	IdToken      string `json:"id_token"`
 	AccessToken  string `json:"access_token"`
@@ -72,21 +92,44 @@ type AuthChange struct {
 }
 
 func (a *Authority) getHttpClient() *http.Client {
-	c := http.DefaultClient
-	if a.InsecureSkipVerify {
-		c = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-		}
+	conf, e := a.tlsConfig()
+	if e != nil {
+		log.Logger(oidcContext).Error("Cannot load client certificate for " + a.URI + ": " + e.Error())
+	}
+	if conf == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:     DialContext,
+			TLSClientConfig: conf,
+		},
 	}
-	return c
+}
+
+// NewAuthenticatedRequest prepares a request on the authority REST API, using the current access token.
+func (a *Authority) NewAuthenticatedRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, e := http.NewRequest(method, strings.TrimRight(a.BaseURL(), "/")+path, body)
+	if e != nil {
+		return nil, e
+	}
+	req.Header.Set("Authorization", "Bearer "+a.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// Do performs a request using the http client configured for this authority.
+func (a *Authority) Do(req *http.Request) (*http.Response, error) {
+	return a.getHttpClient().Do(req)
 }
 
 // RefreshRequired checks if the current IdToken is still valid or requires renewal.
 func (a *Authority) RefreshRequired() (in time.Duration, now bool) {
+	if a.IsPersonalToken() && a.ExpiresAt == 0 {
+		return 12 * time.Hour, false
+	}
 	expTime := time.Unix(int64(a.ExpiresAt), 0)
-	in = expTime.Sub(time.Now().Add(10 * time.Second))
+	in = expTime.Sub(GetClock().Now().Add(10 * time.Second))
 	if in <= 0 {
 		in = 0
 		now = true
@@ -94,8 +137,12 @@ func (a *Authority) RefreshRequired() (in time.Duration, now bool) {
 	return
 }
 
-// Refresh uses the RefreshToken to ask for a new IdToken/AccessToken/RefreshToken truple.
+// Refresh uses the RefreshToken to ask for a new IdToken/AccessToken/RefreshToken truple. Personal Access Tokens
+// cannot be refreshed, they are only checked for expiration.
 func (a *Authority) Refresh() error {
+	if a.IsPersonalToken() {
+		return a.checkPersonalToken()
+	}
 
 	log.Logger(oidcContext).Info("Refreshing token for " + a.URI)
 	data := url.Values{}
@@ -103,7 +150,7 @@ func (a *Authority) Refresh() error {
 	data.Add("client_id", "cells-sync")
 	data.Add("refresh_token", a.RefreshToken)
 	data.Add("scope", "openid email profile pydio offline")
-	httpReq, err := http.NewRequest("POST", a.URI+"/oidc/oauth2/token", strings.NewReader(data.Encode()))
+	httpReq, err := http.NewRequest("POST", strings.TrimRight(a.BaseURL(), "/")+"/oidc/oauth2/token", strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
@@ -132,7 +179,7 @@ func (a *Authority) Refresh() error {
 	a.IdToken = respMap.Id
 	a.AccessToken = respMap.Access
 	a.RefreshToken = respMap.Refresh
-	a.ExpiresAt = int(time.Now().Unix()) + respMap.Exp
+	a.ExpiresAt = int(GetClock().Now().Unix()) + respMap.Exp
 	log.Logger(oidcContext).Info(fmt.Sprintf("Got new token, will expire in %v", respMap.Exp))
 
 	Default().UpdateAuthority(a, true)
@@ -145,7 +192,7 @@ func (a *Authority) Refresh() error {
 func (a *Authority) LoadInfo() {
 	a.ServerLabel = a.URI
 	client := a.getHttpClient()
-	if r, e := client.Get(strings.TrimRight(a.URI, "/") + "/a/frontend/bootconf"); e == nil {
+	if r, e := client.Get(strings.TrimRight(a.BaseURL(), "/") + "/a/frontend/bootconf"); e == nil {
 		var confSample struct {
 			Wording struct {
 				Title      string `json:"title"`
@@ -163,12 +210,14 @@ func (a *Authority) LoadInfo() {
 			}
 		}
 	}
-	// decode JWT token without verifying the signature
-	token, _ := jwt.ParseSigned(a.IdToken)
-	var claims map[string]interface{} // generic map to store parsed token
-	_ = token.UnsafeClaimsWithoutVerification(&claims)
-	if name, ok := claims["name"]; ok {
-		a.Username = name.(string)
+	// decode JWT token without verifying the signature - personal tokens are given with their username
+	if !a.IsPersonalToken() {
+		token, _ := jwt.ParseSigned(a.IdToken)
+		var claims map[string]interface{} // generic map to store parsed token
+		_ = token.UnsafeClaimsWithoutVerification(&claims)
+		if name, ok := claims["name"]; ok {
+			a.Username = name.(string)
+		}
 	}
 	parsed, _ := url.Parse(a.URI)
 	parsed.User = url.User(a.Username)
@@ -186,6 +235,29 @@ func (a *Authority) is(a2 *Authority) bool {
 	return a.key() == a2.key()
 }
 
+// MatchesURI checks if an endpoint URI is using this authority.
+func (a *Authority) MatchesURI(uri string) bool {
+	pU, e := url.Parse(a.URI)
+	if e != nil {
+		return false
+	}
+	u, e := url.Parse(uri)
+	if e != nil || u.User == nil {
+		return false
+	}
+	return u.Scheme == pU.Scheme && u.Host == pU.Host && u.User.Username() == a.Username
+}
+
+// TasksForAuthority lists the tasks that have one of their endpoints using the given authority.
+func (g *Global) TasksForAuthority(a *Authority) (tasks []*Task) {
+	for _, t := range g.Tasks {
+		if a.MatchesURI(t.LeftURI) || a.MatchesURI(t.RightURI) {
+			tasks = append(tasks, t)
+		}
+	}
+	return
+}
+
 // PublicAuthorities returns the list of Authorities without any sensitive information, and counts the
 // number of active sync tasks on each.
 func (g *Global) PublicAuthorities() []*Authority {
@@ -199,6 +271,15 @@ func (g *Global) PublicAuthorities() []*Authority {
 			RefreshDate: a.RefreshDate,
 			LoginDate:   a.LoginDate,
 			ExpiresAt:   a.ExpiresAt,
+			AuthType:    a.AuthType,
+
+			AlternateURIs: a.AlternateURIs,
+			ActiveURI:     a.ActiveURI,
+			Rewrites:      a.Rewrites,
+
+			CertificatePin: a.CertificatePin,
+			ClientCert:     a.ClientCert,
+			ClientKey:      a.ClientKey,
 		}
 		// Associate number of sync tasks
 		pU, _ := url.Parse(a.URI)
@@ -224,6 +305,7 @@ func (g *Global) CreateAuthority(a *Authority) error {
 		}
 	}
 	a.LoginDate = time.Now()
+	a.pinFirstUse()
 	a.LoadInfo()
 	g.Authorities = append(g.Authorities, a)
 	e := Save()
@@ -279,6 +361,7 @@ func (g *Global) UpdateAuthority(a *Authority, isRefresh bool) error {
 			auth.AccessToken = a.AccessToken
 			auth.RefreshToken = a.RefreshToken
 			auth.ExpiresAt = a.ExpiresAt
+			auth.AuthType = a.AuthType
 			if isRefresh {
 				auth.RefreshDate = time.Now()
 			} else {
@@ -297,13 +380,24 @@ func (g *Global) UpdateAuthority(a *Authority, isRefresh bool) error {
 	return e
 }
 
+// notifyAuthChange emits an AuthChange event without modifying the config.
+func (g *Global) notifyAuthChange(changeType string, a *Authority) {
+	go func() {
+		for _, c := range g.changes {
+			c <- &AuthChange{Type: changeType, Authority: a}
+		}
+	}()
+}
+
 // BeforeSave tries to save tokens in keyring and returns a copy of the Authority without tokens
 func (a *Authority) BeforeSave() *Authority {
 	// Filter token to place them in keyring
-	if a.IdToken != "" && a.RefreshToken != "" {
-		if b, err := AuthToKeyring(*a); err == nil {
+	if a.AccessToken != "" && (a.RefreshToken != "" || a.IsPersonalToken()) {
+		b, err := AuthToKeyring(*a)
+		if err == nil {
 			return &b
 		}
+		log.Logger(oidcContext).Error("Cannot store tokens outside of the config file: " + err.Error())
 	}
 	return a
 }
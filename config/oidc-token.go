@@ -35,6 +35,7 @@ type tokenMonitor struct {
 	a       *Authority
 	trigger chan struct{}
 	done    chan bool
+	expired bool
 }
 
 func getTokenMonitor(a *Authority) *tokenMonitor {
@@ -59,27 +60,41 @@ func getTokenMonitor(a *Authority) *tokenMonitor {
 func (t *tokenMonitor) Start() {
 	var nextTick time.Duration
 	nextTick, _ = t.a.RefreshRequired()
-	safeInterval := time.NewTicker(2 * time.Minute)
+	safeInterval := GetClock().NewTicker(2 * time.Minute)
+	next := GetClock().NewTimer(nextTick)
 	defer func() {
 		safeInterval.Stop()
+		next.Stop()
 		close(t.trigger)
 	}()
 	for {
+		if !next.Stop() {
+			select {
+			case <-next.C():
+			default:
+			}
+		}
+		next.Reset(nextTick)
 		select {
-		case <-safeInterval.C:
+		case <-safeInterval.C():
 			var now bool
 			log.Logger(oidcContext).Info("Additional safe check for token " + t.a.key())
 			nextTick, now = t.a.RefreshRequired()
 			if now {
 				t.trigger <- struct{}{}
 			}
-		case <-time.After(nextTick):
+		case <-next.C():
 			t.trigger <- struct{}{}
 		case <-t.trigger:
 			if e := t.a.Refresh(); e != nil {
 				log.Logger(oidcContext).Info("Refreshing token failed for " + t.a.key() + ", will retry in 10s")
 				nextTick = 10 * time.Second
+				if _, now := t.a.RefreshRequired(); now && !t.expired {
+					t.expired = true
+					Default().notifyAuthChange("expired", t.a)
+				}
 			} else {
+				t.expired = false
 				nextTick, _ = t.a.RefreshRequired()
 			}
 		case <-t.done:
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/robertkrimen/otto"
+)
+
+// pacHelpers are the PAC functions that can be written in plain javascript. Date and time ranges always match.
+const pacHelpers = `
+function isPlainHostName(host) { return host.indexOf('.') < 0; }
+function dnsDomainIs(host, domain) { return host.length >= domain.length && host.substring(host.length - domain.length) === domain; }
+function localHostOrDomainIs(host, hostdom) { return host === hostdom || hostdom.lastIndexOf(host + '.', 0) === 0; }
+function dnsDomainLevels(host) { return host.split('.').length - 1; }
+function weekdayRange() { return true; }
+function dateRange() { return true; }
+function timeRange() { return true; }
+`
+
+// pacScript evaluates a proxy auto-configuration script. The otto VM is not thread-safe, calls are serialized.
+type pacScript struct {
+	sync.Mutex
+	vm *otto.Otto
+}
+
+// newPacScript loads a PAC script and the standard helper functions.
+func newPacScript(source string) (*pacScript, error) {
+	vm := otto.New()
+	vm.Set("dnsResolve", func(call otto.FunctionCall) otto.Value {
+		v, _ := vm.ToValue(pacResolve(call.Argument(0).String()))
+		return v
+	})
+	vm.Set("isResolvable", func(call otto.FunctionCall) otto.Value {
+		v, _ := vm.ToValue(pacResolve(call.Argument(0).String()) != "")
+		return v
+	})
+	vm.Set("myIpAddress", func(call otto.FunctionCall) otto.Value {
+		v, _ := vm.ToValue(pacMyIP())
+		return v
+	})
+	vm.Set("isInNet", func(call otto.FunctionCall) otto.Value {
+		v, _ := vm.ToValue(pacIsInNet(call.Argument(0).String(), call.Argument(1).String(), call.Argument(2).String()))
+		return v
+	})
+	vm.Set("shExpMatch", func(call otto.FunctionCall) otto.Value {
+		v, _ := vm.ToValue(pacShExpMatch(call.Argument(0).String(), call.Argument(1).String()))
+		return v
+	})
+	if _, e := vm.Run(pacHelpers); e != nil {
+		return nil, e
+	}
+	if _, e := vm.Run(source); e != nil {
+		return nil, e
+	}
+	return &pacScript{vm: vm}, nil
+}
+
+// find calls FindProxyForURL and returns its raw result, e.g. "PROXY host:8080; DIRECT".
+func (p *pacScript) find(u, host string) (string, error) {
+	p.Lock()
+	defer p.Unlock()
+	v, e := p.vm.Call("FindProxyForURL", nil, u, host)
+	if e != nil {
+		return "", e
+	}
+	return v.String(), nil
+}
+
+// parsePacResult returns the first proxy of a PAC result, or nil for DIRECT.
+func parsePacResult(result string) *Proxy {
+	for _, part := range strings.Split(result, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			return nil
+		case "PROXY", "HTTP":
+			if len(fields) > 1 {
+				return &Proxy{URL: "http://" + fields[1]}
+			}
+		case "HTTPS":
+			if len(fields) > 1 {
+				return &Proxy{URL: "https://" + fields[1]}
+			}
+		case "SOCKS", "SOCKS5":
+			if len(fields) > 1 {
+				return &Proxy{URL: "socks5://" + fields[1]}
+			}
+		}
+	}
+	return nil
+}
+
+func pacResolve(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return host
+	}
+	addrs, e := net.LookupIP(host)
+	if e != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if a.To4() != nil {
+			return a.String()
+		}
+	}
+	return ""
+}
+
+func pacMyIP() string {
+	addrs, e := net.InterfaceAddrs()
+	if e == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && n.IP.To4() != nil {
+				return n.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+func pacIsInNet(host, pattern, mask string) bool {
+	ip := net.ParseIP(pacResolve(host))
+	p := net.ParseIP(pattern)
+	m := net.ParseIP(mask)
+	if ip == nil || p == nil || m == nil || ip.To4() == nil || p.To4() == nil || m.To4() == nil {
+		return false
+	}
+	ipMask := net.IPMask(m.To4())
+	return ip.To4().Mask(ipMask).Equal(p.To4().Mask(ipMask))
+}
+
+// pacShExpMatch matches a shell expression, where * and ? also match dots and slashes.
+func pacShExpMatch(s, exp string) bool {
+	re := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(exp)) + "$"
+	ok, _ := regexp.MatchString(re, s)
+	return ok
+}
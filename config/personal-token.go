@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// AuthTypeOIDC is used by authorities logged in through the OpenID Connect workflow (default).
+	AuthTypeOIDC = "oidc"
+	// AuthTypePersonalToken is used by authorities using a Cells Personal Access Token, for hosts without a browser.
+	AuthTypePersonalToken = "pat"
+)
+
+// IsPersonalToken checks if the authority uses a Personal Access Token instead of OIDC tokens.
+func (a *Authority) IsPersonalToken() bool {
+	return a.AuthType == AuthTypePersonalToken
+}
+
+// checkPersonalToken replaces the token refresh for Personal Access Tokens, that cannot be renewed by the client.
+func (a *Authority) checkPersonalToken() error {
+	if a.ExpiresAt > 0 && GetClock().Now().Unix() >= int64(a.ExpiresAt) {
+		return fmt.Errorf("personal access token for %s has expired, please generate a new one", a.URI)
+	}
+	return nil
+}
+
+// CreatePersonalTokenAuthority registers an authority using a Personal Access Token generated on the server. The
+// token is checked against the server before being saved. A zero expiresAt means that the token does not expire.
+func (g *Global) CreatePersonalTokenAuthority(uri, username, token string, expiresAt time.Time, insecure bool) (*Authority, error) {
+	a := &Authority{
+		URI:                uri,
+		InsecureSkipVerify: insecure,
+		AuthType:           AuthTypePersonalToken,
+		Username:           username,
+		AccessToken:        token,
+	}
+	if !expiresAt.IsZero() {
+		a.ExpiresAt = int(expiresAt.Unix())
+	}
+	if e := a.checkPersonalToken(); e != nil {
+		return nil, e
+	}
+	req, e := a.NewAuthenticatedRequest("GET", "/a/user/"+url.PathEscape(username), nil)
+	if e != nil {
+		return nil, e
+	}
+	res, e := a.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("server refused the token for %s (status %d)", username, res.StatusCode)
+	}
+	return a, g.CreateAuthority(a)
+}
@@ -0,0 +1,41 @@
+// +build !windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// PipeName is only used on Windows.
+const PipeName = ""
+
+// ListenPipe is only supported on Windows.
+func ListenPipe() (net.Listener, error) {
+	return nil, fmt.Errorf("named pipes are only supported on windows")
+}
+
+// DialPipe is only supported on Windows.
+func DialPipe(ctx context.Context) (net.Conn, error) {
+	return nil, fmt.Errorf("named pipes are only supported on windows")
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"context"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// PipeName is the named pipe opened by the agent when running as a Windows service, so that the UI running in
+// the user session can find it even though the service uses another profile folder.
+const PipeName = `\\.\pipe\cells-sync`
+
+// pipeSecurity grants full access to the system account and read/write access to interactive users.
+const pipeSecurity = "D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GRGW;;;IU)"
+
+// ListenPipe opens the agent named pipe.
+func ListenPipe() (net.Listener, error) {
+	return winio.ListenPipe(PipeName, &winio.PipeConfig{SecurityDescriptor: pipeSecurity})
+}
+
+// DialPipe connects to the agent named pipe.
+func DialPipe(ctx context.Context) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, PipeName)
+}
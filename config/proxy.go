@@ -0,0 +1,255 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// ProxyDirect is used as proxy URL to bypass any proxy, typically in an authority override.
+	ProxyDirect = "direct"
+
+	ProxyAuthBasic     = "basic"
+	ProxyAuthNTLM      = "ntlm"
+	ProxyAuthNegotiate = "negotiate"
+)
+
+var baseDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// ProxyFor returns the proxy to use for reaching addr (host:port), or nil for a direct connection. The proxy of
+// the authority listening on addr takes precedence over the global one, then environment variables and finally the
+// system settings are used.
+func ProxyFor(addr string) (*Proxy, error) {
+	p := Default().Proxy
+	if a := authorityForAddr(addr); a != nil && a.Proxy != nil && a.Proxy.URL != "" {
+		p = a.Proxy
+	}
+	target := &url.URL{Scheme: "https", Host: addr}
+	if p == nil || p.URL == "" {
+		u, e := httpproxy.FromEnvironment().ProxyFunc()(target)
+		if e != nil {
+			return nil, e
+		}
+		if u == nil {
+			return systemProxyFor(addr), nil
+		}
+		return &Proxy{URL: u.String()}, nil
+	}
+	if p.URL == ProxyDirect {
+		return nil, nil
+	}
+	conf := &httpproxy.Config{HTTPProxy: p.URL, HTTPSProxy: p.URL, NoProxy: p.NoProxy}
+	if u, e := conf.ProxyFunc()(target); e != nil || u == nil {
+		return nil, e
+	}
+	return p, nil
+}
+
+// DialContext connects to addr, or to the address it is rewritten to, through the proxy configured for it if any.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	addr = rewriteAddr(addr)
+	p, e := ProxyFor(addr)
+	if e != nil {
+		return nil, e
+	}
+	if p == nil {
+		return baseDialer.DialContext(ctx, network, addr)
+	}
+	return p.dial(ctx, network, addr)
+}
+
+// Redacted returns the proxy URL without credentials, for display.
+func (p *Proxy) Redacted() string {
+	u, e := url.Parse(p.URL)
+	if e != nil {
+		return p.URL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// credentials returns the username and password, read from the URL if not set explicitly.
+func (p *Proxy) credentials(u *url.URL) (string, string) {
+	if p.Username != "" || u.User == nil {
+		return p.Username, p.Password
+	}
+	pass, _ := u.User.Password()
+	return u.User.Username(), pass
+}
+
+func (p *Proxy) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	u, e := url.Parse(p.URL)
+	if e != nil {
+		return nil, e
+	}
+	user, pass := p.credentials(u)
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if user != "" {
+			auth = &proxy.Auth{User: user, Password: pass}
+		}
+		d, e := proxy.SOCKS5("tcp", u.Host, auth, baseDialer)
+		if e != nil {
+			return nil, e
+		}
+		return d.Dial(network, addr)
+	case "http", "https":
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+		conn, e := baseDialer.DialContext(ctx, "tcp", host)
+		if e != nil {
+			return nil, e
+		}
+		if u.Scheme == "https" {
+			conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		}
+		if e := p.connect(conn, addr, user, pass); e != nil {
+			conn.Close()
+			return nil, e
+		}
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s", u.Scheme)
+	}
+}
+
+// connect opens a tunnel to addr with an HTTP CONNECT request, authenticating on the proxy if required.
+// NTLM and Negotiate use the NTLM handshake, Kerberos tickets are not supported.
+func (p *Proxy) connect(conn net.Conn, addr, user, pass string) error {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	br := bufio.NewReader(conn)
+	var resp *http.Response
+	var e error
+	switch strings.ToLower(p.Auth) {
+	case ProxyAuthNTLM, ProxyAuthNegotiate:
+		scheme := "NTLM"
+		if strings.ToLower(p.Auth) == ProxyAuthNegotiate {
+			scheme = "Negotiate"
+		}
+		domain := ""
+		if parts := strings.SplitN(user, "\\", 2); len(parts) == 2 {
+			domain, user = parts[0], parts[1]
+		}
+		negotiate, e := ntlmssp.NewNegotiateMessage(domain, "")
+		if e != nil {
+			return e
+		}
+		if resp, e = sendConnect(conn, br, addr, scheme+" "+base64.StdEncoding.EncodeToString(negotiate)); e != nil {
+			return e
+		}
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			var challenge []byte
+			for _, h := range resp.Header["Proxy-Authenticate"] {
+				if strings.HasPrefix(h, scheme+" ") {
+					challenge, _ = base64.StdEncoding.DecodeString(strings.TrimPrefix(h, scheme+" "))
+				}
+			}
+			if len(challenge) == 0 {
+				return fmt.Errorf("proxy did not send a %s challenge", scheme)
+			}
+			authenticate, e := ntlmssp.ProcessChallenge(challenge, user, pass)
+			if e != nil {
+				return e
+			}
+			if resp, e = sendConnect(conn, br, addr, scheme+" "+base64.StdEncoding.EncodeToString(authenticate)); e != nil {
+				return e
+			}
+		}
+	default:
+		auth := ""
+		if user != "" {
+			auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+		}
+		if resp, e = sendConnect(conn, br, addr, auth); e != nil {
+			return e
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused connection to %s: %s", addr, resp.Status)
+	}
+	return nil
+}
+
+// sendConnect writes a CONNECT request and reads the response, discarding its body so that the connection can be
+// reused for the next step of the handshake.
+func sendConnect(conn net.Conn, br *bufio.Reader, addr, auth string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{"Proxy-Connection": {"Keep-Alive"}},
+	}
+	if auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if e := req.Write(conn); e != nil {
+		return nil, e
+	}
+	resp, e := http.ReadResponse(br, req)
+	if e != nil {
+		return nil, e
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// SetAuthorityProxy overrides the proxy used to reach the server of an authority. A nil proxy removes the override.
+func (g *Global) SetAuthorityProxy(id string, p *Proxy) error {
+	if p != nil {
+		if u, e := url.Parse(p.URL); p.URL != ProxyDirect && (e != nil || u.Host == "") {
+			return fmt.Errorf("invalid proxy URL %s", p.URL)
+		}
+	}
+	for _, a := range g.Authorities {
+		if a.key() != id && a.Id != id {
+			continue
+		}
+		a.Proxy = p
+		return Save()
+	}
+	return fmt.Errorf("cannot find authority %s", id)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+const (
+	smtpPasswordKey = "smtp::Password"
+	mqttPasswordKey = "mqtt::Password"
+)
+
+// storeSecret moves a secret received through the config API to the credential store, so that it is neither
+// written to the config file nor sent back to clients. An empty value keeps the stored secret while has is set,
+// and removes it otherwise.
+func storeSecret(key string, value *string, has *bool) error {
+	if *value != "" {
+		if e := credentials().Set(key, *value); e != nil {
+			return e
+		}
+		*value = ""
+		*has = true
+		return nil
+	}
+	if !*has {
+		credentials().Delete(key)
+	}
+	return nil
+}
+
+// loadSecret reads a secret from the credential store, or returns an empty string.
+func loadSecret(key string) string {
+	value, e := credentials().Get(key)
+	if e != nil {
+		return ""
+	}
+	return value
+}
+
+// Secret returns the password of the SMTP server from the credential store.
+func (s *Smtp) Secret() string {
+	if s == nil || !s.HasPassword {
+		return ""
+	}
+	return loadSecret(smtpPasswordKey)
+}
+
+// Secret returns the password of the MQTT broker from the credential store.
+func (m *Mqtt) Secret() string {
+	if m == nil || !m.HasPassword {
+		return ""
+	}
+	return loadSecret(mqttPasswordKey)
+}
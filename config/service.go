@@ -21,6 +21,7 @@ package config
 
 import (
 	"fmt"
+	"runtime"
 
 	"github.com/kardianos/service"
 )
@@ -90,6 +91,17 @@ func RunningAsService() bool {
 	return macService //  service.Interactive() || (runtime.GOOS == "darwin" && !ServiceInstalled())
 }
 
+// RunningAsWindowsService returns true if the process was started by the Windows service manager, in session 0.
+func RunningAsWindowsService() bool {
+	return runtime.GOOS == "windows" && !service.Interactive()
+}
+
+// ServiceRunning checks if the background service is installed and running.
+func ServiceRunning() bool {
+	status, e := Status()
+	return e == nil && status == service.StatusRunning
+}
+
 // ServiceInstalled checks if background service is installed.
 func ServiceInstalled() bool {
 	s, e := GetAppService(nil)
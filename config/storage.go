@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// StorageAuto selects StorageBoltCompact on 32-bit platforms, StorageBolt otherwise
+	StorageAuto = "auto"
+	// StorageBolt uses BoltDB with its default options
+	StorageBolt = "bolt"
+	// StorageBoltCompact uses BoltDB with options that keep files and memory maps small, for 32-bit ARM devices
+	// where large memory maps fail
+	StorageBoltCompact = "bolt-compact"
+
+	// HistoryBolt keeps the history of each task in a BoltDB file
+	HistoryBolt = "bolt"
+	// HistorySQLite keeps the history of each task in a SQLite database, in builds with the sqlite tag
+	HistorySQLite = "sqlite"
+	// DefaultHistoryDays is the default retention of the tasks history
+	DefaultHistoryDays = 90
+	// DefaultHistoryMaxMB is the default maximum size of the history of a task
+	DefaultHistoryMaxMB = 256
+)
+
+// Storage selects how the local databases (snapshots, hashes, patches, stats...) are stored. Backend is one of
+// StorageAuto (default), StorageBolt or StorageBoltCompact. In compact mode, snapshots bigger than
+// CompactAboveMB (default 128) are compacted when their task starts. Changes apply after a restart.
+type Storage struct {
+	Backend        string
+	CompactAboveMB int             `json:"CompactAboveMB,omitempty"`
+	History        *HistoryStorage `json:"History,omitempty"`
+}
+
+// HistoryStorage selects where the run history, audit trail and transfer stats of the tasks are kept, and for how
+// long. Backend is HistoryBolt (default) or HistorySQLite. Records older than RetentionDays (default 90) are pruned,
+// as well as the oldest records of a task whose history grows over MaxSizeMB (default 256). Zero values use the
+// defaults, negative values disable the limit.
+type HistoryStorage struct {
+	Backend       string `json:"Backend,omitempty"`
+	RetentionDays int    `json:"RetentionDays,omitempty"`
+	MaxSizeMB     int    `json:"MaxSizeMB,omitempty"`
+}
+
+// NewStorage creates defaults for Storage.
+func NewStorage() *Storage {
+	return &Storage{Backend: StorageAuto}
+}
+
+// Is32Bit returns true if the agent runs on a 32-bit platform, where memory maps are limited to 2GB.
+func Is32Bit() bool {
+	return strconv.IntSize == 32
+}
+
+// ResolvedBackend returns the backend to use, after detection of the platform for StorageAuto.
+func (s *Storage) ResolvedBackend() string {
+	switch s.Backend {
+	case StorageBolt, StorageBoltCompact:
+		return s.Backend
+	}
+	if Is32Bit() {
+		return StorageBoltCompact
+	}
+	return StorageBolt
+}
+
+// CompactThreshold returns the size in bytes above which snapshots are compacted in compact mode.
+func (s *Storage) CompactThreshold() int64 {
+	if s.CompactAboveMB > 0 {
+		return int64(s.CompactAboveMB) * 1024 * 1024
+	}
+	return 128 * 1024 * 1024
+}
+
+// HistoryOptions resolves the backend and limits of the tasks history. Limits are 0 when disabled.
+func (s *Storage) HistoryOptions() (backend string, retention time.Duration, maxBytes int64) {
+	h := &HistoryStorage{Backend: HistoryBolt, RetentionDays: DefaultHistoryDays, MaxSizeMB: DefaultHistoryMaxMB}
+	if s != nil && s.History != nil {
+		if s.History.Backend != "" {
+			h.Backend = s.History.Backend
+		}
+		if s.History.RetentionDays != 0 {
+			h.RetentionDays = s.History.RetentionDays
+		}
+		if s.History.MaxSizeMB != 0 {
+			h.MaxSizeMB = s.History.MaxSizeMB
+		}
+	}
+	if h.RetentionDays > 0 {
+		retention = time.Duration(h.RetentionDays) * 24 * time.Hour
+	}
+	if h.MaxSizeMB > 0 {
+		maxBytes = int64(h.MaxSizeMB) * 1024 * 1024
+	}
+	return h.Backend, retention, maxBytes
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/pydio/cells/common/log"
+)
+
+// SystemProxySettings are the proxy settings of the operating system.
+type SystemProxySettings struct {
+	// Proxy is the proxy used for https (or all protocols), as host:port or URL
+	Proxy string
+	// Socks is a SOCKS proxy used when Proxy is empty, as host:port
+	Socks string
+	// Bypass lists hosts contacted directly, NO_PROXY style
+	Bypass []string
+	// BypassLocal is true if plain host names (without dots) are contacted directly
+	BypassLocal bool
+	// PacURL is the URL of a proxy auto-configuration script, it takes precedence over Proxy
+	PacURL string
+}
+
+var systemProxy struct {
+	sync.RWMutex
+	settings *SystemProxySettings
+	pac      *pacScript
+}
+
+// RefreshSystemProxy reads the proxy settings of the operating system again, and downloads the PAC script if any.
+// It must be called at startup and whenever the network changes.
+func RefreshSystemProxy() error {
+	s, e := readSystemProxy()
+	if e != nil {
+		return e
+	}
+	var pac *pacScript
+	if s != nil && s.PacURL != "" {
+		source, e := fetchPac(s.PacURL)
+		if e == nil {
+			pac, e = newPacScript(source)
+		}
+		if e != nil {
+			log.Logger(oidcContext).Warn("Cannot load proxy auto-configuration script " + s.PacURL + ": " + e.Error())
+		}
+	}
+	systemProxy.Lock()
+	systemProxy.settings = s
+	systemProxy.pac = pac
+	systemProxy.Unlock()
+	return nil
+}
+
+// fetchPac downloads a PAC script, directly (not through a proxy).
+func fetchPac(pacURL string) (string, error) {
+	if strings.HasPrefix(pacURL, "file://") {
+		u, e := url.Parse(pacURL)
+		if e != nil {
+			return "", e
+		}
+		data, e := ioutil.ReadFile(u.Path)
+		return string(data), e
+	}
+	client := &http.Client{Transport: &http.Transport{}, Timeout: 10 * time.Second}
+	resp, e := client.Get(pacURL)
+	if e != nil {
+		return "", e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+	data, e := ioutil.ReadAll(resp.Body)
+	return string(data), e
+}
+
+// systemProxyFor returns the proxy defined by the system settings for reaching addr (host:port), or nil.
+func systemProxyFor(addr string) *Proxy {
+	systemProxy.RLock()
+	s, pac := systemProxy.settings, systemProxy.pac
+	systemProxy.RUnlock()
+	if s == nil {
+		return nil
+	}
+	host, _, e := net.SplitHostPort(addr)
+	if e != nil {
+		return nil
+	}
+	if pac != nil {
+		result, e := pac.find("https://"+addr+"/", host)
+		if e != nil {
+			log.Logger(oidcContext).Debug("Proxy auto-configuration script failed for " + host + ": " + e.Error())
+			return nil
+		}
+		return parsePacResult(result)
+	}
+	if s.BypassLocal && !strings.Contains(host, ".") {
+		return nil
+	}
+	p := s.Proxy
+	if p == "" && s.Socks != "" {
+		p = "socks5://" + s.Socks
+	}
+	if p == "" {
+		return nil
+	}
+	conf := &httpproxy.Config{HTTPSProxy: p, NoProxy: strings.Join(s.Bypass, ",")}
+	if u, e := conf.ProxyFunc()(&url.URL{Scheme: "https", Host: addr}); e == nil && u != nil {
+		return &Proxy{URL: u.String()}
+	}
+	return nil
+}
+
+// bypassList converts host patterns of the system settings (e.g. *.example.com) to NO_PROXY entries.
+func bypassList(patterns []string) (list []string, local bool) {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "":
+		case p == "<local>":
+			local = true
+		case strings.HasPrefix(p, "*."):
+			list = append(list, strings.TrimPrefix(p, "*."))
+		default:
+			list = append(list, p)
+		}
+	}
+	return
+}
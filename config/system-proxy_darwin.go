@@ -0,0 +1,80 @@
+// +build darwin
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// readSystemProxy reads the proxy settings of the current network service with scutil.
+func readSystemProxy() (*SystemProxySettings, error) {
+	out, e := exec.Command("scutil", "--proxy").Output()
+	if e != nil {
+		return nil, e
+	}
+	values := make(map[string]string)
+	var exceptions []string
+	inExceptions := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "}" {
+			inExceptions = false
+			continue
+		}
+		kv := strings.SplitN(line, " : ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if inExceptions {
+			exceptions = append(exceptions, kv[1])
+			continue
+		}
+		if kv[0] == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[kv[0]] = kv[1]
+	}
+	s := &SystemProxySettings{}
+	if values["ProxyAutoConfigEnable"] == "1" {
+		s.PacURL = values["ProxyAutoConfigURLString"]
+	}
+	if values["HTTPSEnable"] == "1" && values["HTTPSProxy"] != "" {
+		s.Proxy = net.JoinHostPort(values["HTTPSProxy"], values["HTTPSPort"])
+	} else if values["HTTPEnable"] == "1" && values["HTTPProxy"] != "" {
+		s.Proxy = net.JoinHostPort(values["HTTPProxy"], values["HTTPPort"])
+	}
+	if values["SOCKSEnable"] == "1" && values["SOCKSProxy"] != "" {
+		s.Socks = net.JoinHostPort(values["SOCKSProxy"], values["SOCKSPort"])
+	}
+	s.Bypass, _ = bypassList(exceptions)
+	s.BypassLocal = values["ExcludeSimpleHostnames"] == "1"
+	if s.PacURL == "" && s.Proxy == "" && s.Socks == "" {
+		return nil, nil
+	}
+	return s, nil
+}
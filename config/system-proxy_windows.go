@@ -0,0 +1,64 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// readSystemProxy reads the proxy settings of the current user (Internet Options).
+func readSystemProxy() (*SystemProxySettings, error) {
+	k, e := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.QUERY_VALUE)
+	if e != nil {
+		return nil, e
+	}
+	defer k.Close()
+	s := &SystemProxySettings{}
+	s.PacURL, _, _ = k.GetStringValue("AutoConfigURL")
+	if enable, _, _ := k.GetIntegerValue("ProxyEnable"); enable == 1 {
+		server, _, _ := k.GetStringValue("ProxyServer")
+		if !strings.Contains(server, "=") {
+			s.Proxy = server
+		} else {
+			// Per-protocol form: http=host:port;https=host:port;socks=host:port
+			protocols := make(map[string]string)
+			for _, part := range strings.Split(server, ";") {
+				if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+					protocols[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+				}
+			}
+			s.Proxy = protocols["https"]
+			if s.Proxy == "" {
+				s.Proxy = protocols["http"]
+			}
+			s.Socks = protocols["socks"]
+		}
+		override, _, _ := k.GetStringValue("ProxyOverride")
+		s.Bypass, s.BypassLocal = bypassList(strings.Split(override, ";"))
+	}
+	if s.PacURL == "" && s.Proxy == "" && s.Socks == "" {
+		return nil, nil
+	}
+	return s, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import "fmt"
+
+// checkChain verifies that the task chained with After exists, and that the chain does not loop back to the task.
+func checkChain(tasks []*Task, t *Task) error {
+	byUuid := make(map[string]*Task, len(tasks))
+	for _, o := range tasks {
+		byUuid[o.Uuid] = o
+	}
+	byUuid[t.Uuid] = t
+	visited := map[string]bool{}
+	for c := t; c.After != ""; {
+		if visited[c.Uuid] {
+			return fmt.Errorf("task %s cannot run after %s: tasks would be chained in a loop", t.Uuid, t.After)
+		}
+		visited[c.Uuid] = true
+		next, ok := byUuid[c.After]
+		if !ok {
+			return fmt.Errorf("task %s cannot run after %s: task not found", c.Uuid, c.After)
+		}
+		c = next
+	}
+	return nil
+}
+
+// ChainedAfter lists the tasks that run after the task with this uuid.
+func (g *Global) ChainedAfter(uuid string) (tasks []*Task) {
+	for _, t := range g.Tasks {
+		if t.After == uuid {
+			tasks = append(tasks, t)
+		}
+	}
+	return
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// splitFileRoot turns a task whose local URI points to a regular file into a task rooted on the parent folder
+// and restricted to this file. If the other side ends with the same file name, it is rooted on its parent too.
+func splitFileRoot(t *Task) {
+	if t.File != "" {
+		return
+	}
+	uris := []*string{&t.LeftURI, &t.RightURI}
+	for i, uri := range uris {
+		u, e := url.Parse(*uri)
+		if e != nil || u.Scheme != "fs" || u.Path == "" {
+			continue
+		}
+		p := u.Path
+		if runtime.GOOS == "windows" && len(p) > 2 && p[2] == ':' {
+			p = p[1:]
+		}
+		if st, e := os.Stat(filepath.FromSlash(p)); e != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		name := path.Base(u.Path)
+		u.Path = path.Dir(u.Path)
+		*uri = u.String()
+		t.File = name
+		other := uris[1-i]
+		if o, e := url.Parse(*other); e == nil && strings.TrimSuffix(o.Path, "/") != "" && path.Base(o.Path) == name {
+			o.Path = path.Dir(strings.TrimSuffix(o.Path, "/"))
+			*other = o.String()
+		}
+		return
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"sync"
+)
+
+// tasksLock serializes the updates of the tasks list, so that revisions are checked and saved atomically.
+var tasksLock sync.Mutex
+
+// RevisionConflictError is returned when a task is updated from a stale copy.
+type RevisionConflictError struct {
+	Uuid     string
+	Revision int
+	Current  int
+}
+
+// Error implements error interface.
+func (r *RevisionConflictError) Error() string {
+	return fmt.Sprintf("task %s was modified in the meantime (revision %d, current is %d), reload it and apply your changes again", r.Uuid, r.Revision, r.Current)
+}
+
+// syncSavedTasks picks up the tasks saved by another process (e.g. the command line) if the config file was
+// written since it was last read or saved here: newer revisions replace the tasks in memory, and created or
+// removed tasks are added or removed. A TaskChange event is emitted for each of them. It must be called with
+// tasksLock held, before any change is saved, so that the changes of the other process are not overwritten.
+func (g *Global) syncSavedTasks() {
+	if !fileChanged() {
+		return
+	}
+	stamp := statFile()
+	disk, e := LoadFromFile()
+	if e != nil {
+		return
+	}
+	setStamp(stamp)
+	saved := make(map[string]bool, len(disk.Tasks))
+	for _, d := range disk.Tasks {
+		saved[d.Uuid] = true
+		var current *Task
+		for i, t := range g.Tasks {
+			if t.Uuid == d.Uuid {
+				current = t
+				if d.Revision > t.Revision {
+					g.Tasks[i] = d
+					g.emitTaskChange("update", d)
+				}
+			}
+		}
+		if current == nil {
+			g.Tasks = append(g.Tasks, d)
+			g.emitTaskChange("create", d)
+		}
+	}
+	var kept []*Task
+	for _, t := range g.Tasks {
+		if saved[t.Uuid] {
+			kept = append(kept, t)
+		} else {
+			g.emitTaskChange("remove", t)
+		}
+	}
+	g.Tasks = kept
+}
+
+// emitTaskChange sends a TaskChange event to the config watchers.
+func (g *Global) emitTaskChange(changeType string, task *Task) {
+	go func() {
+		for _, c := range g.changes {
+			c <- &TaskChange{Type: changeType, Task: task}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+)
+
+const urlHandlerDesktop = "cells-sync-url.desktop"
+
+func urlHandlerFile() (string, error) {
+	us, e := user.Current()
+	if e != nil {
+		return "", e
+	}
+	return filepath.Join(us.HomeDir, ".local", "share", "applications", urlHandlerDesktop), nil
+}
+
+// RegisterURLHandler registers the current executable as the handler of cellssync:// links for the current user,
+// with a hidden desktop entry declared as the default x-scheme-handler.
+func RegisterURLHandler() error {
+	file, e := urlHandlerFile()
+	if e != nil {
+		return e
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Name=Cells Sync
+Comment=Open Cells Sync links
+Exec="%s" open-url %%u
+Type=Application
+Terminal=false
+NoDisplay=true
+MimeType=x-scheme-handler/%s;
+`, ProcessName(os.Args[0]), URLScheme)
+	if e := os.MkdirAll(filepath.Dir(file), 0755); e != nil {
+		return e
+	}
+	if e := ioutil.WriteFile(file, []byte(entry), 0644); e != nil {
+		return e
+	}
+	if out, e := exec.Command("xdg-mime", "default", urlHandlerDesktop, "x-scheme-handler/"+URLScheme).CombinedOutput(); e != nil {
+		return fmt.Errorf("cannot register the link handler with xdg-mime: %s %s", e.Error(), string(out))
+	}
+	// Optional, refreshes the cache of some desktop environments
+	exec.Command("update-desktop-database", filepath.Dir(file)).Run()
+	return nil
+}
+
+// UnregisterURLHandler removes the desktop entry handling cellssync:// links.
+func UnregisterURLHandler() error {
+	file, e := urlHandlerFile()
+	if e != nil {
+		return e
+	}
+	if e := os.Remove(file); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+	return nil
+}
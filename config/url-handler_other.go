@@ -0,0 +1,34 @@
+// +build !linux,!windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import "fmt"
+
+// RegisterURLHandler is not supported: on macOS, cellssync:// links are declared by the application bundle.
+func RegisterURLHandler() error {
+	return fmt.Errorf("links handler cannot be registered on this platform, it is declared by the application package")
+}
+
+// UnregisterURLHandler is not supported on this platform.
+func UnregisterURLHandler() error {
+	return fmt.Errorf("links handler cannot be unregistered on this platform")
+}
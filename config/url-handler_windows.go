@@ -0,0 +1,62 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const urlHandlerKey = `Software\Classes\` + URLScheme
+
+// RegisterURLHandler registers the current executable as the handler of cellssync:// links for the current user.
+func RegisterURLHandler() error {
+	k, _, e := registry.CreateKey(registry.CURRENT_USER, urlHandlerKey, registry.SET_VALUE)
+	if e != nil {
+		return e
+	}
+	defer k.Close()
+	if e := k.SetStringValue("", "URL:Cells Sync"); e != nil {
+		return e
+	}
+	if e := k.SetStringValue("URL Protocol", ""); e != nil {
+		return e
+	}
+	cmd, _, e := registry.CreateKey(registry.CURRENT_USER, urlHandlerKey+`\shell\open\command`, registry.SET_VALUE)
+	if e != nil {
+		return e
+	}
+	defer cmd.Close()
+	return cmd.SetStringValue("", fmt.Sprintf(`"%s" open-url "%%1"`, ProcessName(os.Args[0])))
+}
+
+// UnregisterURLHandler removes the registry keys handling cellssync:// links.
+func UnregisterURLHandler() error {
+	for _, k := range []string{`\shell\open\command`, `\shell\open`, `\shell`, ""} {
+		if e := registry.DeleteKey(registry.CURRENT_USER, urlHandlerKey+k); e != nil && e != registry.ErrNotExist {
+			return e
+		}
+	}
+	return nil
+}
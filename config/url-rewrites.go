@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// URLRewrite redirects the connections made to the From address to the To address, for split-horizon setups where
+// the server returns presigned or redirect URLs that are not reachable from the client network. Both are host:port
+// addresses or URLs, the port defaulting to the scheme one. Only the connection is redirected: the Host header and
+// the TLS server name are kept, so that signatures and certificates still match.
+type URLRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// normalizeAddr converts a URL or a host:port address to a host:port address.
+func normalizeAddr(s string) (string, error) {
+	if strings.Contains(s, "://") {
+		u, e := url.Parse(s)
+		if e != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid address %s", s)
+		}
+		if u.Port() != "" {
+			return u.Host, nil
+		}
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		return net.JoinHostPort(u.Hostname(), port), nil
+	}
+	if _, _, e := net.SplitHostPort(s); e != nil {
+		return "", fmt.Errorf("invalid address %s, use host:port or a URL", s)
+	}
+	return s, nil
+}
+
+// rewriteAddr returns the address to connect to instead of addr, following the rewrite rules of all authorities.
+func rewriteAddr(addr string) string {
+	for _, a := range Default().Authorities {
+		for _, r := range a.Rewrites {
+			from, e1 := normalizeAddr(r.From)
+			to, e2 := normalizeAddr(r.To)
+			if e1 == nil && e2 == nil && strings.EqualFold(from, addr) {
+				return to
+			}
+		}
+	}
+	return addr
+}
+
+// SetURLRewrites sets the rewrite rules of an authority. An empty list removes them.
+func (g *Global) SetURLRewrites(id string, rules []*URLRewrite) error {
+	for _, r := range rules {
+		if _, e := normalizeAddr(r.From); e != nil {
+			return e
+		}
+		if _, e := normalizeAddr(r.To); e != nil {
+			return e
+		}
+	}
+	for _, a := range g.Authorities {
+		if a.key() != id && a.Id != id {
+			continue
+		}
+		a.Rewrites = rules
+		return Save()
+	}
+	return fmt.Errorf("cannot find authority %s", id)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const accessDeniedRetry = 30 * time.Minute
+
+// accessDenied keeps track of the remote subtrees that returned a 403 during a sync. They are excluded from
+// the task until the next retry, so that they are not interpreted as deleted and local data is kept.
+type accessDenied struct {
+	sync.Mutex
+	paths map[string]time.Time
+}
+
+func newAccessDenied() *accessDenied {
+	return &accessDenied{paths: make(map[string]time.Time)}
+}
+
+// isForbidden checks if an operation error is a permission error returned by the server.
+func isForbidden(e error) bool {
+	if e == nil {
+		return false
+	}
+	msg := strings.ToLower(errors.Cause(e).Error())
+	return strings.Contains(msg, "403") || strings.Contains(msg, "forbidden") || strings.Contains(msg, "access denied")
+}
+
+// collect finds operations that failed on a permission error, and registers their parent folder.
+func (a *accessDenied) collect(patch merger.Patch) (added bool) {
+	a.Lock()
+	defer a.Unlock()
+	patch.WalkOperations([]merger.OperationType{
+		merger.OpCreateFile, merger.OpUpdateFile, merger.OpCreateFolder, merger.OpMoveFile, merger.OpMoveFolder, merger.OpDelete,
+	}, func(operation merger.Operation) {
+		if !isForbidden(operation.Error()) {
+			return
+		}
+		p := strings.Trim(operation.GetRefPath(), "/")
+		if operation.GetNode() != nil && operation.GetNode().IsLeaf() {
+			p = strings.Trim(path.Dir(p), "/.")
+		}
+		if p == "" {
+			// Permission lost on the root, which is handled by the workspace checks
+			return
+		}
+		if _, ok := a.paths[p]; !ok {
+			added = true
+		}
+		a.paths[p] = time.Now().Add(accessDeniedRetry)
+	})
+	return
+}
+
+// expire removes the paths that must be retried and returns true if some were removed.
+func (a *accessDenied) expire() (removed bool) {
+	a.Lock()
+	defer a.Unlock()
+	for p, retry := range a.paths {
+		if time.Now().After(retry) {
+			delete(a.paths, p)
+			removed = true
+		}
+	}
+	return
+}
+
+// list returns the sorted list of denied paths.
+func (a *accessDenied) list() (paths []string) {
+	a.Lock()
+	defer a.Unlock()
+	for p := range a.paths {
+		paths = append(paths, "/"+p)
+	}
+	sort.Strings(paths)
+	return
+}
+
+// ignores returns filter patterns for the denied subtrees.
+func (a *accessDenied) ignores() (patterns []string) {
+	a.Lock()
+	defer a.Unlock()
+	for p := range a.paths {
+		patterns = append(patterns, p, p+"/**")
+	}
+	return
+}
+
+// handleAccessDenied excludes the subtrees that returned a permission error from the task, surfaces them in
+// the task state, and schedules a retry.
+func (s *Syncer) handleAccessDenied(ctx context.Context, patch merger.Patch) {
+	if !s.denied.collect(patch) {
+		return
+	}
+	denied := s.denied.list()
+	log.Logger(ctx).Warn(fmt.Sprintf("Access denied on %d remote folder(s), they will be ignored and retried later: %s", len(denied), strings.Join(denied, ", ")))
+	s.applyFilters()
+	s.stateStore.UpdateAccessDenied(denied)
+	msg := fmt.Sprintf("Access denied on %d folder(s) on the server, local data is kept. Retrying in %d minutes.", len(denied), int(accessDeniedRetry.Minutes()))
+	s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusError)
+	time.AfterFunc(accessDeniedRetry, func() {
+		if !s.denied.expire() {
+			return
+		}
+		log.Logger(ctx).Info("Retrying access to remote folders that were denied")
+		s.applyFilters()
+		GetBus().Pub(s.stateStore.UpdateAccessDenied(s.denied.list()), TopicState)
+		if !s.manual() {
+			GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+		}
+	})
+}
+
+// applyFilters sets the task filters from the configuration, server policies and access-denied subtrees.
+func (s *Syncer) applyFilters() {
+	if s.task == nil {
+		return
+	}
+	ignores := append([]string{}, s.ignores...)
+	ignores = append(ignores, s.denied.ignores()...)
+	for _, rules := range s.ignoreRules {
+		ignores = append(ignores, rules.Filters()...)
+	}
+	s.task.SetFilters(taskRoots(s.conf.SelectiveRoots, s.conf.File), ignores)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+var (
+	userActive          int32
+	activityMonitorOnce sync.Once
+)
+
+// startActivityMonitor regularly polls the OS idle time, as it can be costly to read on some platforms.
+func startActivityMonitor() {
+	activityMonitorOnce.Do(func() {
+		go func() {
+			for {
+				var active int32
+				if a := config.Default().Activity; a != nil && a.Enabled {
+					if idle, ok := systemIdleTime(); ok && idle < time.Duration(a.IdleMinutes)*time.Minute {
+						active = 1
+					}
+				}
+				atomic.StoreInt32(&userActive, active)
+				<-time.After(10 * time.Second)
+			}
+		}()
+	})
+}
+
+// activityRateLimit returns the rate limit in bytes per second for heavy work while the user is active, or 0.
+func activityRateLimit() int64 {
+	if atomic.LoadInt32(&userActive) == 0 {
+		return 0
+	}
+	if a := config.Default().Activity; a != nil && a.ActiveRateKB > 0 {
+		return a.ActiveRateKB * 1024
+	}
+	return 0
+}
+
+// minRateLimit returns the lowest non-zero limit.
+func minRateLimit(limits ...int64) (min int64) {
+	for _, l := range limits {
+		if l > 0 && (min == 0 || l < min) {
+			min = l
+		}
+	}
+	return
+}
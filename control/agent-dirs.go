@@ -0,0 +1,65 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// agentDirsIgnores returns ignore patterns for the agent folders located below the local roots of the task, or an
+// error if a root is itself inside one of these folders: syncing the state DBs or logs while they are written
+// would corrupt them.
+func agentDirsIgnores(conf *config.Task) (patterns []string, e error) {
+	dirs := config.AgentDirectories()
+	for _, uri := range []string{conf.LeftURI, conf.RightURI} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok {
+			continue
+		}
+		if dir := agentDirContaining(root, dirs); dir != "" {
+			return nil, fmt.Errorf("%s is inside the application folder %s and cannot be synced", root, dir)
+		}
+		for _, dir := range dirs {
+			if !pathContains(root, dir) {
+				continue
+			}
+			if rel, er := filepath.Rel(root, dir); er == nil {
+				p := strings.Trim(filepath.ToSlash(rel), "/")
+				patterns = append(patterns, p, p+"/**")
+			}
+		}
+	}
+	return
+}
+
+// agentDirContaining returns the agent folder that contains folder, if any.
+func agentDirContaining(folder string, dirs []string) string {
+	for _, dir := range dirs {
+		if pathContains(dir, folder) {
+			return dir
+		}
+	}
+	return ""
+}
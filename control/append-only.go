@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// setupAppendOnly makes the target of a one-way task append-only. It must be a remote endpoint: local folders
+// can be protected by the filesystem permissions instead.
+func (s *Syncer) setupAppendOnly(left, right model.Endpoint, direction model.DirectionType) error {
+	var target model.Endpoint
+	switch direction {
+	case model.DirectionRight:
+		target = right
+	case model.DirectionLeft:
+		target = left
+	default:
+		return fmt.Errorf("append-only mode requires a one-way task")
+	}
+	index, e := endpoint.SetAppendOnly(target, filepath.Join(s.configPath, "append-only"))
+	if e != nil {
+		return errors.Wrap(e, "cannot open append-only index")
+	}
+	if index == nil {
+		return fmt.Errorf("append-only mode requires a remote target")
+	}
+	s.appendOnly = index
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// archiveWriteError is returned when the archive itself cannot be written, as opposed to a file that cannot be
+// read from the server.
+type archiveWriteError struct {
+	err error
+}
+
+func (a *archiveWriteError) Error() string {
+	return "cannot write archive: " + a.err.Error()
+}
+
+// errWriter wraps the errors of the archive writer, to tell them apart from read errors.
+type errWriter struct {
+	io.Writer
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	n, e := w.Writer.Write(p)
+	if e != nil {
+		e = &archiveWriteError{err: e}
+	}
+	return n, e
+}
+
+// archiveWriter writes files to a zip or tar archive, optionally gzipped.
+type archiveWriter struct {
+	zw *zip.Writer
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func newArchiveWriter(w io.Writer, format string) *archiveWriter {
+	switch format {
+	case ArchiveFormatTar:
+		return &archiveWriter{tw: tar.NewWriter(w)}
+	case ArchiveFormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &archiveWriter{tw: tar.NewWriter(gz), gz: gz}
+	}
+	return &archiveWriter{zw: zip.NewWriter(w)}
+}
+
+// add copies a file into the archive. Tar entries have a fixed size: if the file is shorter than announced, the
+// entry is padded with zeros to keep the archive readable, and the read error is returned.
+func (w *archiveWriter) add(name string, size int64, mtime time.Time, r io.Reader) error {
+	if w.zw != nil {
+		out, e := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime})
+		if e != nil {
+			return &archiveWriteError{err: e}
+		}
+		_, e = io.Copy(errWriter{out}, r)
+		return e
+	}
+	if e := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: mtime, Typeflag: tar.TypeReg}); e != nil {
+		return &archiveWriteError{err: e}
+	}
+	n, e := io.CopyN(errWriter{w.tw}, r, size)
+	if _, ok := e.(*archiveWriteError); ok {
+		return e
+	}
+	if n < size {
+		if _, er := io.CopyN(errWriter{w.tw}, zeroReader{}, size-n); er != nil {
+			return er
+		}
+	}
+	return e
+}
+
+// Close flushes the archive.
+func (w *archiveWriter) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if e := w.tw.Close(); e != nil {
+		return e
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// countingReader counts the bytes read, to find the offsets of the entries of a tar archive.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, e := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, e
+}
+
+// archiveReader gives random access to the files of a previous zip or uncompressed tar archive.
+type archiveReader struct {
+	zr      *zip.ReadCloser
+	zips    map[string]*zip.File
+	f       *os.File
+	offsets map[string][2]int64
+}
+
+func openArchiveReader(p string, format string) (*archiveReader, error) {
+	if format == ArchiveFormatZip {
+		zr, e := zip.OpenReader(p)
+		if e != nil {
+			return nil, e
+		}
+		r := &archiveReader{zr: zr, zips: make(map[string]*zip.File)}
+		for _, f := range zr.File {
+			r.zips[f.Name] = f
+		}
+		return r, nil
+	}
+	f, e := os.Open(p)
+	if e != nil {
+		return nil, e
+	}
+	r := &archiveReader{f: f, offsets: make(map[string][2]int64)}
+	cr := &countingReader{Reader: f}
+	tr := tar.NewReader(cr)
+	for {
+		h, e := tr.Next()
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			f.Close()
+			return nil, e
+		}
+		r.offsets[h.Name] = [2]int64{cr.n, h.Size}
+	}
+	return r, nil
+}
+
+// open returns a reader on a file of the archive.
+func (r *archiveReader) open(name string) (io.ReadCloser, error) {
+	if r.zips != nil {
+		if f, ok := r.zips[name]; ok {
+			return f.Open()
+		}
+		return nil, os.ErrNotExist
+	}
+	if span, ok := r.offsets[name]; ok {
+		return ioutil.NopCloser(io.NewSectionReader(r.f, span[0], span[1])), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// Close releases the archive file. It can be called more than once.
+func (r *archiveReader) Close() {
+	if r.zr != nil {
+		r.zr.Close()
+		r.zr = nil
+	}
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
@@ -0,0 +1,368 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatTarGz = "tar.gz"
+
+	archiveIndexFile  = "archive-index.json"
+	archiveDateLayout = "20060102-150405"
+)
+
+// archiveEntry is the version of a file stored in the previous archive.
+type archiveEntry struct {
+	Etag  string
+	MTime int64
+	Size  int64
+}
+
+// archiveIndex describes the last written archive, to copy unchanged files from it.
+type archiveIndex struct {
+	Archive string
+	Entries map[string]*archiveEntry
+}
+
+// Archiver is a supervisor service running an archive task: on each run, it packages the remote folder into a
+// local archive. Runs are triggered by the task schedule or on demand.
+type Archiver struct {
+	uuid       string
+	conf       *config.Task
+	ctx        context.Context
+	done       chan bool
+	stateStore StateStore
+	configPath string
+	source     model.Endpoint
+	remoteURI  string
+	folder     string
+	format     string
+	cleanAll   bool
+}
+
+// NewArchiver creates a new archive task service.
+func NewArchiver(conf *config.Task) (archiver *Archiver) {
+
+	var startError error
+
+	ctx := servicecontext.WithServiceName(context.Background(), "archive-task")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorGrpc)
+	configPath := filepath.Join(config.SyncClientDataDir(), conf.Uuid)
+	stateStore := NewFileStateStore(conf, configPath)
+	if stateStore.FileError != nil {
+		log.Logger(ctx).Warn("Cannot open file for monitoring state : " + stateStore.FileError.Error())
+	}
+	archiver = &Archiver{
+		uuid:       conf.Uuid,
+		conf:       conf,
+		ctx:        ctx,
+		done:       make(chan bool, 1),
+		stateStore: stateStore,
+		configPath: configPath,
+		format:     conf.Archive.Format,
+	}
+
+	defer func() {
+		if startError != nil {
+			stateStore.UpdateErrors([]*common.ErrorInfo{errorInfo(startError, "")})
+			stateStore.UpdateProcessStatus(model.NewProcessingStatus(startError.Error()).SetError(startError), model.TaskStatusError)
+		}
+	}()
+
+	switch archiver.format {
+	case "":
+		archiver.format = ArchiveFormatZip
+	case ArchiveFormatZip, ArchiveFormatTar, ArchiveFormatTarGz:
+	default:
+		startError = fmt.Errorf("unknown archive format %s", archiver.format)
+		return
+	}
+	localURI, remoteURI := conf.LeftURI, conf.RightURI
+	folder, ok := endpoint.LocalPathForURI(localURI)
+	if !ok {
+		localURI, remoteURI = remoteURI, localURI
+		folder, ok = endpoint.LocalPathForURI(localURI)
+	}
+	if !ok {
+		startError = fmt.Errorf("archive tasks require a local folder")
+		return
+	}
+	archiver.folder = folder
+	archiver.remoteURI = remoteURI
+	source, e := endpoint.EndpointFromURI(remoteURI, localURI)
+	if e != nil {
+		startError = errors.Wrap(e, "cannot start remote endpoint")
+		return
+	}
+	if _, ok := model.AsDataSyncSource(source); !ok {
+		startError = fmt.Errorf("cannot read data from %s", remoteURI)
+		return
+	}
+	archiver.source = source
+	if e := os.MkdirAll(configPath, 0755); e != nil {
+		startError = errors.Wrap(e, "cannot create configuration folder for task")
+		return
+	}
+	return
+}
+
+// Serve implements supervisor service interface.
+func (a *Archiver) Serve() {
+	bus := GetBus()
+	topic := bus.Sub(TopicSyncAll, TopicSync_+a.uuid)
+	defer bus.Unsub(topic)
+
+	if a.source != nil {
+		log.Logger(a.ctx).Info("Starting Archive Service")
+		if index := a.loadIndex(); index.Archive == "" {
+			a.run()
+		}
+	} else {
+		log.Logger(a.ctx).Info("Archiver did not setup Task properly, do nothing")
+	}
+	for {
+		select {
+		case message := <-topic:
+			switch message {
+			case MessageSyncLoop, MessageResync, MessageScheduledResync:
+				if a.source != nil {
+					a.run()
+				}
+			case MessagePublishState:
+				bus.Pub(a.stateStore.LastState(), TopicState)
+			case MessageRestart, MessageRestartClean:
+				bus.Pub(a.stateStore.UpdateSyncStatus(model.TaskStatusRestarting), TopicState)
+			case MessageHalt:
+				bus.Pub(a.stateStore.UpdateSyncStatus(model.TaskStatusStopping), TopicState)
+			case MessageHaltClean:
+				a.cleanAll = true
+				bus.Pub(a.stateStore.UpdateSyncStatus(model.TaskStatusStopping), TopicState)
+			}
+		case <-a.done:
+			a.shutdown()
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (a *Archiver) Stop() {
+	a.done <- true
+}
+
+func (a *Archiver) shutdown() {
+	log.Logger(a.ctx).Info("Stopping Archive Service")
+	if a.cleanAll {
+		if e := os.RemoveAll(a.configPath); e != nil {
+			log.Logger(a.ctx).Error("Could not remove folder " + a.configPath + " : " + e.Error())
+		}
+		GetBus().Pub(a.stateStore.UpdateSyncStatus(model.TaskStatusRemoved), TopicState)
+	}
+	a.stateStore.Close()
+}
+
+// run writes a new archive of the remote folder.
+func (a *Archiver) run() {
+	bus := GetBus()
+	bus.Pub(a.stateStore.UpdateConnection(true, a.source.GetEndpointInfo()), TopicState)
+	bus.Pub(a.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Archiving "+a.remoteURI), model.TaskStatusProcessing), TopicState)
+	downloaded, copied, errs := a.archive()
+	a.stateStore.UpdateErrors(errs)
+	a.stateStore.TouchLastOpsTime()
+	msg := fmt.Sprintf("Archived %d file(s), %d downloaded", downloaded+copied, downloaded)
+	log.Logger(a.ctx).Info(msg)
+	if len(errs) > 0 {
+		e := fmt.Errorf("%d file(s) could not be archived", len(errs))
+		bus.Pub(a.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg).SetError(e), model.TaskStatusError), TopicState)
+	} else {
+		bus.Pub(a.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusIdle), TopicState)
+	}
+}
+
+// archiveName returns the file name of the archive written by this run.
+func (a *Archiver) archiveName(now time.Time) string {
+	name := a.conf.Archive.Name
+	if name == "" {
+		name = a.conf.Label
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if a.conf.Archive.Versions > 1 {
+		name += "-" + now.Format(archiveDateLayout)
+	}
+	return name + "." + a.format
+}
+
+// archive lists the remote files and writes them to a temporary archive, which is moved in place once complete.
+func (a *Archiver) archive() (downloaded, copied int, errs []*common.ErrorInfo) {
+	var nodes []*tree.Node
+	a.source.Walk(func(p string, node *tree.Node, err error) {
+		p = strings.Trim(p, "/")
+		if err != nil || p == "" || !node.IsLeaf() || strings.HasPrefix(filepath.Base(p), ".") {
+			return
+		}
+		n := node.Clone()
+		n.Path = p
+		nodes = append(nodes, n)
+	}, "/", true)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Path < nodes[j].Path
+	})
+
+	previous := a.loadIndex()
+	var reuse *archiveReader
+	if previous.Archive != "" && a.format != ArchiveFormatTarGz {
+		if r, e := openArchiveReader(filepath.Join(a.folder, previous.Archive), a.format); e == nil {
+			reuse = r
+			defer reuse.Close()
+		}
+	}
+
+	name := a.archiveName(time.Now())
+	temp := filepath.Join(a.folder, endpoint.JournalTempPrefix+name)
+	f, e := os.Create(temp)
+	if e != nil {
+		errs = append(errs, errorInfo(e, name))
+		return
+	}
+	defer os.Remove(temp)
+	w := newArchiveWriter(f, a.format)
+	next := &archiveIndex{Archive: name, Entries: make(map[string]*archiveEntry)}
+	for _, node := range nodes {
+		entry := &archiveEntry{Etag: node.Etag, MTime: node.MTime, Size: node.Size}
+		var reader io.ReadCloser
+		if old, ok := previous.Entries[node.Path]; ok && reuse != nil && old.Etag == entry.Etag && old.Etag != "" {
+			reader, _ = reuse.open(node.Path)
+		}
+		fromPrevious := reader != nil
+		if reader == nil {
+			source, _ := model.AsDataSyncSource(a.source)
+			if reader, e = source.GetReaderOn(node.Path); e != nil {
+				log.Logger(a.ctx).Error("Cannot archive " + node.Path + ": " + e.Error())
+				errs = append(errs, errorInfo(e, node.Path))
+				continue
+			}
+		}
+		e = w.add(node.Path, entry.Size, time.Unix(entry.MTime, 0), reader)
+		reader.Close()
+		if e != nil {
+			log.Logger(a.ctx).Error("Cannot archive " + node.Path + ": " + e.Error())
+			errs = append(errs, errorInfo(e, node.Path))
+			if _, ok := e.(*archiveWriteError); ok {
+				// The archive itself is broken, stop here
+				f.Close()
+				return
+			}
+			continue
+		}
+		next.Entries[node.Path] = entry
+		if fromPrevious {
+			copied++
+		} else {
+			downloaded++
+		}
+	}
+	if e := w.Close(); e != nil {
+		f.Close()
+		errs = append(errs, errorInfo(e, name))
+		return
+	}
+	if e := f.Close(); e != nil {
+		errs = append(errs, errorInfo(e, name))
+		return
+	}
+	if reuse != nil {
+		reuse.Close()
+	}
+	if e := os.Rename(temp, filepath.Join(a.folder, name)); e != nil {
+		errs = append(errs, errorInfo(e, name))
+		return
+	}
+	if e := a.saveIndex(next); e != nil {
+		log.Logger(a.ctx).Error("Cannot save archive index: " + e.Error())
+	}
+	a.pruneVersions()
+	return
+}
+
+// pruneVersions removes the oldest dated archives beyond the number of versions to keep.
+func (a *Archiver) pruneVersions() {
+	keep := a.conf.Archive.Versions
+	if keep <= 1 {
+		return
+	}
+	prefix := strings.TrimSuffix(a.archiveName(time.Time{}), time.Time{}.Format(archiveDateLayout)+"."+a.format)
+	matches, _ := filepath.Glob(filepath.Join(a.folder, prefix+"*."+a.format))
+	sort.Strings(matches)
+	for len(matches) > keep {
+		log.Logger(a.ctx).Info("Removing old archive " + filepath.Base(matches[0]))
+		os.Remove(matches[0])
+		matches = matches[1:]
+	}
+}
+
+func (a *Archiver) loadIndex() *archiveIndex {
+	index := &archiveIndex{Entries: make(map[string]*archiveEntry)}
+	if data, e := ioutil.ReadFile(filepath.Join(a.configPath, archiveIndexFile)); e == nil {
+		json.Unmarshal(data, index)
+	}
+	if index.Archive != "" {
+		if _, e := os.Stat(filepath.Join(a.folder, index.Archive)); e != nil {
+			// Archive was moved or removed by the user
+			return &archiveIndex{Entries: make(map[string]*archiveEntry)}
+		}
+	}
+	return index
+}
+
+func (a *Archiver) saveIndex(index *archiveIndex) error {
+	data, e := json.Marshal(index)
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(filepath.Join(a.configPath, archiveIndexFile), data, 0644)
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+// AuditFolder returns the folder of the audit log of a task in previous versions, imported into its history.
+func AuditFolder(taskUuid string) string {
+	return filepath.Join(config.SyncClientDataDir(), taskUuid, "audit")
+}
+
+// auditAction names an operation type in the audit log.
+func auditAction(t merger.OperationType) string {
+	switch t {
+	case merger.OpCreateFile:
+		return "create-file"
+	case merger.OpUpdateFile:
+		return "update-file"
+	case merger.OpCreateFolder:
+		return "create-folder"
+	case merger.OpMoveFile:
+		return "move-file"
+	case merger.OpMoveFolder:
+		return "move-folder"
+	case merger.OpDelete:
+		return "delete"
+	case merger.OpConflict:
+		return "conflict"
+	}
+	return ""
+}
+
+// recordAudit appends the operations of a patch to the task audit log, with the hashes of the files before and
+// after the operation. It must run before recordNodeMeta, that drops the metadata of deleted nodes.
+func (s *Syncer) recordAudit(ctx context.Context, patch merger.Patch) {
+	if s.audit == nil {
+		return
+	}
+	direction := "download"
+	if strings.HasPrefix(patch.Source().GetEndpointInfo().URI, "fs://") {
+		direction = "upload"
+	}
+	lastHash := func(p string) string {
+		if s.nodeMeta == nil {
+			return ""
+		}
+		return s.nodeMeta.Get(p, endpoint.MetaHash)
+	}
+	now := time.Now()
+	var records []*endpoint.AuditRecord
+	patch.WalkOperations([]merger.OperationType{
+		merger.OpCreateFile, merger.OpUpdateFile, merger.OpCreateFolder, merger.OpMoveFile, merger.OpMoveFolder, merger.OpDelete, merger.OpConflict,
+	}, func(operation merger.Operation) {
+		p := operation.GetRefPath()
+		record := &endpoint.AuditRecord{
+			Time:      now,
+			Task:      s.uuid,
+			Path:      "/" + strings.TrimLeft(p, "/"),
+			Direction: direction,
+			Action:    auditAction(operation.Type()),
+			Result:    endpoint.AuditResultSuccess,
+		}
+		n := operation.GetNode()
+		switch operation.Type() {
+		case merger.OpCreateFile, merger.OpUpdateFile:
+			record.HashBefore = lastHash(p)
+			if n != nil {
+				record.Size = n.GetSize()
+				record.HashAfter = n.GetEtag()
+			}
+		case merger.OpMoveFile:
+			record.From = "/" + strings.TrimLeft(operation.GetMoveOriginPath(), "/")
+			record.HashBefore = lastHash(operation.GetMoveOriginPath())
+			record.HashAfter = record.HashBefore
+			if n != nil {
+				record.Size = n.GetSize()
+			}
+		case merger.OpMoveFolder:
+			record.From = "/" + strings.TrimLeft(operation.GetMoveOriginPath(), "/")
+		case merger.OpDelete:
+			record.HashBefore = lastHash(p)
+			if n != nil {
+				record.Size = n.GetSize()
+			}
+		case merger.OpConflict:
+			record.Result = endpoint.AuditResultUnresolved
+		}
+		if direction == "upload" {
+			if a := endpoint.ActorOf(patch.Source(), p); a != nil {
+				record.Process = a.Process
+				record.User = a.User
+			}
+		}
+		if err := operation.Error(); err != nil {
+			record.Result = endpoint.AuditResultError
+			record.Error = err.Error()
+		} else if s.nodeMeta != nil && record.HashAfter != "" {
+			s.nodeMeta.Set(p, endpoint.MetaHash, record.HashAfter)
+		}
+		records = append(records, record)
+	})
+	if len(records) == 0 {
+		return
+	}
+	if e := s.audit.Append(records); e != nil {
+		log.Logger(ctx).Error("Cannot write audit log: " + e.Error())
+	}
+}
+
+// exportAudit sends the audit log of a task between the from and to dates (RFC3339 or YYYY-MM-DD), as JSON lines
+// or CSV depending on the format parameter.
+func (h *HttpServer) exportAudit(c *gin.Context) {
+	syncUUID := c.Param("uuid")
+	var task *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == syncUUID {
+			task = t
+		}
+	}
+	if task == nil {
+		h.writeError(c, fmt.Errorf("cannot find task %s", syncUUID))
+		return
+	}
+	from, e := ParseAuditDate(c.Query("from"), false)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	to, e := ParseAuditDate(c.Query("to"), true)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	format := c.DefaultQuery("format", endpoint.ExportFormatCSV)
+	records, e := readTaskAudit(syncUUID, from, to)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	contentType := "text/csv"
+	if format == endpoint.ExportFormatJSON {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit-%s.%s\"", syncUUID, format))
+	c.Status(http.StatusOK)
+	if e := endpoint.WriteAuditRecords(records, format, c.Writer); e != nil {
+		log.Logger(h.ctx).Error("Cannot export audit log: " + e.Error())
+	}
+}
+
+// ParseAuditDate parses a date range boundary. Dates without time cover the whole day: the end of the day is used
+// if end is true. An empty value returns a zero time.
+func ParseAuditDate(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, e := time.Parse(time.RFC3339, value); e == nil {
+		return t, nil
+	}
+	t, e := time.ParseInLocation("2006-01-02", value, time.Local)
+	if e != nil {
+		return t, fmt.Errorf("invalid date %s, use YYYY-MM-DD or RFC3339", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
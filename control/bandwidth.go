@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// NetworkUsage counts the bytes transferred on a given network.
+type NetworkUsage struct {
+	Network  string
+	Up       int64
+	Down     int64
+	Since    time.Time
+	LastSeen time.Time
+}
+
+var networkUsages struct {
+	sync.Mutex
+	loaded bool
+	usages map[string]*NetworkUsage
+}
+
+func networkUsageFile() string {
+	return filepath.Join(config.SyncClientDataDir(), "network-usage.json")
+}
+
+// loadNetworkUsages reads the usages file once. Must be called with the lock held.
+func loadNetworkUsages() {
+	if networkUsages.loaded {
+		return
+	}
+	networkUsages.loaded = true
+	networkUsages.usages = make(map[string]*NetworkUsage)
+	if data, e := ioutil.ReadFile(networkUsageFile()); e == nil {
+		json.Unmarshal(data, &networkUsages.usages)
+	}
+}
+
+// recordNetworkUsage adds transferred bytes to the usage of the current network, and saves the usages.
+func recordNetworkUsage(up, down int64) error {
+	name := CurrentNetwork().Name()
+	if name == "" {
+		name = "unknown"
+	}
+	networkUsages.Lock()
+	defer networkUsages.Unlock()
+	loadNetworkUsages()
+	u, ok := networkUsages.usages[name]
+	if !ok {
+		u = &NetworkUsage{Network: name, Since: time.Now()}
+		networkUsages.usages[name] = u
+	}
+	u.Up += up
+	u.Down += down
+	u.LastSeen = time.Now()
+	data, e := json.Marshal(networkUsages.usages)
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(networkUsageFile(), data, 0644)
+}
+
+// listNetworkUsages returns a copy of the usages of all known networks.
+func listNetworkUsages() (list []NetworkUsage) {
+	networkUsages.Lock()
+	defer networkUsages.Unlock()
+	loadNetworkUsages()
+	for _, u := range networkUsages.usages {
+		list = append(list, *u)
+	}
+	return
+}
+
+// networkRateLimit returns the rate limit in bytes per second that applies on the current network, or 0.
+func networkRateLimit() int64 {
+	b := config.Default().Bandwidth
+	if b == nil || !b.Enabled {
+		return 0
+	}
+	current := CurrentNetwork()
+	for _, r := range b.Rules {
+		if current.Matches(r.Network) {
+			return r.RateKB * 1024
+		}
+	}
+	return b.DefaultRateKB * 1024
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// setupBatches makes the local endpoints of the task record their operations in a batch journal, so that a folder
+// move and the operations inside the folder are applied together or not at all.
+func (s *Syncer) setupBatches(left, right model.Endpoint) error {
+	for name, ep := range map[string]model.Endpoint{"left": left, "right": right} {
+		b, e := endpoint.SetBatchJournal(ep, filepath.Join(s.configPath, "batch-journal-"+name))
+		if e != nil {
+			return errors.Wrap(e, "cannot open batch journal")
+		}
+		if b == nil {
+			continue
+		}
+		s.batches = append(s.batches, b)
+		s.invalidFolders = append(s.invalidFolders, b.Recovered...)
+	}
+	if len(s.invalidFolders) > 0 {
+		log.Logger(s.serviceCtx).Warn(fmt.Sprintf("Rolled back %d folder moves interrupted in previous run", len(s.invalidFolders)/2))
+	}
+	return nil
+}
+
+// finishBatches commits the batches of a patch, or rolls back those containing a failed operation. The patch is
+// then not re-applied: the snapshot entries of the rolled back folders are dropped, so that the next pass compares
+// them again on both sides.
+func (s *Syncer) finishBatches(ctx context.Context, patch merger.Patch) {
+	if len(s.batches) == 0 {
+		return
+	}
+	var failed []string
+	patch.WalkOperations([]merger.OperationType{}, func(operation merger.Operation) {
+		if operation.Error() == nil {
+			return
+		}
+		failed = append(failed, operation.GetRefPath())
+		if operation.Type() == merger.OpMoveFile || operation.Type() == merger.OpMoveFolder {
+			failed = append(failed, operation.GetMoveOriginPath())
+		}
+	})
+	var rolledBack []string
+	for _, b := range s.batches {
+		folders, e := b.Finish(failed)
+		if e != nil {
+			log.Logger(ctx).Error("Cannot finish batch: " + e.Error())
+		}
+		rolledBack = append(rolledBack, folders...)
+	}
+	if len(rolledBack) == 0 {
+		return
+	}
+	log.Logger(ctx).Warn(fmt.Sprintf("Rolled back %d folder moves that could not be applied completely", len(rolledBack)/2))
+	s.invalidFolders = append(s.invalidFolders, rolledBack...)
+	s.lastPatch = nil
+	s.invalidateFolders(ctx)
+}
+
+// invalidateFolders drops the snapshot entries of the folders whose batch was rolled back.
+func (s *Syncer) invalidateFolders(ctx context.Context) {
+	factory, ok := s.snapFactory.(*endpoint.SnapshotFactory)
+	if !ok {
+		return
+	}
+	for _, folder := range s.invalidFolders {
+		if _, e := factory.Invalidate(ctx, folder); e != nil {
+			log.Logger(ctx).Error("Cannot invalidate snapshots under " + folder + ": " + e.Error())
+		}
+	}
+	s.invalidFolders = nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// blackoutEnd returns the end of the blackout window that contains now, if any.
+func blackoutEnd(blackouts []*config.Blackout, now time.Time) (time.Time, bool) {
+	for _, b := range blackouts {
+		start, end, e := parseTimeWindow(b.Window)
+		if e != nil || start == end {
+			continue
+		}
+		minutes := now.Hour()*60 + now.Minute()
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		// Day on which the window started: for windows spanning over midnight, it may be yesterday
+		startDay := midnight
+		if start <= end {
+			if minutes < start || minutes >= end {
+				continue
+			}
+		} else if minutes < end {
+			startDay = midnight.AddDate(0, 0, -1)
+		} else if minutes < start {
+			continue
+		}
+		if !blackoutOnDay(b.Days, startDay.Weekday()) {
+			continue
+		}
+		endTime := startDay.Add(time.Duration(end) * time.Minute)
+		if start > end {
+			endTime = endTime.AddDate(0, 0, 1)
+		}
+		return endTime, true
+	}
+	return time.Time{}, false
+}
+
+// blackoutOnDay checks if a list of week days ("mon", "tuesday", ...) contains d. An empty list means every day.
+func blackoutOnDay(days []string, d time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, day := range days {
+		if len(day) >= 3 && strings.EqualFold(day[:3], d.String()[:3]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchBlackouts checks the task blackout schedules every minute and publishes MessageBlackoutStart/End
+// on the task topic when entering or leaving a window.
+func (s *Syncer) watchBlackouts(done chan bool) {
+	if s.conf == nil || len(s.conf.Blackouts) == 0 {
+		return
+	}
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	// Initial check is delayed until the task is subscribed to the bus
+	initial := time.After(2 * time.Second)
+	var in bool
+	check := func() {
+		_, now := blackoutEnd(s.conf.Blackouts, time.Now())
+		if now && !in {
+			GetBus().Pub(MessageBlackoutStart, TopicSync_+s.uuid)
+		} else if !now && in {
+			GetBus().Pub(MessageBlackoutEnd, TopicSync_+s.uuid)
+		}
+		in = now
+	}
+	for {
+		select {
+		case <-initial:
+			check()
+		case <-ticker.C:
+			check()
+		case <-done:
+			return
+		}
+	}
+}
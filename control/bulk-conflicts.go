@@ -0,0 +1,48 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pydio/cells/common/log"
+)
+
+// BulkConflictResolution is sent to a Syncer to resolve many conflicts with the same strategy, triggering a
+// single sync loop at the end.
+type BulkConflictResolution struct {
+	Paths []string
+	Keep  string
+}
+
+// resolveConflicts applies the strategy on each path, and returns true if at least one was resolved.
+func (s *Syncer) resolveConflicts(ctx context.Context, bulk *BulkConflictResolution) bool {
+	var resolved int
+	for _, p := range bulk.Paths {
+		if e := s.resolveConflict(ctx, &ConflictResolution{Path: p, Keep: bulk.Keep}); e != nil {
+			log.Logger(ctx).Error("Cannot resolve conflict on " + p + ": " + e.Error())
+			continue
+		}
+		resolved++
+	}
+	log.Logger(ctx).Info(fmt.Sprintf("Resolved %d/%d conflicts (%s)", resolved, len(bulk.Paths), bulk.Keep))
+	return resolved > 0
+}
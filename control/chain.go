@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// chainRetry is the delay before a pass is handed again to a task that was busy.
+const chainRetry = 5 * time.Second
+
+// ChainPass is sent to a chained task once the previous task of the chain applied changes. Path lists the tasks
+// that already ran during this pass, so that each task runs at most once per pass.
+type ChainPass struct {
+	Path []string
+}
+
+// visited checks if a task already ran during this pass.
+func (c *ChainPass) visited(uuid string) bool {
+	for _, p := range c.Path {
+		if p == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// chainState keeps the pass a chained task is currently running.
+type chainState struct {
+	sync.Mutex
+	pass *ChainPass
+}
+
+// runChainPass runs the task for a pass received from the previous task of the chain. The pass is postponed while
+// the previous task or this one are still running.
+func (s *Syncer) runChainPass(ctx context.Context, pass *ChainPass) {
+	if pass.visited(s.uuid) {
+		log.Logger(ctx).Warn("Ignoring chained pass that already went through this task: " + strings.Join(pass.Path, " > "))
+		return
+	}
+	if s.taskPaused || !s.isStarted() {
+		log.Logger(ctx).Info("Task is not running, skipping chained pass")
+		return
+	}
+	if runningTask(s.conf.After) || runningTask(s.uuid) {
+		time.AfterFunc(chainRetry, func() {
+			GetBus().Pub(pass, TopicSync_+s.uuid)
+		})
+		return
+	}
+	s.chain.Lock()
+	s.chain.pass = pass
+	s.chain.Unlock()
+	log.Logger(ctx).Info("Running chained pass after " + strings.Join(pass.Path, " > "))
+	s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Starting chained sync"), model.TaskStatusProcessing)
+	s.run(ctx, false)
+}
+
+// propagateChain hands the pass over to the tasks running after this one, if the patch changed files.
+func (s *Syncer) propagateChain(ctx context.Context, patch merger.Patch) {
+	s.chain.Lock()
+	pass := s.chain.pass
+	s.chain.pass = nil
+	s.chain.Unlock()
+	if patch.Size() == 0 {
+		return
+	}
+	var path []string
+	if pass != nil {
+		path = append(path, pass.Path...)
+	}
+	path = append(path, s.uuid)
+	for _, t := range config.Default().ChainedAfter(s.uuid) {
+		log.Logger(ctx).Info("Changes applied, running chained task " + t.Label)
+		GetBus().Pub(&ChainPass{Path: path}, TopicSync_+t.Uuid)
+	}
+}
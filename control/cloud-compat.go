@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// cloudCompatDurations returns the debounce and polling durations of the compatibility mode, with defaults.
+func cloudCompatDurations(c *config.CloudCompat) (debounce, poll time.Duration) {
+	debounce, poll = 30*time.Second, 5*time.Minute
+	if c.DebounceSeconds > 0 {
+		debounce = time.Duration(c.DebounceSeconds) * time.Second
+	}
+	if c.PollMinutes > 0 {
+		poll = time.Duration(c.PollMinutes) * time.Minute
+	}
+	return
+}
+
+// setupCloudCompat debounces events of the local sides of the task.
+func (s *Syncer) setupCloudCompat(endpoints ...model.Endpoint) {
+	debounce, _ := cloudCompatDurations(s.conf.CloudCompat)
+	for _, ep := range endpoints {
+		endpoint.SetDebounce(ep, debounce)
+	}
+}
+
+// pollCloudCompat triggers a sync loop at regular intervals while the compatibility mode is enabled.
+func (s *Syncer) pollCloudCompat(done chan bool) {
+	if s.conf == nil || s.conf.CloudCompat == nil || s.conf.Manual {
+		return
+	}
+	_, poll := cloudCompatDurations(s.conf.CloudCompat)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !s.taskPaused {
+				GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// cloudFolderProvider returns the product managing one of the local roots of the task, and that root.
+func cloudFolderProvider(conf *config.Task) (root string, provider string) {
+	for _, uri := range []string{conf.LeftURI, conf.RightURI} {
+		if r, ok := endpoint.LocalPathForURI(uri); ok {
+			if p := endpoint.CloudProviderFor(r); p != "" {
+				return r, p
+			}
+		}
+	}
+	return "", ""
+}
+
+// notifyCloudFolder warns the user that a task root is managed by another sync client.
+func notifyCloudFolder(conf *config.Task) {
+	if conf.CloudCompat != nil {
+		return
+	}
+	root, provider := cloudFolderProvider(conf)
+	if provider == "" {
+		return
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationCloudFolder,
+		TaskUuid: conf.Uuid,
+		Title:    conf.Label,
+		Message:  fmt.Sprintf(i18n.T("notification.cloud-folder"), root, provider),
+	})
+}
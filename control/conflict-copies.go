@@ -0,0 +1,151 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// maxConflictCopies is the number of suffixes tried when a conflict copy name is already taken.
+const maxConflictCopies = 100
+
+// localTarget returns the local side of the task, if it can be written.
+func (s *Syncer) localTarget() (model.Endpoint, model.PathSyncTarget, error) {
+	local := model.Endpoint(s.task.Source)
+	if !strings.HasPrefix(local.GetEndpointInfo().URI, "fs://") {
+		local = s.task.Target
+	}
+	if !strings.HasPrefix(local.GetEndpointInfo().URI, "fs://") {
+		return nil, nil, fmt.Errorf("task has no local folder")
+	}
+	target, ok := model.AsPathSyncTarget(local)
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot write to %s", local.GetEndpointInfo().URI)
+	}
+	return local, target, nil
+}
+
+// keepBoth renames the local version of a conflicting file to a copy named after this device and the current
+// date, then downloads the remote version. The copy is uploaded by the following sync loop, and the pair is recorded
+// in the node metadata so that the user can later keep one of them.
+func (s *Syncer) keepBoth(ctx context.Context, p string) error {
+	local, target, e := s.localTarget()
+	if e != nil {
+		return e
+	}
+	now := time.Now()
+	device := config.Default().DeviceName
+	var copyPath string
+	for n := 1; n <= maxConflictCopies; n++ {
+		candidate := endpoint.ConflictCopyName(p, device, now, n)
+		if _, er := local.LoadNode(ctx, candidate); er != nil {
+			copyPath = candidate
+			break
+		}
+	}
+	if copyPath == "" {
+		return fmt.Errorf("cannot find a free name for the conflict copy of %s", p)
+	}
+	if e := target.MoveNode(ctx, p, copyPath); e != nil {
+		return e
+	}
+	if e := s.resolveConflict(ctx, &ConflictResolution{Path: p, Keep: ActionKeepRemote}); e != nil {
+		return e
+	}
+	if s.nodeMeta != nil {
+		s.nodeMeta.Set(p, endpoint.MetaConflictCopy, copyPath)
+		s.nodeMeta.Set(copyPath, endpoint.MetaConflictOf, p)
+	}
+	s.publishConflictCopies()
+	PublishNotification(&common.Notification{
+		Type:      NotificationConflictCopy,
+		TaskUuid:  s.uuid,
+		Path:      p,
+		Suggested: copyPath,
+		Title:     s.label,
+		Message:   fmt.Sprintf(i18n.T("notification.conflict-copy"), path.Base(copyPath)),
+		Actions: []*common.NotificationAction{
+			{Id: ActionKeepOriginal, Label: i18n.T("notification.conflict-copy.keep-original")},
+			{Id: ActionKeepCopy, Label: i18n.T("notification.conflict-copy.keep-copy")},
+		},
+	})
+	return nil
+}
+
+// resolveConflictCopy keeps either the original file, deleting its conflict copy, or the copy, which replaces
+// the original.
+func (s *Syncer) resolveConflictCopy(ctx context.Context, r *ConflictResolution) error {
+	if r.Copy == "" {
+		return fmt.Errorf("missing conflict copy path")
+	}
+	_, target, e := s.localTarget()
+	if e != nil {
+		return e
+	}
+	switch r.Keep {
+	case ActionKeepOriginal:
+		if e := target.DeleteNode(ctx, r.Copy); e != nil {
+			return e
+		}
+	case ActionKeepCopy:
+		if e := target.DeleteNode(ctx, r.Path); e != nil {
+			return e
+		}
+		if e := target.MoveNode(ctx, r.Copy, r.Path); e != nil {
+			return e
+		}
+	}
+	if s.nodeMeta != nil {
+		s.nodeMeta.Set(r.Path, endpoint.MetaConflictCopy, "")
+		s.nodeMeta.Delete(r.Copy)
+	}
+	s.publishConflictCopies()
+	return nil
+}
+
+// publishConflictCopies refreshes the list of conflict pairs in the task state.
+func (s *Syncer) publishConflictCopies() {
+	if s.nodeMeta == nil {
+		return
+	}
+	copies, e := s.nodeMeta.Query(endpoint.MetaConflictOf, "")
+	if e != nil {
+		return
+	}
+	var list []*common.ConflictCopy
+	for c, original := range copies {
+		list = append(list, &common.ConflictCopy{Path: "/" + strings.TrimLeft(original, "/"), Copy: c})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	GetBus().Pub(s.stateStore.UpdateConflictCopies(list), TopicState)
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// maxMergeSize is the size above which files are not merged, and their base version not kept.
+const maxMergeSize = 10 * 1024 * 1024
+
+// mergeBasePath returns the file keeping the version of the last sync of a file handled by a merge driver.
+func (s *Syncer) mergeBasePath(p string) string {
+	sum := sha1.Sum([]byte(strings.Trim(p, "/")))
+	return filepath.Join(s.configPath, "merge-base", hex.EncodeToString(sum[:]))
+}
+
+// saveMergeBase stores the synced version of a file, written to a temporary file then moved in place.
+func (s *Syncer) saveMergeBase(p string, data []byte) error {
+	target := s.mergeBasePath(p)
+	if e := os.MkdirAll(filepath.Dir(target), 0755); e != nil {
+		return e
+	}
+	if e := ioutil.WriteFile(target+".tmp", data, 0600); e != nil {
+		return e
+	}
+	return os.Rename(target+".tmp", target)
+}
+
+// readContent reads a file of an endpoint, failing if it is larger than maxMergeSize.
+func readContent(ep model.Endpoint, p string) ([]byte, error) {
+	source, ok := model.AsDataSyncSource(ep)
+	if !ok {
+		return nil, fmt.Errorf("cannot read data from %s", ep.GetEndpointInfo().URI)
+	}
+	reader, e := source.GetReaderOn(p)
+	if e != nil {
+		return nil, e
+	}
+	defer reader.Close()
+	data, e := ioutil.ReadAll(io.LimitReader(reader, maxMergeSize+1))
+	if e != nil {
+		return nil, e
+	}
+	if len(data) > maxMergeSize {
+		return nil, fmt.Errorf("%s is too large to be merged", p)
+	}
+	return data, nil
+}
+
+// writeContent replaces a file of an endpoint.
+func writeContent(ctx context.Context, ep model.Endpoint, p string, data []byte) error {
+	target, ok := model.AsDataSyncTarget(ep)
+	if !ok {
+		return fmt.Errorf("cannot write data to %s", ep.GetEndpointInfo().URI)
+	}
+	writer, writeDone, writeErr, e := target.GetWriterOn(ctx, p, int64(len(data)))
+	if e != nil {
+		return e
+	}
+	return writeContents(writer, writeDone, writeErr, bytes.NewReader(data))
+}
+
+// recordMergeBases keeps a copy of the files handled by a merge driver once they are synced, to be used as base
+// of the next merge. Copies follow moves and are removed with the files.
+func (s *Syncer) recordMergeBases(ctx context.Context, patch merger.Patch) {
+	if s.conf == nil || len(s.conf.MergeDrivers) == 0 {
+		return
+	}
+	local, _, e := s.localTarget()
+	if e != nil {
+		return
+	}
+	var updated []string
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile, merger.OpMoveFile, merger.OpDelete}, func(operation merger.Operation) {
+		p := operation.GetRefPath()
+		if operation.Error() != nil || (mergeDriverFor(s.conf, p) == nil && operation.Type() != merger.OpMoveFile) {
+			return
+		}
+		switch operation.Type() {
+		case merger.OpDelete:
+			os.Remove(s.mergeBasePath(p))
+		case merger.OpMoveFile:
+			from := s.mergeBasePath(operation.GetMoveOriginPath())
+			if mergeDriverFor(s.conf, p) == nil {
+				os.Remove(from)
+			} else if os.Rename(from, s.mergeBasePath(p)) != nil {
+				updated = append(updated, p)
+			}
+		default:
+			updated = append(updated, p)
+		}
+	})
+	if len(updated) == 0 {
+		return
+	}
+	go func() {
+		for _, p := range updated {
+			data, e := readContent(local, p)
+			if e == nil {
+				e = s.saveMergeBase(p, data)
+			}
+			if e != nil {
+				log.Logger(ctx).Debug("Cannot keep merge base of " + p + ": " + e.Error())
+				os.Remove(s.mergeBasePath(p))
+			}
+		}
+	}()
+}
+
+// mergeConflict resolves a conflict with the merge driver matching the file, if any. The merged version is
+// written locally then copied to the other side. It returns false if the file must be resolved otherwise.
+func (s *Syncer) mergeConflict(ctx context.Context, p string) (bool, error) {
+	driver := mergeDriverFor(s.conf, p)
+	if driver == nil {
+		return false, nil
+	}
+	local, _, e := s.localTarget()
+	if e != nil {
+		return false, e
+	}
+	remote := model.Endpoint(s.task.Target)
+	if remote == local {
+		remote = s.task.Source
+	}
+	localData, e := readContent(local, p)
+	if e != nil {
+		return false, e
+	}
+	remoteData, e := readContent(remote, p)
+	if e != nil {
+		return false, e
+	}
+	base, _ := ioutil.ReadFile(s.mergeBasePath(p))
+	merged, ok, e := runMergeDriver(ctx, driver, p, base, localData, remoteData, s.owner)
+	if !ok || e != nil {
+		return false, e
+	}
+	if e := writeContent(ctx, local, p, merged); e != nil {
+		return false, e
+	}
+	if e := s.resolveConflict(ctx, &ConflictResolution{Path: p, Keep: ActionKeepLocal}); e != nil {
+		return false, e
+	}
+	if e := s.saveMergeBase(p, merged); e != nil {
+		log.Logger(ctx).Debug("Cannot keep merge base of " + p + ": " + e.Error())
+	}
+	return true, nil
+}
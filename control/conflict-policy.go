@@ -0,0 +1,343 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// ConflictPolicyAsk notifies conflicts and waits for the user to resolve them.
+	ConflictPolicyAsk = "ask"
+	// ConflictPolicyNewest keeps the version modified last. Modification times come from the clocks of two
+	// machines: versions modified within conflictClockSkew of each other cannot be ordered and are notified.
+	ConflictPolicyNewest = "newest"
+	// ConflictPolicyKeepEdit restores a file deleted on one side while it was modified on the other.
+	ConflictPolicyKeepEdit = "keep-edit"
+	// ConflictPolicyKeepDeletion deletes a file modified on one side while it was deleted on the other.
+	ConflictPolicyKeepDeletion = "keep-deletion"
+)
+
+// conflictClockSkew is the tolerated difference between the clocks of this machine and of the server, when
+// comparing modification times.
+const conflictClockSkew = 2 * time.Minute
+
+// errClockSkew is returned by conflictWinner when both versions are too close in time to find the newest one.
+var errClockSkew = fmt.Errorf("both versions were modified within %s, cannot tell which one is newer", conflictClockSkew)
+
+// Kinds of conflicts, each one can have its own policy in the task ConflictDefaults.
+const (
+	ConflictKindCreate     = "create"
+	ConflictKindUpdate     = "update"
+	ConflictKindDeleteEdit = "delete-edit"
+)
+
+// conflictInfo is implemented by the conflict operations of the merger.
+type conflictInfo interface {
+	ConflictInfo() (t merger.ConflictType, left merger.Operation, right merger.Operation)
+}
+
+// pendingConflict is a conflict of a patch, with its kind when the merger describes it.
+type pendingConflict struct {
+	path string
+	kind string
+}
+
+// handleConflicts resolves the conflicts between versions that only differ by their byte order mark, merges the
+// conflicting files handled by a merge driver, then applies the task conflict policy for the kind of each other
+// conflict of a patch. With the default policy, or if an automatic resolution fails, conflicts are notified to the
+// user. Automatic decisions are recorded in the audit log. Resolutions run in background, and the task does not
+// sync until they are done.
+func (s *Syncer) handleConflicts(ctx context.Context, patch merger.Patch) {
+	var conflicts []*pendingConflict
+	patch.WalkOperations([]merger.OperationType{merger.OpConflict}, func(operation merger.Operation) {
+		conflicts = append(conflicts, &pendingConflict{path: operation.GetRefPath(), kind: operationConflictKind(operation)})
+	})
+	if len(conflicts) == 0 {
+		return
+	}
+	s.resolveInBackground(ctx, func() bool {
+		var resolved int
+		var failed []string
+		for _, c := range conflicts {
+			p := c.path
+			if s.bomOnlyConflict(ctx, p) {
+				keep, e := s.conflictWinner(ctx, ConflictPolicyNewest, p)
+				if e == errClockSkew {
+					// Both versions have the same text, any of them will do
+					keep, e = ActionKeepLocal, nil
+				}
+				if e == nil {
+					e = s.resolveConflict(ctx, &ConflictResolution{Path: p, Keep: keep})
+				}
+				if e == nil {
+					log.Logger(ctx).Info("Both versions of " + p + " only differ by their byte order mark, kept the newest one")
+					resolved++
+					continue
+				}
+				log.Logger(ctx).Error("Cannot resolve conflict on " + p + ": " + e.Error())
+			}
+			if merged, e := s.mergeConflict(ctx, p); merged {
+				log.Logger(ctx).Info("Merged both versions of " + p)
+				resolved++
+				continue
+			} else if e != nil {
+				log.Logger(ctx).Error("Cannot merge " + p + ", resolving conflict otherwise: " + e.Error())
+			}
+			kind := c.kind
+			if kind == "" {
+				kind = s.conflictKind(ctx, p)
+			}
+			policy, rule := s.conflictPolicy(kind)
+			if policy == ConflictPolicyAsk {
+				failed = append(failed, p)
+				continue
+			}
+			keep, e := s.conflictWinner(ctx, policy, p)
+			if e == nil {
+				if keep == ConflictPolicyKeepDeletion {
+					e = s.deleteConflicting(ctx, p)
+				} else {
+					e = s.resolveConflict(ctx, &ConflictResolution{Path: p, Keep: keep})
+				}
+			}
+			decision := fmt.Sprintf("%s conflict: %s (%s)", kind, keep, rule)
+			s.auditConflictDecision(ctx, p, decision, e)
+			if e != nil {
+				log.Logger(ctx).Error("Cannot resolve " + kind + " conflict on " + p + " with " + rule + ": " + e.Error())
+				failed = append(failed, p)
+				continue
+			}
+			log.Logger(ctx).Info("Resolved conflict on " + p + ", " + decision)
+			resolved++
+		}
+		if len(failed) > 0 {
+			notifyConflictPaths(s.uuid, s.label, failed)
+		}
+		return resolved > 0
+	})
+}
+
+// bomOnlyConflict checks if both versions of a conflicting file have the same text, and only differ by the
+// byte order mark added or removed by an editor. Such conflicts would otherwise come back on each save.
+func (s *Syncer) bomOnlyConflict(ctx context.Context, p string) bool {
+	local, _, e := s.localTarget()
+	if e != nil {
+		return false
+	}
+	remote := model.Endpoint(s.task.Target)
+	if remote == local {
+		remote = s.task.Source
+	}
+	localNode, e := local.LoadNode(ctx, p)
+	if e != nil || !localNode.IsLeaf() || localNode.GetSize() > endpoint.MaxBOMCompareSize {
+		return false
+	}
+	remoteNode, e := remote.LoadNode(ctx, p)
+	// Byte order marks are 2 to 4 bytes long
+	if diff := localNode.GetSize() - remoteNode.GetSize(); e != nil || diff < -4 || diff > 4 {
+		return false
+	}
+	localData, e := readContent(local, p)
+	if e != nil {
+		return false
+	}
+	remoteData, e := readContent(remote, p)
+	if e != nil {
+		return false
+	}
+	return endpoint.BOMOnlyChange(localData, remoteData)
+}
+
+// operationConflictKind tells if a conflict of the merger opposes two creations, two modifications, or a deletion
+// and a modification. It returns an empty kind if the operation does not describe both sides.
+func operationConflictKind(operation merger.Operation) string {
+	info, ok := operation.(conflictInfo)
+	if !ok {
+		return ""
+	}
+	_, left, right := info.ConflictInfo()
+	if left == nil || right == nil {
+		return ""
+	}
+	switch {
+	case left.Type() == merger.OpDelete || right.Type() == merger.OpDelete:
+		return ConflictKindDeleteEdit
+	case left.Type() == merger.OpCreateFile && right.Type() == merger.OpCreateFile:
+		return ConflictKindCreate
+	}
+	return ConflictKindUpdate
+}
+
+// conflictKind guesses the kind of a conflict from the current state of both sides: a file missing on one side
+// was deleted while the other side modified it.
+func (s *Syncer) conflictKind(ctx context.Context, p string) string {
+	localExists, remoteExists, e := s.conflictSides(ctx, p)
+	if e == nil && localExists != remoteExists {
+		return ConflictKindDeleteEdit
+	}
+	return ConflictKindUpdate
+}
+
+// conflictSides tells on which sides a conflicting file still exists.
+func (s *Syncer) conflictSides(ctx context.Context, p string) (localExists, remoteExists bool, e error) {
+	local, _, e := s.localTarget()
+	if e != nil {
+		return false, false, e
+	}
+	remote := model.Endpoint(s.task.Target)
+	if remote == local {
+		remote = s.task.Source
+	}
+	_, le := local.LoadNode(ctx, p)
+	_, re := remote.LoadNode(ctx, p)
+	return le == nil, re == nil, nil
+}
+
+// conflictPolicy returns the policy applying to a kind of conflict, and the setting it comes from.
+func (s *Syncer) conflictPolicy(kind string) (policy string, rule string) {
+	if s.conf == nil {
+		return ConflictPolicyAsk, "default"
+	}
+	if d := s.conf.ConflictDefaults; d != nil {
+		switch {
+		case kind == ConflictKindCreate && d.Create != "":
+			return d.Create, "ConflictDefaults.Create"
+		case kind == ConflictKindUpdate && d.Update != "":
+			return d.Update, "ConflictDefaults.Update"
+		case kind == ConflictKindDeleteEdit && d.DeleteEdit != "":
+			return d.DeleteEdit, "ConflictDefaults.DeleteEdit"
+		}
+	}
+	if s.conf.ConflictPolicy != "" {
+		return s.conf.ConflictPolicy, "ConflictPolicy"
+	}
+	if s.conf.File != "" {
+		// A single file changes often on both sides: keep both versions rather than blocking the next saves
+		return ActionKeepBoth, "single file task"
+	}
+	return ConflictPolicyAsk, "default"
+}
+
+// deleteConflicting removes the local or remote version of a file deleted on the other side.
+func (s *Syncer) deleteConflicting(ctx context.Context, p string) error {
+	local, _, e := s.localTarget()
+	if e != nil {
+		return e
+	}
+	target := model.Endpoint(s.task.Target)
+	if target == local {
+		target = s.task.Source
+	}
+	if _, e := local.LoadNode(ctx, p); e == nil {
+		target = local
+	}
+	writer, ok := model.AsPathSyncTarget(target)
+	if !ok {
+		return fmt.Errorf("cannot write to %s", target.GetEndpointInfo().URI)
+	}
+	if e := writer.DeleteNode(ctx, p); e != nil {
+		return e
+	}
+	if s.nodeMeta != nil {
+		s.nodeMeta.Set(p, endpoint.MetaConflict, "")
+	}
+	return nil
+}
+
+// auditConflictDecision records an automatic conflict resolution in the audit log of the task.
+func (s *Syncer) auditConflictDecision(ctx context.Context, p string, decision string, err error) {
+	if s.audit == nil {
+		return
+	}
+	record := &endpoint.AuditRecord{
+		Time:     time.Now(),
+		Task:     s.uuid,
+		Path:     "/" + strings.TrimLeft(p, "/"),
+		Action:   auditAction(merger.OpConflict),
+		Result:   endpoint.AuditResultResolved,
+		Decision: decision,
+	}
+	if err != nil {
+		record.Result = endpoint.AuditResultError
+		record.Error = err.Error()
+	}
+	if e := s.audit.Append([]*endpoint.AuditRecord{record}); e != nil {
+		log.Logger(ctx).Error("Cannot write audit log: " + e.Error())
+	}
+}
+
+// conflictWinner translates a policy into the resolution of one conflict. Deletion policies return
+// ConflictPolicyKeepDeletion, or the side holding the edited file.
+func (s *Syncer) conflictWinner(ctx context.Context, policy string, p string) (string, error) {
+	switch policy {
+	case ActionKeepBoth, ActionKeepLocal, ActionKeepRemote:
+		return policy, nil
+	case ConflictPolicyKeepEdit, ConflictPolicyKeepDeletion:
+		localExists, remoteExists, e := s.conflictSides(ctx, p)
+		if e != nil {
+			return "", e
+		}
+		if localExists == remoteExists {
+			return "", fmt.Errorf("%s only applies to files deleted on one side", policy)
+		}
+		if policy == ConflictPolicyKeepDeletion {
+			return policy, nil
+		}
+		if localExists {
+			return ActionKeepLocal, nil
+		}
+		return ActionKeepRemote, nil
+	case ConflictPolicyNewest:
+		local, _, e := s.localTarget()
+		if e != nil {
+			return "", e
+		}
+		remote := model.Endpoint(s.task.Target)
+		if remote == local {
+			remote = s.task.Source
+		}
+		localNode, e := local.LoadNode(ctx, p)
+		if e != nil {
+			return "", e
+		}
+		remoteNode, e := remote.LoadNode(ctx, p)
+		if e != nil {
+			return "", e
+		}
+		delta := time.Duration(localNode.GetMTime()-remoteNode.GetMTime()) * time.Second
+		if delta < conflictClockSkew && delta > -conflictClockSkew {
+			return "", errClockSkew
+		}
+		if delta > 0 {
+			return ActionKeepLocal, nil
+		}
+		return ActionKeepRemote, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %s", policy)
+}
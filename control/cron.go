@@ -0,0 +1,203 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+// cronSchedule is a parsed 5-field cron expression: minute, hour, day of month, month and day of week, in
+// local time. Each field is a bitset of the allowed values.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// Set when day of month or day of week is restricted, as cron matches either of them if both are
+	anyDay, anyWeekday bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+var cronMonths = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+var cronWeekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// parseCron parses a cron expression like "0 2 * * *" (every day at 02:00) or "*/30 8-18 * * mon-fri". Fields
+// accept *, values, ranges, steps and lists, months and week days accept their three-letter names. The @hourly,
+// @daily, @weekly and @monthly macros are also supported.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+	c := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var e error
+	if c.minutes, e = parseCronField(fields[0], 0, 59, nil); e != nil {
+		return nil, e
+	}
+	if c.hours, e = parseCronField(fields[1], 0, 23, nil); e != nil {
+		return nil, e
+	}
+	if c.days, e = parseCronField(fields[2], 1, 31, nil); e != nil {
+		return nil, e
+	}
+	if c.months, e = parseCronField(fields[3], 1, 12, cronMonths); e != nil {
+		return nil, e
+	}
+	if c.weekdays, e = parseCronField(fields[4], 0, 7, cronWeekdays); e != nil {
+		return nil, e
+	}
+	// 7 is also Sunday
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if v, ok := names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+		return strconv.Atoi(s)
+	}
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, e := strconv.Atoi(part[i+1:])
+			if e != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			step, part = s, part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			var e1, e2 error
+			if i := strings.Index(part, "-"); i >= 0 {
+				lo, e1 = value(part[:i])
+				hi, e2 = value(part[i+1:])
+			} else if lo, e1 = value(part); step == 1 {
+				hi = lo
+			}
+			if e1 != nil || e2 != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron field %q is out of range %d-%d", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	if !c.anyDay && !c.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// next returns the first time strictly after t matching the schedule, or a zero time if there is none within
+// five years (e.g. for February 30th).
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// runCron triggers a sync loop on the cron schedule of the task, and reports the last and next runs in its state.
+func (s *Syncer) runCron(done chan bool) {
+	if s.conf == nil || s.conf.Cron == "" || s.conf.Manual {
+		return
+	}
+	ctx := s.serviceCtx
+	schedule, e := parseCron(s.conf.Cron)
+	if e != nil {
+		log.Logger(ctx).Error("Ignoring task schedule: " + e.Error())
+		return
+	}
+	var last time.Time
+	next := schedule.next(config.GetClock().Now())
+	if next.IsZero() {
+		log.Logger(ctx).Error("Task schedule " + s.conf.Cron + " never runs")
+		return
+	}
+	GetBus().Pub(s.stateStore.UpdateSchedule(last, next), TopicState)
+	ticker := config.GetClock().NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			now := config.GetClock().Now()
+			if now.Before(next) {
+				continue
+			}
+			if s.taskPaused {
+				log.Logger(ctx).Info("Skipping scheduled sync, task is paused")
+			} else if s.isStarted() {
+				log.Logger(ctx).Info("Starting scheduled sync")
+				GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+				last = now
+			}
+			next = schedule.next(now)
+			GetBus().Pub(s.stateStore.UpdateSchedule(last, next), TopicState)
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseCron checks the expressions accepted for task schedules.
+func TestParseCron(t *testing.T) {
+	cases := []struct {
+		expr  string
+		valid bool
+	}{
+		{"0 2 * * *", true},
+		{"*/30 8-18 * * mon-fri", true},
+		{"0 0 * JAN,jul sun", true},
+		{"1,2,3 * * * 7", true},
+		{"5/15 * * * *", true},
+		{"@DAILY", true},
+		{" @weekly ", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"a * * * *", false},
+		{"* * * foo *", false},
+		{"@yearly", false},
+	}
+	for _, c := range cases {
+		if _, e := parseCron(c.expr); (e == nil) != c.valid {
+			t.Errorf("%q: expected valid=%v, got %v", c.expr, c.valid, e)
+		}
+	}
+}
+
+// TestCronNext checks the next run computed from a given time.
+func TestCronNext(t *testing.T) {
+	// January 1st, 2024 is a Monday
+	date := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2024, month, day, hour, min, sec, 0, time.UTC)
+	}
+	cases := []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"0 2 * * *", date(1, 1, 10, 30, 0), date(1, 2, 2, 0, 0)},
+		{"*/30 8-18 * * mon-fri", date(1, 1, 10, 30, 0), date(1, 1, 11, 0, 0)},
+		{"*/30 8-18 * * mon-fri", date(1, 5, 18, 45, 0), date(1, 8, 8, 0, 0)},
+		{"@hourly", date(1, 1, 10, 30, 0), date(1, 1, 11, 0, 0)},
+		{"@monthly", date(1, 1, 10, 30, 0), date(2, 1, 0, 0, 0)},
+		{"0 0 * * 7", date(1, 1, 10, 30, 0), date(1, 7, 0, 0, 0)},
+		{"15 10 * * *", date(1, 1, 10, 14, 59), date(1, 1, 10, 15, 0)},
+		{"15 10 * * *", date(1, 1, 10, 15, 30), date(1, 2, 10, 15, 0)},
+		{"5/15 * * * *", date(1, 1, 10, 30, 0), date(1, 1, 10, 35, 0)},
+		// Day of month or day of week, as both are restricted
+		{"0 9 13 * fri", date(1, 1, 10, 30, 0), date(1, 5, 9, 0, 0)},
+		{"0 9 13 * fri", date(1, 12, 10, 30, 0), date(1, 13, 9, 0, 0)},
+		{"0 12 29 feb *", date(3, 1, 0, 0, 0), time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", date(1, 1, 0, 0, 0), time.Time{}},
+	}
+	for _, c := range cases {
+		schedule, e := parseCron(c.expr)
+		if e != nil {
+			t.Fatalf("%q: %v", c.expr, e)
+		}
+		if next := schedule.next(c.from); !next.Equal(c.expected) {
+			t.Errorf("%q from %s: expected %s, got %s", c.expr, c.from, c.expected, next)
+		}
+	}
+}
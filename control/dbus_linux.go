@@ -0,0 +1,203 @@
+// +build linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	dbusName      = "com.pydio.CellsSync"
+	dbusPath      = dbus.ObjectPath("/com/pydio/CellsSync")
+	dbusInterface = "com.pydio.CellsSync"
+	dbusIntro     = `
+<node>
+	<interface name="` + dbusInterface + `">
+		<method name="ListTasks">
+			<arg direction="out" type="s"/>
+		</method>
+		<method name="Pause">
+			<arg direction="in" type="s"/>
+		</method>
+		<method name="Resume">
+			<arg direction="in" type="s"/>
+		</method>
+		<method name="RecentFiles">
+			<arg direction="in" type="s"/>
+			<arg direction="in" type="i"/>
+			<arg direction="out" type="as"/>
+		</method>
+		<signal name="StateChanged">
+			<arg type="s"/>
+			<arg type="s"/>
+		</signal>
+	</interface>` + introspect.IntrospectDataString + `</node>`
+)
+
+// DBusTask is the JSON representation of a task returned by the ListTasks method.
+type DBusTask struct {
+	Uuid      string
+	Label     string
+	Status    string
+	Connected bool
+}
+
+// DBusService is a supervisor service exposing tasks on the session bus.
+type DBusService struct {
+	sync.Mutex
+	ctx    context.Context
+	conn   *dbus.Conn
+	done   chan bool
+	states map[string]common.SyncState
+}
+
+// NewDBusService creates a new DBusService.
+func NewDBusService() *DBusService {
+	ctx := servicecontext.WithServiceName(context.Background(), "dbus")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &DBusService{
+		ctx:    ctx,
+		done:   make(chan bool, 1),
+		states: make(map[string]common.SyncState),
+	}
+}
+
+// ListTasks returns a JSON-encoded list of tasks with their status.
+func (d *DBusService) ListTasks() (string, *dbus.Error) {
+	d.Lock()
+	var tasks []*DBusTask
+	for _, s := range d.states {
+		t := &DBusTask{
+			Uuid:      s.UUID,
+			Status:    common.StatusLabel(s.Status),
+			Connected: s.LeftInfo != nil && s.RightInfo != nil && s.LeftInfo.Connected && s.RightInfo.Connected,
+		}
+		if s.Config != nil {
+			t.Label = s.Config.Label
+		}
+		tasks = append(tasks, t)
+	}
+	d.Unlock()
+	data, e := json.Marshal(tasks)
+	if e != nil {
+		return "", dbus.MakeFailedError(e)
+	}
+	return string(data), nil
+}
+
+// Pause pauses one task, or all tasks if uuid is empty.
+func (d *DBusService) Pause(uuid string) *dbus.Error {
+	d.sendCmd(uuid, MessagePause)
+	return nil
+}
+
+// Resume resumes one task, or all tasks if uuid is empty.
+func (d *DBusService) Resume(uuid string) *dbus.Error {
+	d.sendCmd(uuid, MessageResume)
+	return nil
+}
+
+// RecentFiles lists the paths of files recently transferred by a task.
+func (d *DBusService) RecentFiles(uuid string, limit int32) ([]string, *dbus.Error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	var paths []string
+	for _, f := range loadRecentFiles(uuid, int(limit)) {
+		paths = append(paths, f.Path)
+	}
+	return paths, nil
+}
+
+func (d *DBusService) sendCmd(uuid string, cmd int) {
+	if uuid != "" {
+		go GetBus().Pub(cmd, TopicSync_+uuid)
+	} else {
+		go GetBus().Pub(cmd, TopicSyncAll)
+	}
+}
+
+// Serve implements supervisor service interface.
+func (d *DBusService) Serve() {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		log.Logger(d.ctx).Info("D-Bus session bus is not available, skipping: " + err.Error())
+		<-d.done
+		return
+	}
+	reply, err := conn.RequestName(dbusName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		log.Logger(d.ctx).Error("Cannot acquire D-Bus name " + dbusName)
+		<-d.done
+		return
+	}
+	d.conn = conn
+	conn.Export(d, dbusPath, dbusInterface)
+	conn.Export(introspect.Introspectable(dbusIntro), dbusPath, "org.freedesktop.DBus.Introspectable")
+	log.Logger(d.ctx).Info("Exposing tasks on D-Bus as " + dbusName)
+
+	bus := GetBus()
+	states := bus.Sub(TopicState)
+	defer func() {
+		bus.Unsub(states, TopicState)
+		conn.ReleaseName(dbusName)
+	}()
+	go bus.Pub(MessagePublishState, TopicSyncAll)
+	for {
+		select {
+		case s := <-states:
+			state, ok := s.(common.SyncState)
+			if !ok {
+				break
+			}
+			d.Lock()
+			prev, hasPrev := d.states[state.UUID]
+			if state.Status == model.TaskStatusRemoved {
+				delete(d.states, state.UUID)
+			} else {
+				d.states[state.UUID] = state
+			}
+			d.Unlock()
+			if !hasPrev || prev.Status != state.Status {
+				conn.Emit(dbusPath, dbusInterface+".StateChanged", state.UUID, common.StatusLabel(state.Status))
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (d *DBusService) Stop() {
+	log.Logger(d.ctx).Info("Stopping D-Bus service")
+	d.done <- true
+}
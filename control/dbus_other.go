@@ -0,0 +1,42 @@
+// +build !linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+// DBusService is a no-op outside of linux.
+type DBusService struct {
+	done chan bool
+}
+
+// NewDBusService creates a new DBusService.
+func NewDBusService() *DBusService {
+	return &DBusService{done: make(chan bool, 1)}
+}
+
+// Serve implements supervisor service interface.
+func (d *DBusService) Serve() {
+	<-d.done
+}
+
+// Stop implements supervisor service interface.
+func (d *DBusService) Stop() {
+	d.done <- true
+}
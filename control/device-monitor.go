@@ -0,0 +1,317 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// unlinkStopTimeout is the time given to the tasks of a revoked account to stop before their local
+	// folders are wiped. Folders of tasks that did not stop are left untouched.
+	unlinkStopTimeout = 2 * time.Minute
+	// defaultDevicesApiPath is the devices API expected on the servers, see config.Devices.
+	defaultDevicesApiPath = "/a/sync-devices"
+)
+
+// DeviceInfo is sent to the servers to register this device.
+type DeviceInfo struct {
+	DeviceId   string
+	DeviceName string
+	Platform   string
+	Version    string
+	LastSeen   time.Time
+	TasksCount int
+}
+
+// RevocationStatus is returned by the server when checking if this device is still allowed to sync.
+type RevocationStatus struct {
+	Revoked bool
+	// Wipe asks to delete the local copies of the synced data, see config.Devices to keep them.
+	Wipe bool
+	// Workspaces restricts the wipe to some workspaces slugs. Empty means all.
+	Workspaces []string
+}
+
+// DeviceMonitor is a supervisor service registering this device on each server (name, platform, version,
+// last-seen), and polling the servers to detect if the device or session was revoked by an administrator.
+// In that case, it stops and removes the tasks, optionally wipes the local data, and purges the tokens.
+type DeviceMonitor struct {
+	ctx         context.Context
+	done        chan bool
+	interval    time.Duration
+	unsupported map[string]bool
+}
+
+// NewDeviceMonitor creates a new DeviceMonitor service.
+func NewDeviceMonitor() *DeviceMonitor {
+	ctx := servicecontext.WithServiceName(context.Background(), "devices")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorRest)
+	return &DeviceMonitor{
+		ctx:         ctx,
+		done:        make(chan bool, 1),
+		interval:    15 * time.Minute,
+		unsupported: make(map[string]bool),
+	}
+}
+
+// Serve implements supervisor service interface.
+func (r *DeviceMonitor) Serve() {
+	r.checkAll()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.checkAll()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (r *DeviceMonitor) Stop() {
+	log.Logger(r.ctx).Info("Stopping device monitor")
+	r.done <- true
+}
+
+func (r *DeviceMonitor) checkAll() {
+	conf := config.Default()
+	for _, a := range conf.Authorities {
+		if r.unsupported[a.Id] {
+			continue
+		}
+		if e := r.register(a, conf); e != nil {
+			log.Logger(r.ctx).Debug("Cannot register device on " + a.Id + ": " + e.Error())
+		}
+		if r.unsupported[a.Id] {
+			continue
+		}
+		status, e := r.check(a, conf.DeviceId, true)
+		if e != nil {
+			log.Logger(r.ctx).Debug("Cannot check revocation status for " + a.Id + ": " + e.Error())
+			continue
+		}
+		if status != nil && status.Revoked {
+			r.unlink(a, status)
+		}
+	}
+}
+
+// register creates or updates this device on the server. It acts as a heartbeat for the last-seen date.
+func (r *DeviceMonitor) register(a *config.Authority, conf *config.Global) error {
+	info := &DeviceInfo{
+		DeviceId:   conf.DeviceId,
+		DeviceName: conf.DeviceName,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Version:    common.Version,
+		LastSeen:   time.Now(),
+		TasksCount: len(conf.TasksForAuthority(a)),
+	}
+	data, e := json.Marshal(info)
+	if e != nil {
+		return e
+	}
+	req, e := a.NewAuthenticatedRequest("PUT", devicesApiPath()+"/"+url.PathEscape(conf.DeviceId), bytes.NewReader(data))
+	if e != nil {
+		return e
+	}
+	resp, e := a.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// Server does not support devices management, do not ask again
+		r.unsupported[a.Id] = true
+		return nil
+	default:
+		return fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+}
+
+// devicesApiPath returns the path of the devices API on the servers.
+func devicesApiPath() string {
+	if d := config.Default().Devices; d != nil && d.ApiPath != "" {
+		return "/" + strings.Trim(d.ApiPath, "/")
+	}
+	return defaultDevicesApiPath
+}
+
+// check asks the server if this device was revoked. A revoked device has its session revoked too, so a rejected
+// session is also a revocation, once a token refresh ruled out an expired token. It is only trusted for servers
+// that already answered a revocation check, other servers just get the error.
+func (r *DeviceMonitor) check(a *config.Authority, deviceId string, retry bool) (*RevocationStatus, error) {
+	req, e := a.NewAuthenticatedRequest("GET", devicesApiPath()+"/"+url.PathEscape(deviceId)+"/revocation", nil)
+	if e != nil {
+		return nil, e
+	}
+	resp, e := a.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var status RevocationStatus
+		if e := json.NewDecoder(resp.Body).Decode(&status); e != nil {
+			return nil, e
+		}
+		if !a.DevicesManaged {
+			a.DevicesManaged = true
+			if e := config.Save(); e != nil {
+				log.Logger(r.ctx).Error("Cannot save devices management status for " + a.Id + ": " + e.Error())
+			}
+		}
+		return &status, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if retry {
+			if e := a.Refresh(); e == nil {
+				return r.check(a, deviceId, false)
+			} else if !a.Reachable() {
+				return nil, e
+			}
+		}
+		if !a.DevicesManaged {
+			return nil, fmt.Errorf("server rejected the session with status %d", resp.StatusCode)
+		}
+		log.Logger(r.ctx).Warn(fmt.Sprintf("Server rejected the session of this device with status %d", resp.StatusCode))
+		return &RevocationStatus{Revoked: true, Wipe: true}, nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// Server does not support devices management, do not ask again
+		r.unsupported[a.Id] = true
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+}
+
+// unlink stops and removes all tasks using this authority, optionally wipes their local folders, and
+// finally removes the authority and its tokens. Local folders are only touched once their task has confirmed
+// it is stopped and removed.
+func (r *DeviceMonitor) unlink(a *config.Authority, status *RevocationStatus) {
+	log.Logger(r.ctx).Warn("Access for this device was revoked by the administrator of " + a.URI + ", unlinking account")
+	conf := config.Default()
+	wipes := make(map[string]string)
+	bus := GetBus()
+	states := bus.Sub(TopicState)
+	defer bus.Unsub(states, TopicState)
+	for _, t := range conf.TasksForAuthority(a) {
+		if status.Wipe {
+			if localPath, ok := r.wipeTarget(a, t, status.Workspaces); ok {
+				wipes[t.Uuid] = localPath
+			}
+		}
+		if e := conf.RemoveTask(t); e != nil {
+			log.Logger(r.ctx).Error("Cannot remove task " + t.Label + ": " + e.Error())
+			delete(wipes, t.Uuid)
+		}
+	}
+	if e := conf.RemoveAuthority(a); e != nil {
+		log.Logger(r.ctx).Error("Cannot remove account " + a.Id + ": " + e.Error())
+	}
+	if len(wipes) == 0 {
+		return
+	}
+	timeout := time.After(unlinkStopTimeout)
+	for len(wipes) > 0 {
+		select {
+		case m := <-states:
+			state, ok := m.(common.SyncState)
+			if !ok || state.Status != model.TaskStatusRemoved {
+				break
+			}
+			if localPath, ok := wipes[state.UUID]; ok {
+				delete(wipes, state.UUID)
+				r.wipe(localPath)
+			}
+		case <-timeout:
+			for _, localPath := range wipes {
+				log.Logger(r.ctx).Error("Task using " + localPath + " did not stop, leaving its local copy untouched")
+			}
+			return
+		}
+	}
+}
+
+// wipe deletes a revoked local folder. It is first renamed, so that nothing syncs it anymore while it is being
+// deleted. If config.Devices.KeepRevokedData is set, the renamed folder is kept.
+func (r *DeviceMonitor) wipe(localPath string) {
+	target := localPath + ".revoked-" + time.Now().Format("20060102-150405")
+	if e := os.Rename(localPath, target); e != nil {
+		log.Logger(r.ctx).Error("Cannot move " + localPath + ": " + e.Error())
+		return
+	}
+	if d := config.Default().Devices; d != nil && d.KeepRevokedData {
+		log.Logger(r.ctx).Warn("Moved local copy " + localPath + " to " + target)
+		return
+	}
+	log.Logger(r.ctx).Warn("Deleting local copy " + localPath)
+	if e := os.RemoveAll(target); e != nil {
+		log.Logger(r.ctx).Error("Cannot delete " + target + ": " + e.Error())
+	}
+}
+
+// wipeTarget finds the local folder of a task, if its remote side is inside one of the workspaces.
+func (r *DeviceMonitor) wipeTarget(a *config.Authority, t *config.Task, workspaces []string) (string, bool) {
+	localURI, remoteURI := t.LeftURI, t.RightURI
+	if a.MatchesURI(localURI) {
+		localURI, remoteURI = remoteURI, localURI
+	}
+	localPath, ok := endpoint.LocalPathForURI(localURI)
+	if !ok || localPath == "" || localPath == string(filepath.Separator) {
+		return "", false
+	}
+	if len(workspaces) == 0 {
+		return localPath, true
+	}
+	u, e := url.Parse(remoteURI)
+	if e != nil {
+		return "", false
+	}
+	slug := strings.Split(strings.Trim(u.Path, "/"), "/")[0]
+	for _, w := range workspaces {
+		if w == slug {
+			return localPath, true
+		}
+	}
+	return "", false
+}
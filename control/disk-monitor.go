@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+)
+
+// NotificationDiskSpace warns that the local volume of a task is running out of space.
+const NotificationDiskSpace = "disk-space"
+
+const (
+	diskSpaceOK = iota
+	diskSpaceLow
+	diskSpacePaused
+)
+
+// DiskMonitor is a supervisor service measuring the free space of the local volumes hosting synced folders. The
+// user is warned when it goes below the warning threshold of a task, and again when downloads are paused below
+// the pause threshold. Once space is freed, a sync loop is triggered to download the pending files.
+type DiskMonitor struct {
+	ctx      context.Context
+	done     chan bool
+	interval time.Duration
+	levels   map[string]int
+}
+
+// NewDiskMonitor creates a new DiskMonitor service.
+func NewDiskMonitor() *DiskMonitor {
+	ctx := servicecontext.WithServiceName(context.Background(), "disk-space")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &DiskMonitor{
+		ctx:      ctx,
+		done:     make(chan bool, 1),
+		interval: time.Minute,
+		levels:   make(map[string]int),
+	}
+}
+
+// Serve implements supervisor service interface.
+func (d *DiskMonitor) Serve() {
+	d.check()
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.check()
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (d *DiskMonitor) Stop() {
+	log.Logger(d.ctx).Info("Stopping disk space monitor")
+	d.done <- true
+}
+
+// check measures the free space of each task local folder, and notifies the changes of level.
+func (d *DiskMonitor) check() {
+	conf := config.Default()
+	for _, t := range conf.Tasks {
+		root, ok := endpoint.LocalPathForURI(t.LeftURI)
+		if !ok {
+			if root, ok = endpoint.LocalPathForURI(t.RightURI); !ok {
+				continue
+			}
+		}
+		free, e := endpoint.FreeSpace(root)
+		if e != nil {
+			continue
+		}
+		thresholds := conf.DiskSpaceFor(t)
+		level := diskSpaceOK
+		if pause := thresholds.PauseBytes(); pause > 0 && free < pause {
+			level = diskSpacePaused
+		} else if warn := thresholds.WarnBytes(); warn > 0 && free < warn {
+			level = diskSpaceLow
+		}
+		previous := d.levels[t.Uuid]
+		d.levels[t.Uuid] = level
+		if level == previous {
+			continue
+		}
+		var message string
+		switch {
+		case level == diskSpacePaused:
+			message = fmt.Sprintf(i18n.T("notification.disk-space.paused"), root, FormatSize(int64(free)))
+		case level == diskSpaceLow && previous == diskSpaceOK:
+			message = fmt.Sprintf(i18n.T("notification.disk-space.low"), root, FormatSize(int64(free)))
+		case previous == diskSpacePaused:
+			message = fmt.Sprintf(i18n.T("notification.disk-space.resumed"), root)
+			go GetBus().Pub(MessageSyncLoop, TopicSync_+t.Uuid)
+		default:
+			continue
+		}
+		log.Logger(d.ctx).Warn(message)
+		PublishNotification(&common.Notification{
+			Type:     NotificationDiskSpace,
+			TaskUuid: t.Uuid,
+			Title:    t.Label,
+			Message:  message,
+		})
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const driftReportFile = "drift-report.json"
+
+// DriftReport lists the differences found between both sides of a task in audit mode, i.e. what a sync would
+// change.
+type DriftReport struct {
+	Checked    time.Time
+	Direction  string
+	LeftNodes  int
+	RightNodes int
+	OnlyLeft   []string `json:",omitempty"`
+	OnlyRight  []string `json:",omitempty"`
+	Different  []string `json:",omitempty"`
+	Error      string   `json:",omitempty"`
+}
+
+// Drift returns the number of differing paths.
+func (d *DriftReport) Drift() int {
+	return len(d.OnlyLeft) + len(d.OnlyRight) + len(d.Different)
+}
+
+// String implements Stringer interface.
+func (d *DriftReport) String() string {
+	if d.Drift() == 0 {
+		return fmt.Sprintf("No drift between both sides (%d nodes)", d.LeftNodes)
+	}
+	return fmt.Sprintf("Drift found: %d only on the left, %d only on the right, %d different", len(d.OnlyLeft), len(d.OnlyRight), len(d.Different))
+}
+
+// auditOnly checks if the task only reports the drift between both sides, without ever syncing them.
+func (s *Syncer) auditOnly() bool {
+	return s.conf != nil && s.conf.AuditOnly
+}
+
+// run starts a sync pass. Tasks in audit mode only compare both sides instead.
+func (s *Syncer) run(ctx context.Context, force bool) {
+	if s.auditOnly() {
+		go s.checkDrift(ctx)
+		return
+	}
+	s.task.Run(ctx, false, force)
+}
+
+// checkDrift walks both sides of the task and compares them. The report is stored with the task, and the user is
+// notified when the drift changed since the previous check.
+func (s *Syncer) checkDrift(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&s.driftRunning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.driftRunning, 0)
+	GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Comparing both sides"), model.TaskStatusProcessing), TopicState)
+	setRunning(s.uuid, true)
+	defer setRunning(s.uuid, false)
+
+	keep := endpoint.FilterMatcher(taskRoots(s.conf.SelectiveRoots, s.conf.File), s.ignores)
+	report := &DriftReport{Checked: time.Now(), Direction: s.conf.Direction}
+	var left, right map[string]*tree.Node
+	var leftErr, rightErr error
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		left, leftErr = driftWalk(s.task.Source, "/", keep)
+	}()
+	go func() {
+		defer wg.Done()
+		right, rightErr = driftWalk(s.task.Target, "/", keep)
+	}()
+	wg.Wait()
+	if leftErr != nil {
+		report.Error = leftErr.Error()
+	} else if rightErr != nil {
+		report.Error = rightErr.Error()
+	} else {
+		compareDrift(report, left, right)
+	}
+
+	previous := loadDriftReport(s.uuid)
+	if e := saveDriftReport(s.uuid, report); e != nil {
+		log.Logger(ctx).Error("Cannot save drift report: " + e.Error())
+	}
+	if report.Error != "" {
+		msg := "Cannot compare both sides: " + report.Error
+		log.Logger(ctx).Error(msg)
+		GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusError), TopicState)
+		return
+	}
+	log.Logger(ctx).Info(report.String())
+	GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(report.String()), model.TaskStatusIdle), TopicState)
+	if previous != nil && previous.Error == "" && previous.Drift() == report.Drift() {
+		return
+	}
+	message := fmt.Sprintf(i18n.T("notification.drift"), report.Drift())
+	if report.Drift() == 0 {
+		if previous == nil {
+			return
+		}
+		message = i18n.T("notification.drift.none")
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationDrift,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  message,
+	})
+}
+
+// driftWalk lists the nodes of one side of the task under root accepted by keep.
+func driftWalk(ep model.Endpoint, root string, keep func(string) bool) (map[string]*tree.Node, error) {
+	source, ok := model.AsPathSyncSource(ep)
+	if !ok {
+		return nil, fmt.Errorf("cannot walk %s", ep.GetEndpointInfo().URI)
+	}
+	nodes := make(map[string]*tree.Node)
+	e := source.Walk(func(p string, node *tree.Node, err error) {
+		p = strings.Trim(p, "/")
+		if err != nil || p == "" || !keep(p) {
+			return
+		}
+		nodes[p] = node
+	}, root, true)
+	return nodes, e
+}
+
+// compareDrift fills the report with the paths existing on one side only, and the paths whose type, size or
+// content differ. Contents are compared when both sides provide comparable hashes.
+func compareDrift(report *DriftReport, left, right map[string]*tree.Node) {
+	report.LeftNodes, report.RightNodes = len(left), len(right)
+	for p, l := range left {
+		r, ok := right[p]
+		if !ok {
+			report.OnlyLeft = append(report.OnlyLeft, p)
+			continue
+		}
+		if l.IsLeaf() != r.IsLeaf() {
+			report.Different = append(report.Different, p)
+			continue
+		}
+		if !l.IsLeaf() {
+			continue
+		}
+		if l.GetSize() != r.GetSize() {
+			report.Different = append(report.Different, p)
+			continue
+		}
+		le, re := strings.Trim(l.GetEtag(), "\""), strings.Trim(r.GetEtag(), "\"")
+		if driftComparable(le) && driftComparable(re) && le != re {
+			report.Different = append(report.Different, p)
+		}
+	}
+	for p := range right {
+		if _, ok := left[p]; !ok {
+			report.OnlyRight = append(report.OnlyRight, p)
+		}
+	}
+	sort.Strings(report.OnlyLeft)
+	sort.Strings(report.OnlyRight)
+	sort.Strings(report.Different)
+}
+
+// driftComparable checks that an etag is a plain MD5 of the content: multipart and temporary etags cannot be
+// compared across endpoints.
+func driftComparable(etag string) bool {
+	return len(etag) == 32 && !strings.Contains(etag, "-")
+}
+
+func loadDriftReport(syncUUID string) *DriftReport {
+	data, e := ioutil.ReadFile(filepath.Join(taskDataPath(syncUUID), driftReportFile))
+	if e != nil {
+		return nil
+	}
+	var report DriftReport
+	if json.Unmarshal(data, &report) != nil {
+		return nil
+	}
+	return &report
+}
+
+func saveDriftReport(syncUUID string, report *DriftReport) error {
+	data, e := json.MarshalIndent(report, "", "  ")
+	if e != nil {
+		return e
+	}
+	dir := taskDataPath(syncUUID)
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return e
+	}
+	return ioutil.WriteFile(filepath.Join(dir, driftReportFile), data, 0644)
+}
+
+// getDriftReport returns the last drift report of a task in audit mode.
+func (h *HttpServer) getDriftReport(c *gin.Context) {
+	report := loadDriftReport(c.Param("uuid"))
+	if report == nil {
+		h.writeError(c, fmt.Errorf("no drift report for task %s", c.Param("uuid")))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
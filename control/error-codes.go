@@ -0,0 +1,171 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+// Error codes sent to the UI along with their parameters, so that messages can be translated and linked to
+// the documentation. Params are listed next to each code.
+const (
+	ErrorCodePathLimit       = "path-limit"       // path, reason
+	ErrorCodeReadOnly        = "read-only"        // path
+	ErrorCodeQuarantined     = "quarantined"      // path, reason
+	ErrorCodeAccessDenied    = "access-denied"    // path
+	ErrorCodeUnauthorized    = "unauthorized"     // path
+	ErrorCodeThrottled       = "throttled"        // path
+	ErrorCodeMaintenance     = "maintenance"      // path, until
+	ErrorCodeNotFound        = "not-found"        // path
+	ErrorCodeLocalPermission = "local-permission" // path
+	ErrorCodeDiskFull        = "disk-full"        // path
+	ErrorCodeNetwork         = "network"          // path
+	ErrorCodeSourceChanged   = "source-changed"   // path
+	ErrorCodeFileBusy        = "file-busy"        // path, reason
+	ErrorCodeRemoteLocked    = "remote-locked"    // path, user
+	ErrorCodeUnknown         = "unknown"          // path, message
+
+	// maxErrorCodes is the number of distinct errors kept in the task state
+	maxErrorCodes = 10
+)
+
+// errorInfo converts an error into a machine-readable code and parameters. The original message is kept for
+// logs and for clients that do not know the code.
+func errorInfo(e error, p string) *common.ErrorInfo {
+	info := &common.ErrorInfo{Code: ErrorCodeUnknown, Params: []string{p, e.Error()}, Message: e.Error(), Count: 1}
+	cause := errors.Cause(e)
+	if u, ok := cause.(*url.Error); ok {
+		// Errors returned by the transport are wrapped by the HTTP client
+		if m, ok := u.Err.(*endpoint.MaintenanceError); ok {
+			cause = m
+		}
+	}
+	switch c := cause.(type) {
+	case *endpoint.PathViolation:
+		info.Code, info.Params = ErrorCodePathLimit, []string{c.Path, c.Reason}
+		return info
+	case *endpoint.QuarantineError:
+		info.Code, info.Params = ErrorCodeQuarantined, []string{c.Path, c.Reason}
+		return info
+	case *endpoint.MaintenanceError:
+		info.Code, info.Params = ErrorCodeMaintenance, []string{p, c.Until.Format("15:04:05")}
+		return info
+	case *endpoint.SourceChangedError:
+		info.Code, info.Params = ErrorCodeSourceChanged, []string{c.Path}
+		return info
+	case *endpoint.FileBusyError:
+		info.Code, info.Params = ErrorCodeFileBusy, []string{c.Path, c.Reason}
+		return info
+	case *endpoint.LowDiskSpaceError:
+		info.Code, info.Params = ErrorCodeDiskFull, []string{c.Path}
+		return info
+	case *endpoint.NodeLockedError:
+		info.Code, info.Params = ErrorCodeRemoteLocked, []string{c.Path, c.LockedBy}
+		return info
+	case net.Error:
+		info.Code, info.Params = ErrorCodeNetwork, []string{p}
+		return info
+	}
+	msg := strings.ToLower(cause.Error())
+	switch {
+	case cause == endpoint.ErrReadOnly:
+		info.Code = ErrorCodeReadOnly
+	case isDiskFull(cause):
+		info.Code = ErrorCodeDiskFull
+	case os.IsPermission(cause):
+		info.Code = ErrorCodeLocalPermission
+	case os.IsNotExist(cause) || strings.Contains(msg, "404") || strings.Contains(msg, "not found"):
+		info.Code = ErrorCodeNotFound
+	case isForbidden(cause):
+		info.Code = ErrorCodeAccessDenied
+	case strings.Contains(msg, "401") || strings.Contains(msg, "unauthorized"):
+		info.Code = ErrorCodeUnauthorized
+	case strings.Contains(msg, "429") || strings.Contains(msg, "too many requests"):
+		info.Code = ErrorCodeThrottled
+	case strings.Contains(msg, "connection refused") || strings.Contains(msg, "no such host") || strings.Contains(msg, "timeout"):
+		info.Code = ErrorCodeNetwork
+	default:
+		return info
+	}
+	info.Params = []string{p}
+	return info
+}
+
+// isDiskFull checks if an error was caused by a full local disk.
+func isDiskFull(e error) bool {
+	switch c := e.(type) {
+	case *os.PathError:
+		return c.Err == syscall.ENOSPC
+	case *os.LinkError:
+		return c.Err == syscall.ENOSPC
+	}
+	return e == syscall.ENOSPC
+}
+
+// patchErrors groups the errors of a patch by code, keeping the parameters of the first occurrence. If a registry
+// is passed, occurrences are recorded and snoozed errors are left out.
+func patchErrors(patch merger.Patch, registry *errorRegistry) []*common.ErrorInfo {
+	byCode := make(map[string]*common.ErrorInfo)
+	add := func(e error, p string) {
+		info := errorInfo(e, p)
+		if registry != nil && !registry.observe(info) {
+			return
+		}
+		if existing, ok := byCode[info.Code]; ok {
+			existing.Count++
+			return
+		}
+		byCode[info.Code] = info
+	}
+	patch.WalkOperations([]merger.OperationType{}, func(operation merger.Operation) {
+		if e := operation.Error(); e != nil {
+			add(e, operation.GetRefPath())
+		}
+	})
+	if len(byCode) == 0 {
+		if errs, ok := patch.HasErrors(); ok {
+			for _, e := range errs {
+				add(e, "")
+			}
+		}
+	}
+	var infos []*common.ErrorInfo
+	for _, info := range byCode {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Count > infos[j].Count
+	})
+	if len(infos) > maxErrorCodes {
+		infos = infos[:maxErrorCodes]
+	}
+	return infos
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+)
+
+const (
+	// DefaultSnoozeDays is the number of days an error is hidden when the user snoozes it
+	DefaultSnoozeDays = 7
+
+	// errorLogInterval is the minimum delay between two log lines for the same error
+	errorLogInterval = 10 * time.Minute
+	// errorNotifyInterval is the minimum delay between two notifications for the same error
+	errorNotifyInterval = 24 * time.Hour
+	// errorRecordsTTL is the time after which an error that was not seen again is forgotten
+	errorRecordsTTL = 30 * 24 * time.Hour
+)
+
+// variableParts matches numbers and hashes in error messages, which often differ between identical errors
+// (request ids, byte offsets, ports...).
+var variableParts = regexp.MustCompile(`[0-9a-fA-F]{8,}|[0-9]+`)
+
+// errorRecord keeps track of all occurrences of an error with the same fingerprint.
+type errorRecord struct {
+	Code         string
+	Path         string
+	Message      string
+	Count        int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	Notified     time.Time  `json:"Notified,omitempty"`
+	SnoozedUntil *time.Time `json:"SnoozedUntil,omitempty"`
+}
+
+func (r *errorRecord) snoozed() bool {
+	return r.SnoozedUntil != nil && time.Now().Before(*r.SnoozedUntil)
+}
+
+// logEntry tracks log lines that were suppressed since the last time a message was logged.
+type logEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// errorRegistry deduplicates the errors of a task by fingerprint. It counts occurrences across sync passes,
+// throttles logs and notifications, and remembers errors snoozed by the user. Records are persisted in the
+// task configuration folder.
+type errorRegistry struct {
+	sync.Mutex
+	file    string
+	records map[string]*errorRecord
+	logs    map[string]*logEntry
+}
+
+// newErrorRegistry loads the registry stored in the task configuration folder.
+func newErrorRegistry(configPath string) *errorRegistry {
+	r := &errorRegistry{
+		file:    filepath.Join(configPath, "errors.json"),
+		records: make(map[string]*errorRecord),
+		logs:    make(map[string]*logEntry),
+	}
+	if data, e := ioutil.ReadFile(r.file); e == nil {
+		json.Unmarshal(data, &r.records)
+	}
+	return r
+}
+
+// errorFingerprint computes a stable identifier for an error from its code, its path and its message, ignoring
+// the numbers that vary between occurrences.
+func errorFingerprint(info *common.ErrorInfo) string {
+	var p string
+	if len(info.Params) > 0 {
+		p = info.Params[0]
+	}
+	msg := variableParts.ReplaceAllString(strings.ToLower(info.Message), "#")
+	return fmt.Sprintf("%x", md5.Sum([]byte(info.Code+"\x00"+p+"\x00"+msg)))[:12]
+}
+
+// observe records an occurrence of an error and sets its fingerprint. It returns false if the error is snoozed.
+func (r *errorRegistry) observe(info *common.ErrorInfo) bool {
+	info.Fingerprint = errorFingerprint(info)
+	r.Lock()
+	defer r.Unlock()
+	rec, ok := r.records[info.Fingerprint]
+	if !ok {
+		rec = &errorRecord{Code: info.Code, Message: info.Message, FirstSeen: time.Now()}
+		if len(info.Params) > 0 {
+			rec.Path = info.Params[0]
+		}
+		r.records[info.Fingerprint] = rec
+	}
+	rec.Count++
+	rec.LastSeen = time.Now()
+	info.Occurrences = rec.Count
+	return !rec.snoozed()
+}
+
+// shouldNotify returns true if a notification was not already sent recently for this error, and if the error
+// is not snoozed.
+func (r *errorRegistry) shouldNotify(fingerprint string) bool {
+	r.Lock()
+	defer r.Unlock()
+	rec, ok := r.records[fingerprint]
+	if !ok {
+		return true
+	}
+	if rec.snoozed() || time.Since(rec.Notified) < errorNotifyInterval {
+		return false
+	}
+	rec.Notified = time.Now()
+	return true
+}
+
+// shouldLog returns true if the message was not logged recently, along with the number of identical messages
+// that were suppressed since the last time.
+func (r *errorRegistry) shouldLog(msg string) (bool, int) {
+	key := variableParts.ReplaceAllString(msg, "#")
+	r.Lock()
+	defer r.Unlock()
+	entry, ok := r.logs[key]
+	if !ok {
+		r.logs[key] = &logEntry{logged: time.Now()}
+		return true, 0
+	}
+	if time.Since(entry.logged) < errorLogInterval {
+		entry.suppressed++
+		return false, 0
+	}
+	suppressed := entry.suppressed
+	entry.logged, entry.suppressed = time.Now(), 0
+	return true, suppressed
+}
+
+// snooze hides an error for the given number of days. If a path is given, all errors on this path are snoozed.
+// It returns the number of snoozed errors.
+func (r *errorRegistry) snooze(fingerprint string, p string, days int) (count int) {
+	if days <= 0 {
+		days = DefaultSnoozeDays
+	}
+	until := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	r.Lock()
+	for fp, rec := range r.records {
+		if fp == fingerprint || (p != "" && rec.Path == p) {
+			rec.SnoozedUntil = &until
+			count++
+		}
+	}
+	r.Unlock()
+	return
+}
+
+// filter removes snoozed errors from a list.
+func (r *errorRegistry) filter(infos []*common.ErrorInfo) (filtered []*common.ErrorInfo) {
+	r.Lock()
+	defer r.Unlock()
+	for _, info := range infos {
+		if rec, ok := r.records[info.Fingerprint]; ok && rec.snoozed() {
+			continue
+		}
+		filtered = append(filtered, info)
+	}
+	return
+}
+
+// save forgets old errors and writes the registry to disk.
+func (r *errorRegistry) save() error {
+	r.Lock()
+	for fp, rec := range r.records {
+		if time.Since(rec.LastSeen) > errorRecordsTTL && !rec.snoozed() {
+			delete(r.records, fp)
+		}
+	}
+	data, e := json.Marshal(r.records)
+	r.Unlock()
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(r.file, data, 0644)
+}
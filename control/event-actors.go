@@ -0,0 +1,52 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// setupActorTracking records the processes changing files on the local endpoints, if enabled for the task.
+// Failures are only logged, as tracking requires privileges that the agent may not have.
+func (s *Syncer) setupActorTracking(ctx context.Context, left, right model.Endpoint) {
+	if !s.conf.TrackActors {
+		return
+	}
+	for _, ep := range []model.Endpoint{left, right} {
+		if e := endpoint.EnableActorTracking(ep); e != nil {
+			log.Logger(ctx).Error("Cannot track the processes changing local files: " + e.Error())
+			continue
+		}
+		s.tracked = append(s.tracked, ep)
+	}
+}
+
+// stopActorTracking releases the platform resources used to track processes.
+func (s *Syncer) stopActorTracking() {
+	for _, ep := range s.tracked {
+		endpoint.DisableActorTracking(ep)
+	}
+	s.tracked = nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+// TaskLatency describes the event latencies of the local folder of a task.
+type TaskLatency struct {
+	TaskUuid string
+	Label    string
+	Root     string
+	endpoint.EventLatency
+	Watcher endpoint.WatcherMetrics
+}
+
+// recordLatencies closes the latency measures of the local events applied by a patch.
+func (s *Syncer) recordLatencies(patch merger.Patch) {
+	for _, uri := range []string{s.conf.LeftURI, s.conf.RightURI} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok {
+			continue
+		}
+		var paths []string
+		patch.WalkOperations([]merger.OperationType{}, func(operation merger.Operation) {
+			paths = append(paths, operation.GetRefPath())
+			if operation.Type() == merger.OpMoveFile || operation.Type() == merger.OpMoveFolder {
+				paths = append(paths, operation.GetMoveOriginPath())
+			}
+		})
+		endpoint.RecordCompleted(root, paths)
+	}
+}
+
+// taskLatencies lists the event latencies of the local folders of all tasks.
+func taskLatencies() (latencies []*TaskLatency) {
+	for _, t := range config.Default().Tasks {
+		for _, uri := range []string{t.LeftURI, t.RightURI} {
+			if root, ok := endpoint.LocalPathForURI(uri); ok {
+				latencies = append(latencies, &TaskLatency{
+					TaskUuid:     t.Uuid,
+					Label:        t.Label,
+					Root:         root,
+					EventLatency: endpoint.EventLatencyFor(root),
+					Watcher:      endpoint.WatcherMetricsFor(root),
+				})
+			}
+		}
+	}
+	return
+}
+
+// debugLatency is a debug status page showing the delays between local changes and their synchronization, and the
+// number of events waiting at each stage.
+func (h *HttpServer) debugLatency(c *gin.Context) {
+	c.JSON(http.StatusOK, taskLatencies())
+}
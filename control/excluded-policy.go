@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+const (
+	// ExcludedPolicyKeep leaves the copies of newly excluded files in place, they are just not synced anymore.
+	ExcludedPolicyKeep = "keep"
+	// ExcludedPolicyDeleteLocal removes the copies of newly excluded files from the local folders.
+	ExcludedPolicyDeleteLocal = "delete-local"
+	// ExcludedPolicyDeleteRemote removes the copies of newly excluded files from the server.
+	ExcludedPolicyDeleteRemote = "delete-remote"
+
+	appliedFiltersFile = "filters.json"
+)
+
+// appliedFilters are the filters of the task on its last start, used to find the paths excluded since then.
+type appliedFilters struct {
+	SelectiveRoots []string
+	Ignores        []string
+}
+
+// applyExcludedPolicy compares the task filters with the ones applied on the last start, and removes the copies
+// of the files that became excluded following the task policy. Excluded paths are not synced anymore, so the
+// deletions are not propagated to the other side.
+func (s *Syncer) applyExcludedPolicy(ctx context.Context, left, right model.Endpoint) {
+	file := filepath.Join(s.configPath, appliedFiltersFile)
+	current := &appliedFilters{SelectiveRoots: s.conf.SelectiveRoots, Ignores: config.Default().TaskIgnores(s.conf)}
+	defer func() {
+		if data, e := json.Marshal(current); e == nil {
+			ioutil.WriteFile(file, data, 0644)
+		}
+	}()
+	policy := s.conf.ExcludedPolicy
+	if policy == "" || policy == ExcludedPolicyKeep {
+		return
+	}
+	data, e := ioutil.ReadFile(file)
+	if e != nil {
+		return
+	}
+	var previous appliedFilters
+	if json.Unmarshal(data, &previous) != nil {
+		return
+	}
+	before, e := taskFilter(s.conf, previous.SelectiveRoots, previous.Ignores)
+	if e != nil {
+		return
+	}
+	after, e := taskFilter(s.conf, current.SelectiveRoots, current.Ignores)
+	if e != nil {
+		return
+	}
+	for uri, ep := range map[string]model.Endpoint{s.conf.LeftURI: left, s.conf.RightURI: right} {
+		root, local := endpoint.LocalPathForURI(uri)
+		if local != (policy == ExcludedPolicyDeleteLocal) {
+			continue
+		}
+		source, ok := model.AsPathSyncSource(ep)
+		if !ok {
+			continue
+		}
+		excluded := newlyExcluded(source, before, after)
+		if len(excluded) == 0 {
+			continue
+		}
+		var removed int
+		for _, p := range excluded {
+			var er error
+			if local {
+				er = os.RemoveAll(filepath.Join(root, filepath.FromSlash(p)))
+			} else if target, ok := model.AsPathSyncTarget(ep); ok {
+				er = target.DeleteNode(ctx, p)
+			} else {
+				er = fmt.Errorf("endpoint is read-only")
+			}
+			if er != nil {
+				log.Logger(ctx).Error("Cannot remove excluded path " + p + ": " + er.Error())
+				continue
+			}
+			removed++
+		}
+		log.Logger(ctx).Info(fmt.Sprintf("Removed %d paths excluded by the new filters from %s", removed, ep.GetEndpointInfo().URI))
+	}
+}
+
+// newlyExcluded walks a source for the paths accepted by the previous filters but not by the new ones. Only
+// the topmost path of an excluded tree is returned.
+func newlyExcluded(source model.PathSyncSource, before, after func(string) bool) (paths []string) {
+	source.Walk(func(p string, node *tree.Node, err error) {
+		p = strings.Trim(p, "/")
+		if err != nil || p == "" || !before(p) || after(p) {
+			return
+		}
+		paths = append(paths, p)
+	}, "/", true)
+	sort.Strings(paths)
+	var top []string
+	for _, p := range paths {
+		if len(top) > 0 && strings.HasPrefix(p, top[len(top)-1]+"/") {
+			continue
+		}
+		top = append(top, p)
+	}
+	return top
+}
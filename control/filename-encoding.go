@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pydio/cells/common/log"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// applyTranscoding renames the files of the local folders of the task whose names use a legacy encoding, before
+// they are scanned. Conflicting names are left untouched and reported.
+func (s *Syncer) applyTranscoding(ctx context.Context, keep func(string) bool) {
+	for _, uri := range []string{s.conf.LeftURI, s.conf.RightURI} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok {
+			continue
+		}
+		report, e := endpoint.PlanTranscode(root, s.conf.Encoding.Source, keep)
+		if e != nil {
+			log.Logger(ctx).Error("Cannot check file names encoding in " + root + ": " + e.Error())
+			continue
+		}
+		if len(report.Renames) == 0 {
+			continue
+		}
+		applied, errs := endpoint.ApplyTranscode(root, report)
+		for _, er := range errs {
+			log.Logger(ctx).Error("Cannot rename file: " + er.Error())
+		}
+		msg := fmt.Sprintf("Renamed %d files with a legacy encoding in %s", len(applied), root)
+		if skipped := len(report.Renames) - len(applied) - len(errs); skipped > 0 {
+			msg += fmt.Sprintf(", %d skipped as the new name already exists", skipped)
+		}
+		log.Logger(ctx).Info(msg)
+	}
+}
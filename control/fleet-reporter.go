@@ -0,0 +1,225 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// fleetDefaultInterval is the interval between two pushes to the fleet collector.
+const fleetDefaultInterval = 15 * time.Minute
+
+// FleetReport is the JSON payload posted to the fleet collector.
+type FleetReport struct {
+	DeviceId   string
+	DeviceName string
+	Hostname   string
+	Platform   string
+	Version    string
+	BuildStamp string
+	Stamp      time.Time
+	Tasks      []*FleetTask
+}
+
+// FleetTask is the summary of one task in a FleetReport. Runs, Processed, Conflicts and Errors are counted since
+// the previous push.
+type FleetTask struct {
+	Uuid        string
+	Label       string
+	Status      string
+	Connected   bool
+	LastSync    time.Time
+	LastSuccess time.Time `json:"LastSuccess,omitempty"`
+	Runs        int
+	Processed   int
+	Conflicts   int
+	Errors      int
+	// KnownErrors is the number of distinct errors currently reported by the task
+	KnownErrors int
+}
+
+// FleetReporter is a supervisor service pushing tasks summaries to a fleet collector.
+type FleetReporter struct {
+	ctx   context.Context
+	conf  *config.Fleet
+	done  chan bool
+	tasks map[string]*FleetTask
+}
+
+// NewFleetReporter creates a new FleetReporter service.
+func NewFleetReporter(conf *config.Fleet) *FleetReporter {
+	ctx := servicecontext.WithServiceName(context.Background(), "fleet")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &FleetReporter{
+		ctx:   ctx,
+		conf:  conf,
+		done:  make(chan bool, 1),
+		tasks: make(map[string]*FleetTask),
+	}
+}
+
+// task returns the summary of a task, creating it if required.
+func (f *FleetReporter) task(uuid string) *FleetTask {
+	t, ok := f.tasks[uuid]
+	if !ok {
+		t = &FleetTask{Uuid: uuid}
+		f.tasks[uuid] = t
+	}
+	return t
+}
+
+// updateState refreshes a task summary from its state. Paths never leave the device, labels of private tasks are
+// masked, their states already are.
+func (f *FleetReporter) updateState(s common.SyncState) {
+	if s.Status == model.TaskStatusRemoved {
+		delete(f.tasks, s.UUID)
+		return
+	}
+	t := f.task(s.UUID)
+	t.Status = common.StatusLabel(s.Status)
+	t.Connected = s.LeftInfo != nil && s.RightInfo != nil && s.LeftInfo.Connected && s.RightInfo.Connected
+	t.LastSync = s.LastSyncTime
+	t.KnownErrors = len(s.Errors)
+	if s.Config != nil {
+		t.Label = s.Config.Label
+		if s.Config.Privacy {
+			t.Label = maskPath(t.Label)
+		}
+	}
+}
+
+// addReport counts a sync pass.
+func (f *FleetReporter) addReport(r *PatchReport) {
+	t := f.task(r.TaskUuid)
+	t.Runs++
+	t.Processed += r.Processed
+	t.Conflicts += r.Conflicts
+	t.Errors += r.Errors
+	if r.Errors == 0 {
+		t.LastSuccess = r.Stamp
+	}
+}
+
+// report builds the payload and resets the counters.
+func (f *FleetReporter) report() *FleetReport {
+	conf := config.Default()
+	hostname, _ := os.Hostname()
+	r := &FleetReport{
+		DeviceId:   conf.DeviceId,
+		DeviceName: conf.DeviceName,
+		Hostname:   hostname,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Version:    common.Version,
+		BuildStamp: common.BuildStamp,
+		Stamp:      time.Now(),
+	}
+	for _, t := range f.tasks {
+		c := *t
+		r.Tasks = append(r.Tasks, &c)
+		t.Runs, t.Processed, t.Conflicts, t.Errors = 0, 0, 0, 0
+	}
+	return r
+}
+
+// push posts a report to the collector.
+func (f *FleetReporter) push(r *FleetReport) error {
+	data, e := json.Marshal(r)
+	if e != nil {
+		return e
+	}
+	req, e := http.NewRequest("POST", f.conf.CollectorUrl, bytes.NewReader(data))
+	if e != nil {
+		return e
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.conf.Token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, e := client.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Serve implements supervisor service interface.
+func (f *FleetReporter) Serve() {
+	if f.conf == nil || !f.conf.Enabled || f.conf.CollectorUrl == "" {
+		<-f.done
+		return
+	}
+	interval := fleetDefaultInterval
+	if f.conf.IntervalMinutes > 0 {
+		interval = time.Duration(f.conf.IntervalMinutes) * time.Minute
+	}
+	log.Logger(f.ctx).Info("Reporting tasks summaries to " + f.conf.CollectorUrl + " every " + interval.String())
+	bus := GetBus()
+	states := bus.Sub(TopicState)
+	reports := bus.Sub(TopicReport)
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+		bus.Unsub(states, TopicState)
+		bus.Unsub(reports, TopicReport)
+	}()
+	go bus.Pub(MessagePublishState, TopicSyncAll)
+	for {
+		select {
+		case m := <-states:
+			if state, ok := m.(common.SyncState); ok {
+				f.updateState(state)
+			}
+		case m := <-reports:
+			if report, ok := m.(*PatchReport); ok {
+				f.addReport(report)
+			}
+		case <-ticker.C:
+			if e := f.push(f.report()); e != nil {
+				log.Logger(f.ctx).Error("Cannot push summary to fleet collector: " + e.Error())
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (f *FleetReporter) Stop() {
+	log.Logger(f.ctx).Info("Stopping fleet reporter")
+	f.done <- true
+}
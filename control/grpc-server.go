@@ -0,0 +1,292 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/proto/control"
+	"github.com/pydio/cells/common/log"
+)
+
+// watchersBuffer is the number of messages kept for a slow gRPC stream before new ones are dropped.
+const watchersBuffer = 100
+
+// watchers fans messages out to the gRPC streams. Publishing never blocks.
+type watchers struct {
+	sync.Mutex
+	chans map[chan []byte]bool
+}
+
+func newWatchers() *watchers {
+	return &watchers{chans: make(map[chan []byte]bool)}
+}
+
+func (w *watchers) add() chan []byte {
+	w.Lock()
+	defer w.Unlock()
+	c := make(chan []byte, watchersBuffer)
+	w.chans[c] = true
+	return c
+}
+
+func (w *watchers) remove(c chan []byte) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.chans, c)
+}
+
+func (w *watchers) publish(data []byte) {
+	w.Lock()
+	defer w.Unlock()
+	for c := range w.chans {
+		select {
+		case c <- data:
+		default:
+		}
+	}
+}
+
+// grpcControl implements the SyncControl gRPC service, the strongly typed variant of the HTTP/WebSocket API
+// defined in proto/control. It is served next to the http server, on the same host.
+type grpcControl struct {
+	control.UnimplementedSyncControlServer
+	h *HttpServer
+}
+
+// serveGrpc starts the gRPC server on a free port of the host of the http server. It returns a nil server if it
+// cannot listen: the http API remains available.
+func (h *HttpServer) serveGrpc(httpAddr string) (*grpc.Server, string) {
+	host, _, e := net.SplitHostPort(httpAddr)
+	if e != nil {
+		return nil, ""
+	}
+	listener, e := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if e != nil {
+		log.Logger(h.ctx).Error("Cannot start gRPC server: " + e.Error())
+		return nil, ""
+	}
+	srv := grpc.NewServer()
+	control.RegisterSyncControlServer(srv, &grpcControl{h: h})
+	addr := listener.Addr().String()
+	log.Logger(h.ctx).Info("Starting gRPC server on " + addr)
+	go func() {
+		if e := srv.Serve(listener); e != nil && e != grpc.ErrServerStopped {
+			log.Logger(h.ctx).Error("gRPC server stopped: " + e.Error())
+		}
+	}()
+	return srv, addr
+}
+
+// protoTask converts a task for the gRPC API.
+func protoTask(t *config.Task) *control.Task {
+	data, _ := json.Marshal(t)
+	return &control.Task{
+		Uuid:       t.Uuid,
+		Label:      t.Label,
+		LeftURI:    t.LeftURI,
+		RightURI:   t.RightURI,
+		Direction:  t.Direction,
+		JsonConfig: string(data),
+	}
+}
+
+// ListTasks returns the tasks of the configuration.
+func (g *grpcControl) ListTasks(ctx context.Context, req *control.ListTasksRequest) (*control.ListTasksResponse, error) {
+	resp := &control.ListTasksResponse{}
+	for _, t := range config.Default().Tasks {
+		resp.Tasks = append(resp.Tasks, protoTask(t))
+	}
+	return resp, nil
+}
+
+// PutTask creates a task if it has no Uuid, or updates it. The full configuration is read from JsonConfig if set.
+func (g *grpcControl) PutTask(ctx context.Context, req *control.PutTaskRequest) (*control.PutTaskResponse, error) {
+	in := req.GetTask()
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing task")
+	}
+	task := &config.Task{}
+	if in.JsonConfig != "" {
+		if e := json.Unmarshal([]byte(in.JsonConfig), task); e != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid task configuration: "+e.Error())
+		}
+	} else {
+		task.Label, task.LeftURI, task.RightURI, task.Direction = in.Label, in.LeftURI, in.RightURI, in.Direction
+	}
+	task.Uuid = in.Uuid
+	cmd := "edit"
+	if task.Uuid == "" {
+		cmd = "create"
+	}
+	if e := configureTask(cmd, task); e != nil {
+		if _, conflict := e.(*config.RevisionConflictError); conflict {
+			return nil, status.Error(codes.Aborted, e.Error())
+		}
+		return nil, status.Error(codes.FailedPrecondition, e.Error())
+	}
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == task.Uuid {
+			return &control.PutTaskResponse{Task: protoTask(t)}, nil
+		}
+	}
+	return &control.PutTaskResponse{Task: protoTask(task)}, nil
+}
+
+// DeleteTask removes a task.
+func (g *grpcControl) DeleteTask(ctx context.Context, req *control.DeleteTaskRequest) (*control.DeleteTaskResponse, error) {
+	if e := configureTask("delete", &config.Task{Uuid: req.Uuid}); e != nil {
+		return nil, status.Error(codes.NotFound, e.Error())
+	}
+	return &control.DeleteTaskResponse{Success: true}, nil
+}
+
+// SendCommand sends a command to a task, or to all tasks.
+func (g *grpcControl) SendCommand(ctx context.Context, req *control.SendCommandRequest) (*control.SendCommandResponse, error) {
+	if e := sendCommand(req.TaskUuid, req.Command); e != nil {
+		return nil, status.Error(codes.InvalidArgument, e.Error())
+	}
+	return &control.SendCommandResponse{Success: true}, nil
+}
+
+// WatchStatus replays the journaled messages after LastSeq, then streams the states and notifications as they
+// are broadcast to the WebSocket clients.
+func (g *grpcControl) WatchStatus(req *control.WatchStatusRequest, stream control.SyncControl_WatchStatusServer) error {
+	h := g.h
+	live := h.statusWatchers.add()
+	defer h.statusWatchers.remove(live)
+	last := req.LastSeq
+	if last > 0 && h.journal != nil {
+		missed, _ := h.journal.Since(last)
+		for _, data := range missed {
+			if ev := statusEvent(data); ev != nil {
+				if e := stream.Send(ev); e != nil {
+					return e
+				}
+				last = ev.Seq
+			}
+		}
+	}
+	// Publish sync states, in full for the new client
+	h.diffs.reset()
+	GetBus().Pub(MessagePublishState, TopicSyncAll)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case data := <-live:
+			ev := statusEvent(data)
+			if ev == nil || (ev.Seq > 0 && ev.Seq <= last) {
+				continue
+			}
+			if e := stream.Send(ev); e != nil {
+				return e
+			}
+		}
+	}
+}
+
+// statusEvent decodes a message of the status journal.
+func statusEvent(data []byte) *control.StatusEvent {
+	var m struct {
+		Type    string
+		Seq     uint64
+		Content json.RawMessage
+	}
+	if json.Unmarshal(data, &m) != nil {
+		return nil
+	}
+	var target struct {
+		UUID     string
+		TaskUuid string
+	}
+	json.Unmarshal(m.Content, &target)
+	if target.TaskUuid == "" {
+		target.TaskUuid = target.UUID
+	}
+	return &control.StatusEvent{Seq: m.Seq, Type: m.Type, TaskUuid: target.TaskUuid, JsonContent: string(m.Content)}
+}
+
+// ListAuthorities returns the servers accounts, without their tokens.
+func (g *grpcControl) ListAuthorities(ctx context.Context, req *control.ListAuthoritiesRequest) (*control.ListAuthoritiesResponse, error) {
+	resp := &control.ListAuthoritiesResponse{}
+	for _, a := range config.Default().PublicAuthorities() {
+		resp.Authorities = append(resp.Authorities, &control.Authority{
+			Id:          a.Id,
+			URI:         a.URI,
+			ServerLabel: a.ServerLabel,
+			Username:    a.Username,
+			LoginDate:   a.LoginDate.Unix(),
+			RefreshDate: a.RefreshDate.Unix(),
+			ExpiresAt:   int64(a.ExpiresAt),
+			TokenStatus: a.TokenStatus,
+			TasksCount:  int32(a.TasksCount),
+		})
+	}
+	return resp, nil
+}
+
+// DeleteAuthority logs out from a server account.
+func (g *grpcControl) DeleteAuthority(ctx context.Context, req *control.DeleteAuthorityRequest) (*control.DeleteAuthorityResponse, error) {
+	confs := config.Default()
+	for _, a := range confs.PublicAuthorities() {
+		if a.Id == req.Id {
+			if e := confs.RemoveAuthority(a); e != nil {
+				return nil, status.Error(codes.Internal, e.Error())
+			}
+			return &control.DeleteAuthorityResponse{Success: true}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "cannot find server "+req.Id)
+}
+
+// StreamLogs sends the last lines of the logs, then follows new ones.
+func (g *grpcControl) StreamLogs(req *control.StreamLogsRequest, stream control.SyncControl_StreamLogsServer) error {
+	h := g.h
+	live := h.logWatchers.add()
+	defer h.logWatchers.remove(live)
+	recent := h.recentLogs
+	if tail := int(req.Tail); tail >= 0 && tail < len(recent) {
+		recent = recent[len(recent)-tail:]
+	}
+	for _, line := range recent {
+		if e := stream.Send(&control.LogLine{Line: string(line)}); e != nil {
+			return e
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case line := <-live:
+			if e := stream.Send(&control.LogLine{Line: string(line)}); e != nil {
+				return e
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+)
+
+// OpenTaskHistory opens the storage of the run history, audit trail and stats of a task, with the configured
+// backend and retention. Backends missing from this build fall back to BoltDB.
+func OpenTaskHistory(syncUUID string) (*endpoint.History, error) {
+	backend, retention, maxBytes := config.Default().Storage.HistoryOptions()
+	if !endpoint.HistoryBackendAvailable(backend) {
+		log.Logger(context.Background()).Warn("History backend " + backend + " is not supported by this build, using " + config.HistoryBolt)
+		backend = config.HistoryBolt
+	}
+	return endpoint.OpenHistory(taskDataPath(syncUUID), backend, retention, maxBytes)
+}
+
+// requestHistory publishes a MessagePublishHistory and waits for the sync to send back its history.
+func requestHistory(syncUUID string) *endpoint.History {
+
+	var history *endpoint.History
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	ch := GetBus().Sub(TopicHistory_ + syncUUID)
+	go func() {
+		defer func() {
+			wg.Done()
+			GetBus().Unsub(ch)
+		}()
+		select {
+		case h := <-ch:
+			history = h.(*endpoint.History)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}()
+	GetBus().Pub(MessagePublishHistory, TopicSync_+syncUUID)
+	wg.Wait()
+
+	return history
+}
+
+// readTaskAudit loads the audit log of a task from the history of the running task, or opens its history if the
+// task is not running.
+func readTaskAudit(syncUUID string, from, to time.Time) ([]*endpoint.AuditRecord, error) {
+	if history := requestHistory(syncUUID); history != nil {
+		return endpoint.ReadAudit(history, from, to)
+	}
+	history, e := OpenTaskHistory(syncUUID)
+	if e != nil {
+		return nil, e
+	}
+	defer history.Close()
+	return endpoint.ReadAudit(history, from, to)
+}
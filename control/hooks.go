@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+const (
+	HookEventDownload = "download"
+	HookEventUpload   = "upload"
+	HookEventDelete   = "delete"
+
+	hookTimeout = 5 * time.Minute
+)
+
+// hookEvent is a file event matched by a hook.
+type hookEvent struct {
+	event string
+	rel   string
+	hook  *config.Hook
+}
+
+// hookMatches checks if a hook applies to an event on a path.
+func hookMatches(h *config.Hook, event string, p string) bool {
+	if h.Event != "" && h.Event != event {
+		return false
+	}
+	if h.Pattern == "" {
+		return true
+	}
+	if strings.Contains(h.Pattern, "/") {
+		return endpoint.MatchGlob(h.Pattern, p)
+	}
+	ok, _ := path.Match(h.Pattern, path.Base(p))
+	return ok
+}
+
+// runHooks finds the file events of a patch matching the task hooks, and runs their commands sequentially
+// in background.
+func (s *Syncer) runHooks(ctx context.Context, patch merger.Patch) {
+	if s.conf == nil || len(s.conf.Hooks) == 0 {
+		return
+	}
+	root, ok := endpoint.LocalPathForURI(s.conf.LeftURI)
+	if !ok {
+		root, _ = endpoint.LocalPathForURI(s.conf.RightURI)
+	}
+	transfer := HookEventDownload
+	if strings.HasPrefix(patch.Source().GetEndpointInfo().URI, "fs://") {
+		transfer = HookEventUpload
+	}
+	var events []hookEvent
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile, merger.OpMoveFile, merger.OpDelete}, func(operation merger.Operation) {
+		if operation.Error() != nil {
+			return
+		}
+		event := transfer
+		if operation.Type() == merger.OpDelete {
+			event = HookEventDelete
+		} else if n := operation.GetNode(); n != nil && !n.IsLeaf() {
+			return
+		}
+		rel := strings.Trim(operation.GetRefPath(), "/")
+		for _, h := range s.conf.Hooks {
+			if len(h.Command) > 0 && hookMatches(h, event, rel) {
+				events = append(events, hookEvent{event: event, rel: rel, hook: h})
+			}
+		}
+	})
+	if len(events) == 0 {
+		return
+	}
+	go func() {
+		for _, ev := range events {
+			runHook(ctx, s.uuid, root, ev, s.owner)
+		}
+	}()
+}
+
+// runHook runs a hook command, replacing the placeholders of its arguments. The command runs as owner if set.
+func runHook(ctx context.Context, taskUuid string, root string, ev hookEvent, owner *endpoint.Owner) {
+	abs := filepath.Join(root, filepath.FromSlash(ev.rel))
+	replacer := strings.NewReplacer("{path}", abs, "{rel}", ev.rel, "{event}", ev.event)
+	var args []string
+	for _, a := range ev.hook.Command[1:] {
+		args = append(args, replacer.Replace(a))
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(hookCtx, ev.hook.Command[0], args...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "CELLS_SYNC_TASK="+taskUuid, "CELLS_SYNC_EVENT="+ev.event, "CELLS_SYNC_PATH="+abs)
+	endpoint.DropPrivileges(cmd, owner)
+	if out, e := cmd.CombinedOutput(); e != nil {
+		log.Logger(ctx).Error("Hook " + ev.hook.Command[0] + " failed on " + ev.rel + ": " + e.Error() + " " + strings.TrimSpace(string(out)))
+	} else {
+		log.Logger(ctx).Info("Hook " + ev.hook.Command[0] + " ran on " + ev.rel)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// CertificateRequest asks for the certificate of a server before logging in.
+type CertificateRequest struct {
+	URI string
+}
+
+// certificate returns the certificate presented by a server, so that the user can check its fingerprint
+// before it is pinned.
+func (h *HttpServer) certificate(c *gin.Context) {
+	var request CertificateRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	info, e := config.FetchCertificate(request.URI)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// advanceClock fast-forwards the simulated clock by the given duration (e.g. "90m"), when the application is
+// started in simulate mode.
+func (h *HttpServer) advanceClock(c *gin.Context) {
+	clock, ok := config.GetClock().(*config.SimulatedClock)
+	if !ok {
+		h.writeError(c, fmt.Errorf("clock can only be advanced in simulate mode"))
+		return
+	}
+	d, e := time.ParseDuration(c.Param("duration"))
+	if e != nil || d < 0 {
+		h.writeError(c, fmt.Errorf("invalid duration %s", c.Param("duration")))
+		return
+	}
+	clock.Advance(d)
+	c.JSON(http.StatusOK, gin.H{"Now": clock.Now()})
+}
@@ -40,7 +40,13 @@ func (h *HttpServer) updateConf(i *gin.Context) {
 		return
 	}
 
-	if er := config.Default().UpdateGlobals(glob.Logs, glob.Updates, glob.Debugging, glob.Service); er != nil {
+	if glob.DeviceName != "" && glob.DeviceName != config.Default().DeviceName {
+		if er := config.Default().UpdateDeviceName(glob.DeviceName); er != nil {
+			h.writeError(i, er)
+			return
+		}
+	}
+	if er := config.Default().UpdateGlobals(glob.Logs, glob.Updates, glob.Debugging, glob.Service, glob.Smtp, glob.Mqtt, glob.Activity, glob.Proxy, glob.Bandwidth, glob.Startup); er != nil {
 		h.writeError(i, er)
 	} else {
 		i.JSON(http.StatusOK, config.Default())
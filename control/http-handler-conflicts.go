@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// ConflictsRequest resolves all conflicts of a task matching an optional glob with the same strategy.
+type ConflictsRequest struct {
+	Strategy string
+	PathGlob string
+}
+
+// ConflictsResponse lists conflicting paths, or the paths submitted for resolution.
+type ConflictsResponse struct {
+	Paths []string
+}
+
+// requestNodeMeta publishes a MessagePublishMeta and waits for the sync to send back its NodeMetaStore.
+func requestNodeMeta(syncUUID string) *endpoint.NodeMetaStore {
+
+	var store *endpoint.NodeMetaStore
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	ch := GetBus().Sub(TopicMeta_ + syncUUID)
+	go func() {
+		defer func() {
+			wg.Done()
+			GetBus().Unsub(ch)
+		}()
+		select {
+		case s := <-ch:
+			store = s.(*endpoint.NodeMetaStore)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}()
+	GetBus().Pub(MessagePublishMeta, TopicSync_+syncUUID)
+	wg.Wait()
+
+	return store
+}
+
+// conflictPaths lists the paths currently flagged as conflicting in the task node metadata.
+func conflictPaths(syncUUID string, glob string) ([]string, error) {
+	store := requestNodeMeta(syncUUID)
+	if store == nil {
+		return nil, fmt.Errorf("cannot find task %s, or it is not running", syncUUID)
+	}
+	conflicts, e := store.Query(endpoint.MetaConflict, "true")
+	if e != nil {
+		return nil, e
+	}
+	paths := []string{}
+	for p := range conflicts {
+		if glob == "" || endpoint.MatchGlob(glob, p) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// listConflicts returns the conflicting paths of a task.
+func (h *HttpServer) listConflicts(c *gin.Context) {
+	paths, e := conflictPaths(c.Param("uuid"), c.Query("glob"))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, &ConflictsResponse{Paths: paths})
+}
+
+// resolveConflicts sends all matching conflicts to the task for resolution with the requested strategy.
+func (h *HttpServer) resolveConflicts(c *gin.Context) {
+	var request ConflictsRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	switch request.Strategy {
+	case ActionKeepLocal, ActionKeepRemote, ActionKeepBoth:
+	default:
+		h.writeError(c, fmt.Errorf("unknown strategy %s, use one of %s, %s or %s", request.Strategy, ActionKeepLocal, ActionKeepRemote, ActionKeepBoth))
+		return
+	}
+	uuid := c.Param("uuid")
+	paths, e := conflictPaths(uuid, request.PathGlob)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	if len(paths) > 0 {
+		go GetBus().Pub(&BulkConflictResolution{Paths: paths, Keep: request.Strategy}, TopicSync_+uuid)
+	}
+	c.JSON(http.StatusOK, &ConflictsResponse{Paths: paths})
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// maxFilterPreviewFiles is the number of files listed in each section of a filter preview
+const maxFilterPreviewFiles = 200
+
+// FilterPreviewRequest describes the filters edited on an existing task.
+type FilterPreviewRequest struct {
+	SelectiveRoots []string
+	Ignores        []string
+}
+
+// FilterPreviewFile is a file whose sync status changes with the new filters. Sides tells where it currently
+// exists ("left", "right" or "both"), and Effect what happens to it: for excluded files, "kept" if their copies
+// stay in place but are not synced anymore, or "delete-local" and "delete-remote" following the task policy.
+// For included files, "to-left" or "to-right" if they will be copied, "compare" if they exist on both sides, or
+// "none" if the task direction does not copy them.
+type FilterPreviewFile struct {
+	Path   string
+	Size   int64
+	Sides  string
+	Effect string
+}
+
+// FilterPreview lists the files excluded and included by new filters. Lists are truncated, counts are not.
+type FilterPreview struct {
+	Excluded      []*FilterPreviewFile
+	Included      []*FilterPreviewFile
+	ExcludedCount int
+	IncludedCount int
+	ExcludedBytes int64
+	IncludedBytes int64
+}
+
+// previewFilters walks both roots of a task and compares the files accepted by the current filters with the
+// files accepted by the new ones, before they are saved.
+func (h *HttpServer) previewFilters(c *gin.Context) {
+	var request FilterPreviewRequest
+	if e := c.BindJSON(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	var conf *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == c.Param("uuid") {
+			conf = t
+		}
+	}
+	if conf == nil {
+		h.writeError(c, fmt.Errorf("cannot find task"))
+		return
+	}
+	current, e := taskFilter(conf, conf.SelectiveRoots, config.Default().TaskIgnores(conf))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	edited, e := taskFilter(conf, request.SelectiveRoots, config.Default().TaskIgnores(&config.Task{Ignores: request.Ignores, FilterSets: conf.FilterSets}))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	ctx := c.Request.Context()
+	var left, right map[string]int64
+	var leftErr, rightErr error
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		left, leftErr = previewWalk(ctx, conf.LeftURI, conf.RightURI)
+	}()
+	go func() {
+		defer wg.Done()
+		right, rightErr = previewWalk(ctx, conf.RightURI, conf.LeftURI)
+	}()
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	if leftErr != nil {
+		h.writeError(c, leftErr)
+		return
+	} else if rightErr != nil {
+		h.writeError(c, rightErr)
+		return
+	}
+	c.JSON(http.StatusOK, computeFilterPreview(left, right, conf.Direction, conf.ExcludedPolicy, current, edited))
+}
+
+// taskFilter builds a function checking if a path is synced with the given selective roots and ignore patterns,
+// on top of the default ignores, the hidden files policy and the .pydio-ignore file of the local folder.
+func taskFilter(conf *config.Task, roots []string, patterns []string) (func(string) bool, error) {
+	ignores := append([]string{}, endpoint.DefaultIgnores...)
+	if conf.HiddenFiles == endpoint.HiddenFilesIgnore {
+		ignores = append(ignores, endpoint.HiddenFilesIgnores()...)
+	}
+	keep := endpoint.FilterMatcher(taskRoots(roots, conf.File), ignores)
+	var localRoot string
+	for _, uri := range []string{conf.LeftURI, conf.RightURI} {
+		if root, ok := endpoint.LocalPathForURI(uri); ok {
+			localRoot = root
+			break
+		}
+	}
+	rules, e := endpoint.NewIgnoreRules(localRoot, patterns)
+	if e != nil {
+		return nil, e
+	}
+	return func(p string) bool {
+		return keep(p) && !rules.Ignored(p, false)
+	}, nil
+}
+
+// computeFilterPreview compares the files of both sides with the current and new filters.
+func computeFilterPreview(left, right map[string]int64, direction, policy string, current, edited func(string) bool) *FilterPreview {
+	if policy == "" {
+		policy = ExcludedPolicyKeep
+	}
+	p := &FilterPreview{}
+	toRight, toLeft := direction != "Left", direction != "Right"
+	all := make(map[string]int64, len(left))
+	for k, size := range left {
+		all[k] = size
+	}
+	for k, size := range right {
+		if _, ok := all[k]; !ok {
+			all[k] = size
+		}
+	}
+	for k, size := range all {
+		before, after := current(k), edited(k)
+		if before == after {
+			continue
+		}
+		_, onLeft := left[k]
+		_, onRight := right[k]
+		f := &FilterPreviewFile{Path: "/" + k, Size: size, Sides: "both"}
+		if !onRight {
+			f.Sides = "left"
+		} else if !onLeft {
+			f.Sides = "right"
+		}
+		if before {
+			f.Effect = "kept"
+			if policy != ExcludedPolicyKeep {
+				f.Effect = policy
+			}
+			p.ExcludedCount++
+			p.ExcludedBytes += size
+			p.Excluded = append(p.Excluded, f)
+			continue
+		}
+		switch {
+		case onLeft && onRight:
+			f.Effect = "compare"
+		case onLeft && toRight:
+			f.Effect = "to-right"
+		case onRight && toLeft:
+			f.Effect = "to-left"
+		default:
+			f.Effect = "none"
+		}
+		p.IncludedCount++
+		p.IncludedBytes += size
+		p.Included = append(p.Included, f)
+	}
+	for _, l := range []*[]*FilterPreviewFile{&p.Excluded, &p.Included} {
+		files := *l
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+		if len(files) > maxFilterPreviewFiles {
+			*l = files[:maxFilterPreviewFiles]
+		}
+	}
+	return p
+}
+
+// listFilterSets lists the filter sets shared by the tasks.
+func (h *HttpServer) listFilterSets(c *gin.Context) {
+	sets := config.Default().FilterSets
+	if sets == nil {
+		sets = []*config.FilterSet{}
+	}
+	c.JSON(http.StatusOK, sets)
+}
+
+// putFilterSet creates or replaces a filter set. Tasks using it are restarted with the new filters.
+func (h *HttpServer) putFilterSet(c *gin.Context) {
+	var set config.FilterSet
+	if e := c.BindJSON(&set); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	if e := endpoint.ValidateIgnorePatterns(set.Ignores); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	if e := config.Default().UpdateFilterSet(&set); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, &set)
+}
+
+// deleteFilterSet removes a filter set that is not used by any task.
+func (h *HttpServer) deleteFilterSet(c *gin.Context) {
+	if e := config.Default().RemoveFilterSet(c.Param("name")); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.Status(http.StatusOK)
+}
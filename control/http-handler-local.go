@@ -0,0 +1,230 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+)
+
+// LocalValidationRequest asks the agent to check a local folder before using it as a task root.
+type LocalValidationRequest struct {
+	Path string
+	// Create the folder if it does not exist yet
+	Create bool
+	// RequiredBytes is the expected size of the data to download, if known
+	RequiredBytes uint64
+	// TaskUuid is the task being edited, ignored when looking for nested tasks
+	TaskUuid string
+}
+
+// LocalValidation is the result of a local folder check. Errors prevent using the folder, Warnings should be
+// confirmed by the user.
+type LocalValidation struct {
+	Path          string
+	Exists        bool
+	Created       bool
+	Writable      bool
+	FreeSpace     uint64
+	Capabilities  *common.Capabilities `json:"Capabilities,omitempty"`
+	Limits        endpoint.PathLimits
+	NestedTask    string `json:"NestedTask,omitempty"`
+	CloudProvider string `json:"CloudProvider,omitempty"`
+	Errors        []string
+	Warnings      []string
+}
+
+// validateLocal checks that a local folder can be used as a sync root, optionally creating it.
+func (h *HttpServer) validateLocal(c *gin.Context) {
+	var request LocalValidationRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	if request.Path == "" || !filepath.IsAbs(request.Path) {
+		h.writeError(c, fmt.Errorf("please provide an absolute path"))
+		return
+	}
+	c.JSON(http.StatusOK, validateLocalFolder(request))
+}
+
+// validateLocalFolder runs all checks on the requested folder.
+func validateLocalFolder(request LocalValidationRequest) *LocalValidation {
+	folder := filepath.Clean(request.Path)
+	v := &LocalValidation{Path: folder, Limits: endpoint.PlatformPathLimits(), Errors: []string{}, Warnings: []string{}}
+
+	if label := nestedTask(folder, request.TaskUuid); label != "" {
+		v.NestedTask = label
+		v.Errors = append(v.Errors, fmt.Sprintf("folder overlaps with the root of task %s", label))
+	}
+
+	dirs := config.AgentDirectories()
+	if dir := agentDirContaining(folder, dirs); dir != "" {
+		v.Errors = append(v.Errors, fmt.Sprintf("folder is inside the application folder %s", dir))
+	}
+	for _, dir := range dirs {
+		if pathContains(folder, dir) && folder != dir {
+			v.Warnings = append(v.Warnings, fmt.Sprintf("application folder %s will be excluded from the task", dir))
+		}
+	}
+
+	if st, e := os.Stat(folder); e == nil {
+		if !st.IsDir() {
+			v.Errors = append(v.Errors, "path is not a folder")
+			return v
+		}
+		v.Exists = true
+	} else if os.IsNotExist(e) && request.Create && len(v.Errors) == 0 {
+		if er := endpoint.CreateSuggestedFolder(folder); er != nil {
+			v.Errors = append(v.Errors, er.Error())
+			return v
+		}
+		v.Exists = true
+		v.Created = true
+	} else if !os.IsNotExist(e) {
+		v.Errors = append(v.Errors, e.Error())
+		return v
+	}
+
+	// Checks on the folder itself, or on its closest existing parent
+	probe := folder
+	for !v.Exists {
+		parent := filepath.Dir(probe)
+		if parent == probe {
+			break
+		}
+		probe = parent
+		if _, e := os.Stat(probe); e == nil {
+			break
+		}
+	}
+	v.Writable = !endpoint.IsReadOnlyFolder(probe)
+	if !v.Writable {
+		v.Errors = append(v.Errors, "folder is not writable")
+	}
+	if free, e := endpoint.FreeSpace(probe); e == nil {
+		v.FreeSpace = free
+		if request.RequiredBytes > 0 && free < request.RequiredBytes {
+			v.Errors = append(v.Errors, fmt.Sprintf("not enough free space: %d bytes required, %d available", request.RequiredBytes, free))
+		}
+	}
+	if v.Exists && v.Writable {
+		if caps, e := endpoint.ProbeLocalCapabilities(folder); e == nil {
+			v.Capabilities = caps
+			if !caps.CaseSensitive {
+				v.Warnings = append(v.Warnings, "filesystem is not case-sensitive: files differing only by case cannot be synced")
+			}
+		}
+	}
+	if p := endpoint.CloudProviderFor(folder); p != "" {
+		v.CloudProvider = p
+		v.Warnings = append(v.Warnings, fmt.Sprintf("folder is managed by %s: syncing it with another client may cause conflicts", p))
+	}
+	return v
+}
+
+// FolderSuggestionsRequest asks for local roots matching the server side of a new task.
+type FolderSuggestionsRequest struct {
+	ServerURI string
+}
+
+// suggestFolders lists local folders that could be used as the root of a new task, best first. Folders overlapping
+// with existing tasks are numbered until they are free.
+func (h *HttpServer) suggestFolders(c *gin.Context) {
+	var request FolderSuggestionsRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	suggestions := []*endpoint.FolderSuggestion{}
+	for _, s := range endpoint.SuggestFolders(request.ServerURI) {
+		base := s.Path
+		for i := 2; i < 100 && nestedTask(s.Path, "") != ""; i++ {
+			s.Path = fmt.Sprintf("%s-%d", base, i)
+		}
+		if nestedTask(s.Path, "") != "" {
+			continue
+		}
+		if s.Path != base {
+			s = endpoint.SuggestedFolder(s.Kind, s.Path)
+		}
+		suggestions = append(suggestions, s)
+	}
+	c.JSON(http.StatusOK, suggestions)
+}
+
+// createLocalRoots creates the missing local roots of a new task, so that a suggested folder needs no extra step.
+func createLocalRoots(t *config.Task) {
+	for _, uri := range []string{t.LeftURI, t.RightURI} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok {
+			continue
+		}
+		if _, e := os.Stat(root); os.IsNotExist(e) {
+			if er := endpoint.CreateSuggestedFolder(root); er != nil {
+				log.Logger(context.Background()).Error("Cannot create local root " + root + ": " + er.Error())
+			}
+		}
+	}
+}
+
+// nestedTask returns the label of an existing task whose local root contains or is contained by folder.
+func nestedTask(folder string, ignoreUuid string) string {
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == ignoreUuid {
+			continue
+		}
+		for _, uri := range []string{t.LeftURI, t.RightURI} {
+			root, ok := endpoint.LocalPathForURI(uri)
+			if !ok {
+				continue
+			}
+			if pathContains(root, folder) || pathContains(folder, root) {
+				if t.Label != "" {
+					return t.Label
+				}
+				return t.Uuid
+			}
+		}
+	}
+	return ""
+}
+
+// pathContains checks if child is parent or one of its descendants.
+func pathContains(parent, child string) bool {
+	parent = filepath.Clean(parent)
+	child = filepath.Clean(child)
+	if parent == child {
+		return true
+	}
+	return strings.HasPrefix(child, strings.TrimSuffix(parent, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NetworkResponse describes the current network and the bytes transferred on each known network.
+type NetworkResponse struct {
+	Current NetworkIdentity
+	Usages  []NetworkUsage
+}
+
+// network returns the current network identity, to help writing bandwidth rules, and the usage per network.
+func (h *HttpServer) network(c *gin.Context) {
+	c.JSON(http.StatusOK, &NetworkResponse{
+		Current: CurrentNetwork(),
+		Usages:  listNetworkUsages(),
+	})
+}
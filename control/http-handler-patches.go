@@ -61,6 +61,11 @@ func (h *HttpServer) parsePatchRequest(c *gin.Context) (*PatchesRequest, error)
 
 // reqRespStore uses a Pub/Sub model to synchronously retrieve a pointer to the PatchStore of a sync.
 func (h *HttpServer) reqRespStore(syncUUID string) *endpoint.PatchStore {
+	return requestPatchStore(syncUUID)
+}
+
+// requestPatchStore publishes a MessagePublishStore and waits for the sync to send back its PatchStore.
+func requestPatchStore(syncUUID string) *endpoint.PatchStore {
 
 	var store *endpoint.PatchStore
 	wg := sync.WaitGroup{}
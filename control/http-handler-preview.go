@@ -0,0 +1,155 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// PreviewRequest describes a task that is not created yet.
+type PreviewRequest struct {
+	LeftURI   string
+	RightURI  string
+	Direction string
+}
+
+// PreviewVolume is a number of files and bytes to transfer in one direction.
+type PreviewVolume struct {
+	Files int
+	Bytes int64
+}
+
+// SyncPreview estimates what the first sync of a task will transfer.
+type SyncPreview struct {
+	LeftFiles  int
+	RightFiles int
+	ToLeft     PreviewVolume
+	ToRight    PreviewVolume
+	Conflicts  int
+}
+
+// preview walks both roots of a task in parallel to estimate the first sync volume. It is cancelled with
+// the request, e.g. when the user changes one of the roots.
+func (h *HttpServer) preview(c *gin.Context) {
+	var request PreviewRequest
+	if e := c.BindJSON(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	ctx := c.Request.Context()
+	var left, right map[string]int64
+	var leftErr, rightErr error
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		left, leftErr = previewWalk(ctx, request.LeftURI, request.RightURI)
+	}()
+	go func() {
+		defer wg.Done()
+		right, rightErr = previewWalk(ctx, request.RightURI, request.LeftURI)
+	}()
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	if leftErr != nil {
+		h.writeError(c, leftErr)
+		return
+	} else if rightErr != nil {
+		h.writeError(c, rightErr)
+		return
+	}
+	c.JSON(http.StatusOK, computePreview(left, right, request.Direction))
+}
+
+// computePreview compares the files of both sides. Files existing on both sides with different sizes are
+// conflicts in bi-directional mode, or overwritten by the source side otherwise.
+func computePreview(left, right map[string]int64, direction string) *SyncPreview {
+	p := &SyncPreview{LeftFiles: len(left), RightFiles: len(right)}
+	toRight, toLeft := direction != "Left", direction != "Right"
+	for k, size := range left {
+		rightSize, exists := right[k]
+		switch {
+		case !exists && toRight:
+			p.ToRight.Files++
+			p.ToRight.Bytes += size
+		case exists && size != rightSize && direction == "Bi":
+			p.Conflicts++
+		case exists && size != rightSize && toRight:
+			p.ToRight.Files++
+			p.ToRight.Bytes += size
+		case exists && size != rightSize && toLeft:
+			p.ToLeft.Files++
+			p.ToLeft.Bytes += rightSize
+		}
+	}
+	if toLeft {
+		for k, size := range right {
+			if _, exists := left[k]; !exists {
+				p.ToLeft.Files++
+				p.ToLeft.Bytes += size
+			}
+		}
+	}
+	return p
+}
+
+// previewWalk lists the files of a root with their size, skipping the default ignores.
+func previewWalk(ctx context.Context, uri, otherUri string) (map[string]int64, error) {
+	ep, e := endpoint.EndpointFromURI(uri, otherUri)
+	if e != nil {
+		return nil, e
+	}
+	source, ok := model.AsPathSyncSource(ep)
+	if !ok {
+		return nil, fmt.Errorf("cannot walk %s", uri)
+	}
+	accept := endpoint.FilterMatcher(nil, endpoint.DefaultIgnores)
+	files := make(map[string]int64)
+	lock := &sync.Mutex{}
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Walk(func(p string, node *tree.Node, err error) {
+			if err != nil || !node.IsLeaf() || ctx.Err() != nil || !accept(p) {
+				return
+			}
+			lock.Lock()
+			files[strings.Trim(p, "/")] = node.GetSize()
+			lock.Unlock()
+		}, "/", true)
+	}()
+	select {
+	case e := <-done:
+		return files, e
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+const (
+	RunOutcomeStarted      = "started"
+	RunOutcomeSuccess      = "success"
+	RunOutcomePartial      = "partial"
+	RunOutcomeConflicts    = "conflicts"
+	RunOutcomeUnauthorized = "unauthorized"
+	RunOutcomeTimeout      = "timeout"
+
+	defaultRunTimeout = 30 * time.Minute
+)
+
+// RunResult is returned by the /run endpoint. Unless the caller did not wait, it describes the sync pass that
+// completed after the request.
+type RunResult struct {
+	Outcome       string
+	Processed     int
+	Conflicts     int
+	Errors        int
+	ErrorMessages []string
+}
+
+// runOutcome classifies a pass: authentication failures first, as nothing can sync until the user logs in again,
+// then conflicts, then other errors.
+func runOutcome(report *PatchReport) string {
+	for _, code := range report.ErrorCodes {
+		if code == ErrorCodeUnauthorized {
+			return RunOutcomeUnauthorized
+		}
+	}
+	if report.Conflicts > 0 {
+		return RunOutcomeConflicts
+	}
+	if report.Errors > 0 {
+		return RunOutcomePartial
+	}
+	return RunOutcomeSuccess
+}
+
+// runTask triggers a sync pass of a task. With ?wait=true, it blocks until the pass completes or until the
+// ?timeout duration expires (30m by default), and returns its outcome.
+func (h *HttpServer) runTask(c *gin.Context) {
+	uuid := c.Param("uuid")
+	var found bool
+	for _, t := range config.Default().Tasks {
+		found = found || t.Uuid == uuid
+	}
+	if !found {
+		h.writeError(c, fmt.Errorf("cannot find task %s", uuid))
+		return
+	}
+	if c.Query("wait") != "true" {
+		go GetBus().Pub(MessageSyncLoop, TopicSync_+uuid)
+		c.JSON(http.StatusAccepted, &RunResult{Outcome: RunOutcomeStarted})
+		return
+	}
+	timeout := defaultRunTimeout
+	if t := c.Query("timeout"); t != "" {
+		d, e := time.ParseDuration(t)
+		if e != nil || d <= 0 {
+			h.writeError(c, fmt.Errorf("invalid timeout %s", t))
+			return
+		}
+		timeout = d
+	}
+	// Subscribe before triggering the pass, so that its report cannot be missed
+	bus := GetBus()
+	reports := bus.Sub(TopicReport)
+	defer bus.Unsub(reports, TopicReport)
+	go bus.Pub(MessageSyncLoop, TopicSync_+uuid)
+	expire := time.After(timeout)
+	for {
+		select {
+		case m := <-reports:
+			report, ok := m.(*PatchReport)
+			if !ok || report.TaskUuid != uuid {
+				break
+			}
+			c.JSON(http.StatusOK, &RunResult{
+				Outcome:       runOutcome(report),
+				Processed:     report.Processed,
+				Conflicts:     report.Conflicts,
+				Errors:        report.Errors,
+				ErrorMessages: report.ErrorMessages,
+			})
+			return
+		case <-expire:
+			c.JSON(http.StatusOK, &RunResult{Outcome: RunOutcomeTimeout})
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
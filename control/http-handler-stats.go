@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// reqRespStats uses a Pub/Sub model to synchronously retrieve a pointer to the StatsStore of a sync.
+func (h *HttpServer) reqRespStats(syncUUID string) *endpoint.StatsStore {
+
+	var store *endpoint.StatsStore
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	ch := GetBus().Sub(TopicStats_ + syncUUID)
+	go func() {
+		defer func() {
+			wg.Done()
+			GetBus().Unsub(ch)
+		}()
+		select {
+		case s := <-ch:
+			store = s.(*endpoint.StatsStore)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}()
+	GetBus().Pub(MessagePublishStats, TopicSync_+syncUUID)
+	wg.Wait()
+
+	return store
+}
+
+// listStats loads hourly transfer aggregates for the last hours (24 by default).
+func (h *HttpServer) listStats(c *gin.Context) {
+	syncUUID := c.Param("uuid")
+	if syncUUID == "" {
+		h.writeError(c, fmt.Errorf("please provide a sync UUID"))
+		return
+	}
+	hours := 24
+	if hh, e := strconv.ParseInt(c.Param("hours"), 10, 64); e == nil && hh > 0 {
+		hours = int(hh)
+	}
+	store := h.reqRespStats(syncUUID)
+	if store == nil {
+		h.writeError(c, fmt.Errorf("cannot load stats store"))
+		return
+	}
+	stats, err := store.LoadHourly(time.Now().Add(-time.Duration(hours) * time.Hour))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// services lists the status of the sub-processes, with the reason of their last crash.
+func (h *HttpServer) services(c *gin.Context) {
+	c.JSON(http.StatusOK, SpawnedStatuses())
+}
+
+// metrics exposes the watcher counters and event latencies of the local folders of all tasks, in the Prometheus
+// text format.
+func (h *HttpServer) metrics(c *gin.Context) {
+	var b strings.Builder
+	counters := []struct {
+		name, help string
+		value      func(m endpoint.WatcherMetrics) int64
+	}{
+		{"cells_sync_watcher_errors_total", "Errors reported by local watchers", func(m endpoint.WatcherMetrics) int64 { return m.Errors }},
+		{"cells_sync_watcher_overflows_total", "Event queue overflows of local watchers", func(m endpoint.WatcherMetrics) int64 { return m.Overflows }},
+		{"cells_sync_watcher_restarts_total", "Local watchers restarted after an error", func(m endpoint.WatcherMetrics) int64 { return m.Restarts }},
+		{"cells_sync_watcher_rescanned_total", "Entries rescanned after a local watcher error", func(m endpoint.WatcherMetrics) int64 { return m.Rescanned }},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, t := range config.Default().Tasks {
+			for _, uri := range []string{t.LeftURI, t.RightURI} {
+				if root, ok := endpoint.LocalPathForURI(uri); ok {
+					fmt.Fprintf(&b, "%s{task=%q} %d\n", counter.name, t.Uuid, counter.value(endpoint.WatcherMetricsFor(root)))
+				}
+			}
+		}
+	}
+	gauges := []struct {
+		name, help string
+		value      func(l endpoint.EventLatency) float64
+	}{
+		{"cells_sync_events_in_watcher", "Local events not yet handed to the sync engine", func(l endpoint.EventLatency) float64 { return float64(l.InWatcher) }},
+		{"cells_sync_events_in_engine", "Local events waiting for their operation to be applied", func(l endpoint.EventLatency) float64 { return float64(l.InEngine) }},
+		{"cells_sync_event_watcher_p50_seconds", "Median delay between a local event and its handling by the sync engine", func(l endpoint.EventLatency) float64 { return l.WatcherP50.Seconds() }},
+		{"cells_sync_event_watcher_p95_seconds", "95th percentile of the delay between a local event and its handling by the sync engine", func(l endpoint.EventLatency) float64 { return l.WatcherP95.Seconds() }},
+		{"cells_sync_event_complete_p50_seconds", "Median delay between a local event and the end of its operation", func(l endpoint.EventLatency) float64 { return l.CompleteP50.Seconds() }},
+		{"cells_sync_event_complete_p95_seconds", "95th percentile of the delay between a local event and the end of its operation", func(l endpoint.EventLatency) float64 { return l.CompleteP95.Seconds() }},
+	}
+	latencies := taskLatencies()
+	for _, gauge := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, l := range latencies {
+			fmt.Fprintf(&b, "%s{task=%q} %g\n", gauge.name, l.TaskUuid, gauge.value(l.EventLatency))
+		}
+	}
+	c.String(http.StatusOK, b.String())
+}
@@ -27,6 +27,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -254,3 +255,54 @@ func (h *HttpServer) defaultDir(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, &TreeResponse{Node: &tree.Node{Path: outputDir, Type: tree.NodeType_COLLECTION}})
 }
+
+// TreeValidation is returned when checking a root chosen for a new task.
+type TreeValidation struct {
+	Exists    bool
+	Folder    bool
+	Writable  bool
+	Workspace *endpoint.WorkspaceInfo `json:"Workspace,omitempty"`
+}
+
+// workspaces lists the workspaces of a remote server, given its authority URI.
+func (h *HttpServer) workspaces(c *gin.Context) {
+	var request TreeRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	workspaces, e := endpoint.ListWorkspaces(request.EndpointURI)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// validate checks that the path of a root exists, is a folder, and can be written.
+func (h *HttpServer) validate(c *gin.Context) {
+	request, e := h.parseTreeRequest(c)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	response := &TreeValidation{}
+	node, e := request.endpoint.LoadNode(h.ctx, request.Path)
+	if e != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	response.Exists = true
+	response.Folder = !node.IsLeaf()
+	if strings.HasPrefix(request.EndpointURI, "http") {
+		u, _ := url.Parse(request.EndpointURI)
+		u.Path = path.Join(u.Path, request.Path)
+		if ws, er := endpoint.WorkspaceForURI(u.String()); er == nil {
+			response.Workspace = &ws
+			response.Writable = !ws.ReadOnly()
+		}
+	} else if root, ok := endpoint.LocalPathForURI(request.EndpointURI); ok {
+		response.Writable = response.Folder && !endpoint.IsReadOnlyFolder(filepath.Join(root, filepath.FromSlash(request.Path)))
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -21,8 +21,12 @@ package control
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -41,6 +45,8 @@ import (
 	"github.com/pydio/cells-sync/app/ux"
 	"github.com/pydio/cells-sync/common"
 	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
 	"github.com/pydio/cells/common/log"
 )
 
@@ -52,7 +58,13 @@ type HttpServer struct {
 	done          chan bool
 	recentLogs    [][]byte
 	lastSyncState common.SyncState
+	journal       *statusJournal
+	summaries     *summaryCache
+	diffs         *stateDiffer
 	ctx           context.Context
+	// Messages and log lines are also streamed to the gRPC clients
+	statusWatchers *watchers
+	logWatchers    *watchers
 
 	logWriter *io.PipeWriter
 }
@@ -63,8 +75,12 @@ func NewHttpServer() *HttpServer {
 	httpServerCtx = servicecontext.WithServiceColor(httpServerCtx, servicecontext.ServiceColorRest)
 	r, w := io.Pipe()
 	h := &HttpServer{
-		ctx:       httpServerCtx,
-		logWriter: w,
+		ctx:            httpServerCtx,
+		logWriter:      w,
+		summaries:      newSummaryCache(),
+		diffs:          newStateDiffer(),
+		statusWatchers: newWatchers(),
+		logWatchers:    newWatchers(),
 	}
 	log.RegisterWriteSyncer(h)
 	go func() {
@@ -74,6 +90,7 @@ func NewHttpServer() *HttpServer {
 			if h.LogSocket != nil && h.logSocketConnected {
 				h.LogSocket.Broadcast([]byte(line))
 			}
+			h.logWatchers.publish([]byte(line))
 			// Keep last 200 lines in memory
 			if len(h.recentLogs) < 200 {
 				h.recentLogs = append(h.recentLogs, []byte(line))
@@ -92,7 +109,7 @@ func (h *HttpServer) Sync() error {
 
 // Write implements the io.Writer method (used by logs).
 func (h *HttpServer) Write(p []byte) (n int, err error) {
-	go h.logWriter.Write(p)
+	go h.logWriter.Write(redactLogLine(p))
 	return len(p), nil
 }
 
@@ -116,6 +133,12 @@ func (h *HttpServer) InitHandlers() {
 		}
 	})
 
+	if journal, e := newStatusJournal(); e == nil {
+		h.journal = journal
+	} else {
+		log.Logger(h.ctx).Error("Cannot open status journal: " + e.Error())
+	}
+
 	h.WebSocket = melody.New()
 	h.WebSocket.Config.MaxMessageSize = 2048
 
@@ -136,7 +159,18 @@ func (h *HttpServer) InitHandlers() {
 
 			m := &common.Message{Type: "PONG", Content: "Hello new client!"}
 			session.Write(m.Bytes())
-			// Publish sync states
+			// Replay journaled messages missed by a reconnecting client
+			if resume, ok := data.Content.(*common.ResumeRequest); ok && resume.LastSeq > 0 && h.journal != nil {
+				missed, complete := h.journal.Since(resume.LastSeq)
+				if !complete {
+					log.Logger(h.ctx).Debug("Status journal was pruned, client will only receive current states")
+				}
+				for _, b := range missed {
+					session.Write(b)
+				}
+			}
+			// Publish sync states, in full for the new client
+			h.diffs.reset()
 			GetBus().Pub(MessagePublishState, TopicSyncAll)
 			// Publish Authorities list
 			message := &common.Message{Type: "AUTHORITIES", Content: config.Default().PublicAuthorities()}
@@ -150,17 +184,7 @@ func (h *HttpServer) InitHandlers() {
 		case "CMD":
 
 			if cmd, ok := data.Content.(*common.CmdContent); ok {
-				if intCmd, err := MessageFromString(cmd.Cmd); err == nil {
-					if cmd.UUID != "" {
-						go GetBus().Pub(intCmd, TopicSync_+cmd.UUID)
-					} else {
-						if intCmd == MessageHalt || intCmd == MessageRestart {
-							GetBus().Pub(intCmd, TopicGlobal)
-						} else {
-							go GetBus().Pub(intCmd, TopicSyncAll)
-						}
-					}
-				}
+				sendCommand(cmd.UUID, cmd.Cmd)
 			}
 
 		case "CONFIG":
@@ -168,13 +192,11 @@ func (h *HttpServer) InitHandlers() {
 			if confContent, ok := data.Content.(*common.ConfigContent); ok {
 				confs := config.Default()
 				if confContent.Task != nil {
-					if confContent.Cmd == "create" {
-						confContent.Task.Uuid = uuid.New()
-						confs.CreateTask(confContent.Task)
-					} else if confContent.Cmd == "edit" {
-						confs.UpdateTask(confContent.Task)
-					} else if confContent.Cmd == "delete" {
-						confs.RemoveTask(confContent.Task)
+					if er := configureTask(confContent.Cmd, confContent.Task); er != nil {
+						// Let the client know, e.g. when the task was modified concurrently
+						_, conflict := er.(*config.RevisionConflictError)
+						message := &common.Message{Type: "CONFIG_ERROR", Content: &common.ConfigError{UUID: confContent.Task.Uuid, Error: er.Error(), Conflict: conflict}}
+						session.Write(message.Bytes())
 					}
 				} else if confContent.Authority != nil {
 					if confContent.Cmd == "create" {
@@ -191,6 +213,29 @@ func (h *HttpServer) InitHandlers() {
 				}
 			}
 
+		case "NOTIFICATION_ACTION":
+
+			if resp, ok := data.Content.(*common.NotificationResponse); ok {
+				if e := HandleNotificationResponse(resp); e != nil {
+					log.Logger(h.ctx).Error("Cannot handle notification action: " + e.Error())
+				}
+			}
+
+		case "CONFLICT_COPY":
+
+			if r, ok := data.Content.(*common.ConflictCopyResolution); ok && r.UUID != "" {
+				if r.Keep == ActionKeepOriginal || r.Keep == ActionKeepCopy {
+					// States of private tasks carry encrypted paths
+					go GetBus().Pub(&ConflictResolution{Path: revealText(r.Path), Copy: revealText(r.Copy), Keep: r.Keep}, TopicSync_+r.UUID)
+				}
+			}
+
+		case "ERROR_SNOOZE":
+
+			if r, ok := data.Content.(*common.ErrorSnoozeRequest); ok && r.UUID != "" {
+				go GetBus().Pub(&ErrorSnooze{Fingerprint: r.Fingerprint, Path: revealText(r.Path), Days: r.Days}, TopicSync_+r.UUID)
+			}
+
 		case "UPDATE":
 
 			if req, ok := data.Content.(*common.UpdateCheckRequest); ok {
@@ -243,23 +288,35 @@ func (h *HttpServer) drop(s common.SyncState) bool {
 	return false
 }
 
+// record stores a message in the status journal if it is opened.
+func (h *HttpServer) record(m *common.Message) *common.Message {
+	if h.journal == nil {
+		return m
+	}
+	return h.journal.Record(m)
+}
+
 // ListenStatus is hooked to the general Bus to listen for SyncStates and UpdateMessages.
 // It should be called as a goroutine
 func (h *HttpServer) ListenStatus() {
-	statuses := GetBus().Sub(TopicState, TopicUpdate)
+	statuses := GetBus().Sub(TopicState, TopicUpdate, TopicNotification)
 	for {
 		select {
 		case <-h.done:
-			GetBus().Unsub(statuses, TopicState, TopicUpdate)
+			GetBus().Unsub(statuses, TopicState, TopicUpdate, TopicNotification)
+			if h.journal != nil {
+				h.journal.Close()
+			}
 			return
 		case s := <-statuses:
 			if state, ok := s.(common.SyncState); ok {
+				h.summaries.update(state)
 				if !h.drop(state) {
-					m := &common.Message{
-						Type:    "STATE",
-						Content: s,
+					if m := h.diffs.message(state); m != nil {
+						data := h.record(m).Bytes()
+						h.WebSocket.BroadcastFilter(data, verboseSession)
+						h.statusWatchers.publish(data)
 					}
-					h.WebSocket.Broadcast(m.Bytes())
 				}
 			} else if update, ok := s.(common.UpdateMessage); ok {
 				m := &common.Message{
@@ -267,6 +324,16 @@ func (h *HttpServer) ListenStatus() {
 					Content: update,
 				}
 				h.WebSocket.Broadcast(m.Bytes())
+			} else if notification, ok := s.(*common.Notification); ok {
+				m := &common.Message{
+					Type:    "NOTIFICATION",
+					Content: notification,
+				}
+				data := h.record(m).Bytes()
+				h.WebSocket.Broadcast(data)
+				h.statusWatchers.publish(data)
+			} else if m, ok := s.(*common.Message); ok {
+				h.WebSocket.Broadcast(m.Bytes())
 			}
 		}
 	}
@@ -277,7 +344,18 @@ func (h *HttpServer) ListenStatus() {
 func (h *HttpServer) ListenAuthorities() {
 	watches := config.Watch()
 	for w := range watches {
-		if _, ok := w.(*config.AuthChange); ok {
+		if aC, ok := w.(*config.AuthChange); ok {
+			if aC.Type == "expired" {
+				PublishNotification(&common.Notification{
+					Type:    NotificationAuthExpired,
+					Title:   i18n.T("application.title"),
+					Message: fmt.Sprintf(i18n.T("notification.auth-expired"), aC.Authority.URI),
+					Actions: []*common.NotificationAction{
+						{Id: ActionLogin, Label: i18n.T("notification.auth-expired.login")},
+					},
+				})
+				continue
+			}
 			// Broadcast servers list to all clients
 			message := &common.Message{Type: "AUTHORITIES", Content: config.Default().PublicAuthorities()}
 			h.WebSocket.Broadcast(message.Bytes())
@@ -285,10 +363,63 @@ func (h *HttpServer) ListenAuthorities() {
 	}
 }
 
+// sendCommand publishes a command received from a client to a task, or to all tasks if syncUUID is empty.
+func sendCommand(syncUUID string, cmd string) error {
+	intCmd, err := MessageFromString(cmd)
+	if err != nil {
+		return err
+	}
+	if syncUUID != "" {
+		go GetBus().Pub(intCmd, TopicSync_+syncUUID)
+	} else if intCmd == MessageHalt || intCmd == MessageRestart || intCmd == MessageSafeQuit {
+		GetBus().Pub(intCmd, TopicGlobal)
+	} else {
+		go GetBus().Pub(intCmd, TopicSyncAll)
+	}
+	return nil
+}
+
+// configureTask creates, edits or deletes a task as requested by a client.
+func configureTask(cmd string, task *config.Task) error {
+	confs := config.Default()
+	if cmd == "create" {
+		createLocalRoots(task)
+	}
+	if cmd == "create" || cmd == "edit" {
+		// Tasks edited from the state of a private task carry encrypted roots
+		revealTask(task)
+		task.LeftURI = endpoint.AnnotateWorkspaceURI(task.LeftURI)
+		task.RightURI = endpoint.AnnotateWorkspaceURI(task.RightURI)
+		// Detect read-only sides now rather than failing on first write
+		if changed, _ := readOnlyDirection(task); changed {
+			notifyReadOnly(task)
+		}
+		// Reject unknown variables in remote roots before saving
+		if _, er := endpoint.ResolvePathTemplate(*remoteURI(task), time.Now()); er != nil {
+			return er
+		}
+		if er := confs.CheckFilterSets(task); er != nil {
+			return er
+		}
+	}
+	switch cmd {
+	case "create":
+		task.Uuid = uuid.New()
+		er := confs.CreateTask(task)
+		notifyCloudFolder(task)
+		return er
+	case "edit":
+		return confs.UpdateTask(task)
+	case "delete":
+		return confs.RemoveTask(task)
+	}
+	return nil
+}
+
 // Serve implements supervisor service interface. It basically starts the http server.
 func (h *HttpServer) Serve() {
 
-	h.done = make(chan bool)
+	h.done = make(chan bool, 1)
 	h.InitHandlers()
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
@@ -299,11 +430,35 @@ func (h *HttpServer) Serve() {
 	})
 	Server.Use(gin.Recovery())
 	Server.Use(static.Serve("/", ux.Box))
-	addr, err := config.GetHttpAddress()
+	listener, err := h.listen()
 	if err != nil {
 		log.Logger(h.ctx).Error("Cannot start server: " + err.Error())
 		return
 	}
+	addr := listener.Addr().String()
+	grpcServer, grpcAddr := h.serveGrpc(addr)
+	if e := config.WriteRuntimeInfo(addr, grpcAddr); e != nil {
+		log.Logger(h.ctx).Error("Cannot write runtime file, clients will use the default address: " + e.Error())
+	}
+	defer config.RemoveRuntimeInfo()
+	// Registered before the host check, as requests received on the named pipe do not target addr
+	Server.GET("/runtime", func(c *gin.Context) {
+		info, e := config.ReadRuntimeInfo()
+		if e != nil {
+			h.writeError(c, e)
+			return
+		}
+		c.JSON(http.StatusOK, info)
+	})
+	if config.RunningAsWindowsService() {
+		if pipe, e := config.ListenPipe(); e == nil {
+			log.Logger(h.ctx).Info("Serving runtime info on " + config.PipeName)
+			go http.Serve(pipe, Server)
+			defer pipe.Close()
+		} else {
+			log.Logger(h.ctx).Error("Cannot open named pipe, UI in user sessions will not find the service: " + e.Error())
+		}
+	}
 	Server.Use(secure.Secure(secure.Options{
 		AllowedHosts: []string{addr},
 	}))
@@ -326,20 +481,176 @@ func (h *HttpServer) Serve() {
 	Server.POST("/default", h.defaultDir)
 	Server.POST("/tree", h.ls)
 	Server.PUT("/tree", h.mkdir)
+	Server.POST("/tree/validate", h.validate)
+	Server.POST("/workspaces", h.workspaces)
+	Server.POST("/local/validate", h.validateLocal)
+	Server.POST("/local/suggestions", h.suggestFolders)
+
+	// Estimate first sync volume before creating a task
+	Server.POST("/preview", h.preview)
+	// Show the files excluded or included by filters edited on an existing task
+	Server.POST("/preview/filters/:uuid", h.previewFilters)
+	// Manage the filter sets shared by several tasks
+	Server.GET("/filter-sets", h.listFilterSets)
+	Server.PUT("/filter-sets", h.putFilterSet)
+	Server.DELETE("/filter-sets/:name", h.deleteFilterSet)
 
 	// Load Patch contents
 	Server.GET("/patches/:uuid/:offset/:limit", h.listPatches)
 
+	// List and resolve conflicts in bulk
+	Server.GET("/conflicts/:uuid", h.listConflicts)
+	Server.POST("/conflicts/:uuid", h.resolveConflicts)
+	// Review and apply recovery plans
+	Server.GET("/recovery/:uuid", h.getRecoveryPlan)
+	Server.POST("/recovery/:uuid", h.applyRecoveryPlan)
+	// Last comparison of a task in audit mode
+	Server.GET("/drift/:uuid", h.getDriftReport)
+	// Last spot check of the local files of a task
+	Server.GET("/integrity/:uuid", h.getIntegrityReport)
+
+	// Resolve cellssync:// links to the UI route creating the task (open-url command)
+	Server.POST("/links", h.openSyncLink)
+
+	// Trigger a sync pass, optionally waiting for its outcome (run command)
+	Server.POST("/run/:uuid", h.runTask)
+	// Verify again one folder of a task (resync command)
+	Server.POST("/resync/:uuid", h.resyncTaskSubtree)
+	// List and restore the deletions sent to the server recycle bin (recycle-bin command)
+	Server.GET("/recycle-bin/:uuid", h.listRecycledNodes)
+	Server.POST("/recycle-bin/:uuid", h.restoreRecycledNodes)
+	// Buffer local changes during a big reorganization, and process their net result once released (hold command)
+	Server.POST("/hold/:uuid", h.holdTask)
+	// Pause a task until a date or for a duration, it resumes automatically (pause command)
+	Server.POST("/pause/:uuid", h.pauseTaskUntil)
+
+	// Load hourly transfer stats
+	Server.GET("/stats/:uuid", h.listStats)
+	Server.GET("/stats/:uuid/:hours", h.listStats)
+	Server.GET("/metrics", h.metrics)
+	Server.GET("/debug/latency", h.debugLatency)
+	Server.POST("/debug/clock/:duration", h.advanceClock)
+
+	// Resource usage of the agent against its limits (doctor command)
+	Server.GET("/resources", h.resources)
+
+	// Status of the sub-processes (system tray)
+	Server.GET("/services", h.services)
+
+	// Change the transfer limits of a running task
+	Server.PUT("/transfers/:uuid", h.updateTransferLimits)
+
+	// List, restore and empty the local trashes of a task
+	Server.GET("/trash/:uuid", h.listTrash)
+	Server.POST("/trash/:uuid/restore", h.restoreTrash)
+	Server.POST("/trash/:uuid/empty", h.emptyTrash)
+
+	// Export the operations applied by a task over a date range
+	Server.GET("/audit/:uuid", h.exportAudit)
+
+	// Last changed files with their local path and server URL, per task or for "all" tasks
+	Server.GET("/recent/:uuid", h.recentFiles)
+	Server.GET("/recent/:uuid/:limit", h.recentFiles)
+
+	// Files bookmarked on the server, per task or for "all" tasks
+	Server.GET("/favorites/:uuid", h.favorites)
+
+	// Actions triggered from desktop notifications. Links opened from a notification get a page confirming the
+	// action, which is only applied through POST.
+	Server.GET("/notifications/:id/:action", h.notificationConfirm)
+	Server.POST("/notifications/:id/:action", h.notificationAction)
+
+	// Aggregated status of all tasks, polled by the system tray
+	Server.GET("/summary", h.statusSummary)
+
+	// Current network and bandwidth usage per network
+	Server.GET("/network", h.network)
+
 	// Manage global config
 	Server.GET("/config", h.loadConf)
 	Server.PUT("/config", h.updateConf)
 
+	// Decrypt the names masked by the tasks in privacy mode
+	Server.POST("/privacy/reveal", h.revealPrivate)
+
+	// Show server certificate before first login
+	Server.POST("/certificate", h.certificate)
+
 	log.Logger(h.ctx).Info("Starting HttpServer on " + addr)
-	if e := http.ListenAndServe(addr, Server); e != nil {
+	srv := &http.Server{Handler: Server}
+	go func() {
+		<-h.done
+		// Websockets are hijacked connections, they are not closed by Shutdown
+		h.WebSocket.Close()
+		h.LogSocket.Close()
+		if grpcServer != nil {
+			// Streams never end by themselves, do not wait for them
+			grpcServer.Stop()
+		}
+		ctx, cancel := context.WithTimeout(h.ctx, 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	if e := srv.Serve(listener); e != nil && e != http.ErrServerClosed {
 		log.Logger(h.ctx).Error("Cannot start server: " + e.Error())
 	}
 }
 
+// listen binds the http server address. If the port was taken since it was looked up, for example by another
+// application starting at the same time, a new free port is picked.
+func (h *HttpServer) listen() (net.Listener, error) {
+	var lastErr error
+	for i := 0; i < 3; i++ {
+		addr, e := config.GetHttpAddress()
+		if addr == "" {
+			return nil, e
+		} else if e != nil {
+			log.Logger(h.ctx).Warn(e.Error())
+		}
+		l, e := net.Listen("tcp", addr)
+		if e == nil {
+			return l, nil
+		}
+		log.Logger(h.ctx).Warn("Cannot bind " + addr + ", looking for another port: " + e.Error())
+		lastErr = e
+		config.ResetHttpAddress()
+	}
+	return nil, lastErr
+}
+
+// notificationAction is called by notifications that can only open an URL when the user clicks on an action.
+// notificationConfirm renders a page posting the action chosen on a notification.
+func (h *HttpServer) notificationConfirm(c *gin.Context) {
+	page := bytes.NewBuffer(nil)
+	e := notificationConfirmPage.Execute(page, map[string]string{
+		"Title":  i18n.T("application.title"),
+		"Action": c.Request.URL.Path,
+		"Label":  i18n.T("notification.confirm"),
+	})
+	if e != nil {
+		c.String(http.StatusInternalServerError, e.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+func (h *HttpServer) notificationAction(c *gin.Context) {
+	resp := &common.NotificationResponse{Id: c.Param("id"), Action: c.Param("action")}
+	if e := HandleNotificationResponse(resp); e != nil {
+		c.String(http.StatusOK, e.Error())
+		return
+	}
+	if resp.Action == ActionLogin {
+		c.Redirect(http.StatusFound, "/servers")
+		return
+	}
+	c.String(http.StatusOK, "OK, you can close this window.")
+}
+
+var notificationConfirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body><form method="POST" action="{{.Action}}"><button type="submit">{{.Label}}</button></form></body></html>`))
+
 // Stop implements supervisor service interface.
 func (h *HttpServer) Stop() {
 	h.done <- true
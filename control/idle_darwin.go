@@ -0,0 +1,48 @@
+// +build darwin
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var hidIdleTime = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// systemIdleTime returns the time since the last user input, as reported by IOHIDSystem.
+func systemIdleTime() (time.Duration, bool) {
+	out, e := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if e != nil {
+		return 0, false
+	}
+	m := hidIdleTime.FindSubmatch(out)
+	if m == nil {
+		return 0, false
+	}
+	ns, e := strconv.ParseInt(string(m[1]), 10, 64)
+	if e != nil {
+		return 0, false
+	}
+	return time.Duration(ns), true
+}
@@ -0,0 +1,42 @@
+// +build !windows,!darwin
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemIdleTime returns the time since the last user input, using xprintidle if it is installed.
+func systemIdleTime() (time.Duration, bool) {
+	out, e := exec.Command("xprintidle").Output()
+	if e != nil {
+		return 0, false
+	}
+	ms, e := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if e != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
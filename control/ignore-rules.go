@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// setupIgnoreRules installs the task patterns and the .pydio-ignore file on the local endpoints. Changes to the
+// file are picked up by the watcher and update the task filters.
+func (s *Syncer) setupIgnoreRules(left, right model.Endpoint) error {
+	for uri, ep := range map[string]model.Endpoint{s.conf.LeftURI: left, s.conf.RightURI: right} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok {
+			continue
+		}
+		rules, e := endpoint.NewIgnoreRules(root, config.Default().TaskIgnores(s.conf))
+		if e != nil {
+			return e
+		}
+		if !endpoint.SetIgnoreRules(ep, rules) {
+			continue
+		}
+		rules.OnChange(func() {
+			log.Logger(context.Background()).Info("Ignore rules changed, updating task filters")
+			s.applyFilters()
+		})
+		s.ignoreRules = append(s.ignoreRules, rules)
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+	"github.com/pkg/errors"
+	"github.com/rwcarlsen/goexif/exif"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	importPollInterval     = 30 * time.Second
+	DefaultImportTemplate  = "Photos/{{.Year}}/{{.Month}}/{{.Name}}{{.Ext}}"
+	maxImportNameConflicts = 100
+)
+
+var (
+	// DefaultImportExtensions are the files picked by import tasks that do not define their own extensions.
+	DefaultImportExtensions = []string{
+		".jpg", ".jpeg", ".heic", ".heif", ".png", ".tif", ".tiff", ".dng", ".cr2", ".cr3", ".nef", ".arw", ".raf",
+		".orf", ".rw2", ".mp4", ".mov", ".m4v", ".avi", ".mts",
+	}
+	importHashesBucket = []byte("hashes")
+	importFilesBucket  = []byte("files")
+)
+
+// importVars are the values available in the path template of an import task.
+type importVars struct {
+	Year   string
+	Month  string
+	Day    string
+	Camera string
+	Name   string
+	Ext    string
+}
+
+// Importer is a supervisor service running an import task: it polls the local folder, which may appear and
+// disappear as a camera card is mounted, and uploads new photos into the remote folder at a path rendered from
+// their capture date. The hashes of imported files are indexed so that a photo is never uploaded twice, even
+// under another name or from another card.
+type Importer struct {
+	uuid       string
+	conf       *config.Task
+	ctx        context.Context
+	done       chan bool
+	stateStore StateStore
+	configPath string
+	source     string
+	target     model.Endpoint
+	template   *template.Template
+	extensions map[string]bool
+	db         *bbolt.DB
+	available  bool
+	cleanAll   bool
+}
+
+// NewImporter creates a new import task service.
+func NewImporter(conf *config.Task) (importer *Importer) {
+
+	var startError error
+
+	ctx := servicecontext.WithServiceName(context.Background(), "import-task")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorGrpc)
+	configPath := filepath.Join(config.SyncClientDataDir(), conf.Uuid)
+	stateStore := NewFileStateStore(conf, configPath)
+	if stateStore.FileError != nil {
+		log.Logger(ctx).Warn("Cannot open file for monitoring state : " + stateStore.FileError.Error())
+	}
+	importer = &Importer{
+		uuid:       conf.Uuid,
+		conf:       conf,
+		ctx:        ctx,
+		done:       make(chan bool, 1),
+		stateStore: stateStore,
+		configPath: configPath,
+		extensions: make(map[string]bool),
+	}
+
+	defer func() {
+		if startError != nil {
+			stateStore.UpdateErrors([]*common.ErrorInfo{errorInfo(startError, "")})
+			stateStore.UpdateProcessStatus(model.NewProcessingStatus(startError.Error()).SetError(startError), model.TaskStatusError)
+		}
+	}()
+
+	source, ok := endpoint.LocalPathForURI(conf.LeftURI)
+	if !ok {
+		startError = fmt.Errorf("import tasks require a local folder as source")
+		return
+	}
+	importer.source = source
+	target, e := endpoint.EndpointFromURI(conf.RightURI, conf.LeftURI)
+	if e != nil {
+		startError = errors.Wrap(e, "cannot start remote endpoint")
+		return
+	}
+	if _, ok := model.AsDataSyncTarget(target); !ok {
+		startError = fmt.Errorf("cannot write data to %s", conf.RightURI)
+		return
+	}
+	importer.target = target
+
+	pattern := conf.Import.Template
+	if pattern == "" {
+		pattern = DefaultImportTemplate
+	}
+	if importer.template, e = template.New("import").Parse(pattern); e != nil {
+		startError = errors.Wrap(e, "invalid import path template")
+		return
+	}
+	extensions := conf.Import.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultImportExtensions
+	}
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		importer.extensions[ext] = true
+	}
+
+	if e := os.MkdirAll(configPath, 0755); e != nil {
+		startError = errors.Wrap(e, "cannot create configuration folder for task")
+		return
+	}
+	if importer.db, e = bbolt.Open(filepath.Join(configPath, "import-index"), 0644, endpoint.BoltOptions(5*time.Second)); e != nil {
+		startError = errors.Wrap(e, "cannot open import index")
+		return
+	}
+	return
+}
+
+// Serve implements supervisor service interface.
+func (i *Importer) Serve() {
+	bus := GetBus()
+	topic := bus.Sub(TopicSyncAll, TopicSync_+i.uuid)
+	defer bus.Unsub(topic)
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	if i.db != nil {
+		log.Logger(i.ctx).Info("Starting Import Service")
+		i.poll(false)
+	} else {
+		log.Logger(i.ctx).Info("Importer did not setup Task properly, do nothing")
+	}
+	for {
+		select {
+		case message := <-topic:
+			switch message {
+			case MessageSyncLoop, MessageResync, MessageScheduledResync:
+				if i.db != nil {
+					i.poll(true)
+				}
+			case MessagePublishState:
+				bus.Pub(i.stateStore.LastState(), TopicState)
+			case MessageRestart, MessageRestartClean:
+				bus.Pub(i.stateStore.UpdateSyncStatus(model.TaskStatusRestarting), TopicState)
+			case MessageHalt:
+				bus.Pub(i.stateStore.UpdateSyncStatus(model.TaskStatusStopping), TopicState)
+			case MessageHaltClean:
+				i.cleanAll = true
+				bus.Pub(i.stateStore.UpdateSyncStatus(model.TaskStatusStopping), TopicState)
+			}
+		case <-ticker.C:
+			if i.db != nil {
+				i.poll(false)
+			}
+		case <-i.done:
+			i.shutdown()
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (i *Importer) Stop() {
+	i.done <- true
+}
+
+func (i *Importer) shutdown() {
+	log.Logger(i.ctx).Info("Stopping Import Service")
+	if i.db != nil {
+		i.db.Close()
+	}
+	if i.cleanAll {
+		if e := os.RemoveAll(i.configPath); e != nil {
+			log.Logger(i.ctx).Error("Could not remove folder " + i.configPath + " : " + e.Error())
+		}
+		GetBus().Pub(i.stateStore.UpdateSyncStatus(model.TaskStatusRemoved), TopicState)
+	}
+	i.stateStore.Close()
+}
+
+// poll imports the source folder when it becomes available (card inserted), or on demand.
+func (i *Importer) poll(force bool) {
+	bus := GetBus()
+	_, e := os.Stat(i.source)
+	available := e == nil
+	if available != i.available {
+		i.available = available
+		bus.Pub(i.stateStore.UpdateConnection(available, model.EndpointInfo{URI: i.conf.LeftURI}), TopicState)
+		if !available {
+			bus.Pub(i.stateStore.UpdateSyncStatus(model.TaskStatusIdle), TopicState)
+			return
+		}
+		force = true
+	}
+	if !available || !force {
+		return
+	}
+	bus.Pub(i.stateStore.UpdateConnection(true, i.target.GetEndpointInfo()), TopicState)
+	bus.Pub(i.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Importing photos from "+i.source), model.TaskStatusProcessing), TopicState)
+	imported, skipped, errs := i.importAll()
+	i.stateStore.UpdateErrors(errs)
+	i.stateStore.TouchLastOpsTime()
+	msg := fmt.Sprintf("Imported %d file(s), %d already present", imported, skipped)
+	log.Logger(i.ctx).Info(msg)
+	if len(errs) > 0 {
+		e := fmt.Errorf("%d file(s) could not be imported", len(errs))
+		bus.Pub(i.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg).SetError(e), model.TaskStatusError), TopicState)
+	} else {
+		bus.Pub(i.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusIdle), TopicState)
+	}
+}
+
+// importAll walks the source folder and uploads the files that were never imported.
+func (i *Importer) importAll() (imported, skipped int, errs []*common.ErrorInfo) {
+	filepath.Walk(i.source, func(p string, info os.FileInfo, e error) error {
+		if e != nil || info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") || !i.extensions[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		rel, _ := filepath.Rel(i.source, p)
+		done, er := i.importFile(p, info)
+		if er != nil {
+			log.Logger(i.ctx).Error("Cannot import " + rel + ": " + er.Error())
+			errs = append(errs, errorInfo(er, filepath.ToSlash(rel)))
+		} else if done {
+			imported++
+		} else {
+			skipped++
+		}
+		return nil
+	})
+	return
+}
+
+// importFile uploads a file unless its content was already imported. It returns false for skipped files.
+func (i *Importer) importFile(p string, info os.FileInfo) (bool, error) {
+	fileKey := []byte(fmt.Sprintf("%s|%d|%d", p, info.Size(), info.ModTime().UnixNano()))
+	var hash string
+	i.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(importFilesBucket); b != nil {
+			hash = string(b.Get(fileKey))
+		}
+		return nil
+	})
+	if hash == "" {
+		h, e := fileHash(p)
+		if e != nil {
+			return false, e
+		}
+		hash = h
+	}
+	var known bool
+	i.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(importHashesBucket); b != nil {
+			known = b.Get([]byte(hash)) != nil
+		}
+		return nil
+	})
+	if known {
+		return false, i.index(fileKey, hash, "")
+	}
+
+	targetPath, e := i.targetPath(p, info)
+	if e != nil {
+		return false, e
+	}
+	targetPath, exists, e := i.freePath(targetPath, hash)
+	if e != nil {
+		return false, e
+	}
+	if exists {
+		// Same content is already on the server
+		return false, i.index(fileKey, hash, targetPath)
+	}
+	if e := i.createParents(path.Dir(targetPath)); e != nil {
+		return false, e
+	}
+	if e := i.upload(p, targetPath, info.Size()); e != nil {
+		return false, e
+	}
+	log.Logger(i.ctx).Info("Imported " + p + " to " + targetPath)
+	return true, i.index(fileKey, hash, targetPath)
+}
+
+// index records a file as imported.
+func (i *Importer) index(fileKey []byte, hash, targetPath string) error {
+	return i.db.Update(func(tx *bbolt.Tx) error {
+		files, e := tx.CreateBucketIfNotExists(importFilesBucket)
+		if e != nil {
+			return e
+		}
+		hashes, e := tx.CreateBucketIfNotExists(importHashesBucket)
+		if e != nil {
+			return e
+		}
+		if e := files.Put(fileKey, []byte(hash)); e != nil {
+			return e
+		}
+		if hashes.Get([]byte(hash)) == nil {
+			return hashes.Put([]byte(hash), []byte(targetPath))
+		}
+		return nil
+	})
+}
+
+// targetPath renders the path template with the capture date of the file, read from its EXIF data or
+// defaulting to its modification time.
+func (i *Importer) targetPath(p string, info os.FileInfo) (string, error) {
+	taken, camera := readExifInfo(p)
+	if taken.IsZero() {
+		taken = info.ModTime()
+	}
+	ext := filepath.Ext(p)
+	vars := &importVars{
+		Year:   strconv.Itoa(taken.Year()),
+		Month:  fmt.Sprintf("%02d", taken.Month()),
+		Day:    fmt.Sprintf("%02d", taken.Day()),
+		Camera: camera,
+		Name:   strings.TrimSuffix(info.Name(), ext),
+		Ext:    ext,
+	}
+	if vars.Camera == "" {
+		vars.Camera = "Unknown"
+	}
+	buf := &bytes.Buffer{}
+	if e := i.template.Execute(buf, vars); e != nil {
+		return "", e
+	}
+	target := path.Clean("/" + strings.TrimSpace(buf.String()))
+	if target == "/" {
+		return "", fmt.Errorf("import template rendered an empty path")
+	}
+	return strings.TrimPrefix(target, "/"), nil
+}
+
+// freePath finds a free name for the target, suffixing it if another file already uses it. Exists is true
+// if a remote file with the same content is found.
+func (i *Importer) freePath(target, hash string) (string, bool, error) {
+	ext := path.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+	candidate := target
+	for n := 1; n <= maxImportNameConflicts; n++ {
+		node, e := i.target.LoadNode(i.ctx, candidate)
+		if e != nil {
+			return candidate, false, nil
+		}
+		if strings.Trim(node.Etag, "\"") == hash {
+			return candidate, true, nil
+		}
+		candidate = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	return "", false, fmt.Errorf("cannot find a free name for %s", target)
+}
+
+// createParents creates the missing remote folders of the target path.
+func (i *Importer) createParents(dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+	if _, e := i.target.LoadNode(i.ctx, dir); e == nil {
+		return nil
+	}
+	if e := i.createParents(path.Dir(dir)); e != nil {
+		return e
+	}
+	target, ok := i.target.(model.PathSyncTarget)
+	if !ok {
+		return fmt.Errorf("cannot create folders on %s", i.conf.RightURI)
+	}
+	return target.CreateNode(i.ctx, &tree.Node{Path: dir, Type: tree.NodeType_COLLECTION}, false)
+}
+
+// upload copies a local file to the remote target path.
+func (i *Importer) upload(p, targetPath string, size int64) error {
+	target, _ := model.AsDataSyncTarget(i.target)
+	reader, e := os.Open(p)
+	if e != nil {
+		return e
+	}
+	defer reader.Close()
+	writer, writeDone, writeErr, e := target.GetWriterOn(i.ctx, targetPath, size)
+	if e != nil {
+		return e
+	}
+	return writeContents(writer, writeDone, writeErr, reader)
+}
+
+// readExifInfo reads the capture date and camera model of a photo. Zero values are returned for files without
+// EXIF data.
+func readExifInfo(p string) (taken time.Time, camera string) {
+	f, e := os.Open(p)
+	if e != nil {
+		return
+	}
+	defer f.Close()
+	x, e := exif.Decode(f)
+	if e != nil {
+		return
+	}
+	if t, e := x.DateTime(); e == nil {
+		taken = t
+	}
+	if tag, e := x.Get(exif.Model); e == nil {
+		if s, e := tag.StringVal(); e == nil {
+			camera = strings.TrimSpace(strings.Trim(s, "\x00"))
+		}
+	}
+	return
+}
+
+func fileHash(p string) (string, error) {
+	f, e := os.Open(p)
+	if e != nil {
+		return "", e
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, e := io.Copy(h, f); e != nil {
+		return "", e
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
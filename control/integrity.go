@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const integrityReportFile = "integrity-report.json"
+
+// sampleIntegrityIfDue starts a spot check of the local files if the previous one is older than the interval of
+// the task. It is called while the task is idle.
+func (s *Syncer) sampleIntegrityIfDue(ctx context.Context) {
+	if s.task == nil || s.conf == nil || !s.isStarted() || runningTask(s.uuid) {
+		return
+	}
+	ratio, interval := s.conf.Integrity.Options()
+	if ratio == 0 {
+		return
+	}
+	if previous := loadIntegrityReport(s.uuid); previous != nil && time.Since(previous.Checked) < interval {
+		return
+	}
+	go s.sampleIntegrity(ctx, ratio)
+}
+
+// sampleIntegrity re-hashes a sample of the local files. Corrupted files are added to the recovery plan, so that
+// their server version can be restored while the local one is kept aside, and the user is notified.
+func (s *Syncer) sampleIntegrity(ctx context.Context, ratio float64) {
+	if !atomic.CompareAndSwapInt32(&s.integrityRunning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.integrityRunning, 0)
+	local, _, e := s.localTarget()
+	if e != nil {
+		return
+	}
+	localSource, ok := model.AsPathSyncSource(local)
+	root, isLocal := endpoint.LocalPathForURI(local.GetEndpointInfo().URI)
+	if !ok || !isLocal || s.snapFactory == nil {
+		return
+	}
+	snap, e := s.snapFactory.Load(localSource)
+	if e != nil {
+		log.Logger(ctx).Error("Cannot load snapshot for integrity check: " + e.Error())
+		return
+	}
+	keep := endpoint.FilterMatcher(taskRoots(s.conf.SelectiveRoots, s.conf.File), s.ignores)
+	report, e := endpoint.SampleIntegrity(snap, root, ratio, keep)
+	if e != nil {
+		log.Logger(ctx).Error("Cannot check integrity of local files: " + e.Error())
+		return
+	}
+	// Only report the files that can be restored from the server
+	remote := model.Endpoint(s.task.Source)
+	if remote == local {
+		remote = s.task.Target
+	}
+	var corrupted []string
+	for _, p := range report.Corrupted {
+		if n, er := remote.LoadNode(ctx, p); er == nil && n.IsLeaf() {
+			corrupted = append(corrupted, p)
+		}
+	}
+	report.Corrupted = corrupted
+	if e := saveIntegrityReport(s.uuid, report); e != nil {
+		log.Logger(ctx).Error("Cannot save integrity report: " + e.Error())
+	}
+	if len(report.Corrupted) == 0 {
+		log.Logger(ctx).Info("Integrity check: " + report.String())
+		return
+	}
+	log.Logger(ctx).Warn("Integrity check: " + report.String() + ": " + strings.Join(report.Corrupted, ", "))
+	plan, e := endpoint.LoadRecoveryPlan(taskDataPath(s.uuid))
+	if e != nil || plan == nil {
+		plan = endpoint.NewRecoveryPlan(endpoint.RecoveryOriginIntegrity)
+	}
+	for _, p := range report.Corrupted {
+		plan.Add(endpoint.RecoveryKeepBoth, p, endpoint.RiskMedium, "Local content changed without being modified, the disk may be failing: the server version is restored and the local one kept as a copy")
+	}
+	if e := endpoint.SaveRecoveryPlan(taskDataPath(s.uuid), plan); e != nil {
+		log.Logger(ctx).Error("Cannot save recovery plan: " + e.Error())
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationIntegrity,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  fmt.Sprintf(i18n.T("notification.integrity"), len(report.Corrupted)),
+	})
+}
+
+func loadIntegrityReport(syncUUID string) *endpoint.IntegrityReport {
+	data, e := ioutil.ReadFile(filepath.Join(taskDataPath(syncUUID), integrityReportFile))
+	if e != nil {
+		return nil
+	}
+	var report endpoint.IntegrityReport
+	if json.Unmarshal(data, &report) != nil {
+		return nil
+	}
+	return &report
+}
+
+func saveIntegrityReport(syncUUID string, report *endpoint.IntegrityReport) error {
+	data, e := json.MarshalIndent(report, "", "  ")
+	if e != nil {
+		return e
+	}
+	dir := taskDataPath(syncUUID)
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return e
+	}
+	return ioutil.WriteFile(filepath.Join(dir, integrityReportFile), data, 0644)
+}
+
+// getIntegrityReport returns the last integrity check of a task.
+func (h *HttpServer) getIntegrityReport(c *gin.Context) {
+	report := loadIntegrityReport(c.Param("uuid"))
+	if report == nil {
+		h.writeError(c, fmt.Errorf("no integrity report for task %s", c.Param("uuid")))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
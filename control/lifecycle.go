@@ -0,0 +1,165 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/thejerf/suture"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+)
+
+// Shutdown stages, stopped in this order: clients are disconnected first so that they do not trigger new work,
+// then the services feeding the tasks, then the tasks themselves, and finally the endpoint plugins they use.
+const (
+	stageUI = iota
+	stageBackground
+	stageTasks
+	stageEndpoints
+)
+
+// stageTimeouts is the maximum time to wait for the services of each stage.
+var stageTimeouts = []time.Duration{5 * time.Second, 10 * time.Second, 30 * time.Second, 10 * time.Second}
+
+// stageOf returns the shutdown stage of a service.
+func stageOf(svc suture.Service) int {
+	switch svc.(type) {
+	case *HttpServer, *SpawnedService, *StdInner:
+		return stageUI
+	case *Syncer, *Importer, *Archiver:
+		return stageTasks
+	}
+	return stageBackground
+}
+
+// lifecycleService wraps a service to know when its Serve method returned.
+type lifecycleService struct {
+	suture.Service
+	name   string
+	stage  int
+	mu     sync.Mutex
+	exited chan struct{}
+}
+
+// Serve implements supervisor service interface. The service may be restarted, each run has its own exit channel.
+func (l *lifecycleService) Serve() {
+	done := make(chan struct{})
+	l.mu.Lock()
+	l.exited = done
+	l.mu.Unlock()
+	defer close(done)
+	l.Service.Serve()
+}
+
+func (l *lifecycleService) String() string {
+	return l.name
+}
+
+// wait blocks until the current run of the service returned, or the context is done.
+func (l *lifecycleService) wait(ctx context.Context) error {
+	l.mu.Lock()
+	done := l.exited
+	l.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lifecycle registers the services of the supervisor with their shutdown stage.
+type lifecycle struct {
+	sync.Mutex
+	services   map[suture.ServiceToken]*lifecycleService
+	goroutines int
+}
+
+// Add registers the service in its shutdown stage and adds it to the supervisor.
+func (s *Supervisor) Add(svc suture.Service) suture.ServiceToken {
+	l := &lifecycleService{Service: svc, name: fmt.Sprintf("%T", svc), stage: stageOf(svc)}
+	token := s.Supervisor.Add(l)
+	s.lifecycle.Lock()
+	s.lifecycle.services[token] = l
+	s.lifecycle.Unlock()
+	return token
+}
+
+// Remove stops a service and removes it from the supervisor.
+func (s *Supervisor) Remove(token suture.ServiceToken) error {
+	s.lifecycle.Lock()
+	delete(s.lifecycle.services, token)
+	s.lifecycle.Unlock()
+	return s.Supervisor.Remove(token)
+}
+
+// Stop shuts the services down stage by stage before stopping the supervisor. Services of a stage are stopped
+// together, and are waited for at most the stage timeout.
+func (s *Supervisor) Stop() {
+	s.shutdown(context.Background())
+	s.Supervisor.Stop()
+}
+
+func (s *Supervisor) shutdown(ctx context.Context) {
+	for stage, timeout := range stageTimeouts {
+		s.lifecycle.Lock()
+		services := make(map[suture.ServiceToken]*lifecycleService)
+		for token, l := range s.lifecycle.services {
+			if l.stage == stage {
+				services[token] = l
+				delete(s.lifecycle.services, token)
+			}
+		}
+		s.lifecycle.Unlock()
+		stageCtx, cancel := context.WithTimeout(ctx, timeout)
+		var wg sync.WaitGroup
+		for token, l := range services {
+			s.Supervisor.Remove(token)
+			wg.Add(1)
+			go func(l *lifecycleService) {
+				defer wg.Done()
+				if e := l.wait(stageCtx); e != nil {
+					log.Logger(s.ctx).Warn(l.name + " did not stop within " + timeout.String())
+				}
+			}(l)
+		}
+		wg.Wait()
+		cancel()
+		if stage == stageEndpoints {
+			endpoint.StopPlugins()
+		}
+	}
+	checkLeaks(s.ctx, s.lifecycle.goroutines)
+}
+
+// startLifecycle records the number of goroutines running before any service is started.
+func (s *Supervisor) startLifecycle() {
+	s.lifecycle.services = make(map[suture.ServiceToken]*lifecycleService)
+	s.lifecycle.goroutines = runtime.NumGoroutine()
+}
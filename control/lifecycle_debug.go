@@ -0,0 +1,50 @@
+// +build debug
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+)
+
+// leakMargin is the number of goroutines that may outlive the services (signal handlers, bus, logger).
+const leakMargin = 10
+
+// checkLeaks compares the goroutines still running after the shutdown with the ones running at startup, and
+// dumps their stacks if some services leaked goroutines.
+func checkLeaks(ctx context.Context, before int) {
+	// Give stopped goroutines a chance to return
+	time.Sleep(500 * time.Millisecond)
+	after := runtime.NumGoroutine()
+	if after <= before+leakMargin {
+		return
+	}
+	buf := &bytes.Buffer{}
+	pprof.Lookup("goroutine").WriteTo(buf, 1)
+	log.Logger(ctx).Warn(fmt.Sprintf("%d goroutines still running after shutdown (%d at startup):\n%s", after, before, buf.String()))
+}
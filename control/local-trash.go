@@ -0,0 +1,163 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// TrashItem is an item of the trash of one of the local folders ("left" or "right") of a task.
+type TrashItem struct {
+	*endpoint.TrashedItem
+	Side string
+}
+
+// TrashRequest restores items from the trash of a task.
+type TrashRequest struct {
+	Side string
+	Ids  []string
+}
+
+// TrashResponse lists the items of the trashes of a task, or the paths restored or removed.
+type TrashResponse struct {
+	Items  []*TrashItem `json:"Items,omitempty"`
+	Paths  []string     `json:"Paths,omitempty"`
+	Errors []string     `json:"Errors,omitempty"`
+}
+
+// setupTrash makes the local endpoints of the task move deleted nodes into their trash.
+func (s *Syncer) setupTrash(endpoints ...model.Endpoint) {
+	for _, ep := range endpoints {
+		if t := endpoint.SetTrash(ep); t != nil {
+			s.trashes = append(s.trashes, t)
+		}
+	}
+}
+
+// purgeTrash removes the expired items from the trashes of the task.
+func (s *Syncer) purgeTrash(ctx context.Context) {
+	if s.conf.Trash == nil {
+		return
+	}
+	for _, t := range s.trashes {
+		report, e := t.Purge(s.conf.Trash.KeepDays, s.conf.Trash.MaxSizeGB)
+		if e != nil {
+			log.Logger(ctx).Error("Cannot purge local trash: " + e.Error())
+			if report == nil {
+				continue
+			}
+		}
+		log.Logger(ctx).Info(fmt.Sprintf("Local trash purge removed %d items, reclaimed %s, %s remaining", report.Removed, FormatSize(report.ReclaimedBytes), FormatSize(report.RemainingBytes)))
+	}
+}
+
+// taskTrashes opens the trashes of the local folders of a task, by side. They are read directly from disk, so
+// that they can be managed while the task is stopped.
+func taskTrashes(syncUUID string) (map[string]*endpoint.Trash, error) {
+	for _, t := range config.Default().Tasks {
+		if t.Uuid != syncUUID {
+			continue
+		}
+		trashes := make(map[string]*endpoint.Trash)
+		for side, uri := range map[string]string{"left": t.LeftURI, "right": t.RightURI} {
+			if root, ok := endpoint.LocalPathForURI(uri); ok {
+				trashes[side] = endpoint.NewTrash(root)
+			}
+		}
+		return trashes, nil
+	}
+	return nil, fmt.Errorf("cannot find task %s", syncUUID)
+}
+
+// listTrash returns the items of the trashes of a task.
+func (h *HttpServer) listTrash(c *gin.Context) {
+	trashes, e := taskTrashes(c.Param("uuid"))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	response := &TrashResponse{Items: []*TrashItem{}}
+	for side, t := range trashes {
+		items, e := t.List()
+		if e != nil {
+			h.writeError(c, e)
+			return
+		}
+		for _, item := range items {
+			response.Items = append(response.Items, &TrashItem{TrashedItem: item, Side: side})
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// restoreTrash moves items of a trash back to their original location, from where they are synced again.
+func (h *HttpServer) restoreTrash(c *gin.Context) {
+	var request TrashRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	trashes, e := taskTrashes(c.Param("uuid"))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	t, ok := trashes[request.Side]
+	if !ok {
+		h.writeError(c, fmt.Errorf("no local folder on side %s", request.Side))
+		return
+	}
+	response := &TrashResponse{}
+	for _, id := range request.Ids {
+		if p, e := t.Restore(id); e != nil {
+			response.Errors = append(response.Errors, e.Error())
+		} else {
+			response.Paths = append(response.Paths, p)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// emptyTrash removes all items from the trashes of a task.
+func (h *HttpServer) emptyTrash(c *gin.Context) {
+	trashes, e := taskTrashes(c.Param("uuid"))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	response := &TrashResponse{}
+	for _, t := range trashes {
+		if _, e := t.Empty(); e != nil {
+			response.Errors = append(response.Errors, e.Error())
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
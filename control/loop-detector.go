@@ -0,0 +1,151 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+const (
+	// loopWindow is the period during which direction changes on a file are counted
+	loopWindow = 10 * time.Minute
+	// loopFlips is the number of direction changes after which a file is considered bouncing
+	loopFlips = 4
+	// loopMinPaths is the number of bouncing files required to detect a loop, unless another agent wrote them
+	loopMinPaths = 3
+)
+
+// pathFlips records the last transfer direction of a file and when it changed.
+type pathFlips struct {
+	target string
+	seen   time.Time
+	flips  []time.Time
+}
+
+// loopDetector finds files transferred back and forth between both sides in a short time, which happens when the
+// same pair of folders is synced by two agents: each one re-applies the changes written by the other one.
+type loopDetector struct {
+	sync.Mutex
+	paths   map[string]*pathFlips
+	foreign map[string]string
+}
+
+func newLoopDetector() *loopDetector {
+	return &loopDetector{paths: make(map[string]*pathFlips), foreign: make(map[string]string)}
+}
+
+// record registers the file transfers of a patch, and returns the bouncing paths if a loop is detected.
+func (l *loopDetector) record(patch merger.Patch, deviceId string) (looping []string, origins []string) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	target := patch.Target().GetEndpointInfo().URI
+	localRoot, uploading := endpoint.LocalPathForURI(patch.Source().GetEndpointInfo().URI)
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile}, func(operation merger.Operation) {
+		if operation.Error() != nil {
+			return
+		}
+		p := strings.Trim(operation.GetRefPath(), "/")
+		if uploading {
+			// A file written by another agent is uploaded again
+			if origin := endpoint.ReadOrigin(localRoot, p); origin != "" && origin != deviceId {
+				l.foreign[p] = origin
+			}
+		}
+		f, ok := l.paths[p]
+		if !ok {
+			l.paths[p] = &pathFlips{target: target, seen: now}
+			return
+		}
+		f.seen = now
+		if f.target != target {
+			f.target = target
+			f.flips = append(f.flips, now)
+		}
+	})
+	var foreignLoop bool
+	for p, f := range l.paths {
+		var recent []time.Time
+		for _, t := range f.flips {
+			if now.Sub(t) < loopWindow {
+				recent = append(recent, t)
+			}
+		}
+		f.flips = recent
+		if now.Sub(f.seen) > loopWindow {
+			delete(l.paths, p)
+			delete(l.foreign, p)
+			continue
+		}
+		if len(recent) >= loopFlips {
+			looping = append(looping, p)
+			if origin, ok := l.foreign[p]; ok {
+				foreignLoop = true
+				origins = append(origins, origin)
+			}
+		}
+	}
+	if len(looping) < loopMinPaths && !foreignLoop {
+		return nil, nil
+	}
+	return
+}
+
+// reset forgets all transfers, once the user resumed the task.
+func (l *loopDetector) reset() {
+	l.Lock()
+	defer l.Unlock()
+	l.paths = make(map[string]*pathFlips)
+	l.foreign = make(map[string]string)
+}
+
+// detectLoop pauses the task and warns the user if files keep bouncing between both sides.
+func (s *Syncer) detectLoop(ctx context.Context, patch merger.Patch) {
+	if s.loops == nil {
+		return
+	}
+	looping, origins := s.loops.record(patch, config.Default().DeviceId)
+	if len(looping) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Sync loop detected: %d files were transferred back and forth (%s)", len(looping), strings.Join(looping, ", "))
+	if len(origins) > 0 {
+		msg += ", they were written by another sync agent (device " + origins[0] + ")"
+	}
+	log.Logger(ctx).Error(msg)
+	PublishNotification(&common.Notification{
+		Type:     NotificationSyncLoop,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  fmt.Sprintf(i18n.T("notification.sync-loop"), len(looping)),
+	})
+	go GetBus().Pub(MessageLoopDetected, TopicSync_+s.uuid)
+}
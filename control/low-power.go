@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+const (
+	// lowPowerHashFlush is the number of hashes kept in memory by tasks using the low-power profile.
+	lowPowerHashFlush = 100
+	// lowPowerGCPercent makes the garbage collector run more often once a low-power task is loaded.
+	lowPowerGCPercent = 50
+)
+
+var lowPowerGC sync.Once
+
+// setupLowPower applies the low-power profile to a task: no realtime watcher, a single transfer and a single
+// hashing goroutine at a time, and smaller memory caches. As the garbage collector settings are process-wide, they apply as soon as one task
+// uses this profile.
+func (s *Syncer) setupLowPower(ctx context.Context) {
+	if !s.conf.LowPower() {
+		return
+	}
+	s.watches = false
+	for _, h := range s.hashCaches {
+		h.SetFlushThreshold(lowPowerHashFlush)
+		h.SetWorkers(1)
+	}
+	lowPowerGC.Do(func() {
+		debug.SetGCPercent(lowPowerGCPercent)
+	})
+	log.Logger(ctx).Info(fmt.Sprintf("Low-power profile: no realtime watcher, scanning every %s", s.conf.ScanInterval()))
+}
+
+// lowPowerLimits forces a single parallel transfer on tasks using the low-power profile.
+func lowPowerLimits(conf *config.Task, limits *config.TransferLimits) *config.TransferLimits {
+	if !conf.LowPower() || (limits != nil && limits.Parallel == 1) {
+		return limits
+	}
+	l := config.TransferLimits{Parallel: 1}
+	if limits != nil {
+		l.UploadKB, l.DownloadKB = limits.UploadKB, limits.DownloadKB
+	}
+	return &l
+}
+
+// pollLowPower triggers a sync loop every ScanMinutes for tasks using the low-power profile.
+func (s *Syncer) pollLowPower(done chan bool) {
+	if s.conf == nil || !s.conf.LowPower() || s.conf.Manual {
+		return
+	}
+	ticker := time.NewTicker(s.conf.ScanInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !s.taskPaused && s.isStarted() {
+				GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+			}
+		case <-done:
+			return
+		}
+	}
+}
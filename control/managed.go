@@ -0,0 +1,238 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+)
+
+// managedDefaultInterval is the interval between two pulls of the organization policy.
+const managedDefaultInterval = time.Hour
+
+// SignedPolicy is the document served at the policy URL: a base64-encoded ManagedPolicy and its RSA signature
+// (PKCS#1 v1.5 with SHA-256), also base64-encoded.
+type SignedPolicy struct {
+	Payload   string
+	Signature string
+}
+
+// ManagedPolicy lists the tasks provisioned by the organization. Tasks must have a fixed Uuid. In URIs, {HOME},
+// {USER} and {DEVICE} are replaced by the home folder, login and device name of the current user. Revision must
+// increase with each new version of the policy.
+type ManagedPolicy struct {
+	Revision int
+	Tasks    []*config.Task
+}
+
+// ManagedService is a supervisor service pulling the organization policy and reconciling the managed tasks.
+type ManagedService struct {
+	ctx  context.Context
+	conf *config.Managed
+	done chan bool
+}
+
+// NewManagedService creates a new ManagedService.
+func NewManagedService(conf *config.Managed) *ManagedService {
+	ctx := servicecontext.WithServiceName(context.Background(), "managed")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &ManagedService{
+		ctx:  ctx,
+		conf: conf,
+		done: make(chan bool, 1),
+	}
+}
+
+// fetch downloads the policy and verifies its signature.
+func (m *ManagedService) fetch() (*ManagedPolicy, error) {
+	var pubKey rsa.PublicKey
+	if block, _ := pem.Decode([]byte(m.conf.PublicKey)); block == nil {
+		return nil, fmt.Errorf("cannot decode public key as PEM format")
+	} else if _, e := asn1.Unmarshal(block.Bytes, &pubKey); e != nil {
+		return nil, e
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, e := client.Get(m.conf.PolicyUrl)
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy server responded with status %d", resp.StatusCode)
+	}
+	data, e := ioutil.ReadAll(resp.Body)
+	if e != nil {
+		return nil, e
+	}
+	var signed SignedPolicy
+	if e := json.Unmarshal(data, &signed); e != nil {
+		return nil, e
+	}
+	payload, e := base64.StdEncoding.DecodeString(signed.Payload)
+	if e != nil {
+		return nil, e
+	}
+	signature, e := base64.StdEncoding.DecodeString(signed.Signature)
+	if e != nil {
+		return nil, e
+	}
+	hashed := sha256.Sum256(payload)
+	if e := rsa.VerifyPKCS1v15(&pubKey, crypto.SHA256, hashed[:], signature); e != nil {
+		return nil, fmt.Errorf("invalid policy signature: %s", e.Error())
+	}
+	var policy ManagedPolicy
+	if e := json.Unmarshal(payload, &policy); e != nil {
+		return nil, e
+	}
+	return &policy, nil
+}
+
+// expandURI replaces the user placeholders of a policy URI.
+func expandURI(uri string) string {
+	var home, login string
+	if u, e := user.Current(); e == nil {
+		home, login = u.HomeDir, u.Username
+		if i := strings.LastIndex(login, `\`); i >= 0 {
+			// Remove the Windows domain
+			login = login[i+1:]
+		}
+	}
+	return strings.NewReplacer("{HOME}", home, "{USER}", login, "{DEVICE}", config.Default().DeviceName).Replace(uri)
+}
+
+// sameTask compares two task definitions, ignoring their revisions.
+func sameTask(a, b *config.Task) bool {
+	ca, cb := *a, *b
+	ca.Revision, cb.Revision = 0, 0
+	ja, _ := json.Marshal(ca)
+	jb, _ := json.Marshal(cb)
+	return string(ja) == string(jb)
+}
+
+// reconcile creates and updates the tasks of the policy, and removes the managed tasks it does not list anymore.
+func (m *ManagedService) reconcile(policy *ManagedPolicy) {
+	conf := config.Default()
+	current := make(map[string]*config.Task)
+	for _, t := range conf.Tasks {
+		current[t.Uuid] = t
+	}
+	listed := make(map[string]bool)
+	for _, t := range policy.Tasks {
+		if t.Uuid == "" {
+			log.Logger(m.ctx).Error("Ignoring policy task " + t.Label + " without Uuid")
+			continue
+		}
+		listed[t.Uuid] = true
+		task := *t
+		task.Managed = true
+		task.LeftURI, task.RightURI = expandURI(t.LeftURI), expandURI(t.RightURI)
+		if a, _, _ := remoteAuthority(&task); a == nil {
+			log.Logger(m.ctx).Info("Policy task " + task.Label + " waits for a login on its server")
+			continue
+		}
+		existing, ok := current[task.Uuid]
+		var e error
+		if !ok {
+			log.Logger(m.ctx).Info("Creating policy task " + task.Label)
+			e = conf.CreateTask(&task)
+		} else if !sameTask(existing, &task) {
+			log.Logger(m.ctx).Info("Updating policy task " + task.Label)
+			task.Revision = existing.Revision
+			e = conf.UpdateTask(&task)
+		}
+		if e != nil {
+			log.Logger(m.ctx).Error("Cannot apply policy task " + task.Label + ": " + e.Error())
+		}
+	}
+	for _, t := range current {
+		if t.Managed && !listed[t.Uuid] {
+			log.Logger(m.ctx).Info("Removing task " + t.Label + ", not listed in policy anymore")
+			if e := conf.RemoveTask(t); e != nil {
+				log.Logger(m.ctx).Error("Cannot remove task " + t.Label + ": " + e.Error())
+			}
+		}
+	}
+}
+
+// pull fetches the policy and applies it if it is newer than the last applied one.
+func (m *ManagedService) pull() {
+	policy, e := m.fetch()
+	if e != nil {
+		log.Logger(m.ctx).Error("Cannot load organization policy: " + e.Error())
+		return
+	}
+	if policy.Revision < m.conf.AppliedRevision {
+		log.Logger(m.ctx).Warn(fmt.Sprintf("Ignoring policy revision %d, older than applied revision %d", policy.Revision, m.conf.AppliedRevision))
+		return
+	}
+	m.reconcile(policy)
+	if policy.Revision != m.conf.AppliedRevision {
+		m.conf.AppliedRevision = policy.Revision
+		if e := config.Save(); e != nil {
+			log.Logger(m.ctx).Error("Cannot save applied policy revision: " + e.Error())
+		}
+	}
+}
+
+// Serve implements supervisor service interface.
+func (m *ManagedService) Serve() {
+	if m.conf == nil || !m.conf.Enabled || m.conf.PolicyUrl == "" {
+		<-m.done
+		return
+	}
+	interval := managedDefaultInterval
+	if m.conf.IntervalMinutes > 0 {
+		interval = time.Duration(m.conf.IntervalMinutes) * time.Minute
+	}
+	log.Logger(m.ctx).Info("Managed mode enabled, pulling policy from " + m.conf.PolicyUrl + " every " + interval.String())
+	m.pull()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.pull()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (m *ManagedService) Stop() {
+	log.Logger(m.ctx).Info("Stopping managed mode")
+	m.done <- true
+}
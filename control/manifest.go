@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pydio/cells/common/log"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// manifestCacheFile stores the SHA-256 of the files by path, size and modification time, so that unchanged
+// files are not hashed again on each pass.
+const manifestCacheFile = "manifest-cache.json"
+
+// writeManifest writes the checksum manifest of the local folder in the background, if the task defines one.
+// Passes ending while a manifest is being written are skipped, the next pass catches up.
+func (s *Syncer) writeManifest(ctx context.Context) {
+	if s.conf.ManifestPath == "" || !atomic.CompareAndSwapInt32(&s.manifestRunning, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&s.manifestRunning, 0)
+		root, ok := endpoint.LocalPathForURI(s.conf.LeftURI)
+		if !ok {
+			if root, ok = endpoint.LocalPathForURI(s.conf.RightURI); !ok {
+				return
+			}
+		}
+		keep, e := taskFilter(s.conf, s.conf.SelectiveRoots, config.Default().TaskIgnores(s.conf))
+		if e != nil {
+			log.Logger(ctx).Error("Cannot write manifest: " + e.Error())
+			return
+		}
+		count, e := buildManifest(root, s.conf.ManifestPath, filepath.Join(s.configPath, manifestCacheFile), keep)
+		if e != nil {
+			log.Logger(ctx).Error("Cannot write manifest: " + e.Error())
+			return
+		}
+		log.Logger(ctx).Info(fmt.Sprintf("Wrote manifest of %d files to %s", count, s.conf.ManifestPath))
+	}()
+}
+
+// buildManifest hashes the files of root accepted by the filter, and writes them in sha256sum format, sorted by
+// path. The manifest is written to a temporary file then moved in place.
+func buildManifest(root, target, cachePath string, keep func(string) bool) (int, error) {
+	cache := make(map[string]string)
+	if data, e := ioutil.ReadFile(cachePath); e == nil {
+		json.Unmarshal(data, &cache)
+	}
+	absTarget, _ := filepath.Abs(target)
+	sums := make(map[string]string)
+	nextCache := make(map[string]string)
+	e := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || p == absTarget {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if !keep(rel) {
+			return nil
+		}
+		key := fmt.Sprintf("%s|%d|%d", rel, info.Size(), info.ModTime().UnixNano())
+		sum, ok := cache[key]
+		if !ok {
+			var e error
+			if sum, e = sha256File(p); e != nil {
+				return nil
+			}
+		}
+		sums[rel] = sum
+		nextCache[key] = sum
+		return nil
+	})
+	if e != nil {
+		return 0, e
+	}
+	paths := make([]string, 0, len(sums))
+	for p := range sums {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	temp := filepath.Join(filepath.Dir(target), endpoint.JournalTempPrefix+filepath.Base(target))
+	f, e := os.Create(temp)
+	if e != nil {
+		return 0, e
+	}
+	w := bufio.NewWriter(f)
+	for _, p := range paths {
+		fmt.Fprint(w, manifestLine(sums[p], p))
+	}
+	if e := w.Flush(); e != nil {
+		f.Close()
+		os.Remove(temp)
+		return 0, e
+	}
+	if e := f.Close(); e != nil {
+		os.Remove(temp)
+		return 0, e
+	}
+	if e := os.Rename(temp, target); e != nil {
+		os.Remove(temp)
+		return 0, e
+	}
+	if data, e := json.Marshal(nextCache); e == nil {
+		ioutil.WriteFile(cachePath, data, 0644)
+	}
+	return len(paths), nil
+}
+
+// manifestLine formats an entry like sha256sum: names containing a backslash or a newline are escaped, and the
+// line is then prefixed with a backslash.
+func manifestLine(sum, p string) string {
+	if strings.ContainsAny(p, "\\\n") {
+		p = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(p)
+		return "\\" + sum + "  " + p + "\n"
+	}
+	return sum + "  " + p + "\n"
+}
+
+func sha256File(p string) (string, error) {
+	f, e := os.Open(p)
+	if e != nil {
+		return "", e
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, e := io.Copy(h, f); e != nil {
+		return "", e
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
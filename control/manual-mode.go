@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// manual checks if the task only syncs when the user runs it.
+func (s *Syncer) manual() bool {
+	return s.conf != nil && s.conf.Manual
+}
+
+// startManual starts a manual task on its first run: the initial scan is then the run itself. It returns false if
+// the task is not in manual mode or was already started, so that the run goes on as usual.
+func (s *Syncer) startManual(ctx context.Context) bool {
+	if !s.manual() {
+		return false
+	}
+	s.startLock.Lock()
+	if s.started {
+		s.startLock.Unlock()
+		return false
+	}
+	if s.holdStart || s.manualStart {
+		// Still paused, or already waiting for a scan slot
+		s.startLock.Unlock()
+		return true
+	}
+	s.manualStart = true
+	cancel := s.startCancel
+	s.startLock.Unlock()
+	log.Logger(ctx).Info("Manual run requested, starting task")
+	s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Starting manual run"), model.TaskStatusProcessing)
+	go s.startScheduled(ctx, cancel)
+	return true
+}
@@ -0,0 +1,331 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+const (
+	MergeDriverICS     = "ics"
+	MergeDriverLines   = "lines"
+	MergeDriverCommand = "command"
+)
+
+// mergeDriverFor returns the first merge driver of the task matching the file name, or the path if the pattern
+// contains a slash.
+func mergeDriverFor(conf *config.Task, p string) *config.MergeDriver {
+	if conf == nil {
+		return nil
+	}
+	p = strings.Trim(p, "/")
+	for _, d := range conf.MergeDrivers {
+		if d.Pattern == "" {
+			continue
+		}
+		if strings.Contains(d.Pattern, "/") {
+			if endpoint.MatchGlob(d.Pattern, p) {
+				return d
+			}
+		} else if ok, _ := path.Match(d.Pattern, path.Base(p)); ok {
+			return d
+		}
+	}
+	return nil
+}
+
+// runMergeDriver merges the local and remote versions of a file, from their common base (nil if unknown). It
+// returns false if the driver cannot merge them automatically.
+func runMergeDriver(ctx context.Context, d *config.MergeDriver, p string, base, local, remote []byte, owner *endpoint.Owner) ([]byte, bool, error) {
+	switch d.Driver {
+	case MergeDriverLines:
+		return mergeLines(base, local, remote), true, nil
+	case MergeDriverICS:
+		merged, ok := mergeICS(base, local, remote)
+		return merged, ok, nil
+	case MergeDriverCommand:
+		return runMergeCommand(ctx, d.Command, p, base, local, remote, owner)
+	}
+	return nil, false, fmt.Errorf("unknown merge driver %s", d.Driver)
+}
+
+// splitLines splits contents into lines, returning the line separator and whether contents end with one.
+func splitLines(data []byte) ([]string, string, bool) {
+	text := string(data)
+	sep := "\n"
+	if strings.Contains(text, "\r\n") {
+		sep = "\r\n"
+	}
+	if text == "" {
+		return nil, sep, false
+	}
+	trailing := strings.HasSuffix(text, sep)
+	return strings.Split(strings.TrimSuffix(text, sep), sep), sep, trailing
+}
+
+// mergeLines merges plain-text lists: lines removed on the remote side since the base are removed from the local
+// version, then lines added on the remote side are appended. Without base, both lists are merged.
+func mergeLines(base, local, remote []byte) []byte {
+	baseLines, _, _ := splitLines(base)
+	localLines, sep, trailing := splitLines(local)
+	remoteLines, _, _ := splitLines(remote)
+	set := func(lines []string) map[string]bool {
+		m := make(map[string]bool, len(lines))
+		for _, l := range lines {
+			m[l] = true
+		}
+		return m
+	}
+	inBase, inLocal, inRemote := set(baseLines), set(localLines), set(remoteLines)
+	var out []string
+	for _, l := range localLines {
+		if strings.TrimSpace(l) != "" && inBase[l] && !inRemote[l] {
+			continue
+		}
+		out = append(out, l)
+	}
+	added := make(map[string]bool)
+	for _, r := range remoteLines {
+		if !inBase[r] && !inLocal[r] && !added[r] {
+			out = append(out, r)
+			added[r] = true
+		}
+	}
+	result := strings.Join(out, sep)
+	if trailing || (len(localLines) == 0 && len(out) > 0) {
+		result += sep
+	}
+	return []byte(result)
+}
+
+// icsCalendar is a parsed calendar: properties of the VCALENDAR, and its components keyed by type and UID.
+type icsCalendar struct {
+	header     []string
+	keys       []string
+	components map[string]string
+}
+
+// icsProperty reads a property of an unfolded component, without its parameters.
+func icsProperty(block, name string) string {
+	for _, l := range strings.Split(block, "\r\n") {
+		upper := strings.ToUpper(l)
+		if strings.HasPrefix(upper, name+":") || strings.HasPrefix(upper, name+";") {
+			if i := strings.Index(l, ":"); i >= 0 {
+				return l[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// parseICS splits a calendar into its components. It returns false if contents are not a calendar.
+func parseICS(data []byte) (*icsCalendar, bool) {
+	cal := &icsCalendar{components: make(map[string]string)}
+	if len(data) == 0 {
+		return cal, true
+	}
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) < 2 || strings.ToUpper(strings.TrimSpace(lines[0])) != "BEGIN:VCALENDAR" {
+		return nil, false
+	}
+	var block []string
+	var kind string
+	depth := 0
+	for _, l := range lines[1:] {
+		upper := strings.ToUpper(strings.TrimSpace(l))
+		if depth == 0 {
+			if upper == "END:VCALENDAR" {
+				return cal, true
+			}
+			if strings.HasPrefix(upper, "BEGIN:") {
+				kind = upper[len("BEGIN:"):]
+				block = []string{l}
+				depth = 1
+				continue
+			}
+			cal.header = append(cal.header, l)
+			continue
+		}
+		block = append(block, l)
+		if strings.HasPrefix(upper, "BEGIN:") {
+			depth++
+		} else if strings.HasPrefix(upper, "END:") {
+			depth--
+		}
+		if depth == 0 {
+			raw := strings.Join(block, "\r\n")
+			unfolded := strings.NewReplacer("\r\n ", "", "\r\n\t", "").Replace(raw)
+			key := kind + "|" + icsProperty(unfolded, "UID") + "|" + icsProperty(unfolded, "RECURRENCE-ID")
+			if kind == "VTIMEZONE" {
+				key = kind + "|" + icsProperty(unfolded, "TZID")
+			} else if icsProperty(unfolded, "UID") == "" {
+				key = kind + "|" + raw
+			}
+			if _, ok := cal.components[key]; !ok {
+				cal.keys = append(cal.keys, key)
+			}
+			cal.components[key] = raw
+		}
+	}
+	return nil, false
+}
+
+// icsNewer checks if component a is a more recent revision than b, comparing SEQUENCE then LAST-MODIFIED and
+// DTSTAMP (UTC dates compare as strings).
+func icsNewer(a, b string) bool {
+	unfold := strings.NewReplacer("\r\n ", "", "\r\n\t", "")
+	a, b = unfold.Replace(a), unfold.Replace(b)
+	sa, _ := strconv.Atoi(icsProperty(a, "SEQUENCE"))
+	sb, _ := strconv.Atoi(icsProperty(b, "SEQUENCE"))
+	if sa != sb {
+		return sa > sb
+	}
+	for _, prop := range []string{"LAST-MODIFIED", "DTSTAMP"} {
+		if pa, pb := icsProperty(a, prop), icsProperty(b, prop); pa != pb {
+			return pa > pb
+		}
+	}
+	return false
+}
+
+// mergeICS merges calendars component by component: changes made on one side only are applied, deleted events
+// are removed unless modified on the other side, and events modified on both sides keep their latest revision.
+// It returns false if one of the versions is not a calendar.
+func mergeICS(base, local, remote []byte) ([]byte, bool) {
+	b, ok := parseICS(base)
+	if !ok {
+		b, _ = parseICS(nil)
+	}
+	l, ok := parseICS(local)
+	if !ok {
+		return nil, false
+	}
+	r, ok := parseICS(remote)
+	if !ok {
+		return nil, false
+	}
+	keys := append([]string{}, l.keys...)
+	for _, k := range r.keys {
+		if _, ok := l.components[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString("BEGIN:VCALENDAR\r\n")
+	header := l.header
+	if len(header) == 0 {
+		header = r.header
+	}
+	for _, h := range header {
+		out.WriteString(h + "\r\n")
+	}
+	for _, k := range keys {
+		bc, inB := b.components[k]
+		lc, inL := l.components[k]
+		rc, inR := r.components[k]
+		var keep string
+		switch {
+		case inL && inR:
+			switch {
+			case lc == rc, inB && rc == bc:
+				keep = lc
+			case inB && lc == bc:
+				keep = rc
+			case icsNewer(rc, lc):
+				keep = rc
+			default:
+				keep = lc
+			}
+		case inL:
+			if inB && lc == bc {
+				continue
+			}
+			keep = lc
+		case inR:
+			if inB && rc == bc {
+				continue
+			}
+			keep = rc
+		}
+		out.WriteString(keep + "\r\n")
+	}
+	out.WriteString("END:VCALENDAR\r\n")
+	return out.Bytes(), true
+}
+
+// runMergeCommand writes the three versions to temporary files named like the original, and runs the merge
+// command on them. The merged contents are read back from the local version.
+func runMergeCommand(ctx context.Context, command []string, p string, base, local, remote []byte, owner *endpoint.Owner) ([]byte, bool, error) {
+	if len(command) == 0 {
+		return nil, false, fmt.Errorf("missing merge command")
+	}
+	dir, e := ioutil.TempDir("", "cells-sync-merge")
+	if e != nil {
+		return nil, false, e
+	}
+	defer os.RemoveAll(dir)
+	files := make(map[string]string)
+	for name, data := range map[string][]byte{"base": base, "local": local, "remote": remote} {
+		f := filepath.Join(dir, name+"-"+path.Base(p))
+		if e := ioutil.WriteFile(f, data, 0600); e != nil {
+			return nil, false, e
+		}
+		files[name] = f
+	}
+	if owner != nil {
+		for _, f := range append([]string{dir}, files["base"], files["local"], files["remote"]) {
+			os.Chown(f, owner.Uid, owner.Gid)
+		}
+	}
+	replacer := strings.NewReplacer("{base}", files["base"], "{local}", files["local"], "{remote}", files["remote"])
+	var args []string
+	for _, a := range command[1:] {
+		args = append(args, replacer.Replace(a))
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, command[0], args...)
+	cmd.Dir = dir
+	endpoint.DropPrivileges(cmd, owner)
+	if out, e := cmd.CombinedOutput(); e != nil {
+		if _, exit := e.(*exec.ExitError); exit {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("merge command failed: %s %s", e.Error(), strings.TrimSpace(string(out)))
+	}
+	merged, e := ioutil.ReadFile(files["local"])
+	if e != nil {
+		return nil, false, e
+	}
+	return merged, true, nil
+}
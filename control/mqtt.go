@@ -0,0 +1,247 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// MqttTaskState is the JSON payload published for each task on {prefix}/tasks/{uuid}/state.
+type MqttTaskState struct {
+	Uuid           string
+	Label          string
+	Status         string
+	Connected      bool
+	LastSyncTime   time.Time
+	LastOpsTime    time.Time
+	UpRate         int64
+	DownRate       int64
+	ProcessMessage string
+}
+
+// MqttSummary is the JSON payload published on {prefix}/status, aggregating all tasks.
+type MqttSummary struct {
+	Status     string
+	Tasks      int
+	Processing int
+	Errors     int
+	Paused     int
+}
+
+// mqttQueueSize is the number of messages waiting to be sent to the broker. Newer messages are dropped when
+// the broker is too slow, the next state change publishes the task and summary states again.
+const mqttQueueSize = 100
+
+type mqttMessage struct {
+	topic  string
+	data   []byte
+	retain bool
+}
+
+// MqttPublisher is a supervisor service publishing tasks states to an MQTT broker.
+type MqttPublisher struct {
+	ctx      context.Context
+	conf     *config.Mqtt
+	client   mqtt.Client
+	done     chan bool
+	states   map[string]*MqttTaskState
+	outgoing chan *mqttMessage
+}
+
+// NewMqttPublisher creates a new MqttPublisher service.
+func NewMqttPublisher(conf *config.Mqtt) *MqttPublisher {
+	ctx := servicecontext.WithServiceName(context.Background(), "mqtt")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &MqttPublisher{
+		ctx:    ctx,
+		conf:   conf,
+		done:   make(chan bool, 1),
+		states: make(map[string]*MqttTaskState),
+	}
+}
+
+func (m *MqttPublisher) topic(suffix string) string {
+	prefix := m.conf.TopicPrefix
+	if prefix == "" {
+		prefix = "cells-sync"
+	}
+	return prefix + "/" + suffix
+}
+
+// publish queues a payload for the sender, without waiting for the broker.
+func (m *MqttPublisher) publish(topic string, payload interface{}) {
+	data, e := json.Marshal(payload)
+	if e != nil {
+		return
+	}
+	m.enqueue(&mqttMessage{topic: topic, data: data, retain: m.conf.Retain})
+}
+
+func (m *MqttPublisher) enqueue(msg *mqttMessage) {
+	select {
+	case m.outgoing <- msg:
+	default:
+		log.Logger(m.ctx).Warn("MQTT broker is too slow, dropping message for " + msg.topic)
+	}
+}
+
+// send publishes the queued messages until the queue is closed.
+func (m *MqttPublisher) send() {
+	for msg := range m.outgoing {
+		token := m.client.Publish(msg.topic, 0, msg.retain, msg.data)
+		if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+			log.Logger(m.ctx).Error("Cannot publish to " + msg.topic + ": " + token.Error().Error())
+		}
+	}
+}
+
+func (m *MqttPublisher) taskState(s common.SyncState) *MqttTaskState {
+	t := &MqttTaskState{
+		Uuid:         s.UUID,
+		Status:       common.StatusLabel(s.Status),
+		Connected:    s.LeftInfo != nil && s.RightInfo != nil && s.LeftInfo.Connected && s.RightInfo.Connected,
+		LastSyncTime: s.LastSyncTime,
+		LastOpsTime:  s.LastOpsTime,
+	}
+	if s.Config != nil {
+		t.Label = s.Config.Label
+	}
+	if s.Throughput != nil {
+		t.UpRate = s.Throughput.UpRate
+		t.DownRate = s.Throughput.DownRate
+	}
+	if s.LastProcessStatus != nil {
+		t.ProcessMessage = s.LastProcessStatus.String()
+	}
+	return t
+}
+
+// changed compares two states ignoring volatile fields, to avoid flooding the broker with progress events.
+func (t *MqttTaskState) changed(other *MqttTaskState) bool {
+	return other == nil || t.Status != other.Status || t.Connected != other.Connected ||
+		t.LastOpsTime != other.LastOpsTime || (t.Status != "processing" && t.ProcessMessage != other.ProcessMessage)
+}
+
+// summary counts each task once. Paused and disabled tasks are not expected to be connected, other tasks are in
+// error when one of their endpoints is disconnected.
+func (m *MqttPublisher) summary() *MqttSummary {
+	sum := &MqttSummary{Status: "idle", Tasks: len(m.states)}
+	for _, t := range m.states {
+		switch {
+		case t.Status == "paused" || t.Status == "disabled":
+			sum.Paused++
+		case t.Status == "error" || !t.Connected:
+			sum.Errors++
+		case t.Status == "processing":
+			sum.Processing++
+		}
+	}
+	if sum.Errors > 0 {
+		sum.Status = "error"
+	} else if sum.Processing > 0 {
+		sum.Status = "processing"
+	} else if sum.Tasks > 0 && sum.Paused == sum.Tasks {
+		sum.Status = "paused"
+	}
+	return sum
+}
+
+// Serve implements supervisor service interface.
+func (m *MqttPublisher) Serve() {
+	if m.conf == nil || !m.conf.Enabled || m.conf.BrokerUrl == "" {
+		<-m.done
+		return
+	}
+	opts := mqtt.NewClientOptions().AddBroker(m.conf.BrokerUrl).SetClientID(m.conf.ClientId)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectTimeout(10 * time.Second)
+	if m.conf.Username != "" {
+		opts.SetUsername(m.conf.Username)
+		opts.SetPassword(m.conf.Secret())
+	}
+	opts.SetWill(m.topic("availability"), "offline", 0, true)
+	m.client = mqtt.NewClient(opts)
+	if token := m.client.Connect(); token.Wait() && token.Error() != nil {
+		log.Logger(m.ctx).Error("Cannot connect to MQTT broker: " + token.Error().Error())
+		// Let the supervisor restart the service later
+		panic(fmt.Errorf("cannot connect to mqtt broker %s", m.conf.BrokerUrl))
+	}
+	log.Logger(m.ctx).Info("Connected to MQTT broker " + m.conf.BrokerUrl)
+	m.client.Publish(m.topic("availability"), 0, true, "online")
+
+	m.outgoing = make(chan *mqttMessage, mqttQueueSize)
+	sent := make(chan struct{})
+	go func() {
+		m.send()
+		close(sent)
+	}()
+
+	bus := GetBus()
+	states := bus.Sub(TopicState)
+	defer func() {
+		bus.Unsub(states, TopicState)
+		close(m.outgoing)
+		<-sent
+		m.client.Publish(m.topic("availability"), 0, true, "offline").WaitTimeout(2 * time.Second)
+		m.client.Disconnect(250)
+	}()
+	go bus.Pub(MessagePublishState, TopicSyncAll)
+	for {
+		select {
+		case s := <-states:
+			state, ok := s.(common.SyncState)
+			if !ok {
+				break
+			}
+			if state.Status == model.TaskStatusRemoved {
+				delete(m.states, state.UUID)
+				// Clear the retained state of the task
+				m.enqueue(&mqttMessage{topic: m.topic("tasks/" + state.UUID + "/state"), data: []byte{}, retain: true})
+			} else {
+				newState := m.taskState(state)
+				if !newState.changed(m.states[state.UUID]) {
+					break
+				}
+				m.states[state.UUID] = newState
+				m.publish(m.topic("tasks/"+state.UUID+"/state"), newState)
+			}
+			m.publish(m.topic("status"), m.summary())
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (m *MqttPublisher) Stop() {
+	log.Logger(m.ctx).Info("Stopping MQTT publisher")
+	m.done <- true
+}
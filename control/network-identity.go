@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"net"
+	"sync"
+)
+
+// NetworkIdentity describes the network currently used to reach the servers.
+type NetworkIdentity struct {
+	// SSID is the name of the Wi-Fi network, empty on wired connections
+	SSID string
+	// Interface is the name of the interface holding the default route
+	Interface string
+}
+
+// Name returns the SSID, or the interface name if not on Wi-Fi.
+func (n NetworkIdentity) Name() string {
+	if n.SSID != "" {
+		return n.SSID
+	}
+	return n.Interface
+}
+
+// Matches returns true if a rule network (SSID or interface name, or * for any) designates this network.
+func (n NetworkIdentity) Matches(network string) bool {
+	return network == "*" || (network != "" && (network == n.SSID || network == n.Interface))
+}
+
+var currentNetwork struct {
+	sync.RWMutex
+	identity NetworkIdentity
+}
+
+// detectNetworkIdentity refreshes the current network identity. Reading the SSID may spawn a command, it is only
+// called at startup and when a network change is detected.
+func detectNetworkIdentity() NetworkIdentity {
+	id := NetworkIdentity{Interface: defaultInterface()}
+	if ssid, e := wifiSSID(); e == nil {
+		id.SSID = ssid
+	}
+	currentNetwork.Lock()
+	currentNetwork.identity = id
+	currentNetwork.Unlock()
+	return id
+}
+
+// CurrentNetwork returns the last detected network identity.
+func CurrentNetwork() NetworkIdentity {
+	currentNetwork.RLock()
+	defer currentNetwork.RUnlock()
+	return currentNetwork.identity
+}
+
+// defaultInterface finds the interface used for outgoing connections. Dialing UDP does not send any packet.
+func defaultInterface() string {
+	conn, e := net.Dial("udp", "192.0.2.1:80")
+	if e != nil {
+		return ""
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+	ifaces, e := net.Interfaces()
+	if e != nil {
+		return ""
+	}
+	for _, i := range ifaces {
+		addrs, e := i.Addrs()
+		if e != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(local) {
+				return i.Name
+			}
+		}
+	}
+	return ""
+}
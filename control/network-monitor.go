@@ -0,0 +1,130 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+)
+
+// NetworkMonitor is a supervisor service detecting network changes (e.g. moving from office to home) by watching
+// the addresses of the network interfaces. The network identity (SSID or interface) used by bandwidth rules is
+// detected again on each change. The system proxy settings are evaluated again on each change, and periodically
+// in case they were modified by the user. Servers declaring several URLs are switched to the first one reachable
+// from the new network.
+type NetworkMonitor struct {
+	ctx      context.Context
+	done     chan bool
+	interval time.Duration
+	refresh  time.Duration
+	current  string
+}
+
+// NewNetworkMonitor creates a new NetworkMonitor service.
+func NewNetworkMonitor() *NetworkMonitor {
+	ctx := servicecontext.WithServiceName(context.Background(), "network")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorRest)
+	return &NetworkMonitor{
+		ctx:      ctx,
+		done:     make(chan bool, 1),
+		interval: 30 * time.Second,
+		refresh:  15 * time.Minute,
+	}
+}
+
+// Serve implements supervisor service interface.
+func (n *NetworkMonitor) Serve() {
+	n.current = networkFingerprint()
+	detectNetworkIdentity()
+	n.refreshProxy()
+	go n.selectServerURLs()
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if fp := networkFingerprint(); fp != n.current {
+				n.current = fp
+				id := detectNetworkIdentity()
+				log.Logger(n.ctx).Info("Network change detected (now on " + id.Name() + "), evaluating proxy settings again")
+				endpoint.NetworkChanged()
+				n.refreshProxy()
+				go n.selectServerURLs()
+				last = time.Now()
+			} else if time.Since(last) > n.refresh {
+				n.refreshProxy()
+				last = time.Now()
+			}
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (n *NetworkMonitor) Stop() {
+	log.Logger(n.ctx).Info("Stopping network monitor")
+	n.done <- true
+}
+
+func (n *NetworkMonitor) refreshProxy() {
+	if e := config.RefreshSystemProxy(); e != nil {
+		log.Logger(n.ctx).Debug("Cannot read system proxy settings: " + e.Error())
+	}
+}
+
+// selectServerURLs switches the servers declaring alternate URLs to the first one reachable on the current network.
+func (n *NetworkMonitor) selectServerURLs() {
+	for _, a := range config.Default().SelectAuthorityURIs(CurrentNetwork().Name()) {
+		log.Logger(n.ctx).Info("Now reaching " + a.Id + " through " + a.BaseURL())
+	}
+}
+
+// networkFingerprint lists the addresses of the active, non-loopback interfaces.
+func networkFingerprint() string {
+	ifaces, e := net.Interfaces()
+	if e != nil {
+		return ""
+	}
+	var addrs []string
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		aa, e := i.Addrs()
+		if e != nil {
+			continue
+		}
+		for _, a := range aa {
+			addrs = append(addrs, i.Name+"/"+a.String())
+		}
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+// recordNodeMeta updates the per-node metadata store with the results of a patch: last errors, conflicts and
+// paths that cannot be created locally. Metadata follows moves and is dropped on deletes.
+func (s *Syncer) recordNodeMeta(ctx context.Context, patch merger.Patch) {
+	if s.nodeMeta == nil {
+		return
+	}
+	set := func(p, key, value string) {
+		if e := s.nodeMeta.Set(p, key, value); e != nil {
+			log.Logger(ctx).Error("Cannot store metadata for " + p + ": " + e.Error())
+		}
+	}
+	patch.WalkOperations([]merger.OperationType{
+		merger.OpCreateFile, merger.OpUpdateFile, merger.OpCreateFolder, merger.OpMoveFile, merger.OpMoveFolder, merger.OpDelete, merger.OpConflict,
+	}, func(operation merger.Operation) {
+		p := operation.GetRefPath()
+		switch operation.Type() {
+		case merger.OpConflict:
+			set(p, endpoint.MetaConflict, "true")
+			return
+		case merger.OpDelete:
+			if operation.Error() == nil {
+				s.nodeMeta.Delete(p)
+				return
+			}
+		case merger.OpMoveFile, merger.OpMoveFolder:
+			if operation.Error() == nil {
+				s.nodeMeta.Move(operation.GetMoveOriginPath(), p)
+			}
+		}
+		if err := operation.Error(); err != nil {
+			set(p, endpoint.MetaLastError, err.Error())
+			if v, ok := errors.Cause(err).(*endpoint.PathViolation); ok {
+				set(p, endpoint.MetaMangledName, v.Suggested)
+			}
+		} else {
+			set(p, endpoint.MetaLastError, "")
+			set(p, endpoint.MetaMangledName, "")
+		}
+	})
+	s.publishConflictCopies()
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+const (
+	// digestQuiet is the time without new patch after which a burst is considered finished.
+	digestQuiet = 30 * time.Second
+	// digestMaxWait sends a digest for long bursts, so that the user is informed of the progress.
+	digestMaxWait = 10 * time.Minute
+	// digestMaxGroups is the number of top-level folders named in a digest, others are counted together.
+	digestMaxGroups = 2
+)
+
+// transferDigest aggregates the files transferred by the patches of a burst, per top-level folder.
+type transferDigest struct {
+	sync.Mutex
+	groups  map[string]int
+	files   int
+	bytes   int64
+	started time.Time
+	timer   *time.Timer
+	send    func(n *common.Notification)
+}
+
+func newTransferDigest(send func(n *common.Notification)) *transferDigest {
+	return &transferDigest{groups: make(map[string]int), send: send}
+}
+
+// topFolder returns the first segment of a path, or an empty string for files at the root.
+func topFolder(p string) string {
+	p = strings.Trim(p, "/")
+	if i := strings.Index(p, "/"); i > 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+// add records the files successfully transferred by a patch, and postpones the digest until the burst ends.
+func (d *transferDigest) add(patch merger.Patch) {
+	d.Lock()
+	defer d.Unlock()
+	var count int
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile}, func(operation merger.Operation) {
+		if operation.Error() != nil {
+			return
+		}
+		d.groups[topFolder(operation.GetRefPath())]++
+		d.files++
+		if n := operation.GetNode(); n != nil {
+			d.bytes += n.GetSize()
+		}
+		count++
+	})
+	if count == 0 {
+		return
+	}
+	if d.started.IsZero() {
+		d.started = time.Now()
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	wait := digestQuiet
+	if remaining := digestMaxWait - time.Since(d.started); remaining < wait {
+		wait = remaining
+	}
+	d.timer = time.AfterFunc(wait, d.flush)
+}
+
+// flush sends the digest of the current burst and starts a new one.
+func (d *transferDigest) flush() {
+	d.Lock()
+	if d.files == 0 {
+		d.Unlock()
+		return
+	}
+	message := digestMessage(d.groups, d.files, d.bytes, time.Since(d.started))
+	d.groups = make(map[string]int)
+	d.files, d.bytes, d.started, d.timer = 0, 0, time.Time{}, nil
+	d.Unlock()
+	d.send(&common.Notification{
+		Type:    NotificationDigest,
+		Message: message,
+		Actions: []*common.NotificationAction{
+			{Id: ActionShowActivity, Label: i18n.T("notification.digest.show")},
+		},
+	})
+}
+
+// formatCount formats a number with thousands separators.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// digestMessage describes a burst, naming the folders with the most files first.
+func digestMessage(groups map[string]int, files int, bytes int64, duration time.Duration) string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if groups[names[i]] != groups[names[j]] {
+			return groups[names[i]] > groups[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	details := fmt.Sprintf(i18n.T("notification.digest.details"), FormatSize(bytes), duration.Round(time.Second).String())
+	if len(names) == 1 {
+		folder := names[0]
+		if folder == "" {
+			folder = i18n.T("notification.digest.root")
+		}
+		return fmt.Sprintf(i18n.T("notification.digest.single"), formatCount(files), folder, details)
+	}
+	var parts []string
+	others := files
+	for i, name := range names {
+		if i >= digestMaxGroups || name == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(i18n.T("notification.digest.group"), formatCount(groups[name]), name))
+		others -= groups[name]
+	}
+	if others > 0 {
+		parts = append(parts, fmt.Sprintf(i18n.T("notification.digest.others"), formatCount(others)))
+	}
+	return fmt.Sprintf(i18n.T("notification.digest.multiple"), formatCount(files), strings.Join(parts, ", "), details)
+}
+
+// recordDigest feeds the transfer digest with the files of a patch, if digests are enabled for the task.
+func (s *Syncer) recordDigest(patch merger.Patch) {
+	if s.digest != nil {
+		s.digest.add(patch)
+	}
+}
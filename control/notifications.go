@@ -0,0 +1,349 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	NotificationConflict     = "conflict"
+	NotificationAuthExpired  = "auth-expired"
+	NotificationPathLimit    = "path-limit"
+	NotificationReadOnly     = "read-only"
+	NotificationCloudFolder  = "cloud-folder"
+	NotificationSyncLoop     = "sync-loop"
+	NotificationConflictCopy = "conflict-copy"
+	NotificationRetention    = "retention"
+	NotificationSafeMode     = "safe-mode"
+	NotificationDigest       = "digest"
+	NotificationRecovery     = "recovery"
+	NotificationDrift        = "drift"
+	NotificationIntegrity    = "integrity"
+	NotificationMigration    = "migration"
+
+	ActionKeepLocal    = "keep-local"
+	ActionKeepRemote   = "keep-remote"
+	ActionKeepBoth     = "keep-both"
+	ActionKeepOriginal = "keep-original"
+	ActionKeepCopy     = "keep-copy"
+	ActionLogin        = "login"
+	ActionRenameRemote = "rename-remote"
+	ActionSnooze       = "snooze"
+	ActionShowActivity = "show-activity"
+	ActionRecoverySafe = "recovery-apply-safe"
+
+	maxConflictNotifications = 3
+	// Actionable notifications are forgotten after this delay, or when too many are pending
+	pendingNotificationsTTL = 7 * 24 * time.Hour
+	maxPendingNotifications = 200
+)
+
+// ConflictResolution is sent to a Syncer to resolve a conflict by overriding one side with the other one, or by
+// keeping both versions. Copy is the path of the conflict copy when choosing between a file and its copy.
+type ConflictResolution struct {
+	Path string
+	Copy string
+	Keep string
+}
+
+// ErrorSnooze is sent to a Syncer to hide an error, or all errors on a path, for a number of days.
+type ErrorSnooze struct {
+	Fingerprint string
+	Path        string
+	Days        int
+}
+
+// RemoteRename is sent to a Syncer to rename a remote node whose path cannot be created locally.
+type RemoteRename struct {
+	Path    string
+	NewPath string
+}
+
+type pendingNotification struct {
+	*common.Notification
+	published time.Time
+}
+
+var (
+	pendingNotifications     = make(map[string]*pendingNotification)
+	pendingNotificationsLock = &sync.Mutex{}
+)
+
+// PublishNotification registers a notification if it is actionable, and sends it to the UI clients.
+func PublishNotification(n *common.Notification) {
+	if n.Id == "" {
+		n.Id = uuid.New()
+	}
+	if len(n.Actions) > 0 {
+		pendingNotificationsLock.Lock()
+		prunePendingNotifications(time.Now())
+		pendingNotifications[n.Id] = &pendingNotification{Notification: n, published: time.Now()}
+		pendingNotificationsLock.Unlock()
+	}
+	go GetBus().Pub(n, TopicNotification)
+}
+
+// prunePendingNotifications forgets the notifications that were not answered in time, then the oldest ones if
+// there are still too many. It must be called with the lock held.
+func prunePendingNotifications(now time.Time) {
+	var remaining []*pendingNotification
+	for id, n := range pendingNotifications {
+		if now.Sub(n.published) > pendingNotificationsTTL {
+			delete(pendingNotifications, id)
+		} else {
+			remaining = append(remaining, n)
+		}
+	}
+	if len(remaining) < maxPendingNotifications {
+		return
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		return remaining[i].published.Before(remaining[j].published)
+	})
+	for _, n := range remaining[:len(remaining)-maxPendingNotifications+1] {
+		delete(pendingNotifications, n.Id)
+	}
+}
+
+// HandleNotificationResponse dispatches an action chosen by the user on a notification.
+func HandleNotificationResponse(r *common.NotificationResponse) error {
+	pendingNotificationsLock.Lock()
+	pending, ok := pendingNotifications[r.Id]
+	if ok {
+		delete(pendingNotifications, r.Id)
+	}
+	pendingNotificationsLock.Unlock()
+	if !ok {
+		return fmt.Errorf("notification %s is unknown or was already handled", r.Id)
+	}
+	n := pending.Notification
+	switch r.Action {
+	case ActionKeepLocal, ActionKeepRemote, ActionKeepBoth:
+		if n.Type != NotificationConflict || n.TaskUuid == "" {
+			return fmt.Errorf("action %s is not supported for this notification", r.Action)
+		}
+		go GetBus().Pub(&ConflictResolution{Path: n.Path, Keep: r.Action}, TopicSync_+n.TaskUuid)
+	case ActionKeepOriginal, ActionKeepCopy:
+		if n.Type != NotificationConflictCopy || n.TaskUuid == "" || n.Suggested == "" {
+			return fmt.Errorf("action %s is not supported for this notification", r.Action)
+		}
+		go GetBus().Pub(&ConflictResolution{Path: n.Path, Copy: n.Suggested, Keep: r.Action}, TopicSync_+n.TaskUuid)
+	case ActionRenameRemote:
+		if n.Type != NotificationPathLimit || n.TaskUuid == "" || n.Suggested == "" {
+			return fmt.Errorf("action %s is not supported for this notification", r.Action)
+		}
+		go GetBus().Pub(&RemoteRename{Path: n.Path, NewPath: n.Suggested}, TopicSync_+n.TaskUuid)
+	case ActionSnooze:
+		if n.TaskUuid == "" || n.Path == "" {
+			return fmt.Errorf("action %s is not supported for this notification", r.Action)
+		}
+		go GetBus().Pub(&ErrorSnooze{Path: n.Path, Days: DefaultSnoozeDays}, TopicSync_+n.TaskUuid)
+	case ActionShowActivity:
+		// Ask an opened UI to display the tasks list with the detailed activity
+		go GetBus().Pub(&common.Message{Type: "WEBVIEW_ROUTE", Content: "/"}, TopicNotification)
+	case ActionRecoverySafe:
+		if n.Type != NotificationRecovery || n.TaskUuid == "" {
+			return fmt.Errorf("action %s is not supported for this notification", r.Action)
+		}
+		go GetBus().Pub(&RecoveryApproval{MaxRisk: endpoint.RiskLow}, TopicSync_+n.TaskUuid)
+	case ActionLogin:
+		// Ask an opened UI to display the servers page
+		go GetBus().Pub(&common.Message{Type: "WEBVIEW_ROUTE", Content: "/servers"}, TopicNotification)
+	default:
+		return fmt.Errorf("unknown action %s", r.Action)
+	}
+	return nil
+}
+
+// notifyConflictPaths sends a notification for the first conflicting paths, with the resolution actions.
+func notifyConflictPaths(taskUuid string, taskLabel string, paths []string) {
+	for i, p := range paths {
+		if i >= maxConflictNotifications {
+			return
+		}
+		PublishNotification(&common.Notification{
+			Type:     NotificationConflict,
+			TaskUuid: taskUuid,
+			Path:     p,
+			Title:    taskLabel,
+			Message:  fmt.Sprintf(i18n.T("notification.conflict"), p),
+			Actions: []*common.NotificationAction{
+				{Id: ActionKeepLocal, Label: i18n.T("notification.conflict.keep-local")},
+				{Id: ActionKeepRemote, Label: i18n.T("notification.conflict.keep-remote")},
+				{Id: ActionKeepBoth, Label: i18n.T("notification.conflict.keep-both")},
+			},
+		})
+	}
+}
+
+// notifyPathViolations sends a notification for the first operations that could not be applied because of
+// local path limits, suggesting to rename the remote node. Errors that were already notified recently or that
+// are snoozed in the registry are skipped.
+func notifyPathViolations(taskUuid string, taskLabel string, patch merger.Patch, registry *errorRegistry) {
+	var count int
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile, merger.OpCreateFolder, merger.OpMoveFile, merger.OpMoveFolder}, func(operation merger.Operation) {
+		v, ok := errors.Cause(operation.Error()).(*endpoint.PathViolation)
+		if !ok {
+			return
+		}
+		if registry != nil && !registry.shouldNotify(errorFingerprint(errorInfo(operation.Error(), operation.GetRefPath()))) {
+			return
+		}
+		count++
+		if count > maxConflictNotifications {
+			return
+		}
+		n := &common.Notification{
+			Type:      NotificationPathLimit,
+			TaskUuid:  taskUuid,
+			Path:      v.Path,
+			Suggested: v.Suggested,
+			Title:     taskLabel,
+			Message:   fmt.Sprintf(i18n.T("notification.path-limit"), v.Path, v.Reason),
+		}
+		if v.Suggested != "" {
+			n.Actions = append(n.Actions, &common.NotificationAction{Id: ActionRenameRemote, Label: fmt.Sprintf(i18n.T("notification.path-limit.rename"), path.Base(v.Suggested))})
+		}
+		n.Actions = append(n.Actions, &common.NotificationAction{Id: ActionSnooze, Label: i18n.T("notification.snooze")})
+		PublishNotification(n)
+	})
+}
+
+// renameRemote moves a node on the remote side of the task, then triggers a sync loop.
+func (s *Syncer) renameRemote(ctx context.Context, r *RemoteRename) error {
+	remote := model.Endpoint(s.task.Target)
+	if !strings.HasPrefix(model.Endpoint(s.task.Source).GetEndpointInfo().URI, "fs://") {
+		remote = s.task.Source
+	}
+	target, ok := model.AsPathSyncTarget(remote)
+	if !ok {
+		return fmt.Errorf("cannot rename nodes on %s", remote.GetEndpointInfo().URI)
+	}
+	if e := target.MoveNode(ctx, r.Path, r.NewPath); e != nil {
+		return e
+	}
+	if s.nodeMeta != nil {
+		s.nodeMeta.Set(r.Path, endpoint.MetaMangledName, "")
+	}
+	go GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+	return nil
+}
+
+// resolveConflict copies the file from the side to keep to the other side. Changes are propagated by the sync
+// loop triggered once all resolutions of a request are applied.
+func (s *Syncer) resolveConflict(ctx context.Context, r *ConflictResolution) error {
+	switch r.Keep {
+	case ActionKeepBoth:
+		return s.keepBoth(ctx, r.Path)
+	case ActionKeepOriginal, ActionKeepCopy:
+		return s.resolveConflictCopy(ctx, r)
+	}
+	var from, to model.Endpoint
+	left, right := model.Endpoint(s.task.Source), model.Endpoint(s.task.Target)
+	leftLocal := strings.HasPrefix(left.GetEndpointInfo().URI, "fs://")
+	if (r.Keep == ActionKeepLocal) == leftLocal {
+		from, to = left, right
+	} else {
+		from, to = right, left
+	}
+	node, e := from.LoadNode(ctx, r.Path)
+	if e != nil {
+		return e
+	}
+	if !node.IsLeaf() {
+		return fmt.Errorf("conflict resolution is only supported on files")
+	}
+	source, ok := model.AsDataSyncSource(from)
+	if !ok {
+		return fmt.Errorf("cannot read data from %s", from.GetEndpointInfo().URI)
+	}
+	target, ok := model.AsDataSyncTarget(to)
+	if !ok {
+		return fmt.Errorf("cannot write data to %s", to.GetEndpointInfo().URI)
+	}
+	reader, e := source.GetReaderOn(r.Path)
+	if e != nil {
+		return e
+	}
+	defer reader.Close()
+	writer, writeDone, writeErr, e := target.GetWriterOn(ctx, r.Path, node.Size)
+	if e != nil {
+		return e
+	}
+	if e := writeContents(writer, writeDone, writeErr, reader); e != nil {
+		return e
+	}
+	if s.nodeMeta != nil {
+		s.nodeMeta.Set(r.Path, endpoint.MetaConflict, "")
+	}
+	return nil
+}
+
+// abortWriteTimeout is how long a target is waited for after its writer was closed with an error.
+const abortWriteTimeout = 30 * time.Second
+
+// writeContents copies reader to a writer opened with GetWriterOn, and waits until the target is written. If the
+// copy fails, the writer is closed with the error, so that the target does not commit partial contents.
+func writeContents(writer io.WriteCloser, writeDone chan bool, writeErr chan error, reader io.Reader) error {
+	if _, e := io.Copy(writer, reader); e != nil {
+		if w, ok := writer.(interface{ CloseWithError(error) error }); ok {
+			w.CloseWithError(e)
+		} else {
+			writer.Close()
+		}
+		// Wait for the target to give up
+		select {
+		case <-writeErr:
+		case <-writeDone:
+		case <-time.After(abortWriteTimeout):
+		}
+		return e
+	}
+	writer.Close()
+	if writeDone == nil && writeErr == nil {
+		return nil
+	}
+	select {
+	case _, ok := <-writeDone:
+		if !ok {
+			return fmt.Errorf("write was interrupted")
+		}
+	case e := <-writeErr:
+		return e
+	}
+	return nil
+}
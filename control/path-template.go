@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+)
+
+// templatedTask returns the task to run: a copy whose remote root variables are resolved, if it has any. As the
+// resolved root may change between runs (e.g. with {date}), snapshots of each resolved root are kept apart.
+func templatedTask(conf *config.Task, configPath string) (*config.Task, string, error) {
+	uri := *remoteURI(conf)
+	if !endpoint.HasPathTemplate(uri) {
+		return conf, configPath, nil
+	}
+	resolved, e := endpoint.ResolvePathTemplate(uri, config.GetClock().Now())
+	if e != nil {
+		return conf, configPath, e
+	}
+	c := *conf
+	*remoteURI(&c) = resolved
+	sum := sha1.Sum([]byte(resolved))
+	return &c, filepath.Join(configPath, "roots", hex.EncodeToString(sum[:8])), nil
+}
+
+// createTemplatedRoot creates the resolved remote root of a task if its configured root has variables.
+func createTemplatedRoot(ctx context.Context, conf *config.Task, resolved *config.Task) error {
+	if !endpoint.HasPathTemplate(*remoteURI(conf)) {
+		return nil
+	}
+	log.Logger(ctx).Info("Remote root resolved to " + *remoteURI(resolved) + ", creating it if necessary")
+	return endpoint.CreateRemoteRoot(ctx, *remoteURI(resolved))
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// pausedUntilFile stores the expiry of a timed pause, so that the pause survives a restart.
+const pausedUntilFile = "paused-until"
+
+// PauseUntil is published on the task topic to pause it until a given time.
+type PauseUntil struct {
+	Until time.Time
+}
+
+// PauseUntilRequest is posted to pause a task either until a date or for a duration.
+type PauseUntilRequest struct {
+	Until    string `json:"Until,omitempty"`
+	Duration string `json:"Duration,omitempty"`
+}
+
+// ParsePauseUntil reads the end of a timed pause. It accepts full dates ("2006-01-02 15:04", RFC3339), a time of
+// day ("9:00", next occurrence) or a weekday with an optional time ("monday 9:00", next occurrence, midnight by
+// default).
+func ParsePauseUntil(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, e := time.Parse(time.RFC3339, value); e == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, e := time.ParseInLocation(layout, value, now.Location()); e == nil {
+			return t, nil
+		}
+	}
+	parts := strings.Fields(strings.ToLower(value))
+	if len(parts) == 0 || len(parts) > 2 {
+		return time.Time{}, fmt.Errorf("cannot read pause end %q", value)
+	}
+	day := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if parts[0] == name || parts[0] == name[:3] {
+			day = int(d)
+		}
+	}
+	clock := parts[len(parts)-1]
+	if day >= 0 && len(parts) == 1 {
+		clock = "0:00"
+	} else if day < 0 && len(parts) == 2 {
+		return time.Time{}, fmt.Errorf("cannot read pause end %q", value)
+	}
+	hm, e := time.Parse("15:04", clock)
+	if e != nil {
+		return time.Time{}, fmt.Errorf("cannot read pause end %q", value)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), hm.Hour(), hm.Minute(), 0, 0, now.Location())
+	if day >= 0 {
+		t = t.AddDate(0, 0, (day-int(now.Weekday())+7)%7)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 7)
+		}
+	} else if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parsePauseDuration reads a Go duration, or a number of days like "3d".
+func parsePauseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, e := strconv.Atoi(strings.TrimSuffix(value, "d")); e == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// pausedUntilMessage is the status displayed while a timed pause is running.
+func pausedUntilMessage(until time.Time) string {
+	return "Paused until " + until.Format("Mon 2 Jan 15:04") + ", the task will resume automatically"
+}
+
+// loadPausedUntil reads the end of a timed pause from a previous run. Expired pauses are cleared.
+func (s *Syncer) loadPausedUntil(ctx context.Context) time.Time {
+	data, e := ioutil.ReadFile(filepath.Join(s.configPath, pausedUntilFile))
+	if e != nil {
+		return time.Time{}
+	}
+	until, e := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if e != nil || !until.After(time.Now()) {
+		log.Logger(ctx).Info("Timed pause expired while the task was stopped, catching up")
+		s.clearPausedUntil(ctx)
+		return time.Time{}
+	}
+	s.pauseLock.Lock()
+	s.pausedUntil = until
+	s.pauseLock.Unlock()
+	return until
+}
+
+// pauseUntil pauses the task until the given time, and persists the expiry.
+func (s *Syncer) pauseUntil(ctx context.Context, until time.Time) {
+	if !until.After(time.Now()) {
+		return
+	}
+	if !s.taskPaused {
+		s.task.Pause(ctx)
+		s.taskPaused = true
+		s.drainRunning()
+	}
+	s.pauseLock.Lock()
+	s.pausedUntil = until
+	s.pauseLock.Unlock()
+	if e := ioutil.WriteFile(filepath.Join(s.configPath, pausedUntilFile), []byte(until.Format(time.RFC3339)), 0644); e != nil {
+		log.Logger(ctx).Error("Cannot save timed pause: " + e.Error())
+	}
+	msg := pausedUntilMessage(until)
+	log.Logger(ctx).Info(msg)
+	GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused), TopicState)
+}
+
+// clearPausedUntil forgets the timed pause, when the task is resumed or paused indefinitely.
+func (s *Syncer) clearPausedUntil(ctx context.Context) {
+	s.pauseLock.Lock()
+	s.pausedUntil = time.Time{}
+	s.pauseLock.Unlock()
+	if e := os.Remove(filepath.Join(s.configPath, pausedUntilFile)); e != nil && !os.IsNotExist(e) {
+		log.Logger(ctx).Error("Cannot remove timed pause: " + e.Error())
+	}
+}
+
+// watchPausedUntil resumes the task when its timed pause expires. The wall clock is checked periodically rather
+// than armed once, so that the expiry is not delayed when the machine was asleep.
+func (s *Syncer) watchPausedUntil(done chan bool) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.pauseLock.Lock()
+			expired := !s.pausedUntil.IsZero() && !s.pausedUntil.After(time.Now())
+			if expired {
+				s.pausedUntil = time.Time{}
+			}
+			s.pauseLock.Unlock()
+			if expired {
+				GetBus().Pub(MessageResume, TopicSync_+s.uuid)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// pauseTaskUntil pauses a task until a date or for a duration.
+func (h *HttpServer) pauseTaskUntil(c *gin.Context) {
+	var request PauseUntilRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	now := time.Now()
+	var until time.Time
+	switch {
+	case request.Duration != "" && request.Until != "":
+		h.writeError(c, fmt.Errorf("please provide either a date or a duration"))
+		return
+	case request.Duration != "":
+		d, e := parsePauseDuration(request.Duration)
+		if e != nil {
+			h.writeError(c, e)
+			return
+		}
+		until = now.Add(d)
+	case request.Until != "":
+		u, e := ParsePauseUntil(request.Until, now)
+		if e != nil {
+			h.writeError(c, e)
+			return
+		}
+		until = u
+	default:
+		h.writeError(c, fmt.Errorf("please provide a date or a duration"))
+		return
+	}
+	if !until.After(now) {
+		h.writeError(c, fmt.Errorf("pause end %s is in the past", until.Format("2006-01-02 15:04")))
+		return
+	}
+	uuid := c.Param("uuid")
+	var found bool
+	for _, t := range config.Default().Tasks {
+		found = found || t.Uuid == uuid
+	}
+	if !found {
+		h.writeError(c, fmt.Errorf("cannot find task %s", uuid))
+		return
+	}
+	GetBus().Pub(&PauseUntil{Until: until}, TopicSync_+uuid)
+	c.JSON(http.StatusOK, &PauseUntil{Until: until})
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	PolicyDownloadOnly = "download-only"
+	PolicyUploadOnly   = "upload-only"
+
+	maxPolicyViolations = 100
+
+	policyCacheFile = "policy.json"
+	// policyRefreshInterval is the delay between two fetches of the policy of a running task
+	policyRefreshInterval = 15 * time.Minute
+)
+
+// SyncPolicy is defined by the server administrator for a workspace, and enforced by the client.
+type SyncPolicy struct {
+	// Excludes are glob patterns that are never synced
+	Excludes []string
+	// UploadExcludes are glob patterns that cannot be uploaded (e.g. "**/*.exe"), they are still downloaded
+	UploadExcludes []string
+	// Direction locks the task direction to PolicyDownloadOnly or PolicyUploadOnly
+	Direction string
+	// MaxFileSize is the maximum size of an uploaded file, in bytes
+	MaxFileSize int64
+}
+
+// remoteAuthority finds the authority and workspace slug of the remote side of a task.
+func remoteAuthority(conf *config.Task) (auth *config.Authority, slug string, remoteIsLeft bool) {
+	for _, a := range config.Default().Authorities {
+		if a.MatchesURI(conf.LeftURI) {
+			auth, remoteIsLeft = a, true
+		} else if a.MatchesURI(conf.RightURI) {
+			auth = a
+		}
+		if auth != nil {
+			break
+		}
+	}
+	if auth == nil {
+		return
+	}
+	remoteURI := conf.RightURI
+	if remoteIsLeft {
+		remoteURI = conf.LeftURI
+	}
+	if u, e := url.Parse(remoteURI); e == nil {
+		slug = strings.Split(strings.Trim(u.Path, "/"), "/")[0]
+	}
+	return
+}
+
+// loadCachedPolicy reads the last policy fetched for a task, so that it applies as soon as the task starts. The
+// policy is then refreshed from the server by watchPolicy.
+func loadCachedPolicy(configPath string) *SyncPolicy {
+	data, e := ioutil.ReadFile(filepath.Join(configPath, policyCacheFile))
+	if e != nil {
+		return nil
+	}
+	var cached SyncPolicy
+	if json.Unmarshal(data, &cached) != nil {
+		return nil
+	}
+	return &cached
+}
+
+// loadSyncPolicy fetches the policy for the workspace of a task, and caches it inside the task folder. It returns
+// nil if the workspace has no policy.
+func loadSyncPolicy(conf *config.Task, configPath string) (*SyncPolicy, error) {
+	auth, slug, _ := remoteAuthority(conf)
+	if auth == nil || slug == "" {
+		return nil, nil
+	}
+	cachePath := filepath.Join(configPath, policyCacheFile)
+	policy, e := fetchSyncPolicy(auth, slug)
+	if e != nil {
+		return nil, e
+	}
+	if policy == nil {
+		os.Remove(cachePath)
+		return nil, nil
+	}
+	if data, er := json.Marshal(policy); er == nil {
+		ioutil.WriteFile(cachePath, data, 0644)
+	}
+	return policy, nil
+}
+
+// watchPolicy fetches the policy of the task from the server when it starts, then every policyRefreshInterval.
+// Upload limits apply right away, the task is restarted if its excludes or its direction lock changed.
+func (s *Syncer) watchPolicy(done chan bool) {
+	ctx := s.serviceCtx
+	for {
+		policy, e := loadSyncPolicy(s.conf, s.configPath)
+		if e != nil {
+			log.Logger(ctx).Debug("Cannot fetch sync policy from server, keeping current one: " + e.Error())
+		} else {
+			s.policyLock.Lock()
+			previous := s.policy
+			s.policy = policy
+			s.policyLock.Unlock()
+			if s.uploadGuard != nil {
+				s.uploadGuard.SetPolicy(policy.maxFileSize(), policy.uploadExcludes())
+			}
+			if previous.requiresRestart(policy) {
+				log.Logger(ctx).Info("Server policy changed, restarting task")
+				config.Default().RestartTask(s.uuid)
+				return
+			}
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(policyRefreshInterval):
+		}
+	}
+}
+
+func fetchSyncPolicy(auth *config.Authority, slug string) (*SyncPolicy, error) {
+	req, e := auth.NewAuthenticatedRequest("GET", "/a/sync-policies/"+url.PathEscape(slug), nil)
+	if e != nil {
+		return nil, e
+	}
+	resp, e := auth.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var policy SyncPolicy
+		if e := json.NewDecoder(resp.Body).Decode(&policy); e != nil {
+			return nil, e
+		}
+		return &policy, nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// No policy for this workspace, or server does not support policies
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+}
+
+// Ignores returns the patterns that must be added to the task filters.
+func (p *SyncPolicy) Ignores() []string {
+	return append([]string{}, p.Excludes...)
+}
+
+func (p *SyncPolicy) maxFileSize() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.MaxFileSize
+}
+
+func (p *SyncPolicy) uploadExcludes() []string {
+	if p == nil {
+		return nil
+	}
+	return p.UploadExcludes
+}
+
+// requiresRestart tells if the task filters or direction must change to apply the next policy.
+func (p *SyncPolicy) requiresRestart(next *SyncPolicy) bool {
+	var excludes, nextExcludes []string
+	var direction, nextDirection string
+	if p != nil {
+		excludes, direction = p.Excludes, p.Direction
+	}
+	if next != nil {
+		nextExcludes, nextDirection = next.Excludes, next.Direction
+	}
+	return direction != nextDirection || strings.Join(excludes, "\n") != strings.Join(nextExcludes, "\n")
+}
+
+// EnforceDirection returns the direction allowed by the policy, and a violation message if the configured
+// direction had to be changed.
+func (p *SyncPolicy) EnforceDirection(conf *config.Task, direction model.DirectionType) (model.DirectionType, string) {
+	if p.Direction != PolicyDownloadOnly && p.Direction != PolicyUploadOnly {
+		return direction, ""
+	}
+	_, _, remoteIsLeft := remoteAuthority(conf)
+	// DirectionLeft propagates changes to the left, DirectionRight to the right
+	targetIsLeft := (p.Direction == PolicyDownloadOnly) != remoteIsLeft
+	allowed := model.DirectionRight
+	if targetIsLeft {
+		allowed = model.DirectionLeft
+	}
+	if allowed == direction {
+		return direction, ""
+	}
+	return allowed, "Sync direction is locked to " + p.Direction + " by the server policy"
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// privateServiceName is the service name of the tasks in privacy mode, used to find their log lines.
+	privateServiceName = "sync-task.private"
+	// privateTokenPrefix starts every encrypted name, so that masking the same text twice is a no-op.
+	privateTokenPrefix = "~"
+)
+
+var (
+	// pathTokenRegexp finds the names in a free text: tokens containing a slash or a backslash, and file names
+	// with an extension. Names stop at spaces, so the end of a name containing spaces is only partially masked.
+	pathTokenRegexp = regexp.MustCompile(`[^\s"',;:()\[\]{}<>]*[/\\][^\s"',;:()\[\]{}<>]*|[^\s"',;:()\[\]{}<>/\\]+\.[A-Za-z][A-Za-z0-9]{0,7}\b`)
+	// privateTokenRegexp finds the encrypted names: nonce, sealed name and tag in URL-safe base64.
+	privateTokenRegexp = regexp.MustCompile(privateTokenPrefix + `[A-Za-z0-9_-]{39,}`)
+	extensionRegexp    = regexp.MustCompile(`\.[A-Za-z0-9]{1,8}$`)
+
+	privacyOnce sync.Once
+	privacyAEAD cipher.AEAD
+	privacyMAC  []byte
+)
+
+// privacyKeyFile is the key encrypting the names of the tasks in privacy mode. It never leaves the device: it
+// protects the states, logs and reports sent outside of the application, and lets the owner reveal them.
+func privacyKeyFile() string {
+	return filepath.Join(config.SyncClientDataDir(), "privacy.key")
+}
+
+// privacyCipher loads or creates the privacy key. The encryption and the nonce derivation keys are both
+// derived from it.
+func privacyCipher() (cipher.AEAD, []byte) {
+	privacyOnce.Do(func() {
+		key, e := ioutil.ReadFile(privacyKeyFile())
+		if e != nil || len(key) != 32 {
+			key = make([]byte, 32)
+			if _, e := rand.Read(key); e != nil {
+				return
+			}
+			if e := ioutil.WriteFile(privacyKeyFile(), key, 0600); e != nil {
+				return
+			}
+		}
+		encKey := sha256.Sum256(append(append([]byte{}, key...), "enc"...))
+		macKey := sha256.Sum256(append(append([]byte{}, key...), "mac"...))
+		block, e := aes.NewCipher(encKey[:])
+		if e != nil {
+			return
+		}
+		if privacyAEAD, e = cipher.NewGCM(block); e != nil {
+			privacyAEAD = nil
+			return
+		}
+		privacyMAC = macKey[:]
+	})
+	return privacyAEAD, privacyMAC
+}
+
+// encryptName encrypts one name. The nonce is derived from the name, so that a name always gives the same token
+// on this device and masked paths can still be compared. If the key cannot be stored, it falls back to a hash
+// salted with the device id, that cannot be revealed.
+func encryptName(name string) string {
+	aead, macKey := privacyCipher()
+	if aead == nil {
+		h := sha256.Sum256([]byte(config.Default().DeviceId + name))
+		return hex.EncodeToString(h[:])[:8]
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+	return privateTokenPrefix + base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(name), nil))
+}
+
+// decryptName reveals a name encrypted by encryptName.
+func decryptName(token string) (string, bool) {
+	aead, _ := privacyCipher()
+	if aead == nil || !strings.HasPrefix(token, privateTokenPrefix) {
+		return "", false
+	}
+	data, e := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, privateTokenPrefix))
+	if e != nil || len(data) < aead.NonceSize() {
+		return "", false
+	}
+	name, e := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if e != nil {
+		return "", false
+	}
+	return string(name), true
+}
+
+// maskName encrypts one path segment, keeping its file extension. Segments that are already encrypted are kept.
+func maskName(name string) string {
+	ext := extensionRegexp.FindString(name)
+	if ext == name {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	if _, ok := decryptName(base); ok {
+		return name
+	}
+	return encryptName(base) + ext
+}
+
+// maskPath encrypts each segment of a path, keeping the separators and the file extension.
+func maskPath(p string) string {
+	var out strings.Builder
+	var segment strings.Builder
+	flush := func() {
+		if segment.Len() > 0 {
+			out.WriteString(maskName(segment.String()))
+			segment.Reset()
+		}
+	}
+	for _, r := range p {
+		if r == '/' || r == '\\' {
+			flush()
+			out.WriteRune(r)
+		} else {
+			segment.WriteRune(r)
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// maskURI encrypts the path of an endpoint URI, keeping its scheme and host.
+func maskURI(uri string) string {
+	u, e := url.Parse(uri)
+	if e != nil || u.Scheme == "" {
+		return maskPath(uri)
+	}
+	return u.Scheme + "://" + u.Host + maskPath(u.Path)
+}
+
+// maskText encrypts the names found in a free text, like a status or an error message. Tokens without any
+// letter, like counters or dates, are kept.
+func maskText(text string) string {
+	return pathTokenRegexp.ReplaceAllStringFunc(text, func(token string) string {
+		if strings.IndexFunc(token, unicode.IsLetter) < 0 {
+			return token
+		}
+		return maskPath(token)
+	})
+}
+
+func maskTexts(texts []string) (masked []string) {
+	for _, t := range texts {
+		masked = append(masked, maskText(t))
+	}
+	return
+}
+
+func maskPaths(paths []string) (masked []string) {
+	for _, p := range paths {
+		masked = append(masked, maskPath(p))
+	}
+	return
+}
+
+// revealText replaces the encrypted names of a text by their clear value.
+func revealText(text string) string {
+	return privateTokenRegexp.ReplaceAllStringFunc(text, func(token string) string {
+		if name, ok := decryptName(token); ok {
+			return name
+		}
+		return token
+	})
+}
+
+func revealTexts(texts []string) (revealed []string) {
+	for _, t := range texts {
+		revealed = append(revealed, revealText(t))
+	}
+	return
+}
+
+// revealTask reveals the roots of a task configuration edited from a masked state.
+func revealTask(task *config.Task) {
+	task.LeftURI, task.RightURI = revealText(task.LeftURI), revealText(task.RightURI)
+	task.SelectiveRoots = revealTexts(task.SelectiveRoots)
+	task.File = revealText(task.File)
+}
+
+// privateTask checks if a task runs in privacy mode.
+func privateTask(uuid string) bool {
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == uuid {
+			return t.Privacy
+		}
+	}
+	return false
+}
+
+// maskStatus masks the names found in a processing status, keeping its endpoint, progress and error flag.
+func maskStatus(s model.Status) model.Status {
+	if s == nil {
+		return nil
+	}
+	masked := model.NewProcessingStatus(maskText(s.String())).SetEndpoint(maskURI(s.EndpointURI())).SetProgress(s.Progress())
+	if s.IsError() && s.Error() != nil {
+		masked.SetError(errors.New(maskText(s.Error().Error())))
+	}
+	return masked
+}
+
+// maskState returns a copy of the state of a task in privacy mode, where names are encrypted. It is applied by
+// the state store, so that every consumer of the states (UI, journal, MQTT, fleet reports) only gets masked names.
+func maskState(s common.SyncState) common.SyncState {
+	if s.Config != nil {
+		c := *s.Config
+		c.LeftURI, c.RightURI = maskURI(c.LeftURI), maskURI(c.RightURI)
+		c.SelectiveRoots = maskPaths(c.SelectiveRoots)
+		if c.File != "" {
+			c.File = maskPath(c.File)
+		}
+		s.Config = &c
+	}
+	s.LastProcessStatus = maskStatus(s.LastProcessStatus)
+	s.LeftProcessStatus = maskStatus(s.LeftProcessStatus)
+	s.RightProcessStatus = maskStatus(s.RightProcessStatus)
+	s.PolicyViolations = maskTexts(s.PolicyViolations)
+	s.AccessDenied = maskPaths(s.AccessDenied)
+	s.Quarantined = maskPaths(s.Quarantined)
+	var files []*common.FileProgress
+	for _, f := range s.ActiveFiles {
+		c := *f
+		c.Path = maskPath(c.Path)
+		files = append(files, &c)
+	}
+	s.ActiveFiles = files
+	var copies []*common.ConflictCopy
+	for _, cc := range s.ConflictCopies {
+		copies = append(copies, &common.ConflictCopy{Path: maskPath(cc.Path), Copy: maskPath(cc.Copy)})
+	}
+	s.ConflictCopies = copies
+	var errs []*common.ErrorInfo
+	for _, e := range s.Errors {
+		c := *e
+		c.Message = maskText(c.Message)
+		c.Params = maskTexts(c.Params)
+		errs = append(errs, &c)
+	}
+	s.Errors = errs
+	return s
+}
+
+// logClearFields are the fields of a JSON log line that never contain names.
+var logClearFields = map[string]bool{"level": true, "ts": true, "logger": true, "caller": true}
+
+// redactLogLine masks the names of a log line written by a task in privacy mode. JSON lines have all their
+// values masked, other lines are masked as a whole.
+func redactLogLine(line []byte) []byte {
+	if !strings.Contains(string(line), privateServiceName) {
+		return line
+	}
+	var fields map[string]interface{}
+	if e := json.Unmarshal(line, &fields); e != nil {
+		return []byte(maskText(string(line)))
+	}
+	for k, v := range fields {
+		if s, ok := v.(string); ok && !logClearFields[k] {
+			fields[k] = maskText(s)
+		}
+	}
+	redacted, e := json.Marshal(fields)
+	if e != nil {
+		return []byte(maskText(string(line)))
+	}
+	if strings.HasSuffix(string(line), "\n") {
+		redacted = append(redacted, '\n')
+	}
+	return redacted
+}
+
+type redactingWriter struct {
+	zapcore.WriteSyncer
+}
+
+// Write implements io.Writer.
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, e := w.WriteSyncer.Write(redactLogLine(p)); e != nil {
+		return 0, e
+	}
+	return len(p), nil
+}
+
+// RedactLogs wraps a log output so that the file paths logged by the tasks in privacy mode are masked.
+func RedactLogs(ws zapcore.WriteSyncer) zapcore.WriteSyncer {
+	return &redactingWriter{WriteSyncer: ws}
+}
+
+// revealRequest is posted by the owner of the device to read a masked state, log line or report.
+type revealRequest struct {
+	Text string
+}
+
+// revealPrivate decrypts the names of a text masked by a task in privacy mode. The key stays on the device,
+// so only this application can reveal them.
+func (h *HttpServer) revealPrivate(c *gin.Context) {
+	var req revealRequest
+	if e := c.BindJSON(&req); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, &revealRequest{Text: revealText(req.Text)})
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// dropPrivileges is called when the agent runs elevated, for example when started by an installer. Files created
+// in the local root are given to the account owning it, and scanners and hooks run as this account. The task
+// fails to start if this account cannot read and write the root, or if no unprivileged account is found, rather
+// than creating files that the user cannot modify.
+func (s *Syncer) dropPrivileges(ctx context.Context, left, right model.Endpoint) error {
+	root, ok := endpoint.LocalPathForURI(s.conf.LeftURI)
+	if !ok {
+		if root, ok = endpoint.LocalPathForURI(s.conf.RightURI); !ok {
+			return nil
+		}
+	}
+	owner := endpoint.RootOwner(root)
+	if owner == nil {
+		return fmt.Errorf("running with elevated rights and cannot find the user owning %s, please start Cells Sync as this user", root)
+	}
+	// Also gives the root to owner if it was created by the agent
+	endpoint.SetOwner(left, owner)
+	endpoint.SetOwner(right, owner)
+	if e := endpoint.CheckOwnerAccess(root, owner); e != nil {
+		return errors.Wrap(e, "running with elevated rights")
+	}
+	s.owner = owner
+	log.Logger(ctx).Warn(fmt.Sprintf("Running with elevated rights, files in %s will belong to user %d:%d", root, owner.Uid, owner.Gid))
+	return nil
+}
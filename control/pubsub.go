@@ -30,12 +30,20 @@ var (
 )
 
 const (
-	TopicGlobal  = "cmd"
-	TopicSyncAll = "sync"
-	TopicSync_   = "sync-"
-	TopicState   = "state"
-	TopicStore_  = "store"
-	TopicUpdate  = "update"
+	TopicGlobal   = "cmd"
+	TopicSyncAll  = "sync"
+	TopicSync_    = "sync-"
+	TopicState    = "state"
+	TopicStore_   = "store"
+	TopicStats_   = "stats-"
+	TopicMeta_    = "meta-"
+	TopicHistory_ = "history-"
+	TopicResync_  = "resync-"
+	TopicHold_    = "hold-"
+	TopicUpdate   = "update"
+	TopicReport   = "report"
+
+	TopicNotification = "notification"
 )
 
 type CommandMessage int
@@ -55,6 +63,17 @@ const (
 	MessagePublishStore
 	MessageRestartClean // Restart an clean snapshots
 	MessageHaltClean    // Halt task and remove all configs
+	MessagePublishStats
+	MessageScheduledResync  // Full resync triggered by scheduler, subject to rescan policy
+	MessageBlackoutStart    // Task enters a blackout window
+	MessageBlackoutEnd      // Task leaves a blackout window
+	MessageLoopDetected     // Task is pausing as changes bounce between both sides
+	MessagePublishMeta      // Task sends back its node metadata store
+	MessageRetention        // Task prunes its stash following its retention rules
+	MessageMaintenanceStart // Server of the task announced a maintenance
+	MessageMaintenanceEnd   // Server of the task is back from maintenance
+	MessageSafeQuit         // Pause all tasks, let running transfers finish, then halt
+	MessagePublishHistory   // Task sends back its history storage
 )
 
 func init() {
@@ -73,6 +92,9 @@ func MessageFromString(text string) (int, error) {
 	case "exit", "quit":
 		// Stop all
 		return MessageHalt, nil
+	case "stop-all", "safe-quit":
+		// Pause all, wait for running syncs and stop
+		return MessageSafeQuit, nil
 	case "resync":
 		// Full resync
 		return MessageResync, nil
@@ -101,6 +123,9 @@ func MessageFromString(text string) (int, error) {
 	case "resume":
 		// Resume all syncs
 		return MessageResume, nil
+	case "retention":
+		// Prune the stash of one sync
+		return MessageRetention, nil
 	default:
 		return -1, fmt.Errorf("cannot find corresponding command")
 	}
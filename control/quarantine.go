@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+// handleQuarantine reports the downloaded files that were moved to quarantine by the content scanner.
+func (s *Syncer) handleQuarantine(ctx context.Context, patch merger.Patch) {
+	var paths []string
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile}, func(operation merger.Operation) {
+		if q, ok := errors.Cause(operation.Error()).(*endpoint.QuarantineError); ok {
+			log.Logger(ctx).Warn(q.Error() + ", see " + q.Quarantine)
+			paths = append(paths, q.Path)
+		}
+	})
+	if len(paths) > 0 {
+		GetBus().Pub(s.stateStore.AddQuarantined(paths), TopicState)
+	}
+}
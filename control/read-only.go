@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+)
+
+// readOnlyDirection adjusts the task direction if one of its sides is read-only (local folder on read-only
+// media, or remote workspace shared without write permission): data can only flow from that side. It returns changed=true if the direction was switched, or an error if the configured direction
+// would require writing to a read-only folder.
+func readOnlyDirection(conf *config.Task) (changed bool, e error) {
+	leftRO := endpoint.IsReadOnlyURI(conf.LeftURI)
+	rightRO := endpoint.IsReadOnlyURI(conf.RightURI)
+	switch {
+	case leftRO && rightRO:
+		return false, fmt.Errorf("both sides are read-only, nothing can be synced")
+	case leftRO:
+		if conf.Direction == "Left" {
+			return false, fmt.Errorf("cannot write to %s: it is read-only", conf.LeftURI)
+		}
+		changed = conf.Direction != "Right"
+		conf.Direction = "Right"
+	case rightRO:
+		if conf.Direction == "Right" {
+			return false, fmt.Errorf("cannot write to %s: it is read-only", conf.RightURI)
+		}
+		changed = conf.Direction != "Left"
+		conf.Direction = "Left"
+	}
+	return
+}
+
+// notifyReadOnly tells the user that a task was switched to one-way sync.
+func notifyReadOnly(conf *config.Task) {
+	uri := conf.LeftURI
+	if conf.Direction == "Left" {
+		uri = conf.RightURI
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationReadOnly,
+		TaskUuid: conf.Uuid,
+		Title:    conf.Label,
+		Message:  fmt.Sprintf(i18n.T("notification.read-only"), uri),
+	})
+}
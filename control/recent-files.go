@@ -0,0 +1,160 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+// RecentFile describes a file recently changed by a sync task, with links to open it locally or on the server
+// web interface.
+type RecentFile struct {
+	TaskUuid  string
+	Path      string
+	Stamp     time.Time
+	Action    string
+	From      string `json:",omitempty"`
+	LocalPath string `json:",omitempty"`
+	ServerURL string `json:",omitempty"`
+}
+
+// loadRecentFiles walks the last patches of a task to find the most recently changed files. Names of the tasks
+// in privacy mode are encrypted.
+func loadRecentFiles(taskUuid string, limit int) (files []*RecentFile) {
+	store := requestPatchStore(taskUuid)
+	if store == nil {
+		return
+	}
+	patches, err := store.Load(0, 10)
+	if err != nil {
+		return
+	}
+	var conf *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == taskUuid {
+			conf = t
+		}
+	}
+	seen := make(map[string]struct{})
+	for _, patch := range patches {
+		patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile, merger.OpMoveFile, merger.OpDelete}, func(operation merger.Operation) {
+			p := operation.GetRefPath()
+			if len(files) >= limit {
+				return
+			}
+			if n := operation.GetNode(); operation.Type() == merger.OpDelete && (n == nil || !n.IsLeaf()) {
+				return
+			}
+			if _, ok := seen[p]; ok {
+				return
+			}
+			seen[p] = struct{}{}
+			f := &RecentFile{TaskUuid: taskUuid, Path: p, Stamp: patch.GetStamp(), Action: auditAction(operation.Type())}
+			if operation.Type() == merger.OpMoveFile {
+				f.From = operation.GetMoveOriginPath()
+			}
+			if conf != nil && operation.Type() != merger.OpDelete {
+				f.LocalPath, f.ServerURL = recentFileLinks(conf, p)
+			}
+			if conf != nil && conf.Privacy {
+				f.Path, f.LocalPath, f.ServerURL = maskPath(f.Path), maskPath(f.LocalPath), maskURI(f.ServerURL)
+				if f.From != "" {
+					f.From = maskPath(f.From)
+				}
+			}
+			files = append(files, f)
+		})
+		if len(files) >= limit {
+			break
+		}
+	}
+	return
+}
+
+// recentFileLinks returns the local path of a file and the URL of its page on the Cells web interface.
+func recentFileLinks(conf *config.Task, p string) (localPath string, serverURL string) {
+	p = strings.TrimLeft(p, "/")
+	for _, uri := range []string{conf.LeftURI, conf.RightURI} {
+		if root, ok := endpoint.LocalPathForURI(uri); ok {
+			localPath = filepath.Join(root, filepath.FromSlash(p))
+			break
+		}
+	}
+	auth, _, remoteIsLeft := remoteAuthority(conf)
+	if auth == nil {
+		return
+	}
+	remoteURI := conf.RightURI
+	if remoteIsLeft {
+		remoteURI = conf.LeftURI
+	}
+	u, e := url.Parse(remoteURI)
+	if e != nil {
+		return
+	}
+	// Remote path starts with the workspace slug, exposed as ws-{slug} on the web interface
+	full := strings.Trim(u.Path, "/") + "/" + p
+	parts := strings.Split(strings.Trim(full, "/"), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	parts[0] = "ws-" + parts[0]
+	serverURL = strings.TrimRight(auth.BaseURL(), "/") + "/" + strings.Join(parts, "/")
+	return
+}
+
+// recentFiles lists the last files changed by a task, or by all tasks if uuid is "all", most recent first.
+func (h *HttpServer) recentFiles(c *gin.Context) {
+	syncUUID := c.Param("uuid")
+	if syncUUID == "" {
+		h.writeError(c, fmt.Errorf("please provide a sync UUID"))
+		return
+	}
+	limit := 20
+	if l, e := strconv.ParseInt(c.Param("limit"), 10, 64); e == nil && l > 0 {
+		limit = int(l)
+	}
+	files := []*RecentFile{}
+	for _, t := range config.Default().Tasks {
+		if syncUUID == "all" || t.Uuid == syncUUID {
+			files = append(files, loadRecentFiles(t.Uuid, limit)...)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Stamp.After(files[j].Stamp)
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	c.JSON(http.StatusOK, files)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// defaultReconnectDelay is the time both sides must stay connected after a reconnection before syncing.
+	defaultReconnectDelay = 10 * time.Second
+	// maxReconnectDelay caps the delay of a flapping endpoint.
+	maxReconnectDelay = 15 * time.Minute
+	// flapWindow and flapThreshold define a flapping endpoint: more than flapThreshold reconnections in flapWindow.
+	flapWindow    = 10 * time.Minute
+	flapThreshold = 3
+)
+
+// reconnectGuard debounces the sync loops triggered when an endpoint reconnects. While an endpoint flaps (e.g. a
+// VPN reconnecting), the delay grows exponentially: the task is degraded rather than failed, and syncs once the
+// connection is stable.
+type reconnectGuard struct {
+	sync.Mutex
+	base  time.Duration
+	seen  bool
+	flaps []time.Time
+	timer config.Timer
+}
+
+func newReconnectGuard(seconds int) *reconnectGuard {
+	base := defaultReconnectDelay
+	if seconds > 0 {
+		base = time.Duration(seconds) * time.Second
+	}
+	return &reconnectGuard{base: base}
+}
+
+// delay records a connection and returns the time to wait before syncing, and whether the endpoint is flapping.
+// The first connection of the task is not delayed.
+func (g *reconnectGuard) delay(now time.Time) (time.Duration, bool) {
+	g.Lock()
+	defer g.Unlock()
+	if !g.seen {
+		g.seen = true
+		return 0, false
+	}
+	var recent []time.Time
+	for _, t := range g.flaps {
+		if now.Sub(t) < flapWindow {
+			recent = append(recent, t)
+		}
+	}
+	g.flaps = append(recent, now)
+	if len(g.flaps) <= flapThreshold {
+		return g.base, false
+	}
+	d := g.base << uint(len(g.flaps)-flapThreshold)
+	if d > maxReconnectDelay || d <= 0 {
+		d = maxReconnectDelay
+	}
+	return d, true
+}
+
+// schedule runs fn after the delay, replacing any pending run.
+func (g *reconnectGuard) schedule(d time.Duration, fn func()) {
+	g.Lock()
+	defer g.Unlock()
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.timer = config.GetClock().AfterFunc(d, fn)
+}
+
+// cancel drops the pending run, when an endpoint disconnects again.
+func (g *reconnectGuard) cancel() {
+	g.Lock()
+	defer g.Unlock()
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+}
+
+// runAfterReconnect launches a sync loop, or a full resync if the task was not stopped properly, once both sides
+// have been connected for the reconnect delay.
+func (s *Syncer) runAfterReconnect() {
+	d, flapping := s.reconnect.delay(config.GetClock().Now())
+	if flapping {
+		log.Logger(s.serviceCtx).Warn("Endpoints are reconnecting repeatedly, delaying sync by " + d.String())
+		state, _ := s.stateStore.UpdateDegraded(config.GetClock().Now().Add(d))
+		GetBus().Pub(state, TopicState)
+	}
+	s.reconnect.schedule(d, func() {
+		if state, changed := s.stateStore.UpdateDegraded(time.Time{}); changed {
+			GetBus().Pub(state, TopicState)
+		}
+		if !s.stateStore.BothConnected() || s.stateStore.LastState().Status != model.TaskStatusIdle {
+			return
+		}
+		if s.dirtyStopped {
+			s.dirtyStopped = false
+			log.Logger(s.serviceCtx).Info("Both sides are connected, now launching a full resync")
+			s.run(s.serviceCtx, true)
+		} else {
+			log.Logger(s.serviceCtx).Info("Both sides are connected, now launching a sync loop")
+			s.run(s.serviceCtx, false)
+		}
+	})
+}
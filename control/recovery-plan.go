@@ -0,0 +1,199 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// maxRecoveryChecks limits the number of failed operations checked on both sides after each sync.
+const maxRecoveryChecks = 50
+
+// RecoveryApproval is sent to a Syncer to apply some operations of its recovery plan, either by ID or up to a
+// risk level.
+type RecoveryApproval struct {
+	IDs     []int
+	MaxRisk string
+}
+
+// RecoveryResponse returns the plan of a task, or the operations submitted for execution.
+type RecoveryResponse struct {
+	Plan       *endpoint.RecoveryPlan        `json:",omitempty"`
+	Operations []*endpoint.RecoveryOperation `json:",omitempty"`
+}
+
+// taskDataPath is where the recovery plan and drift report of a task are stored. It is shared with the state
+// command, that runs while the agent is stopped.
+func taskDataPath(syncUUID string) string {
+	return filepath.Join(config.SyncClientDataDir(), syncUUID)
+}
+
+// recordDivergence looks for operations that failed because a node was missing: the snapshots of the task do not
+// match the actual contents anymore. Each file is checked on both sides and an operation bringing them back
+// together is added to the recovery plan, for the user to review.
+func (s *Syncer) recordDivergence(ctx context.Context, patch merger.Patch) {
+	var paths []string
+	patch.WalkOperations([]merger.OperationType{}, func(operation merger.Operation) {
+		if operation.Error() == nil || len(paths) >= maxRecoveryChecks {
+			return
+		}
+		if errorInfo(operation.Error(), "").Code == ErrorCodeNotFound {
+			paths = append(paths, operation.GetRefPath())
+		}
+	})
+	if len(paths) == 0 || s.task == nil {
+		return
+	}
+	local, _, e := s.localTarget()
+	if e != nil {
+		return
+	}
+	remote := model.Endpoint(s.task.Source)
+	if remote == local {
+		remote = s.task.Target
+	}
+	plan, e := endpoint.LoadRecoveryPlan(taskDataPath(s.uuid))
+	if e != nil || plan == nil {
+		plan = endpoint.NewRecoveryPlan(endpoint.RecoveryOriginSync)
+	}
+	var added int
+	for _, p := range paths {
+		localNode, le := local.LoadNode(ctx, p)
+		remoteNode, re := remote.LoadNode(ctx, p)
+		var ok bool
+		switch {
+		case le == nil && re == nil && localNode.IsLeaf() && remoteNode.IsLeaf():
+			ok = plan.Add(endpoint.RecoveryKeepBoth, p, endpoint.RiskMedium, "Sync failed although both versions exist: the local version is kept as a copy")
+		case le == nil && re != nil && localNode.IsLeaf():
+			ok = plan.Add(endpoint.RecoveryUpload, p, endpoint.RiskLow, "Missing on the server")
+		case le != nil && re == nil && remoteNode.IsLeaf():
+			ok = plan.Add(endpoint.RecoveryDownload, p, endpoint.RiskLow, "Missing locally")
+		}
+		if ok {
+			added++
+		}
+	}
+	if added == 0 {
+		return
+	}
+	if e := endpoint.SaveRecoveryPlan(taskDataPath(s.uuid), plan); e != nil {
+		log.Logger(ctx).Error("Cannot save recovery plan: " + e.Error())
+		return
+	}
+	log.Logger(ctx).Warn(fmt.Sprintf("Snapshots diverged from the actual contents, %d operation(s) added to the recovery plan", added))
+	notification := &common.Notification{
+		Type:     NotificationRecovery,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  fmt.Sprintf(i18n.T("notification.recovery"), len(plan.Pending())),
+	}
+	if len(plan.Select(nil, endpoint.RiskLow)) > 0 {
+		notification.Actions = []*common.NotificationAction{
+			{Id: ActionRecoverySafe, Label: i18n.T("notification.recovery.apply-safe")},
+		}
+	}
+	PublishNotification(notification)
+}
+
+// applyRecovery runs the approved operations of the recovery plan, records their outcome in the plan, and
+// triggers a sync loop so that snapshots catch up with the changes.
+func (s *Syncer) applyRecovery(ctx context.Context, approval *RecoveryApproval) {
+	plan, e := endpoint.LoadRecoveryPlan(taskDataPath(s.uuid))
+	if e != nil || plan == nil {
+		log.Logger(ctx).Error("Cannot find a recovery plan for this task")
+		return
+	}
+	var applied int
+	ops := plan.Select(approval.IDs, approval.MaxRisk)
+	for _, op := range ops {
+		var er error
+		switch op.Action {
+		case endpoint.RecoveryDownload:
+			er = s.resolveConflict(ctx, &ConflictResolution{Path: op.Path, Keep: ActionKeepRemote})
+		case endpoint.RecoveryUpload:
+			er = s.resolveConflict(ctx, &ConflictResolution{Path: op.Path, Keep: ActionKeepLocal})
+		case endpoint.RecoveryKeepBoth:
+			er = s.keepBoth(ctx, op.Path)
+		default:
+			er = fmt.Errorf("unknown action %s", op.Action)
+		}
+		if er != nil {
+			log.Logger(ctx).Error(fmt.Sprintf("Recovery operation %d (%s %s) failed: %s", op.ID, op.Action, op.Path, er.Error()))
+			op.Error = er.Error()
+			continue
+		}
+		op.Done, op.Error = true, ""
+		applied++
+	}
+	log.Logger(ctx).Info(fmt.Sprintf("Applied %d/%d recovery operations", applied, len(ops)))
+	if e := endpoint.SaveRecoveryPlan(taskDataPath(s.uuid), plan); e != nil {
+		log.Logger(ctx).Error("Cannot save recovery plan: " + e.Error())
+	}
+	if applied > 0 {
+		go GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+	}
+}
+
+// getRecoveryPlan returns the recovery plan of a task.
+func (h *HttpServer) getRecoveryPlan(c *gin.Context) {
+	plan, e := endpoint.LoadRecoveryPlan(taskDataPath(c.Param("uuid")))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, &RecoveryResponse{Plan: plan})
+}
+
+// applyRecoveryPlan sends the approved operations of a plan to its task.
+func (h *HttpServer) applyRecoveryPlan(c *gin.Context) {
+	var approval RecoveryApproval
+	if e := json.NewDecoder(c.Request.Body).Decode(&approval); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	uuid := c.Param("uuid")
+	plan, e := endpoint.LoadRecoveryPlan(taskDataPath(uuid))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	} else if plan == nil {
+		h.writeError(c, fmt.Errorf("this task has no recovery plan"))
+		return
+	}
+	ops := plan.Select(approval.IDs, approval.MaxRisk)
+	if len(ops) > 0 {
+		go GetBus().Pub(&approval, TopicSync_+uuid)
+	}
+	c.JSON(http.StatusOK, &RecoveryResponse{Operations: ops})
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// recycleBinFile records the deletions of a task sent to the server recycle bin.
+const recycleBinFile = "recycle-bin.json"
+
+// RecycleRestoreRequest is posted to restore a file or folder deleted by the task.
+type RecycleRestoreRequest struct {
+	Path string
+}
+
+// openTaskRecycleBin opens the recycle bin deletions of a known task.
+func openTaskRecycleBin(uuid string) (*endpoint.RecycleBin, error) {
+	var found bool
+	for _, t := range config.Default().Tasks {
+		found = found || t.Uuid == uuid
+	}
+	if !found {
+		return nil, fmt.Errorf("cannot find task %s", uuid)
+	}
+	return endpoint.OpenRecycleBin(filepath.Join(taskDataPath(uuid), recycleBinFile))
+}
+
+// listRecycledNodes lists the deletions of a task that can be restored from the server recycle bin.
+func (h *HttpServer) listRecycledNodes(c *gin.Context) {
+	bin, e := openTaskRecycleBin(c.Param("uuid"))
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	c.JSON(http.StatusOK, bin.Entries())
+}
+
+// restoreRecycledNodes restores a path deleted by a task from the server recycle bin, and triggers a sync pass
+// to bring it back locally.
+func (h *HttpServer) restoreRecycledNodes(c *gin.Context) {
+	var request RecycleRestoreRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	uuid := c.Param("uuid")
+	bin, e := openTaskRecycleBin(uuid)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	restored, e := bin.Restore(request.Path)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	go GetBus().Pub(MessageSyncLoop, TopicSync_+uuid)
+	c.JSON(http.StatusOK, restored)
+}
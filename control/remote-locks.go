@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// remoteLockRetry is the delay before trying again to upload files locked on the server.
+const remoteLockRetry = time.Minute
+
+// retryLockedNodes schedules a new sync loop when some uploads were deferred because the remote file is locked by
+// another user. Files still locked are deferred again, until the lock is lifted.
+func (s *Syncer) retryLockedNodes(ctx context.Context, patch merger.Patch) {
+	var locked []string
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile}, func(operation merger.Operation) {
+		if c, ok := errors.Cause(operation.Error()).(*endpoint.NodeLockedError); ok {
+			locked = append(locked, c.Path+" ("+c.LockedBy+")")
+		}
+	})
+	if len(locked) == 0 || s.manual() || !atomic.CompareAndSwapInt32(&s.lockRetry, 0, 1) {
+		return
+	}
+	log.Logger(ctx).Info("Files locked on the server, retrying later: " + strings.Join(locked, ", "))
+	time.AfterFunc(remoteLockRetry, func() {
+		atomic.StoreInt32(&s.lockRetry, 0)
+		GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+	})
+}
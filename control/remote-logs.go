@@ -0,0 +1,332 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+)
+
+const (
+	// remoteLogsFlush is the interval between two batches sent to the servers
+	remoteLogsFlush = 30 * time.Second
+	// remoteLogsDefaultRate is the default maximum number of lines sent per minute
+	remoteLogsDefaultRate = 20
+	// remoteLogsQueue is the number of lines waiting for the next batch, further lines are dropped
+	remoteLogsQueue = 200
+	// remoteLogsMaxLine truncates long messages
+	remoteLogsMaxLine = 1024
+	// taskServicePrefix starts the logger name of the sync tasks, followed by the task uuid
+	taskServicePrefix = "sync-task"
+)
+
+var (
+	remoteLogLines = make(chan *RemoteLogLine, remoteLogsQueue)
+	// secretsRegexp matches credentials that may appear in URLs, headers or error messages
+	secretsRegexp = regexp.MustCompile(`(?i)(bearer\s+|(?:access_token|refresh_token|id_token|token|password|secret|signature|x-amz-[a-z-]+)=)[^\s&"',]+`)
+	// remoteLogFields are the fields kept from a log line, other fields may hold private data
+	remoteLogFields = []string{"SpanUuid", "error", "status", "code"}
+)
+
+// RemoteLogLine is a log line queued for the servers. Task is the uuid of the task that wrote it, other lines
+// are never sent.
+type RemoteLogLine struct {
+	Level   string
+	Time    time.Time
+	Logger  string
+	Task    string
+	Message string
+}
+
+// FrontLogMessage is the payload of the Cells server logging endpoint.
+type FrontLogMessage struct {
+	Level   string
+	Source  string
+	Prefix  string
+	Message string
+}
+
+// remoteLogsWriter is a log output queueing the lines that may be sent to the servers.
+type remoteLogsWriter struct{}
+
+// Write implements io.Writer. It never blocks: lines are dropped when the queue is full.
+func (w *remoteLogsWriter) Write(p []byte) (int, error) {
+	conf := config.Default().Logs
+	if conf == nil || conf.Remote == nil || !conf.Remote.Enabled {
+		return len(p), nil
+	}
+	if line := parseRemoteLogLine(redactLogLine(p), conf.Remote.Level); line != nil {
+		select {
+		case remoteLogLines <- line:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Sync implements zapcore.WriteSyncer.
+func (w *remoteLogsWriter) Sync() error {
+	return nil
+}
+
+// RemoteLogs returns a log output feeding the remote logger, to be registered along with the log file.
+func RemoteLogs() zapcore.WriteSyncer {
+	return &remoteLogsWriter{}
+}
+
+// taskServiceName is the service name of a task, carrying its uuid so that its log lines can be sent to its own
+// servers only.
+func taskServiceName(conf *config.Task) string {
+	name := taskServicePrefix
+	if conf.Privacy {
+		name = privateServiceName
+	}
+	return name + "." + conf.Uuid
+}
+
+// loggerTask finds the uuid of the task from the logger name of a line, or returns an empty string.
+func loggerTask(logger string) string {
+	for _, prefix := range []string{privateServiceName + ".", taskServicePrefix + "."} {
+		if strings.HasPrefix(logger, prefix) {
+			return strings.TrimPrefix(logger, prefix)
+		}
+	}
+	return ""
+}
+
+// parseRemoteLogLine decodes a JSON log line, keeping it only if its level reaches minLevel.
+func parseRemoteLogLine(p []byte, minLevel string) *RemoteLogLine {
+	var entry map[string]interface{}
+	if e := json.Unmarshal(bytes.TrimSpace(p), &entry); e != nil {
+		return nil
+	}
+	level, _ := entry["level"].(string)
+	var lvl, min zapcore.Level
+	if lvl.UnmarshalText([]byte(level)) != nil {
+		return nil
+	}
+	if min.UnmarshalText([]byte(minLevel)) != nil || min < zapcore.WarnLevel {
+		min = zapcore.WarnLevel
+	}
+	if lvl < min {
+		return nil
+	}
+	msg, _ := entry["msg"].(string)
+	var extra []string
+	for _, f := range remoteLogFields {
+		if v, ok := entry[f]; ok {
+			extra = append(extra, fmt.Sprintf("%s=%v", f, v))
+		}
+	}
+	if len(extra) > 0 {
+		msg += " (" + strings.Join(extra, ", ") + ")"
+	}
+	logger, _ := entry["logger"].(string)
+	task := loggerTask(logger)
+	if task == "" {
+		return nil
+	}
+	line := &RemoteLogLine{Level: lvl.String(), Time: time.Now(), Logger: logger, Task: task, Message: filterLogMessage(msg)}
+	if ts, ok := entry["ts"].(string); ok {
+		if t, e := time.Parse(time.RFC3339, ts); e == nil {
+			line.Time = t
+		}
+	}
+	return line
+}
+
+// filterLogMessage removes credentials and the user home folder from a message.
+func filterLogMessage(msg string) string {
+	msg = secretsRegexp.ReplaceAllString(msg, "${1}***")
+	if home, e := os.UserHomeDir(); e == nil && len(home) > 1 {
+		msg = strings.Replace(msg, home, "~", -1)
+	}
+	if len(msg) > remoteLogsMaxLine {
+		msg = msg[:remoteLogsMaxLine] + "…"
+	}
+	return msg
+}
+
+// RemoteLogger is a supervisor service sending batches of the queued log lines to the servers of the tasks.
+type RemoteLogger struct {
+	ctx         context.Context
+	done        chan bool
+	batch       []*RemoteLogLine
+	dropped     int
+	sent        []time.Time
+	unsupported map[string]bool
+}
+
+// NewRemoteLogger creates a new RemoteLogger service.
+func NewRemoteLogger() *RemoteLogger {
+	ctx := servicecontext.WithServiceName(context.Background(), "remote-logs")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &RemoteLogger{
+		ctx:         ctx,
+		done:        make(chan bool, 1),
+		unsupported: make(map[string]bool),
+	}
+}
+
+// Serve implements supervisor service interface.
+func (r *RemoteLogger) Serve() {
+	ticker := time.NewTicker(remoteLogsFlush)
+	defer ticker.Stop()
+	for {
+		select {
+		case line := <-remoteLogLines:
+			r.add(line)
+		case <-ticker.C:
+			r.flush()
+		case <-r.done:
+			r.flush()
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (r *RemoteLogger) Stop() {
+	r.done <- true
+}
+
+// add appends a line to the next batch if the rate limit allows it.
+func (r *RemoteLogger) add(line *RemoteLogLine) {
+	limit := remoteLogsDefaultRate
+	if conf := config.Default().Logs; conf != nil && conf.Remote != nil && conf.Remote.MaxPerMinute > 0 {
+		limit = conf.Remote.MaxPerMinute
+	}
+	now := time.Now()
+	var recent []time.Time
+	for _, t := range r.sent {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	r.sent = recent
+	if len(r.sent) >= limit {
+		r.dropped++
+		return
+	}
+	r.sent = append(r.sent, now)
+	r.batch = append(r.batch, line)
+}
+
+// flush sends to each server one message with the lines of its own tasks. Lines are lost if sending fails:
+// they are still available in the local log file.
+func (r *RemoteLogger) flush() {
+	if len(r.batch) == 0 {
+		return
+	}
+	batch, dropped := r.batch, r.dropped
+	r.batch = nil
+	r.dropped = 0
+	conf := config.Default()
+	for _, a := range conf.Authorities {
+		if r.unsupported[a.Id] {
+			continue
+		}
+		tasks := make(map[string]bool)
+		for _, t := range conf.TasksForAuthority(a) {
+			tasks[t.Uuid] = true
+		}
+		var lines []*RemoteLogLine
+		for _, l := range batch {
+			if tasks[l.Task] {
+				lines = append(lines, l)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		data, e := json.Marshal(r.message(lines, dropped))
+		if e != nil {
+			continue
+		}
+		if er := r.send(a, data); er != nil {
+			// Do not log at warning level, it would be sent again
+			log.Logger(r.ctx).Info("Cannot send logs to " + a.URI + ": " + er.Error())
+		}
+	}
+}
+
+// message builds the payload for some lines of the batch, with the highest level of these lines.
+func (r *RemoteLogger) message(batch []*RemoteLogLine, dropped int) *FrontLogMessage {
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].Time.Before(batch[j].Time)
+	})
+	var level zapcore.Level
+	var lines []string
+	for _, l := range batch {
+		var lvl zapcore.Level
+		if lvl.UnmarshalText([]byte(l.Level)) == nil && lvl > level {
+			level = lvl
+		}
+		lines = append(lines, fmt.Sprintf("%s [%s] %s: %s", l.Time.UTC().Format(time.RFC3339), strings.ToUpper(l.Level), l.Logger, l.Message))
+	}
+	if dropped > 0 {
+		lines = append(lines, fmt.Sprintf("%d more lines dropped by rate limit", dropped))
+	}
+	conf := config.Default()
+	return &FrontLogMessage{
+		Level:   level.String(),
+		Source:  "cells-sync/" + common.Version,
+		Prefix:  conf.DeviceName + " (" + conf.DeviceId + ")",
+		Message: strings.Join(lines, "\n"),
+	}
+}
+
+// send posts a batch to the logging endpoint of a server.
+func (r *RemoteLogger) send(a *config.Authority, data []byte) error {
+	req, e := a.NewAuthenticatedRequest("POST", "/a/frontend/frontlogs", bytes.NewReader(data))
+	if e != nil {
+		return e
+	}
+	resp, e := a.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// Server does not expose the logging endpoint, do not try again
+		r.unsupported[a.Id] = true
+		return nil
+	default:
+		return fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+}
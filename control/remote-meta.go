@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// FavoriteFile describes a file bookmarked on the server, with links to open it locally or on the web interface.
+type FavoriteFile struct {
+	TaskUuid  string
+	Path      string
+	Tags      string `json:",omitempty"`
+	LockedBy  string `json:",omitempty"`
+	LocalPath string `json:",omitempty"`
+	ServerURL string `json:",omitempty"`
+}
+
+// setupRemoteMeta keeps a copy of the server-side metadata of remote nodes (tags, bookmarks, locks) in the node
+// metadata store. Only changed values are written.
+func (s *Syncer) setupRemoteMeta(ctx context.Context, left, right model.Endpoint) {
+	sink := func(p string, meta map[string]string) {
+		if s.nodeMeta == nil {
+			return
+		}
+		current := s.nodeMeta.GetAll(p)
+		for key, value := range meta {
+			if current[key] == value {
+				continue
+			}
+			if e := s.nodeMeta.Set(p, key, value); e != nil {
+				log.Logger(ctx).Error("Cannot store remote metadata for " + p + ": " + e.Error())
+			}
+		}
+	}
+	endpoint.SetRemoteMetaSink(left, sink)
+	endpoint.SetRemoteMetaSink(right, sink)
+}
+
+// loadFavorites lists the files of a task bookmarked on the server.
+func loadFavorites(taskUuid string) (files []*FavoriteFile) {
+	store := requestNodeMeta(taskUuid)
+	if store == nil {
+		return
+	}
+	bookmarks, e := store.Query(endpoint.MetaRemoteBookmark, "")
+	if e != nil {
+		return
+	}
+	var conf *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == taskUuid {
+			conf = t
+		}
+	}
+	for p := range bookmarks {
+		meta := store.GetAll(p)
+		f := &FavoriteFile{TaskUuid: taskUuid, Path: p, Tags: meta[endpoint.MetaRemoteTags], LockedBy: meta[endpoint.MetaRemoteLock]}
+		if conf != nil {
+			f.LocalPath, f.ServerURL = recentFileLinks(conf, p)
+		}
+		files = append(files, f)
+	}
+	return
+}
+
+// favorites is a virtual "Favorites" quick list of the files bookmarked on the server, per task or for "all" tasks.
+func (h *HttpServer) favorites(c *gin.Context) {
+	syncUUID := c.Param("uuid")
+	if syncUUID == "" {
+		h.writeError(c, fmt.Errorf("please provide a sync UUID"))
+		return
+	}
+	files := []*FavoriteFile{}
+	for _, t := range config.Default().Tasks {
+		if syncUUID == "all" || t.Uuid == syncUUID {
+			files = append(files, loadFavorites(t.Uuid)...)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	c.JSON(http.StatusOK, files)
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+	"github.com/pydio/cells/common/sync/merger"
+)
+
+const (
+	reportDefaultSubject = `[Cells Sync] {{.Label}}: {{.Processed}} changes, {{.Errors}} errors`
+	reportDefaultBody    = `Sync task "{{.Label}}" report from {{.Start.Format "2006-01-02 15:04"}} to {{.End.Format "2006-01-02 15:04"}}
+
+Sync passes: {{.Runs}}
+Files and folders changed: {{.Processed}}
+Conflicts: {{.Conflicts}}
+Errors: {{.Errors}}
+{{range .ErrorMessages}}
+ - {{.}}{{end}}
+`
+	reportMaxErrorMessages = 50
+	// reportQueueSize is the number of reports waiting for the SMTP server, newer reports are dropped beyond.
+	reportQueueSize = 50
+	// smtpDialTimeout and smtpSendTimeout bound the connection to the SMTP server and the whole exchange.
+	smtpDialTimeout = 10 * time.Second
+	smtpSendTimeout = 1 * time.Minute
+)
+
+// PatchReport is published on the bus by a Syncer after each sync pass.
+type PatchReport struct {
+	TaskUuid      string
+	Stamp         time.Time
+	Processed     int
+	Conflicts     int
+	Errors        int
+	ErrorMessages []string
+	ErrorCodes    []string
+}
+
+// ReportSummary aggregates one or more PatchReports, it is passed to the report templates.
+type ReportSummary struct {
+	Label         string
+	Start         time.Time
+	End           time.Time
+	Runs          int
+	Processed     int
+	Conflicts     int
+	Errors        int
+	ErrorMessages []string
+}
+
+// NewPatchReport computes a PatchReport from a processed patch. Names found in the errors of the tasks in privacy
+// mode are encrypted.
+func NewPatchReport(taskUuid string, patch merger.Patch) *PatchReport {
+	r := &PatchReport{
+		TaskUuid: taskUuid,
+		Stamp:    time.Now(),
+	}
+	stats := patch.Stats()
+	if val, ok := stats["Processed"]; ok {
+		r.Processed = val.(map[string]int)["Total"]
+	}
+	if errs, ok := patch.HasErrors(); ok {
+		r.Errors = len(errs)
+		private := privateTask(taskUuid)
+		for _, e := range errs {
+			msg := e.Error()
+			if private {
+				msg = maskText(msg)
+			}
+			r.ErrorMessages = append(r.ErrorMessages, msg)
+			r.ErrorCodes = append(r.ErrorCodes, errorInfo(e, "").Code)
+		}
+	}
+	patch.WalkOperations([]merger.OperationType{merger.OpConflict}, func(operation merger.Operation) {
+		r.Conflicts++
+	})
+	return r
+}
+
+func (r *ReportSummary) add(p *PatchReport) {
+	if r.Start.IsZero() {
+		r.Start = p.Stamp
+	}
+	r.End = p.Stamp
+	r.Runs++
+	r.Processed += p.Processed
+	r.Conflicts += p.Conflicts
+	r.Errors += p.Errors
+	for _, m := range p.ErrorMessages {
+		if len(r.ErrorMessages) >= reportMaxErrorMessages {
+			break
+		}
+		r.ErrorMessages = append(r.ErrorMessages, m)
+	}
+}
+
+// queuedReport is a report waiting to be sent.
+type queuedReport struct {
+	task    *config.Task
+	summary *ReportSummary
+}
+
+// Reporter is a supervisor service sending summary emails for tasks that have a report configured. Emails are
+// sent from a separate goroutine, so that a slow SMTP server never blocks the bus.
+type Reporter struct {
+	ctx     context.Context
+	done    chan bool
+	pending map[string]*ReportSummary
+	queue   chan *queuedReport
+}
+
+// NewReporter creates a new Reporter service.
+func NewReporter() *Reporter {
+	ctx := servicecontext.WithServiceName(context.Background(), "reporter")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &Reporter{
+		ctx:     ctx,
+		done:    make(chan bool, 1),
+		pending: make(map[string]*ReportSummary),
+		queue:   make(chan *queuedReport, reportQueueSize),
+	}
+}
+
+func reportsPendingFile() string {
+	return filepath.Join(config.SyncClientDataDir(), "reports-pending.json")
+}
+
+// loadPending reads the daily summaries that were not sent before the last stop.
+func (r *Reporter) loadPending() {
+	data, e := ioutil.ReadFile(reportsPendingFile())
+	if e != nil {
+		return
+	}
+	if e := json.Unmarshal(data, &r.pending); e != nil {
+		log.Logger(r.ctx).Error("Cannot read pending reports: " + e.Error())
+		r.pending = make(map[string]*ReportSummary)
+	}
+}
+
+// savePending stores the daily summaries, so that they survive a restart.
+func (r *Reporter) savePending() {
+	if len(r.pending) == 0 {
+		os.Remove(reportsPendingFile())
+		return
+	}
+	data, e := json.Marshal(r.pending)
+	if e == nil {
+		e = ioutil.WriteFile(reportsPendingFile(), data, 0644)
+	}
+	if e != nil {
+		log.Logger(r.ctx).Error("Cannot store pending reports: " + e.Error())
+	}
+}
+
+func (r *Reporter) taskConfig(uuid string) *config.Task {
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == uuid {
+			return t
+		}
+	}
+	return nil
+}
+
+// Serve implements supervisor service interface.
+func (r *Reporter) Serve() {
+	bus := GetBus()
+	reports := bus.Sub(TopicReport)
+	ticker := time.NewTicker(1 * time.Minute)
+	day := time.Now().YearDay()
+	sendDone := make(chan bool)
+	go r.sendQueued(sendDone)
+	r.loadPending()
+	for _, summary := range r.pending {
+		if summary.Start.YearDay() != day || summary.Start.Year() != time.Now().Year() {
+			// Summaries of a previous day were pending when the agent stopped
+			r.flush()
+			break
+		}
+	}
+	defer func() {
+		ticker.Stop()
+		bus.Unsub(reports, TopicReport)
+		close(sendDone)
+	}()
+	for {
+		select {
+		case m := <-reports:
+			report, ok := m.(*PatchReport)
+			if !ok {
+				break
+			}
+			t := r.taskConfig(report.TaskUuid)
+			if t == nil || t.Report == nil || !t.Report.Enabled {
+				break
+			}
+			if t.Report.Frequency == "daily" {
+				if _, ok := r.pending[t.Uuid]; !ok {
+					r.pending[t.Uuid] = &ReportSummary{}
+				}
+				r.pending[t.Uuid].add(report)
+				r.savePending()
+			} else if report.Processed > 0 || report.Errors > 0 {
+				summary := &ReportSummary{}
+				summary.add(report)
+				r.send(t, summary)
+			}
+		case <-ticker.C:
+			if now := time.Now().YearDay(); now != day {
+				day = now
+				r.flush()
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// flush sends all pending daily reports.
+func (r *Reporter) flush() {
+	for uuid, summary := range r.pending {
+		if t := r.taskConfig(uuid); t != nil && t.Report != nil && t.Report.Enabled {
+			r.send(t, summary)
+		}
+	}
+	r.pending = make(map[string]*ReportSummary)
+	r.savePending()
+}
+
+// send queues a report for the sender goroutine. It is dropped if the queue is full.
+func (r *Reporter) send(t *config.Task, summary *ReportSummary) {
+	summary.Label = t.Label
+	select {
+	case r.queue <- &queuedReport{task: t, summary: summary}:
+	default:
+		log.Logger(r.ctx).Error("Too many reports waiting for the SMTP server, dropping report for task " + t.Label)
+	}
+}
+
+// sendQueued sends the queued reports until done is closed.
+func (r *Reporter) sendQueued(done chan bool) {
+	for {
+		select {
+		case q := <-r.queue:
+			if e := SendReport(config.Default().Smtp, q.task.Report, q.summary); e != nil {
+				log.Logger(r.ctx).Error("Cannot send report for task " + q.task.Label + ": " + e.Error())
+			} else {
+				log.Logger(r.ctx).Info("Sent report for task " + q.task.Label)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// SendReport renders the report templates and sends them using the SMTP configuration.
+func SendReport(conf *config.Smtp, report *config.TaskReport, summary *ReportSummary) error {
+	if conf == nil || conf.Host == "" {
+		return fmt.Errorf("smtp server is not configured")
+	}
+	if len(report.Recipients) == 0 {
+		return fmt.Errorf("no recipients configured")
+	}
+	subjectTpl, bodyTpl := report.Subject, report.Body
+	if subjectTpl == "" {
+		subjectTpl = reportDefaultSubject
+	}
+	if bodyTpl == "" {
+		bodyTpl = reportDefaultBody
+	}
+	subject, e := renderReport("subject", subjectTpl, summary)
+	if e != nil {
+		return e
+	}
+	body, e := renderReport("body", bodyTpl, summary)
+	if e != nil {
+		return e
+	}
+	from := conf.From
+	if from == "" {
+		from = "cells-sync@localhost"
+	}
+	msg := bytes.NewBufferString("")
+	msg.WriteString("From: " + headerValue(from) + "\r\n")
+	msg.WriteString("To: " + headerValue(strings.Join(report.Recipients, ", ")) + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", headerValue(subject)) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	port := conf.Port
+	if port == 0 {
+		port = 25
+	}
+	var auth smtp.Auth
+	if conf.User != "" {
+		auth = smtp.PlainAuth("", conf.User, conf.Secret(), conf.Host)
+	}
+	return sendMail(fmt.Sprintf("%s:%d", conf.Host, port), conf.Host, auth, from, report.Recipients, msg.Bytes())
+}
+
+// sendMail works like smtp.SendMail, with a timeout on the connection and a deadline on the whole exchange.
+func sendMail(addr, host string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	conn, e := (&net.Dialer{Timeout: smtpDialTimeout}).Dial("tcp", addr)
+	if e != nil {
+		return e
+	}
+	if e := conn.SetDeadline(time.Now().Add(smtpSendTimeout)); e != nil {
+		conn.Close()
+		return e
+	}
+	c, e := smtp.NewClient(conn, host)
+	if e != nil {
+		conn.Close()
+		return e
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if e := c.StartTLS(&tls.Config{ServerName: host}); e != nil {
+			return e
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if e := c.Auth(auth); e != nil {
+				return e
+			}
+		}
+	}
+	if e := c.Mail(from); e != nil {
+		return e
+	}
+	for _, rcpt := range to {
+		if e := c.Rcpt(rcpt); e != nil {
+			return e
+		}
+	}
+	w, e := c.Data()
+	if e != nil {
+		return e
+	}
+	if _, e := w.Write(msg); e != nil {
+		return e
+	}
+	if e := w.Close(); e != nil {
+		return e
+	}
+	return c.Quit()
+}
+
+// headerValue replaces line breaks by spaces, so that a value cannot inject other headers in the message.
+func headerValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, v)
+}
+
+func renderReport(name, tpl string, summary *ReportSummary) (string, error) {
+	t, e := template.New(name).Parse(tpl)
+	if e != nil {
+		return "", e
+	}
+	buf := bytes.NewBuffer(nil)
+	if e := t.Execute(buf, summary); e != nil {
+		return "", e
+	}
+	return buf.String(), nil
+}
+
+// Stop implements supervisor service interface.
+func (r *Reporter) Stop() {
+	log.Logger(r.ctx).Info("Stopping reporter")
+	r.done <- true
+}
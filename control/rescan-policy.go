@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// parseTimeWindow parses a "HH:MM-HH:MM" range into minutes since midnight.
+func parseTimeWindow(w string) (start, end int, e error) {
+	var h1, m1, h2, m2 int
+	if _, e = fmt.Sscanf(w, "%d:%d-%d:%d", &h1, &m1, &h2, &m2); e != nil {
+		return 0, 0, fmt.Errorf("invalid time window %s, expected HH:MM-HH:MM", w)
+	}
+	return h1*60 + m1, h2*60 + m2, nil
+}
+
+// inTimeWindow checks if t is within the window. Windows ending before they start span over midnight.
+func inTimeWindow(w string, t time.Time) bool {
+	start, end, e := parseTimeWindow(w)
+	if e != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// rescanAllowed checks if a scheduled full rescan may run now.
+func rescanAllowed(p *config.RescanPolicy, now time.Time) bool {
+	if p == nil || (len(p.Windows) == 0 && !p.WhenIdle) {
+		return true
+	}
+	for _, w := range p.Windows {
+		if inTimeWindow(w, now) {
+			return true
+		}
+	}
+	if p.WhenIdle {
+		idleMinutes := p.IdleMinutes
+		if idleMinutes <= 0 {
+			idleMinutes = 15
+		}
+		if idle, ok := systemIdleTime(); ok && idle >= time.Duration(idleMinutes)*time.Minute {
+			return true
+		}
+	}
+	return false
+}
+
+// rescanRateLimit returns the local read rate limit in bytes per second that applies now, or 0.
+func rescanRateLimit(p *config.RescanPolicy, now time.Time) int64 {
+	if p == nil || p.BusinessRateKB <= 0 || p.BusinessHours == "" || !inTimeWindow(p.BusinessHours, now) {
+		return 0
+	}
+	return p.BusinessRateKB * 1024
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+)
+
+// resolutionDone is sent back to the Syncer by a background conflict resolution. Loop is set if some changes
+// must be propagated.
+type resolutionDone struct {
+	Loop bool
+}
+
+// resolveInBackground runs conflict resolutions outside of the bus loop, so that large copies do not stall the
+// task. Resolutions are serialized, and the task does not process events nor run sync passes until they are
+// done: a sync loop is then triggered if one was requested meanwhile or if resolve returns true. It must be
+// called from the bus loop of the task.
+func (s *Syncer) resolveInBackground(ctx context.Context, resolve func() bool) {
+	if s.resolutions == 0 && !s.taskPaused && s.isStarted() {
+		s.task.Pause(ctx)
+	}
+	s.resolutions++
+	go func() {
+		s.resolveLock.Lock()
+		loop := resolve()
+		s.resolveLock.Unlock()
+		GetBus().Pub(&resolutionDone{Loop: loop}, TopicSync_+s.uuid)
+	}()
+}
+
+// resolving tells if conflict resolutions are running. Sync passes requested meanwhile are deferred until they
+// are done.
+func (s *Syncer) resolving() bool {
+	if s.resolutions > 0 {
+		s.resolutionLoop = true
+		return true
+	}
+	return false
+}
+
+// endResolution resumes the task once all background resolutions are done, and triggers the deferred sync loop.
+func (s *Syncer) endResolution(ctx context.Context, done *resolutionDone) {
+	s.resolutions--
+	s.resolutionLoop = s.resolutionLoop || done.Loop
+	if s.resolutions > 0 {
+		return
+	}
+	if !s.taskPaused && s.isStarted() {
+		s.task.Resume(ctx)
+	}
+	if s.resolutionLoop {
+		s.resolutionLoop = false
+		go GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+	}
+}
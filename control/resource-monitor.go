@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	servicecontext "github.com/pydio/cells/common/service/context"
+)
+
+const (
+	// NotificationResources warns that the agent approaches a resource limit.
+	NotificationResources = "resources"
+
+	// resourceWarnRatio raises a warning when usage reaches this share of a limit, resourceClearRatio clears it.
+	resourceWarnRatio  = 0.8
+	resourceClearRatio = 0.7
+	// memorySoftLimit is the resident memory above which a warning is raised.
+	memorySoftLimit = 1024 * 1024 * 1024
+)
+
+var lastResources = struct {
+	sync.Mutex
+	usage common.ResourceUsage
+}{usage: common.ResourceUsage{OpenFiles: -1, MaxFiles: -1, Watches: -1, MaxWatches: -1, RSS: -1, MaxRSS: memorySoftLimit}}
+
+// CurrentResources returns the last measured resource usage of the agent.
+func CurrentResources() common.ResourceUsage {
+	lastResources.Lock()
+	defer lastResources.Unlock()
+	return lastResources.usage
+}
+
+// ResourceMonitor is a supervisor service measuring the resources used by the agent against soft limits. Warnings
+// are shown in the status summary and notified before the OS limits are hit, at which point watchers and transfers
+// would start failing.
+type ResourceMonitor struct {
+	ctx      context.Context
+	done     chan bool
+	interval time.Duration
+	raised   map[string]bool
+}
+
+// NewResourceMonitor creates a new ResourceMonitor service.
+func NewResourceMonitor() *ResourceMonitor {
+	ctx := servicecontext.WithServiceName(context.Background(), "resources")
+	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
+	return &ResourceMonitor{
+		ctx:      ctx,
+		done:     make(chan bool, 1),
+		interval: time.Minute,
+		raised:   make(map[string]bool),
+	}
+}
+
+// Serve implements supervisor service interface.
+func (r *ResourceMonitor) Serve() {
+	r.check()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.check()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Stop implements supervisor service interface.
+func (r *ResourceMonitor) Stop() {
+	log.Logger(r.ctx).Info("Stopping resource monitor")
+	r.done <- true
+}
+
+// check measures the resources and raises or clears the warnings. A warning is notified when it is raised, and
+// cleared once usage goes back below the clear ratio, so that it is not notified again on each check.
+func (r *ResourceMonitor) check() {
+	usage := common.ResourceUsage{MaxRSS: memorySoftLimit}
+	usage.OpenFiles, usage.MaxFiles, usage.Watches, usage.MaxWatches, usage.RSS = measureResources()
+	limits := []struct {
+		key          string
+		value, limit int64
+		message      string
+	}{
+		{"files", int64(usage.OpenFiles), int64(usage.MaxFiles), fmt.Sprintf(i18n.T("notification.resources.files"), usage.OpenFiles, usage.MaxFiles)},
+		{"watches", int64(usage.Watches), int64(usage.MaxWatches), fmt.Sprintf(i18n.T("notification.resources.watches"), usage.Watches, usage.MaxWatches)},
+		{"memory", usage.RSS, usage.MaxRSS, fmt.Sprintf(i18n.T("notification.resources.memory"), usage.RSS/1024/1024)},
+	}
+	for _, l := range limits {
+		if l.value < 0 || l.limit <= 0 {
+			continue
+		}
+		ratio := float64(l.value) / float64(l.limit)
+		if ratio >= resourceWarnRatio {
+			usage.Warnings = append(usage.Warnings, l.message)
+			if !r.raised[l.key] {
+				r.raised[l.key] = true
+				log.Logger(r.ctx).Warn(l.message)
+				PublishNotification(&common.Notification{
+					Type:    NotificationResources,
+					Title:   i18n.T("application.title"),
+					Message: l.message,
+				})
+			}
+		} else if ratio < resourceClearRatio {
+			r.raised[l.key] = false
+		} else if r.raised[l.key] {
+			usage.Warnings = append(usage.Warnings, l.message)
+		}
+	}
+	lastResources.Lock()
+	lastResources.usage = usage
+	lastResources.Unlock()
+}
+
+// resources returns the resource usage of the agent, used by the doctor command.
+func (h *HttpServer) resources(c *gin.Context) {
+	c.JSON(http.StatusOK, CurrentResources())
+}
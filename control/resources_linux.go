@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// measureResources reads the file descriptors, inotify watches and resident memory of the process from /proc.
+func measureResources() (openFiles, maxFiles, watches, maxWatches int, rss int64) {
+	openFiles, maxFiles, watches, maxWatches, rss = -1, -1, 0, -1, -1
+	var limit syscall.Rlimit
+	if syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit) == nil {
+		maxFiles = int(limit.Cur)
+	}
+	if data, e := ioutil.ReadFile("/proc/sys/fs/inotify/max_user_watches"); e == nil {
+		if v, e := strconv.Atoi(strings.TrimSpace(string(data))); e == nil {
+			maxWatches = v
+		}
+	}
+	fds, e := ioutil.ReadDir("/proc/self/fd")
+	if e == nil {
+		openFiles = len(fds)
+		for _, fd := range fds {
+			if target, er := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); er != nil || target != "anon_inode:inotify" {
+				continue
+			}
+			watches += countInotifyWatches(filepath.Join("/proc/self/fdinfo", fd.Name()))
+		}
+	}
+	if f, e := os.Open("/proc/self/status"); e == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "VmRSS:" {
+				if kb, e := strconv.ParseInt(fields[1], 10, 64); e == nil {
+					rss = kb * 1024
+				}
+			}
+		}
+	}
+	return
+}
+
+// countInotifyWatches counts the watches of an inotify descriptor, listed one per line in its fdinfo.
+func countInotifyWatches(fdinfo string) int {
+	data, e := ioutil.ReadFile(fdinfo)
+	if e != nil {
+		return 0
+	}
+	return strings.Count(string(data), "inotify wd:")
+}
@@ -0,0 +1,32 @@
+// +build !linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import "runtime"
+
+// measureResources only reports the memory obtained from the OS by the Go runtime: descriptors and watches are
+// not limited the same way on this platform.
+func measureResources() (openFiles, maxFiles, watches, maxWatches int, rss int64) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return -1, -1, -1, -1, int64(m.Sys)
+}
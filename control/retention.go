@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// DefaultRetentionInterval runs the retention rules every day at 3:00 UTC.
+const DefaultRetentionInterval = "R/2012-01-01T03:00:00.000Z/PT24H"
+
+// setupRetention installs a stash on the target of a one-way task.
+func (s *Syncer) setupRetention(left, right model.Endpoint, direction model.DirectionType) error {
+	var target model.Endpoint
+	switch direction {
+	case model.DirectionRight:
+		target = right
+	case model.DirectionLeft:
+		target = left
+	default:
+		return fmt.Errorf("retention rules require a one-way task")
+	}
+	if s.conf.AppendOnly {
+		return fmt.Errorf("retention rules cannot be used on append-only targets, that never remove anything")
+	}
+	if s.stash = endpoint.SetStash(target); s.stash == nil {
+		return fmt.Errorf("retention rules are not supported on %s", target.GetEndpointInfo().URI)
+	}
+	return nil
+}
+
+// enforceRetention prunes the stash of the target and reports the reclaimed space.
+func (s *Syncer) enforceRetention(ctx context.Context) {
+	if s.stash == nil {
+		return
+	}
+	report, e := s.stash.Enforce(ctx, s.conf.Retention)
+	if e != nil {
+		log.Logger(ctx).Error("Cannot apply retention rules: " + e.Error())
+		if report == nil {
+			return
+		}
+	}
+	log.Logger(ctx).Info(fmt.Sprintf("Retention rules removed %d stash entries, reclaimed %s, %s remaining", report.Removed, FormatSize(report.ReclaimedBytes), FormatSize(report.RemainingBytes)))
+	if report.Removed == 0 {
+		return
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationRetention,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  fmt.Sprintf(i18n.T("notification.retention"), report.Removed, FormatSize(report.ReclaimedBytes)),
+	})
+}
+
+// FormatSize formats a number of bytes for logs and notifications.
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
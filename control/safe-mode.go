@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+)
+
+// safeModeFile marks a task whose snapshots are being rebuilt, so that safe mode survives a restart.
+const safeModeFile = "safe-mode"
+
+// setupSafeMode checks the snapshots of the task before it starts. Corrupted ones are moved aside, and the task
+// runs in safe mode until they are rebuilt by a successful sync.
+func (s *Syncer) setupSafeMode(ctx context.Context, left, right model.Endpoint) {
+	s.safeEndpoints = []model.Endpoint{left, right}
+	moved, e := endpoint.RepairSnapshots(s.configPath)
+	if e != nil {
+		log.Logger(ctx).Error("Cannot move corrupted snapshot aside: " + e.Error())
+	}
+	if len(moved) == 0 {
+		if _, er := os.Stat(filepath.Join(s.configPath, safeModeFile)); er != nil {
+			return
+		}
+	}
+	s.enterSafeMode(ctx)
+}
+
+// enterSafeMode stops propagating deletions until the snapshots are rebuilt, and notifies the user.
+func (s *Syncer) enterSafeMode(ctx context.Context) {
+	s.safeLock.Lock()
+	defer s.safeLock.Unlock()
+	if s.safeMode != nil {
+		return
+	}
+	log.Logger(ctx).Warn("Entering safe mode: deletions will not be propagated until the snapshots are rebuilt")
+	if e := ioutil.WriteFile(filepath.Join(s.configPath, safeModeFile), []byte(time.Now().Format(time.RFC3339)), 0644); e != nil {
+		log.Logger(ctx).Error("Cannot write safe mode marker: " + e.Error())
+	}
+	s.safeMode = &endpoint.SafeMode{}
+	for _, ep := range s.safeEndpoints {
+		endpoint.SetSafeMode(ep, s.safeMode)
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationSafeMode,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  i18n.T("notification.safe-mode"),
+	})
+}
+
+// leaveSafeMode is called after a sync without errors: the snapshots are rebuilt, deletions are propagated again.
+func (s *Syncer) leaveSafeMode(ctx context.Context) {
+	s.safeLock.Lock()
+	defer s.safeLock.Unlock()
+	if s.safeMode == nil {
+		return
+	}
+	skipped := s.safeMode.Skipped()
+	log.Logger(ctx).Info(fmt.Sprintf("Snapshots rebuilt, leaving safe mode (%d deletions skipped)", skipped))
+	for _, ep := range s.safeEndpoints {
+		endpoint.SetSafeMode(ep, nil)
+	}
+	s.safeMode = nil
+	if e := os.Remove(filepath.Join(s.configPath, safeModeFile)); e != nil && !os.IsNotExist(e) {
+		log.Logger(ctx).Error("Cannot remove safe mode marker: " + e.Error())
+	}
+	PublishNotification(&common.Notification{
+		Type:     NotificationSafeMode,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  fmt.Sprintf(i18n.T("notification.safe-mode.done"), skipped),
+	})
+}
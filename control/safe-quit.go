@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	// safeQuitTimeout is the time given to running syncs to finish before they are interrupted.
+	safeQuitTimeout = 5 * time.Minute
+	// transferIdleDelay is the time after which a paused task without progressing transfers is considered idle.
+	transferIdleDelay = 10 * time.Second
+	// safeQuitCheckpoint is the time given to interrupted syncs to store their state.
+	safeQuitCheckpoint = 10 * time.Second
+)
+
+// running registers the tasks currently processing a sync.
+var running sync.Map
+
+// setRunning flags a task as processing or done.
+func setRunning(uuid string, r bool) {
+	if r {
+		running.Store(uuid, true)
+	} else {
+		running.Delete(uuid)
+	}
+}
+
+// runningTasks counts the tasks currently processing a sync.
+func runningTasks() (count int) {
+	running.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return
+}
+
+// waitRunning polls running tasks until they are all done or the timeout is reached.
+func waitRunning(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for runningTasks() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		<-time.After(time.Second)
+	}
+	return true
+}
+
+// safeQuit pauses all tasks, waits for the running syncs and in-flight transfers to finish and halts the process.
+// Syncs that are still running after safeQuitTimeout are interrupted, letting them store their last patch.
+// Stores and snapshots are then flushed and closed by the normal halt sequence.
+func (s *Supervisor) safeQuit() {
+	bus := GetBus()
+	log.Logger(s.ctx).Info("Pausing all tasks before quitting")
+	bus.Pub(MessagePause, TopicSyncAll)
+	if !waitRunning(safeQuitTimeout) {
+		log.Logger(s.ctx).Warn("Syncs are still running, interrupting them before quitting")
+		bus.Pub(MessageInterrupt, TopicSyncAll)
+		waitRunning(safeQuitCheckpoint)
+	}
+	log.Logger(s.ctx).Info("All tasks are paused, quitting now")
+	bus.Pub(MessageHalt, TopicGlobal)
+}
+
+// drainRunning is called when a task is paused: as its pass may never report done, its running flag is cleared
+// once its processor is idle, i.e. no file has progressed for transferIdleDelay.
+func (s *Syncer) drainRunning() {
+	if !runningTask(s.uuid) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if !runningTask(s.uuid) {
+				// Pass reported done
+				return
+			}
+			if !s.progress.InFlight(transferIdleDelay) {
+				break
+			}
+		}
+		if s.taskPaused {
+			setRunning(s.uuid, false)
+		}
+	}()
+}
+
+// runningTask checks if one task is currently processing a sync.
+func runningTask(uuid string) bool {
+	_, ok := running.Load(uuid)
+	return ok
+}
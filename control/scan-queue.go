@@ -0,0 +1,197 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	// scanGather lets the tasks started at the same time register before the first one is picked.
+	scanGather = 2 * time.Second
+	// scanSlotTimeout releases the slot of a task whose initial scan never reports.
+	scanSlotTimeout = 2 * time.Hour
+)
+
+type scanWaiter struct {
+	weight int64
+	ready  chan time.Time
+}
+
+// scanQueue limits the number of tasks running their initial scan at the same time. Waiting tasks are started
+// smallest first, and at least StaggerSeconds apart.
+type scanQueue struct {
+	sync.Mutex
+	running   int
+	waiting   []*scanWaiter
+	lastStart time.Time
+}
+
+var scans = &scanQueue{}
+
+func scanLimits() (max int, stagger time.Duration) {
+	if s := config.Default().Startup; s != nil {
+		return s.MaxConcurrentScans, time.Duration(s.StaggerSeconds) * time.Second
+	}
+	return 0, 0
+}
+
+// acquire blocks until the task can start scanning. It returns false if cancel is closed first.
+func (q *scanQueue) acquire(weight int64, cancel <-chan struct{}) bool {
+	w := &scanWaiter{weight: weight, ready: make(chan time.Time, 1)}
+	q.Lock()
+	q.waiting = append(q.waiting, w)
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		return q.waiting[i].weight < q.waiting[j].weight
+	})
+	q.Unlock()
+	time.AfterFunc(scanGather, q.dispatch)
+	select {
+	case at := <-w.ready:
+		select {
+		case <-time.After(time.Until(at)):
+			return true
+		case <-cancel:
+			q.release()
+			return false
+		}
+	case <-cancel:
+		q.Lock()
+		for i, other := range q.waiting {
+			if other == w {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+				break
+			}
+		}
+		q.Unlock()
+		select {
+		case <-w.ready:
+			q.release()
+		default:
+		}
+		return false
+	}
+}
+
+// release frees the slot of a task and starts the next ones.
+func (q *scanQueue) release() {
+	q.Lock()
+	q.running--
+	q.Unlock()
+	q.dispatch()
+}
+
+// dispatch starts the smallest waiting tasks while there are free slots.
+func (q *scanQueue) dispatch() {
+	max, stagger := scanLimits()
+	q.Lock()
+	defer q.Unlock()
+	for (max <= 0 || q.running < max) && len(q.waiting) > 0 {
+		w := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.running++
+		at := time.Now()
+		if next := q.lastStart.Add(stagger); next.After(at) {
+			at = next
+		}
+		q.lastStart = at
+		w.ready <- at
+	}
+}
+
+// snapshotsSize estimates the size of a task from its snapshots, new tasks being considered the smallest.
+func snapshotsSize(configPath string) (size int64) {
+	files, _ := filepath.Glob(filepath.Join(configPath, "snapshot-*"))
+	for _, f := range files {
+		if info, e := os.Stat(f); e == nil {
+			size += info.Size()
+		}
+	}
+	return
+}
+
+// startScheduled starts the task once it gets a scan slot, as starting runs its initial scan.
+func (s *Syncer) startScheduled(ctx context.Context, cancel chan struct{}) {
+	if !scans.acquire(snapshotsSize(s.configPath), cancel) {
+		return
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(scans.release)
+	}
+	s.startLock.Lock()
+	select {
+	case <-cancel:
+		s.startLock.Unlock()
+		release()
+		return
+	default:
+	}
+	s.started = true
+	s.scanRelease = release
+	s.startLock.Unlock()
+	time.AfterFunc(scanSlotTimeout, release)
+	log.Logger(ctx).Info("Starting initial scan")
+	s.task.Start(ctx, s.watches)
+}
+
+// isStarted checks if the task got its scan slot and was started.
+func (s *Syncer) isStarted() bool {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+	return s.started
+}
+
+// releaseScanSlot lets the next task start, once the initial scan is done.
+func (s *Syncer) releaseScanSlot() {
+	s.startLock.Lock()
+	release := s.scanRelease
+	s.startLock.Unlock()
+	if release != nil {
+		release()
+	}
+}
+
+// releaseHold clears the paused mode of a task started with holdStart, and returns the channel cancelling its start.
+func (s *Syncer) releaseHold() (chan struct{}, bool) {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+	if !s.holdStart {
+		return nil, false
+	}
+	s.holdStart = false
+	return s.startCancel, true
+}
+
+// cancelStart stops waiting for a scan slot, and returns true if the task was already started.
+func (s *Syncer) cancelStart() bool {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+	close(s.startCancel)
+	return s.started
+}
@@ -21,6 +21,8 @@ package control
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/pydio/cells-sync/config"
 	"github.com/pydio/cells/common/log"
@@ -30,10 +32,12 @@ import (
 
 // Scheduler is a supervisor service emitting various commands on a timely manner.
 type Scheduler struct {
-	tasks   []*config.Task
-	tickers []*schedule.Ticker
-	logCtx  context.Context
-	stop    chan bool
+	tasks  []*config.Task
+	logCtx context.Context
+	stop   chan bool
+
+	pendingLock sync.Mutex
+	pending     map[string]*config.Task
 }
 
 // NewScheduler creates a scheduler and register the schedules from the tasks configs.
@@ -42,53 +46,111 @@ func NewScheduler(tasks []*config.Task) *Scheduler {
 	ctx = servicecontext.WithServiceName(ctx, "scheduler")
 	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorRest)
 	return &Scheduler{
-		tasks:  tasks,
-		logCtx: ctx,
-		stop:   make(chan bool, 1),
+		tasks:   tasks,
+		logCtx:  ctx,
+		stop:    make(chan bool, 1),
+		pending: make(map[string]*config.Task),
 	}
 }
 
 // Serve implements supervisor service interface.
 func (s *Scheduler) Serve() {
 	for _, t := range s.tasks {
-		if t.LoopInterval != "" {
+		if t.LoopInterval != "" && !t.Manual {
 			// Check t.HasInterval
 			if i, e := schedule.NewTickerScheduleFromISO(t.LoopInterval); e == nil {
 				log.Logger(s.logCtx).Info("Starting a ticker for task loop - " + t.Label)
-				ticker := schedule.NewTicker(i, func() error {
-					go GetBus().Pub(MessageSyncLoop, TopicSync_+t.Uuid)
-					return nil
+				uuid := t.Uuid
+				go s.tick(i, func() {
+					go GetBus().Pub(MessageSyncLoop, TopicSync_+uuid)
 				})
-				ticker.Start()
-				s.tickers = append(s.tickers, ticker)
 			} else {
 				log.Logger(s.logCtx).Error("Cannot parse interval as duration :" + e.Error())
 			}
 		}
-		if t.HardInterval != "" {
+		if t.HardInterval != "" && !t.Manual {
 			// Check t.HasInterval
 			if i, e := schedule.NewTickerScheduleFromISO(t.HardInterval); e == nil {
 				log.Logger(s.logCtx).Info("Starting a ticker for task full resync - " + t.Label)
-				ticker := schedule.NewTicker(i, func() error {
-					go GetBus().Pub(MessageResync, TopicSync_+t.Uuid)
-					return nil
+				task := t
+				go s.tick(i, func() {
+					s.requestRescan(task)
 				})
-				ticker.Start()
-				s.tickers = append(s.tickers, ticker)
 			} else {
 				log.Logger(s.logCtx).Error("Cannot parse interval as duration :" + e.Error())
 			}
 		}
+		if t.Retention != nil || t.Trash != nil {
+			interval := DefaultRetentionInterval
+			if t.Retention != nil && t.Retention.Interval != "" {
+				interval = t.Retention.Interval
+			}
+			if i, e := schedule.NewTickerScheduleFromISO(interval); e == nil {
+				log.Logger(s.logCtx).Info("Starting a ticker for task retention rules and trash purge - " + t.Label)
+				uuid := t.Uuid
+				go s.tick(i, func() {
+					go GetBus().Pub(MessageRetention, TopicSync_+uuid)
+				})
+			} else {
+				log.Logger(s.logCtx).Error("Cannot parse interval as duration :" + e.Error())
+			}
+		}
+	}
+	ticker := config.GetClock().NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			s.runPendingRescans()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// tick calls fn on each execution of the schedule, using the application clock, until the scheduler is stopped.
+func (s *Scheduler) tick(i *schedule.TickerSchedule, fn func()) {
+	clock := config.GetClock()
+	for {
+		now := clock.Now()
+		timer := clock.NewTimer(i.NextExecutionAfter(now).Sub(now))
+		select {
+		case <-timer.C():
+			fn()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// requestRescan triggers a full resync if the task rescan policy allows it now, or postpones it.
+func (s *Scheduler) requestRescan(t *config.Task) {
+	if rescanAllowed(t.Rescan, config.GetClock().Now()) {
+		go GetBus().Pub(MessageScheduledResync, TopicSync_+t.Uuid)
+		return
+	}
+	log.Logger(s.logCtx).Info("Full resync postponed by rescan policy - " + t.Label)
+	s.pendingLock.Lock()
+	s.pending[t.Uuid] = t
+	s.pendingLock.Unlock()
+}
+
+// runPendingRescans triggers the postponed rescans that are now allowed.
+func (s *Scheduler) runPendingRescans() {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	for id, t := range s.pending {
+		if rescanAllowed(t.Rescan, config.GetClock().Now()) {
+			log.Logger(s.logCtx).Info("Running postponed full resync - " + t.Label)
+			go GetBus().Pub(MessageScheduledResync, TopicSync_+id)
+			delete(s.pending, id)
+		}
 	}
-	<-s.stop
 }
 
 // Stop implements supervisor service interface.
 func (s *Scheduler) Stop() {
-	log.Logger(s.logCtx).Info("Stopping all tickers")
-	for _, t := range s.tickers {
-		t.Stop()
-	}
 	log.Logger(s.logCtx).Info("Stopping scheduler")
 	close(s.stop)
 }
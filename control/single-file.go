@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"time"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// singleFileDebounce coalesces the bursts of events sent by applications saving a file (temporary copy, rename,
+// metadata update) into a single sync.
+const singleFileDebounce = 2 * time.Second
+
+// taskRoots returns the selective roots of the task: the file of a file-rooted task, or the configured roots.
+func taskRoots(roots []string, file string) []string {
+	if file != "" {
+		return []string{file}
+	}
+	return roots
+}
+
+// safeReplacePatterns returns the files that must settle before being synced, and that are verified before being
+// replaced: known database formats, and the file of a file-rooted task.
+func safeReplacePatterns(file string) []string {
+	patterns := append([]string{}, endpoint.SafeReplacePatterns...)
+	if file != "" {
+		patterns = append(patterns, file)
+	}
+	return patterns
+}
+
+// setupSingleFile debounces the events of the local sides of a file-rooted task. The watcher stays on the parent
+// folder, the filters only keep the file.
+func (s *Syncer) setupSingleFile(endpoints ...model.Endpoint) {
+	for _, ep := range endpoints {
+		endpoint.SetDebounce(ep, singleFileDebounce)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pydio/cells/common/log"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells-sync/i18n"
+)
+
+// migrateSnapshots upgrades the snapshots of the task when this release changed their schema, before they are
+// opened. If the migration fails, the snapshots are restored from their backup and the task starts paused. It
+// cannot be resumed by this process: the user must roll back to the previous release.
+func (s *Syncer) migrateSnapshots(ctx context.Context) {
+	binary := common.Version
+	if common.BuildRevision != "" {
+		binary += " (" + common.BuildRevision + ")"
+	}
+	reports, e := endpoint.MigrateSnapshots(s.configPath, binary)
+	for _, r := range reports {
+		log.Logger(ctx).Info("Snapshot migration: " + r.String())
+	}
+	if e == nil {
+		if len(reports) > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Snapshots upgraded to schema %d", endpoint.SnapshotSchemaVersion))
+		}
+		return
+	}
+	log.Logger(ctx).Error("Cannot upgrade snapshots: " + e.Error())
+	s.holdStart = true
+	s.migrationFailed = true
+	PublishNotification(&common.Notification{
+		Type:     NotificationMigration,
+		TaskUuid: s.uuid,
+		Title:    s.label,
+		Message:  fmt.Sprintf(i18n.T("notification.migration.failed"), s.uuid),
+	})
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/merger"
+
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// retryChangedSources schedules a new sync loop when some uploads were aborted because the local file changed
+// while it was read, or some databases were not ready. Files are only read again once they have been stable for the
+// hot delay.
+func (s *Syncer) retryChangedSources(ctx context.Context, patch merger.Patch) {
+	var changed []string
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile}, func(operation merger.Operation) {
+		switch c := errors.Cause(operation.Error()).(type) {
+		case *endpoint.SourceChangedError:
+			changed = append(changed, c.Path)
+		case *endpoint.FileBusyError:
+			changed = append(changed, c.Path)
+		}
+	})
+	if len(changed) == 0 || s.manual() || !atomic.CompareAndSwapInt32(&s.changedRetry, 0, 1) {
+		return
+	}
+	log.Logger(ctx).Info("Files changed while they were uploaded, retrying later: " + strings.Join(changed, ", "))
+	time.AfterFunc(endpoint.DefaultHotDelay+5*time.Second, func() {
+		atomic.StoreInt32(&s.changedRetry, 0)
+		GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+	})
+}
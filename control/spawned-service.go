@@ -4,47 +4,225 @@ import (
 	"bufio"
 	"context"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/pydio/cells-sync/common"
 	"github.com/pydio/cells-sync/config"
 	servicecontext "github.com/pydio/cells/common/service/context"
 
 	"github.com/pydio/cells/common/log"
 )
 
+// States of a SpawnedService
+const (
+	SpawnedStarting = "starting"
+	SpawnedRunning  = "running"
+	SpawnedCrashed  = "crashed"
+	SpawnedBackoff  = "backoff"
+	SpawnedFailed   = "failed"
+	SpawnedStopped  = "stopped"
+)
+
+var (
+	spawnedRegistry = make(map[string]*SpawnedService)
+	spawnedLock     sync.Mutex
+)
+
+// SpawnedStatus describes the state of a sub-process, with the reason of its last crash. It is published on the
+// bus on each change, and broadcast to the UI as a SERVICE message.
+type SpawnedStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Pid       int       `json:"pid,omitempty"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	Since     time.Time `json:"since"`
+	NextStart time.Time `json:"nextStart,omitempty"`
+}
+
 // SpawnedService is a supervisor service for launching a command and automatically restarting if it fails.
+// Restarts are delayed with an exponential backoff, and the service gives up after MaxRetries consecutive crashes.
 type SpawnedService struct {
-	name   string
-	args   []string
-	cancel context.CancelFunc
-	logCtx context.Context
+	sync.Mutex
+	name       string
+	executable string
+	args       []string
+	cancel     context.CancelFunc
+	logCtx     context.Context
+
+	// MaxRetries is the number of consecutive crashes before giving up (0 for no limit)
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the delay before a restart
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StableAfter is the running time after which the crash counter is reset
+	StableAfter time.Duration
+
+	probe         func() error
+	probeInterval time.Duration
+	health        chan SpawnedStatus
+	stop          chan struct{}
+	status        SpawnedStatus
+	failures      int
 }
 
-// NewSpawnedService creates a SpawnedService
+// NewSpawnedService creates a SpawnedService running the application itself with args.
 func NewSpawnedService(name string, args []string) *SpawnedService {
 	s := &SpawnedService{
-		name: name,
-		args: args,
+		name:        name,
+		args:        args,
+		MaxRetries:  10,
+		MinBackoff:  time.Second,
+		MaxBackoff:  2 * time.Minute,
+		StableAfter: 5 * time.Minute,
+		health:      make(chan SpawnedStatus, 10),
+		status:      SpawnedStatus{Name: name, State: SpawnedStopped, Since: time.Now()},
 	}
 	ctx := servicecontext.WithServiceName(context.Background(), name)
 	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorOther)
 	s.logCtx = ctx
+	spawnedLock.Lock()
+	spawnedRegistry[name] = s
+	spawnedLock.Unlock()
 	return s
 }
 
-// Serve implements supervisor service interface.
+// SpawnedStatuses returns the status of all sub-processes, sorted by name.
+func SpawnedStatuses() (statuses []SpawnedStatus) {
+	spawnedLock.Lock()
+	defer spawnedLock.Unlock()
+	for _, s := range spawnedRegistry {
+		statuses = append(statuses, s.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return
+}
+
+// SetProbe registers a liveness probe, called at each interval while the process is running. The process is
+// killed, and thus restarted, if the probe fails three times in a row.
+func (c *SpawnedService) SetProbe(interval time.Duration, probe func() error) {
+	c.probe = probe
+	c.probeInterval = interval
+}
+
+// Health returns a channel receiving each status change. Changes are dropped if the channel is not read.
+func (c *SpawnedService) Health() <-chan SpawnedStatus {
+	return c.health
+}
+
+// Status returns the current status of the sub-process.
+func (c *SpawnedService) Status() SpawnedStatus {
+	c.Lock()
+	defer c.Unlock()
+	return c.status
+}
+
+// setStatus updates the status and publishes it on the bus and the health channel.
+func (c *SpawnedService) setStatus(state string, pid int, err error, next time.Time) {
+	c.Lock()
+	c.status.State = state
+	c.status.Pid = pid
+	c.status.Since = time.Now()
+	c.status.NextStart = next
+	if err != nil {
+		c.status.LastError = err.Error()
+	}
+	if state == SpawnedCrashed {
+		c.status.Restarts++
+	}
+	status := c.status
+	c.Unlock()
+	select {
+	case c.health <- status:
+	default:
+	}
+	GetBus().Pub(&common.Message{Type: "SERVICE", Content: status}, TopicState)
+}
+
+// backoff doubles the restart delay after each consecutive crash.
+func (c *SpawnedService) backoff() time.Duration {
+	d := c.MinBackoff
+	for i := 1; i < c.failures && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return d
+}
+
+// Serve implements supervisor service interface. It runs the command until Stop is called, restarting it when
+// it exits.
 func (c *SpawnedService) Serve() {
+	c.Lock()
+	c.stop = make(chan struct{})
+	stop := c.stop
+	c.failures = 0
+	c.Unlock()
+	for {
+		started := time.Now()
+		err := c.run()
+		select {
+		case <-stop:
+			c.setStatus(SpawnedStopped, 0, nil, time.Time{})
+			return
+		default:
+		}
+		if time.Since(started) > c.StableAfter {
+			c.failures = 0
+		}
+		var delay time.Duration
+		if err != nil {
+			log.Logger(c.logCtx).Error("Error on sub process : " + err.Error())
+			c.failures++
+			c.setStatus(SpawnedCrashed, 0, err, time.Time{})
+			if c.MaxRetries > 0 && c.failures > c.MaxRetries {
+				log.Logger(c.logCtx).Error("Sub process crashed too many times, giving up")
+				c.setStatus(SpawnedFailed, 0, nil, time.Time{})
+				<-stop
+				c.setStatus(SpawnedStopped, 0, nil, time.Time{})
+				return
+			}
+			delay = c.backoff()
+		} else {
+			log.Logger(c.logCtx).Info("Sub process exited, restarting")
+			delay = c.MinBackoff
+		}
+		c.setStatus(SpawnedBackoff, 0, nil, time.Now().Add(delay))
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			c.setStatus(SpawnedStopped, 0, nil, time.Time{})
+			return
+		}
+	}
+}
+
+// run starts the command and waits for it to exit.
+func (c *SpawnedService) run() error {
+	c.setStatus(SpawnedStarting, 0, nil, time.Time{})
 	log.Logger(c.logCtx).Info("Starting sub-process with args " + strings.Join(c.args, " "))
-	pName := config.ProcessName(os.Args[0])
+	pName := c.executable
+	if pName == "" {
+		pName = config.ProcessName(os.Args[0])
+	}
 	cmd, cancel := killableSpawn(pName, c.args)
+	defer cancel()
+	c.Lock()
 	c.cancel = cancel
+	c.Unlock()
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return // PRINT SOMETHING
+		return err
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return // PRINT SOMETHING
+		return err
 	}
 	scannerOut := bufio.NewScanner(stdout)
 	go func() {
@@ -60,15 +238,49 @@ func (c *SpawnedService) Serve() {
 			log.Logger(c.logCtx).Error(text)
 		}
 	}()
-	if e := cmd.Run(); e != nil && !strings.Contains(e.Error(), "killed") {
-		log.Logger(c.logCtx).Error("Error on sub process : " + e.Error())
-		c.cancel = nil
-		panic(e)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	c.setStatus(SpawnedRunning, cmd.Process.Pid, nil, time.Time{})
+	exited := make(chan struct{})
+	defer close(exited)
+	if c.probe != nil {
+		go c.watchProbe(cancel, exited)
+	}
+	return cmd.Wait()
+}
+
+// watchProbe kills the process if the liveness probe fails three times in a row.
+func (c *SpawnedService) watchProbe(cancel context.CancelFunc, exited chan struct{}) {
+	failed := 0
+	for {
+		select {
+		case <-time.After(c.probeInterval):
+			if e := c.probe(); e != nil {
+				failed++
+				log.Logger(c.logCtx).Error("Liveness probe failed: " + e.Error())
+				if failed >= 3 {
+					log.Logger(c.logCtx).Error("Killing unresponsive sub process")
+					cancel()
+					return
+				}
+			} else {
+				failed = 0
+			}
+		case <-exited:
+			return
+		}
 	}
 }
 
 // Stop implements supervisor service interface.
 func (c *SpawnedService) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
 	if c.cancel != nil {
 		c.cancel()
 		c.cancel = nil
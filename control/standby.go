@@ -0,0 +1,152 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+const (
+	// defaultStandbyThreshold is the time the primary server must be unreachable before switching to the standby.
+	defaultStandbyThreshold = 15 * time.Minute
+	// standbyCheckInterval is the interval between checks of the primary server.
+	standbyCheckInterval = time.Minute
+)
+
+var (
+	// standbyTasks registers the tasks currently running on their standby server.
+	standbyTasks sync.Map
+	// standbyReturned registers the tasks switched back to their primary server, that need a full resync.
+	standbyReturned sync.Map
+)
+
+// StandbySwitch is published on TopicGlobal to restart a task on its standby server (Active), or back on its
+// primary server.
+type StandbySwitch struct {
+	Uuid   string
+	Active bool
+}
+
+// remoteURI returns the URI of the remote side of a task: the side that is not a local folder.
+func remoteURI(conf *config.Task) *string {
+	if _, ok := endpoint.LocalPathForURI(conf.RightURI); ok {
+		return &conf.LeftURI
+	}
+	return &conf.RightURI
+}
+
+// standbyTask returns the task to run: a copy using the standby server while the task is switched to it.
+func standbyTask(conf *config.Task) (*config.Task, bool) {
+	if conf.Standby == nil || conf.Standby.URI == "" {
+		standbyTasks.Delete(conf.Uuid)
+		return conf, false
+	}
+	if _, ok := standbyTasks.Load(conf.Uuid); !ok {
+		return conf, false
+	}
+	c := *conf
+	*remoteURI(&c) = conf.Standby.URI
+	return &c, true
+}
+
+// remoteConnected checks the connection of the remote side in the task state.
+func (s *Syncer) remoteConnected() bool {
+	state := s.stateStore.LastState()
+	info := state.RightInfo
+	if remoteURI(s.conf) == &s.conf.LeftURI {
+		info = state.LeftInfo
+	}
+	return info != nil && info.Connected
+}
+
+// watchStandby switches the task to its standby server once the primary server has been unreachable for the
+// threshold, and back to the primary server as soon as it answers again.
+func (s *Syncer) watchStandby(done chan bool) {
+	if s.conf.Standby == nil || s.conf.Standby.URI == "" {
+		return
+	}
+	threshold := defaultStandbyThreshold
+	if s.conf.Standby.ThresholdMinutes > 0 {
+		threshold = time.Duration(s.conf.Standby.ThresholdMinutes) * time.Minute
+	}
+	ticker := time.NewTicker(standbyCheckInterval)
+	defer ticker.Stop()
+	since := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if s.standby {
+				if a := config.Default().AuthorityForURI(s.primary); a != nil && a.Reachable() {
+					log.Logger(s.serviceCtx).Info("Primary server is reachable again, leaving standby server")
+					GetBus().Pub(&StandbySwitch{Uuid: s.uuid}, TopicGlobal)
+					return
+				}
+			} else if s.remoteConnected() {
+				since = time.Now()
+			} else if time.Since(since) > threshold {
+				log.Logger(s.serviceCtx).Warn("Primary server unreachable for " + threshold.String() + ", switching to standby server " + s.conf.Standby.URI)
+				GetBus().Pub(&StandbySwitch{Uuid: s.uuid, Active: true}, TopicGlobal)
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// switchStandby restarts a task on its standby server, or back on its primary server. Snapshots of both servers
+// are kept apart, and switching back triggers a full resync to merge the changes made on the standby server.
+func (s *Supervisor) switchStandby(sw *StandbySwitch) {
+	var task *config.Task
+	for _, t := range config.Default().Tasks {
+		if t.Uuid == sw.Uuid {
+			task = t
+		}
+	}
+	if task == nil {
+		return
+	}
+	if sw.Active {
+		standbyTasks.Store(sw.Uuid, true)
+	} else {
+		standbyTasks.Delete(sw.Uuid)
+		standbyReturned.Store(sw.Uuid, true)
+	}
+	s.Lock()
+	token, ok := s.tasksTokens[sw.Uuid]
+	s.Unlock()
+	if !ok {
+		return
+	}
+	log.Logger(s.ctx).Info("Restarting Task " + sw.Uuid + " to switch server")
+	GetBus().Pub(MessageRestart, TopicSync_+sw.Uuid)
+	s.Remove(token)
+	<-time.After(5 * time.Second)
+	token = s.Add(newTaskService(task))
+	s.Lock()
+	s.tasksTokens[sw.Uuid] = token
+	s.Unlock()
+}
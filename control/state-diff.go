@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// stateDiffsMax is the number of diffs sent for a task before a full state is sent again.
+	stateDiffsMax = 50
+	// stateFullInterval is the maximum time between two full states of a task.
+	stateFullInterval = 30 * time.Second
+)
+
+type diffedState struct {
+	status   model.TaskStatus
+	fields   map[string]interface{}
+	diffs    int
+	lastFull time.Time
+}
+
+// stateDiffer turns the states of the tasks into incremental diffs against the last state sent to the websocket
+// clients. Full states are sent when the status of a task changes, periodically, and after a client connected.
+type stateDiffer struct {
+	sync.Mutex
+	tasks map[string]*diffedState
+}
+
+func newStateDiffer() *stateDiffer {
+	return &stateDiffer{tasks: make(map[string]*diffedState)}
+}
+
+// reset forgets the states sent so far, so that the next state of each task is sent in full.
+func (d *stateDiffer) reset() {
+	d.Lock()
+	d.tasks = make(map[string]*diffedState)
+	d.Unlock()
+}
+
+// message returns the message to broadcast for a state: a STATE message with the full state, or a STATE_DIFF
+// message with the fields that changed since the last one. It returns nil if nothing changed.
+func (d *stateDiffer) message(state common.SyncState) *common.Message {
+	full := &common.Message{Type: "STATE", Content: state}
+	fields, e := stateFields(state)
+	if e != nil {
+		return full
+	}
+	d.Lock()
+	defer d.Unlock()
+	last, ok := d.tasks[state.UUID]
+	if !ok || last.status != state.Status || last.diffs >= stateDiffsMax || time.Since(last.lastFull) > stateFullInterval {
+		d.tasks[state.UUID] = &diffedState{status: state.Status, fields: fields, lastFull: time.Now()}
+		return full
+	}
+	patch := mergePatch(last.fields, fields)
+	if len(patch) == 0 {
+		return nil
+	}
+	last.fields = fields
+	last.diffs++
+	return &common.Message{Type: "STATE_DIFF", Content: &common.StateDiff{UUID: state.UUID, Patch: patch}}
+}
+
+// stateFields converts a state to its JSON representation as a generic map.
+func stateFields(state common.SyncState) (map[string]interface{}, error) {
+	data, e := json.Marshal(state)
+	if e != nil {
+		return nil, e
+	}
+	var fields map[string]interface{}
+	if e := json.Unmarshal(data, &fields); e != nil {
+		return nil, e
+	}
+	return fields, nil
+}
+
+// mergePatch computes the JSON merge patch turning from into to. Objects are diffed recursively, other values,
+// including arrays, are replaced as a whole.
+func mergePatch(from, to map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for k, v := range to {
+		old, ok := from[k]
+		if !ok {
+			patch[k] = v
+			continue
+		}
+		if reflect.DeepEqual(old, v) {
+			continue
+		}
+		oldMap, oldIsMap := old.(map[string]interface{})
+		newMap, newIsMap := v.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			patch[k] = mergePatch(oldMap, newMap)
+		} else {
+			patch[k] = v
+		}
+	}
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
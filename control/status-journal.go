@@ -0,0 +1,127 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const maxJournalMessages = 1000
+
+var journalBucket = []byte("messages")
+
+// statusJournal persists state transitions and notifications sent to the websocket clients, with a
+// sequence number that survives agent restarts. Clients reconnecting with their last seen sequence
+// receive the messages they missed.
+type statusJournal struct {
+	sync.Mutex
+	db       *bbolt.DB
+	statuses map[string]model.TaskStatus
+}
+
+func newStatusJournal() (*statusJournal, error) {
+	db, e := bbolt.Open(filepath.Join(config.SyncClientDataDir(), "status-journal"), 0644, endpoint.BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	return &statusJournal{db: db, statuses: make(map[string]model.TaskStatus)}, nil
+}
+
+// Record assigns a sequence number to a message and stores it, if it is a notification or a state
+// carrying a status change. Other messages are returned untouched.
+func (j *statusJournal) Record(m *common.Message) *common.Message {
+	j.Lock()
+	defer j.Unlock()
+	if state, ok := m.Content.(common.SyncState); ok {
+		if previous, known := j.statuses[state.UUID]; known && previous == state.Status {
+			return m
+		}
+		j.statuses[state.UUID] = state.Status
+	} else if m.Type != "NOTIFICATION" {
+		return m
+	}
+	j.db.Update(func(tx *bbolt.Tx) error {
+		bucket, e := tx.CreateBucketIfNotExists(journalBucket)
+		if e != nil {
+			return e
+		}
+		seq, e := bucket.NextSequence()
+		if e != nil {
+			return e
+		}
+		m.Seq = seq
+		if e := bucket.Put(journalKey(seq), m.Bytes()); e != nil {
+			return e
+		}
+		// Prune oldest messages
+		if seq > maxJournalMessages {
+			c := bucket.Cursor()
+			limit := journalKey(seq - maxJournalMessages)
+			var prunes [][]byte
+			for k, _ := c.First(); k != nil && string(k) <= string(limit); k, _ = c.Next() {
+				prunes = append(prunes, k)
+			}
+			for _, k := range prunes {
+				bucket.Delete(k)
+			}
+		}
+		return nil
+	})
+	return m
+}
+
+// Since lists the messages recorded after lastSeq. Complete is false if some messages were already pruned.
+func (j *statusJournal) Since(lastSeq uint64) (messages [][]byte, complete bool) {
+	j.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(journalBucket)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		first, _ := c.First()
+		complete = first == nil || binary.BigEndian.Uint64(first) <= lastSeq+1
+		for k, v := c.Seek(journalKey(lastSeq + 1)); k != nil; k, v = c.Next() {
+			messages = append(messages, append([]byte{}, v...))
+		}
+		return nil
+	})
+	return
+}
+
+// Close closes the DB.
+func (j *statusJournal) Close() {
+	j.db.Close()
+}
+
+func journalKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/olahol/melody.v1"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// summaryCache keeps the last state of each task, to build the summary polled by the system tray.
+type summaryCache struct {
+	sync.Mutex
+	states map[string]common.SyncState
+}
+
+func newSummaryCache() *summaryCache {
+	return &summaryCache{states: make(map[string]common.SyncState)}
+}
+
+// update stores the last state of a task, or forgets it if the task was removed.
+func (c *summaryCache) update(s common.SyncState) {
+	c.Lock()
+	defer c.Unlock()
+	if s.Status == model.TaskStatusRemoved {
+		delete(c.states, s.UUID)
+		return
+	}
+	c.states[s.UUID] = s
+}
+
+// statusSeverity orders task statuses from the least to the most important one to display.
+func statusSeverity(s model.TaskStatus) int {
+	switch s {
+	case model.TaskStatusError:
+		return 5
+	case model.TaskStatusProcessing:
+		return 4
+	case model.TaskStatusRestarting, model.TaskStatusStopping:
+		return 3
+	case model.TaskStatusIdle:
+		return 2
+	case model.TaskStatusPaused:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// empty returns true if no states were received yet.
+func (c *summaryCache) empty() bool {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.states) == 0
+}
+
+// summary aggregates the cached states. Disconnected tasks are reported as errors.
+func (c *summaryCache) summary() *common.StatusSummary {
+	sum := &common.StatusSummary{Status: model.TaskStatusIdle}
+	worst := -1
+	c.Lock()
+	for _, s := range c.states {
+		t := &common.TaskSummary{
+			UUID:      s.UUID,
+			Status:    s.Status,
+			Connected: s.LeftInfo != nil && s.LeftInfo.Connected && s.RightInfo != nil && s.RightInfo.Connected,
+			Pending:   len(s.ActiveFiles),
+		}
+		if s.Config != nil {
+			t.Label = s.Config.Label
+		}
+		if s.LastProcessStatus != nil {
+			t.Message = s.LastProcessStatus.String()
+		}
+		status := s.Status
+		if !t.Connected && status != model.TaskStatusDisabled && status != model.TaskStatusPaused {
+			status = model.TaskStatusError
+		}
+		if sev := statusSeverity(status); sev > worst {
+			worst, sum.Status = sev, status
+		}
+		sum.Pending += len(s.ActiveFiles)
+		if s.Throughput != nil {
+			sum.UpRate += s.Throughput.UpRate
+			sum.DownRate += s.Throughput.DownRate
+		}
+		for _, e := range s.Errors {
+			if e.Code == ErrorCodeUnauthorized {
+				sum.AuthProblems++
+				break
+			}
+		}
+		sum.Tasks = append(sum.Tasks, t)
+	}
+	c.Unlock()
+	sort.Slice(sum.Tasks, func(i, j int) bool {
+		return sum.Tasks[i].Label < sum.Tasks[j].Label
+	})
+	sum.ResourceWarnings = CurrentResources().Warnings
+	for _, a := range config.Default().Authorities {
+		// Tokens are refreshed before expiration, an expired one means that the refresh failed
+		if a.ExpiresAt > 0 && time.Now().After(time.Unix(int64(a.ExpiresAt), 0).Add(time.Minute)) {
+			sum.AuthProblems++
+		}
+	}
+	return sum
+}
+
+// verboseSession returns false for websocket clients that only subscribed to notifications, like the system
+// tray, which polls the summary instead of receiving all task states.
+func verboseSession(s *melody.Session) bool {
+	return s.Request.URL.Query().Get("events") != "notifications"
+}
+
+// statusSummary returns the aggregated status of all tasks.
+func (h *HttpServer) statusSummary(c *gin.Context) {
+	if h.summaries.empty() {
+		// Ask tasks to publish their state for the next call
+		GetBus().Pub(MessagePublishState, TopicSyncAll)
+	}
+	c.JSON(http.StatusOK, h.summaries.summary())
+}
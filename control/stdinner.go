@@ -39,14 +39,14 @@ func (s *StdInner) Serve() {
 	s.ctx = servicecontext.WithServiceName(context.Background(), "scanner")
 	s.ctx = servicecontext.WithServiceColor(s.ctx, servicecontext.ServiceColorOther)
 
-	log.Logger(s.ctx).Info("Use 'quit' or Ctrl+C to exit, type 'resync', 'dry', 'loop' to control syncs, 'pause' or 'resume'")
+	log.Logger(s.ctx).Info("Use 'quit' or Ctrl+C to exit, type 'resync', 'dry', 'loop' to control syncs, 'pause' or 'resume', 'stop-all' to quit once running syncs are done")
 	bus := GetBus()
 	if os.Stdin != nil {
 		scanner := bufio.NewScanner(os.Stdin)
 		for scanner.Scan() {
 			text := scanner.Text()
 			if cmd, e := MessageFromString(text); e == nil {
-				if cmd == MessageHalt {
+				if cmd == MessageHalt || cmd == MessageSafeQuit {
 					bus.Pub(cmd, TopicGlobal)
 				} else {
 					bus.Pub(cmd, TopicSyncAll)
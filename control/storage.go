@@ -0,0 +1,55 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"os"
+
+	"github.com/pydio/cells/common/log"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// compactSnapshots rewrites the snapshots of the task that grew over the configured threshold, when the local
+// databases use the compact storage mode. It runs before the snapshots are opened, as on 32-bit platforms
+// mapping a large file may fail.
+func (s *Syncer) compactSnapshots(ctx context.Context) {
+	if !endpoint.StorageCompact() {
+		return
+	}
+	storage := config.Default().Storage
+	if storage == nil {
+		storage = config.NewStorage()
+	}
+	for name, p := range endpoint.SnapshotFiles(s.configPath) {
+		info, e := os.Stat(p)
+		if e != nil || info.Size() < storage.CompactThreshold() {
+			continue
+		}
+		report, e := endpoint.CompactSnapshot(name, p, nil)
+		if e != nil {
+			log.Logger(ctx).Error("Cannot compact snapshot " + name + ": " + e.Error())
+			continue
+		}
+		log.Logger(ctx).Info("Compacted large snapshot: " + report.String())
+	}
+}
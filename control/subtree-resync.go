@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+)
+
+const (
+	// ResyncDownload replaces local files differing from the server
+	ResyncDownload = "download"
+	// ResyncUpload replaces server files differing from the local ones
+	ResyncUpload = "upload"
+
+	// resyncSubtreeTimeout is the time given to a task to compare a folder on both sides
+	resyncSubtreeTimeout = 10 * time.Minute
+)
+
+// SubtreeResync asks a task to verify again one folder only. Snapshot entries under Path are dropped, so that the
+// next pass compares both sides of the folder as if they were new: files found on one side only are copied to the
+// other one, and different files become conflicts unless Direction forces one side.
+type SubtreeResync struct {
+	Path      string
+	Direction string `json:"Direction,omitempty"`
+}
+
+// SubtreeResyncResponse describes the differences found in the folder before resyncing it.
+type SubtreeResyncResponse struct {
+	Path   string
+	Report *DriftReport
+}
+
+// resyncSubtree compares the folder on both sides, forces the requested direction on different files, invalidates
+// the snapshots under the folder and triggers a sync pass.
+func (s *Syncer) resyncSubtree(ctx context.Context, r *SubtreeResync) (*DriftReport, error) {
+	factory, ok := s.snapFactory.(*endpoint.SnapshotFactory)
+	if !ok {
+		return nil, fmt.Errorf("task does not use snapshots")
+	}
+	folder := "/" + strings.Trim(r.Path, "/")
+	keep := endpoint.FilterMatcher(taskRoots(s.conf.SelectiveRoots, s.conf.File), s.ignores)
+	report := &DriftReport{Checked: time.Now(), Direction: s.conf.Direction}
+	var left, right map[string]*tree.Node
+	var leftErr, rightErr error
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		left, leftErr = driftWalk(s.task.Source, folder, keep)
+	}()
+	go func() {
+		defer wg.Done()
+		right, rightErr = driftWalk(s.task.Target, folder, keep)
+	}()
+	wg.Wait()
+	if leftErr != nil {
+		return nil, leftErr
+	} else if rightErr != nil {
+		return nil, rightErr
+	}
+	compareDrift(report, left, right)
+	log.Logger(ctx).Info("Resyncing " + folder + ": " + report.String())
+
+	if r.Direction != "" {
+		winner := ActionKeepRemote
+		if r.Direction == ResyncUpload {
+			winner = ActionKeepLocal
+		}
+		for _, p := range report.Different {
+			if n, ok := left[p]; !ok || !n.IsLeaf() {
+				continue
+			}
+			if e := s.resolveConflict(ctx, &ConflictResolution{Path: p, Keep: winner}); e != nil {
+				log.Logger(ctx).Error("Cannot resync " + p + ": " + e.Error())
+			}
+		}
+	}
+	if _, e := factory.Invalidate(ctx, folder); e != nil {
+		return report, e
+	}
+	go GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
+	return report, nil
+}
+
+// resyncTaskSubtree verifies again one folder of a task. The task must be idle.
+func (h *HttpServer) resyncTaskSubtree(c *gin.Context) {
+	var request SubtreeResync
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	switch request.Direction {
+	case "", ResyncDownload, ResyncUpload:
+	default:
+		h.writeError(c, fmt.Errorf("unknown direction %s, use %s or %s", request.Direction, ResyncDownload, ResyncUpload))
+		return
+	}
+	uuid := c.Param("uuid")
+	var found bool
+	for _, t := range config.Default().Tasks {
+		found = found || t.Uuid == uuid
+	}
+	if !found {
+		h.writeError(c, fmt.Errorf("cannot find task %s", uuid))
+		return
+	}
+	if runningTask(uuid) {
+		h.writeError(c, fmt.Errorf("task is currently syncing, please retry when it is idle"))
+		return
+	}
+	bus := GetBus()
+	topic := TopicResync_ + uuid
+	responses := bus.Sub(topic)
+	defer bus.Unsub(responses, topic)
+	go bus.Pub(&request, TopicSync_+uuid)
+	select {
+	case m := <-responses:
+		switch r := m.(type) {
+		case *SubtreeResyncResponse:
+			c.JSON(http.StatusOK, r)
+		case error:
+			h.writeError(c, r)
+		}
+	case <-time.After(resyncSubtreeTimeout):
+		h.writeError(c, fmt.Errorf("task did not respond"))
+	}
+}
+
+// replyResyncSubtree runs a subtree resync requested on the bus and publishes its outcome.
+func (s *Syncer) replyResyncSubtree(ctx context.Context, r *SubtreeResync) {
+	var reply interface{}
+	if report, e := s.resyncSubtree(ctx, r); e != nil {
+		log.Logger(ctx).Error("Cannot resync " + r.Path + ": " + e.Error())
+		reply = e
+	} else {
+		reply = &SubtreeResyncResponse{Path: "/" + strings.Trim(r.Path, "/"), Report: report}
+	}
+	GetBus().Pub(reply, TopicResync_+s.uuid)
+}
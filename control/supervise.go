@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thejerf/suture"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+// RestartPolicy tells how a supervised process is restarted when it exits.
+type RestartPolicy struct {
+	// MaxRetries is the number of consecutive crashes before giving up (0 for no limit)
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the delay before a restart, doubled after each consecutive crash
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StableAfter is the running time after which the crash counter is reset
+	StableAfter time.Duration
+	// Probe is an optional liveness check called every ProbeInterval, the process is killed after three failures
+	Probe         func() error
+	ProbeInterval time.Duration
+}
+
+// DefaultRestartPolicy returns the policy used for the sub-processes of the application.
+func DefaultRestartPolicy() *RestartPolicy {
+	return &RestartPolicy{
+		MaxRetries:  10,
+		MinBackoff:  time.Second,
+		MaxBackoff:  2 * time.Minute,
+		StableAfter: 5 * time.Minute,
+	}
+}
+
+// supervised holds the processes registered with Supervise, until the supervisor is started.
+var supervised = struct {
+	sync.Mutex
+	supervisor *Supervisor
+	tokens     map[string]suture.ServiceToken
+	pending    []*SpawnedService
+}{tokens: make(map[string]suture.ServiceToken)}
+
+// Supervise runs an auxiliary process with the same restart, backoff and log capture as the sub-processes of the
+// application. Command is the executable followed by its arguments, and policy may be nil for the default one.
+// Its output is logged under name, and its status is published like the status of the other sub-processes.
+func Supervise(name string, command []string, policy *RestartPolicy) (*SpawnedService, error) {
+	if name == "" || len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("please provide a name and a command")
+	}
+	spawnedLock.Lock()
+	_, exists := spawnedRegistry[name]
+	spawnedLock.Unlock()
+	if exists {
+		return nil, fmt.Errorf("a process named %s is already supervised", name)
+	}
+	if policy == nil {
+		policy = DefaultRestartPolicy()
+	}
+	s := NewSpawnedService(name, command[1:])
+	s.executable = command[0]
+	s.MaxRetries = policy.MaxRetries
+	if policy.MinBackoff > 0 {
+		s.MinBackoff = policy.MinBackoff
+	}
+	if policy.MaxBackoff > 0 {
+		s.MaxBackoff = policy.MaxBackoff
+	}
+	if policy.StableAfter > 0 {
+		s.StableAfter = policy.StableAfter
+	}
+	if policy.Probe != nil && policy.ProbeInterval > 0 {
+		s.SetProbe(policy.ProbeInterval, policy.Probe)
+	}
+	supervised.Lock()
+	defer supervised.Unlock()
+	if supervised.supervisor != nil {
+		supervised.tokens[name] = supervised.supervisor.Add(s)
+	} else {
+		supervised.pending = append(supervised.pending, s)
+	}
+	return s, nil
+}
+
+// Unsupervise stops a process started with Supervise and forgets it.
+func Unsupervise(name string) error {
+	supervised.Lock()
+	defer supervised.Unlock()
+	spawnedLock.Lock()
+	s, ok := spawnedRegistry[name]
+	delete(spawnedRegistry, name)
+	spawnedLock.Unlock()
+	if !ok {
+		return fmt.Errorf("no process named %s", name)
+	}
+	if token, ok := supervised.tokens[name]; ok {
+		delete(supervised.tokens, name)
+		return supervised.supervisor.Remove(token)
+	}
+	for i, p := range supervised.pending {
+		if p == s {
+			supervised.pending = append(supervised.pending[:i], supervised.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// attachSupervised starts the helpers of the configuration and the processes registered before the supervisor.
+func (s *Supervisor) attachSupervised(helpers []*config.Helper) {
+	for _, h := range helpers {
+		policy := DefaultRestartPolicy()
+		if h.MaxRetries > 0 {
+			policy.MaxRetries = h.MaxRetries
+		} else if h.MaxRetries < 0 {
+			policy.MaxRetries = 0
+		}
+		if _, e := Supervise(h.Name, h.Command, policy); e != nil {
+			log.Logger(s.ctx).Error("Cannot start helper " + h.Name + ": " + e.Error())
+		}
+	}
+	supervised.Lock()
+	defer supervised.Unlock()
+	supervised.supervisor = s
+	for _, p := range supervised.pending {
+		supervised.tokens[p.name] = s.Add(p)
+	}
+	supervised.pending = nil
+}
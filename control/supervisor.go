@@ -27,6 +27,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kardianos/service"
@@ -34,6 +35,7 @@ import (
 	"github.com/thejerf/suture"
 
 	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
 	"github.com/pydio/cells/common/log"
 	servicecontext "github.com/pydio/cells/common/service/context"
 )
@@ -46,7 +48,12 @@ type Supervisor struct {
 	ctx            context.Context
 	tasksTokens    map[string]suture.ServiceToken
 	schedulerToken suture.ServiceToken
+	mqttToken      suture.ServiceToken
 	noUi           bool
+	autoStarted    bool
+	startPaused    bool
+	quitting       int32
+	lifecycle      lifecycle
 }
 
 // NewSupervisor creates a new Supervisor
@@ -63,43 +70,105 @@ func NewSupervisor(noUi bool) *Supervisor {
 			},
 		}),
 	}
+	s.startLifecycle()
 	return s
 }
 
+// SetAutoStarted flags the process as started with the user session, to honour the StartMinimized option.
+func (s *Supervisor) SetAutoStarted(autoStarted bool) {
+	s.autoStarted = autoStarted
+}
+
+// SetStartPaused keeps the tasks paused at startup, until they are resumed by the user.
+func (s *Supervisor) SetStartPaused(paused bool) {
+	s.startPaused = paused
+}
+
 // Serve starts all services and start listening to config and bus
 // The call is blocking until all services are stopped
 func (s *Supervisor) Serve() error {
+	config.InstallSharedTransport()
+	endpoint.InstallAPIRateLimiter()
 	httpServer := NewHttpServer()
 	conf := config.Default()
 	if len(conf.Tasks) > 0 {
 		for _, t := range conf.Tasks {
-			syncer := NewSyncer(t)
-			s.tasksTokens[t.Uuid] = s.Add(syncer)
+			svc := newTaskService(t)
+			if syncer, ok := svc.(*Syncer); ok && s.startPaused {
+				syncer.holdStart = true
+			}
+			s.tasksTokens[t.Uuid] = s.Add(svc)
+		}
+		if s.startPaused {
+			log.Logger(s.ctx).Info("Started in paused mode, tasks will not sync until they are resumed")
 		}
 	}
 
+	if endpoint.StorageCompact() {
+		log.Logger(s.ctx).Info("Using compact storage mode for local databases")
+	}
 	s.schedulerToken = s.Add(NewScheduler(conf.Tasks))
 	s.Add(&Profiler{})
 	if !config.RunningAsService() && service.Interactive() && runtime.GOOS != "windows" && os.Getenv("CELLS_SYNC_IN_PATH") == "" {
 		s.Add(&StdInner{})
 	}
-	if !s.noUi {
+	if conf.Service.Background {
+		log.Logger(s.ctx).Info("Running in background mode, no UI process will be started")
+	} else if !s.noUi {
 		addr, _ := config.GetHttpAddress()
-		s.Add(NewSpawnedService("systray", []string{"systray", "--url", fmt.Sprintf("%s://%s", config.GetHttpProtocol(), addr)}))
+		args := []string{"systray", "--url", fmt.Sprintf("%s://%s", config.GetHttpProtocol(), addr)}
+		if s.autoStarted && !conf.Service.StartMinimized {
+			args = append(args, "--open")
+		}
+		s.Add(NewSpawnedService("systray", args))
 	}
 	s.Add(httpServer)
 	s.Add(NewUpdater())
+	s.Add(NewReporter())
+	s.Add(NewDeviceMonitor())
+	s.Add(NewNetworkMonitor())
+	s.Add(NewResourceMonitor())
+	s.Add(NewDiskMonitor())
+	s.mqttToken = s.Add(NewMqttPublisher(conf.Mqtt))
+	s.Add(NewFleetReporter(conf.Fleet))
+	s.Add(NewRemoteLogger())
+	s.Add(NewManagedService(conf.Managed))
+	s.attachSupervised(conf.Helpers)
+	if runtime.GOOS == "linux" {
+		s.Add(NewDBusService())
+	}
 
 	go s.listenBus()
 	go s.listenConfig()
 	// Blocks here
 	s.Supervisor.Serve()
+	endpoint.StopPlugins()
 	return nil
 }
 
+// newTaskService creates the service running a task: an Importer for import tasks, an Archiver for archive tasks,
+// a Syncer otherwise.
+func newTaskService(t *config.Task) suture.Service {
+	if t.Import != nil {
+		return NewImporter(t)
+	}
+	if t.Archive != nil {
+		return NewArchiver(t)
+	}
+	return NewSyncer(t)
+}
+
 func (s *Supervisor) listenConfig() {
 	c := config.Watch()
 	for event := range c {
+		if globalChange, ok := event.(*config.GlobalChange); ok && globalChange.Section == "mqtt" {
+			log.Logger(s.ctx).Info("Restarting MQTT publisher")
+			s.Remove(s.mqttToken)
+			s.mqttToken = s.Add(NewMqttPublisher(config.Default().Mqtt))
+		}
+		if authChange, ok := event.(*config.AuthChange); ok && authChange.Type == "url" {
+			s.restartAuthorityTasks(authChange.Authority)
+		}
 		if taskChange, ok := event.(*config.TaskChange); ok {
 			// Restart Scheduler
 			s.Remove(s.schedulerToken)
@@ -109,7 +178,7 @@ func (s *Supervisor) listenConfig() {
 			// Start/stop sync tasks
 			if taskChange.Type == "create" {
 				log.Logger(s.ctx).Info("Starting New Task " + taskChange.Task.Uuid)
-				t := s.Add(NewSyncer(taskChange.Task))
+				t := s.Add(newTaskService(taskChange.Task))
 				s.Lock()
 				s.tasksTokens[taskChange.Task.Uuid] = t
 				s.Unlock()
@@ -125,7 +194,7 @@ func (s *Supervisor) listenConfig() {
 					<-time.After(5 * time.Second)
 				}
 				log.Logger(s.ctx).Info("Starting Task " + taskChange.Task.Uuid)
-				t := s.Add(NewSyncer(taskChange.Task))
+				t := s.Add(newTaskService(taskChange.Task))
 				s.Lock()
 				s.tasksTokens[taskChange.Task.Uuid] = t
 				s.Unlock()
@@ -147,10 +216,37 @@ func (s *Supervisor) listenConfig() {
 	}
 }
 
+// restartAuthorityTasks restarts the tasks using an authority, keeping their snapshots, so that their remote
+// endpoint reaches the server through its new URL.
+func (s *Supervisor) restartAuthorityTasks(a *config.Authority) {
+	for _, t := range config.Default().TasksForAuthority(a) {
+		s.Lock()
+		token, ok := s.tasksTokens[t.Uuid]
+		s.Unlock()
+		if !ok {
+			continue
+		}
+		log.Logger(s.ctx).Info("Restarting Task " + t.Uuid + " to use " + a.BaseURL())
+		GetBus().Pub(MessageRestart, TopicSync_+t.Uuid)
+		s.Remove(token)
+		<-time.After(5 * time.Second)
+		token = s.Add(newTaskService(t))
+		s.Lock()
+		s.tasksTokens[t.Uuid] = token
+		s.Unlock()
+	}
+}
+
 func (s *Supervisor) listenBus() {
 	c := GetBus().Sub(TopicGlobal)
 	for m := range c {
-		if m == MessageHalt {
+		if sw, ok := m.(*StandbySwitch); ok {
+			go s.switchStandby(sw)
+		} else if m == MessageSafeQuit {
+			if atomic.CompareAndSwapInt32(&s.quitting, 0, 1) {
+				go s.safeQuit()
+			}
+		} else if m == MessageHalt {
 			if config.RunningAsService() {
 				config.ControlAppService(config.ServiceCmdStop)
 			} else {
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/i18n"
+)
+
+// NotificationSyncLink asks the user to log in to the server of a link before creating the task.
+const NotificationSyncLink = "sync-link"
+
+// SyncLink is a cellssync:// link, sent by the "Sync to my computer" action of the Cells web interface. It points
+// to a folder of a server, and optionally to the account to use.
+type SyncLink struct {
+	Server string
+	User   string
+	Path   string
+}
+
+// SyncLinkRequest is posted to the agent by the open-url command.
+type SyncLinkRequest struct {
+	Link string
+}
+
+// SyncLinkResponse gives the UI route to open for a link.
+type SyncLinkResponse struct {
+	Route string
+}
+
+// ParseSyncLink parses and validates a link of the form cellssync://sync?server=https://host&path=/workspace/folder.
+func ParseSyncLink(link string) (*SyncLink, error) {
+	u, e := url.Parse(link)
+	if e != nil {
+		return nil, e
+	}
+	if u.Scheme != config.URLScheme || u.Host != "sync" {
+		return nil, fmt.Errorf("unsupported link %s", link)
+	}
+	q := u.Query()
+	server, e := url.Parse(q.Get("server"))
+	if e != nil || (server.Scheme != "http" && server.Scheme != "https") || server.Host == "" {
+		return nil, fmt.Errorf("link must point to an http or https server")
+	}
+	p := "/" + strings.Trim(q.Get("path"), "/")
+	if p == "/" || strings.Contains(p, "/../") || strings.HasSuffix(p, "/..") {
+		return nil, fmt.Errorf("link must point to a workspace or a folder")
+	}
+	return &SyncLink{Server: server.Scheme + "://" + server.Host, User: q.Get("user"), Path: p}, nil
+}
+
+// remoteURI finds a known account on the server of the link, and returns the remote URI of the task to create.
+func (l *SyncLink) remoteURI() (string, bool) {
+	for _, a := range config.Default().Authorities {
+		u, e := url.Parse(a.URI)
+		if e != nil || u.Scheme+"://"+u.Host != l.Server {
+			continue
+		}
+		if l.User != "" && a.Username != l.User {
+			continue
+		}
+		id, e := url.Parse(a.Id)
+		if e != nil {
+			continue
+		}
+		id.Path = l.Path
+		return id.String(), true
+	}
+	return "", false
+}
+
+// openSyncLink returns the route of the task editor pre-filled with the server and folder of a link, so that the
+// user only has to choose the local folder. If no account is known on this server, the user is asked to log in.
+func (h *HttpServer) openSyncLink(c *gin.Context) {
+	var request SyncLinkRequest
+	if e := c.BindJSON(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	link, e := ParseSyncLink(request.Link)
+	if e != nil {
+		h.writeError(c, e)
+		return
+	}
+	uri, ok := link.remoteURI()
+	if !ok {
+		PublishNotification(&common.Notification{
+			Type:    NotificationSyncLink,
+			Title:   i18n.T("application.title"),
+			Message: fmt.Sprintf(i18n.T("notification.sync-link.login"), link.Server),
+		})
+		c.JSON(http.StatusOK, &SyncLinkResponse{Route: "/servers"})
+		return
+	}
+	c.JSON(http.StatusOK, &SyncLinkResponse{Route: "/create?id=" + url.QueryEscape(uri)})
+}
@@ -54,19 +54,34 @@ type StateStore interface {
 
 	UpdateSyncStatus(s model.TaskStatus) common.SyncState
 	UpdateProcessStatus(processStatus model.Status, status ...model.TaskStatus) common.SyncState
+	UpdateThroughput(up, down int64) common.SyncState
+	UpdatePolicyViolations(violations []string) common.SyncState
+	AddPolicyViolation(violation string) common.SyncState
+	UpdateAccessDenied(paths []string) common.SyncState
+	AddQuarantined(paths []string) common.SyncState
+	UpdateConflictCopies(copies []*common.ConflictCopy) common.SyncState
+	UpdateErrors(errs []*common.ErrorInfo) common.SyncState
+	UpdateThrottling(until time.Time) (common.SyncState, bool)
+	UpdateMaintenance(until time.Time) (common.SyncState, bool)
+	UpdateDegraded(until time.Time) (common.SyncState, bool)
+	UpdateCapabilities(c *common.Capabilities, i model.EndpointInfo) common.SyncState
+	UpdateActiveFiles(files []*common.FileProgress) (common.SyncState, bool)
+	UpdateSchedule(last, next time.Time) common.SyncState
 }
 
 // MemoryStateStore keeps all SyncStates in memory.
 type MemoryStateStore struct {
 	sync.Mutex
-	config *config.Task
-	state  common.SyncState
+	config     *config.Task
+	state      common.SyncState
+	throughput *ThroughputMeter
 }
 
 // NewMemoryStateStore creates a MemoryStateStore.
 func NewMemoryStateStore(config *config.Task) *MemoryStateStore {
 	s := &MemoryStateStore{
-		config: config,
+		config:     config,
+		throughput: NewThroughputMeter(),
 		state: common.SyncState{
 			UUID:      config.Uuid,
 			Config:    config,
@@ -81,11 +96,20 @@ func NewMemoryStateStore(config *config.Task) *MemoryStateStore {
 // Close closes the state store
 func (b *MemoryStateStore) Close() {}
 
+// output returns the state handed to the rest of the application. Names are encrypted for tasks in privacy mode,
+// the store itself keeps them in clear.
+func (b *MemoryStateStore) output() common.SyncState {
+	if b.config.Privacy {
+		return maskState(b.state)
+	}
+	return b.state
+}
+
 // LastState returns the last known state of the task.
 func (b *MemoryStateStore) LastState() common.SyncState {
 	b.Lock()
 	defer b.Unlock()
-	return b.state
+	return b.output()
 }
 
 // TouchLastOps updates the time of last known operation.
@@ -104,7 +128,7 @@ func (b *MemoryStateStore) UpdateSyncStatus(s model.TaskStatus) common.SyncState
 	b.Lock()
 	defer b.Unlock()
 	b.state.Status = s
-	return b.state
+	return b.output()
 }
 
 // UpdateProcessStatus updates the status of one endpoint. It is recognized based on its EndpointURI.
@@ -122,8 +146,134 @@ func (b *MemoryStateStore) UpdateProcessStatus(processStatus model.Status, statu
 	if len(status) > 0 {
 		b.state.Status = status[0]
 	}
-	GetBus().Pub(b.state, TopicState)
-	return b.state
+	GetBus().Pub(b.output(), TopicState)
+	return b.output()
+}
+
+// UpdateThroughput records transferred bytes and refreshes the live transfer rates.
+func (b *MemoryStateStore) UpdateThroughput(up, down int64) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	if up > 0 || down > 0 {
+		b.throughput.Record(up, down)
+	}
+	b.state.Throughput = b.throughput.Info()
+	return b.output()
+}
+
+// UpdatePolicyViolations replaces the list of server policy violations.
+func (b *MemoryStateStore) UpdatePolicyViolations(violations []string) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.PolicyViolations = violations
+	return b.output()
+}
+
+// AddPolicyViolation appends a violation detected while syncing, keeping at most maxPolicyViolations.
+func (b *MemoryStateStore) AddPolicyViolation(violation string) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.PolicyViolations = append(b.state.PolicyViolations, violation)
+	if l := len(b.state.PolicyViolations); l > maxPolicyViolations {
+		b.state.PolicyViolations = b.state.PolicyViolations[l-maxPolicyViolations:]
+	}
+	return b.output()
+}
+
+// AddQuarantined appends files moved to quarantine by the content scanner.
+func (b *MemoryStateStore) AddQuarantined(paths []string) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.Quarantined = append(b.state.Quarantined, paths...)
+	return b.output()
+}
+
+// UpdateConflictCopies replaces the list of conflict copies waiting for the user to keep one version.
+func (b *MemoryStateStore) UpdateConflictCopies(copies []*common.ConflictCopy) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.ConflictCopies = copies
+	return b.output()
+}
+
+// UpdateErrors replaces the errors of the last sync pass.
+func (b *MemoryStateStore) UpdateErrors(errs []*common.ErrorInfo) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.Errors = errs
+	return b.output()
+}
+
+// UpdateAccessDenied replaces the list of remote folders that are currently not accessible.
+func (b *MemoryStateStore) UpdateAccessDenied(paths []string) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.AccessDenied = paths
+	return b.output()
+}
+
+// UpdateActiveFiles replaces the list of files being processed. It returns true if the list was or is not empty.
+func (b *MemoryStateStore) UpdateActiveFiles(files []*common.FileProgress) (common.SyncState, bool) {
+	b.Lock()
+	defer b.Unlock()
+	changed := len(files) > 0 || len(b.state.ActiveFiles) > 0
+	b.state.ActiveFiles = files
+	return b.output(), changed
+}
+
+// UpdateThrottling records until when the server is throttling requests. It returns true if the state changed.
+func (b *MemoryStateStore) UpdateThrottling(until time.Time) (common.SyncState, bool) {
+	b.Lock()
+	defer b.Unlock()
+	if until.IsZero() {
+		changed := b.state.ThrottledUntil != nil
+		b.state.ThrottledUntil = nil
+		return b.output(), changed
+	}
+	changed := b.state.ThrottledUntil == nil || !b.state.ThrottledUntil.Equal(until)
+	b.state.ThrottledUntil = &until
+	return b.output(), changed
+}
+
+// UpdateMaintenance records until when the server announced a maintenance. It returns true if the state changed.
+func (b *MemoryStateStore) UpdateMaintenance(until time.Time) (common.SyncState, bool) {
+	b.Lock()
+	defer b.Unlock()
+	if until.IsZero() {
+		changed := b.state.MaintenanceUntil != nil
+		b.state.MaintenanceUntil = nil
+		return b.output(), changed
+	}
+	changed := b.state.MaintenanceUntil == nil || !b.state.MaintenanceUntil.Equal(until)
+	b.state.MaintenanceUntil = &until
+	return b.output(), changed
+}
+
+// UpdateDegraded records until when the sync of a flapping endpoint is delayed. It returns true if the state changed.
+func (b *MemoryStateStore) UpdateDegraded(until time.Time) (common.SyncState, bool) {
+	b.Lock()
+	defer b.Unlock()
+	if until.IsZero() {
+		changed := b.state.DegradedUntil != nil
+		b.state.DegradedUntil = nil
+		return b.output(), changed
+	}
+	b.state.DegradedUntil = &until
+	return b.output(), true
+}
+
+// UpdateSchedule records the last and next runs of the task schedule. Zero times are not reported.
+func (b *MemoryStateStore) UpdateSchedule(last, next time.Time) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	b.state.LastScheduledRun, b.state.NextScheduledRun = nil, nil
+	if !last.IsZero() {
+		b.state.LastScheduledRun = &last
+	}
+	if !next.IsZero() {
+		b.state.NextScheduledRun = &next
+	}
+	return b.output()
 }
 
 // UpdateConnection updates the connection status of one endpoint.
@@ -136,7 +286,7 @@ func (b *MemoryStateStore) UpdateConnection(c bool, i model.EndpointInfo) common
 			internalInfo.LastConnection = time.Now()
 		}
 	}
-	return b.state
+	return b.output()
 }
 
 // UpdateWatcherActivity updates the watcher status of one endpoint.
@@ -146,7 +296,7 @@ func (b *MemoryStateStore) UpdateWatcherActivity(a bool, i model.EndpointInfo) c
 	if internalInfo, ok := b.internalInfoFromEndpointInfo(i); ok {
 		internalInfo.WatcherActive = a
 	}
-	return b.state
+	return b.output()
 }
 
 // UpdateEndpointStats updates the statistics about the root of one endpoint.
@@ -156,7 +306,17 @@ func (b *MemoryStateStore) UpdateEndpointStats(s *model.EndpointRootStat, i mode
 	if internalInfo, ok := b.internalInfoFromEndpointInfo(i); ok {
 		internalInfo.Stats = s
 	}
-	return b.state
+	return b.output()
+}
+
+// UpdateCapabilities updates the probed capabilities of one endpoint.
+func (b *MemoryStateStore) UpdateCapabilities(c *common.Capabilities, i model.EndpointInfo) common.SyncState {
+	b.Lock()
+	defer b.Unlock()
+	if internalInfo, ok := b.internalInfoFromEndpointInfo(i); ok {
+		internalInfo.Capabilities = c
+	}
+	return b.output()
 }
 
 func (b *MemoryStateStore) internalInfoFromEndpointInfo(info model.EndpointInfo) (*common.EndpointInfo, bool) {
@@ -24,12 +24,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/pydio/cells-sync/common"
 	"github.com/pydio/cells-sync/config"
 	"github.com/pydio/cells-sync/endpoint"
+	cellsync "github.com/pydio/cells-sync/sync"
 	"github.com/pydio/cells/common/log"
 	"github.com/pydio/cells/common/service/context"
 	"github.com/pydio/cells/common/sync/merger"
@@ -42,24 +47,111 @@ type Syncer struct {
 	task    *task.Sync
 	stop    chan bool
 	uuid    string
+	label   string
+	conf    *config.Task
 	watches bool
 
-	eventsChan  chan interface{}
-	patchStatus chan model.Status
-	patchDone   chan interface{}
-	cmd         *model.Command
+	eventsChan     chan interface{}
+	patchStatus    chan model.Status
+	patchDone      chan interface{}
+	throughputDone chan bool
+	cmd            *model.Command
+	// Bytes transferred but not yet added to the network usage and stats
+	transfersLock sync.Mutex
+	pendingUp     int64
+	pendingDown   int64
 
 	serviceCtx   context.Context
 	configPath   string
 	stateStore   StateStore
 	patchStore   *endpoint.PatchStore
+	statsStore   *endpoint.StatsStore
+	nodeMeta     *endpoint.NodeMetaStore
+	journals     []*endpoint.WriteJournal
+	batches      []*endpoint.BatchJournal
+	appendOnly   *endpoint.AppendOnlyIndex
+	stash        *endpoint.Stash
+	transforms   *endpoint.Transforms
+	trashes      []*endpoint.Trash
+	audit        *endpoint.AuditLog
+	progress     *endpoint.ProgressTracker
 	snapFactory  model.SnapshotFactory
+	ignores      []string
+	ignoreRules  []*endpoint.IgnoreRules
+	hashCaches   []*endpoint.HashCache
+	history      *endpoint.History
+	uploads      *endpoint.UploadSessions
+	opKeys       *endpoint.OperationKeys
+	digest       *transferDigest
+	tracked      []model.Endpoint
+	transfers    *endpoint.TransferLimiter
+	denied       *accessDenied
+	owner        *endpoint.Owner
+	knownErrors  *errorRegistry
 	taskPaused   bool
 	lastPatch    merger.Patch
 	dirtyStopped bool
 
+	// Set while a scheduled full resync is running
+	scheduledScan int32
+	// Set while a sync loop is scheduled to retry files that changed during an upload
+	changedRetry int32
+	// Set while a sync loop is scheduled to retry files locked on the server
+	lockRetry int32
+	// Set while the checksum manifest is written
+	manifestRunning int32
+	// Set while both sides are compared in audit mode
+	driftRunning int32
+	// Set while local files are spot-checked for corruption
+	integrityRunning int32
+	// Set while the task is paused by a blackout schedule
+	blackout bool
+	// Set while the task is paused because its server announced a maintenance
+	maintenance      bool
+	maintenanceUntil time.Time
+	// Last time the remote workspaces were found available, they are checked again after policyRefreshInterval
+	workspacesChecked time.Time
+	// Set while the task is paused until a given time, it is resumed automatically after
+	pauseLock   sync.Mutex
+	pausedUntil time.Time
+	// Buffers local events while the user reorganizes the local folder
+	hold      *endpoint.WatchHold
+	holdTimer *time.Timer
+	// Policy of the server for the workspace of the task, its upload limits are enforced by uploadGuard
+	policyLock  sync.Mutex
+	policy      *SyncPolicy
+	uploadGuard *endpoint.UploadGuard
+	// Detects files bouncing between both sides
+	loops *loopDetector
+	// Pass received from the previous task of a chain
+	chain chainState
+	// Debounces the sync loops triggered by reconnections
+	reconnect *reconnectGuard
+	// Set while the task runs on its standby server, primary is the remote URI of the primary server
+	standby bool
+	primary string
+	// The task waits for a slot in the global scan queue before starting
+	startLock   sync.Mutex
+	started     bool
+	holdStart   bool
+	manualStart bool
+	startCancel chan struct{}
+	scanRelease func()
+	// Deletions are not propagated while snapshots are rebuilt after a corruption
+	safeLock      sync.Mutex
+	safeMode      *endpoint.SafeMode
+	safeEndpoints []model.Endpoint
+
 	cleanSnapsAfterStop bool
 	cleanAllAfterStop   bool
+	// Snapshots could not be upgraded: the task stays paused until the previous release is restored
+	migrationFailed bool
+	// Conflict resolutions running in background, only counted by the bus loop
+	resolveLock    sync.Mutex
+	resolutions    int
+	resolutionLoop bool
+	// Folders of rolled back batches, whose snapshot entries must be dropped
+	invalidFolders []string
 }
 
 // NewSyncer creates a new running sync task.
@@ -67,20 +159,42 @@ func NewSyncer(conf *config.Task) (syncer *Syncer) {
 
 	var startError error
 
-	ctx := servicecontext.WithServiceName(context.Background(), "sync-task")
+	ctx := servicecontext.WithServiceName(context.Background(), taskServiceName(conf))
 	ctx = servicecontext.WithServiceColor(ctx, servicecontext.ServiceColorGrpc)
+	primary := *remoteURI(conf)
+	conf, standby := standbyTask(conf)
 	configPath := filepath.Join(config.SyncClientDataDir(), conf.Uuid)
+	if standby {
+		// Snapshots of the standby server are kept apart
+		configPath = filepath.Join(configPath, "standby")
+	}
+	template := conf
+	conf, configPath, templateError := templatedTask(conf, configPath)
 	stateStore := NewFileStateStore(conf, configPath)
 	if stateStore.FileError != nil {
 		log.Logger(ctx).Warn("Cannot open file for monitoring state : " + stateStore.FileError.Error())
 	}
 
 	syncer = &Syncer{
-		uuid:       conf.Uuid,
-		serviceCtx: ctx,
-		stop:       make(chan bool, 1),
-		stateStore: stateStore,
-		configPath: configPath,
+		uuid:        conf.Uuid,
+		label:       conf.Label,
+		conf:        conf,
+		serviceCtx:  ctx,
+		stop:        make(chan bool, 1),
+		startCancel: make(chan struct{}),
+		stateStore:  stateStore,
+		configPath:  configPath,
+		knownErrors: newErrorRegistry(configPath),
+		standby:     standby,
+		primary:     primary,
+		reconnect:   newReconnectGuard(conf.ReconnectDelay),
+	}
+	if standby {
+		log.Logger(ctx).Warn("Primary server is unreachable, syncing with standby server " + conf.Standby.URI)
+	} else if _, ok := standbyReturned.Load(conf.Uuid); ok {
+		standbyReturned.Delete(conf.Uuid)
+		log.Logger(ctx).Info("Back from standby server, will relaunch a full resync")
+		syncer.dirtyStopped = true
 	}
 	if stateStore.PreviousState == model.TaskStatusProcessing {
 		log.Logger(ctx).Warn("Last Status on this task was 'processing', this is not normal, will relaunch a full resync")
@@ -89,6 +203,7 @@ func NewSyncer(conf *config.Task) (syncer *Syncer) {
 
 	defer func() {
 		if startError != nil {
+			stateStore.UpdateErrors([]*common.ErrorInfo{errorInfo(startError, "")})
 			stateStore.UpdateProcessStatus(model.NewProcessingStatus(startError.Error()).SetError(startError), model.TaskStatusError)
 		}
 	}()
@@ -97,32 +212,60 @@ func NewSyncer(conf *config.Task) (syncer *Syncer) {
 		startError = fmt.Errorf("invalid arguments: please provide left and right endpoints using a valid URI")
 		return
 	}
-	leftEndpoint, err := endpoint.EndpointFromURI(conf.LeftURI, conf.RightURI)
-	if err != nil {
-		startError = errors.Wrap(err, "cannot start left endpoint")
+	if templateError != nil {
+		startError = errors.Wrap(templateError, "cannot resolve remote root")
+		return
+	}
+	if e := config.Default().CheckFilterSets(conf); e != nil {
+		startError = e
 		return
 	}
-	rightEndpoint, err := endpoint.EndpointFromURI(conf.RightURI, conf.LeftURI)
+	if changed, unavailable := resolveWorkspaces(ctx, conf); unavailable {
+		msg := "Workspace is not available anymore on the server, task is paused"
+		log.Logger(ctx).Warn(msg)
+		stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused)
+		return
+	} else if changed {
+		if e := updateStoredTask(conf.Uuid, func(t *config.Task) bool {
+			c, _ := resolveWorkspaces(ctx, t)
+			return c
+		}); e != nil {
+			log.Logger(ctx).Error("Cannot save updated task URIs: " + e.Error())
+		}
+	}
+	if e := createTemplatedRoot(ctx, template, conf); e != nil {
+		startError = errors.Wrap(e, "cannot create remote root")
+		return
+	}
+	leftEndpoint, rightEndpoint, err := cellsync.OpenEndpoints(conf.LeftURI, conf.RightURI)
 	if err != nil {
-		startError = errors.Wrap(err, "cannot start right endpoint")
+		startError = err
 		return
 	}
 
-	var direction model.DirectionType
-	switch conf.Direction {
-	case "Bi":
-		direction = model.DirectionBi
-	case "Left":
-		direction = model.DirectionLeft
-	case "Right":
-		direction = model.DirectionRight
-	default:
-		startError = errors.Wrap(err, "unsupported direction type, please use one of Bi, Left, Right")
+	if changed, e := readOnlyDirection(conf); e != nil {
+		startError = e
 		return
+	} else if changed {
+		log.Logger(ctx).Info("Task has a read-only side, switching to one-way sync (" + conf.Direction + ")")
+		notifyReadOnly(conf)
+		direction := conf.Direction
+		if e := updateStoredTask(conf.Uuid, func(t *config.Task) bool {
+			if t.Direction == direction {
+				return false
+			}
+			t.Direction = direction
+			return true
+		}); e != nil {
+			log.Logger(ctx).Error("Cannot save updated task direction: " + e.Error())
+		}
 	}
 
-	syncTask := task.NewSync(leftEndpoint, rightEndpoint, direction)
-	syncTask.SetFilters(conf.SelectiveRoots, []string{"**/.git**", "**/.pydio"})
+	direction, err := cellsync.ParseDirection(conf.Direction)
+	if err != nil {
+		startError = err
+		return
+	}
 
 	if _, er := os.Stat(configPath); er != nil && os.IsNotExist(er) {
 		if er := os.MkdirAll(configPath, 0755); er != nil {
@@ -131,19 +274,283 @@ func NewSyncer(conf *config.Task) (syncer *Syncer) {
 		}
 	}
 
+	startActivityMonitor()
+	limit := func() int64 {
+		var rescanLimit int64
+		if atomic.LoadInt32(&syncer.scheduledScan) == 1 {
+			rescanLimit = rescanRateLimit(conf.Rescan, time.Now())
+		}
+		return minRateLimit(rescanLimit, activityRateLimit(), networkRateLimit())
+	}
+	endpoint.SetRateLimit(leftEndpoint, limit)
+	endpoint.SetRateLimit(rightEndpoint, limit)
+	syncer.setupTransferLimits(leftEndpoint, rightEndpoint)
+	if conf.ConsistentReads && direction != model.DirectionBi {
+		endpoint.SetConsistentReads(leftEndpoint)
+		endpoint.SetConsistentReads(rightEndpoint)
+	}
+	if conf.Permissions != nil {
+		for _, ep := range []model.Endpoint{leftEndpoint, rightEndpoint} {
+			if _, e := endpoint.SetPermissions(ep, conf.Permissions); e != nil {
+				startError = errors.Wrap(e, "invalid permissions")
+				return
+			}
+		}
+	}
+	if e := syncer.setupIgnoreRules(leftEndpoint, rightEndpoint); e != nil {
+		startError = errors.Wrap(e, "invalid ignore rules")
+		return
+	}
+
+	ignores := append([]string{}, endpoint.DefaultIgnores...)
+	if conf.HiddenFiles == endpoint.HiddenFilesIgnore {
+		ignores = append(ignores, endpoint.HiddenFilesIgnores()...)
+	}
+	agentIgnores, e := agentDirsIgnores(conf)
+	if e != nil {
+		startError = e
+		return
+	}
+	if len(agentIgnores) > 0 {
+		log.Logger(ctx).Warn("Application folders are located inside the task root, excluding them: " + strings.Join(agentIgnores, ", "))
+		ignores = append(ignores, agentIgnores...)
+	}
+	if conf.Encoding != nil && conf.Encoding.Apply {
+		syncer.applyTranscoding(ctx, endpoint.FilterMatcher(taskRoots(conf.SelectiveRoots, conf.File), ignores))
+	}
+	go syncer.applyExcludedPolicy(ctx, leftEndpoint, rightEndpoint)
+	leftEndpoint = endpoint.WithHiddenFilesPolicy(leftEndpoint, conf.HiddenFiles)
+	rightEndpoint = endpoint.WithHiddenFilesPolicy(rightEndpoint, conf.HiddenFiles)
+
+	if conf.Scanner != nil {
+		scanner, e := endpoint.NewScanner(conf.Scanner)
+		if e != nil {
+			startError = errors.Wrap(e, "cannot setup content scanner")
+			return
+		}
+		quarantine := conf.Scanner.Quarantine
+		if quarantine == "" {
+			quarantine = filepath.Join(configPath, "quarantine")
+		}
+		endpoint.SetScanner(leftEndpoint, scanner, quarantine)
+		endpoint.SetScanner(rightEndpoint, scanner, quarantine)
+	}
+
+	if conf.File != "" {
+		syncer.setupSingleFile(leftEndpoint, rightEndpoint)
+	}
+	for _, ep := range []model.Endpoint{leftEndpoint, rightEndpoint} {
+		endpoint.SetSafeReplace(ep, safeReplacePatterns(conf.File))
+	}
+	if conf.CloudCompat != nil {
+		syncer.setupCloudCompat(leftEndpoint, rightEndpoint)
+	}
+
+	if endpoint.Elevated() {
+		if e := syncer.dropPrivileges(ctx, leftEndpoint, rightEndpoint); e != nil {
+			startError = e
+			return
+		}
+	}
+
+	// Start with the last known server policy, it is refreshed in the background by watchPolicy
+	var violations []string
+	policy := loadCachedPolicy(configPath)
+	syncer.policy = policy
+	if policy != nil {
+		var msg string
+		if direction, msg = policy.EnforceDirection(conf, direction); msg != "" {
+			violations = append(violations, msg)
+		}
+		ignores = append(ignores, policy.Ignores()...)
+	}
+	stateStore.UpdatePolicyViolations(violations)
+	if e := syncer.setupUploadRules(leftEndpoint, rightEndpoint); e != nil {
+		startError = errors.Wrap(e, "invalid upload rules")
+		return
+	}
+	if len(conf.Transforms) > 0 {
+		transforms, e := endpoint.NewTransforms(conf.Transforms, configPath)
+		if e != nil {
+			startError = errors.Wrap(e, "invalid transforms")
+			return
+		}
+		syncer.transforms = transforms
+		endpoint.SetTransforms(leftEndpoint, transforms)
+		endpoint.SetTransforms(rightEndpoint, transforms)
+	}
+
+	go syncer.loadCapabilities(ctx, map[string]model.Endpoint{conf.LeftURI: leftEndpoint, conf.RightURI: rightEndpoint})
+
+	syncTask := task.NewSync(leftEndpoint, rightEndpoint, direction)
 	syncer.task = syncTask
-	syncer.watches = conf.Realtime
+	syncer.ignores = ignores
+	syncer.denied = newAccessDenied()
+	syncer.applyFilters()
+
+	syncer.watches = conf.Realtime && !conf.Manual && !conf.AuditOnly && conf.After == ""
 	syncer.eventsChan = make(chan interface{})
 	syncer.patchStatus = make(chan model.Status)
 	syncer.patchDone = make(chan interface{})
+	syncer.throughputDone = make(chan bool)
 	syncer.cmd = model.NewCommand()
 
-	if patchStore, err := endpoint.NewPatchStore(configPath, leftEndpoint, rightEndpoint); err == nil {
-		syncer.patchStore = patchStore
-		syncTask.SetPatchListener(syncer.patchStore)
+	syncer.loops = newLoopDetector()
+	endpoint.SetOrigin(leftEndpoint, config.Default().DeviceId)
+	endpoint.SetOrigin(rightEndpoint, config.Default().DeviceId)
+	for name, ep := range map[string]model.Endpoint{"left": leftEndpoint, "right": rightEndpoint} {
+		j, er := endpoint.SetWriteJournal(ep, filepath.Join(configPath, "write-journal-"+name))
+		if er != nil {
+			startError = errors.Wrap(er, "cannot open write journal")
+			return
+		}
+		if j == nil {
+			continue
+		}
+		syncer.journals = append(syncer.journals, j)
+		if r := j.Recovered; r.RolledBack > 0 || r.RolledForward > 0 {
+			log.Logger(ctx).Warn(fmt.Sprintf("Recovered writes interrupted in previous run: %d removed, %d completed", r.RolledBack, r.RolledForward))
+		}
+	}
+	if e := syncer.setupBatches(leftEndpoint, rightEndpoint); e != nil {
+		startError = e
+		return
+	}
+	if conf.AppendOnly {
+		if e := syncer.setupAppendOnly(leftEndpoint, rightEndpoint, direction); e != nil {
+			startError = e
+			return
+		}
+	}
+	if conf.Retention != nil {
+		if e := syncer.setupRetention(leftEndpoint, rightEndpoint, direction); e != nil {
+			startError = e
+			return
+		}
+	}
+	if conf.Trash != nil {
+		if conf.Retention != nil {
+			// Tasks configured before both options were rejected
+			startError = fmt.Errorf("the local trash cannot be used with retention rules, deleted files are already kept in the stash")
+			return
+		}
+		syncer.setupTrash(leftEndpoint, rightEndpoint)
+	}
+	syncer.progress = endpoint.NewProgressTracker()
+	endpoint.SetProgressTracker(leftEndpoint, syncer.progress)
+	endpoint.SetProgressTracker(rightEndpoint, syncer.progress)
+	if history, err := OpenTaskHistory(conf.Uuid); err == nil {
+		syncer.history = history
+	} else {
+		log.Logger(ctx).Error("Cannot open history: " + err.Error())
+	}
+	if syncer.history != nil {
+		syncer.patchStore, _ = endpoint.NewPatchStore(syncer.history, leftEndpoint, rightEndpoint)
+		syncTask.SetPatchListener(&endpoint.ProgressListener{Tracker: syncer.progress, Next: syncer.patchStore})
+		syncer.statsStore, _ = endpoint.NewStatsStore(syncer.history)
+	} else {
+		syncTask.SetPatchListener(&endpoint.ProgressListener{Tracker: syncer.progress})
+	}
 
+	if nodeMeta, err := endpoint.NewNodeMetaStore(configPath); err == nil {
+		syncer.nodeMeta = nodeMeta
 	} else {
-		log.Logger(ctx).Error("Cannot open patch store: " + err.Error())
+		log.Logger(ctx).Error("Cannot open node metadata store: " + err.Error())
+	}
+
+	for side, uri := range map[string]string{"left": conf.LeftURI, "right": conf.RightURI} {
+		root, ok := endpoint.LocalPathForURI(uri)
+		if !ok {
+			continue
+		}
+		cache, err := endpoint.OpenHashCache(configPath, side, root)
+		if err != nil {
+			log.Logger(ctx).Error("Cannot open hash cache: " + err.Error())
+			continue
+		}
+		ep := leftEndpoint
+		if side == "right" {
+			ep = rightEndpoint
+		}
+		if endpoint.SetHashCache(ep, cache) {
+			syncer.hashCaches = append(syncer.hashCaches, cache)
+		} else {
+			cache.Close()
+		}
+	}
+
+	syncer.setupActorTracking(ctx, leftEndpoint, rightEndpoint)
+	syncer.migrateSnapshots(ctx)
+	syncer.setupSafeMode(ctx, leftEndpoint, rightEndpoint)
+	syncer.setupRemoteMeta(ctx, leftEndpoint, rightEndpoint)
+	if conf.Digests {
+		syncer.digest = newTransferDigest(func(n *common.Notification) {
+			n.TaskUuid = syncer.uuid
+			n.Title = syncer.label
+			PublishNotification(n)
+		})
+	}
+	syncer.compactSnapshots(ctx)
+	endpoint.SetRemoteCache(leftEndpoint)
+	endpoint.SetRemoteCache(rightEndpoint)
+	if uploads, er := endpoint.OpenUploadSessions(configPath); er == nil {
+		syncer.uploads = uploads
+		endpoint.SetUploadSessions(leftEndpoint, uploads)
+		endpoint.SetUploadSessions(rightEndpoint, uploads)
+	} else {
+		log.Logger(ctx).Error("Cannot open upload sessions: " + er.Error())
+	}
+	if keys, er := endpoint.OpenOperationKeys(configPath); er == nil {
+		syncer.opKeys = keys
+		endpoint.SetOperationKeys(leftEndpoint, keys)
+		endpoint.SetOperationKeys(rightEndpoint, keys)
+	} else {
+		log.Logger(ctx).Error("Cannot open operation keys: " + er.Error())
+	}
+	hold := endpoint.NewWatchHold()
+	if l, r := endpoint.SetWatchHold(leftEndpoint, hold), endpoint.SetWatchHold(rightEndpoint, hold); l || r {
+		syncer.hold = hold
+	}
+	if !conf.PermanentDeletes {
+		if bin, er := endpoint.OpenRecycleBin(filepath.Join(configPath, recycleBinFile)); er == nil {
+			endpoint.SetRecycleBin(leftEndpoint, bin)
+			endpoint.SetRecycleBin(rightEndpoint, bin)
+		} else {
+			log.Logger(ctx).Error("Cannot open recycle bin deletions: " + er.Error())
+		}
+	}
+	pauseBytes := func() uint64 {
+		return config.Default().DiskSpaceFor(conf).PauseBytes()
+	}
+	endpoint.SetDiskSpaceGuard(leftEndpoint, pauseBytes)
+	endpoint.SetDiskSpaceGuard(rightEndpoint, pauseBytes)
+	if conf.ContentCacheMB > 0 {
+		if contents, er := endpoint.OpenContentCache(configPath, int64(conf.ContentCacheMB)*1024*1024); er == nil {
+			endpoint.SetContentCache(leftEndpoint, contents)
+			endpoint.SetContentCache(rightEndpoint, contents)
+		} else {
+			log.Logger(ctx).Error("Cannot open content cache: " + er.Error())
+		}
+	}
+	syncer.setupLowPower(ctx)
+
+	if syncer.history != nil {
+		syncer.audit, _ = endpoint.NewAuditLog(syncer.history)
+		if count, err := syncer.audit.ImportAuditFolder(AuditFolder(conf.Uuid)); err != nil {
+			log.Logger(ctx).Error("Cannot import previous audit log: " + err.Error())
+		} else if count > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Imported %d records of the previous audit log into the history", count))
+		}
+		if count, err := syncer.patchStore.ImportPatchesFile(filepath.Join(configPath, endpoint.HistoryPatches)); err != nil {
+			log.Logger(ctx).Error("Cannot import previous patches: " + err.Error())
+		} else if count > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Imported %d previous patches into the history", count))
+		}
+		if count, err := syncer.statsStore.ImportStatsFile(filepath.Join(configPath, endpoint.HistoryStats)); err != nil {
+			log.Logger(ctx).Error("Cannot import previous stats: " + err.Error())
+		} else if count > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Imported %d hours of previous stats into the history", count))
+		}
 	}
 
 	return
@@ -163,9 +570,18 @@ func (s *Syncer) dispatchStatus(ctx context.Context) {
 				msg += fmt.Sprintf(" - Progress: %d%%", int64(l.Progress()*100))
 			}
 			status := model.TaskStatusProcessing
+			if !s.taskPaused {
+				// A paused pass may never send done, do not let safe quit wait for it
+				setRunning(s.uuid, true)
+			}
 			if l.IsError() {
 				//status = common.TaskStatusError
-				log.Logger(ctx).Error(msg)
+				if ok, repeated := s.knownErrors.shouldLog(msg); ok {
+					if repeated > 0 {
+						msg += fmt.Sprintf(" (repeated %d times)", repeated)
+					}
+					log.Logger(ctx).Error(msg)
+				}
 			} else {
 				log.Logger(ctx).Debug(msg)
 			}
@@ -175,6 +591,12 @@ func (s *Syncer) dispatchStatus(ctx context.Context) {
 			if !ok {
 				return
 			}
+			atomic.StoreInt32(&s.scheduledScan, 0)
+			setRunning(s.uuid, false)
+			s.releaseScanSlot()
+			s.progress.Reset()
+			endpoint.ClearRemoteCache(s.task.Source)
+			endpoint.ClearRemoteCache(s.task.Target)
 			var idleStatus = model.TaskStatusIdle
 			if s.taskPaused {
 				idleStatus = model.TaskStatusPaused
@@ -182,10 +604,14 @@ func (s *Syncer) dispatchStatus(ctx context.Context) {
 			deferIdle := true
 			stateStore := s.stateStore
 			if patch, ok := data.(merger.Patch); ok {
+				if _, hasErrors := patch.HasErrors(); !hasErrors {
+					s.leaveSafeMode(ctx)
+				}
 				stats := patch.Stats()
 				if patch.Size() > 0 {
 					s.lastPatch = patch
 					s.stateStore.TouchLastOpsTime()
+					s.recordTransfers(ctx)
 					// Update Stats from snapshots
 					if snapStats, err := s.task.RootStats(ctx, true); err == nil {
 						log.Logger(ctx).Info("Stats after running patch")
@@ -198,11 +624,23 @@ func (s *Syncer) dispatchStatus(ctx context.Context) {
 				if val, ok := stats["Errors"]; ok {
 					errs := val.(map[string]int)
 					msg := fmt.Sprintf("Processing ended on error (%d errors)!", errs["Total"])
+					if state := stateStore.LastState(); state.ThrottledUntil != nil {
+						msg += " Server is throttling requests, will retry after " + state.ThrottledUntil.Format("15:04:05")
+					}
+					if state := stateStore.LastState(); state.MaintenanceUntil != nil {
+						msg += " Server is under maintenance, will resume at " + state.MaintenanceUntil.Format("15:04:05")
+					}
 					log.Logger(ctx).Error(msg)
 					stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusError)
 					deferIdle = false
 				} else if err, ok := patch.HasErrors(); ok {
 					msg := fmt.Sprintf("Processing ended with %d errors!", len(err))
+					if state := stateStore.LastState(); state.ThrottledUntil != nil {
+						msg += " Server is throttling requests, will retry after " + state.ThrottledUntil.Format("15:04:05")
+					}
+					if state := stateStore.LastState(); state.MaintenanceUntil != nil {
+						msg += " Server is under maintenance, will resume at " + state.MaintenanceUntil.Format("15:04:05")
+					}
 					log.Logger(ctx).Error(msg)
 					stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusError)
 					deferIdle = false
@@ -215,9 +653,31 @@ func (s *Syncer) dispatchStatus(ctx context.Context) {
 					stateStore.UpdateProcessStatus(model.NewProcessingStatus("Idle"), idleStatus)
 					deferIdle = false
 				}
+				s.finishBatches(ctx, patch)
+				stateStore.UpdateErrors(patchErrors(patch, s.knownErrors))
 				if s.patchStore != nil {
 					s.patchStore.Store(patch)
 				}
+				go GetBus().Pub(NewPatchReport(s.uuid, patch), TopicReport)
+				s.recordLatencies(patch)
+				s.recordDigest(patch)
+				s.recordMergeBases(ctx, patch)
+				s.writeManifest(ctx)
+				s.handleConflicts(ctx, patch)
+				notifyPathViolations(s.uuid, s.label, patch, s.knownErrors)
+				if er := s.knownErrors.save(); er != nil {
+					log.Logger(ctx).Error("Cannot save errors registry: " + er.Error())
+				}
+				s.recordAudit(ctx, patch)
+				s.recordNodeMeta(ctx, patch)
+				s.handleQuarantine(ctx, patch)
+				s.runHooks(ctx, patch)
+				s.handleAccessDenied(ctx, patch)
+				s.retryChangedSources(ctx, patch)
+				s.retryLockedNodes(ctx, patch)
+				s.detectLoop(ctx, patch)
+				s.propagateChain(ctx, patch)
+				s.recordDivergence(ctx, patch)
 			}
 			if deferIdle {
 				go func() {
@@ -230,6 +690,10 @@ func (s *Syncer) dispatchStatus(ctx context.Context) {
 			go GetBus().Pub(e, TopicSync_+s.uuid)
 
 		case <-time.After(10 * time.Minute):
+			s.sampleIntegrityIfDue(ctx)
+			if s.manual() || s.auditOnly() {
+				break
+			}
 			log.Logger(ctx).Info("Sending Loop after 10mn Idle Time")
 			GetBus().Pub(MessageSyncLoop, TopicSync_+s.uuid)
 			break
@@ -250,9 +714,14 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 
 			log.Logger(ctx).Info("Stopping Service")
 			bus.Unsub(topic)
+			setRunning(s.uuid, false)
 			if s.task != nil {
 				log.Logger(ctx).Info("-- Stopping Task")
-				s.task.Shutdown()
+				if s.cancelStart() {
+					s.task.Shutdown()
+				}
+				s.releaseScanSlot()
+				close(s.throughputDone)
 				close(s.eventsChan)
 				close(s.patchDone)
 				close(s.patchStatus)
@@ -262,6 +731,41 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 				log.Logger(ctx).Info("-- Stopping PatchStore")
 				s.patchStore.Stop()
 			}
+			if s.history != nil {
+				log.Logger(ctx).Info("-- Closing History")
+				s.history.Close()
+			}
+			if s.nodeMeta != nil {
+				s.nodeMeta.Stop()
+			}
+			for _, h := range s.hashCaches {
+				h.Close()
+			}
+			if s.uploads != nil {
+				s.uploads.Close()
+			}
+			if s.opKeys != nil {
+				s.opKeys.Close()
+			}
+			if s.transforms != nil {
+				s.transforms.Close()
+			}
+			if s.holdTimer != nil {
+				s.holdTimer.Stop()
+			}
+			if s.digest != nil {
+				s.digest.flush()
+			}
+			s.stopActorTracking()
+			for _, j := range s.journals {
+				j.Close()
+			}
+			for _, b := range s.batches {
+				b.Close()
+			}
+			if s.appendOnly != nil {
+				s.appendOnly.Close()
+			}
 			if s.snapFactory != nil {
 				if s.cleanAllAfterStop {
 					log.Logger(ctx).Info("-- Cleaning Snapshots")
@@ -289,6 +793,14 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 
 		case message := <-topic:
 
+			if limits, ok := message.(*config.TransferLimits); ok {
+				s.applyTransferLimits(ctx, limits)
+				continue
+			}
+			if pass, ok := message.(*ChainPass); ok && s.task != nil {
+				s.runChainPass(ctx, pass)
+				continue
+			}
 			switch message {
 			case MessageRestart:
 				// Message from supervisor, just update status
@@ -304,21 +816,57 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 				// Message from supervisor, just update status
 				s.cleanAllAfterStop = true
 				bus.Pub(s.stateStore.UpdateSyncStatus(model.TaskStatusStopping), TopicState)
-			case MessageResync:
-				// Trigger a full resync
+			case MessageResync, MessageScheduledResync:
+				if s.auditOnly() {
+					s.run(ctx, true)
+					break
+				}
+				if message == MessageResync && s.startManual(ctx) {
+					break
+				}
+				if (message == MessageScheduledResync && (s.blackout || s.manual())) || !s.isStarted() {
+					break
+				}
+				if s.holding() {
+					log.Logger(ctx).Info("Local changes are held, resync will run once they are released")
+					break
+				}
+				if s.resolving() {
+					log.Logger(ctx).Info("Conflicts are being resolved, changes will be synced once they are done")
+					break
+				}
+				// Trigger a full resync. Scheduled ones may be throttled by the rescan policy.
+				if message == MessageScheduledResync {
+					atomic.StoreInt32(&s.scheduledScan, 1)
+				}
 				if s.lastPatch != nil {
 					if _, b := s.lastPatch.HasErrors(); b {
 						// Remove the lastPatch otherwise it will stick
 						s.lastPatch = nil
 					}
 				}
+				if !s.workspacesAvailable(ctx) {
+					break
+				}
 				s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Starting full resync"), model.TaskStatusProcessing)
-				s.task.Run(ctx, false, true)
+				s.run(ctx, true)
 			case MessageResyncDry:
 				// Trigger a dry-run
 				s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Dry-running sync"), model.TaskStatusProcessing)
 				s.task.Run(ctx, true, true)
 			case MessageSyncLoop:
+				if s.auditOnly() {
+					if !s.blackout && !s.maintenance {
+						s.run(ctx, false)
+					}
+					break
+				}
+				if s.startManual(ctx) {
+					break
+				}
+				if s.blackout || s.maintenance || s.holding() || !s.isStarted() || s.resolving() || !s.workspacesAvailable(ctx) {
+					break
+				}
 				if s.lastPatch != nil {
 					if _, b := s.lastPatch.HasErrors(); b {
 						// Trigger the loop
@@ -328,7 +876,10 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 					}
 				}
 				s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Starting sync loop"), model.TaskStatusProcessing)
-				s.task.Run(ctx, false, false)
+				s.run(ctx, false)
+			case MessageRetention:
+				go s.enforceRetention(ctx)
+				go s.purgeTrash(ctx)
 			case MessagePublishState:
 				// Broadcast current state
 				bus.Pub(s.stateStore.LastState(), TopicState)
@@ -336,27 +887,190 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 				if s.patchStore != nil {
 					bus.Pub(s.patchStore, TopicStore_+s.uuid)
 				}
+			case MessagePublishMeta:
+				if s.nodeMeta != nil {
+					bus.Pub(s.nodeMeta, TopicMeta_+s.uuid)
+				}
+			case MessagePublishStats:
+				if s.statsStore != nil {
+					bus.Pub(s.statsStore, TopicStats_+s.uuid)
+				}
+			case MessagePublishHistory:
+				if s.history != nil {
+					bus.Pub(s.history, TopicHistory_+s.uuid)
+				}
 			case MessageInterrupt:
 				s.cmd.Publish(model.Interrupt)
 			case MessagePause:
-				// Stop watching for events
+				// Stop watching for events, a timed pause becomes indefinite
+				s.clearPausedUntil(ctx)
 				s.task.Pause(ctx)
 				s.taskPaused = true
+				s.drainRunning()
 				state := s.stateStore.UpdateSyncStatus(model.TaskStatusPaused)
 				bus.Pub(state, TopicState)
 			case MessageResume:
-				// Start watching for events
-				s.task.Resume(ctx)
+				if s.migrationFailed {
+					log.Logger(ctx).Warn("Snapshots could not be upgraded, roll back to the previous release to resume this task")
+					break
+				}
+				s.clearPausedUntil(ctx)
+				if cancel, held := s.releaseHold(); held {
+					// Task was started in paused mode, run its initial scan now, or on the first run in manual mode
+					s.taskPaused = false
+					bus.Pub(s.stateStore.UpdateSyncStatus(model.TaskStatusIdle), TopicState)
+					if s.auditOnly() {
+						s.run(ctx, false)
+					} else if !s.manual() {
+						go s.startScheduled(ctx, cancel)
+					}
+					break
+				}
 				s.taskPaused = false
+				s.blackout = false
+				s.maintenance = false
+				if s.loops != nil {
+					s.loops.reset()
+				}
 				state := s.stateStore.UpdateSyncStatus(model.TaskStatusIdle)
 				bus.Pub(state, TopicState)
-				s.task.Run(ctx, false, false)
+				if s.resolving() {
+					// Events are watched again and synced once the resolutions are done
+					break
+				}
+				// Start watching for events
+				s.task.Resume(ctx)
+				s.run(ctx, false)
+			case MessageLoopDetected:
+				// Stop re-applying changes until the user fixed the setup and resumed the task
+				if s.taskPaused {
+					break
+				}
+				s.task.Pause(ctx)
+				s.taskPaused = true
+				s.drainRunning()
+				msg := "Paused: sync loop detected, check that these folders are not synced by another agent"
+				bus.Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused), TopicState)
+			case MessageBlackoutStart:
+				// Pause task until the end of the window, unless it is already paused by user
+				if s.taskPaused {
+					break
+				}
+				s.task.Pause(ctx)
+				s.taskPaused = true
+				s.drainRunning()
+				s.blackout = true
+				msg := "Paused by schedule"
+				if end, ok := blackoutEnd(s.conf.Blackouts, time.Now()); ok {
+					msg += " until " + end.Format("15:04")
+				}
+				log.Logger(ctx).Info(msg)
+				bus.Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused), TopicState)
+			case MessageBlackoutEnd:
+				// Resume task and catch up with changes made during the window
+				if !s.blackout {
+					break
+				}
+				s.task.Resume(ctx)
+				s.taskPaused = false
+				s.blackout = false
+				bus.Pub(s.stateStore.UpdateSyncStatus(model.TaskStatusIdle), TopicState)
+				if s.manual() {
+					break
+				}
+				s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Starting sync loop"), model.TaskStatusProcessing)
+				s.run(ctx, false)
+			case MessageMaintenanceStart:
+				// Hold the task until the server is back, unless it is already paused
+				if s.taskPaused {
+					break
+				}
+				s.task.Pause(ctx)
+				s.taskPaused = true
+				s.drainRunning()
+				s.maintenance = true
+				msg := "Server under maintenance, resuming at " + s.maintenanceUntil.Format("15:04:05")
+				log.Logger(ctx).Warn(msg)
+				bus.Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused), TopicState)
+			case MessageMaintenanceEnd:
+				// Resume task and catch up with changes made during the maintenance
+				if !s.maintenance {
+					break
+				}
+				s.task.Resume(ctx)
+				s.taskPaused = false
+				s.maintenance = false
+				log.Logger(ctx).Info("Server is back from maintenance, resuming task")
+				bus.Pub(s.stateStore.UpdateSyncStatus(model.TaskStatusIdle), TopicState)
+				if s.manual() {
+					break
+				}
+				s.stateStore.UpdateProcessStatus(model.NewProcessingStatus("Starting sync loop"), model.TaskStatusProcessing)
+				s.run(ctx, false)
 			case MessageDisable:
 				// Disable Task
 				s.task.Shutdown()
 				state := s.stateStore.UpdateSyncStatus(model.TaskStatusDisabled)
 				bus.Pub(state, TopicState)
 			default:
+				if resolution, ok := message.(*ConflictResolution); ok && s.task != nil {
+					s.resolveInBackground(ctx, func() bool {
+						if e := s.resolveConflict(ctx, resolution); e != nil {
+							log.Logger(ctx).Error("Cannot resolve conflict on " + resolution.Path + ": " + e.Error())
+							return false
+						}
+						log.Logger(ctx).Info("Resolved conflict on " + resolution.Path + " (" + resolution.Keep + ")")
+						return true
+					})
+					break
+				}
+				if bulk, ok := message.(*BulkConflictResolution); ok && s.task != nil {
+					s.resolveInBackground(ctx, func() bool {
+						return s.resolveConflicts(ctx, bulk)
+					})
+					break
+				}
+				if done, ok := message.(*resolutionDone); ok && s.task != nil {
+					s.endResolution(ctx, done)
+					break
+				}
+				if approval, ok := message.(*RecoveryApproval); ok && s.task != nil {
+					s.applyRecovery(ctx, approval)
+					break
+				}
+				if hold, ok := message.(*HoldRequest); ok && s.task != nil {
+					s.replyHold(ctx, hold)
+					break
+				}
+				if pause, ok := message.(*PauseUntil); ok && s.task != nil {
+					s.pauseUntil(ctx, pause.Until)
+					break
+				}
+				if resync, ok := message.(*SubtreeResync); ok && s.task != nil {
+					go s.replyResyncSubtree(ctx, resync)
+					break
+				}
+				if snooze, ok := message.(*ErrorSnooze); ok {
+					days := snooze.Days
+					if days <= 0 {
+						days = DefaultSnoozeDays
+					}
+					count := s.knownErrors.snooze(snooze.Fingerprint, snooze.Path, days)
+					log.Logger(ctx).Info(fmt.Sprintf("Snoozed %d error(s) for %d days", count, days))
+					if er := s.knownErrors.save(); er != nil {
+						log.Logger(ctx).Error("Cannot save errors registry: " + er.Error())
+					}
+					bus.Pub(s.stateStore.UpdateErrors(s.knownErrors.filter(s.stateStore.LastState().Errors)), TopicState)
+					break
+				}
+				if rename, ok := message.(*RemoteRename); ok && s.task != nil {
+					if e := s.renameRemote(ctx, rename); e != nil {
+						log.Logger(ctx).Error("Cannot rename " + rename.Path + ": " + e.Error())
+					} else {
+						log.Logger(ctx).Info("Renamed " + rename.Path + " to " + rename.NewPath + " on server")
+					}
+					break
+				}
 				// Received info about an Endpoint - TODO : move this inside StateStore
 				if status, ok := message.(*model.EndpointStatus); ok {
 					initialConnState := s.stateStore.BothConnected()
@@ -383,15 +1097,10 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 					if updateConnection {
 						state := s.stateStore.UpdateConnection(connected, status.EndpointInfo)
 						newConnState := s.stateStore.BothConnected()
-						if state.Status == model.TaskStatusIdle && newConnState && newConnState != initialConnState {
-							if s.dirtyStopped {
-								s.dirtyStopped = false
-								log.Logger(ctx).Info("Both sides are connected, now launching a full resync")
-								s.task.Run(ctx, false, true)
-							} else {
-								log.Logger(ctx).Info("Both sides are connected, now launching a sync loop")
-								s.task.Run(ctx, false, false)
-							}
+						if !newConnState {
+							s.reconnect.cancel()
+						} else if state.Status == model.TaskStatusIdle && newConnState != initialConnState {
+							s.runAfterReconnect()
 						}
 						bus.Pub(state, TopicState)
 					} else if updateActive {
@@ -410,6 +1119,113 @@ func (s *Syncer) dispatchBus(ctx context.Context, done chan bool) {
 
 }
 
+// dispatchThroughput feeds the live throughput with the bytes transferred during the last second, and publishes
+// the state every second while transfers happened during the last minute or files are being processed, so that
+// clients can render live rates and per-file progress.
+func (s *Syncer) dispatchThroughput() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	var wasActive bool
+	var ticks int
+	for {
+		select {
+		case <-ticker.C:
+			ticks++
+			state := s.collectTransfers()
+			if ticks%transfersRecordInterval == 0 {
+				s.recordTransfers(s.serviceCtx)
+			}
+			active := state.Throughput.Active()
+			throttlingChanged := s.checkThrottling()
+			maintenanceChanged := s.checkMaintenance()
+			_, filesChanged := s.stateStore.UpdateActiveFiles(s.progress.List())
+			if active || wasActive || throttlingChanged || maintenanceChanged || filesChanged {
+				GetBus().Pub(s.stateStore.LastState(), TopicState)
+			}
+			wasActive = active
+		case <-s.throughputDone:
+			return
+		}
+	}
+}
+
+// loadCapabilities reads the endpoints capabilities from the cache, probing them if required. It also checks
+// whether the servers currently announce a maintenance.
+func (s *Syncer) loadCapabilities(ctx context.Context, endpoints map[string]model.Endpoint) {
+	for uri, ep := range endpoints {
+		if until := endpoint.CheckMaintenance(uri); !until.IsZero() {
+			log.Logger(ctx).Warn("Server of " + ep.GetEndpointInfo().URI + " is under maintenance until " + until.Format("15:04:05"))
+		}
+		caps, e := endpoint.LoadCapabilities(s.configPath, uri)
+		if e != nil {
+			log.Logger(ctx).Warn("Cannot load capabilities of " + ep.GetEndpointInfo().URI + ": " + e.Error())
+			continue
+		}
+		endpoint.SetCapabilities(ep, caps)
+		GetBus().Pub(s.stateStore.UpdateCapabilities(caps, ep.GetEndpointInfo()), TopicState)
+	}
+}
+
+// checkThrottling updates the state if a server of the task is throttling requests, so that a clear status is
+// displayed instead of generic errors.
+func (s *Syncer) checkThrottling() bool {
+	if s.conf == nil {
+		return false
+	}
+	var until time.Time
+	for _, uri := range []string{s.conf.LeftURI, s.conf.RightURI} {
+		if u := endpoint.ThrottledUntil(uri); u.After(until) {
+			until = u
+		}
+	}
+	_, changed := s.stateStore.UpdateThrottling(until)
+	if changed && !until.IsZero() {
+		msg := "Server is throttling requests, resuming at " + until.Format("15:04:05")
+		log.Logger(s.serviceCtx).Warn(msg)
+		s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg))
+	}
+	return changed
+}
+
+// checkMaintenance updates the state if a server of the task announced a maintenance, and publishes
+// MessageMaintenanceStart/End on the task topic so that the task is held instead of failing on every request.
+func (s *Syncer) checkMaintenance() bool {
+	if s.conf == nil {
+		return false
+	}
+	var until time.Time
+	for _, uri := range []string{s.conf.LeftURI, s.conf.RightURI} {
+		if u := endpoint.MaintenanceUntil(uri); u.After(until) {
+			until = u
+		}
+	}
+	_, changed := s.stateStore.UpdateMaintenance(until)
+	if !changed {
+		return false
+	}
+	if !until.IsZero() && s.maintenanceUntil.IsZero() {
+		s.maintenanceUntil = until
+		go GetBus().Pub(MessageMaintenanceStart, TopicSync_+s.uuid)
+	} else if until.IsZero() {
+		// Server may have announced a longer maintenance through its capabilities
+		for _, uri := range []string{s.conf.LeftURI, s.conf.RightURI} {
+			if u := endpoint.CheckMaintenance(uri); u.After(until) {
+				until = u
+			}
+		}
+		if !until.IsZero() {
+			s.maintenanceUntil = until
+			s.stateStore.UpdateMaintenance(until)
+			return true
+		}
+		s.maintenanceUntil = time.Time{}
+		go GetBus().Pub(MessageMaintenanceEnd, TopicSync_+s.uuid)
+	} else {
+		s.maintenanceUntil = until
+	}
+	return true
+}
+
 // Serve implements supervisor interface.
 func (s *Syncer) Serve() {
 
@@ -422,11 +1238,24 @@ func (s *Syncer) Serve() {
 
 		go s.dispatchStatus(ctx)
 		go s.dispatchBus(ctx, done)
+		go s.dispatchThroughput()
+		go s.watchBlackouts(s.throughputDone)
+		go s.pollCloudCompat(s.throughputDone)
+		go s.pollLowPower(s.throughputDone)
+		go s.runCron(s.throughputDone)
+		go s.watchStandby(s.throughputDone)
+		go s.watchPausedUntil(s.throughputDone)
+		go s.watchPolicy(s.throughputDone)
+		go s.publishConflictCopies()
 
 		s.task.SetupCmd(s.cmd)
 		s.task.SetupEventsChan(s.patchStatus, s.patchDone, s.eventsChan)
 		s.snapFactory = endpoint.NewSnapshotFactory(s.configPath, s.task.Source, s.task.Target)
 		s.task.SetSnapshotFactory(s.snapFactory)
+		endpoint.OnSnapshotCorrupted(s.snapFactory, func(name string) {
+			s.enterSafeMode(ctx)
+		})
+		s.invalidateFolders(ctx)
 
 		if s.patchStore != nil {
 			if lasts, err := s.patchStore.Load(0, 1); err == nil && len(lasts) > 0 {
@@ -440,7 +1269,35 @@ func (s *Syncer) Serve() {
 			}
 		}
 
-		s.task.Start(ctx, s.watches)
+		s.startLock.Lock()
+		s.started = false
+		s.manualStart = false
+		s.startCancel = make(chan struct{})
+		until := s.loadPausedUntil(ctx)
+		if !until.IsZero() {
+			// Timed pause from a previous run, the initial scan runs when it expires
+			s.holdStart = true
+		}
+		held := s.holdStart
+		s.startLock.Unlock()
+		if held {
+			s.taskPaused = true
+			msg := "Started in paused mode, resume the task to start syncing"
+			if s.migrationFailed {
+				msg = "Snapshots could not be upgraded, roll back to the previous release to resume this task"
+			} else if !until.IsZero() {
+				msg = pausedUntilMessage(until)
+			}
+			GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused), TopicState)
+		} else if s.manual() {
+			msg := "Manual mode, run the task to start syncing"
+			GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusIdle), TopicState)
+		} else if s.auditOnly() {
+			// Contents are never synced, both sides are only compared on the task schedule
+			s.run(ctx, false)
+		} else {
+			go s.startScheduled(ctx, s.startCancel)
+		}
 
 	} else {
 
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	throughputWindow   = 60
+	throughputRateSpan = 5
+	// Transferred bytes are added to the network usage and stats every minute, and when a patch is done
+	transfersRecordInterval = 60
+)
+
+// ThroughputMeter keeps a rolling window of per-second transferred bytes, for each direction.
+// Up means from the local filesystem to the remote endpoint, Down the opposite.
+type ThroughputMeter struct {
+	sync.Mutex
+	up         [throughputWindow]int64
+	down       [throughputWindow]int64
+	lastSecond int64
+}
+
+// NewThroughputMeter creates an empty ThroughputMeter.
+func NewThroughputMeter() *ThroughputMeter {
+	return &ThroughputMeter{lastSecond: time.Now().Unix()}
+}
+
+// advance resets the slots of the seconds that elapsed since the last record.
+func (m *ThroughputMeter) advance(now int64) {
+	elapsed := now - m.lastSecond
+	if elapsed <= 0 {
+		return
+	}
+	if elapsed > throughputWindow {
+		elapsed = throughputWindow
+	}
+	for i := int64(1); i <= elapsed; i++ {
+		idx := (m.lastSecond + i) % throughputWindow
+		m.up[idx] = 0
+		m.down[idx] = 0
+	}
+	m.lastSecond = now
+}
+
+// Record adds transferred bytes to the current second.
+func (m *ThroughputMeter) Record(up, down int64) {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now().Unix()
+	m.advance(now)
+	idx := now % throughputWindow
+	m.up[idx] += up
+	m.down[idx] += down
+}
+
+// Info builds a ThroughputInfo. Rates are averaged on the last few seconds.
+func (m *ThroughputMeter) Info() *common.ThroughputInfo {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now().Unix()
+	m.advance(now)
+	info := &common.ThroughputInfo{
+		UpSamples:   make([]int64, throughputWindow),
+		DownSamples: make([]int64, throughputWindow),
+	}
+	for i := 0; i < throughputWindow; i++ {
+		idx := (now + 1 + int64(i)) % throughputWindow
+		info.UpSamples[i] = m.up[idx]
+		info.DownSamples[i] = m.down[idx]
+		if i >= throughputWindow-throughputRateSpan {
+			info.UpRate += m.up[idx]
+			info.DownRate += m.down[idx]
+		}
+	}
+	info.UpRate /= throughputRateSpan
+	info.DownRate /= throughputRateSpan
+	return info
+}
+
+// collectTransfers moves the bytes counted by the progress tracker to the live throughput, and keeps them until
+// they are recorded by recordTransfers.
+func (s *Syncer) collectTransfers() common.SyncState {
+	up, down := s.progress.TakeTransfers()
+	s.transfersLock.Lock()
+	s.pendingUp += up
+	s.pendingDown += down
+	s.transfersLock.Unlock()
+	return s.stateStore.UpdateThroughput(up, down)
+}
+
+// recordTransfers adds the bytes transferred since the last call to the network usage and the hourly stats.
+func (s *Syncer) recordTransfers(ctx context.Context) {
+	s.collectTransfers()
+	s.transfersLock.Lock()
+	up, down := s.pendingUp, s.pendingDown
+	s.pendingUp, s.pendingDown = 0, 0
+	s.transfersLock.Unlock()
+	if up == 0 && down == 0 {
+		return
+	}
+	if er := recordNetworkUsage(up, down); er != nil {
+		log.Logger(ctx).Error("Cannot record network usage: " + er.Error())
+	}
+	if s.statsStore != nil {
+		if er := s.statsStore.RecordTransfer(time.Now(), up, down); er != nil {
+			log.Logger(ctx).Error("Cannot record transfer stats: " + er.Error())
+		}
+	}
+}
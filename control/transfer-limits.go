@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// setupTransferLimits registers the task limiter on its local endpoint. For tasks between two local folders,
+// only the left one is limited, as a copy would otherwise take two transfer slots.
+func (s *Syncer) setupTransferLimits(left, right model.Endpoint) {
+	s.transfers = endpoint.NewTransferLimiter()
+	s.applyTransferLimits(context.Background(), s.conf.Transfers)
+	if !endpoint.SetTransferLimiter(left, s.transfers) {
+		endpoint.SetTransferLimiter(right, s.transfers)
+	}
+}
+
+// applyTransferLimits changes the limits of the running task.
+func (s *Syncer) applyTransferLimits(ctx context.Context, limits *config.TransferLimits) {
+	limits = lowPowerLimits(s.conf, limits)
+	if limits == nil {
+		limits = &config.TransferLimits{}
+	}
+	log.Logger(ctx).Info(fmt.Sprintf("Transfer limits: upload %d KB/s, download %d KB/s, %d parallel transfers (0 for no limit)", limits.UploadKB, limits.DownloadKB, limits.Parallel))
+	s.transfers.Set(limits.UploadKB*1024, limits.DownloadKB*1024, limits.Parallel)
+}
+
+// updateTransferLimits saves the transfer limits of a task and sends them to the running task, without
+// restarting it.
+func (h *HttpServer) updateTransferLimits(c *gin.Context) {
+	var limits config.TransferLimits
+	if e := c.BindJSON(&limits); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	if limits.UploadKB < 0 || limits.DownloadKB < 0 || limits.Parallel < 0 {
+		h.writeError(c, fmt.Errorf("limits cannot be negative"))
+		return
+	}
+	syncUUID := c.Param("uuid")
+	if e := config.Default().SetTransferLimits(syncUUID, &limits); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	GetBus().Pub(&limits, TopicSync_+syncUUID)
+	c.JSON(http.StatusOK, limits)
+}
@@ -344,3 +344,39 @@ func (u *Updater) Stop() {
 	log.Logger(u.ctx).Info("Stopping Updater Service")
 	u.done <- true
 }
+
+// PreviousBinary returns the path of the binary replaced by the last update.
+func PreviousBinary() (string, error) {
+	dataDir := config.SyncClientDataDir()
+	candidates, _ := filepath.Glob(filepath.Join(dataDir, "backups", "revision-*"))
+	others, _ := filepath.Glob(filepath.Join(dataDir, "revision-*"))
+	var latest string
+	var latestTime time.Time
+	for _, p := range append(candidates, others...) {
+		if info, e := os.Stat(p); e == nil && !info.IsDir() && info.ModTime().After(latestTime) {
+			latest, latestTime = p, info.ModTime()
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no previous binary found in %s", filepath.Join(dataDir, "backups"))
+	}
+	return latest, nil
+}
+
+// RollbackBinary reinstalls the binary replaced by the last update in place of the current one, and returns
+// its path. The application must be restarted to use it.
+func RollbackBinary() (string, error) {
+	previous, e := PreviousBinary()
+	if e != nil {
+		return "", e
+	}
+	f, e := os.Open(previous)
+	if e != nil {
+		return "", e
+	}
+	defer f.Close()
+	if e := update2.Apply(f, update2.Options{}); e != nil {
+		return "", e
+	}
+	return previous, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// setupUploadRules installs the task upload rules and the upload limits of the server policy on the remote
+// endpoint. Blocked files are reported as policy violations in the task state instead of failing the patch.
+func (s *Syncer) setupUploadRules(left, right model.Endpoint) error {
+	root, ok := endpoint.LocalPathForURI(s.conf.LeftURI)
+	remote := right
+	if !ok {
+		root, ok = endpoint.LocalPathForURI(s.conf.RightURI)
+		remote = left
+	}
+	if !ok {
+		return nil
+	}
+	guard, e := endpoint.NewUploadGuard(config.Default().TaskUploadRules(s.conf), root)
+	if e != nil {
+		return e
+	}
+	guard.SetPolicy(s.policy.maxFileSize(), s.policy.uploadExcludes())
+	s.uploadGuard = guard
+	endpoint.SetUploadGuard(remote, guard, func(p, reason string) {
+		msg := fmt.Sprintf("%s was not uploaded: %s", path.Base(p), reason)
+		GetBus().Pub(s.stateStore.AddPolicyViolation(msg), TopicState)
+	})
+	return nil
+}
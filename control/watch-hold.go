@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// DefaultHoldMinutes is the time after which a hold of local changes is released if the user forgot it.
+const DefaultHoldMinutes = 60
+
+// HoldRequest is published on the task topic to hold or release the local changes.
+type HoldRequest struct {
+	Release bool
+	// Minutes after which the hold is released automatically (DefaultHoldMinutes by default)
+	Minutes int `json:"Minutes,omitempty"`
+}
+
+// HoldResponse describes the hold after a request.
+type HoldResponse struct {
+	Held bool
+	// Number of changes forwarded on release
+	Released int
+	// Changes were too numerous to be buffered, a full resync was triggered instead
+	Overflow bool
+	Until    time.Time `json:"Until,omitempty"`
+}
+
+// holding tells if the local changes are currently held.
+func (s *Syncer) holding() bool {
+	return s.hold != nil && s.hold.Held()
+}
+
+// replyHold holds or releases the local changes and publishes the outcome.
+func (s *Syncer) replyHold(ctx context.Context, r *HoldRequest) {
+	var reply interface{}
+	if s.hold == nil {
+		reply = fmt.Errorf("task has no local folder to hold")
+	} else if r.Release {
+		reply = s.releaseLocalChanges(ctx)
+	} else {
+		reply = s.holdLocalChanges(ctx, r.Minutes)
+	}
+	GetBus().Pub(reply, TopicHold_+s.uuid)
+}
+
+// holdLocalChanges buffers the local events until released, or until the given minutes have elapsed.
+func (s *Syncer) holdLocalChanges(ctx context.Context, minutes int) *HoldResponse {
+	if minutes <= 0 {
+		minutes = DefaultHoldMinutes
+	}
+	until := time.Now().Add(time.Duration(minutes) * time.Minute)
+	if s.hold.Hold() {
+		log.Logger(ctx).Info("Holding local changes")
+	}
+	if s.holdTimer != nil {
+		s.holdTimer.Stop()
+	}
+	s.holdTimer = time.AfterFunc(time.Until(until), func() {
+		GetBus().Pub(&HoldRequest{Release: true}, TopicSync_+s.uuid)
+	})
+	msg := "Local changes are held until released, at most until " + until.Format("15:04")
+	GetBus().Pub(s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusIdle), TopicState)
+	return &HoldResponse{Held: true, Until: until}
+}
+
+// releaseLocalChanges forwards the net result of the held changes to the task. If they were too numerous, a full
+// resync is run instead.
+func (s *Syncer) releaseLocalChanges(ctx context.Context) *HoldResponse {
+	if s.holdTimer != nil {
+		s.holdTimer.Stop()
+		s.holdTimer = nil
+	}
+	if !s.hold.Held() {
+		return &HoldResponse{}
+	}
+	count, overflow := s.hold.Release()
+	if overflow {
+		log.Logger(ctx).Warn("Too many local changes were held, running a full resync")
+		go GetBus().Pub(MessageResync, TopicSync_+s.uuid)
+	} else {
+		log.Logger(ctx).Info(fmt.Sprintf("Released %d held local change(s)", count))
+	}
+	GetBus().Pub(s.stateStore.UpdateSyncStatus(model.TaskStatusIdle), TopicState)
+	return &HoldResponse{Released: count, Overflow: overflow}
+}
+
+// holdTask holds or releases the local changes of a task, and waits for its answer.
+func (h *HttpServer) holdTask(c *gin.Context) {
+	var request HoldRequest
+	if e := json.NewDecoder(c.Request.Body).Decode(&request); e != nil {
+		h.writeError(c, e)
+		return
+	}
+	uuid := c.Param("uuid")
+	var found bool
+	for _, t := range config.Default().Tasks {
+		found = found || t.Uuid == uuid
+	}
+	if !found {
+		h.writeError(c, fmt.Errorf("cannot find task %s", uuid))
+		return
+	}
+	bus := GetBus()
+	topic := TopicHold_ + uuid
+	responses := bus.Sub(topic)
+	defer bus.Unsub(responses, topic)
+	go bus.Pub(&request, TopicSync_+uuid)
+	select {
+	case m := <-responses:
+		switch r := m.(type) {
+		case *HoldResponse:
+			c.JSON(http.StatusOK, r)
+		case error:
+			h.writeError(c, r)
+		}
+	case <-time.After(30 * time.Second):
+		h.writeError(c, fmt.Errorf("task did not respond"))
+	}
+}
@@ -0,0 +1,50 @@
+// +build darwin
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// wifiSSID reads the SSID of the Wi-Fi network with networksetup, on the first Wi-Fi device.
+func wifiSSID() (string, error) {
+	device := "en0"
+	if out, e := exec.Command("networksetup", "-listallhardwareports").Output(); e == nil {
+		lines := strings.Split(string(out), "\n")
+		for i, line := range lines {
+			if strings.Contains(line, "Wi-Fi") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "Device: ") {
+				device = strings.TrimSpace(strings.TrimPrefix(lines[i+1], "Device: "))
+				break
+			}
+		}
+	}
+	out, e := exec.Command("networksetup", "-getairportnetwork", device).Output()
+	if e != nil {
+		return "", e
+	}
+	const prefix = "Current Wi-Fi Network: "
+	if s := strings.TrimSpace(string(out)); strings.HasPrefix(s, prefix) {
+		return strings.TrimPrefix(s, prefix), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,44 @@
+// +build linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// wifiSSID reads the SSID of the active Wi-Fi connection with iwgetid, or nmcli as a fallback.
+func wifiSSID() (string, error) {
+	if out, e := exec.Command("iwgetid", "-r").Output(); e == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+	out, e := exec.Command("nmcli", "-t", "-f", "active,ssid", "dev", "wifi").Output()
+	if e != nil {
+		return "", e
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "yes:") {
+			return strings.TrimPrefix(line, "yes:"), nil
+		}
+	}
+	return "", nil
+}
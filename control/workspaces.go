@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// resolveWorkspaces updates the task URIs if the slug of their workspace has changed on the server. It returns
+// changed=true if URIs were updated, and unavailable=true if one of the workspaces has disappeared.
+func resolveWorkspaces(ctx context.Context, conf *config.Task) (changed, unavailable bool) {
+	for _, uri := range []*string{&conf.LeftURI, &conf.RightURI} {
+		resolved, e := endpoint.ResolveWorkspaceURI(*uri)
+		if e == endpoint.ErrWorkspaceUnavailable {
+			return false, true
+		} else if e != nil {
+			log.Logger(ctx).Warn("Cannot resolve workspace for " + *uri + ": " + e.Error())
+			continue
+		}
+		if resolved != *uri {
+			log.Logger(ctx).Info("Workspace slug has changed, now using " + resolved)
+			*uri = resolved
+			changed = true
+		}
+	}
+	return
+}
+
+// workspacesAvailable checks the remote workspaces before running the task. If a workspace has disappeared,
+// the task is paused instead of propagating the removal to local data. If its slug has changed, the task is
+// updated and restarted. As it lists the remote workspaces, a successful check is trusted for
+// policyRefreshInterval.
+func (s *Syncer) workspacesAvailable(ctx context.Context) bool {
+	if s.conf == nil || time.Since(s.workspacesChecked) < policyRefreshInterval {
+		return true
+	}
+	updated := *s.conf
+	changed, unavailable := resolveWorkspaces(ctx, &updated)
+	if unavailable {
+		msg := "Workspace is not available anymore on the server, task is paused"
+		log.Logger(ctx).Warn(msg)
+		s.task.Pause(ctx)
+		s.taskPaused = true
+		s.drainRunning()
+		s.stateStore.UpdateProcessStatus(model.NewProcessingStatus(msg), model.TaskStatusPaused)
+		return false
+	}
+	if changed {
+		if e := updateStoredTask(s.uuid, func(t *config.Task) bool {
+			c, _ := resolveWorkspaces(ctx, t)
+			return c
+		}); e != nil {
+			log.Logger(ctx).Error("Cannot update task: " + e.Error())
+			return true
+		}
+		return false
+	}
+	s.workspacesChecked = time.Now()
+	return true
+}
+
+// updateStoredTask applies a change to the task as stored in the config, and saves it with UpdateTask, which
+// restarts it. The running copy of a task must not be saved, as its remote URI may be derived (standby server,
+// resolved path template). Change returns false if nothing needs to be saved.
+func updateStoredTask(uuid string, change func(t *config.Task) bool) error {
+	for _, t := range config.Default().Tasks {
+		if t.Uuid != uuid {
+			continue
+		}
+		updated := *t
+		if !change(&updated) {
+			return nil
+		}
+		return config.Default().UpdateTask(&updated)
+	}
+	return fmt.Errorf("cannot find task %s", uuid)
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	concurrencyStart = 4.0
+	concurrencyMin   = 1.0
+	concurrencyMax   = 16.0
+	// latencyTolerance is the ratio to the best observed latency above which the window stops growing
+	latencyTolerance = 2.0
+	latencySmoothing = 0.2
+)
+
+var (
+	windowsLock sync.Mutex
+	windows     = make(map[string]*concurrencyWindow)
+)
+
+// concurrencyWindow limits the number of requests in flight to a server with an AIMD algorithm: the window grows by
+// one slot per window of successful requests while latency stays close to the best observed one, and is halved on
+// timeouts, 429 and 5xx responses. Users on flaky links get stable transfers without manual tuning.
+type concurrencyWindow struct {
+	sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	inFlight int
+	latency  time.Duration
+	best     time.Duration
+}
+
+// concurrencyFor returns the window for a given key, typically a kind of request and a server host.
+func concurrencyFor(key string) *concurrencyWindow {
+	windowsLock.Lock()
+	defer windowsLock.Unlock()
+	w, ok := windows[key]
+	if !ok {
+		w = &concurrencyWindow{limit: concurrencyStart}
+		w.cond = sync.NewCond(w)
+		windows[key] = w
+	}
+	return w
+}
+
+// acquire waits for a free slot. The context is checked when a slot is released.
+func (w *concurrencyWindow) acquire(ctx context.Context) error {
+	w.Lock()
+	defer w.Unlock()
+	for w.inFlight >= int(w.limit) {
+		if e := ctx.Err(); e != nil {
+			return e
+		}
+		w.cond.Wait()
+	}
+	w.inFlight++
+	return nil
+}
+
+// release frees a slot and adapts the window to the outcome of the request.
+func (w *concurrencyWindow) release(start time.Time, failed bool) {
+	w.Lock()
+	defer w.Unlock()
+	w.inFlight--
+	if failed {
+		w.limit /= 2
+		if w.limit < concurrencyMin {
+			w.limit = concurrencyMin
+		}
+	} else {
+		d := time.Since(start)
+		if w.latency == 0 {
+			w.latency = d
+		} else {
+			w.latency = time.Duration(float64(w.latency)*(1-latencySmoothing) + float64(d)*latencySmoothing)
+		}
+		if w.best == 0 || w.latency < w.best {
+			w.best = w.latency
+		}
+		if float64(w.latency) <= float64(w.best)*latencyTolerance {
+			w.limit += 1 / w.limit
+			if w.limit > concurrencyMax {
+				w.limit = concurrencyMax
+			}
+		}
+	}
+	w.cond.Broadcast()
+}
+
+// isBackoffError returns true if an error or a status code should shrink the window. Cancelled requests do not.
+func isBackoffError(ctx context.Context, e error, status int) bool {
+	if e != nil {
+		return ctx.Err() == nil
+	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
@@ -0,0 +1,293 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	apiRate     = 20.0 // requests per second
+	apiBurst    = 40
+	apiMinRate  = 1.0
+	apiRetries  = 3
+	apiDefRetry = 2 * time.Second
+)
+
+var installLimiter sync.Once
+
+// InstallAPIRateLimiter wraps the default HTTP transport so that requests sent to the servers of the configured
+// authorities are rate limited per authority, with burst control. The rate is automatically lowered when a
+// server responds with 429 Too Many Requests, and slowly restored afterward. The number of requests in flight
+// is also adapted to the observed latency and errors. A 503 Service Unavailable response with a Retry-After
+// header is considered as a maintenance announce: requests then fail immediately until it is over.
+func InstallAPIRateLimiter() {
+	installLimiter.Do(func() {
+		http.DefaultTransport = &apiLimiter{
+			base:    http.DefaultTransport,
+			buckets: make(map[string]*apiBucket),
+		}
+	})
+}
+
+type apiLimiter struct {
+	sync.Mutex
+	base    http.RoundTripper
+	buckets map[string]*apiBucket
+}
+
+// apiBucket is a token bucket whose rate adapts to server responses.
+type apiBucket struct {
+	sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	until  time.Time
+	// Set while the server announced a maintenance
+	maintenance time.Time
+}
+
+// MaintenanceError is returned without contacting the server while it announced a maintenance.
+type MaintenanceError struct {
+	Host  string
+	Until time.Time
+}
+
+// Error implements error interface.
+func (m *MaintenanceError) Error() string {
+	return fmt.Sprintf("server %s is under maintenance until %s", m.Host, m.Until.Format("15:04:05"))
+}
+
+// bucket returns the bucket for the request host, or nil if it is not a known authority.
+func (l *apiLimiter) bucket(u *url.URL) *apiBucket {
+	key := u.Scheme + "://" + u.Host
+	l.Lock()
+	defer l.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+	for _, a := range config.Default().Authorities {
+		if au, e := url.Parse(a.URI); e == nil && au.Scheme == u.Scheme && au.Host == u.Host {
+			b := &apiBucket{rate: apiRate, tokens: apiBurst, last: time.Now()}
+			l.buckets[key] = b
+			return b
+		}
+	}
+	return nil
+}
+
+// take waits until a token is available.
+func (b *apiBucket) take(ctx context.Context) error {
+	for {
+		b.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > apiBurst {
+			b.tokens = apiBurst
+		}
+		b.last = now
+		var wait time.Duration
+		if now.Before(b.until) {
+			wait = b.until.Sub(now)
+		} else if b.tokens >= 1 {
+			b.tokens--
+			b.Unlock()
+			return nil
+		} else {
+			wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		}
+		b.Unlock()
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, either in seconds or as an HTTP date.
+func parseRetryAfter(h string) time.Duration {
+	if s, e := strconv.Atoi(h); e == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, e := http.ParseTime(h); e == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return apiDefRetry
+}
+
+// ThrottledUntil returns the time until which requests to the server of an URI are held because the server
+// responded with 429 Too Many Requests. It returns a zero time if the server is not throttling.
+func ThrottledUntil(uri string) time.Time {
+	l, ok := http.DefaultTransport.(*apiLimiter)
+	if !ok {
+		return time.Time{}
+	}
+	u, e := url.Parse(uri)
+	if e != nil {
+		return time.Time{}
+	}
+	l.Lock()
+	b, ok := l.buckets[u.Scheme+"://"+u.Host]
+	l.Unlock()
+	if !ok {
+		return time.Time{}
+	}
+	b.Lock()
+	defer b.Unlock()
+	if time.Now().Before(b.until) {
+		return b.until
+	}
+	return time.Time{}
+}
+
+// MaintenanceUntil returns the time until which the server of an URI announced a maintenance, either by
+// responding with 503 Service Unavailable and a Retry-After header or through SetMaintenance. It returns a zero
+// time if the server is not under maintenance.
+func MaintenanceUntil(uri string) time.Time {
+	l, ok := http.DefaultTransport.(*apiLimiter)
+	if !ok {
+		return time.Time{}
+	}
+	u, e := url.Parse(uri)
+	if e != nil {
+		return time.Time{}
+	}
+	l.Lock()
+	b, ok := l.buckets[u.Scheme+"://"+u.Host]
+	l.Unlock()
+	if !ok {
+		return time.Time{}
+	}
+	b.Lock()
+	defer b.Unlock()
+	if time.Now().Before(b.maintenance) {
+		return b.maintenance
+	}
+	return time.Time{}
+}
+
+// SetMaintenance records a maintenance announced by the server of an URI. Requests sent to this server fail
+// with a MaintenanceError until then. A zero time clears the maintenance.
+func SetMaintenance(uri string, until time.Time) {
+	l, ok := http.DefaultTransport.(*apiLimiter)
+	if !ok {
+		return
+	}
+	u, e := url.Parse(uri)
+	if e != nil {
+		return
+	}
+	if b := l.bucket(u); b != nil {
+		b.Lock()
+		b.maintenance = until
+		b.Unlock()
+	}
+}
+
+// inMaintenance returns the end of the current maintenance, if any.
+func (b *apiBucket) inMaintenance() (time.Time, bool) {
+	b.Lock()
+	defer b.Unlock()
+	return b.maintenance, time.Now().Before(b.maintenance)
+}
+
+// throttled halves the rate and blocks requests for the given duration.
+func (b *apiBucket) throttled(retryAfter time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	b.rate /= 2
+	if b.rate < apiMinRate {
+		b.rate = apiMinRate
+	}
+	b.tokens = 0
+	b.until = time.Now().Add(retryAfter)
+}
+
+// succeeded slowly restores the rate.
+func (b *apiBucket) succeeded() {
+	b.Lock()
+	defer b.Unlock()
+	if b.rate < apiRate {
+		b.rate *= 1.02
+		if b.rate > apiRate {
+			b.rate = apiRate
+		}
+	}
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (l *apiLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := l.bucket(req.URL)
+	if b == nil {
+		return l.base.RoundTrip(req)
+	}
+	// Only requests without body can be safely replayed
+	canRetry := req.Body == nil || req.Body == http.NoBody
+	for i := 0; ; i++ {
+		if until, ok := b.inMaintenance(); ok {
+			return nil, &MaintenanceError{Host: req.URL.Host, Until: until}
+		}
+		if e := b.take(req.Context()); e != nil {
+			return nil, e
+		}
+		w := concurrencyFor("api:" + req.URL.Host)
+		if e := w.acquire(req.Context()); e != nil {
+			return nil, e
+		}
+		start := time.Now()
+		resp, e := l.base.RoundTrip(req)
+		var status int
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		w.release(start, isBackoffError(req.Context(), e, status))
+		if e == nil && status == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "" {
+			// Server announced a maintenance: stop sending requests until it is over
+			until := time.Now().Add(parseRetryAfter(resp.Header.Get("Retry-After")))
+			b.Lock()
+			b.maintenance = until
+			b.Unlock()
+			log.Logger(req.Context()).Warn("Server " + req.URL.Host + " is under maintenance until " + until.Format("15:04:05"))
+			return resp, nil
+		}
+		if e != nil || resp.StatusCode != http.StatusTooManyRequests {
+			if e == nil {
+				b.succeeded()
+			}
+			return resp, e
+		}
+		b.throttled(parseRetryAfter(resp.Header.Get("Retry-After")))
+		log.Logger(req.Context()).Warn("Server " + req.URL.Host + " is throttling requests, slowing down")
+		if !canRetry || i >= apiRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const maxVersionNameConflicts = 100
+
+var (
+	latestVersionsBucket = []byte("latest")
+	versionsBucket       = []byte("versions")
+)
+
+// VersionName builds the name under which a new version of an existing file is uploaded to an append-only
+// target, like "report (2024-05-01 10-42-07).docx". If n is greater than 1, it is appended to the suffix.
+func VersionName(p string, t time.Time, n int) string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	if name == "" {
+		name, ext = base, ""
+	}
+	suffix := t.Format("2006-01-02 15-04-05")
+	if n > 1 {
+		suffix += fmt.Sprintf(" %d", n)
+	}
+	return dir + name + " (" + suffix + ")" + ext
+}
+
+// AppendOnlyIndex records the versions uploaded to an append-only target. The target exposes the latest version
+// of each file at its original path and hides the version files, so that the sync engine sees the tree it
+// expects and does not upload the same content again.
+type AppendOnlyIndex struct {
+	db *bbolt.DB
+}
+
+// SetAppendOnly makes a remote endpoint append-only: existing files are never overwritten (new versions are
+// uploaded under a suffixed name), deletions and moves are ignored. The versions index is stored in file.
+// It returns nil if the endpoint is not remote.
+func SetAppendOnly(ep model.Endpoint, file string) (*AppendOnlyIndex, error) {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return nil, nil
+	}
+	db, e := bbolt.Open(file, 0644, BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	r.appendOnly = &AppendOnlyIndex{db: db}
+	return r.appendOnly, nil
+}
+
+// Close closes the index.
+func (a *AppendOnlyIndex) Close() {
+	a.db.Close()
+}
+
+// Latest returns the path of the latest version uploaded for a file, if any.
+func (a *AppendOnlyIndex) Latest(p string) (latest string) {
+	a.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(latestVersionsBucket); b != nil {
+			latest = string(b.Get(versionKey(p)))
+		}
+		return nil
+	})
+	return
+}
+
+// IsVersion tells if a path is a version uploaded in place of an existing file.
+func (a *AppendOnlyIndex) IsVersion(p string) (version bool) {
+	a.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(versionsBucket); b != nil {
+			version = b.Get(versionKey(p)) != nil
+		}
+		return nil
+	})
+	return
+}
+
+func (a *AppendOnlyIndex) record(p, version string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		latest, e := tx.CreateBucketIfNotExists(latestVersionsBucket)
+		if e != nil {
+			return e
+		}
+		versions, e := tx.CreateBucketIfNotExists(versionsBucket)
+		if e != nil {
+			return e
+		}
+		if e := latest.Put(versionKey(p), versionKey(version)); e != nil {
+			return e
+		}
+		return versions.Put(versionKey(version), versionKey(p))
+	})
+}
+
+func versionKey(p string) []byte {
+	return []byte(strings.Trim(p, "/"))
+}
+
+// LoadNode returns the latest version of a file on append-only targets. Nodes may come from the metadata cache.
+func (r *remoteFS) LoadNode(ctx context.Context, p string, extendedStats ...bool) (*tree.Node, error) {
+	if r.appendOnly == nil {
+		return r.loadRemote(ctx, p, extendedStats...)
+	}
+	if r.appendOnly.IsVersion(p) {
+		return nil, fmt.Errorf("cannot find node %s", p)
+	}
+	if latest := r.appendOnly.Latest(p); latest != "" {
+		if node, e := r.loadRemote(ctx, latest, extendedStats...); e == nil {
+			return asOriginal(node, p), nil
+		}
+	}
+	return r.loadRemote(ctx, p, extendedStats...)
+}
+
+// Walk hides the version files of append-only targets, and lists the latest versions at the original paths.
+// Non-recursive listings may come from the metadata cache.
+func (r *remoteFS) Walk(walknFc model.WalkNodesFunc, root string, recursive bool) error {
+	if r.appendOnly == nil {
+		return r.walkRemote(walknFc, root, recursive)
+	}
+	return r.walkRemote(func(p string, node *tree.Node, err error) {
+		if err != nil || node == nil {
+			walknFc(p, node, err)
+			return
+		}
+		if r.appendOnly.IsVersion(p) {
+			return
+		}
+		if latest := r.appendOnly.Latest(p); latest != "" {
+			if l, e := r.loadRemote(context.Background(), latest); e == nil {
+				node = asOriginal(l, node.GetPath())
+			}
+		}
+		walknFc(p, node, nil)
+	}, root, recursive)
+}
+
+// DeleteNode is ignored on append-only targets and in safe mode. With a stash, the node is moved into it instead.
+// With a recycle bin, the node is moved to the server recycle bin rather than deleted permanently. With operation
+// keys, a deletion that already reached the server is not sent again.
+func (r *remoteFS) DeleteNode(ctx context.Context, p string) error {
+	if r.safe.skip(ctx, p) {
+		return nil
+	}
+	defer r.invalidateCache(p)
+	if r.appendOnly != nil {
+		log.Logger(ctx).Info("Append-only target: ignoring deletion of " + p)
+		return nil
+	}
+	if r.stash != nil {
+		return r.stash.keep(ctx, p, StashDeleted)
+	}
+	if r.opKeys != nil {
+		return r.opKeys.apply(ctx, OperationKey("delete", p), "deletion", p, func() bool {
+			_, e := r.Remote.LoadNode(ctx, p)
+			return e != nil
+		}, func() error {
+			return r.deleteRemote(ctx, p)
+		})
+	}
+	return r.deleteRemote(ctx, p)
+}
+
+// deleteRemote sends a node to the server recycle bin if possible, or deletes it permanently.
+func (r *remoteFS) deleteRemote(ctx context.Context, p string) error {
+	if r.recycle != nil {
+		if done, e := r.recycle.delete(ctx, r.uri, p); done {
+			return e
+		}
+	}
+	return r.Remote.DeleteNode(ctx, p)
+}
+
+// MoveNode is ignored on append-only targets: the file is uploaded at its new path by the next full resync. With
+// operation keys, a move that already reached the server is not sent again.
+func (r *remoteFS) MoveNode(ctx context.Context, oldPath string, newPath string) error {
+	if r.appendOnly != nil {
+		log.Logger(ctx).Info("Append-only target: ignoring move of " + oldPath + " to " + newPath)
+		return nil
+	}
+	defer r.invalidateCache(oldPath, newPath)
+	if r.opKeys != nil {
+		return r.opKeys.apply(ctx, OperationKey("move", oldPath, newPath), "move", oldPath, func() bool {
+			if _, e := r.Remote.LoadNode(ctx, oldPath); e == nil {
+				return false
+			}
+			_, e := r.Remote.LoadNode(ctx, newPath)
+			return e == nil
+		}, func() error {
+			return r.Remote.MoveNode(ctx, oldPath, newPath)
+		})
+	}
+	return r.Remote.MoveNode(ctx, oldPath, newPath)
+}
+
+// versionTarget returns the path where a file must be written on append-only targets: a new version name if
+// the file already exists.
+func (r *remoteFS) versionTarget(ctx context.Context, p string) (string, error) {
+	if _, e := r.Remote.LoadNode(ctx, p); e != nil {
+		return p, nil
+	}
+	now := time.Now()
+	for n := 1; n <= maxVersionNameConflicts; n++ {
+		candidate := VersionName(p, now, n)
+		if _, e := r.Remote.LoadNode(ctx, candidate); e != nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find a free version name for %s", p)
+}
+
+// recordVersion registers the version once written.
+func (r *remoteFS) recordVersion(p, version string, out io.WriteCloser, writeDone chan bool) (io.WriteCloser, chan bool) {
+	if writeDone == nil || version == p {
+		return out, writeDone
+	}
+	done := make(chan bool, 1)
+	go func() {
+		defer close(done)
+		d, ok := <-writeDone
+		if !ok {
+			return
+		}
+		if e := r.appendOnly.record(p, version); e != nil {
+			log.Logger(context.Background()).Error("Cannot record version " + version + ": " + e.Error())
+		}
+		done <- d
+	}()
+	return out, done
+}
+
+// asOriginal presents a version node at the path of the original file.
+func asOriginal(version *tree.Node, p string) *tree.Node {
+	node := proto.Clone(version).(*tree.Node)
+	node.Path = p
+	return node
+}
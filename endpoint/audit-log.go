@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// MetaHash is the node metadata holding the last hash recorded in the audit log
+	MetaHash = "hash"
+
+	AuditResultSuccess    = "success"
+	AuditResultError      = "error"
+	AuditResultUnresolved = "unresolved"
+	AuditResultResolved   = "resolved"
+
+	// Audit logs of previous versions were stored as monthly JSON lines files
+	auditFilePrefix = "audit-"
+	auditFileSuffix = ".jsonl"
+)
+
+var auditCsvHeader = []string{"time", "task", "path", "from", "direction", "action", "size", "hash_before", "hash_after", "result", "error", "process", "user", "decision"}
+
+// AuditRecord describes an operation applied by a sync task.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Task       string    `json:"task"`
+	Path       string    `json:"path"`
+	From       string    `json:"from,omitempty"`
+	Direction  string    `json:"direction"`
+	Action     string    `json:"action"`
+	Size       int64     `json:"size"`
+	HashBefore string    `json:"hash_before,omitempty"`
+	HashAfter  string    `json:"hash_after,omitempty"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+	// Process and User describe the local process at the origin of an upload, when actors are tracked
+	Process string `json:"process,omitempty"`
+	User    string `json:"user,omitempty"`
+	// Decision explains how a conflict was resolved automatically, and which setting made the decision
+	Decision string `json:"decision,omitempty"`
+}
+
+// AuditLog records the operations applied by a task in its history. Records are never rewritten, only pruned
+// with the history retention.
+type AuditLog struct {
+	sync.Mutex
+	history *History
+}
+
+// NewAuditLog opens the audit log of a task history.
+func NewAuditLog(history *History) (*AuditLog, error) {
+	return &AuditLog{history: history}, nil
+}
+
+// Append stores records in the history.
+func (a *AuditLog) Append(records []*AuditRecord) error {
+	a.Lock()
+	defer a.Unlock()
+	for i, r := range records {
+		data, e := json.Marshal(r)
+		if e != nil {
+			return e
+		}
+		if e := a.history.Put(HistoryAudit, HistoryKey(r.Time, fmt.Sprintf("%04d %s", i, r.Path)), data); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// ReadAudit loads the records of the audit log of a history between from and to (zero values for no limit),
+// sorted by time.
+func ReadAudit(history HistoryBackend, from, to time.Time) (records []*AuditRecord, e error) {
+	var fromKey, toKey string
+	if !from.IsZero() {
+		fromKey = HistoryKey(from, "")
+	}
+	if !to.IsZero() {
+		toKey = HistoryKey(to.Add(time.Nanosecond), "")
+	}
+	e = history.Walk(HistoryAudit, fromKey, toKey, false, func(_ string, value []byte) bool {
+		var r AuditRecord
+		if er := json.Unmarshal(value, &r); er == nil {
+			records = append(records, &r)
+		}
+		return true
+	})
+	return
+}
+
+// ImportAuditFolder moves the records of an audit log written as monthly JSON lines files by previous versions
+// into the history. The folder is renamed once imported.
+func (a *AuditLog) ImportAuditFolder(folder string) (int, error) {
+	if _, e := os.Stat(folder); e != nil {
+		return 0, nil
+	}
+	files, e := filepath.Glob(filepath.Join(folder, auditFilePrefix+"*"+auditFileSuffix))
+	if e != nil {
+		return 0, e
+	}
+	var records []*AuditRecord
+	for _, file := range files {
+		if er := readAuditFile(file, &records); er != nil {
+			return 0, er
+		}
+	}
+	if e := a.Append(records); e != nil {
+		return 0, e
+	}
+	return len(records), os.Rename(folder, folder+".imported")
+}
+
+func readAuditFile(file string, records *[]*AuditRecord) error {
+	f, e := os.Open(file)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r AuditRecord
+		if e := json.Unmarshal(scanner.Bytes(), &r); e != nil {
+			// Skip a line truncated by a crash
+			continue
+		}
+		*records = append(*records, &r)
+	}
+	return scanner.Err()
+}
+
+// WriteAuditRecords encodes records as JSON lines or CSV.
+func WriteAuditRecords(records []*AuditRecord, format string, w io.Writer) error {
+	switch format {
+	case ExportFormatJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if e := enc.Encode(r); e != nil {
+				return e
+			}
+		}
+		return nil
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(auditCsvHeader)
+		for _, r := range records {
+			cw.Write([]string{
+				r.Time.Format(time.RFC3339), r.Task, r.Path, r.From, r.Direction, r.Action,
+				strconv.FormatInt(r.Size, 10), r.HashBefore, r.HashAfter, r.Result, r.Error, r.Process, r.User, r.Decision,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported format %s, use %s or %s", format, ExportFormatJSON, ExportFormatCSV)
+	}
+}
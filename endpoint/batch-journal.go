@@ -0,0 +1,302 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// BatchFolder is the folder of a local root keeping the nodes deleted or overwritten by the current batch, until
+// it is committed. It starts with JournalTempPrefix so that it is never synced.
+const BatchFolder = JournalTempPrefix + "batch"
+
+const (
+	batchCreate = "create"
+	batchMove   = "move"
+	batchDelete = "delete"
+	batchWrite  = "write"
+)
+
+// batchStep is an operation applied on a local endpoint, with what is needed to revert it.
+type batchStep struct {
+	Op     string
+	Id     int64
+	Path   string
+	From   string `json:",omitempty"`
+	Kept   string `json:",omitempty"`
+	Folder bool   `json:",omitempty"`
+}
+
+// BatchJournal records the operations applied on a local endpoint during a patch, so that operations that must
+// happen together are either all applied or all reverted. A folder move forms a batch with the operations applied
+// inside the folder: if one of them fails, the whole batch is rolled back at the end of the patch, instead of
+// leaving the folder moved with half of its updates. Deleted and overwritten nodes are kept in BatchFolder until
+// the patch is over. Steps are flushed to disk as they are applied: batches interrupted by a crash are rolled back
+// when the journal is opened again.
+type BatchJournal struct {
+	sync.Mutex
+	c      *localFS
+	file   string
+	f      *os.File
+	nextId int64
+	steps  []*batchStep
+	// Recovered lists the roots of the batches rolled back when opening the journal
+	Recovered []string
+}
+
+// SetBatchJournal makes the operations on a local endpoint go through a batch journal stored in journalFile.
+// Batches that were interrupted in a previous run are rolled back first. It returns nil if the endpoint is not
+// local.
+func SetBatchJournal(ep model.Endpoint, journalFile string) (*BatchJournal, error) {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return nil, nil
+	}
+	b := &BatchJournal{c: c, file: journalFile}
+	if e := b.recover(); e != nil {
+		return nil, e
+	}
+	var e error
+	if b.f, e = os.OpenFile(journalFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); e != nil {
+		return nil, e
+	}
+	c.batch = b
+	return b, nil
+}
+
+// recover reads the steps left by a previous run. As the patch did not finish, every batch is rolled back and the
+// other steps are committed.
+func (b *BatchJournal) recover() error {
+	f, e := os.Open(b.file)
+	if os.IsNotExist(e) {
+		return nil
+	} else if e != nil {
+		return e
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s batchStep
+		if json.Unmarshal(scanner.Bytes(), &s) != nil {
+			// Last line may be truncated
+			continue
+		}
+		b.steps = append(b.steps, &s)
+	}
+	f.Close()
+	var all []string
+	for _, s := range b.steps {
+		if s.Op == batchMove && s.Folder {
+			all = append(all, s.Path)
+		}
+	}
+	b.Recovered, e = b.finish(all)
+	if e != nil {
+		return e
+	}
+	// Nodes kept by steps that were not recorded: their operation was applied
+	return os.RemoveAll(b.c.abs(BatchFolder))
+}
+
+// record appends a step to the journal and flushes it to disk.
+func (b *BatchJournal) record(s *batchStep) error {
+	b.Lock()
+	defer b.Unlock()
+	if s.Id == 0 {
+		b.nextId++
+		s.Id = b.nextId
+	}
+	data, e := json.Marshal(s)
+	if e != nil {
+		return e
+	}
+	if _, e := b.f.Write(append(data, '\n')); e != nil {
+		return e
+	}
+	if e := b.f.Sync(); e != nil {
+		return e
+	}
+	b.steps = append(b.steps, s)
+	return nil
+}
+
+// keep moves the current node at p into BatchFolder and records the step. The node is restored if the step
+// cannot be recorded. A missing node is recorded without a kept copy.
+func (b *BatchJournal) keep(op string, p string) error {
+	b.Lock()
+	b.nextId++
+	s := &batchStep{Op: op, Id: b.nextId, Path: strings.Trim(p, "/")}
+	b.Unlock()
+	abs := b.c.abs(s.Path)
+	if info, e := os.Lstat(abs); e == nil {
+		s.Folder = info.IsDir()
+		s.Kept = path.Join(BatchFolder, fmt.Sprintf("%d-%s", s.Id, path.Base(s.Path)))
+		if e := os.MkdirAll(b.c.abs(BatchFolder), 0755); e != nil {
+			return e
+		}
+		if e := os.Rename(abs, b.c.abs(s.Kept)); e != nil {
+			return e
+		}
+	} else if op == batchDelete {
+		return nil
+	}
+	if e := b.record(s); e != nil {
+		if s.Kept != "" {
+			os.Rename(b.c.abs(s.Kept), abs)
+		}
+		return e
+	}
+	return nil
+}
+
+// Finish ends the batches of a patch, given the paths of its failed operations. Batches containing a failed path
+// are rolled back, other steps are committed: kept nodes go to the stash or the trash if any, or are removed. It
+// returns the folders rolled back, on both sides of their moves, whose snapshot entries can no longer be trusted.
+func (b *BatchJournal) Finish(failed []string) ([]string, error) {
+	b.Lock()
+	defer b.Unlock()
+	roots, e := b.finish(failed)
+	if er := b.f.Truncate(0); er == nil {
+		b.f.Seek(0, io.SeekStart)
+	}
+	return roots, e
+}
+
+func (b *BatchJournal) finish(failed []string) (roots []string, err error) {
+	steps := b.steps
+	b.steps = nil
+	revert := make(map[int64]bool)
+	for _, move := range steps {
+		if move.Op != batchMove || !move.Folder || !touches(failed, move.Path, move.From) {
+			continue
+		}
+		roots = append(roots, move.From, move.Path)
+		for _, s := range steps {
+			if insideAny(s.Path, move.Path, move.From) || (s.From != "" && insideAny(s.From, move.Path, move.From)) {
+				revert[s.Id] = true
+			}
+		}
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if s := steps[i]; revert[s.Id] {
+			if e := b.revert(s); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	for _, s := range steps {
+		if !revert[s.Id] && s.Kept != "" {
+			if e := b.commit(s); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return
+}
+
+// revert undoes a step.
+func (b *BatchJournal) revert(s *batchStep) error {
+	c := b.c
+	if c.hashes != nil {
+		c.hashes.Invalidate(s.Path)
+		if s.From != "" {
+			c.hashes.Invalidate(s.From)
+		}
+	}
+	var e error
+	switch s.Op {
+	case batchCreate:
+		e = os.RemoveAll(c.abs(s.Path))
+	case batchMove:
+		if e = os.MkdirAll(filepath.Dir(c.abs(s.From)), 0755); e == nil {
+			e = os.Rename(c.abs(s.Path), c.abs(s.From))
+		}
+	case batchDelete, batchWrite:
+		if s.Kept == "" {
+			// Written file did not exist before
+			e = os.Remove(c.abs(s.Path))
+		} else if e = os.MkdirAll(filepath.Dir(c.abs(s.Path)), 0755); e == nil {
+			if s.Folder {
+				os.RemoveAll(c.abs(s.Path))
+			}
+			e = os.Rename(c.abs(s.Kept), c.abs(s.Path))
+		}
+	}
+	if os.IsNotExist(e) {
+		return nil
+	}
+	return e
+}
+
+// commit disposes of the node kept by a step, as the operation would have done without a batch.
+func (b *BatchJournal) commit(s *batchStep) error {
+	c := b.c
+	kind := StashVersions
+	if s.Op == batchDelete {
+		kind = StashDeleted
+	}
+	switch {
+	case c.stash != nil:
+		return c.stash.keepFrom(context.Background(), s.Kept, s.Path, kind)
+	case c.trash != nil && s.Op == batchDelete:
+		return c.trash.putFrom(c.abs(s.Kept), s.Path)
+	default:
+		return os.RemoveAll(c.abs(s.Kept))
+	}
+}
+
+// Close closes the journal file. Batches in progress are rolled back at next start.
+func (b *BatchJournal) Close() error {
+	b.Lock()
+	defer b.Unlock()
+	return b.f.Close()
+}
+
+// touches tells if one of the paths is inside one of the roots.
+func touches(paths []string, roots ...string) bool {
+	for _, p := range paths {
+		if insideAny(p, roots...) {
+			return true
+		}
+	}
+	return false
+}
+
+// insideAny tells if p is one of the roots or inside one of them.
+func insideAny(p string, roots ...string) bool {
+	p = strings.Trim(p, "/")
+	for _, r := range roots {
+		r = strings.Trim(r, "/")
+		if r != "" && (p == r || strings.HasPrefix(p, r+"/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// BoltOptions returns the options used to open the local databases, depending on the configured storage
+// backend. In compact mode, the freelist is not persisted and pages are not pre-loaded in memory, which keeps
+// files and their memory maps smaller.
+func BoltOptions(timeout time.Duration) *bbolt.Options {
+	options := *bbolt.DefaultOptions
+	options.Timeout = timeout
+	if StorageCompact() {
+		options.NoFreelistSync = true
+		options.MmapFlags = 0
+	}
+	return &options
+}
+
+// StorageCompact returns true if the local databases use the compact storage mode.
+func StorageCompact() bool {
+	s := config.Default().Storage
+	if s == nil {
+		s = config.NewStorage()
+	}
+	return s.ResolvedBackend() == config.StorageBoltCompact
+}
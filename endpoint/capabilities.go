@@ -0,0 +1,225 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+)
+
+var capabilitiesBucket = []byte("capabilities")
+
+// LoadCapabilities returns the capabilities of an endpoint from the cache stored in the task folder, or probes
+// them if they are unknown or if the endpoint version has changed.
+func LoadCapabilities(folderPath string, uri string) (*common.Capabilities, error) {
+	version := endpointVersion(uri)
+	db, e := bbolt.Open(filepath.Join(folderPath, "capabilities"), 0644, BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	defer db.Close()
+	var cached *common.Capabilities
+	db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(capabilitiesBucket); b != nil {
+			if data := b.Get([]byte(uri)); data != nil {
+				var c common.Capabilities
+				if json.Unmarshal(data, &c) == nil {
+					cached = &c
+				}
+			}
+		}
+		return nil
+	})
+	if cached != nil && cached.Version == version {
+		return cached, nil
+	}
+	caps, e := probeCapabilities(uri)
+	if e != nil {
+		return nil, e
+	}
+	caps.Version = version
+	caps.ProbedAt = time.Now()
+	data, _ := json.Marshal(caps)
+	e = db.Update(func(tx *bbolt.Tx) error {
+		b, er := tx.CreateBucketIfNotExists(capabilitiesBucket)
+		if er != nil {
+			return er
+		}
+		return b.Put([]byte(uri), data)
+	})
+	return caps, e
+}
+
+// endpointVersion returns the version of the software serving an endpoint.
+func endpointVersion(uri string) string {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return ""
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		for _, a := range config.Default().Authorities {
+			if a.MatchesURI(uri) {
+				if v := serverVersion(a); v != "" {
+					return v
+				}
+			}
+		}
+	}
+	return "cells-sync/" + common.Version + "/" + runtime.GOOS
+}
+
+// serverVersion reads the version advertised by a Cells server.
+func serverVersion(a *config.Authority) string {
+	req, e := a.NewAuthenticatedRequest("GET", "/a/frontend/bootconf", nil)
+	if e != nil {
+		return ""
+	}
+	resp, e := a.Do(req)
+	if e != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	var conf struct {
+		AjxpVersion string `json:"ajxpVersion"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&conf) != nil || conf.AjxpVersion == "" {
+		return ""
+	}
+	return "cells/" + conf.AjxpVersion
+}
+
+// CheckMaintenance reads the maintenance flag advertised by the Cells server of an URI and records it, so that
+// requests are held until the announced end. Servers that do not announce an end are checked again after
+// five minutes. It returns the end of the maintenance, or a zero time.
+func CheckMaintenance(uri string) time.Time {
+	for _, a := range config.Default().Authorities {
+		if !a.MatchesURI(uri) {
+			continue
+		}
+		req, e := a.NewAuthenticatedRequest("GET", "/a/frontend/bootconf", nil)
+		if e != nil {
+			return time.Time{}
+		}
+		resp, e := a.Do(req)
+		if e != nil {
+			// Requests are refused while a maintenance is already known
+			return MaintenanceUntil(uri)
+		}
+		defer resp.Body.Close()
+		var conf struct {
+			Maintenance    bool  `json:"maintenance"`
+			MaintenanceEnd int64 `json:"maintenanceEnd"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&conf) != nil || !conf.Maintenance {
+			return MaintenanceUntil(uri)
+		}
+		until := time.Now().Add(5 * time.Minute)
+		if conf.MaintenanceEnd > 0 {
+			until = time.Unix(conf.MaintenanceEnd, 0)
+		}
+		SetMaintenance(uri, until)
+		return until
+	}
+	return time.Time{}
+}
+
+func probeCapabilities(uri string) (*common.Capabilities, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return nil, e
+	}
+	switch u.Scheme {
+	case "fs":
+		root, ok := LocalPathForURI(uri)
+		if !ok {
+			return nil, fmt.Errorf("cannot find local path for %s", uri)
+		}
+		return probeLocalCapabilities(root)
+	case "http", "https":
+		// Cells servers use MD5 etags, store modification times in seconds, and support ranged reads and multipart
+		// uploads on the gateway
+		caps := &common.Capabilities{HashAlgorithm: "md5", MTimePrecision: time.Second, RangedReads: true, CaseSensitive: true, Transfers: []string{TransferMultipart, TransferRanged, TransferStream}}
+		// Servers or gateways may also serve the tus.io resumable upload protocol, preferred when available
+		if caps.TusPath, caps.TusChecksum = probeTus(uri); caps.TusPath != "" {
+			caps.Transfers = append([]string{TransferTus}, caps.Transfers...)
+		}
+		return caps, nil
+	case "s3":
+		return &common.Capabilities{HashAlgorithm: "md5", MTimePrecision: time.Second, RangedReads: true, CaseSensitive: true}, nil
+	default:
+		return &common.Capabilities{HashAlgorithm: "md5", MTimePrecision: time.Nanosecond, CaseSensitive: true}, nil
+	}
+}
+
+// ProbeLocalCapabilities detects the capabilities of a local folder without caching them.
+func ProbeLocalCapabilities(root string) (*common.Capabilities, error) {
+	return probeLocalCapabilities(root)
+}
+
+// probeLocalCapabilities creates a temporary file in the root folder to detect case sensitivity and mtime precision.
+func probeLocalCapabilities(root string) (*common.Capabilities, error) {
+	caps := &common.Capabilities{HashAlgorithm: "md5", RangedReads: true}
+	if IsReadOnlyFolder(root) {
+		// Nothing can be probed, assume platform defaults
+		caps.CaseSensitive = runtime.GOOS == "linux"
+		caps.MTimePrecision = time.Second
+		return caps, nil
+	}
+	f, e := ioutil.TempFile(root, ".cells-sync-probe-")
+	if e != nil {
+		return nil, e
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	base := filepath.Base(name)
+	if _, e := os.Stat(filepath.Join(root, strings.ToUpper(base))); e != nil {
+		caps.CaseSensitive = true
+	}
+
+	probe := time.Date(2019, 1, 1, 0, 0, 1, 123456789, time.UTC)
+	if e := os.Chtimes(name, probe, probe); e != nil {
+		return nil, e
+	}
+	info, e := os.Stat(name)
+	if e != nil {
+		return nil, e
+	}
+	for _, precision := range []time.Duration{time.Nanosecond, 100 * time.Nanosecond, time.Microsecond, time.Millisecond, time.Second, 2 * time.Second} {
+		if info.ModTime().Equal(probe.Truncate(precision)) {
+			caps.MTimePrecision = precision
+			break
+		}
+	}
+	return caps, nil
+}
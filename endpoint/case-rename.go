@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// isCaseInsensitive checks if a local folder is on a case-insensitive filesystem, by looking up its own name with
+// a different case. It falls back to the platform default if the name has no letters.
+func isCaseInsensitive(root string) bool {
+	base := filepath.Base(root)
+	swapped := strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, base)
+	if swapped == base {
+		return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+	}
+	info, e := os.Stat(root)
+	if e != nil {
+		return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+	}
+	other, e := os.Stat(filepath.Join(filepath.Dir(root), swapped))
+	return e == nil && os.SameFile(info, other)
+}
+
+// exactCase checks that the last component of a path exists with this exact case. On case-insensitive
+// filesystems, a file renamed with a different case is still found under its old name, so the rename would be lost.
+func (c *localFS) exactCase(p string) bool {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return true
+	}
+	dir, e := os.Open(filepath.Dir(c.abs(p)))
+	if e != nil {
+		return true
+	}
+	names, e := dir.Readdirnames(-1)
+	dir.Close()
+	if e != nil {
+		return true
+	}
+	base := path.Base(p)
+	for _, n := range names {
+		if n == base {
+			return true
+		}
+	}
+	return false
+}
+
+// isCaseRename checks if a move only changes the case of a path.
+func isCaseRename(oldPath, newPath string) bool {
+	return oldPath != newPath && strings.EqualFold(oldPath, newPath)
+}
+
+// caseRename renames a path to a different case through a temporary name, as renaming directly is ignored or fails
+// on some case-insensitive filesystems.
+func (c *localFS) caseRename(ctx context.Context, oldPath, newPath string) error {
+	temp := path.Join(path.Dir(newPath), JournalTempPrefix+"case-"+time.Now().Format("150405.000")+"-"+path.Base(newPath))
+	c.expect(temp)
+	if c.expected != nil {
+		c.expected.expectDeleted(temp)
+	}
+	if e := os.Rename(c.abs(oldPath), c.abs(temp)); e != nil {
+		return e
+	}
+	if e := os.Rename(c.abs(temp), c.abs(newPath)); e != nil {
+		// Restore the original name
+		os.Rename(c.abs(temp), c.abs(oldPath))
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var errCloneUnsupported = errors.New("copy-on-write clones are not supported on this platform")
+
+// CloneFile duplicates a local file. On filesystems supporting copy-on-write (APFS, Btrfs, XFS, ReFS), the copy
+// shares the blocks of the original and is nearly free, whatever the size. Other filesystems fall back to a
+// plain copy of the contents.
+func CloneFile(from, to string) error {
+	if cloneFile(from, to) == nil {
+		return nil
+	}
+	os.Remove(to)
+	src, e := os.Open(from)
+	if e != nil {
+		return e
+	}
+	defer src.Close()
+	info, e := src.Stat()
+	if e != nil {
+		return e
+	}
+	dst, e := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if e != nil {
+		return e
+	}
+	if _, e := io.Copy(dst, src); e != nil {
+		dst.Close()
+		os.Remove(to)
+		return e
+	}
+	return dst.Close()
+}
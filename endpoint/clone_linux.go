@@ -0,0 +1,51 @@
+// +build linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, supported by Btrfs and XFS (reflink).
+const ficlone = 0x40049409
+
+func cloneFile(from, to string) error {
+	src, e := os.Open(from)
+	if e != nil {
+		return e
+	}
+	defer src.Close()
+	info, e := src.Stat()
+	if e != nil {
+		return e
+	}
+	dst, e := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if e != nil {
+		return e
+	}
+	defer dst.Close()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd()); errno != 0 {
+		return errno
+	}
+	return nil
+}
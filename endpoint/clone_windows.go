@@ -0,0 +1,99 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// fsctlDuplicateExtentsToFile clones a range of a file, supported by ReFS volumes.
+const fsctlDuplicateExtentsToFile = 0x00098344
+
+type duplicateExtentsData struct {
+	FileHandle       syscall.Handle
+	SourceFileOffset int64
+	TargetFileOffset int64
+	ByteCount        int64
+}
+
+func cloneFile(from, to string) error {
+	src, e := os.Open(from)
+	if e != nil {
+		return e
+	}
+	defer src.Close()
+	info, e := src.Stat()
+	if e != nil {
+		return e
+	}
+	cluster, e := clusterSize(from)
+	if e != nil {
+		return e
+	}
+	dst, e := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if e != nil {
+		return e
+	}
+	defer dst.Close()
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+	if e := dst.Truncate(size); e != nil {
+		return e
+	}
+	// Cloned ranges must be aligned on the cluster size, the last one may go past the end of file
+	data := duplicateExtentsData{
+		FileHandle: syscall.Handle(src.Fd()),
+		ByteCount:  (size + cluster - 1) / cluster * cluster,
+	}
+	var returned uint32
+	return syscall.DeviceIoControl(syscall.Handle(dst.Fd()), fsctlDuplicateExtentsToFile, (*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), nil, 0, &returned, nil)
+}
+
+// clusterSize reads the cluster size of the volume containing a file.
+func clusterSize(p string) (int64, error) {
+	abs, e := filepath.Abs(p)
+	if e != nil {
+		return 0, e
+	}
+	h, e := syscall.LoadDLL("kernel32.dll")
+	if e != nil {
+		return 0, e
+	}
+	c, e := h.FindProc("GetDiskFreeSpaceW")
+	if e != nil {
+		return 0, e
+	}
+	root, e := syscall.UTF16PtrFromString(filepath.VolumeName(abs) + `\`)
+	if e != nil {
+		return 0, e
+	}
+	var sectorsPerCluster, bytesPerSector, freeClusters, totalClusters uint32
+	if r, _, err := c.Call(uintptr(unsafe.Pointer(root)), uintptr(unsafe.Pointer(&sectorsPerCluster)), uintptr(unsafe.Pointer(&bytesPerSector)), uintptr(unsafe.Pointer(&freeClusters)), uintptr(unsafe.Pointer(&totalClusters))); r == 0 {
+		return 0, err
+	}
+	return int64(sectorsPerCluster) * int64(bytesPerSector), nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// cloudFolderNames maps folder names created by other sync clients to their product name.
+var cloudFolderNames = map[string]string{
+	"onedrive":         "OneDrive",
+	"dropbox":          "Dropbox",
+	"google drive":     "Google Drive",
+	"icloud drive":     "iCloud Drive",
+	"iclouddrive":      "iCloud Drive",
+	"mobile documents": "iCloud Drive",
+}
+
+// CloudFolderRoots returns the folders managed by other sync clients on this computer, mapped to the product name.
+// They are read from the clients configurations or from their default locations on the current OS.
+func CloudFolderRoots() map[string]string {
+	roots := make(map[string]string)
+	u, e := user.Current()
+	if e != nil {
+		return roots
+	}
+	home := u.HomeDir
+	add := func(p, provider string) {
+		if p == "" {
+			return
+		}
+		if st, e := os.Stat(p); e == nil && st.IsDir() {
+			roots[filepath.Clean(p)] = provider
+		}
+	}
+	// Dropbox publishes its folders in info.json
+	infoFiles := []string{filepath.Join(home, ".dropbox", "info.json")}
+	switch runtime.GOOS {
+	case "windows":
+		infoFiles = append(infoFiles, filepath.Join(os.Getenv("APPDATA"), "Dropbox", "info.json"), filepath.Join(os.Getenv("LOCALAPPDATA"), "Dropbox", "info.json"))
+		for _, env := range []string{"OneDrive", "OneDriveConsumer", "OneDriveCommercial"} {
+			add(os.Getenv(env), "OneDrive")
+		}
+		add(filepath.Join(home, "iCloudDrive"), "iCloud Drive")
+	case "darwin":
+		add(filepath.Join(home, "Library", "Mobile Documents", "com~apple~CloudDocs"), "iCloud Drive")
+		// File provider based clients all live under ~/Library/CloudStorage
+		if entries, e := ioutil.ReadDir(filepath.Join(home, "Library", "CloudStorage")); e == nil {
+			for _, entry := range entries {
+				if p := CloudProviderFor(entry.Name()); p != "" {
+					add(filepath.Join(home, "Library", "CloudStorage", entry.Name()), p)
+				}
+			}
+		}
+		add(filepath.Join(home, "OneDrive"), "OneDrive")
+	default:
+		add(filepath.Join(home, "OneDrive"), "OneDrive")
+	}
+	for _, f := range infoFiles {
+		data, e := ioutil.ReadFile(f)
+		if e != nil {
+			continue
+		}
+		var info map[string]struct {
+			Path string `json:"path"`
+		}
+		if json.Unmarshal(data, &info) == nil {
+			for _, account := range info {
+				add(account.Path, "Dropbox")
+			}
+		}
+	}
+	add(filepath.Join(home, "Dropbox"), "Dropbox")
+	return roots
+}
+
+// CloudProviderFor returns the name of the cloud storage product managing the folder, or an empty string. Known
+// roots are checked first, then the folder and its parents are matched against the names used by sync clients.
+func CloudProviderFor(folder string) string {
+	clean := filepath.Clean(folder)
+	if filepath.IsAbs(clean) {
+		for root, provider := range CloudFolderRoots() {
+			if clean == root || strings.HasPrefix(clean, root+string(filepath.Separator)) {
+				return provider
+			}
+		}
+	}
+	for _, part := range strings.Split(filepath.ToSlash(clean), "/") {
+		name := strings.ToLower(part)
+		if p, ok := cloudFolderNames[name]; ok {
+			return p
+		}
+		// Business accounts are named "OneDrive - Company", "Dropbox (Company)", or "OneDrive-Company" and
+		// "GoogleDrive-account" under macOS CloudStorage
+		switch {
+		case strings.HasPrefix(name, "onedrive"):
+			return "OneDrive"
+		case strings.HasPrefix(name, "dropbox"):
+			return "Dropbox"
+		case strings.HasPrefix(name, "googledrive") || strings.HasPrefix(name, "google drive"):
+			return "Google Drive"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ConflictCopyName builds the name of the copy kept on conflict, like "report (conflict MacBook-Pro 2024-05-01).docx".
+// If n is greater than 1, it is appended to the suffix to avoid collisions with an existing copy.
+func ConflictCopyName(p string, device string, t time.Time, n int) string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	if name == "" {
+		// Dot files like ".profile" have no extension
+		name, ext = base, ""
+	}
+	device = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(device))
+	suffix := "conflict " + t.Format("2006-01-02")
+	if device != "" {
+		suffix = fmt.Sprintf("conflict %s %s", device, t.Format("2006-01-02"))
+	}
+	if n > 1 {
+		suffix += fmt.Sprintf(" %d", n)
+	}
+	return dir + name + " (" + suffix + ")" + ext
+}
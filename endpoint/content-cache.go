@@ -0,0 +1,237 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// contentKeyRegexp restricts the etags used as file names in the content cache.
+var contentKeyRegexp = regexp.MustCompile(`^[0-9a-zA-Z-]+$`)
+
+type contentEntry struct {
+	key  string
+	size int64
+}
+
+// ContentCache keeps the contents of the files recently read on a remote endpoint in a local folder, keyed by
+// their etag, so that reading them again (verifications, conflict copies, repeated downloads) does not hit the
+// server. The total size of the folder is bounded: least recently used files are evicted first.
+type ContentCache struct {
+	sync.Mutex
+	dir     string
+	max     int64
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// ContentCacheDir returns the folder of the content cache of a task.
+func ContentCacheDir(configPath string) string {
+	return filepath.Join(configPath, "content-cache")
+}
+
+// OpenContentCache opens or creates the content cache of a task, holding at most maxBytes. Files found in the
+// folder are registered from the oldest to the most recently used, and partial files left by a crash are removed.
+func OpenContentCache(configPath string, maxBytes int64) (*ContentCache, error) {
+	dir := ContentCacheDir(configPath)
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return nil, e
+	}
+	c := &ContentCache{dir: dir, max: maxBytes, entries: make(map[string]*list.Element), lru: list.New()}
+	infos, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return nil, e
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if !contentKeyRegexp.MatchString(info.Name()) {
+			os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+		c.entries[info.Name()] = c.lru.PushFront(&contentEntry{key: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+	c.Lock()
+	c.evict()
+	c.Unlock()
+	return c, nil
+}
+
+// SetContentCache registers a content cache on a remote endpoint. It returns false if the endpoint is not remote.
+func SetContentCache(ep model.Endpoint, cache *ContentCache) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.contents = cache
+	return true
+}
+
+// Size returns the current size of the cached contents.
+func (c *ContentCache) Size() int64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.size
+}
+
+// Purge removes all cached contents.
+func (c *ContentCache) Purge() error {
+	c.Lock()
+	defer c.Unlock()
+	for k := range c.entries {
+		if e := os.Remove(filepath.Join(c.dir, k)); e != nil && !os.IsNotExist(e) {
+			return e
+		}
+	}
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return nil
+}
+
+// cacheable checks if the contents of a file can be cached: its etag must be final, and the file must not take
+// more than half of the cache.
+func (c *ContentCache) cacheable(etag string, size int64) bool {
+	return etag != common.NodeFlagEtagTemporary && contentKeyRegexp.MatchString(etag) && size > 0 && size <= c.max/2
+}
+
+// open returns a reader on the cached contents of a file, and marks it as recently used.
+func (c *ContentCache) open(etag string, size int64) (io.ReadCloser, bool) {
+	if !c.cacheable(etag, size) {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[etag]
+	if !ok || el.Value.(*contentEntry).size != size {
+		return nil, false
+	}
+	name := filepath.Join(c.dir, etag)
+	f, e := os.Open(name)
+	if e != nil {
+		c.remove(el)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(name, now, now)
+	c.lru.MoveToFront(el)
+	return f, true
+}
+
+// readThrough copies the contents read from reader into the cache. The file is only added to the cache once it
+// was entirely read without error.
+func (c *ContentCache) readThrough(etag string, size int64, reader io.ReadCloser) io.ReadCloser {
+	if !c.cacheable(etag, size) {
+		return reader
+	}
+	tmp, e := ioutil.TempFile(c.dir, etag+".part-")
+	if e != nil {
+		return reader
+	}
+	return &cachingReader{ReadCloser: reader, cache: c, etag: etag, size: size, tmp: tmp}
+}
+
+// commit moves a fully read file into the cache, and evicts older files if needed.
+func (c *ContentCache) commit(etag, tmpName string, size int64) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[etag]; ok {
+		c.remove(el)
+	}
+	if e := os.Rename(tmpName, filepath.Join(c.dir, etag)); e != nil {
+		os.Remove(tmpName)
+		return
+	}
+	c.entries[etag] = c.lru.PushFront(&contentEntry{key: etag, size: size})
+	c.size += size
+	c.evict()
+}
+
+// evict removes the least recently used files until the cache fits in its maximum size.
+func (c *ContentCache) evict() {
+	for c.size > c.max {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+// remove drops one file from the cache.
+func (c *ContentCache) remove(el *list.Element) {
+	entry := el.Value.(*contentEntry)
+	os.Remove(filepath.Join(c.dir, entry.key))
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// cachingReader writes the contents it reads to a temporary file, committed to the cache on Close.
+type cachingReader struct {
+	io.ReadCloser
+	cache  *ContentCache
+	etag   string
+	size   int64
+	tmp    *os.File
+	read   int64
+	failed bool
+}
+
+// Read implements io.Reader.
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, e := r.ReadCloser.Read(p)
+	if n > 0 && !r.failed {
+		if _, we := r.tmp.Write(p[:n]); we != nil {
+			r.failed = true
+		}
+		r.read += int64(n)
+	}
+	if e != nil && e != io.EOF {
+		r.failed = true
+	}
+	return n, e
+}
+
+// Close implements io.Closer.
+func (r *cachingReader) Close() error {
+	e := r.ReadCloser.Close()
+	name := r.tmp.Name()
+	if ce := r.tmp.Close(); ce != nil || r.failed || e != nil || r.read != r.size {
+		os.Remove(name)
+		return e
+	}
+	r.cache.commit(r.etag, name, r.size)
+	return e
+}
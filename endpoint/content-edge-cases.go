@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/proto/tree"
+)
+
+const (
+	// EmptyEtag is the MD5 of an empty content
+	EmptyEtag = "d41d8cd98f00b204e9800998ecf8427e"
+	// MTimeGranularity is the coarsest modification time resolution of the supported filesystems (FAT)
+	MTimeGranularity = 2 * time.Second
+	// MaxBOMCompareSize is the size above which files are not compared for BOM-only differences
+	MaxBOMCompareSize = 10 * 1024 * 1024
+)
+
+// Byte order marks, longest first as the UTF-32 LE mark starts with the UTF-16 LE one
+var byteOrderMarks = []struct {
+	encoding string
+	mark     []byte
+}{
+	{"utf-32le", []byte{0xFF, 0xFE, 0x00, 0x00}},
+	{"utf-32be", []byte{0x00, 0x00, 0xFE, 0xFF}},
+	{"utf-8", []byte{0xEF, 0xBB, 0xBF}},
+	{"utf-16le", []byte{0xFF, 0xFE}},
+	{"utf-16be", []byte{0xFE, 0xFF}},
+}
+
+// NormalizeEmptyFile sets the etag of an empty file to the MD5 of an empty content. Servers do not always compute
+// a hash for zero-byte files: without it they would be compared as different from their local copy after each
+// transfer, and sent again endlessly.
+func NormalizeEmptyFile(node *tree.Node) {
+	if node == nil || !node.IsLeaf() || node.GetSize() != 0 {
+		return
+	}
+	if strings.Trim(node.GetEtag(), "\"") != EmptyEtag {
+		node.Etag = EmptyEtag
+	}
+}
+
+// StripBOM removes the byte order mark at the beginning of data, and returns the encoding it announced.
+func StripBOM(data []byte) ([]byte, string) {
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(data, b.mark) {
+			return data[len(b.mark):], b.encoding
+		}
+	}
+	return data, ""
+}
+
+// BOMOnlyChange checks if two contents only differ by their byte order mark, e.g. when an editor adds or removes
+// the UTF-8 BOM of a file without changing its text.
+func BOMOnlyChange(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return false
+	}
+	strippedA, encA := StripBOM(a)
+	strippedB, encB := StripBOM(b)
+	if encA == encB {
+		return false
+	}
+	return bytes.Equal(strippedA, strippedB)
+}
+
+// RacyHash checks if a hash recorded at a given time may be stale although the file size and modification time
+// did not change since: a file written again within the modification time resolution keeps the same time. Such
+// hashes must be computed again, so that a content changed with the same size is not skipped.
+func RacyHash(mtime, recorded time.Time) bool {
+	return !recorded.IsZero() && !mtime.Add(MTimeGranularity).Before(recorded)
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// maxDebounced is the number of pending events that forces a flush, even if the folder is still busy.
+const maxDebounced = 5000
+
+// SetDebounce holds local filesystem events until the root has been quiet for the given duration. Files that
+// changed during a read must stay quiet as long before being read again. It returns false if the endpoint is not
+// a local folder.
+func SetDebounce(ep model.Endpoint, quiet time.Duration) bool {
+	if l, ok := ep.(*localFS); ok {
+		l.debounce = quiet
+		if l.hot != nil && quiet > l.hot.delay {
+			l.hot.delay = quiet
+		}
+		return true
+	}
+	return false
+}
+
+// DebounceEvents returns a copy of the watch object whose events are forwarded in batches, once no new event
+// was received for the quiet duration.
+func DebounceEvents(main *model.WatchObject, quiet time.Duration) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		var pending []model.EventInfo
+		timer := config.GetClock().NewTimer(quiet)
+		timer.Stop()
+		defer timer.Stop()
+		flush := func() bool {
+			for _, ev := range pending {
+				select {
+				case out.EventInfoChan <- ev:
+				case <-main.Done():
+					return false
+				}
+			}
+			pending = nil
+			return true
+		}
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					flush()
+					close(out.EventInfoChan)
+					return
+				}
+				pending = append(pending, ev)
+				if len(pending) >= maxDebounced {
+					if !flush() {
+						return
+					}
+					continue
+				}
+				timer.Reset(quiet)
+			case <-timer.C():
+				if !flush() {
+					return
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FolderCells is a folder named after the workspace under ~/Cells
+	FolderCells = "cells"
+	// FolderDocuments is a folder named after the workspace in the user documents
+	FolderDocuments = "documents"
+	// FolderPictures is a folder named after the workspace in the user pictures
+	FolderPictures = "pictures"
+)
+
+var (
+	picturesWorkspace  = regexp.MustCompile(`(?i)(photo|picture|image|pics|camera|bilder|fotos|immagini|imágenes|imagens)`)
+	documentsWorkspace = regexp.MustCompile(`(?i)^(personal|my)[-_ ]?(files|documents)$|(document|dokument)`)
+)
+
+// FolderSuggestion is a local folder proposed as the root of a new task.
+type FolderSuggestion struct {
+	Kind string
+	// Path is the native path of the folder
+	Path string
+	// URIPath is the path of the folder in an "fs" endpoint URI
+	URIPath string
+	Exists  bool
+}
+
+// SuggestFolders proposes local roots for a task syncing the workspace of a server URI (empty if not chosen yet).
+// Workspaces of pictures are suggested in the user pictures folder and workspaces of documents in the user
+// documents folder, as localized by the OS. Other workspaces go to ~/Cells/<workspace>. The best suggestion comes
+// first, followed by the other ones.
+func SuggestFolders(serverURI string) []*FolderSuggestion {
+	u, e := user.Current()
+	if e != nil {
+		return nil
+	}
+	workspace := workspaceFolderName(serverURI)
+	candidates := map[string]string{
+		FolderCells:     filepath.Join(u.HomeDir, "Cells"),
+		FolderDocuments: userFolder(u.HomeDir, FolderDocuments),
+		FolderPictures:  userFolder(u.HomeDir, FolderPictures),
+	}
+	order := []string{FolderCells, FolderDocuments, FolderPictures}
+	switch {
+	case workspace == "":
+	case picturesWorkspace.MatchString(workspace):
+		order = []string{FolderPictures, FolderCells, FolderDocuments}
+	case documentsWorkspace.MatchString(workspace):
+		order = []string{FolderDocuments, FolderCells, FolderPictures}
+	}
+	var suggestions []*FolderSuggestion
+	for _, kind := range order {
+		p := candidates[kind]
+		if p == "" {
+			continue
+		}
+		if workspace != "" {
+			p = filepath.Join(p, workspace)
+		}
+		suggestions = append(suggestions, SuggestedFolder(kind, p))
+	}
+	return suggestions
+}
+
+// SuggestedFolder builds the suggestion for a native path.
+func SuggestedFolder(kind, p string) *FolderSuggestion {
+	s := &FolderSuggestion{Kind: kind, Path: p, URIPath: uriPath(p)}
+	if st, e := os.Stat(p); e == nil && st.IsDir() {
+		s.Exists = true
+	}
+	return s
+}
+
+// CreateSuggestedFolder creates a suggested folder and its missing parents, only accessible to the current user.
+func CreateSuggestedFolder(p string) error {
+	return os.MkdirAll(p, 0700)
+}
+
+// workspaceFolderName returns the workspace segment of a server URI, usable as a folder name.
+func workspaceFolderName(serverURI string) string {
+	u, e := url.Parse(serverURI)
+	if e != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	workspace := strings.Split(strings.Trim(u.Path, "/"), "/")[0]
+	if workspace == "" || strings.Contains(workspace, "{") {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, workspace)
+}
+
+// uriPath converts a native path to the path of an "fs" endpoint URI, e.g. /C:/Users/name on Windows.
+func uriPath(p string) string {
+	s := filepath.ToSlash(p)
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + s
+	}
+	return s
+}
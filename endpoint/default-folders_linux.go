@@ -0,0 +1,59 @@
+// +build linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userFolder reads the localized user folders from the XDG user-dirs configuration, falling back to the English
+// names under home.
+func userFolder(home, kind string) string {
+	key, fallback := "XDG_DOCUMENTS_DIR", "Documents"
+	if kind == FolderPictures {
+		key, fallback = "XDG_PICTURES_DIR", "Pictures"
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	if f, e := os.Open(filepath.Join(configHome, "user-dirs.dirs")); e == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, key+"=") {
+				continue
+			}
+			value := strings.Trim(strings.TrimPrefix(line, key+"="), `"`)
+			value = strings.Replace(value, "$HOME", home, 1)
+			// Folders set to the home itself are disabled
+			if filepath.IsAbs(value) && filepath.Clean(value) != filepath.Clean(home) {
+				return value
+			}
+		}
+	}
+	return filepath.Join(home, fallback)
+}
@@ -0,0 +1,33 @@
+// +build !linux,!windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import "path/filepath"
+
+// userFolder returns the user folders under home: macOS keeps English names on disk and only localizes their
+// display names.
+func userFolder(home, kind string) string {
+	if kind == FolderPictures {
+		return filepath.Join(home, "Pictures")
+	}
+	return filepath.Join(home, "Documents")
+}
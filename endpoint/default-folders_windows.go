@@ -0,0 +1,40 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// userFolder asks the shell for the known folders, which may be localized or redirected to a network share.
+func userFolder(home, kind string) string {
+	id, fallback := windows.FOLDERID_Documents, "Documents"
+	if kind == FolderPictures {
+		id, fallback = windows.FOLDERID_Pictures, "Pictures"
+	}
+	if p, e := windows.KnownFolderPath(id, windows.KF_FLAG_DEFAULT); e == nil && p != "" {
+		return p
+	}
+	return filepath.Join(home, fallback)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// diskSpaceRefresh is the maximum age of the free space measure. In between, the space taken by accepted writes is
+// deduced from it.
+const diskSpaceRefresh = 5 * time.Second
+
+// LowDiskSpaceError is returned instead of writing a file that would leave less free space than allowed on the
+// local volume. The file is downloaded once space is freed.
+type LowDiskSpaceError struct {
+	Path string
+	Free uint64
+	Min  uint64
+}
+
+func (l *LowDiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough free space to download %s (%d MB free, %d MB reserved)", l.Path, l.Free/1024/1024, l.Min/1024/1024)
+}
+
+// diskSpaceGuard refuses writes that would bring the free space of the local volume below a minimum.
+type diskSpaceGuard struct {
+	sync.Mutex
+	min     func() uint64
+	free    uint64
+	checked time.Time
+}
+
+// SetDiskSpaceGuard makes a local endpoint refuse downloads that would leave less than min() bytes free on its
+// volume. It returns false if the endpoint is not local.
+func SetDiskSpaceGuard(ep model.Endpoint, min func() uint64) bool {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return false
+	}
+	c.space = &diskSpaceGuard{min: min}
+	return true
+}
+
+// reserve checks that a file of the given size can be written, and deduces it from the known free space.
+func (g *diskSpaceGuard) reserve(root, p string, size int64) error {
+	min := g.min()
+	if min == 0 {
+		return nil
+	}
+	g.Lock()
+	defer g.Unlock()
+	if time.Since(g.checked) > diskSpaceRefresh {
+		free, e := FreeSpace(root)
+		if e != nil {
+			// Free space cannot be measured on this volume, do not block
+			return nil
+		}
+		g.free, g.checked = free, time.Now()
+	}
+	if size < 0 {
+		size = 0
+	}
+	if g.free < min+uint64(size) {
+		return &LowDiskSpaceError{Path: p, Free: g.free, Min: min}
+	}
+	g.free -= uint64(size)
+	return nil
+}
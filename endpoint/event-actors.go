@@ -0,0 +1,152 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// MetaActorProcess is the event metadata holding the name of the process that changed a local file
+	MetaActorProcess = "actor-process"
+	// MetaActorPid is the event metadata holding the id of the process that changed a local file
+	MetaActorPid = "actor-pid"
+	// MetaActorUser is the event metadata holding the OS user running the process that changed a local file
+	MetaActorUser = "actor-user"
+
+	actorsTTL = 10 * time.Minute
+)
+
+// ErrActorsUnsupported is returned when the platform does not report the process at the origin of file changes.
+var ErrActorsUnsupported = errors.New("tracking the processes changing files is not supported on this platform")
+
+// Actor is the process at the origin of a local change.
+type Actor struct {
+	Pid     int
+	Process string
+	User    string
+	Time    time.Time
+}
+
+// actorTracker keeps the last actor seen on each path for a while, as reported by the platform.
+type actorTracker struct {
+	sync.Mutex
+	actors map[string]*Actor
+	stop   func()
+}
+
+func (t *actorTracker) record(p string, a *Actor) {
+	t.Lock()
+	defer t.Unlock()
+	t.actors[strings.Trim(p, "/")] = a
+	if len(t.actors) > 10000 {
+		t.expire()
+	}
+}
+
+// lookup finds the last actor of a path, if it was seen recently.
+func (t *actorTracker) lookup(p string) *Actor {
+	t.Lock()
+	defer t.Unlock()
+	if a, ok := t.actors[strings.Trim(p, "/")]; ok && time.Since(a.Time) < actorsTTL {
+		return a
+	}
+	return nil
+}
+
+func (t *actorTracker) expire() {
+	for p, a := range t.actors {
+		if time.Since(a.Time) >= actorsTTL {
+			delete(t.actors, p)
+		}
+	}
+}
+
+// enrichEvents returns a copy of the watch object that adds the actor of each event to its metadata.
+func (t *actorTracker) enrichEvents(main *model.WatchObject) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					close(out.EventInfoChan)
+					return
+				}
+				if a := t.lookup(ev.Path); a != nil {
+					if ev.Metadata == nil {
+						ev.Metadata = make(map[string]string)
+					}
+					ev.Metadata[MetaActorProcess] = a.Process
+					ev.Metadata[MetaActorPid] = strconv.Itoa(a.Pid)
+					ev.Metadata[MetaActorUser] = a.User
+				}
+				select {
+				case out.EventInfoChan <- ev:
+				case <-main.Done():
+					return
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
+
+// EnableActorTracking starts recording the processes changing files on a local endpoint, where the platform
+// allows it. It usually requires administrative privileges.
+func EnableActorTracking(ep model.Endpoint) error {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return nil
+	}
+	t := &actorTracker{actors: make(map[string]*Actor)}
+	stop, e := watchActors(c.root, t.record)
+	if e != nil {
+		return e
+	}
+	t.stop = stop
+	c.actors = t
+	return nil
+}
+
+// DisableActorTracking stops recording the processes changing files on a local endpoint.
+func DisableActorTracking(ep model.Endpoint) {
+	if c, ok := ep.(*localFS); ok && c.actors != nil {
+		c.actors.stop()
+		c.actors = nil
+	}
+}
+
+// ActorOf returns the last process seen changing a path of a local endpoint, or nil if unknown.
+func ActorOf(ep interface{}, p string) *Actor {
+	if c, ok := ep.(*localFS); ok && c.actors != nil {
+		return c.actors.lookup(p)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// +build linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fanotify flags reporting the parent directory and name of each event (Linux 5.9+)
+const (
+	fanReportDfidName     = 0x00000c00
+	fanMarkFilesystem     = 0x00000100
+	fanInfoTypeDfidName   = 2
+	fanModify             = 0x00000002
+	fanCloseWrite         = 0x00000008
+	fanMovedFrom          = 0x00000040
+	fanMovedTo            = 0x00000080
+	fanCreate             = 0x00000100
+	fanDelete             = 0x00000200
+	fanOnDir              = 0x40000000
+	fanEventMask          = fanModify | fanCloseWrite | fanMovedFrom | fanMovedTo | fanCreate | fanDelete | fanOnDir
+	fanEventMetadataSize  = int(unsafe.Sizeof(unix.FanotifyEventMetadata{}))
+	fanInfoHeaderAndFsid  = 4 + 8
+	fanFileHandleHeadSize = 8
+)
+
+// watchActors uses a fanotify filesystem mark to find the process behind each change below root. It requires
+// the CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH capabilities.
+func watchActors(root string, record func(p string, a *Actor)) (func(), error) {
+	fd, e := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|fanReportDfidName, unix.O_RDONLY|unix.O_LARGEFILE)
+	if e != nil {
+		return nil, e
+	}
+	if e := unix.FanotifyMark(fd, unix.FAN_MARK_ADD|fanMarkFilesystem, fanEventMask, unix.AT_FDCWD, root); e != nil {
+		unix.Close(fd)
+		return nil, e
+	}
+	mountFd, e := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	if e != nil {
+		unix.Close(fd)
+		return nil, e
+	}
+	done := make(chan struct{})
+	go func() {
+		defer unix.Close(mountFd)
+		self := int32(os.Getpid())
+		names := make(map[int32]*Actor)
+		buf := make([]byte, 64*1024)
+		for {
+			n, er := unix.Read(fd, buf)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if er != nil {
+				if er == unix.EINTR {
+					continue
+				}
+				return
+			}
+			for off := 0; off+fanEventMetadataSize <= n; {
+				meta := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[off]))
+				if meta.Event_len == 0 || off+int(meta.Event_len) > n {
+					break
+				}
+				if meta.Pid != self {
+					if p, ok := resolveFanotifyPath(mountFd, root, buf[off+int(meta.Metadata_len):off+int(meta.Event_len)]); ok {
+						record(p, processActor(meta.Pid, names))
+					}
+				}
+				off += int(meta.Event_len)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		// Closing the descriptor unblocks the pending read
+		unix.Close(fd)
+	}, nil
+}
+
+// resolveFanotifyPath reads the directory handle and name of an event, and returns its path relative to root.
+func resolveFanotifyPath(mountFd int, root string, info []byte) (string, bool) {
+	if len(info) < fanInfoHeaderAndFsid+fanFileHandleHeadSize || info[0] != fanInfoTypeDfidName {
+		return "", false
+	}
+	infoLen := int(binary.LittleEndian.Uint16(info[2:4]))
+	if infoLen > len(info) {
+		return "", false
+	}
+	fh := info[fanInfoHeaderAndFsid:infoLen]
+	size := int(*(*uint32)(unsafe.Pointer(&fh[0])))
+	handleType := *(*int32)(unsafe.Pointer(&fh[4]))
+	if fanFileHandleHeadSize+size > len(fh) {
+		return "", false
+	}
+	name := fh[fanFileHandleHeadSize+size:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	dirFd, e := unix.OpenByHandleAt(mountFd, unix.NewFileHandle(handleType, fh[fanFileHandleHeadSize:fanFileHandleHeadSize+size]), unix.O_PATH)
+	if e != nil {
+		return "", false
+	}
+	dir, e := os.Readlink("/proc/self/fd/" + strconv.Itoa(dirFd))
+	unix.Close(dirFd)
+	if e != nil {
+		return "", false
+	}
+	rel, e := filepath.Rel(root, filepath.Join(dir, string(name)))
+	if e != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// processActor describes a process from /proc. Names are kept, as short-lived processes are often gone when
+// their next event is read.
+func processActor(pid int32, names map[int32]*Actor) *Actor {
+	a := &Actor{Pid: int(pid), Time: time.Now()}
+	if known, ok := names[pid]; ok {
+		a.Process, a.User = known.Process, known.User
+		return a
+	}
+	procDir := "/proc/" + strconv.Itoa(int(pid))
+	if comm, e := ioutil.ReadFile(procDir + "/comm"); e == nil {
+		a.Process = strings.TrimSpace(string(comm))
+	}
+	if info, e := os.Stat(procDir); e == nil {
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid := strconv.Itoa(int(st.Uid))
+			a.User = uid
+			if u, e := user.LookupId(uid); e == nil {
+				a.User = u.Username
+			}
+		}
+	}
+	if len(names) > 1000 {
+		for k := range names {
+			delete(names, k)
+		}
+	}
+	names[pid] = a
+	return a
+}
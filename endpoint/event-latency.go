@@ -0,0 +1,202 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// latencySamples is the number of last latencies kept to compute percentiles.
+	latencySamples = 1000
+	// latencyMaxPending bounds the number of events waiting for their operation.
+	latencyMaxPending = 10000
+	// latencyExpire drops events that never led to an operation (e.g. a file changed back to its synced state).
+	latencyExpire = time.Hour
+)
+
+// EventLatency describes the delays between the reception of watcher events of a local folder and the end of their
+// processing, with the number of events waiting at each stage.
+type EventLatency struct {
+	// InWatcher counts events received from the OS but not yet handed to the sync engine (filtering, move
+	// detection and debouncing)
+	InWatcher int
+	// InEngine counts events handed to the sync engine whose operation is not applied yet
+	InEngine int
+	// Dropped counts events not tracked because too many were pending
+	Dropped int64
+	// Samples is the number of latencies used to compute the percentiles
+	Samples     int
+	WatcherP50  time.Duration
+	WatcherP95  time.Duration
+	CompleteP50 time.Duration
+	CompleteP95 time.Duration
+}
+
+type pendingEvent struct {
+	received time.Time
+	emitted  bool
+}
+
+type latencyTracker struct {
+	pending  map[string]*pendingEvent
+	watcher  []time.Duration
+	complete []time.Duration
+	dropped  int64
+}
+
+var eventLatencies = struct {
+	sync.Mutex
+	roots map[string]*latencyTracker
+}{roots: make(map[string]*latencyTracker)}
+
+// trackerFor returns the tracker of a root, the lock must be held.
+func trackerFor(root string) *latencyTracker {
+	t, ok := eventLatencies.roots[metricsKey(root)]
+	if !ok {
+		t = &latencyTracker{pending: make(map[string]*pendingEvent)}
+		eventLatencies.roots[metricsKey(root)] = t
+	}
+	return t
+}
+
+// latencyKey normalizes event and operation paths.
+func latencyKey(p string) string {
+	return strings.Trim(p, "/")
+}
+
+// appendSample adds a duration to a bounded list of samples.
+func appendSample(samples []time.Duration, d time.Duration) []time.Duration {
+	samples = append(samples, d)
+	if len(samples) > latencySamples {
+		samples = samples[len(samples)-latencySamples:]
+	}
+	return samples
+}
+
+// percentiles returns the p50 and p95 of a list of samples.
+func percentiles(samples []time.Duration) (p50, p95 time.Duration) {
+	if len(samples) == 0 {
+		return
+	}
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)*50/100], sorted[len(sorted)*95/100]
+}
+
+// EventLatencyFor returns the event latencies of a local folder since the application started.
+func EventLatencyFor(root string) EventLatency {
+	eventLatencies.Lock()
+	defer eventLatencies.Unlock()
+	t, ok := eventLatencies.roots[metricsKey(root)]
+	if !ok {
+		return EventLatency{}
+	}
+	l := EventLatency{Dropped: t.dropped, Samples: len(t.complete)}
+	for _, p := range t.pending {
+		if time.Since(p.received) > latencyExpire {
+			continue
+		}
+		if p.emitted {
+			l.InEngine++
+		} else {
+			l.InWatcher++
+		}
+	}
+	l.WatcherP50, l.WatcherP95 = percentiles(t.watcher)
+	l.CompleteP50, l.CompleteP95 = percentiles(t.complete)
+	return l
+}
+
+// RecordCompleted closes the latency measures of the events that led to the operations applied on the given paths.
+func RecordCompleted(root string, paths []string) {
+	eventLatencies.Lock()
+	defer eventLatencies.Unlock()
+	t, ok := eventLatencies.roots[metricsKey(root)]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for _, p := range paths {
+		if ev, ok := t.pending[latencyKey(p)]; ok && ev.emitted {
+			t.complete = appendSample(t.complete, now.Sub(ev.received))
+			delete(t.pending, latencyKey(p))
+		}
+	}
+	for p, ev := range t.pending {
+		if now.Sub(ev.received) > latencyExpire {
+			delete(t.pending, p)
+		}
+	}
+}
+
+// timeEvents returns a copy of the watch object recording the events passing through it. At the start of the
+// pipeline, the first event received for a path starts a measure, at the end the event is marked as handed to
+// the engine.
+func (c *localFS) timeEvents(main *model.WatchObject, start bool) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					close(out.EventInfoChan)
+					return
+				}
+				c.recordEvent(ev.Path, start)
+				select {
+				case out.EventInfoChan <- ev:
+				case <-main.Done():
+					return
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
+
+func (c *localFS) recordEvent(p string, start bool) {
+	eventLatencies.Lock()
+	defer eventLatencies.Unlock()
+	t := trackerFor(c.root)
+	key := latencyKey(p)
+	ev, ok := t.pending[key]
+	if start {
+		if ok {
+			return
+		}
+		if len(t.pending) >= latencyMaxPending {
+			t.dropped++
+			return
+		}
+		t.pending[key] = &pendingEvent{received: time.Now()}
+	} else if ok && !ev.emitted {
+		ev.emitted = true
+		t.watcher = appendSample(t.watcher, time.Since(ev.received))
+	}
+}
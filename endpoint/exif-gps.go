@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// gpsInfoTag is the entry of the first EXIF directory pointing to the GPS directory.
+const gpsInfoTag = 0x8825
+
+// exifTypeSizes are the sizes in bytes of the EXIF value types.
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// StripJPEGGPS removes the GPS location from the EXIF data of a JPEG file. The GPS directory is emptied and its
+// values are zeroed in place, so that the offsets of the other EXIF entries stay valid. It returns false if the
+// file has no GPS data.
+func StripJPEGGPS(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false
+	}
+	stripped := false
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// Image data starts, no more metadata
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0xFF {
+			i += 2
+			continue
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			break
+		}
+		if seg := data[i+4 : end]; marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			stripped = stripTIFFGPS(seg[6:]) || stripped
+		}
+		i = end
+	}
+	return stripped
+}
+
+// stripTIFFGPS empties the GPS directory of a TIFF structure.
+func stripTIFFGPS(t []byte) bool {
+	if len(t) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+	size := uint32(len(t))
+	ifd := order.Uint32(t[4:])
+	if ifd+2 > size {
+		return false
+	}
+	for k := uint32(0); k < uint32(order.Uint16(t[ifd:])); k++ {
+		entry := ifd + 2 + 12*k
+		if entry+12 > size {
+			return false
+		}
+		if order.Uint16(t[entry:]) != gpsInfoTag {
+			continue
+		}
+		gps := order.Uint32(t[entry+8:])
+		if gps+2 > size {
+			return false
+		}
+		count := uint32(order.Uint16(t[gps:]))
+		for j := uint32(0); j < count; j++ {
+			e := gps + 2 + 12*j
+			if e+12 > size {
+				break
+			}
+			length := exifTypeSizes[order.Uint16(t[e+2:])] * order.Uint32(t[e+4:])
+			if length > 4 {
+				if off := order.Uint32(t[e+8:]); off < size && length <= size-off {
+					zeroBytes(t[off : off+length])
+				}
+			}
+			zeroBytes(t[e : e+12])
+		}
+		order.PutUint16(t[gps:], 0)
+		return count > 0
+	}
+	return false
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// expectedTTL is how long a change applied by the agent is expected to come back through the watcher.
+const expectedTTL = 30 * time.Second
+
+// expectedChange is the state of a local path right after the agent wrote it.
+type expectedChange struct {
+	deleted bool
+	size    int64
+	modTime time.Time
+	until   time.Time
+}
+
+// expectedChanges is a journal of the changes applied by the sync engine on a local folder. Watcher events are
+// compared with it to recognize self-inflicted changes: an event is suppressed if the path still has the exact
+// size and modification time written by the agent, so that later user edits always go through.
+type expectedChanges struct {
+	sync.Mutex
+	root    string
+	changes map[string]expectedChange
+}
+
+func newExpectedChanges(root string) *expectedChanges {
+	return &expectedChanges{root: root, changes: make(map[string]expectedChange)}
+}
+
+func (j *expectedChanges) localPath(p string) string {
+	return filepath.Join(j.root, filepath.FromSlash(strings.Trim(p, "/")))
+}
+
+// expect records the current state of a path written by the agent.
+func (j *expectedChanges) expect(p string) {
+	st, e := os.Stat(j.localPath(p))
+	if e != nil {
+		return
+	}
+	j.Lock()
+	defer j.Unlock()
+	j.changes[strings.Trim(p, "/")] = expectedChange{size: st.Size(), modTime: st.ModTime(), until: time.Now().Add(expectedTTL)}
+}
+
+// expectDeleted records a path removed by the agent.
+func (j *expectedChanges) expectDeleted(p string) {
+	j.Lock()
+	defer j.Unlock()
+	j.changes[strings.Trim(p, "/")] = expectedChange{deleted: true, until: time.Now().Add(expectedTTL)}
+}
+
+// isExpected checks if the current state of a path is the one written by the agent. Expired entries are dropped.
+func (j *expectedChanges) isExpected(p string) bool {
+	key := strings.Trim(p, "/")
+	j.Lock()
+	c, ok := j.changes[key]
+	now := time.Now()
+	for k, v := range j.changes {
+		if now.After(v.until) {
+			delete(j.changes, k)
+		}
+	}
+	j.Unlock()
+	if !ok || now.After(c.until) {
+		return false
+	}
+	st, e := os.Stat(j.localPath(key))
+	if c.deleted {
+		return os.IsNotExist(e)
+	}
+	return e == nil && st.Size() == c.size && st.ModTime().Equal(c.modTime)
+}
+
+// filterEvents returns a copy of the watch object that drops the events caused by the agent itself.
+func (j *expectedChanges) filterEvents(main *model.WatchObject) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					close(out.EventInfoChan)
+					return
+				}
+				if j.isExpected(ev.Path) {
+					continue
+				}
+				select {
+				case out.EventInfoChan <- ev:
+				case <-main.Done():
+					return
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	FilePhaseQueued       = "queued"
+	FilePhaseHashing      = "hashing"
+	FilePhaseTransferring = "transferring"
+	FilePhaseVerifying    = "verifying"
+	FilePhaseCommitting   = "committing"
+
+	maxActiveFiles = 50
+)
+
+// ProgressTracker records the processing phase of each file of a task. It is fed by the endpoint wrappers.
+// It also counts the bytes sent to and received from the remote endpoints, for the live throughput.
+type ProgressTracker struct {
+	sync.Mutex
+	files map[string]*common.FileProgress
+	up    int64
+	down  int64
+	// Last time a file changed phase or bytes were written
+	active time.Time
+}
+
+// NewProgressTracker creates an empty tracker.
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{files: make(map[string]*common.FileProgress)}
+}
+
+// SetProgressTracker registers a tracker on a local or remote endpoint. It returns false for other endpoints.
+func SetProgressTracker(ep model.Endpoint, t *ProgressTracker) bool {
+	switch c := ep.(type) {
+	case *localFS:
+		c.progress = t
+	case *remoteFS:
+		c.progress = t
+	default:
+		return false
+	}
+	return true
+}
+
+// Phase sets the current phase of a file.
+func (t *ProgressTracker) Phase(p string, phase string, total int64) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	p = "/" + strings.Trim(p, "/")
+	f, ok := t.files[p]
+	if !ok {
+		f = &common.FileProgress{Path: p}
+		t.files[p] = f
+	}
+	f.Phase = phase
+	if phase == FilePhaseTransferring {
+		f.Bytes, f.Total = 0, total
+	}
+	if phase != FilePhaseQueued {
+		t.active = time.Now()
+	}
+}
+
+// Add records transferred bytes for a file.
+func (t *ProgressTracker) Add(p string, n int64) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if f, ok := t.files["/"+strings.Trim(p, "/")]; ok {
+		f.Bytes += n
+		t.active = time.Now()
+	}
+}
+
+// Transfer counts bytes sent to (up) or received from (down) a remote endpoint.
+func (t *ProgressTracker) Transfer(up, down int64) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.up += up
+	t.down += down
+}
+
+// TakeTransfers returns the bytes counted since the last call.
+func (t *ProgressTracker) TakeTransfers() (up, down int64) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	up, down = t.up, t.down
+	t.up, t.down = 0, 0
+	return
+}
+
+// InFlight tells if files are being processed, i.e. not only queued, and progressed within the idle duration.
+// Files whose transfer failed stay in the tracker, but stop progressing.
+func (t *ProgressTracker) InFlight(idle time.Duration) bool {
+	if t == nil {
+		return false
+	}
+	t.Lock()
+	defer t.Unlock()
+	if time.Since(t.active) > idle {
+		return false
+	}
+	for _, f := range t.files {
+		if f.Phase != FilePhaseQueued {
+			return true
+		}
+	}
+	return false
+}
+
+// Done removes a file from the tracker.
+func (t *ProgressTracker) Done(p string) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	delete(t.files, "/"+strings.Trim(p, "/"))
+}
+
+// Reset removes all files, e.g. when a patch is finished.
+func (t *ProgressTracker) Reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.files = make(map[string]*common.FileProgress)
+}
+
+// List returns the files being processed first, then the queued ones, sorted by path.
+func (t *ProgressTracker) List() (files []*common.FileProgress) {
+	t.Lock()
+	defer t.Unlock()
+	for _, f := range t.files {
+		c := *f
+		files = append(files, &c)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		qi, qj := files[i].Phase == FilePhaseQueued, files[j].Phase == FilePhaseQueued
+		if qi != qj {
+			return qj
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > maxActiveFiles {
+		files = files[:maxActiveFiles]
+	}
+	return
+}
+
+// Queue marks all file transfers of a patch as queued.
+func (t *ProgressTracker) Queue(patch merger.Patch) {
+	patch.WalkOperations([]merger.OperationType{merger.OpCreateFile, merger.OpUpdateFile}, func(operation merger.Operation) {
+		t.Phase(operation.GetRefPath(), FilePhaseQueued, 0)
+	})
+}
+
+// ProgressListener forwards patches to a patch listener after queuing their operations in a tracker.
+type ProgressListener struct {
+	Tracker *ProgressTracker
+	Next    interface {
+		PublishPatch(patch merger.Patch)
+	}
+}
+
+// PublishPatch implements the patch listener interface.
+func (l *ProgressListener) PublishPatch(patch merger.Patch) {
+	l.Tracker.Queue(patch)
+	if l.Next != nil {
+		l.Next.PublishPatch(patch)
+	}
+}
+
+// progressWriter reports written bytes, then the committing phase on Close. Bytes written to a remote endpoint
+// are counted as uploaded.
+type progressWriter struct {
+	io.WriteCloser
+	tracker *ProgressTracker
+	path    string
+	upload  bool
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, e := w.WriteCloser.Write(p)
+	w.tracker.Add(w.path, int64(n))
+	if w.upload {
+		w.tracker.Transfer(int64(n), 0)
+	}
+	return n, e
+}
+
+func (w *progressWriter) Close() error {
+	w.tracker.Phase(w.path, FilePhaseCommitting, 0)
+	return w.WriteCloser.Close()
+}
+
+// trackWriter wraps a writer and its done channel to report the transferring and committing phases. Files
+// failing to write stay in the tracker until it is reset. Upload is set for writers on a remote endpoint.
+func trackWriter(t *ProgressTracker, p string, size int64, out io.WriteCloser, writeDone chan bool, upload bool) (io.WriteCloser, chan bool) {
+	if t == nil {
+		return out, writeDone
+	}
+	t.Phase(p, FilePhaseTransferring, size)
+	out = &progressWriter{WriteCloser: out, tracker: t, path: p, upload: upload}
+	if writeDone == nil {
+		return out, writeDone
+	}
+	done := make(chan bool, 1)
+	go func() {
+		if d, ok := <-writeDone; ok {
+			t.Done(p)
+			done <- d
+		}
+		close(done)
+	}()
+	return out, done
+}
+
+// downloadReader counts the bytes read from a remote endpoint as downloaded.
+type downloadReader struct {
+	io.ReadCloser
+	tracker *ProgressTracker
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	n, e := r.ReadCloser.Read(p)
+	r.tracker.Transfer(0, int64(n))
+	return n, e
+}
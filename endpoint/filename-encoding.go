@@ -0,0 +1,188 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	EncodingAuto   = "auto"
+	EncodingLatin1 = "latin1"
+	EncodingCP1252 = "cp1252"
+)
+
+// cp1252Runes maps the 0x80-0x9F range of Windows-1252, the only difference with Latin-1. Undefined bytes are
+// kept as the matching control characters.
+var cp1252Runes = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// TranscodeRename is a file or folder to rename, with paths relative to the local folder.
+type TranscodeRename struct {
+	From string
+	To   string
+	// Set if a file already exists with the new name
+	Conflict bool `json:",omitempty"`
+}
+
+// TranscodeReport lists the renames planned or applied on a local folder.
+type TranscodeReport struct {
+	Renames []*TranscodeRename
+	Errors  []string
+}
+
+// String implements Stringer interface.
+func (r *TranscodeReport) String() string {
+	var conflicts int
+	var lines []string
+	for _, rn := range r.Renames {
+		line := " - " + rn.From + " => " + rn.To
+		if rn.Conflict {
+			conflicts++
+			line += " (skipped, target exists)"
+		}
+		lines = append(lines, line)
+	}
+	s := fmt.Sprintf("%d names to rename, %d conflicts, %d errors", len(r.Renames), conflicts, len(r.Errors))
+	for _, l := range append(lines, r.Errors...) {
+		s += "\n" + l
+	}
+	return s
+}
+
+// decodeLegacy reads bytes as Latin-1 or Windows-1252.
+func decodeLegacy(b []byte, source string) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x80 && c < 0xA0 && source != EncodingLatin1 {
+			sb.WriteRune(cp1252Runes[c-0x80])
+		} else {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// encodeLegacy converts a string back to Latin-1 or Windows-1252 bytes. It fails if a rune has no legacy byte.
+func encodeLegacy(s string, source string) ([]byte, bool) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r < 0x80 || (r >= 0xA0 && r <= 0xFF) || (r < 0xA0 && source == EncodingLatin1) {
+			b = append(b, byte(r))
+			continue
+		}
+		found := false
+		if source != EncodingLatin1 {
+			for i, c := range cp1252Runes {
+				if c == r {
+					b, found = append(b, byte(0x80+i)), true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+// TranscodeName fixes a file name written in a legacy encoding. Names that are not valid UTF-8 are decoded
+// from the source encoding. Valid names made of legacy characters that form valid UTF-8 once encoded back
+// (e.g. "Ã©tÃ©") were converted twice, and are decoded once more. It returns false if the name is fine.
+func TranscodeName(name string, source string) (string, bool) {
+	if source == "" {
+		source = EncodingAuto
+	}
+	if !utf8.ValidString(name) {
+		return decodeLegacy([]byte(name), source), true
+	}
+	b, ok := encodeLegacy(name, source)
+	if !ok || !utf8.Valid(b) {
+		return name, false
+	}
+	fixed := string(b)
+	if fixed == name {
+		// Only ASCII characters
+		return name, false
+	}
+	return fixed, true
+}
+
+// PlanTranscode walks a local folder to find the names that should be transcoded. Deepest paths come first,
+// so that renames can be applied in order. Only paths accepted by keep are processed.
+func PlanTranscode(root string, source string, keep func(string) bool) (*TranscodeReport, error) {
+	report := &TranscodeReport{}
+	e := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if !keep(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fixed, ok := TranscodeName(info.Name(), source)
+		if !ok {
+			return nil
+		}
+		rn := &TranscodeRename{From: rel, To: filepath.ToSlash(filepath.Join(filepath.Dir(rel), fixed))}
+		if _, er := os.Lstat(filepath.Join(filepath.Dir(p), fixed)); er == nil {
+			rn.Conflict = true
+		}
+		report.Renames = append(report.Renames, rn)
+		return nil
+	})
+	sort.SliceStable(report.Renames, func(i, j int) bool {
+		return strings.Count(report.Renames[i].From, "/") > strings.Count(report.Renames[j].From, "/")
+	})
+	return report, e
+}
+
+// ApplyTranscode renames the files of a plan, skipping conflicts. It returns the renames actually applied.
+func ApplyTranscode(root string, report *TranscodeReport) (applied []*TranscodeRename, errs []error) {
+	for _, rn := range report.Renames {
+		if rn.Conflict {
+			continue
+		}
+		from := filepath.Join(root, filepath.FromSlash(rn.From))
+		to := filepath.Join(filepath.Dir(from), filepath.Base(filepath.FromSlash(rn.To)))
+		if e := os.Rename(from, to); e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		applied = append(applied, rn)
+	}
+	return
+}
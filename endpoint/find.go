@@ -0,0 +1,235 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+const findSearchSize = 1000
+
+// FindQuery filters the files of a task by name, modification time and content.
+type FindQuery struct {
+	// Glob pattern matched against the file name, case-insensitively
+	Name string
+	// Only files modified after this time
+	ModifiedSince time.Time
+	// Keyword searched in the file content, case-insensitively
+	Content string
+}
+
+// FindResult is a file matching a FindQuery.
+type FindResult struct {
+	Path  string    `json:"path"`
+	Size  int64     `json:"size"`
+	MTime time.Time `json:"mtime"`
+	// False for files only known from the remote snapshot
+	Local bool `json:"local"`
+}
+
+// ParseSince reads a duration relative to now, either as a Go duration or as a number of days ("7d").
+func ParseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, e := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if e != nil {
+			return time.Time{}, fmt.Errorf("invalid duration %s", s)
+		}
+		return time.Now().AddDate(0, 0, -days), nil
+	}
+	d, e := time.ParseDuration(s)
+	if e != nil {
+		return time.Time{}, e
+	}
+	return time.Now().Add(-d), nil
+}
+
+// matches checks the name and modification time of a file.
+func (q *FindQuery) matches(p string, mtime time.Time) bool {
+	if q.Name != "" {
+		if ok, _ := path.Match(strings.ToLower(q.Name), strings.ToLower(path.Base(p))); !ok {
+			return false
+		}
+	}
+	return q.ModifiedSince.IsZero() || mtime.After(q.ModifiedSince)
+}
+
+// FindLocal walks a local folder for files matching the query. Only paths accepted by keep are returned.
+func FindLocal(root string, q *FindQuery, keep func(string) bool) (results []FindResult, e error) {
+	e = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = "/" + filepath.ToSlash(rel)
+		if !keep(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !q.matches(rel, info.ModTime()) {
+			return nil
+		}
+		if q.Content != "" {
+			if found, er := fileContains(p, q.Content); er != nil || !found {
+				return nil
+			}
+		}
+		results = append(results, FindResult{Path: rel, Size: info.Size(), MTime: info.ModTime(), Local: true})
+		return nil
+	})
+	return
+}
+
+// FindRemoteOnly returns the files of a remote snapshot matching the query that do not exist in the local
+// folder, e.g. because they are outside the selective roots. Content is searched by the server.
+func FindRemoteOnly(entries []SnapshotEntry, localRoot, remoteURI string, q *FindQuery) ([]FindResult, error) {
+	var candidates []FindResult
+	for _, e := range entries {
+		if e.Type != "file" || !q.matches(e.Path, time.Unix(e.MTime, 0)) {
+			continue
+		}
+		if _, er := os.Stat(filepath.Join(localRoot, filepath.FromSlash(strings.TrimLeft(e.Path, "/")))); er == nil {
+			continue
+		}
+		candidates = append(candidates, FindResult{Path: e.Path, Size: e.Size, MTime: time.Unix(e.MTime, 0)})
+	}
+	if q.Content == "" || len(candidates) == 0 {
+		return candidates, nil
+	}
+	found, e := searchRemoteContent(remoteURI, q.Content)
+	if e != nil {
+		return nil, e
+	}
+	var results []FindResult
+	for _, c := range candidates {
+		if found[c.Path] {
+			results = append(results, c)
+		}
+	}
+	return results, nil
+}
+
+// searchRemoteContent asks the server search engine for the files of a remote URI containing a keyword. It
+// returns their paths relative to the URI.
+func searchRemoteContent(remoteURI, keyword string) (map[string]bool, error) {
+	u, e := url.Parse(remoteURI)
+	if e != nil {
+		return nil, e
+	}
+	var authority *config.Authority
+	for _, a := range config.Default().Authorities {
+		if a.MatchesURI(remoteURI) {
+			authority = a
+			break
+		}
+	}
+	if authority == nil {
+		return nil, fmt.Errorf("cannot find authority")
+	}
+	prefix := strings.Trim(u.Path, "/")
+	body, _ := json.Marshal(map[string]interface{}{
+		"Query": map[string]interface{}{
+			"Content":    keyword,
+			"PathPrefix": []string{prefix},
+		},
+		"Size": findSearchSize,
+	})
+	req, e := authority.NewAuthenticatedRequest("POST", "/a/search/nodes", bytes.NewReader(body))
+	if e != nil {
+		return nil, e
+	}
+	resp, e := authority.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server search responded with status %d", resp.StatusCode)
+	}
+	var res struct {
+		Results []struct {
+			Path string
+		}
+	}
+	if e := json.NewDecoder(resp.Body).Decode(&res); e != nil {
+		return nil, e
+	}
+	found := make(map[string]bool, len(res.Results))
+	for _, r := range res.Results {
+		p := strings.Trim(r.Path, "/")
+		if prefix != "" {
+			if !strings.HasPrefix(p, prefix+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(p, prefix+"/")
+		}
+		found["/"+p] = true
+	}
+	return found, nil
+}
+
+// fileContains checks if a local file contains a keyword, case-insensitively. The file is read by chunks that
+// overlap by the keyword length.
+func fileContains(p, keyword string) (bool, error) {
+	f, e := os.Open(p)
+	if e != nil {
+		return false, e
+	}
+	defer f.Close()
+	needle := bytes.ToLower([]byte(keyword))
+	r := bufio.NewReaderSize(f, 64*1024)
+	buf := make([]byte, 64*1024+len(needle))
+	var carry int
+	for {
+		n, er := io.ReadFull(r, buf[carry:])
+		chunk := bytes.ToLower(buf[:carry+n])
+		if bytes.Contains(chunk, needle) {
+			return true, nil
+		}
+		if er == io.EOF || er == io.ErrUnexpectedEOF {
+			return false, nil
+		} else if er != nil {
+			return false, er
+		}
+		carry = len(needle) - 1
+		if carry > len(chunk) {
+			carry = len(chunk)
+		}
+		copy(buf, chunk[len(chunk)-carry:])
+	}
+}
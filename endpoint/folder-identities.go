@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells/common"
+)
+
+// foldersBucket stores the identity (the UUID of the .pydio marker) of the local folders, keyed by path.
+var foldersBucket = []byte("folders")
+
+// folderIdentity reads the UUID of the marker of a local folder, given its absolute path.
+func folderIdentity(abs string) string {
+	uid, e := ioutil.ReadFile(filepath.Join(abs, common.PYDIO_SYNC_HIDDEN_FILE_META))
+	if e != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(uid))
+}
+
+// recordFolder registers the identity of a folder. Like hashes, entries are kept in memory until flush is called.
+func (h *HashCache) recordFolder(p string, uuid string) {
+	if uuid == "" {
+		return
+	}
+	h.Lock()
+	h.folders[strings.Trim(p, "/")] = uuid
+	full := len(h.pending)+len(h.folders) >= h.flushAt
+	h.Unlock()
+	if full {
+		h.flush()
+	}
+}
+
+// folderUuid returns the identity last recorded for the folder at path p, or an empty string.
+func (h *HashCache) folderUuid(p string) (uuid string) {
+	key := strings.Trim(p, "/")
+	h.Lock()
+	uuid, ok := h.folders[key]
+	h.Unlock()
+	if ok {
+		return
+	}
+	h.db.View(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket(foldersBucket); bucket != nil {
+			uuid = string(bucket.Get([]byte(key)))
+		}
+		return nil
+	})
+	return
+}
+
+// foldersUnder lists the folders with a known identity below a folder, "" or "." for the whole cache.
+func (h *HashCache) foldersUnder(folder string) (paths []string) {
+	h.flush()
+	prefix := strings.Trim(folder, "/")
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	h.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(foldersBucket)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			paths = append(paths, string(k))
+		}
+		return nil
+	})
+	return
+}
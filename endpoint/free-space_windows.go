@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// FreeSpace returns the number of bytes available to the current user on the volume containing the folder.
+func FreeSpace(folder string) (uint64, error) {
+	h, e := syscall.LoadDLL("kernel32.dll")
+	if e != nil {
+		return 0, e
+	}
+	c, e := h.FindProc("GetDiskFreeSpaceExW")
+	if e != nil {
+		return 0, e
+	}
+	p, e := syscall.UTF16PtrFromString(folder)
+	if e != nil {
+		return 0, e
+	}
+	var freeBytes uint64
+	if r, _, err := c.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&freeBytes)), 0, 0); r == 0 {
+		return 0, err
+	}
+	return freeBytes, nil
+}
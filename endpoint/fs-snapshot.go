@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// snapshotIdle is the time without reads after which a snapshot is released
+	snapshotIdle = time.Minute
+	// snapshotMaxAge is the age after which a new snapshot is taken for the next reads
+	snapshotMaxAge = 30 * time.Minute
+)
+
+var errSnapshotUnsupported = errors.New("filesystem snapshots are not supported on this platform")
+
+// volumeSnapshot is a read-only, point-in-time view of the volume containing a folder.
+type volumeSnapshot interface {
+	// Path maps a live absolute path to the same path inside the snapshot
+	Path(live string) string
+	// Release deletes the snapshot
+	Release() error
+}
+
+// consistentReads reads local files from a filesystem snapshot (VSS on Windows, APFS local snapshot on macOS),
+// so that files open or locked by other applications (mail archives, databases) are captured consistently.
+// A snapshot is taken at the first read, and released once reads stop.
+type consistentReads struct {
+	sync.Mutex
+	root     string
+	current  volumeSnapshot
+	created  time.Time
+	lastRead time.Time
+	failed   bool
+	timer    *time.Timer
+}
+
+// SetConsistentReads makes a local endpoint read files from a filesystem snapshot, typically for backup tasks.
+func SetConsistentReads(ep model.Endpoint) bool {
+	if c, ok := ep.(*localFS); ok {
+		c.consistent = &consistentReads{root: c.root}
+		return true
+	}
+	return false
+}
+
+// open opens a file inside the current snapshot, taking a new one if required. It returns nil if the file
+// must be read from the live filesystem: snapshot not supported, or file created after the snapshot.
+func (r *consistentReads) open(p string) io.ReadCloser {
+	r.Lock()
+	defer r.Unlock()
+	if r.failed {
+		return nil
+	}
+	if r.current != nil && time.Since(r.created) > snapshotMaxAge {
+		r.release()
+	}
+	if r.current == nil {
+		s, e := createVolumeSnapshot(r.root)
+		if e != nil {
+			// Do not try again for this run, as creating snapshots may require privileges
+			log.Logger(context.Background()).Warn("Cannot create filesystem snapshot, reading live files: " + e.Error())
+			r.failed = true
+			return nil
+		}
+		r.current, r.created = s, time.Now()
+		r.timer = time.AfterFunc(snapshotIdle, r.expire)
+	}
+	r.lastRead = time.Now()
+	live := filepath.Join(r.root, filepath.FromSlash(strings.TrimLeft(p, "/")))
+	f, e := os.Open(r.current.Path(live))
+	if e != nil {
+		return nil
+	}
+	return f
+}
+
+// expire releases the snapshot if it was not read recently.
+func (r *consistentReads) expire() {
+	r.Lock()
+	defer r.Unlock()
+	if r.current == nil {
+		return
+	}
+	if idle := time.Since(r.lastRead); idle < snapshotIdle {
+		r.timer = time.AfterFunc(snapshotIdle-idle, r.expire)
+		return
+	}
+	r.release()
+}
+
+// release deletes the current snapshot. Must be called with the lock held.
+func (r *consistentReads) release() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	if e := r.current.Release(); e != nil {
+		log.Logger(context.Background()).Error("Cannot release filesystem snapshot: " + e.Error())
+	}
+	r.current = nil
+}
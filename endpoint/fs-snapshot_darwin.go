@@ -0,0 +1,101 @@
+// +build darwin
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// apfsSnapshot is an APFS local snapshot, mounted read-only in a temporary folder.
+type apfsSnapshot struct {
+	date       string
+	mountPoint string
+	mounted    string
+}
+
+func createVolumeSnapshot(root string) (volumeSnapshot, error) {
+	var stat syscall.Statfs_t
+	if e := syscall.Statfs(root, &stat); e != nil {
+		return nil, e
+	}
+	mountPoint := cString(stat.Mntonname[:])
+	out, e := exec.Command("tmutil", "localsnapshot").CombinedOutput()
+	if e != nil {
+		return nil, fmt.Errorf("tmutil localsnapshot: %s", strings.TrimSpace(string(out)))
+	}
+	// Created local snapshot with date: 2020-05-01-123456
+	const prefix = "date: "
+	i := strings.LastIndex(string(out), prefix)
+	if i < 0 {
+		return nil, fmt.Errorf("unexpected output from tmutil: %s", strings.TrimSpace(string(out)))
+	}
+	date := strings.TrimSpace(string(out)[i+len(prefix):])
+	s := &apfsSnapshot{date: date, mountPoint: mountPoint}
+	if s.mounted, e = ioutil.TempDir("", "cells-sync-snapshot-"); e != nil {
+		s.Release()
+		return nil, e
+	}
+	name := "com.apple.TimeMachine." + date + ".local"
+	if out, e := exec.Command("mount_apfs", "-o", "ro,nobrowse", "-s", name, mountPoint, s.mounted).CombinedOutput(); e != nil {
+		s.Release()
+		return nil, fmt.Errorf("mount_apfs: %s", strings.TrimSpace(string(out)))
+	}
+	return s, nil
+}
+
+func cString(b []int8) string {
+	var s []byte
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		s = append(s, byte(c))
+	}
+	return string(s)
+}
+
+// Path implements volumeSnapshot interface.
+func (a *apfsSnapshot) Path(live string) string {
+	rel, e := filepath.Rel(a.mountPoint, live)
+	if e != nil {
+		return live
+	}
+	return filepath.Join(a.mounted, rel)
+}
+
+// Release implements volumeSnapshot interface.
+func (a *apfsSnapshot) Release() error {
+	if a.mounted != "" {
+		exec.Command("umount", a.mounted).Run()
+		os.Remove(a.mounted)
+	}
+	if out, e := exec.Command("tmutil", "deletelocalsnapshots", a.date).CombinedOutput(); e != nil {
+		return fmt.Errorf("tmutil deletelocalsnapshots: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// vssSnapshot is a Volume Shadow Copy. Creating it requires administrator privileges.
+type vssSnapshot struct {
+	id     string
+	volume string
+	device string
+}
+
+func powershell(script string) (string, error) {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	out, e := cmd.CombinedOutput()
+	if e != nil {
+		return "", fmt.Errorf("%s: %s", e.Error(), strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func createVolumeSnapshot(root string) (volumeSnapshot, error) {
+	abs, e := filepath.Abs(root)
+	if e != nil {
+		return nil, e
+	}
+	volume := filepath.VolumeName(abs) + `\`
+	out, e := powershell(fmt.Sprintf(`$r = ([WMICLASS]"root\cimv2:Win32_ShadowCopy").Create("%s", "ClientAccessible"); `+
+		`if ($r.ReturnValue -ne 0) { Write-Output "Error $($r.ReturnValue)"; exit 1 }; `+
+		`$s = Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq $r.ShadowID }; `+
+		`Write-Output $s.ID; Write-Output $s.DeviceObject`, volume))
+	if e != nil {
+		return nil, e
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected output when creating shadow copy: %s", out)
+	}
+	return &vssSnapshot{
+		id:     strings.TrimSpace(lines[0]),
+		volume: volume,
+		device: strings.TrimSpace(lines[1]),
+	}, nil
+}
+
+// Path implements volumeSnapshot interface.
+func (v *vssSnapshot) Path(live string) string {
+	if len(live) < len(v.volume) || !strings.EqualFold(live[:len(v.volume)], v.volume) {
+		return live
+	}
+	return v.device + `\` + live[len(v.volume):]
+}
+
+// Release implements volumeSnapshot interface.
+func (v *vssSnapshot) Release() error {
+	_, e := powershell(fmt.Sprintf(`Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq '%s' } | ForEach-Object { $_.Delete() }`, v.id))
+	return e
+}
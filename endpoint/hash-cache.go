@@ -0,0 +1,428 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+var hashesBucket = []byte("hashes")
+
+// hashCacheFlush is the number of entries recorded during a walk before they are written to the DB.
+const hashCacheFlush = 1000
+
+// hashEntry is the metadata of a local file when its hash was computed.
+type hashEntry struct {
+	Size  int64
+	MTime int64
+	Inode uint64
+	Etag  string
+	// Recorded is the time when the hash was computed
+	Recorded int64 `json:"Recorded,omitempty"`
+}
+
+// HashCache persists the hashes of the files of a local endpoint, keyed by path, so that files whose size,
+// modification time and inode did not change are not hashed again on the next walk. It is also registered
+// as the reference hash store of the filesystem client. The identities of the folders are kept along, to
+// recognize moved folders. It is based on BoltDB.
+type HashCache struct {
+	sync.Mutex
+	db      *bbolt.DB
+	root    string
+	name    string
+	ref     model.PathSyncSource
+	pending map[string]*hashEntry
+	folders map[string]string
+	flushAt int
+	workers int
+}
+
+// HashCacheFile returns the path of the hash cache of one side of a task.
+func HashCacheFile(configPath, name string) string {
+	return filepath.Join(configPath, "hashes-"+name)
+}
+
+// OpenHashCache opens or creates the hash cache of the local folder root, for one side (left or right) of a task.
+func OpenHashCache(configPath, name, root string) (*HashCache, error) {
+	db, e := bbolt.Open(HashCacheFile(configPath, name), 0644, BoltOptions(2*time.Second))
+	if e == bbolt.ErrTimeout {
+		return nil, fmt.Errorf("hash cache %s is in use, please stop cells-sync first", name)
+	} else if e != nil {
+		return nil, e
+	}
+	return &HashCache{db: db, root: root, name: name, pending: make(map[string]*hashEntry), folders: make(map[string]string), flushAt: hashCacheFlush, workers: runtime.NumCPU()}, nil
+}
+
+// SetFlushThreshold changes the number of entries kept in memory before they are written to the DB.
+func (h *HashCache) SetFlushThreshold(n int) {
+	if n < 1 {
+		n = 1
+	}
+	h.Lock()
+	h.flushAt = n
+	h.Unlock()
+}
+
+// InvalidateHashCache removes the hash cache of one side of a task, so that all files are hashed again.
+func InvalidateHashCache(configPath, name string) error {
+	if e := os.Remove(HashCacheFile(configPath, name)); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+	return nil
+}
+
+// SetHashCache registers a hash cache on a local endpoint. It returns false if the endpoint is not local.
+func SetHashCache(ep model.Endpoint, cache *HashCache) bool {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return false
+	}
+	c.hashes = cache
+	c.FSClient.SetRefHashStore(cache)
+	return true
+}
+
+// SetRefHashStore keeps the hash cache in front of the reference store set by the sync task.
+func (c *localFS) SetRefHashStore(source model.PathSyncSource) {
+	if c.hashes == nil {
+		c.FSClient.SetRefHashStore(source)
+		return
+	}
+	c.hashes.ref = source
+}
+
+// stat reads the metadata of a local file, or returns nil if it is not a regular file.
+func (h *HashCache) stat(p string) (os.FileInfo, *hashEntry) {
+	info, e := os.Stat(filepath.Join(h.root, filepath.FromSlash(strings.Trim(p, "/"))))
+	if e != nil || !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	return info, &hashEntry{Size: info.Size(), MTime: info.ModTime().UnixNano(), Inode: fileInode(info)}
+}
+
+// lookup returns the cached hash of a file if its metadata did not change. Hashes computed right after the last
+// modification are not trusted, as a later write may have kept the same size and modification time.
+func (h *HashCache) lookup(p string) (os.FileInfo, string) {
+	info, current := h.stat(p)
+	if current == nil {
+		return nil, ""
+	}
+	cached := h.entry(p)
+	if cached == nil || cached.Etag == "" || cached.Size != current.Size || cached.MTime != current.MTime || cached.Inode != current.Inode {
+		return info, ""
+	}
+	if cached.Recorded > 0 && RacyHash(time.Unix(0, cached.MTime), time.Unix(0, cached.Recorded)) {
+		return info, ""
+	}
+	return info, cached.Etag
+}
+
+// entry returns the cached metadata of a file, or nil if it is not in the cache.
+func (h *HashCache) entry(p string) (cached *hashEntry) {
+	key := strings.Trim(p, "/")
+	h.Lock()
+	cached, ok := h.pending[key]
+	h.Unlock()
+	if ok {
+		return
+	}
+	h.db.View(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket(hashesBucket); bucket != nil {
+			if data := bucket.Get([]byte(key)); data != nil {
+				var entry hashEntry
+				if json.Unmarshal(data, &entry) == nil {
+					cached = &entry
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// record registers the hash of a file. Entries are kept in memory until flush is called, or until there are
+// enough of them.
+func (h *HashCache) record(p string, etag string) {
+	if etag == "" || etag == "-1" {
+		return
+	}
+	_, entry := h.stat(p)
+	if entry == nil {
+		return
+	}
+	entry.Etag = etag
+	entry.Recorded = time.Now().UnixNano()
+	h.Lock()
+	h.pending[strings.Trim(p, "/")] = entry
+	full := len(h.pending) >= h.flushAt
+	h.Unlock()
+	if full {
+		h.flush()
+	}
+}
+
+// flush writes the pending entries and folder identities to the DB.
+func (h *HashCache) flush() {
+	h.Lock()
+	pending, folders := h.pending, h.folders
+	h.pending = make(map[string]*hashEntry)
+	h.folders = make(map[string]string)
+	h.Unlock()
+	if len(pending) == 0 && len(folders) == 0 {
+		return
+	}
+	e := h.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(hashesBucket)
+		if err != nil {
+			return err
+		}
+		for k, entry := range pending {
+			data, _ := json.Marshal(entry)
+			if err := bucket.Put([]byte(k), data); err != nil {
+				return err
+			}
+		}
+		fBucket, err := tx.CreateBucketIfNotExists(foldersBucket)
+		if err != nil {
+			return err
+		}
+		for k, uuid := range folders {
+			if err := fBucket.Put([]byte(k), []byte(uuid)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if e != nil {
+		log.Logger(context.Background()).Error("Cannot write hash cache " + h.name + ": " + e.Error())
+	}
+}
+
+// Invalidate removes the cached hashes of a path and all its children. An empty path clears the whole cache.
+func (h *HashCache) Invalidate(p string) error {
+	return h.rename(strings.Trim(p, "/"), "", true)
+}
+
+// move keeps the cached hashes and folder identities of a moved path.
+func (h *HashCache) move(from, to string) {
+	if e := h.rename(strings.Trim(from, "/"), strings.Trim(to, "/"), false); e != nil {
+		log.Logger(context.Background()).Error("Cannot update hash cache " + h.name + ": " + e.Error())
+	}
+}
+
+// rename moves or deletes the entries and folder identities of a path and its children, in memory and in the DB.
+func (h *HashCache) rename(from, to string, remove bool) error {
+	under := func(k string) bool {
+		return from == "" || k == from || strings.HasPrefix(k, from+"/")
+	}
+	target := func(k string) string {
+		return to + strings.TrimPrefix(k, from)
+	}
+	h.Lock()
+	for k, entry := range h.pending {
+		if under(k) {
+			delete(h.pending, k)
+			if !remove {
+				h.pending[target(k)] = entry
+			}
+		}
+	}
+	for k, uuid := range h.folders {
+		if under(k) {
+			delete(h.folders, k)
+			if !remove {
+				h.folders[target(k)] = uuid
+			}
+		}
+	}
+	h.Unlock()
+	return h.db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{hashesBucket, foldersBucket} {
+			bucket := tx.Bucket(name)
+			if bucket == nil {
+				continue
+			}
+			moves := make(map[string][]byte)
+			c := bucket.Cursor()
+			for k, v := c.Seek([]byte(from)); k != nil && strings.HasPrefix(string(k), from); k, v = c.Next() {
+				if under(string(k)) {
+					moves[string(k)] = append([]byte{}, v...)
+				}
+			}
+			for k, v := range moves {
+				if e := bucket.Delete([]byte(k)); e != nil {
+					return e
+				}
+				if remove {
+					continue
+				}
+				if e := bucket.Put([]byte(target(k)), v); e != nil {
+					return e
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// pathsUnder lists the cached files below a folder, "" or "." for the whole cache.
+func (h *HashCache) pathsUnder(folder string) (paths []string) {
+	h.flush()
+	prefix := strings.Trim(folder, "/")
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	h.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(hashesBucket)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			paths = append(paths, string(k))
+		}
+		return nil
+	})
+	return
+}
+
+// Rebuild clears the cache and hashes all files of the local folder again, reading the folder identities along.
+func (h *HashCache) Rebuild(ctx context.Context) (count int, e error) {
+	if e = h.Invalidate(""); e != nil {
+		return
+	}
+	e = filepath.Walk(h.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, er := filepath.Rel(h.root, p)
+		if er != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if rel != "." {
+				h.recordFolder(filepath.ToSlash(rel), folderIdentity(p))
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		etag, er := fileMD5(p)
+		if er != nil {
+			log.Logger(ctx).Error("Cannot hash " + p + ": " + er.Error())
+			return nil
+		}
+		h.record(filepath.ToSlash(rel), etag)
+		count++
+		return nil
+	})
+	h.flush()
+	return
+}
+
+// Close writes the pending entries and closes the DB.
+func (h *HashCache) Close() error {
+	h.flush()
+	return h.db.Close()
+}
+
+// LoadNode implements model.Endpoint interface, as the reference hash store of the filesystem client. It only
+// finds files whose metadata did not change since they were hashed, and falls back to the reference store set
+// by the sync task otherwise.
+func (h *HashCache) LoadNode(ctx context.Context, p string, extendedStats ...bool) (*tree.Node, error) {
+	if info, etag := h.lookup(p); etag != "" {
+		return &tree.Node{
+			Path:  strings.Trim(p, "/"),
+			Type:  tree.NodeType_LEAF,
+			Etag:  etag,
+			Size:  info.Size(),
+			MTime: info.ModTime().Unix(),
+		}, nil
+	}
+	if h.ref != nil {
+		return h.ref.LoadNode(ctx, p, extendedStats...)
+	}
+	return nil, os.ErrNotExist
+}
+
+// GetEndpointInfo implements model.Endpoint interface.
+func (h *HashCache) GetEndpointInfo() model.EndpointInfo {
+	return model.EndpointInfo{URI: "hashes://" + h.name}
+}
+
+// Walk implements model.PathSyncSource interface by listing the cached entries.
+func (h *HashCache) Walk(walknFc model.WalkNodesFunc, root string, recursive bool) error {
+	h.flush()
+	prefix := strings.Trim(root, "/")
+	return h.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(hashesBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			key := string(k)
+			if prefix != "" && !strings.HasPrefix(key, prefix+"/") {
+				return nil
+			}
+			if !recursive && strings.Contains(strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/"), "/") {
+				return nil
+			}
+			var entry hashEntry
+			if json.Unmarshal(v, &entry) != nil {
+				return nil
+			}
+			walknFc(key, &tree.Node{
+				Path:  key,
+				Type:  tree.NodeType_LEAF,
+				Etag:  entry.Etag,
+				Size:  entry.Size,
+				MTime: time.Unix(0, entry.MTime).Unix(),
+			}, nil)
+			return nil
+		})
+	})
+}
+
+// Watch implements model.PathSyncSource interface. A hash cache cannot be watched.
+func (h *HashCache) Watch(recursivePath string) (*model.WatchObject, error) {
+	return nil, errors.New("hash cache cannot be watched")
+}
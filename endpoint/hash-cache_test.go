@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestHashCache creates a local folder with its hash cache.
+func newTestHashCache(t *testing.T) (root, configPath string, cache *HashCache, cleanup func()) {
+	root, e := ioutil.TempDir("", "hash-cache-root")
+	if e != nil {
+		t.Fatal(e)
+	}
+	configPath, e = ioutil.TempDir("", "hash-cache-config")
+	if e != nil {
+		t.Fatal(e)
+	}
+	cache, e = OpenHashCache(configPath, "left", root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return root, configPath, cache, func() {
+		cache.Close()
+		os.RemoveAll(root)
+		os.RemoveAll(configPath)
+	}
+}
+
+// writeOldFile writes a file with a modification time far enough in the past for its hash to be trusted.
+func writeOldFile(t *testing.T, root, p, content string, mtime time.Time) {
+	full := filepath.Join(root, filepath.FromSlash(p))
+	if e := os.MkdirAll(filepath.Dir(full), 0755); e != nil {
+		t.Fatal(e)
+	}
+	if e := ioutil.WriteFile(full, []byte(content), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.Chtimes(full, mtime, mtime); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// TestHashCacheLookup checks that cached hashes are only used while the file metadata did not change.
+func TestHashCacheLookup(t *testing.T) {
+	old := time.Now().Add(-1 * time.Hour)
+	cases := []struct {
+		name   string
+		etag   string
+		change func(root string)
+		found  string
+	}{
+		{"unchanged", "etag", nil, "etag"},
+		{"invalid hash", "-1", nil, ""},
+		{"size changed", "etag", func(root string) { writeOldFile(t, root, "file.txt", "longer content", old) }, ""},
+		{"mtime changed", "etag", func(root string) { writeOldFile(t, root, "file.txt", "content", old.Add(time.Minute)) }, ""},
+		{"rewritten now", "etag", func(root string) { writeOldFile(t, root, "file.txt", "content", time.Now()) }, ""},
+		{"removed", "etag", func(root string) { os.Remove(filepath.Join(root, "file.txt")) }, ""},
+	}
+	for _, c := range cases {
+		root, _, cache, cleanup := newTestHashCache(t)
+		writeOldFile(t, root, "file.txt", "content", old)
+		cache.record("/file.txt", c.etag)
+		if c.change != nil {
+			c.change(root)
+		}
+		if _, etag := cache.lookup("file.txt"); etag != c.found {
+			t.Errorf("%s: expected %q, got %q", c.name, c.found, etag)
+		}
+		cleanup()
+	}
+}
+
+// TestHashCacheRecentHash checks that a hash computed right after the last write is not trusted.
+func TestHashCacheRecentHash(t *testing.T) {
+	root, _, cache, cleanup := newTestHashCache(t)
+	defer cleanup()
+	writeOldFile(t, root, "file.txt", "content", time.Now())
+	cache.record("file.txt", "etag")
+	if _, etag := cache.lookup("file.txt"); etag != "" {
+		t.Errorf("expected racy hash to be ignored, got %q", etag)
+	}
+}
+
+// TestHashCacheMoves checks the entries kept, moved and removed, in memory and once written to the DB.
+func TestHashCacheMoves(t *testing.T) {
+	old := time.Now().Add(-1 * time.Hour)
+	for _, flushAt := range []int{1, hashCacheFlush} {
+		root, _, cache, cleanup := newTestHashCache(t)
+		cache.SetFlushThreshold(flushAt)
+		for _, p := range []string{"a/one.txt", "a/two.txt", "ab/three.txt", "b/four.txt"} {
+			writeOldFile(t, root, p, p, old)
+			cache.record(p, "etag-"+p)
+		}
+		cache.move("a", "c")
+		if e := cache.Invalidate("b"); e != nil {
+			t.Fatal(e)
+		}
+		expected := []string{"ab/three.txt", "c/one.txt", "c/two.txt"}
+		if paths := cache.pathsUnder(""); !reflect.DeepEqual(paths, expected) {
+			t.Errorf("flush at %d: expected %v, got %v", flushAt, expected, paths)
+		}
+		if paths := cache.pathsUnder("/c/"); !reflect.DeepEqual(paths, expected[1:]) {
+			t.Errorf("flush at %d: expected %v under c, got %v", flushAt, expected[1:], paths)
+		}
+		if entry := cache.entry("c/one.txt"); entry == nil || entry.Etag != "etag-a/one.txt" {
+			t.Errorf("flush at %d: moved entry should keep its hash, got %v", flushAt, entry)
+		}
+		cleanup()
+	}
+}
+
+// TestHashCachePersistence checks that hashes survive a restart and that Rebuild hashes all files again.
+func TestHashCachePersistence(t *testing.T) {
+	root, configPath, cache, cleanup := newTestHashCache(t)
+	defer cleanup()
+	old := time.Now().Add(-1 * time.Hour)
+	writeOldFile(t, root, "folder/file.txt", "content", old)
+	cache.record("folder/file.txt", "etag")
+	if e := cache.Close(); e != nil {
+		t.Fatal(e)
+	}
+	reopened, e := OpenHashCache(configPath, "left", root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer reopened.Close()
+	if _, etag := reopened.lookup("folder/file.txt"); etag != "etag" {
+		t.Errorf("expected hash to be persisted, got %q", etag)
+	}
+	count, e := reopened.Rebuild(context.Background())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 file hashed, got %d", count)
+	}
+	if entry := reopened.entry("folder/file.txt"); entry == nil || entry.Etag == "etag" || entry.Etag == "" {
+		t.Errorf("expected hash to be computed again, got %v", entry)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	HiddenFilesSync         = "sync"
+	HiddenFilesIgnore       = "ignore"
+	HiddenFilesDownloadOnly = "download-only"
+)
+
+// HiddenFilesIgnores returns the filter patterns for ignoring hidden files.
+func HiddenFilesIgnores() []string {
+	return []string{"**/.*"}
+}
+
+// IsHiddenPath checks if any component of the path starts with a dot.
+func IsHiddenPath(p string) bool {
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// WithHiddenFilesPolicy configures the remote endpoint of a task to skip uploads of hidden files when the policy
+// is "download-only". Other endpoints and policies are returned untouched.
+func WithHiddenFilesPolicy(ep model.Endpoint, policy string) model.Endpoint {
+	if r, ok := ep.(*remoteFS); ok && policy == HiddenFilesDownloadOnly {
+		r.skipHiddenUploads = true
+	}
+	return ep
+}
+
+type discardWriter struct {
+	done chan bool
+}
+
+func (d *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (d *discardWriter) Close() error {
+	d.done <- true
+	return nil
+}
+
+// markHidden sets the hidden attribute on a local file if its name starts with a dot, so that files
+// hidden on the source are also hidden on platforms relying on attributes.
+func markHidden(root, p string) {
+	if strings.HasPrefix(path.Base(p), ".") {
+		setHiddenAttribute(filepath.Join(root, filepath.FromSlash(strings.TrimLeft(p, "/"))))
+	}
+}
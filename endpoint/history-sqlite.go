@@ -0,0 +1,130 @@
+// +build sqlite
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+func init() {
+	historyBackends[config.HistorySQLite] = openSQLiteHistory
+}
+
+// sqliteHistory stores the records in a single table of a SQLite database. In WAL mode, the history can be read
+// by other processes while the agent writes to it.
+type sqliteHistory struct {
+	db *sql.DB
+}
+
+func openSQLiteHistory(folder string) (HistoryBackend, error) {
+	db, e := sql.Open("sqlite3", filepath.Join(folder, "history.sqlite")+"?_busy_timeout=5000&_journal_mode=WAL")
+	if e != nil {
+		return nil, e
+	}
+	if _, e := db.Exec(`CREATE TABLE IF NOT EXISTS history (kind TEXT NOT NULL, key TEXT NOT NULL, value BLOB, PRIMARY KEY (kind, key))`); e != nil {
+		db.Close()
+		return nil, e
+	}
+	return &sqliteHistory{db: db}, nil
+}
+
+func (s *sqliteHistory) Put(kind, key string, value []byte) error {
+	_, e := s.db.Exec(`INSERT OR REPLACE INTO history (kind, key, value) VALUES (?, ?, ?)`, kind, key, value)
+	return e
+}
+
+func (s *sqliteHistory) Get(kind, key string) (value []byte, e error) {
+	e = s.db.QueryRow(`SELECT value FROM history WHERE kind = ? AND key = ?`, kind, key).Scan(&value)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	}
+	return
+}
+
+func (s *sqliteHistory) Walk(kind, from, to string, reverse bool, fn func(key string, value []byte) bool) error {
+	query := []string{`SELECT key, value FROM history WHERE kind = ?`}
+	args := []interface{}{kind}
+	if from != "" {
+		query = append(query, `AND key >= ?`)
+		args = append(args, from)
+	}
+	if to != "" {
+		query = append(query, `AND key < ?`)
+		args = append(args, to)
+	}
+	if reverse {
+		query = append(query, `ORDER BY key DESC`)
+	} else {
+		query = append(query, `ORDER BY key ASC`)
+	}
+	rows, e := s.db.Query(strings.Join(query, " "), args...)
+	if e != nil {
+		return e
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value []byte
+		if e := rows.Scan(&key, &value); e != nil {
+			return e
+		}
+		if !fn(key, value) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteHistory) Delete(kind string, keys []string) error {
+	tx, e := s.db.Begin()
+	if e != nil {
+		return e
+	}
+	stmt, e := tx.Prepare(`DELETE FROM history WHERE kind = ? AND key = ?`)
+	if e != nil {
+		tx.Rollback()
+		return e
+	}
+	defer stmt.Close()
+	for _, k := range keys {
+		if _, e := stmt.Exec(kind, k); e != nil {
+			tx.Rollback()
+			return e
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteHistory) Size() (size int64, e error) {
+	e = s.db.QueryRow(`SELECT COALESCE(SUM(LENGTH(key) + LENGTH(value)), 0) FROM history`).Scan(&size)
+	return
+}
+
+func (s *sqliteHistory) Close() error {
+	return s.db.Close()
+}
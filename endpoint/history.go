@@ -0,0 +1,285 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	// HistoryPatches holds the patches applied by the task
+	HistoryPatches = "patches"
+	// HistoryAudit holds the audit trail of the task
+	HistoryAudit = "audit"
+	// HistoryStats holds the hourly transfer stats of the task
+	HistoryStats = "stats"
+
+	historyKeyFormat     = "2006-01-02T15:04:05.000000000Z"
+	historyPruneInterval = time.Hour
+)
+
+var historyKinds = []string{HistoryPatches, HistoryAudit, HistoryStats}
+
+// HistoryBackend stores the history records of a task by kind. Keys start with a UTC timestamp (see HistoryKey),
+// so that records are sorted chronologically and can be pruned by age.
+type HistoryBackend interface {
+	Put(kind, key string, value []byte) error
+	// Get returns nil if the record does not exist
+	Get(kind, key string) ([]byte, error)
+	// Walk calls fn on the records of a kind with from <= key < to (empty for no bound), in reverse order if reverse
+	// is set, until fn returns false. Values are only valid during the call.
+	Walk(kind, from, to string, reverse bool, fn func(key string, value []byte) bool) error
+	Delete(kind string, keys []string) error
+	// Size returns the space used by the records, in bytes
+	Size() (int64, error)
+	Close() error
+}
+
+var historyBackends = map[string]func(folder string) (HistoryBackend, error){
+	config.HistoryBolt: openBoltHistory,
+}
+
+// HistoryBackendAvailable checks if a backend is supported by this build.
+func HistoryBackendAvailable(backend string) bool {
+	_, ok := historyBackends[backend]
+	return ok
+}
+
+// HistoryKey builds the key of a record from its time and an optional identifier.
+func HistoryKey(t time.Time, id string) string {
+	k := t.UTC().Format(historyKeyFormat)
+	if id != "" {
+		k += " " + id
+	}
+	return k
+}
+
+// History is the storage of the run history, audit trail and stats of a task. Records older than the retention
+// are pruned when it opens and every hour, as well as the oldest records when it grows over maxBytes.
+type History struct {
+	HistoryBackend
+	retention time.Duration
+	maxBytes  int64
+	done      chan bool
+}
+
+// OpenHistory opens the history stored in folder with a backend.
+func OpenHistory(folder, backend string, retention time.Duration, maxBytes int64) (*History, error) {
+	open, ok := historyBackends[backend]
+	if !ok {
+		return nil, fmt.Errorf("unsupported history backend %s", backend)
+	}
+	b, e := open(folder)
+	if e != nil {
+		return nil, e
+	}
+	h := &History{HistoryBackend: b, retention: retention, maxBytes: maxBytes, done: make(chan bool)}
+	go h.prune()
+	return h, nil
+}
+
+// Close stops pruning and closes the backend.
+func (h *History) Close() error {
+	close(h.done)
+	return h.HistoryBackend.Close()
+}
+
+func (h *History) prune() {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+	for {
+		if pruned, e := h.Prune(time.Now()); e != nil {
+			log.Logger(context.Background()).Error("Cannot prune history: " + e.Error())
+		} else if pruned > 0 {
+			log.Logger(context.Background()).Info(fmt.Sprintf("Pruned %d history records", pruned))
+		}
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Prune removes the records older than the retention, then the oldest tenth of each kind of records until the
+// history fits in its maximum size.
+func (h *History) Prune(now time.Time) (pruned int, e error) {
+	if h.retention > 0 {
+		limit := HistoryKey(now.Add(-h.retention), "")
+		for _, kind := range historyKinds {
+			n, er := h.pruneKind(kind, limit, 0)
+			if er != nil {
+				return pruned, er
+			}
+			pruned += n
+		}
+	}
+	if h.maxBytes <= 0 {
+		return
+	}
+	for {
+		size, er := h.Size()
+		if er != nil || size <= h.maxBytes {
+			return pruned, er
+		}
+		var round int
+		for _, kind := range historyKinds {
+			n, er := h.pruneKind(kind, "", 10)
+			if er != nil {
+				return pruned, er
+			}
+			round += n
+		}
+		if round == 0 {
+			return
+		}
+		pruned += round
+	}
+}
+
+// pruneKind removes the records of a kind before limit, or the oldest 1/fraction of them if fraction is set.
+func (h *History) pruneKind(kind, limit string, fraction int) (int, error) {
+	var keys []string
+	e := h.Walk(kind, "", limit, false, func(key string, _ []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if e != nil {
+		return 0, e
+	}
+	if fraction > 0 && len(keys) > 0 {
+		keys = keys[:len(keys)/fraction+1]
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return len(keys), h.Delete(kind, keys)
+}
+
+// boltHistory stores each kind of records in a bucket of a BoltDB file.
+type boltHistory struct {
+	db *bbolt.DB
+}
+
+func openBoltHistory(folder string) (HistoryBackend, error) {
+	db, e := bbolt.Open(filepath.Join(folder, "history"), 0644, BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	return &boltHistory{db: db}, nil
+}
+
+func (b *boltHistory) Put(kind, key string, value []byte) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket, e := tx.CreateBucketIfNotExists([]byte(kind))
+		if e != nil {
+			return e
+		}
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+func (b *boltHistory) Get(kind, key string) (value []byte, e error) {
+	e = b.db.View(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket([]byte(kind)); bucket != nil {
+			if v := bucket.Get([]byte(key)); v != nil {
+				value = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (b *boltHistory) Walk(kind, from, to string, reverse bool, fn func(key string, value []byte) bool) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(kind))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		if !reverse {
+			k, v := c.First()
+			if from != "" {
+				k, v = c.Seek([]byte(from))
+			}
+			for ; k != nil && (to == "" || string(k) < to); k, v = c.Next() {
+				if !fn(string(k), v) {
+					break
+				}
+			}
+			return nil
+		}
+		k, v := c.Last()
+		if to != "" {
+			if k, v = c.Seek([]byte(to)); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil && (from == "" || string(k) >= from); k, v = c.Prev() {
+			if !fn(string(k), v) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltHistory) Delete(kind string, keys []string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(kind))
+		if bucket == nil {
+			return nil
+		}
+		for _, k := range keys {
+			if e := bucket.Delete([]byte(k)); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// Size sums the space used in the pages of the buckets: the file itself does not shrink when records are deleted,
+// freed pages are reused.
+func (b *boltHistory) Size() (size int64, e error) {
+	e = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(_ []byte, bucket *bbolt.Bucket) error {
+			stats := bucket.Stats()
+			size += int64(stats.LeafInuse + stats.BranchInuse + stats.InlineBucketInuse)
+			return nil
+		})
+	})
+	return
+}
+
+func (b *boltHistory) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// IgnoreFile is the name of the file listing ignore patterns at the root of a local folder.
+const IgnoreFile = ".pydio-ignore"
+
+// ErrIgnored is returned when the engine tries to write a path excluded by the ignore rules.
+var ErrIgnored = errors.New("path is excluded by ignore rules")
+
+// ignoreRule is a compiled gitignore-like pattern.
+type ignoreRule struct {
+	pattern string
+	glob    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreRules matches local paths against the task patterns and the patterns of the .pydio-ignore file. Patterns
+// follow the gitignore syntax: a pattern without slash matches a name at any level, a leading slash anchors it
+// at the root, a trailing slash only matches folders, "**" matches any number of folders and "!" re-includes
+// a path excluded by a previous pattern.
+type IgnoreRules struct {
+	sync.RWMutex
+	root     string
+	patterns []string
+	rules    []*ignoreRule
+	onChange func()
+}
+
+// NewIgnoreRules compiles the task patterns and loads the .pydio-ignore file of root, if any.
+func NewIgnoreRules(root string, patterns []string) (*IgnoreRules, error) {
+	r := &IgnoreRules{root: root, patterns: patterns}
+	for _, p := range patterns {
+		if _, e := parseIgnoreRule(p); e != nil {
+			return nil, e
+		}
+	}
+	if e := r.Reload(); e != nil {
+		return nil, e
+	}
+	return r, nil
+}
+
+// ValidateIgnorePatterns checks that patterns can be compiled, without loading any ignore file.
+func ValidateIgnorePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, e := parseIgnoreRule(p); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// parseIgnoreRule compiles one line of an ignore file. It returns nil for blank lines and comments.
+func parseIgnoreRule(line string) (*ignoreRule, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	rule := &ignoreRule{pattern: line}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, fmt.Errorf("invalid ignore pattern %s", rule.pattern)
+	}
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	rule.glob = strings.Trim(line, "/")
+	re, e := globToRegexp(line)
+	if e != nil {
+		return nil, fmt.Errorf("invalid ignore pattern %s: %s", rule.pattern, e.Error())
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// Reload reads the .pydio-ignore file again. Invalid lines are logged and skipped, as the file is edited by hand.
+func (r *IgnoreRules) Reload() error {
+	var rules []*ignoreRule
+	for _, p := range r.patterns {
+		if rule, _ := parseIgnoreRule(p); rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	f, e := os.Open(filepath.Join(r.root, IgnoreFile))
+	if e != nil && !os.IsNotExist(e) {
+		return e
+	} else if e == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			rule, er := parseIgnoreRule(scanner.Text())
+			if er != nil {
+				log.Logger(context.Background()).Warn("Skipping line of " + IgnoreFile + ": " + er.Error())
+				continue
+			}
+			if rule != nil {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	r.Lock()
+	r.rules = rules
+	r.Unlock()
+	return nil
+}
+
+// Ignored checks if a path relative to the root is excluded, either directly or through one of its parents.
+func (r *IgnoreRules) Ignored(p string, dir bool) bool {
+	p = strings.Trim(p, "/")
+	if p == "" || p == IgnoreFile {
+		return false
+	}
+	r.RLock()
+	defer r.RUnlock()
+	parts := strings.Split(p, "/")
+	for i := 1; i <= len(parts); i++ {
+		if r.match(strings.Join(parts[:i], "/"), i < len(parts) || dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies the rules in order on a single path, the last matching rule wins.
+func (r *IgnoreRules) match(p string, dir bool) (ignored bool) {
+	for _, rule := range r.rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return
+}
+
+// Filters converts the rules into filter patterns for the sync task, so that ignored paths are also excluded on
+// the other side. Negated patterns cannot be expressed as filters and only apply to the local folder.
+func (r *IgnoreRules) Filters() (filters []string) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, rule := range r.rules {
+		if rule.negate {
+			continue
+		}
+		if !rule.dirOnly {
+			filters = append(filters, rule.glob)
+		}
+		filters = append(filters, rule.glob+"/**")
+	}
+	return
+}
+
+// OnChange registers a callback invoked after the .pydio-ignore file was modified and reloaded.
+func (r *IgnoreRules) OnChange(f func()) {
+	r.onChange = f
+}
+
+// SetIgnoreRules excludes ignored paths from the walks, the watcher events and the writes of a local endpoint.
+func SetIgnoreRules(ep model.Endpoint, rules *IgnoreRules) bool {
+	if c, ok := ep.(*localFS); ok {
+		c.ignores = rules
+		return true
+	}
+	return false
+}
+
+// filterIgnored returns a copy of the watch object that drops events on ignored paths, and reloads the rules
+// when the .pydio-ignore file changes.
+func (c *localFS) filterIgnored(main *model.WatchObject) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					close(out.EventInfoChan)
+					return
+				}
+				if strings.Trim(ev.Path, "/") == IgnoreFile {
+					c.reloadIgnores()
+				} else if c.ignores.Ignored(ev.Path, ev.Folder) {
+					continue
+				}
+				select {
+				case out.EventInfoChan <- ev:
+				case <-main.Done():
+					return
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
+
+// reloadIgnores reloads the rules after the .pydio-ignore file was modified.
+func (c *localFS) reloadIgnores() {
+	if e := c.ignores.Reload(); e != nil {
+		log.Logger(context.Background()).Error("Cannot reload " + IgnoreFile + ": " + e.Error())
+		return
+	}
+	log.Logger(context.Background()).Info("Reloaded ignore rules from " + IgnoreFile)
+	if c.ignores.onChange != nil {
+		c.ignores.onChange()
+	}
+}
+
+// ignoredWrite checks if the engine is about to write an ignored path.
+func (c *localFS) ignoredWrite(p string, dir bool) error {
+	if c.ignores != nil && c.ignores.Ignored(p, dir) {
+		return errors.Wrap(ErrIgnored, p)
+	}
+	return nil
+}
+
+// isDir checks if a local path is an existing folder.
+func (c *localFS) isDir(p string) bool {
+	info, e := os.Stat(filepath.Join(c.root, filepath.FromSlash(strings.TrimLeft(p, "/"))))
+	return e == nil && info.IsDir()
+}
+
+// hasIgnored checks if a local folder contains ignored entries.
+func (c *localFS) hasIgnored(p string) (found bool) {
+	if c.ignores == nil {
+		return false
+	}
+	root := filepath.Join(c.root, filepath.FromSlash(strings.TrimLeft(p, "/")))
+	filepath.Walk(root, func(fp string, info os.FileInfo, err error) error {
+		if err != nil || fp == root {
+			return nil
+		}
+		rel, er := filepath.Rel(c.root, fp)
+		if er == nil && c.ignores.Ignored(filepath.ToSlash(rel), info.IsDir()) {
+			found = true
+			return io.EOF
+		}
+		return nil
+	})
+	return
+}
+
+// deleteKeepingIgnored deletes the entries of a folder one by one, so that ignored entries are preserved. The
+// folder itself is only removed if it ends up empty.
+func (c *localFS) deleteKeepingIgnored(ctx context.Context, p string) error {
+	folder := filepath.Join(c.root, filepath.FromSlash(strings.TrimLeft(p, "/")))
+	infos, e := ioutil.ReadDir(folder)
+	if e != nil {
+		return e
+	}
+	for _, info := range infos {
+		child := path.Join(p, info.Name())
+		if c.ignores.Ignored(child, info.IsDir()) {
+			continue
+		}
+		if e := c.DeleteNode(ctx, child); e != nil {
+			return e
+		}
+	}
+	if e := os.Remove(folder); e != nil {
+		log.Logger(ctx).Info("Keeping folder " + p + " as it contains ignored entries")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestIgnoreRules checks the gitignore-like matching of the task patterns.
+func TestIgnoreRules(t *testing.T) {
+	root, e := ioutil.TempDir("", "ignore-rules")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(root)
+	rules, e := NewIgnoreRules(root, []string{"# comment", "", "*.tmp", "!keep.tmp", "/build", "cache/", "docs/**/draft.md"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := []struct {
+		path    string
+		dir     bool
+		ignored bool
+	}{
+		{"", true, false},
+		{IgnoreFile, false, false},
+		{"a.tmp", false, true},
+		{"/folder/a.tmp", false, true},
+		{"a.tmpx", false, false},
+		{"keep.tmp", false, false},
+		{"folder/keep.tmp", false, false},
+		{"build", true, true},
+		{"build/out.o", false, true},
+		{"src/build", true, false},
+		{"cache", false, false},
+		{"cache", true, true},
+		{"sub/cache/file.txt", false, true},
+		{"docs/draft.md", false, true},
+		{"docs/a/b/draft.md", false, true},
+		{"other/draft.md", false, false},
+		{"a.tmp/inside.txt", false, true},
+	}
+	for _, c := range cases {
+		if ignored := rules.Ignored(c.path, c.dir); ignored != c.ignored {
+			t.Errorf("%q (dir=%v): expected ignored=%v", c.path, c.dir, c.ignored)
+		}
+	}
+	expected := []string{"**/*.tmp", "**/*.tmp/**", "build", "build/**", "**/cache/**", "docs/**/draft.md", "docs/**/draft.md/**"}
+	if filters := rules.Filters(); !reflect.DeepEqual(filters, expected) {
+		t.Errorf("expected filters %v, got %v", expected, filters)
+	}
+}
+
+// TestIgnorePatternsValidation checks the patterns rejected when saving a task.
+func TestIgnorePatternsValidation(t *testing.T) {
+	cases := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"*.tmp", true},
+		{"# comment", true},
+		{"  ", true},
+		{`\!important`, true},
+		{"!", false},
+		{"/", false},
+		{"!/", false},
+	}
+	for _, c := range cases {
+		if e := ValidateIgnorePatterns([]string{c.pattern}); (e == nil) != c.valid {
+			t.Errorf("%q: expected valid=%v, got %v", c.pattern, c.valid, e)
+		}
+	}
+}
+
+// TestIgnoreFile checks that the .pydio-ignore file is added to the task patterns and skips invalid lines.
+func TestIgnoreFile(t *testing.T) {
+	root, e := ioutil.TempDir("", "ignore-file")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(root)
+	if e := ioutil.WriteFile(filepath.Join(root, IgnoreFile), []byte("# comment\n*.log\n!\nnode_modules/\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	rules, e := NewIgnoreRules(root, []string{"*.tmp"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := []struct {
+		path    string
+		dir     bool
+		ignored bool
+	}{
+		{"a.tmp", false, true},
+		{"logs/app.log", false, true},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"app/node_modules/lib.js", false, true},
+		{"readme.md", false, false},
+	}
+	for _, c := range cases {
+		if ignored := rules.Ignored(c.path, c.dir); ignored != c.ignored {
+			t.Errorf("%q (dir=%v): expected ignored=%v", c.path, c.dir, c.ignored)
+		}
+	}
+	if e := ioutil.WriteFile(filepath.Join(root, IgnoreFile), []byte("*.bak\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if e := rules.Reload(); e != nil {
+		t.Fatal(e)
+	}
+	if rules.Ignored("logs/app.log", false) || !rules.Ignored("old.bak", false) || !rules.Ignored("a.tmp", false) {
+		t.Error("reload should replace the patterns of the file and keep the task patterns")
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// IntegrityReport describes a spot check of the local files against the local snapshot.
+type IntegrityReport struct {
+	Checked time.Time
+	// Eligible is the number of files that did not change since their last sync
+	Eligible int
+	Hashed   int
+	// Corrupted files have the same size and modification time as when they were synced, but a different content
+	Corrupted  []string `json:"Corrupted,omitempty"`
+	Unreadable []string `json:"Unreadable,omitempty"`
+}
+
+// String implements Stringer interface.
+func (r *IntegrityReport) String() string {
+	return fmt.Sprintf("%d/%d unchanged files re-hashed, %d corrupted, %d unreadable", r.Hashed, r.Eligible, len(r.Corrupted), len(r.Unreadable))
+}
+
+// SampleIntegrity hashes again a random ratio of the local files, at least one, and compares them with the etags
+// recorded in the local snapshot. Only files whose size and modification time did not change since they were
+// synced are sampled: a different content then means that the data was altered below the filesystem (bit rot,
+// faulty RAM or driver), not edited by a user. Only paths accepted by keep are sampled.
+func SampleIntegrity(snap model.PathSyncSource, localRoot string, ratio float64, keep func(string) bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{Checked: time.Now()}
+	var files []*tree.Node
+	e := snap.Walk(func(p string, node *tree.Node, err error) {
+		p = strings.Trim(p, "/")
+		if err != nil || p == "" || !node.IsLeaf() || !keep(p) {
+			return
+		}
+		// Multipart and temporary etags are not plain MD5
+		etag := strings.Trim(node.GetEtag(), "\"")
+		if len(etag) != 32 || strings.Contains(etag, "-") {
+			return
+		}
+		info, er := os.Stat(filepath.Join(localRoot, filepath.FromSlash(p)))
+		if er != nil || info.Size() != node.GetSize() || info.ModTime().Unix() != node.GetMTime() {
+			return
+		}
+		n := node.Clone()
+		n.Path = p
+		files = append(files, n)
+	}, "/", true)
+	if e != nil {
+		return nil, e
+	}
+	report.Eligible = len(files)
+	if len(files) == 0 {
+		return report, nil
+	}
+	sample := int(math.Ceil(float64(len(files)) * ratio))
+	rand.Shuffle(len(files), func(i, j int) {
+		files[i], files[j] = files[j], files[i]
+	})
+	for _, node := range files[:sample] {
+		h, er := fileMD5(filepath.Join(localRoot, filepath.FromSlash(node.Path)))
+		if er != nil {
+			report.Unreadable = append(report.Unreadable, node.Path)
+			continue
+		}
+		report.Hashed++
+		if h != strings.Trim(node.GetEtag(), "\"") {
+			report.Corrupted = append(report.Corrupted, node.Path)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,645 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/endpoints/filesystem"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// localFS wraps the filesystem client. It validates local paths before any write, so that platform limits are
+// reported as a PathViolation instead of failing in the middle of a transfer. It also applies the hidden attribute
+// on created files, and can throttle local I/O. Read-only roots reject all writes with ErrReadOnly.
+type localFS struct {
+	*filesystem.FSClient
+	root     string
+	limits   PathLimits
+	readOnly bool
+
+	rateLimit  func() int64
+	scanner    Scanner
+	quarantine string
+	progress   *ProgressTracker
+	debounce   time.Duration
+	origin     string
+	expected   *expectedChanges
+	journal    *WriteJournal
+	batch      *BatchJournal
+	consistent *consistentReads
+	stash      *Stash
+	trash      *Trash
+	owner      *Owner
+	modes      *modeTemplate
+	ignores    *IgnoreRules
+	hashes     *HashCache
+	hot        *hotPaths
+	databases  *safeReplace
+	foldCase   bool
+	actors     *actorTracker
+	safe       *SafeMode
+	transfers  *TransferLimiter
+	space      *diskSpaceGuard
+	hold       *WatchHold
+}
+
+// Walk skips the ignored paths, and records the hashes of the files and the identities of the folders in the hash
+// cache. Files missing from the cache are first hashed in parallel.
+func (c *localFS) Walk(walknFc model.WalkNodesFunc, root string, recursive bool) error {
+	if c.ignores == nil && c.hashes == nil {
+		return c.FSClient.Walk(walknFc, root, recursive)
+	}
+	if c.hashes != nil {
+		defer c.hashes.flush()
+		if recursive {
+			c.prehash(root)
+		}
+	}
+	return c.FSClient.Walk(func(p string, node *tree.Node, err error) {
+		if err == nil && node != nil {
+			if c.ignores != nil && c.ignores.Ignored(p, !node.IsLeaf()) {
+				return
+			}
+			if c.hashes != nil && node.IsLeaf() {
+				c.hashes.record(p, node.GetEtag())
+			} else if c.hashes != nil {
+				c.hashes.recordFolder(p, node.GetUuid())
+			}
+		}
+		walknFc(p, node, err)
+	}, root, recursive)
+}
+
+// LoadNode records the hash of the loaded file, or the identity of the loaded folder, in the hash cache. On
+// case-insensitive filesystems, a path that only exists with a different case is reported as not found, so that
+// case-only renames are seen as moves.
+func (c *localFS) LoadNode(ctx context.Context, p string, extendedStats ...bool) (*tree.Node, error) {
+	if c.foldCase && !c.exactCase(p) {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	node, e := c.FSClient.LoadNode(ctx, p, extendedStats...)
+	if e == nil && c.hashes != nil {
+		if node.IsLeaf() {
+			c.hashes.record(p, node.GetEtag())
+		} else {
+			c.hashes.recordFolder(p, node.GetUuid())
+		}
+	}
+	return node, e
+}
+
+// CreateNode validates path before creating node. With a batch journal, new nodes are recorded.
+func (c *localFS) CreateNode(ctx context.Context, node *tree.Node, updateIfExists bool) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if v := c.limits.Validate(c.root, node.GetPath()); v != nil {
+		return v
+	}
+	if e := c.ignoredWrite(node.GetPath(), !node.IsLeaf()); e != nil {
+		return e
+	}
+	if e := c.makeParents(node.GetPath()); e != nil {
+		return e
+	}
+	_, existed := os.Lstat(c.abs(node.GetPath()))
+	if e := c.FSClient.CreateNode(ctx, node, updateIfExists); e != nil {
+		return e
+	}
+	if c.batch != nil && existed != nil {
+		if e := c.batch.record(&batchStep{Op: batchCreate, Path: strings.Trim(node.GetPath(), "/"), Folder: !node.IsLeaf()}); e != nil {
+			return e
+		}
+	}
+	markHidden(c.root, node.GetPath())
+	c.applyMode(node.GetPath(), !node.IsLeaf())
+	c.fixOwner(node.GetPath())
+	c.expect(node.GetPath())
+	return nil
+}
+
+// MoveNode validates target path before moving node. With a batch journal, the move is recorded.
+func (c *localFS) MoveNode(ctx context.Context, oldPath string, newPath string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if v := c.limits.Validate(c.root, newPath); v != nil {
+		return v
+	}
+	if e := c.ignoredWrite(newPath, c.isDir(oldPath)); e != nil {
+		return e
+	}
+	if e := c.makeParents(newPath); e != nil {
+		return e
+	}
+	if c.foldCase && isCaseRename(oldPath, newPath) {
+		if e := c.caseRename(ctx, oldPath, newPath); e != nil {
+			return e
+		}
+	} else if e := c.FSClient.MoveNode(ctx, oldPath, newPath); e != nil {
+		return e
+	}
+	if c.hashes != nil {
+		c.hashes.move(oldPath, newPath)
+	}
+	if c.batch != nil {
+		step := &batchStep{Op: batchMove, Path: strings.Trim(newPath, "/"), From: strings.Trim(oldPath, "/"), Folder: c.isDir(newPath)}
+		if e := c.batch.record(step); e != nil {
+			return e
+		}
+	}
+	if c.expected != nil {
+		c.expected.expectDeleted(oldPath)
+		c.expected.expect(newPath)
+	}
+	return nil
+}
+
+// DeleteNode fails on read-only roots. With a batch journal, the node is kept until the end of the patch. With a
+// stash or a trash, the node is moved into it instead. Ignored entries are never deleted, and folders containing
+// some are emptied instead of being removed. Deletions are skipped in safe mode.
+func (c *localFS) DeleteNode(ctx context.Context, p string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if e := c.ignoredWrite(p, c.isDir(p)); e != nil {
+		return e
+	}
+	if c.safe.skip(ctx, p) {
+		return nil
+	}
+	if c.hasIgnored(p) {
+		if e := c.deleteKeepingIgnored(ctx, p); e != nil {
+			return e
+		}
+	} else if c.batch != nil {
+		if e := c.batch.keep(batchDelete, p); e != nil {
+			return e
+		}
+	} else if c.stash != nil {
+		if e := c.stash.keep(ctx, p, StashDeleted); e != nil {
+			return e
+		}
+	} else if c.trash != nil {
+		if e := c.trash.put(p); e != nil {
+			return e
+		}
+	} else if e := c.FSClient.DeleteNode(ctx, p); e != nil {
+		return e
+	}
+	if c.hashes != nil {
+		c.hashes.Invalidate(p)
+	}
+	if c.expected != nil {
+		c.expected.expectDeleted(p)
+	}
+	return nil
+}
+
+// GetWriterOn validates path before opening a writer, then streams the contents to PutNode. Downloads that would
+// leave less free space than reserved on the volume are refused. With a stash, the previous version is moved into
+// it once the new one is complete. The done channel only receives a value on success, errors are sent on the
+// errors channel.
+func (c *localFS) GetWriterOn(ctx context.Context, p string, targetSize int64) (io.WriteCloser, chan bool, chan error, error) {
+	if e := c.prepareWrite(ctx, p, targetSize); e != nil {
+		return nil, nil, nil, e
+	}
+	if c.scanner != nil {
+		return c.scanningWriter(ctx, p, targetSize)
+	}
+	reader, writer := io.Pipe()
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	go func() {
+		if e := c.put(p, reader, targetSize); e != nil {
+			reader.CloseWithError(e)
+			errs <- e
+			return
+		}
+		done <- true
+		close(done)
+	}()
+	return writer, done, errs, nil
+}
+
+// prepareWrite checks that p can be written before any content is transferred.
+func (c *localFS) prepareWrite(ctx context.Context, p string, targetSize int64) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if v := c.limits.Validate(c.root, p); v != nil {
+		return v
+	}
+	if e := c.ignoredWrite(p, false); e != nil {
+		return e
+	}
+	if c.databases.matches(p) {
+		if e := c.databases.replaceable(c.abs(p), p); e != nil {
+			return e
+		}
+	}
+	if c.space != nil {
+		if e := c.space.reserve(c.root, p, targetSize); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// stashPrevious moves the current version of p into the stash, if any, right before the new version is moved in
+// place: if the transfer fails, the previous version stays at its path. With a batch journal, the previous
+// version is kept until the end of the patch instead.
+func (c *localFS) stashPrevious(p string) error {
+	if c.batch != nil {
+		return c.batch.keep(batchWrite, p)
+	}
+	if c.stash == nil {
+		return nil
+	}
+	return c.stash.keep(context.Background(), p, StashVersions)
+}
+
+// writeTarget returns the temporary file receiving the contents of p, and the function moving it in place once
+// complete, after stashing the previous version. With a write journal, the temporary file is recorded so that an
+// interrupted write is recovered.
+func (c *localFS) writeTarget(p string) (string, func(hash string) error, error) {
+	if c.journal != nil {
+		entry, e := c.journal.begin(p)
+		if e != nil {
+			return "", nil, e
+		}
+		return entry.Temp, func(hash string) error {
+			return c.commitWrite(entry, hash, p)
+		}, nil
+	}
+	temp := path.Join(path.Dir(p), fmt.Sprintf("%s%d-%s", JournalTempPrefix, time.Now().UnixNano(), path.Base(p)))
+	return temp, func(string) error {
+		if e := c.stashPrevious(p); e != nil {
+			os.Remove(c.abs(temp))
+			return e
+		}
+		if e := os.Rename(c.abs(temp), c.abs(p)); e != nil {
+			os.Remove(c.abs(temp))
+			return e
+		}
+		syncDir(filepath.Dir(c.abs(p)))
+		return nil
+	}, nil
+}
+
+// openWriter opens a writer on the filesystem client, applying rate limit and hidden attribute. Contents go to a
+// temporary file that is moved in place once complete, so that the previous version is never partially
+// overwritten.
+func (c *localFS) openWriter(ctx context.Context, p string, targetSize int64) (io.WriteCloser, chan bool, chan error, error) {
+	target, commit, e := c.writeTarget(p)
+	if e != nil {
+		return nil, nil, nil, e
+	}
+	c.expect(target)
+	if e := c.makeParents(target); e != nil {
+		return nil, nil, nil, e
+	}
+	out, writeDone, writeErr, e := c.FSClient.GetWriterOn(ctx, target, targetSize)
+	if e != nil {
+		return out, writeDone, writeErr, e
+	}
+	hashing := &hashingWriter{WriteCloser: out, h: md5.New()}
+	out = hashing
+	if writeDone == nil {
+		out = &finishingWriter{hashingWriter: hashing, finish: func() error {
+			return commit(hashing.sum())
+		}}
+	}
+	if c.rateLimit != nil {
+		out = &throttledWriter{WriteCloser: out, limiter: &rateLimiter{limit: c.rateLimit}}
+	}
+	if c.transfers != nil {
+		out = &limitedWriter{WriteCloser: out, bucket: c.transfers.Download, release: c.transfers.acquire()}
+	}
+	if c.scanner == nil {
+		// Scanning writers already report progress
+		out, writeDone = trackWriter(c.progress, p, targetSize, out, writeDone, false)
+	}
+	if writeDone == nil {
+		return out, writeDone, writeErr, nil
+	}
+	// Forward the done signal once the file is in place, to mark it as hidden if required. Errors when moving the
+	// temporary file in place are reported on the errors channel
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	go func() {
+		select {
+		case d, ok := <-writeDone:
+			if !ok {
+				// Closed without success, the error may follow
+				select {
+				case e, ok := <-writeErr:
+					if ok {
+						errs <- e
+						return
+					}
+				case <-time.After(time.Second):
+				}
+				errs <- fmt.Errorf("cannot write %s", p)
+				return
+			}
+			if e := commit(hashing.sum()); e != nil {
+				log.Logger(ctx).Error("Cannot move " + target + " in place: " + e.Error())
+				errs <- e
+				return
+			}
+			c.written(p, "")
+			done <- d
+			close(done)
+		case e, ok := <-writeErr:
+			if !ok {
+				e = fmt.Errorf("cannot write %s", p)
+			}
+			errs <- e
+		}
+	}()
+	return out, done, errs, nil
+}
+
+// Watch watches the root recursively, and registers an additional watcher for each volume mounted below the
+// root (mount points or junctions), as recursive watchers do not cross volume boundaries. Events are merged
+// into the main watch object. Watchers are restarted on errors, and their subtree rescanned. Events caused by the
+// engine's own writes or on ignored paths are dropped, and buffered while a hold is active. Renames are paired
+// into moves when hashes are cached, then events are debounced if required, and tagged with the process at their
+// origin when actors are tracked. The delay between the reception of an event and the end of the pipeline is
+// measured.
+func (c *localFS) Watch(recursivePath string) (*model.WatchObject, error) {
+	first, e := c.FSClient.Watch(recursivePath)
+	if e != nil {
+		return nil, e
+	}
+	main := c.superviseWatch(first, c.root, recursivePath, func() (*model.WatchObject, error) {
+		return c.FSClient.Watch(recursivePath)
+	})
+	watchRoot := filepath.Join(c.root, filepath.FromSlash(strings.TrimLeft(recursivePath, "/")))
+	for _, mount := range findMountPoints(watchRoot) {
+		rel, er := filepath.Rel(c.root, mount)
+		if er != nil {
+			continue
+		}
+		prefix := filepath.ToSlash(rel)
+		sub, er := filesystem.NewFSClient(mount, model.EndpointOptions{})
+		if er != nil {
+			log.Logger(context.Background()).Error("Cannot watch volume mounted on " + mount + ": " + er.Error())
+			continue
+		}
+		subWatch, er := sub.Watch("")
+		if er != nil {
+			log.Logger(context.Background()).Error("Cannot watch volume mounted on " + mount + ": " + er.Error())
+			continue
+		}
+		log.Logger(context.Background()).Info("Watching volume mounted on " + mount)
+		subWatch = c.superviseWatch(subWatch, mount, "", func() (*model.WatchObject, error) {
+			return sub.Watch("")
+		})
+		go c.mergeEvents(main, subWatch, prefix)
+	}
+	if c.expected != nil {
+		main = c.expected.filterEvents(main)
+	}
+	if c.ignores != nil {
+		main = c.filterIgnored(main)
+	}
+	main = c.timeEvents(main, true)
+	if c.hold != nil {
+		main = c.hold.gate(main)
+	}
+	if c.hashes != nil {
+		main = c.detectMoves(main)
+	}
+	if c.debounce > 0 {
+		main = DebounceEvents(main, c.debounce)
+	}
+	if c.actors != nil {
+		main = c.actors.enrichEvents(main)
+	}
+	return c.timeEvents(main, false), nil
+}
+
+// expect records a path written by the engine, so that the matching watcher events are ignored.
+func (c *localFS) expect(p string) {
+	if c.expected != nil {
+		c.expected.expect(p)
+	}
+}
+
+// mergeEvents forwards events of a sub-watcher to the main watcher, rewriting paths relative to the task root.
+func (c *localFS) mergeEvents(main, sub *model.WatchObject, prefix string) {
+	defer sub.Close()
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			ev.Path = path.Join(prefix, ev.Path)
+			ev.Source = c
+			main.EventInfoChan <- ev
+		case err, ok := <-sub.Errors():
+			if !ok {
+				return
+			}
+			main.ErrorChan <- err
+		case <-main.Done():
+			return
+		}
+	}
+}
+
+// findMountPoints lists the folders below root that are on a different volume than their parent.
+func findMountPoints(root string) (mounts []string) {
+	rootVolume, ok := volumeID(root)
+	if !ok {
+		return
+	}
+	volumes := map[string]string{root: rootVolume}
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		isLink := info.Mode()&os.ModeSymlink != 0
+		if !info.IsDir() && !isLink {
+			return nil
+		}
+		volume, ok := volumeID(p)
+		if !ok {
+			return nil
+		}
+		if isLink {
+			// Only junctions/links to folders on other volumes are considered. Walk does not follow them.
+			if target, er := os.Stat(p); er == nil && target.IsDir() && volume != volumes[filepath.Dir(p)] {
+				mounts = append(mounts, p)
+			}
+			return nil
+		}
+		if parent, ok := volumes[filepath.Dir(p)]; ok && volume != parent {
+			mounts = append(mounts, p)
+			return filepath.SkipDir
+		}
+		volumes[p] = volume
+		return nil
+	})
+	return
+}
+
+// GetReaderOn opens a reader on a local file, throttled if a rate limit applies. With consistent reads, the file
+// is read from a filesystem snapshot when possible. Otherwise, the read fails if the file changes in the meantime.
+func (c *localFS) GetReaderOn(p string) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	var e error
+	if c.databases.matches(p) {
+		if e = c.databases.readable(c.abs(p), p); e != nil {
+			return nil, e
+		}
+	}
+	if c.consistent != nil {
+		r = c.consistent.open(p)
+	}
+	if r == nil {
+		r, e = c.checkReader(p, func() (io.ReadCloser, error) {
+			return c.FSClient.GetReaderOn(p)
+		})
+	}
+	if e != nil {
+		return r, e
+	}
+	if c.rateLimit != nil {
+		r = &throttledReader{ReadCloser: r, limiter: &rateLimiter{limit: c.rateLimit}}
+	}
+	if c.transfers != nil {
+		r = &limitedReader{ReadCloser: r, bucket: c.transfers.Upload, release: c.transfers.acquire()}
+	}
+	return r, nil
+}
+
+// ComputeChecksum reuses the cached hash of unchanged files. Otherwise, it delays hashing if a rate limit
+// applies, as the file will be fully read.
+func (c *localFS) ComputeChecksum(node *tree.Node) error {
+	if c.hashes != nil {
+		if _, etag := c.hashes.lookup(node.GetPath()); etag != "" {
+			node.Etag = etag
+			return nil
+		}
+	}
+	c.progress.Phase(node.GetPath(), FilePhaseHashing, 0)
+	defer c.progress.Done(node.GetPath())
+	if c.rateLimit != nil {
+		if rate := c.rateLimit(); rate > 0 && node.GetSize() > 0 {
+			time.Sleep(time.Duration(float64(node.GetSize()) / float64(rate) * float64(time.Second)))
+		}
+	}
+	if e := c.FSClient.ComputeChecksum(node); e != nil {
+		return e
+	}
+	if c.hashes != nil {
+		c.hashes.record(node.GetPath(), node.GetEtag())
+	}
+	return nil
+}
+
+// SetRateLimit registers a function returning the current rate limit (in bytes per second, 0 for no limit) for
+// reading, writing and hashing local files. It returns false if the endpoint is not local.
+func SetRateLimit(ep model.Endpoint, limit func() int64) bool {
+	if c, ok := ep.(*localFS); ok {
+		c.rateLimit = limit
+		return true
+	}
+	return false
+}
+
+// rateLimiter computes the time to wait to respect a rate limit, that may change over time.
+type rateLimiter struct {
+	limit func() int64
+	start time.Time
+	done  int64
+}
+
+// chunk returns the maximum size of the next operation.
+func (r *rateLimiter) chunk(size int) int {
+	rate := r.limit()
+	if rate > 0 && int64(size) > rate {
+		return int(rate)
+	}
+	return size
+}
+
+// wait records n processed bytes and sleeps as required.
+func (r *rateLimiter) wait(n int) {
+	rate := r.limit()
+	if rate <= 0 {
+		// Restart counting when limit applies again
+		r.start = time.Time{}
+		r.done = 0
+		return
+	}
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	r.done += int64(n)
+	expected := time.Duration(float64(r.done) / float64(rate) * float64(time.Second))
+	if d := expected - time.Since(r.start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, e := t.ReadCloser.Read(p[:t.limiter.chunk(len(p))])
+	t.limiter.wait(n)
+	return n, e
+}
+
+type throttledWriter struct {
+	io.WriteCloser
+	limiter *rateLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (written int, e error) {
+	for len(p) > 0 {
+		n, er := t.WriteCloser.Write(p[:t.limiter.chunk(len(p))])
+		written += n
+		t.limiter.wait(n)
+		if er != nil {
+			return written, er
+		}
+		p = p[n:]
+	}
+	return
+}
@@ -0,0 +1,43 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// volumeID returns the volume of a path, after resolving junctions.
+func volumeID(p string) (string, bool) {
+	resolved, e := filepath.EvalSymlinks(p)
+	if e != nil {
+		return "", false
+	}
+	return strings.ToUpper(filepath.VolumeName(resolved)), true
+}
+
+// fileInode is not available from the file information on Windows, the hash cache relies on size and
+// modification time only.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// TrashFolder is the folder of a local root where deleted files are moved when the local trash is enabled
+	TrashFolder = ".pydio-trash"
+
+	trashOrigin   = ".origin"
+	trashIdFormat = "20060102-150405.000000000"
+)
+
+// Trash is a recycle area at the root of a local endpoint. Each deleted node is moved into its own
+// <date> folder, along with an .origin file holding its original path, so that it can be restored later.
+type Trash struct {
+	sync.Mutex
+	root string
+}
+
+// TrashedItem is a node found in the trash.
+type TrashedItem struct {
+	Id      string
+	Path    string
+	Deleted time.Time
+	Size    int64
+	Folder  bool
+}
+
+// NewTrash opens the trash of a local root.
+func NewTrash(root string) *Trash {
+	return &Trash{root: root}
+}
+
+// SetTrash makes a local endpoint move deleted nodes into its trash. It returns nil if the endpoint is not local.
+func SetTrash(ep model.Endpoint) *Trash {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return nil
+	}
+	c.trash = NewTrash(c.root)
+	return c.trash
+}
+
+func (t *Trash) folder() string {
+	return filepath.Join(t.root, TrashFolder)
+}
+
+// put moves a file or folder into the trash. Missing paths are ignored.
+func (t *Trash) put(p string) error {
+	p = strings.Trim(p, "/")
+	return t.putFrom(filepath.Join(t.root, filepath.FromSlash(p)), p)
+}
+
+// putFrom moves the absolute path src into the trash, recording p as its original path. Missing sources are
+// ignored.
+func (t *Trash) putFrom(src string, p string) error {
+	p = strings.Trim(p, "/")
+	if _, e := os.Lstat(src); e != nil {
+		if os.IsNotExist(e) {
+			return nil
+		}
+		return e
+	}
+	t.Lock()
+	defer t.Unlock()
+	id := time.Now().Format(trashIdFormat)
+	dir := filepath.Join(t.folder(), id)
+	for n := 2; ; n++ {
+		if _, e := os.Lstat(dir); os.IsNotExist(e) {
+			break
+		}
+		dir = filepath.Join(t.folder(), fmt.Sprintf("%s-%d", id, n))
+	}
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return e
+	}
+	if e := ioutil.WriteFile(filepath.Join(dir, trashOrigin), []byte(p), 0644); e != nil {
+		os.RemoveAll(dir)
+		return e
+	}
+	if e := os.Rename(src, filepath.Join(dir, path.Base(p))); e != nil {
+		os.RemoveAll(dir)
+		return e
+	}
+	return nil
+}
+
+// item reads a trash entry.
+func (t *Trash) item(id string) (*TrashedItem, error) {
+	if len(id) < len(trashIdFormat) || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid trash entry %s", id)
+	}
+	stamp, e := time.ParseInLocation(trashIdFormat, id[:len(trashIdFormat)], time.Local)
+	if e != nil {
+		return nil, fmt.Errorf("invalid trash entry %s", id)
+	}
+	origin, e := ioutil.ReadFile(filepath.Join(t.folder(), id, trashOrigin))
+	if e != nil {
+		return nil, e
+	}
+	item := &TrashedItem{Id: id, Path: string(origin), Deleted: stamp}
+	info, e := os.Lstat(t.content(item))
+	if e != nil {
+		return nil, e
+	}
+	item.Folder = info.IsDir()
+	filepath.Walk(t.content(item), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			item.Size += info.Size()
+		}
+		return nil
+	})
+	return item, nil
+}
+
+// content is the location of the trashed node on disk.
+func (t *Trash) content(item *TrashedItem) string {
+	return filepath.Join(t.folder(), item.Id, path.Base(item.Path))
+}
+
+// List returns the items of the trash, most recently deleted first.
+func (t *Trash) List() ([]*TrashedItem, error) {
+	infos, e := ioutil.ReadDir(t.folder())
+	if os.IsNotExist(e) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+	var items []*TrashedItem
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if item, e := t.item(info.Name()); e == nil {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+	return items, nil
+}
+
+// Restore moves an item back to its original path, and returns that path. It fails if a node already exists
+// there.
+func (t *Trash) Restore(id string) (string, error) {
+	t.Lock()
+	defer t.Unlock()
+	item, e := t.item(id)
+	if e != nil {
+		return "", e
+	}
+	target := filepath.Join(t.root, filepath.FromSlash(item.Path))
+	if _, e := os.Lstat(target); e == nil {
+		return "", fmt.Errorf("cannot restore %s: a file already exists at this location", item.Path)
+	}
+	if e := os.MkdirAll(filepath.Dir(target), 0755); e != nil {
+		return "", e
+	}
+	if e := os.Rename(t.content(item), target); e != nil {
+		return "", e
+	}
+	return item.Path, os.RemoveAll(filepath.Join(t.folder(), id))
+}
+
+// Purge removes the items deleted more than keepDays ago, then the oldest ones until the trash fits in maxSizeGB.
+// Zero values mean no limit.
+func (t *Trash) Purge(keepDays int, maxSizeGB float64) (*RetentionReport, error) {
+	items, e := t.List()
+	if e != nil {
+		return nil, e
+	}
+	t.Lock()
+	defer t.Unlock()
+	report := &RetentionReport{}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	var max int64
+	if maxSizeGB > 0 {
+		max = int64(maxSizeGB * 1024 * 1024 * 1024)
+	}
+	now := time.Now()
+	// Oldest first
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		expired := keepDays > 0 && now.Sub(item.Deleted) > time.Duration(keepDays)*24*time.Hour
+		if !expired && (max == 0 || total <= max) {
+			continue
+		}
+		if e := os.RemoveAll(filepath.Join(t.folder(), item.Id)); e != nil {
+			return report, e
+		}
+		report.Removed++
+		report.ReclaimedBytes += item.Size
+		total -= item.Size
+	}
+	report.RemainingBytes = total
+	return report, nil
+}
+
+// Empty removes all items from the trash.
+func (t *Trash) Empty() (*RetentionReport, error) {
+	items, e := t.List()
+	if e != nil {
+		return nil, e
+	}
+	t.Lock()
+	defer t.Unlock()
+	report := &RetentionReport{}
+	for _, item := range items {
+		if e := os.RemoveAll(filepath.Join(t.folder(), item.Id)); e != nil {
+			return report, e
+		}
+		report.Removed++
+		report.ReclaimedBytes += item.Size
+	}
+	return report, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	// MetaMimeType is the namespace of the remote node metadata holding the detected content type
+	MetaMimeType = "mime"
+	sniffLength  = 512
+)
+
+var (
+	mimeUnsupportedLock sync.Mutex
+	mimeUnsupported     = make(map[string]bool)
+)
+
+// DetectMimeType returns the content type of a file from its extension, or by sniffing its first bytes if the
+// extension is unknown.
+func DetectMimeType(p string, head []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(path.Ext(p))); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// sniffWriter keeps the first bytes written, for content type detection.
+type sniffWriter struct {
+	io.WriteCloser
+	head []byte
+}
+
+func (w *sniffWriter) Write(p []byte) (int, error) {
+	if missing := sniffLength - len(w.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		w.head = append(w.head, p[:missing]...)
+	}
+	return w.WriteCloser.Write(p)
+}
+
+// detectMimeType sniffs an upload and sets its content type as metadata on the remote node once written, so that
+// previews and indexing work on the server.
+func (r *remoteFS) detectMimeType(p string, out io.WriteCloser, writeDone chan bool) (io.WriteCloser, chan bool) {
+	if writeDone == nil {
+		return out, writeDone
+	}
+	sniff := &sniffWriter{WriteCloser: out}
+	done := make(chan bool, 1)
+	go func() {
+		defer close(done)
+		d, ok := <-writeDone
+		if !ok {
+			return
+		}
+		done <- d
+		go func() {
+			if e := r.setMimeType(p, DetectMimeType(p, sniff.head)); e != nil {
+				log.Logger(context.Background()).Debug("Cannot set content type of " + p + ": " + e.Error())
+			}
+		}()
+	}()
+	return sniff, done
+}
+
+// setMimeType stores the content type in the remote node metadata. Servers rejecting the request are not asked
+// again until restart.
+func (r *remoteFS) setMimeType(p, mimeType string) error {
+	host := r.uri.Host
+	mimeUnsupportedLock.Lock()
+	unsupported := mimeUnsupported[host]
+	mimeUnsupportedLock.Unlock()
+	if unsupported {
+		return nil
+	}
+	var authority *config.Authority
+	for _, a := range config.Default().Authorities {
+		if a.MatchesURI(r.uri.String()) {
+			authority = a
+			break
+		}
+	}
+	if authority == nil {
+		return fmt.Errorf("cannot find authority")
+	}
+	node, e := r.Remote.LoadNode(context.Background(), p)
+	if e != nil {
+		return e
+	}
+	value, _ := json.Marshal(mimeType)
+	body, _ := json.Marshal(map[string]interface{}{
+		"Operation": "PUT",
+		"MetaDatas": []map[string]string{{
+			"NodeUuid":  node.GetUuid(),
+			"Namespace": MetaMimeType,
+			"JsonValue": string(value),
+		}},
+	})
+	req, e := authority.NewAuthenticatedRequest("PUT", "/a/user-meta/update", bytes.NewReader(body))
+	if e != nil {
+		return e
+	}
+	resp, e := authority.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		mimeUnsupportedLock.Lock()
+		mimeUnsupported[host] = true
+		mimeUnsupportedLock.Unlock()
+		return fmt.Errorf("server responded with status %d, content types will not be sent anymore", resp.StatusCode)
+	}
+	return nil
+}
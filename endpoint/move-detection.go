@@ -0,0 +1,221 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// moveWindow is how long creates and removes are held to be paired as moves.
+	moveWindow = time.Second
+	// moveProbes is the number of cached files checked to recognize a moved folder.
+	moveProbes = 20
+)
+
+type pendingEvent struct {
+	ev model.EventInfo
+	at time.Time
+}
+
+// detectMoves returns a copy of the watch object that pairs the remove and create events of a renamed file or
+// folder into a single EventSureMove. Files are recognized by their inode, or by their size and modification time
+// on filesystems without inodes, as recorded in the hash cache. Folders are recognized by the identity of their
+// .pydio marker, or by the files they contain. The move is then applied as a move on the server, which keeps the
+// node and the share links attached to it.
+// Events are delayed by moveWindow, and unpaired ones are forwarded unchanged, in their original order.
+func (c *localFS) detectMoves(main *model.WatchObject) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		var pending []*pendingEvent
+		ticker := time.NewTicker(moveWindow / 4)
+		defer ticker.Stop()
+		send := func(ev model.EventInfo) bool {
+			select {
+			case out.EventInfoChan <- ev:
+				return true
+			case <-main.Done():
+				return false
+			}
+		}
+		flush := func(all bool) bool {
+			i := 0
+			for ; i < len(pending); i++ {
+				if !all && time.Since(pending[i].at) < moveWindow {
+					break
+				}
+				if !send(pending[i].ev) {
+					return false
+				}
+			}
+			pending = pending[i:]
+			return true
+		}
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					flush(true)
+					close(out.EventInfoChan)
+					return
+				}
+				if ev.Type != model.EventCreate && ev.Type != model.EventRemove {
+					if len(pending) == 0 {
+						if !send(ev) {
+							return
+						}
+						continue
+					}
+					pending = append(pending, &pendingEvent{ev: ev, at: time.Now()})
+					continue
+				}
+				pending = c.pairMove(pending, ev)
+			case <-ticker.C:
+				if !flush(false) {
+					return
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
+
+// pairMove replaces a pending event by a move if it matches ev, or queues ev. Events below a moved folder are
+// dropped, as the move covers them.
+func (c *localFS) pairMove(pending []*pendingEvent, ev model.EventInfo) []*pendingEvent {
+	for _, p := range pending {
+		if p.ev.Type == model.EventSureMove && p.ev.Folder && p.ev.MoveSource != nil {
+			if (ev.Type == model.EventRemove && isBelow(ev.Path, p.ev.MoveSource.Path)) || (ev.Type == model.EventCreate && isBelow(ev.Path, p.ev.Path)) {
+				return pending
+			}
+		}
+	}
+	for i, p := range pending {
+		var from, to string
+		if ev.Type == model.EventCreate && p.ev.Type == model.EventRemove {
+			from, to = p.ev.Path, ev.Path
+		} else if ev.Type == model.EventRemove && p.ev.Type == model.EventCreate {
+			from, to = ev.Path, p.ev.Path
+		} else {
+			continue
+		}
+		folder, ok := c.isMove(from, to)
+		if !ok {
+			continue
+		}
+		pending[i].ev = c.moveEvent(from, to, folder)
+		if !folder {
+			return pending
+		}
+		var kept []*pendingEvent
+		for j, other := range pending {
+			if j != i && ((other.ev.Type == model.EventRemove && isBelow(other.ev.Path, from)) || (other.ev.Type == model.EventCreate && isBelow(other.ev.Path, to))) {
+				continue
+			}
+			kept = append(kept, other)
+		}
+		return kept
+	}
+	return append(pending, &pendingEvent{ev: ev, at: time.Now()})
+}
+
+// isMove checks if the file or folder now found at to is the one that was at from.
+func (c *localFS) isMove(from, to string) (folder bool, ok bool) {
+	if from == to || c.hashes == nil {
+		return false, false
+	}
+	info, e := os.Lstat(c.abs(to))
+	if e != nil {
+		return false, false
+	}
+	if _, e := os.Lstat(c.abs(from)); e == nil && !(c.foldCase && isCaseRename(from, to)) {
+		return false, false
+	}
+	if !info.IsDir() {
+		entry := c.hashes.entry(from)
+		return false, entry != nil && sameFile(entry, info)
+	}
+	if uuid := c.hashes.folderUuid(from); uuid != "" && uuid == folderIdentity(c.abs(to)) {
+		return true, true
+	}
+	prefix := strings.Trim(from, "/") + "/"
+	for i, p := range c.hashes.pathsUnder(from) {
+		if i >= moveProbes {
+			break
+		}
+		child, e := os.Lstat(c.abs(path.Join(to, strings.TrimPrefix(p, prefix))))
+		if e != nil {
+			continue
+		}
+		if entry := c.hashes.entry(p); entry != nil && sameFile(entry, child) {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// moveEvent builds the move event of a path, and moves its cached hashes along.
+func (c *localFS) moveEvent(from, to string, folder bool) model.EventInfo {
+	source := &tree.Node{Path: from, Type: tree.NodeType_LEAF}
+	target := &tree.Node{Path: to, Type: tree.NodeType_LEAF}
+	if folder {
+		source.Type = tree.NodeType_COLLECTION
+		target.Type = tree.NodeType_COLLECTION
+		source.Uuid = folderIdentity(c.abs(to))
+		target.Uuid = source.Uuid
+	} else if entry := c.hashes.entry(from); entry != nil {
+		source.Etag, source.Size, source.MTime = entry.Etag, entry.Size, entry.MTime/int64(time.Second)
+		target.Etag, target.Size, target.MTime = source.Etag, source.Size, source.MTime
+	}
+	c.hashes.move(from, to)
+	return model.EventInfo{
+		Time:       time.Now().Format(time.RFC3339),
+		Path:       to,
+		Folder:     folder,
+		Size:       target.Size,
+		Etag:       target.Etag,
+		Type:       model.EventSureMove,
+		Source:     c,
+		MoveSource: source,
+		MoveTarget: target,
+	}
+}
+
+// sameFile compares a cached entry with the metadata of a file.
+func sameFile(entry *hashEntry, info os.FileInfo) bool {
+	if inode := fileInode(info); entry.Inode != 0 && inode != 0 {
+		return inode == entry.Inode
+	}
+	return entry.Size == info.Size() && entry.MTime == info.ModTime().UnixNano()
+}
+
+// isBelow checks if p is a child of folder.
+func isBelow(p, folder string) bool {
+	return strings.HasPrefix(strings.Trim(p, "/"), strings.Trim(folder, "/")+"/")
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+)
+
+// Well-known keys of the node metadata store.
+const (
+	MetaPinState    = "pin-state"
+	MetaMangledName = "mangled-name"
+	MetaConflict    = "conflict"
+	MetaLastError   = "last-error"
+	// MetaConflictCopy is set on a file with the path of the copy of its conflicting local version
+	MetaConflictCopy = "conflict-copy"
+	// MetaConflictOf is set on a conflict copy with the path of the original file
+	MetaConflictOf = "conflict-of"
+)
+
+var nodesMetaBucket = []byte("nodes")
+
+// NodeMetaStore stores a generic key/value map for each node of a task, keyed by path. It is based on BoltDB
+// and is used for client-side information that the endpoints cannot store (pin state, errors, conflicts...).
+type NodeMetaStore struct {
+	db *bbolt.DB
+}
+
+// NewNodeMetaStore opens a new NodeMetaStore in the task folder.
+func NewNodeMetaStore(folderPath string) (*NodeMetaStore, error) {
+	db, err := bbolt.Open(filepath.Join(folderPath, "nodes-meta"), 0644, BoltOptions(5*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	return &NodeMetaStore{db: db}, nil
+}
+
+func metaKey(p string) []byte {
+	return []byte(strings.Trim(p, "/"))
+}
+
+// Set stores a value for a node. An empty value removes the key.
+func (s *NodeMetaStore) Set(p, key, value string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(nodesMetaBucket)
+		if err != nil {
+			return err
+		}
+		meta := make(map[string]string)
+		if data := bucket.Get(metaKey(p)); data != nil {
+			if e := json.Unmarshal(data, &meta); e != nil {
+				return e
+			}
+		}
+		if value == "" {
+			delete(meta, key)
+		} else {
+			meta[key] = value
+		}
+		if len(meta) == 0 {
+			return bucket.Delete(metaKey(p))
+		}
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(metaKey(p), data)
+	})
+}
+
+// Get reads a value for a node, or an empty string if it is not set.
+func (s *NodeMetaStore) Get(p, key string) string {
+	return s.GetAll(p)[key]
+}
+
+// GetAll reads all values stored for a node.
+func (s *NodeMetaStore) GetAll(p string) map[string]string {
+	meta := make(map[string]string)
+	s.db.View(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket(nodesMetaBucket); bucket != nil {
+			if data := bucket.Get(metaKey(p)); data != nil {
+				json.Unmarshal(data, &meta)
+			}
+		}
+		return nil
+	})
+	return meta
+}
+
+// Query lists the nodes having a given key, with their value. If value is not empty, only nodes with this
+// exact value are returned.
+func (s *NodeMetaStore) Query(key, value string) (map[string]string, error) {
+	results := make(map[string]string)
+	e := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(nodesMetaBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			meta := make(map[string]string)
+			if json.Unmarshal(v, &meta) != nil {
+				return nil
+			}
+			if val, ok := meta[key]; ok && (value == "" || val == value) {
+				results["/"+string(k)] = val
+			}
+			return nil
+		})
+	})
+	return results, e
+}
+
+// Move moves the metadata of a node and of all its children to a new path.
+func (s *NodeMetaStore) Move(oldPath, newPath string) error {
+	from, to := metaKey(oldPath), metaKey(newPath)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(nodesMetaBucket)
+		if bucket == nil {
+			return nil
+		}
+		moves := make(map[string][]byte)
+		c := bucket.Cursor()
+		for k, v := c.Seek(from); k != nil && bytes.HasPrefix(k, from); k, v = c.Next() {
+			if len(k) == len(from) || k[len(from)] == '/' {
+				moves[string(k)] = append([]byte{}, v...)
+			}
+		}
+		for k, v := range moves {
+			if e := bucket.Delete([]byte(k)); e != nil {
+				return e
+			}
+			if e := bucket.Put(append(append([]byte{}, to...), k[len(from):]...), v); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes the metadata of a node and of all its children.
+func (s *NodeMetaStore) Delete(p string) error {
+	prefix := metaKey(p)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(nodesMetaBucket)
+		if bucket == nil {
+			return nil
+		}
+		var deletes [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if len(prefix) == 0 || len(k) == len(prefix) || k[len(prefix)] == '/' {
+				deletes = append(deletes, append([]byte{}, k...))
+			}
+		}
+		for _, k := range deletes {
+			if e := bucket.Delete(k); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// Stop closes the DB.
+func (s *NodeMetaStore) Stop() {
+	s.db.Close()
+}
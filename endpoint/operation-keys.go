@@ -0,0 +1,215 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// operationKeysTTL is the time during which an operation is remembered. Duplicated deliveries happen within
+// seconds, and interrupted operations are replayed at the next start.
+const operationKeysTTL = 24 * time.Hour
+
+var operationKeysBucket = []byte("operations")
+
+// operationRecord is stored under the key of an operation before it is sent, and marked as applied once the
+// server acknowledged it.
+type operationRecord struct {
+	Op      string
+	Path    string
+	Applied bool
+	Stamp   time.Time
+}
+
+// OperationKeys records the structural operations sent to a remote endpoint (folder creations, deletions and
+// moves) under a deterministic key, before they are sent. When an operation with a known key is delivered again,
+// by a duplicated watcher event or by a retry after a crash, the server is checked first and the operation is
+// only sent if its effect is not visible: a folder is never created twice as "folder (1)". It is based on BoltDB.
+type OperationKeys struct {
+	db       *bbolt.DB
+	lock     sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// OpenOperationKeys opens or creates the operation keys store in the task folder, and forgets expired keys.
+func OpenOperationKeys(configPath string) (*OperationKeys, error) {
+	db, e := bbolt.Open(filepath.Join(configPath, "operation-keys"), 0644, BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	o := &OperationKeys{db: db, inflight: make(map[string]chan struct{})}
+	o.prune(time.Now().Add(-operationKeysTTL))
+	return o, nil
+}
+
+// SetOperationKeys makes a remote endpoint record its structural operations under idempotency keys. It returns
+// false if the endpoint is not remote.
+func SetOperationKeys(ep model.Endpoint, keys *OperationKeys) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.opKeys = keys
+	return true
+}
+
+// OperationKey computes the deterministic key of an operation from its type and arguments.
+func OperationKey(op string, args ...string) string {
+	h := sha1.New()
+	h.Write([]byte(op))
+	for _, a := range args {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Trim(a, "/")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (o *OperationKeys) get(key string) *operationRecord {
+	var r *operationRecord
+	o.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(operationKeysBucket); b != nil {
+			if data := b.Get([]byte(key)); data != nil {
+				r = &operationRecord{}
+				if json.Unmarshal(data, r) != nil {
+					r = nil
+				}
+			}
+		}
+		return nil
+	})
+	return r
+}
+
+func (o *OperationKeys) put(key string, r *operationRecord) error {
+	data, e := json.Marshal(r)
+	if e != nil {
+		return e
+	}
+	return o.db.Update(func(tx *bbolt.Tx) error {
+		b, e := tx.CreateBucketIfNotExists(operationKeysBucket)
+		if e != nil {
+			return e
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+func (o *OperationKeys) remove(key string) error {
+	return o.db.Update(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(operationKeysBucket); b != nil {
+			return b.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+// prune removes the keys recorded before a date.
+func (o *OperationKeys) prune(before time.Time) error {
+	return o.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(operationKeysBucket)
+		if b == nil {
+			return nil
+		}
+		var expired [][]byte
+		b.ForEach(func(k, v []byte) error {
+			var r operationRecord
+			if json.Unmarshal(v, &r) != nil || r.Stamp.Before(before) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		for _, k := range expired {
+			if e := b.Delete(k); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// acquire waits until no other operation with the same key is running, so that concurrent duplicates are
+// checked against the outcome of the first one.
+func (o *OperationKeys) acquire(key string) func() {
+	for {
+		o.lock.Lock()
+		ch, ok := o.inflight[key]
+		if !ok {
+			ch = make(chan struct{})
+			o.inflight[key] = ch
+			o.lock.Unlock()
+			return func() {
+				o.lock.Lock()
+				delete(o.inflight, key)
+				o.lock.Unlock()
+				close(ch)
+			}
+		}
+		o.lock.Unlock()
+		<-ch
+	}
+}
+
+// apply sends an operation identified by its key. If the key was already recorded, applied is called to check
+// on the server whether the operation took effect, in which case it is not sent again. A failed operation is
+// forgotten so that it is retried normally.
+func (o *OperationKeys) apply(ctx context.Context, key, op, p string, applied func() bool, send func() error) error {
+	release := o.acquire(key)
+	defer release()
+	if r := o.get(key); r != nil && applied() {
+		if r.Applied {
+			log.Logger(ctx).Info("Skipping duplicate " + op + " of " + p + ", it was already applied")
+		} else {
+			log.Logger(ctx).Info("Operation " + op + " of " + p + " was interrupted but reached the server, it is not sent again")
+			r.Applied = true
+			o.put(key, r)
+		}
+		return nil
+	}
+	r := &operationRecord{Op: op, Path: p, Stamp: time.Now()}
+	if e := o.put(key, r); e != nil {
+		log.Logger(ctx).Error("Cannot record operation key, sending anyway: " + e.Error())
+	}
+	if e := send(); e != nil {
+		o.remove(key)
+		return e
+	}
+	r.Applied = true
+	if e := o.put(key, r); e != nil {
+		log.Logger(ctx).Error("Cannot record applied operation key: " + e.Error())
+	}
+	return nil
+}
+
+// Close closes the DB.
+func (o *OperationKeys) Close() error {
+	return o.db.Close()
+}
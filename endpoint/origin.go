@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// OriginAttribute is the extended attribute holding the id of the device whose sync agent last wrote a local file.
+const OriginAttribute = "user.cells-sync.origin"
+
+// SetOrigin tags files written on a local endpoint with the given device id. It returns false if the endpoint is
+// not a local folder.
+func SetOrigin(ep model.Endpoint, deviceId string) bool {
+	if l, ok := ep.(*localFS); ok {
+		l.origin = deviceId
+		return true
+	}
+	return false
+}
+
+// ReadOrigin returns the device id stored on a local file, or an empty string if it was not written by a sync
+// agent or if the filesystem does not support extended attributes.
+func ReadOrigin(root, p string) string {
+	return getOriginAttribute(filepath.Join(root, filepath.FromSlash(strings.TrimLeft(p, "/"))))
+}
+
+// tagOrigin stores the origin of a file written by this agent.
+func (c *localFS) tagOrigin(p string) {
+	if c.origin == "" {
+		return
+	}
+	setOriginAttribute(filepath.Join(c.root, filepath.FromSlash(strings.TrimLeft(p, "/"))), c.origin)
+}
@@ -0,0 +1,40 @@
+// +build linux
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import "syscall"
+
+// setOriginAttribute stores the origin as an extended attribute. Errors are ignored, as some filesystems do not
+// support user attributes.
+func setOriginAttribute(p string, origin string) {
+	syscall.Setxattr(p, OriginAttribute, []byte(origin), 0)
+}
+
+// getOriginAttribute reads the origin extended attribute.
+func getOriginAttribute(p string) string {
+	buf := make([]byte, 128)
+	n, e := syscall.Getxattr(p, OriginAttribute, buf)
+	if e != nil || n <= 0 {
+		return ""
+	}
+	return string(buf[:n])
+}
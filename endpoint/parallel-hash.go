@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pydio/cells/common/log"
+)
+
+// hashQueue hands out the files to hash, taking them from each folder in turn, so that parallel reads are spread
+// over the tree instead of all hitting the same folder.
+type hashQueue struct {
+	sync.Mutex
+	cond   *sync.Cond
+	dirs   []string
+	files  map[string][]string
+	next   int
+	closed bool
+}
+
+func newHashQueue() *hashQueue {
+	q := &hashQueue{files: make(map[string][]string)}
+	q.cond = sync.NewCond(&q.Mutex)
+	return q
+}
+
+// push adds a file of a folder to the queue.
+func (q *hashQueue) push(dir, file string) {
+	q.Lock()
+	if _, ok := q.files[dir]; !ok {
+		q.dirs = append(q.dirs, dir)
+	}
+	q.files[dir] = append(q.files[dir], file)
+	q.Unlock()
+	q.cond.Signal()
+}
+
+// pop returns the next file, taken from the folder following the one of the previous file. It blocks until a file
+// is available, and returns false once the queue is closed and empty.
+func (q *hashQueue) pop() (string, bool) {
+	q.Lock()
+	defer q.Unlock()
+	for len(q.dirs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 {
+		return "", false
+	}
+	i := q.next % len(q.dirs)
+	dir := q.dirs[i]
+	file := q.files[dir][0]
+	if rest := q.files[dir][1:]; len(rest) > 0 {
+		q.files[dir] = rest
+		q.next = i + 1
+	} else {
+		delete(q.files, dir)
+		q.dirs = append(q.dirs[:i], q.dirs[i+1:]...)
+		q.next = i
+	}
+	return file, true
+}
+
+// close lets the workers exit once the queue is empty.
+func (q *hashQueue) close() {
+	q.Lock()
+	q.closed = true
+	q.Unlock()
+	q.cond.Broadcast()
+}
+
+// SetWorkers changes the number of files hashed in parallel before a walk. Defaults to the number of CPUs, 1
+// disables parallel hashing.
+func (h *HashCache) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	h.Lock()
+	h.workers = n
+	h.Unlock()
+}
+
+// prehash hashes in parallel the files below root that are not in the hash cache yet, while they are listed, so that
+// the walk of the filesystem client then finds all of them cached. It does nothing if local reads are rate limited.
+func (c *localFS) prehash(root string) {
+	h := c.hashes
+	h.Lock()
+	workers := h.workers
+	h.Unlock()
+	if workers <= 1 || (c.rateLimit != nil && c.rateLimit() > 0) {
+		return
+	}
+	queue := newHashQueue()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				rel, ok := queue.pop()
+				if !ok {
+					return
+				}
+				c.progress.Phase(rel, FilePhaseHashing, 0)
+				if etag, e := fileMD5(filepath.Join(h.root, filepath.FromSlash(rel))); e == nil {
+					h.record(rel, etag)
+				} else {
+					log.Logger(context.Background()).Debug("Cannot hash " + rel + ": " + e.Error())
+				}
+				c.progress.Done(rel)
+			}
+		}()
+	}
+	base := filepath.Join(h.root, filepath.FromSlash(strings.Trim(root, "/")))
+	filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, er := filepath.Rel(h.root, p)
+		if er != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if c.ignores != nil && c.ignores.Ignored(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if _, etag := h.lookup(rel); etag == "" {
+			queue.push(path.Dir(rel), rel)
+		}
+		return nil
+	})
+	queue.close()
+	wg.Wait()
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pborman/uuid"
+
+	"github.com/pydio/cells/common"
+)
+
+// makeParents creates the missing parent folders of p in one pass, from the top. Each created folder receives
+// its identity marker right away, as the filesystem client would otherwise create it lazily on the next walk,
+// generating spurious events. The folder mode and owner are applied too.
+func (c *localFS) makeParents(p string) error {
+	rel := filepath.Dir(filepath.FromSlash(strings.Trim(p, "/")))
+	if rel == "." {
+		return nil
+	}
+	var missing []string
+	for ; rel != "." && rel != string(filepath.Separator); rel = filepath.Dir(rel) {
+		if _, e := os.Stat(filepath.Join(c.root, rel)); e == nil {
+			break
+		}
+		missing = append(missing, rel)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		folder := filepath.ToSlash(missing[i])
+		if e := os.Mkdir(filepath.Join(c.root, missing[i]), 0755); e != nil && !os.IsExist(e) {
+			return e
+		}
+		c.applyMode(folder, true)
+		c.fixOwner(folder)
+		c.expect(folder)
+		if e := c.writeMarker(folder); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// writeMarker records a new identity for a folder created by the agent.
+func (c *localFS) writeMarker(folder string) error {
+	marker := path.Join(folder, common.PYDIO_SYNC_HIDDEN_FILE_META)
+	abs := filepath.Join(c.root, filepath.FromSlash(marker))
+	id := uuid.New()
+	if e := ioutil.WriteFile(abs, []byte(id), 0644); e != nil {
+		return e
+	}
+	if c.hashes != nil {
+		c.hashes.recordFolder(folder, id)
+	}
+	markHidden(c.root, marker)
+	c.applyMode(marker, false)
+	c.fixOwner(marker)
+	c.expect(marker)
+	return nil
+}
@@ -22,11 +22,10 @@ package endpoint
 
 import (
 	"context"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
-	"sort"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/etcd-io/bbolt"
@@ -36,56 +35,38 @@ import (
 	"github.com/pydio/cells/common/sync/model"
 )
 
-var (
-	patchBucket = []byte("patches")
-	timeKey     = []byte("stamp")
-	opsKey      = []byte("operations")
-)
-
-type patchSorter []merger.Patch
-
-func (p patchSorter) Len() int {
-	return len(p)
-}
-func (p patchSorter) Less(i, j int) bool {
-	return p[i].GetStamp().After(p[j].GetStamp())
-}
-func (p patchSorter) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+// storedPatch is the record of a patch in the history.
+type storedPatch struct {
+	UUID       string
+	Stamp      time.Time
+	Operations []json.RawMessage
 }
 
-// PatchStore is a persistence layer for storing patches. It is based on BoltDB
+// PatchStore is a persistence layer for storing patches in the history of a task.
 type PatchStore struct {
-	patches  chan merger.Patch
-	done     chan bool
-	pipeDone chan bool
+	patches chan merger.Patch
+	done    chan bool
 
 	source model.Endpoint
 	target model.Endpoint
 
-	db         *bbolt.DB
-	folderPath string
+	history *History
+	// Keys of the patches stored by this process, so that patches applied again replace their record
+	keysLock sync.Mutex
+	keys     map[string]string
 }
 
 // NewPatchStore opens a new PatchStore
-func NewPatchStore(folderPath string, source model.Endpoint, target model.Endpoint) (*PatchStore, error) {
+func NewPatchStore(history *History, source model.Endpoint, target model.Endpoint) (*PatchStore, error) {
 	p := &PatchStore{
 		patches: make(chan merger.Patch),
 		done:    make(chan bool, 1),
 		source:  source,
 		target:  target,
+		history: history,
+		keys:    make(map[string]string),
 	}
 
-	options := bbolt.DefaultOptions
-	options.Timeout = 5 * time.Second
-	p.folderPath = folderPath
-	dbPath := filepath.Join(p.folderPath, "patches")
-	db, err := bbolt.Open(dbPath, 0644, options)
-	if err != nil {
-		return nil, err
-	}
-	p.db = db
-
 	go func() {
 		for patch := range p.patches {
 			p.persist(patch)
@@ -138,93 +119,42 @@ func (p *PatchStore) unmarshalConflict(data []byte, op merger.Operation) (merger
 	return conflict, nil
 }
 
-// Load list all patches
+// Load lists patches, most recent first.
 func (p *PatchStore) Load(offset, limit int) (patches []merger.Patch, e error) {
-	var stamps patchSorter
-
-	e = p.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(patchBucket)
-		if bucket == nil {
-			return nil
+	var index int
+	e = p.history.Walk(HistoryPatches, "", "", true, func(key string, value []byte) bool {
+		index++
+		if index <= offset {
+			return true
 		}
-		c := bucket.Cursor()
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
-			patch := merger.NewPatch(p.source.(model.PathSyncSource), p.target.(model.PathSyncTarget), merger.PatchOptions{})
-			// Set the UUID of the patch
-			patch.SetUUID(string(k))
-			// v is a bucket containing all operations
-			patchBucket := bucket.Bucket(k)
-			stamp := patchBucket.Get(timeKey)
-			t := time.Now()
-			if err := t.UnmarshalJSON(stamp); err == nil {
-				patch.Stamp(t)
-			}
-			opsBucket := patchBucket.Bucket(opsKey)
-			oc := opsBucket.Cursor()
-			for _, v := oc.First(); v != nil; _, v = oc.Next() {
-				operation := merger.NewOpForUnmarshall()
-				if err := json.Unmarshal(v, &operation); err == nil {
-					if operation, err = p.unmarshalConflict(v, operation); err != nil {
-						log.Logger(context.Background()).Error("Cannot unmarshall conflict operation:" + err.Error())
-					}
-					patch.Enqueue(operation)
-				} else {
-					log.Logger(context.Background()).Error("Cannot unmarshall operation:" + err.Error())
+		var stored storedPatch
+		if er := json.Unmarshal(value, &stored); er != nil {
+			log.Logger(context.Background()).Error("Cannot unmarshall patch:" + er.Error())
+			return true
+		}
+		patch := merger.NewPatch(p.source.(model.PathSyncSource), p.target.(model.PathSyncTarget), merger.PatchOptions{})
+		patch.SetUUID(stored.UUID)
+		patch.Stamp(stored.Stamp)
+		for _, data := range stored.Operations {
+			operation := merger.NewOpForUnmarshall()
+			if err := json.Unmarshal(data, &operation); err == nil {
+				if operation, err = p.unmarshalConflict(data, operation); err != nil {
+					log.Logger(context.Background()).Error("Cannot unmarshall conflict operation:" + err.Error())
 				}
+				patch.Enqueue(operation)
+			} else {
+				log.Logger(context.Background()).Error("Cannot unmarshall operation:" + err.Error())
 			}
-			stamps = append(stamps, patch)
-		}
-		return nil
-	})
-	if e != nil {
-		return patches, e
-	}
-	// Order patches by timestamp
-	sort.Sort(stamps)
-	var prunes []string
-	if len(stamps) > 100 {
-		for _, pr := range stamps[100:] {
-			prunes = append(prunes, pr.GetUUID())
-		}
-	}
-	for i, patch := range stamps {
-		if i < offset {
-			continue
 		}
 		patches = append(patches, patch)
-		if i >= offset+limit-1 {
-			break
-		}
-	}
-
-	if len(prunes) > 0 {
-		go func() {
-			log.Logger(context.Background()).Info("Pruning patch store")
-			p.db.Update(func(tx *bbolt.Tx) error {
-				bucket := tx.Bucket(patchBucket)
-				if bucket == nil {
-					return nil
-				}
-				for _, uuid := range prunes {
-					if e := bucket.DeleteBucket([]byte(uuid)); e != nil {
-						log.Logger(context.Background()).Error("cannot delete bucket " + uuid + " - " + e.Error())
-					}
-				}
-				return nil
-			})
-		}()
-	}
-
+		return len(patches) < limit
+	})
 	return
 }
 
-// Stop closes the DB.
+// Stop stops persisting patches. The history is closed by its owner.
 func (p *PatchStore) Stop() {
 	close(p.done)
-	if p.pipeDone != nil {
-		close(p.pipeDone)
-	}
-	p.db.Close()
 }
 
 // PublishPatch pushes patch to the persist queue
@@ -232,41 +162,84 @@ func (p *PatchStore) PublishPatch(patch merger.Patch) {
 	p.patches <- patch
 }
 
-func (p PatchStore) persist(patch merger.Patch) {
+func (p *PatchStore) persist(patch merger.Patch) {
 	_, has := patch.HasErrors()
 	if patch.Size() == 0 && !has {
 		return // Do not store empty patch!
 	}
-	p.db.Update(func(tx *bbolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists(patchBucket)
-		if err != nil {
-			return err
+	stored := &storedPatch{UUID: patch.GetUUID(), Stamp: patch.GetStamp()}
+	patch.WalkOperations([]merger.OperationType{}, func(operation merger.Operation) {
+		if data, err := json.Marshal(operation); err == nil {
+			stored.Operations = append(stored.Operations, data)
 		}
-		// Fully replace bucket content
-		bName := []byte(patch.GetUUID())
-		if opsBucket := bucket.Bucket(bName); opsBucket != nil {
-			bucket.DeleteBucket(bName)
-		}
-		patchBucket, err := bucket.CreateBucketIfNotExists(bName)
-		if err != nil {
-			return err
+	})
+	data, e := json.Marshal(stored)
+	if e != nil {
+		return
+	}
+	key := HistoryKey(stored.Stamp, stored.UUID)
+	// Fully replace the record of a patch applied again
+	p.keysLock.Lock()
+	previous, ok := p.keys[stored.UUID]
+	p.keys[stored.UUID] = key
+	p.keysLock.Unlock()
+	if ok && previous != key {
+		p.history.Delete(HistoryPatches, []string{previous})
+	}
+	if e := p.history.Put(HistoryPatches, key, data); e != nil {
+		log.Logger(context.Background()).Error("Cannot store patch: " + e.Error())
+	}
+}
+
+// ImportPatchesFile copies the patches stored by previous versions in their own BoltDB file into the history,
+// then renames the file so that it is imported only once.
+func (p *PatchStore) ImportPatchesFile(file string) (int, error) {
+	if _, e := os.Stat(file); e != nil {
+		return 0, nil
+	}
+	options := BoltOptions(5 * time.Second)
+	options.ReadOnly = true
+	db, e := bbolt.Open(file, 0644, options)
+	if e != nil {
+		return 0, e
+	}
+	var records []*storedPatch
+	e = db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(HistoryPatches))
+		if bucket == nil {
+			return nil
 		}
-		mTime, _ := patch.GetStamp().MarshalJSON()
-		patchBucket.Put(timeKey, mTime)
-		opsBucket, _ := patchBucket.CreateBucket(opsKey)
-		patch.WalkOperations([]merger.OperationType{}, func(operation merger.Operation) {
-			if data, err := json.Marshal(operation); err == nil {
-				id, _ := opsBucket.NextSequence()
-				opsBucket.Put(itob(id), data)
+		return bucket.ForEach(func(k, v []byte) error {
+			patchBucket := bucket.Bucket(k)
+			if v != nil || patchBucket == nil {
+				return nil
+			}
+			stored := &storedPatch{UUID: string(k)}
+			if er := stored.Stamp.UnmarshalJSON(patchBucket.Get([]byte("stamp"))); er != nil {
+				return nil
 			}
+			if opsBucket := patchBucket.Bucket([]byte("operations")); opsBucket != nil {
+				opsBucket.ForEach(func(_, data []byte) error {
+					stored.Operations = append(stored.Operations, append(json.RawMessage{}, data...))
+					return nil
+				})
+			}
+			records = append(records, stored)
+			return nil
 		})
-		return nil
 	})
-}
-
-// itob returns an 8-byte big endian representation of v.
-func itob(v uint64) []byte {
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, v)
-	return b
+	db.Close()
+	if e != nil {
+		return 0, e
+	}
+	for _, stored := range records {
+		data, er := json.Marshal(stored)
+		if er != nil {
+			continue
+		}
+		if er := p.history.Put(HistoryPatches, HistoryKey(stored.Stamp, stored.UUID), data); er != nil {
+			return 0, er
+		}
+	}
+	return len(records), os.Rename(file, file+".imported")
 }
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"crypto/md5"
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// PathLimits describes the constraints of the local filesystem on paths.
+type PathLimits struct {
+	// MaxPath is the maximum length of an absolute path, in bytes
+	MaxPath int
+	// MaxComponent is the maximum length of a file or folder name, in bytes
+	MaxComponent int
+	// MaxDepth is the maximum number of folders levels below the sync root
+	MaxDepth int
+}
+
+// PlatformPathLimits returns the path limits of the current OS.
+func PlatformPathLimits() PathLimits {
+	switch runtime.GOOS {
+	case "windows":
+		// Legacy MAX_PATH, as long paths support is not enabled by default
+		return PathLimits{MaxPath: 259, MaxComponent: 255, MaxDepth: 128}
+	case "darwin":
+		return PathLimits{MaxPath: 1023, MaxComponent: 255, MaxDepth: 256}
+	default:
+		return PathLimits{MaxPath: 4095, MaxComponent: 255, MaxDepth: 256}
+	}
+}
+
+// PathViolation is returned when a path cannot be created locally. It provides a suggested path that fits the limits.
+type PathViolation struct {
+	Path      string
+	Reason    string
+	Suggested string
+}
+
+// Error implements error interface.
+func (p *PathViolation) Error() string {
+	return fmt.Sprintf("cannot write %s locally: %s", p.Path, p.Reason)
+}
+
+// Validate checks if a path relative to the given root fits the limits.
+func (l PathLimits) Validate(root, p string) *PathViolation {
+	rel := strings.Trim(p, "/")
+	if rel == "" {
+		return nil
+	}
+	parts := strings.Split(rel, "/")
+	if l.MaxDepth > 0 && len(parts) > l.MaxDepth {
+		return &PathViolation{Path: p, Reason: fmt.Sprintf("path is deeper than %d levels", l.MaxDepth)}
+	}
+	var reason string
+	for i, part := range parts {
+		if l.MaxComponent > 0 && len(part) > l.MaxComponent {
+			reason = fmt.Sprintf("name is longer than %d characters", l.MaxComponent)
+			parts[i] = shortenName(part, l.MaxComponent)
+		}
+	}
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if l.MaxPath > 0 && len(full) > l.MaxPath {
+		if reason == "" {
+			reason = fmt.Sprintf("full path is longer than %d characters", l.MaxPath)
+		}
+		last := len(parts) - 1
+		if excess := len(full) - l.MaxPath; len(parts[last])-excess > 0 {
+			parts[last] = shortenName(parts[last], len(parts[last])-excess)
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	suggested := "/" + strings.Join(parts, "/")
+	if len(filepath.Join(root, filepath.FromSlash(suggested))) > l.MaxPath || suggested == "/"+rel {
+		// Cannot be fixed by renaming the file only
+		suggested = ""
+	}
+	return &PathViolation{Path: p, Reason: reason, Suggested: suggested}
+}
+
+// shortenName truncates a name to max bytes, keeping its extension and adding a short hash to avoid collisions.
+func shortenName(name string, max int) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	hash := fmt.Sprintf("~%x", md5.Sum([]byte(name)))[:7]
+	keep := max - len(ext) - len(hash)
+	if keep <= 0 {
+		return hash[1:]
+	}
+	for len(base) > keep {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	return base + hash + ext
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+var pathVariable = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// PathVariables lists the variables that can be used in the remote root of a task, resolved when the task starts.
+var PathVariables = []string{"username", "hostname", "date", "year", "month"}
+
+// HasPathTemplate checks if the path of a URI contains variables.
+func HasPathTemplate(uri string) bool {
+	u, e := url.Parse(uri)
+	return e == nil && pathVariable.MatchString(u.Path)
+}
+
+// ResolvePathTemplate replaces the variables found in the path of a remote URI, e.g. /backups/{hostname}/{date}.
+// Unknown variables and values that cannot be used as a folder name are rejected. Variables cannot be used in the
+// first segment, which is the workspace.
+func ResolvePathTemplate(uri string, now time.Time) (string, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return "", e
+	}
+	if !pathVariable.MatchString(u.Path) {
+		return uri, nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("variables are only supported in the path of remote servers")
+	}
+	hostname, _ := os.Hostname()
+	values := map[string]string{
+		"username": u.User.Username(),
+		"hostname": hostname,
+		"date":     now.Format("2006-01-02"),
+		"year":     now.Format("2006"),
+		"month":    now.Format("01"),
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		var err error
+		resolved := pathVariable.ReplaceAllStringFunc(segment, func(v string) string {
+			name := v[1 : len(v)-1]
+			value, ok := values[name]
+			if !ok {
+				err = fmt.Errorf("unknown variable %s in remote path, supported variables are {%s}", v, strings.Join(PathVariables, "}, {"))
+			} else if i == 0 {
+				err = fmt.Errorf("variable %s cannot be used in the workspace name", v)
+			} else if value == "" {
+				err = fmt.Errorf("variable %s has no value on this device", v)
+			}
+			return value
+		})
+		if err != nil {
+			return "", err
+		}
+		if resolved == "." || resolved == ".." || strings.ContainsAny(resolved, "/\\") {
+			return "", fmt.Errorf("segment %s of remote path resolves to an invalid folder name %q", segment, resolved)
+		}
+		segments[i] = resolved
+	}
+	u.Path = "/" + strings.Join(segments, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// CreateRemoteRoot creates the folders of the root of a remote URI below its workspace, if they do not exist.
+func CreateRemoteRoot(ctx context.Context, uri string) error {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return e
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return nil
+	}
+	root := *u
+	root.Path, root.RawQuery = "", ""
+	ep, e := EndpointFromURI(root.String(), "", true)
+	if e != nil {
+		return e
+	}
+	target, ok := model.AsPathSyncTarget(ep)
+	if !ok {
+		return fmt.Errorf("cannot create folders on %s", root.String())
+	}
+	for i := 2; i <= len(segments); i++ {
+		p := strings.Join(segments[:i], "/")
+		if _, e := ep.LoadNode(ctx, p); e == nil {
+			continue
+		}
+		if e := target.CreateNode(ctx, &tree.Node{Path: p, Type: tree.NodeType_COLLECTION}, false); e != nil {
+			return e
+		}
+		// Wait for the folder to be indexed before creating its children
+		model.Retry(func() error {
+			_, e := ep.LoadNode(ctx, p)
+			return e
+		}, 2*time.Second, 10*time.Second)
+	}
+	return nil
+}
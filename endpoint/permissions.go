@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// modeTemplate computes the mode bits of the entries created by a local endpoint.
+type modeTemplate struct {
+	file    os.FileMode
+	dir     os.FileMode
+	inherit bool
+}
+
+// parseMode parses an octal mode string. An empty string returns 0.
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, e := strconv.ParseUint(s, 8, 32)
+	if e != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid mode %s, expecting an octal value like 0640", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// SetPermissions applies the mode bits of the task configuration to the files and folders created by a local
+// endpoint.
+func SetPermissions(ep model.Endpoint, conf *config.Permissions) (bool, error) {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return false, nil
+	}
+	t := &modeTemplate{inherit: conf.Inherit}
+	var e error
+	if t.file, e = parseMode(conf.FileMode); e != nil {
+		return false, e
+	}
+	if t.dir, e = parseMode(conf.DirMode); e != nil {
+		return false, e
+	}
+	c.modes = t
+	return true, nil
+}
+
+// mode returns the mode to apply on a new entry whose parent folder is parent, or 0 to keep the default.
+func (t *modeTemplate) mode(parent string, dir bool) os.FileMode {
+	if t.inherit {
+		info, e := os.Stat(parent)
+		if e != nil {
+			return 0
+		}
+		if dir {
+			return info.Mode().Perm()
+		}
+		return info.Mode().Perm() &^ 0111
+	}
+	if dir {
+		return t.dir
+	}
+	return t.file
+}
+
+// applyMode sets the mode bits of a created entry.
+func (c *localFS) applyMode(p string, dir bool) {
+	if c.modes == nil {
+		return
+	}
+	abs := filepath.Join(c.root, filepath.FromSlash(strings.Trim(p, "/")))
+	if m := c.modes.mode(filepath.Dir(abs), dir); m != 0 {
+		os.Chmod(abs, m)
+	}
+}
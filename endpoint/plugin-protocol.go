@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pydio/cells-sync/proto/plugin"
+)
+
+// PluginHandshake is shared by cells-sync and endpoint plugins. Plugins are executables named
+// cells-sync-plugin-<name> placed in the plugins folder, and are used with plugin://<name>/path URIs. They serve
+// the Endpoint gRPC service defined in proto/plugin, so that they can be written in any language supported by
+// hashicorp/go-plugin.
+var PluginHandshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  2,
+	MagicCookieKey:   "CELLS_SYNC_PLUGIN",
+	MagicCookieValue: "endpoint",
+}
+
+const pluginName = "endpoint"
+
+// PluginNode describes a node of a plugin backend.
+type PluginNode struct {
+	Path   string
+	Folder bool
+	Size   int64
+	MTime  int64
+	Etag   string
+	Uuid   string
+}
+
+// PluginBackend is implemented by endpoint plugins written in Go, and served with ServePlugin. Paths are relative
+// to the root of the URI passed to Init. Stat must return an error satisfying os.IsNotExist for missing nodes.
+type PluginBackend interface {
+	Init(uri string) error
+	Walk(root string, recursive bool) ([]*PluginNode, error)
+	Stat(p string) (*PluginNode, error)
+	Mkdir(p string) error
+	Delete(p string) error
+	Move(from, to string) error
+	Read(p string, offset, length int64) ([]byte, error)
+	Write(p string, offset int64, data []byte) error
+}
+
+// ServePlugin is called by the main function of a plugin executable written in Go to serve its backend.
+func ServePlugin(impl PluginBackend) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: PluginHandshake,
+		Plugins:         map[string]goplugin.Plugin{pluginName: &endpointPlugin{impl: impl}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// endpointPlugin implements goplugin.GRPCPlugin.
+type endpointPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	impl PluginBackend
+}
+
+func (p *endpointPlugin) GRPCServer(b *goplugin.GRPCBroker, s *grpc.Server) error {
+	plugin.RegisterEndpointServer(s, &pluginGRPCServer{impl: p.impl})
+	return nil
+}
+
+func (p *endpointPlugin) GRPCClient(ctx context.Context, b *goplugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &pluginGRPCClient{client: plugin.NewEndpointClient(c)}, nil
+}
+
+func toProtoNode(n *PluginNode) *plugin.Node {
+	return &plugin.Node{Path: n.Path, Folder: n.Folder, Size: n.Size, MTime: n.MTime, Etag: n.Etag, Uuid: n.Uuid}
+}
+
+func fromProtoNode(n *plugin.Node) *PluginNode {
+	return &PluginNode{Path: n.Path, Folder: n.Folder, Size: n.Size, MTime: n.MTime, Etag: n.Etag, Uuid: n.Uuid}
+}
+
+// pluginError converts a backend error to a gRPC status, keeping missing nodes recognizable.
+func pluginError(e error) error {
+	if e == nil {
+		return nil
+	}
+	if os.IsNotExist(e) {
+		return status.Error(codes.NotFound, e.Error())
+	}
+	return status.Error(codes.Unknown, e.Error())
+}
+
+// pluginGRPCServer runs in the plugin process.
+type pluginGRPCServer struct {
+	plugin.UnimplementedEndpointServer
+	impl PluginBackend
+}
+
+func (s *pluginGRPCServer) Init(ctx context.Context, req *plugin.InitRequest) (*plugin.Empty, error) {
+	return &plugin.Empty{}, pluginError(s.impl.Init(req.URI))
+}
+
+func (s *pluginGRPCServer) Walk(req *plugin.WalkRequest, stream plugin.Endpoint_WalkServer) error {
+	nodes, e := s.impl.Walk(req.Path, req.Recursive)
+	if e != nil {
+		return pluginError(e)
+	}
+	for _, n := range nodes {
+		if e := stream.Send(toProtoNode(n)); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *pluginGRPCServer) Stat(ctx context.Context, req *plugin.PathRequest) (*plugin.Node, error) {
+	n, e := s.impl.Stat(req.Path)
+	if e != nil {
+		return nil, pluginError(e)
+	}
+	return toProtoNode(n), nil
+}
+
+func (s *pluginGRPCServer) Mkdir(ctx context.Context, req *plugin.PathRequest) (*plugin.Empty, error) {
+	return &plugin.Empty{}, pluginError(s.impl.Mkdir(req.Path))
+}
+
+func (s *pluginGRPCServer) Delete(ctx context.Context, req *plugin.PathRequest) (*plugin.Empty, error) {
+	return &plugin.Empty{}, pluginError(s.impl.Delete(req.Path))
+}
+
+func (s *pluginGRPCServer) Move(ctx context.Context, req *plugin.MoveRequest) (*plugin.Empty, error) {
+	return &plugin.Empty{}, pluginError(s.impl.Move(req.From, req.To))
+}
+
+func (s *pluginGRPCServer) Read(ctx context.Context, req *plugin.ReadRequest) (*plugin.ReadResponse, error) {
+	data, e := s.impl.Read(req.Path, req.Offset, req.Length)
+	if e != nil {
+		return nil, pluginError(e)
+	}
+	return &plugin.ReadResponse{Data: data}, nil
+}
+
+func (s *pluginGRPCServer) Write(ctx context.Context, req *plugin.WriteRequest) (*plugin.Empty, error) {
+	return &plugin.Empty{}, pluginError(s.impl.Write(req.Path, req.Offset, req.Data))
+}
+
+// pluginGRPCClient runs in cells-sync and forwards calls to the plugin process.
+type pluginGRPCClient struct {
+	client plugin.EndpointClient
+}
+
+// clientError converts a gRPC status back to an error, missing nodes satisfying os.IsNotExist.
+func clientError(p string, e error) error {
+	if e == nil {
+		return nil
+	}
+	if s, ok := status.FromError(e); ok {
+		if s.Code() == codes.NotFound {
+			return &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+		}
+		return &os.PathError{Op: "plugin", Path: p, Err: errors.New(s.Message())}
+	}
+	return e
+}
+
+func (c *pluginGRPCClient) Init(uri string) error {
+	_, e := c.client.Init(context.Background(), &plugin.InitRequest{URI: uri})
+	return clientError(uri, e)
+}
+
+func (c *pluginGRPCClient) Walk(root string, recursive bool) (nodes []*PluginNode, e error) {
+	stream, e := c.client.Walk(context.Background(), &plugin.WalkRequest{Path: root, Recursive: recursive})
+	if e != nil {
+		return nil, clientError(root, e)
+	}
+	for {
+		n, e := stream.Recv()
+		if e == io.EOF {
+			return nodes, nil
+		} else if e != nil {
+			return nil, clientError(root, e)
+		}
+		nodes = append(nodes, fromProtoNode(n))
+	}
+}
+
+func (c *pluginGRPCClient) Stat(p string) (*PluginNode, error) {
+	n, e := c.client.Stat(context.Background(), &plugin.PathRequest{Path: p})
+	if e != nil {
+		return nil, clientError(p, e)
+	}
+	return fromProtoNode(n), nil
+}
+
+func (c *pluginGRPCClient) Mkdir(p string) error {
+	_, e := c.client.Mkdir(context.Background(), &plugin.PathRequest{Path: p})
+	return clientError(p, e)
+}
+
+func (c *pluginGRPCClient) Delete(p string) error {
+	_, e := c.client.Delete(context.Background(), &plugin.PathRequest{Path: p})
+	return clientError(p, e)
+}
+
+func (c *pluginGRPCClient) Move(from, to string) error {
+	_, e := c.client.Move(context.Background(), &plugin.MoveRequest{From: from, To: to})
+	return clientError(from, e)
+}
+
+func (c *pluginGRPCClient) Read(p string, offset, length int64) ([]byte, error) {
+	resp, e := c.client.Read(context.Background(), &plugin.ReadRequest{Path: p, Offset: offset, Length: length})
+	if e != nil {
+		return nil, clientError(p, e)
+	}
+	return resp.Data, nil
+}
+
+func (c *pluginGRPCClient) Write(p string, offset int64, data []byte) error {
+	_, e := c.client.Write(context.Background(), &plugin.WriteRequest{Path: p, Offset: offset, Data: data})
+	return clientError(p, e)
+}
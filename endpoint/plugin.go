@@ -0,0 +1,290 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	goplugin "github.com/hashicorp/go-plugin"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	pluginPrefix    = "cells-sync-plugin-"
+	pluginChunkSize = 1024 * 1024
+)
+
+var (
+	pluginClients     = make(map[string]*goplugin.Client)
+	pluginClientsLock = &sync.Mutex{}
+)
+
+// PluginsDir is the folder where endpoint plugins are discovered.
+func PluginsDir() string {
+	return filepath.Join(config.SyncClientDataDir(), "plugins")
+}
+
+// ListPlugins lists the names of the plugins found in the plugins folder.
+func ListPlugins() (names []string) {
+	files, e := ioutil.ReadDir(PluginsDir())
+	if e != nil {
+		return
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".exe")
+		if f.IsDir() || !strings.HasPrefix(name, pluginPrefix) {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(name, pluginPrefix))
+	}
+	return
+}
+
+// StopPlugins kills all running plugin processes.
+func StopPlugins() {
+	pluginClientsLock.Lock()
+	defer pluginClientsLock.Unlock()
+	for name, c := range pluginClients {
+		c.Kill()
+		delete(pluginClients, name)
+	}
+}
+
+// pluginBackend starts the plugin process if required, and returns its backend.
+func pluginBackend(name string) (PluginBackend, error) {
+	pluginClientsLock.Lock()
+	defer pluginClientsLock.Unlock()
+	client, ok := pluginClients[name]
+	if !ok || client.Exited() {
+		bin := filepath.Join(PluginsDir(), pluginPrefix+name)
+		if runtime.GOOS == "windows" {
+			bin += ".exe"
+		}
+		if _, e := os.Stat(bin); e != nil {
+			return nil, fmt.Errorf("cannot find plugin %s in %s", name, PluginsDir())
+		}
+		client = goplugin.NewClient(&goplugin.ClientConfig{
+			HandshakeConfig:  PluginHandshake,
+			Plugins:          map[string]goplugin.Plugin{pluginName: &endpointPlugin{}},
+			Cmd:              exec.Command(bin),
+			AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		})
+		pluginClients[name] = client
+	}
+	rpcClient, e := client.Client()
+	if e != nil {
+		return nil, e
+	}
+	raw, e := rpcClient.Dispense(pluginName)
+	if e != nil {
+		return nil, e
+	}
+	backend, ok := raw.(PluginBackend)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s does not implement an endpoint", name)
+	}
+	return backend, nil
+}
+
+// pluginEndpoint is a sync endpoint backed by an out-of-process plugin.
+type pluginEndpoint struct {
+	uri     string
+	backend PluginBackend
+}
+
+// newPluginEndpoint opens a plugin://name/path URI.
+func newPluginEndpoint(uri string) (*pluginEndpoint, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return nil, e
+	}
+	backend, e := pluginBackend(u.Host)
+	if e != nil {
+		return nil, e
+	}
+	if e := backend.Init(uri); e != nil {
+		return nil, e
+	}
+	return &pluginEndpoint{uri: uri, backend: backend}, nil
+}
+
+func (p *PluginNode) toNode() *tree.Node {
+	n := &tree.Node{
+		Uuid:  p.Uuid,
+		Path:  strings.Trim(p.Path, "/"),
+		Size:  p.Size,
+		MTime: p.MTime,
+		Etag:  p.Etag,
+		Type:  tree.NodeType_LEAF,
+	}
+	if p.Folder {
+		n.Type = tree.NodeType_COLLECTION
+	}
+	return n
+}
+
+// GetEndpointInfo implements model.Endpoint.
+func (e *pluginEndpoint) GetEndpointInfo() model.EndpointInfo {
+	return model.EndpointInfo{
+		URI:                   e.uri,
+		RequiresFoldersRescan: true,
+		RequiresNormalization: false,
+	}
+}
+
+// LoadNode implements model.Endpoint.
+func (e *pluginEndpoint) LoadNode(ctx context.Context, p string, extendedStats ...bool) (*tree.Node, error) {
+	n, err := e.backend.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return n.toNode(), nil
+}
+
+// Walk implements model.PathSyncSource.
+func (e *pluginEndpoint) Walk(walknFc model.WalkNodesFunc, root string, recursive bool) error {
+	nodes, err := e.backend.Walk(root, recursive)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		node := n.toNode()
+		walknFc(node.Path, node, nil)
+	}
+	return nil
+}
+
+// Watch is not supported by plugins, tasks using them must run with sync loops instead of realtime.
+func (e *pluginEndpoint) Watch(recursivePath string) (*model.WatchObject, error) {
+	return nil, errors.New("plugin endpoints do not support realtime watches")
+}
+
+// CreateNode implements model.PathSyncTarget. Only folders are created here, files are written by GetWriterOn.
+func (e *pluginEndpoint) CreateNode(ctx context.Context, node *tree.Node, updateIfExists bool) error {
+	if node.IsLeaf() {
+		return nil
+	}
+	return e.backend.Mkdir(node.GetPath())
+}
+
+// DeleteNode implements model.PathSyncTarget.
+func (e *pluginEndpoint) DeleteNode(ctx context.Context, p string) error {
+	return e.backend.Delete(p)
+}
+
+// MoveNode implements model.PathSyncTarget.
+func (e *pluginEndpoint) MoveNode(ctx context.Context, oldPath string, newPath string) error {
+	return e.backend.Move(oldPath, newPath)
+}
+
+// GetReaderOn implements model.DataSyncSource, reading the file by chunks.
+func (e *pluginEndpoint) GetReaderOn(p string) (io.ReadCloser, error) {
+	return &pluginReader{backend: e.backend, path: p}, nil
+}
+
+// GetWriterOn implements model.DataSyncTarget, sending the file by chunks.
+func (e *pluginEndpoint) GetWriterOn(ctx context.Context, p string, targetSize int64) (io.WriteCloser, chan bool, chan error, error) {
+	if dir := path.Dir(strings.Trim(p, "/")); dir != "." {
+		if _, err := e.backend.Stat(dir); err != nil {
+			if err := e.backend.Mkdir(dir); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	reader, writer := io.Pipe()
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(done)
+		defer close(errs)
+		buf := make([]byte, pluginChunkSize)
+		var offset int64
+		for {
+			n, err := io.ReadFull(reader, buf)
+			if n > 0 || offset == 0 {
+				if we := e.backend.Write(p, offset, buf[:n]); we != nil {
+					reader.CloseWithError(we)
+					errs <- we
+					return
+				}
+				offset += int64(n)
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				done <- true
+				return
+			} else if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	return writer, done, errs, nil
+}
+
+// pluginReader reads a plugin file by chunks.
+type pluginReader struct {
+	backend PluginBackend
+	path    string
+	offset  int64
+	buf     []byte
+	eof     bool
+}
+
+func (r *pluginReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		data, err := r.backend.Read(r.path, r.offset, pluginChunkSize)
+		if err != nil {
+			return 0, err
+		}
+		r.offset += int64(len(data))
+		r.buf = data
+		if len(data) < pluginChunkSize {
+			r.eof = true
+		}
+		if len(data) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *pluginReader) Close() error {
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// Owner is the unprivileged account that owns a local root. When the agent runs elevated (e.g. started by an
+// installer), files created by the engine are given to this account and external workers run as this account.
+type Owner struct {
+	Uid int
+	Gid int
+}
+
+// SetOwner makes a local endpoint give the files and folders it creates to owner, and runs its content scanner
+// as owner. The root itself is given to owner if it belongs to the elevated account. It must be called after
+// SetScanner.
+func SetOwner(ep model.Endpoint, owner *Owner) bool {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return false
+	}
+	c.owner = owner
+	chownElevated(c.root, owner)
+	if s, ok := c.scanner.(*commandScanner); ok {
+		s.owner = owner
+	}
+	return true
+}
+
+// fixOwner gives p and the parent folders created along with it to the owner of the root. Only entries still
+// owned by the elevated account are changed.
+func (c *localFS) fixOwner(p string) {
+	if c.owner == nil {
+		return
+	}
+	rel := strings.Trim(p, "/")
+	for rel != "" && rel != "." {
+		abs := filepath.Join(c.root, filepath.FromSlash(rel))
+		if !chownElevated(abs, c.owner) {
+			// Parents that already belong to the user were not created by the engine
+			return
+		}
+		rel = filepath.ToSlash(filepath.Dir(rel))
+	}
+}
+
+// ownerPath returns the closest existing path to p, to find the owner of a root that does not exist yet.
+func ownerPath(p string) string {
+	for {
+		if _, e := os.Stat(p); e == nil {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
+	}
+}
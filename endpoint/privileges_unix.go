@@ -0,0 +1,102 @@
+// +build !windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// Elevated returns true if the process runs as root.
+func Elevated() bool {
+	return os.Geteuid() == 0
+}
+
+// RootOwner finds the unprivileged account owning a local root. If the root belongs to root itself, the account
+// that called sudo is used. It returns nil if no unprivileged account can be found.
+func RootOwner(root string) *Owner {
+	if info, e := os.Stat(ownerPath(root)); e == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 {
+			return &Owner{Uid: int(stat.Uid), Gid: int(stat.Gid)}
+		}
+	}
+	uid, e1 := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, e2 := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if e1 == nil && e2 == nil && uid != 0 {
+		return &Owner{Uid: uid, Gid: gid}
+	}
+	return nil
+}
+
+// CheckOwnerAccess verifies that owner can read, write and traverse the root, so that the files synced by the
+// elevated agent remain usable by the user.
+func CheckOwnerAccess(root string, owner *Owner) error {
+	info, e := os.Stat(root)
+	if e != nil {
+		return e
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	perm := info.Mode().Perm()
+	var bits os.FileMode
+	switch {
+	case int(stat.Uid) == owner.Uid:
+		bits = perm >> 6
+	case int(stat.Gid) == owner.Gid:
+		bits = perm >> 3
+	default:
+		bits = perm
+	}
+	if bits&07 != 07 {
+		return fmt.Errorf("user %d cannot read and write %s (mode %s, owner %d:%d)", owner.Uid, root, info.Mode().String(), stat.Uid, stat.Gid)
+	}
+	return nil
+}
+
+// DropPrivileges makes a command run as owner.
+func DropPrivileges(cmd *exec.Cmd, owner *Owner) {
+	if owner == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(owner.Uid), Gid: uint32(owner.Gid)}
+}
+
+// chownElevated gives a path owned by root to owner. It returns false if the path did not belong to root.
+func chownElevated(abs string, owner *Owner) bool {
+	info, e := os.Lstat(abs)
+	if e != nil {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Uid != 0 {
+		return false
+	}
+	return os.Lchown(abs, owner.Uid, owner.Gid) == nil
+}
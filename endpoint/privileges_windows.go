@@ -0,0 +1,49 @@
+// +build windows
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"os/exec"
+)
+
+// Elevated is not detected on Windows: files created by an elevated process inherit the ACLs of their parent
+// folder and remain accessible to the user.
+func Elevated() bool {
+	return false
+}
+
+// RootOwner is not supported on Windows.
+func RootOwner(root string) *Owner {
+	return nil
+}
+
+// CheckOwnerAccess is not supported on Windows.
+func CheckOwnerAccess(root string, owner *Owner) error {
+	return nil
+}
+
+// DropPrivileges is not supported on Windows.
+func DropPrivileges(cmd *exec.Cmd, owner *Owner) {}
+
+func chownElevated(abs string, owner *Owner) bool {
+	return false
+}
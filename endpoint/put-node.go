@@ -0,0 +1,188 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PutOptions tunes a PutNode call.
+type PutOptions struct {
+	// Offset resumes an interrupted write: the existing file is kept up to Offset and the reader provides the
+	// remaining contents. It must not be greater than the current file size.
+	Offset int64
+}
+
+// PutNode writes the contents of reader to a local file. Contents are written to a temporary file in the same
+// folder, that is moved in place once complete, so that the previous version stays untouched until then and no
+// trailing bytes of it can remain. With an Offset, the existing file is completed in place and truncated to its
+// final size instead. The writers returned by GetWriterOn go through PutNode.
+func (c *localFS) PutNode(ctx context.Context, p string, reader io.Reader, size int64, opts PutOptions) error {
+	if e := c.prepareWrite(ctx, p, size); e != nil {
+		return e
+	}
+	if opts.Offset > 0 {
+		return c.writeAt(ctx, p, reader, size, opts.Offset)
+	}
+	if c.scanner != nil {
+		// Scanned contents already go through the quarantine folder before being moved in place
+		return c.putThroughWriter(ctx, p, reader, size)
+	}
+	return c.put(p, reader, size)
+}
+
+// put writes a file that was checked by prepareWrite through a temporary file.
+func (c *localFS) put(p string, reader io.Reader, size int64) error {
+	temp, commit, e := c.writeTarget(p)
+	if e != nil {
+		return e
+	}
+	if e := c.makeParents(temp); e != nil {
+		return e
+	}
+	c.expect(temp)
+	hash, e := c.writeFile(p, c.abs(temp), reader, size, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0)
+	if e != nil {
+		os.Remove(c.abs(temp))
+		return e
+	}
+	if e := commit(hash); e != nil {
+		return e
+	}
+	c.written(p, hash)
+	return nil
+}
+
+// writeAt completes an existing file from offset, and truncates it to its final size.
+func (c *localFS) writeAt(ctx context.Context, p string, reader io.Reader, size int64, offset int64) error {
+	if c.scanner != nil {
+		return fmt.Errorf("cannot resume %s: offset writes are not supported with a content scanner", p)
+	}
+	info, e := os.Stat(c.abs(p))
+	if e != nil {
+		return e
+	}
+	if offset > info.Size() {
+		return fmt.Errorf("cannot resume %s at offset %d, file size is %d", p, offset, info.Size())
+	}
+	c.expect(p)
+	if _, e := c.writeFile(p, c.abs(p), reader, size-offset, os.O_WRONLY, offset); e != nil {
+		return e
+	}
+	c.written(p, "")
+	return nil
+}
+
+// writeFile copies reader into a file opened with flag, starting at offset. The file is truncated at the end
+// of the written contents and flushed to disk. It fails if the reader does not provide exactly size bytes (when
+// size is known), so that an interrupted transfer is never committed. It returns the MD5 of the written contents.
+func (c *localFS) writeFile(p string, abs string, reader io.Reader, size int64, flag int, offset int64) (string, error) {
+	f, e := os.OpenFile(abs, flag, 0644)
+	if e != nil {
+		return "", e
+	}
+	if offset > 0 {
+		if _, e := f.Seek(offset, io.SeekStart); e != nil {
+			f.Close()
+			return "", e
+		}
+	}
+	hashing := &hashingWriter{WriteCloser: f, h: md5.New()}
+	var out io.WriteCloser = hashing
+	if c.rateLimit != nil {
+		out = &throttledWriter{WriteCloser: out, limiter: &rateLimiter{limit: c.rateLimit}}
+	}
+	if c.transfers != nil {
+		out = &limitedWriter{WriteCloser: out, bucket: c.transfers.Download, release: c.transfers.acquire()}
+	}
+	out, _ = trackWriter(c.progress, p, size, out, nil, false)
+	n, e := io.Copy(out, reader)
+	if e == nil && size >= 0 && n != size {
+		e = fmt.Errorf("incomplete contents for %s: received %d bytes, expected %d", p, n, size)
+	}
+	if e == nil {
+		e = f.Truncate(offset + n)
+	}
+	if e == nil {
+		e = f.Sync()
+	}
+	if er := out.Close(); e == nil {
+		e = er
+	}
+	if e != nil {
+		return "", e
+	}
+	c.progress.Done(p)
+	return hashing.sum(), nil
+}
+
+// putThroughWriter copies reader to the scanning writer, and waits until the file is in place.
+func (c *localFS) putThroughWriter(ctx context.Context, p string, reader io.Reader, size int64) error {
+	out, done, errs, e := c.scanningWriter(ctx, p, size)
+	if e != nil {
+		return e
+	}
+	_, e = io.Copy(out, reader)
+	if er := out.Close(); e == nil {
+		e = er
+	}
+	if e != nil || done == nil {
+		return e
+	}
+	select {
+	case _, ok := <-done:
+		if ok {
+			return nil
+		}
+		select {
+		case e := <-errs:
+			return e
+		default:
+			return fmt.Errorf("cannot write %s", p)
+		}
+	case e := <-errs:
+		return e
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// written applies the attributes of the files created by the agent. An empty hash is computed again on next walk.
+func (c *localFS) written(p string, hash string) {
+	markHidden(c.root, p)
+	c.applyMode(p, false)
+	c.fixOwner(p)
+	c.tagOrigin(p)
+	c.expect(p)
+	if c.hashes != nil && hash != "" {
+		c.hashes.record(p, hash)
+	}
+}
+
+// abs returns the absolute path of a path relative to the root.
+func (c *localFS) abs(p string) string {
+	return filepath.Join(c.root, filepath.FromSlash(strings.TrimLeft(p, "/")))
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPutNode checks that overwritten files never keep trailing bytes of their previous version, and that
+// incomplete contents are never committed.
+func TestPutNode(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing string
+		path     string
+		offset   int64
+		content  string
+		size     int64
+		expected string
+		fail     bool
+	}{
+		{name: "new file", path: "file.txt", content: "hello", size: 5, expected: "hello"},
+		{name: "new file in new folder", path: "sub/folder/file.txt", content: "hello", size: 5, expected: "hello"},
+		{name: "shorter overwrite", existing: "0123456789", path: "file.txt", content: "abc", size: 3, expected: "abc"},
+		{name: "longer overwrite", existing: "abc", path: "file.txt", content: "0123456789", size: 10, expected: "0123456789"},
+		{name: "unknown size", existing: "0123456789", path: "file.txt", content: "abc", size: -1, expected: "abc"},
+		{name: "empty overwrite", existing: "0123456789", path: "file.txt", content: "", size: 0, expected: ""},
+		{name: "incomplete", existing: "0123456789", path: "file.txt", content: "ab", size: 5, expected: "0123456789", fail: true},
+		{name: "too long", existing: "0123456789", path: "file.txt", content: "abcdef", size: 5, expected: "0123456789", fail: true},
+		{name: "resume", existing: "01234XXXXXXXXX", path: "file.txt", offset: 5, content: "56789", size: 10, expected: "0123456789"},
+		{name: "resume past end", existing: "01234", path: "file.txt", offset: 8, content: "89", size: 10, expected: "01234", fail: true},
+	}
+	for _, c := range cases {
+		root, e := ioutil.TempDir("", "put-node")
+		if e != nil {
+			t.Fatal(e)
+		}
+		ep, e := EndpointFromURI("fs://"+filepath.ToSlash(root), "")
+		if e != nil {
+			t.Fatal(e)
+		}
+		local := ep.(*localFS)
+		abs := filepath.Join(root, filepath.FromSlash(c.path))
+		if c.existing != "" {
+			if e := ioutil.WriteFile(abs, []byte(c.existing), 0644); e != nil {
+				t.Fatal(e)
+			}
+		}
+		e = local.PutNode(context.Background(), c.path, strings.NewReader(c.content), c.size, PutOptions{Offset: c.offset})
+		if (e != nil) != c.fail {
+			t.Errorf("%s: expected failure=%v, got %v", c.name, c.fail, e)
+		}
+		if data, _ := ioutil.ReadFile(abs); string(data) != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, string(data))
+		}
+		filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err == nil && strings.HasPrefix(info.Name(), JournalTempPrefix) {
+				t.Errorf("%s: temporary file %s was left", c.name, p)
+			}
+			return nil
+		})
+		os.RemoveAll(root)
+	}
+}
+
+// TestGetWriterOnTruncates checks that the writers used by the sync engine replace the whole file.
+func TestGetWriterOnTruncates(t *testing.T) {
+	root, e := ioutil.TempDir("", "writer-on")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(root)
+	ep, e := EndpointFromURI("fs://"+filepath.ToSlash(root), "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := ioutil.WriteFile(filepath.Join(root, "file.txt"), []byte("0123456789"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	w, done, errs, e := ep.(*localFS).GetWriterOn(context.Background(), "/file.txt", 3)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := w.Write([]byte("abc")); e != nil {
+		t.Fatal(e)
+	}
+	if e := w.Close(); e != nil {
+		t.Fatal(e)
+	}
+	select {
+	case <-done:
+	case e := <-errs:
+		t.Fatal(e)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "file.txt")); string(data) != "abc" {
+		t.Errorf("expected %q, got %q", "abc", string(data))
+	}
+}
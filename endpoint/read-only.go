@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ErrReadOnly is returned by local endpoints for any write on a read-only root.
+var ErrReadOnly = errors.New("folder is read-only")
+
+// IsReadOnlyFolder checks if a local folder is on read-only media or cannot be written by the current user,
+// by trying to create a temporary file in it.
+func IsReadOnlyFolder(root string) bool {
+	f, e := ioutil.TempFile(root, ".cells-sync-probe-")
+	if e != nil {
+		if pe, ok := e.(*os.PathError); ok && pe.Err == syscall.EROFS {
+			return true
+		}
+		return os.IsPermission(e)
+	}
+	name := f.Name()
+	f.Close()
+	os.Remove(name)
+	return false
+}
+
+// IsReadOnlyURI checks if a URI points to a read-only local folder, or to a remote workspace where the current
+// user is not allowed to write (e.g. a read-only share).
+func IsReadOnlyURI(uri string) bool {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		ws, e := WorkspaceForURI(uri)
+		return e == nil && ws.ReadOnly()
+	}
+	root, ok := LocalPathForURI(uri)
+	if !ok {
+		return false
+	}
+	return IsReadOnlyFolder(root)
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RecoveryDownload copies the server version to the local folder
+	RecoveryDownload = "download"
+	// RecoveryUpload copies the local version to the server
+	RecoveryUpload = "upload"
+	// RecoveryKeepBoth keeps the local version as a conflict copy, then downloads the server version
+	RecoveryKeepBoth = "keep-both"
+
+	// RiskLow operations do not replace or remove any content
+	RiskLow = "low"
+	// RiskMedium operations change local contents, previous versions are kept
+	RiskMedium = "medium"
+	// RiskHigh operations replace contents on the server
+	RiskHigh = "high"
+
+	// RecoveryOriginVerify is used for plans generated by the state verify command
+	RecoveryOriginVerify = "verify"
+	// RecoveryOriginSync is used for plans generated after a failed sync
+	RecoveryOriginSync = "sync"
+	// RecoveryOriginIntegrity is used for plans generated by the integrity spot checks
+	RecoveryOriginIntegrity = "integrity"
+
+	recoveryPlanFile = "recovery-plan.json"
+)
+
+// RecoveryOperation is one step of a recovery plan.
+type RecoveryOperation struct {
+	ID     int
+	Action string
+	Path   string
+	Risk   string
+	Reason string
+	Done   bool   `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// RecoveryPlan lists the operations needed to bring a task back in sync after its snapshots diverged from the
+// actual contents. Operations are only applied once approved by the user.
+type RecoveryPlan struct {
+	Origin     string
+	Created    time.Time
+	Operations []*RecoveryOperation
+}
+
+// NewRecoveryPlan creates an empty plan.
+func NewRecoveryPlan(origin string) *RecoveryPlan {
+	return &RecoveryPlan{Origin: origin, Created: time.Now()}
+}
+
+// Add appends an operation to the plan, unless a pending operation already exists for the same path.
+func (p *RecoveryPlan) Add(action, path, risk, reason string) bool {
+	next := 1
+	for _, o := range p.Operations {
+		if o.Path == path && !o.Done {
+			return false
+		}
+		if o.ID >= next {
+			next = o.ID + 1
+		}
+	}
+	p.Operations = append(p.Operations, &RecoveryOperation{ID: next, Action: action, Path: path, Risk: risk, Reason: reason})
+	return true
+}
+
+// Pending returns the operations not applied yet.
+func (p *RecoveryPlan) Pending() (ops []*RecoveryOperation) {
+	for _, o := range p.Operations {
+		if !o.Done {
+			ops = append(ops, o)
+		}
+	}
+	return
+}
+
+// Select returns the pending operations approved either by their ID, or by a maximum risk level.
+func (p *RecoveryPlan) Select(ids []int, maxRisk string) (ops []*RecoveryOperation) {
+	approved := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		approved[id] = true
+	}
+	for _, o := range p.Pending() {
+		if approved[o.ID] || (maxRisk != "" && RiskRank(o.Risk) <= RiskRank(maxRisk)) {
+			ops = append(ops, o)
+		}
+	}
+	return
+}
+
+// RiskRank orders the risk levels, unknown levels being ranked above RiskHigh.
+func RiskRank(risk string) int {
+	switch risk {
+	case RiskLow:
+		return 0
+	case RiskMedium:
+		return 1
+	case RiskHigh:
+		return 2
+	}
+	return 3
+}
+
+// LoadRecoveryPlan reads the plan of a task. It returns nil if there is none.
+func LoadRecoveryPlan(configPath string) (*RecoveryPlan, error) {
+	data, e := ioutil.ReadFile(filepath.Join(configPath, recoveryPlanFile))
+	if os.IsNotExist(e) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+	var plan RecoveryPlan
+	if e := json.Unmarshal(data, &plan); e != nil {
+		return nil, e
+	}
+	return &plan, nil
+}
+
+// SaveRecoveryPlan writes the plan of a task, or removes it when no operation is pending.
+func SaveRecoveryPlan(configPath string, plan *RecoveryPlan) error {
+	target := filepath.Join(configPath, recoveryPlanFile)
+	if plan == nil || len(plan.Pending()) == 0 {
+		if e := os.Remove(target); e != nil && !os.IsNotExist(e) {
+			return e
+		}
+		return nil
+	}
+	data, e := json.MarshalIndent(plan, "", "  ")
+	if e != nil {
+		return e
+	}
+	temp := target + ".tmp"
+	if e := ioutil.WriteFile(temp, data, 0644); e != nil {
+		return e
+	}
+	return os.Rename(temp, target)
+}
+
+// PlanFromVerify builds a plan from the report of VerifyRemote. Entries of the local snapshot tell whether
+// differences come from local changes that were never synced, or from the local folder diverging from what
+// the task knows about it.
+func PlanFromVerify(report *VerifyReport, localRoot string, snapshot []SnapshotEntry) *RecoveryPlan {
+	known := make(map[string]SnapshotEntry, len(snapshot))
+	for _, entry := range snapshot {
+		known["/"+strings.TrimLeft(entry.Path, "/")] = entry
+	}
+	plan := NewRecoveryPlan(RecoveryOriginVerify)
+	for _, p := range report.Missing {
+		if _, ok := known[p]; ok {
+			plan.Add(RecoveryDownload, p, RiskMedium, "Missing locally although the task considers it synced: restoring it cancels a local deletion")
+		} else {
+			plan.Add(RecoveryDownload, p, RiskLow, "Missing locally")
+		}
+	}
+	for _, p := range append(append([]string{}, report.SizeMismatch...), report.HashMismatch...) {
+		entry, ok := known[p]
+		info, e := os.Stat(filepath.Join(localRoot, filepath.FromSlash(strings.TrimLeft(p, "/"))))
+		if ok && e == nil && info.ModTime().Unix() != entry.MTime {
+			plan.Add(RecoveryUpload, p, RiskHigh, "Modified locally since the last sync: the server version is replaced")
+		} else {
+			plan.Add(RecoveryKeepBoth, p, RiskMedium, "Local content differs from the server: the local version is kept as a copy")
+		}
+	}
+	return plan
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// remoteCacheTTL is the lifetime of the cached metadata. It is short, as changes made on the server by other
+// clients are not seen until the entries expire.
+const remoteCacheTTL = 10 * time.Second
+
+type cachedNode struct {
+	node    *tree.Node
+	expires time.Time
+}
+
+type cachedListing struct {
+	paths   []string
+	nodes   []*tree.Node
+	expires time.Time
+}
+
+// remoteCache keeps the results of LoadNode and of non-recursive Walk calls on a remote endpoint for a few seconds,
+// so that lookups repeated during a sync pass (typically the parents of moved nodes) are not sent again to the
+// server. Entries are invalidated by the writes made through the endpoint, and cleared at the end of each pass.
+type remoteCache struct {
+	sync.Mutex
+	nodes    map[string]*cachedNode
+	listings map[string]*cachedListing
+}
+
+func newRemoteCache() *remoteCache {
+	return &remoteCache{
+		nodes:    make(map[string]*cachedNode),
+		listings: make(map[string]*cachedListing),
+	}
+}
+
+// SetRemoteCache enables the metadata cache on a remote endpoint. It returns false if the endpoint is not remote.
+func SetRemoteCache(ep model.Endpoint) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.cache = newRemoteCache()
+	return true
+}
+
+// ClearRemoteCache drops all the metadata cached for a remote endpoint.
+func ClearRemoteCache(ep model.Endpoint) {
+	if r, ok := ep.(*remoteFS); ok && r.cache != nil {
+		r.cache.clear()
+	}
+}
+
+func cacheKey(p string) string {
+	return strings.Trim(p, "/")
+}
+
+func (c *remoteCache) node(p string) (*tree.Node, bool) {
+	c.Lock()
+	defer c.Unlock()
+	n, ok := c.nodes[cacheKey(p)]
+	if !ok || time.Now().After(n.expires) {
+		return nil, false
+	}
+	return proto.Clone(n.node).(*tree.Node), true
+}
+
+func (c *remoteCache) setNode(p string, node *tree.Node) {
+	c.Lock()
+	defer c.Unlock()
+	c.nodes[cacheKey(p)] = &cachedNode{node: proto.Clone(node).(*tree.Node), expires: time.Now().Add(remoteCacheTTL)}
+}
+
+func (c *remoteCache) listing(p string) (*cachedListing, bool) {
+	c.Lock()
+	defer c.Unlock()
+	l, ok := c.listings[cacheKey(p)]
+	if !ok || time.Now().After(l.expires) {
+		return nil, false
+	}
+	return l, true
+}
+
+func (c *remoteCache) setListing(p string, l *cachedListing) {
+	l.expires = time.Now().Add(remoteCacheTTL)
+	c.Lock()
+	defer c.Unlock()
+	c.listings[cacheKey(p)] = l
+}
+
+// invalidate drops the entries of a path, of everything below it and the listing of its parent.
+func (c *remoteCache) invalidate(p string) {
+	key := cacheKey(p)
+	c.Lock()
+	defer c.Unlock()
+	for k := range c.nodes {
+		if k == key || strings.HasPrefix(k, key+"/") || key == "" {
+			delete(c.nodes, k)
+		}
+	}
+	for k := range c.listings {
+		if k == key || strings.HasPrefix(k, key+"/") || key == "" {
+			delete(c.listings, k)
+		}
+	}
+	parent := path.Dir(key)
+	if parent == "." {
+		parent = ""
+	}
+	delete(c.listings, parent)
+}
+
+func (c *remoteCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.nodes = make(map[string]*cachedNode)
+	c.listings = make(map[string]*cachedListing)
+}
+
+// loadRemote loads a node from the server, or from the cache. Extended stats are never cached. The metadata of
+// nodes loaded from the server is sent to the metadata sink. Empty files always get the etag of an empty content.
+func (r *remoteFS) loadRemote(ctx context.Context, p string, extendedStats ...bool) (*tree.Node, error) {
+	if r.cache == nil || (len(extendedStats) > 0 && extendedStats[0]) {
+		node, e := r.Remote.LoadNode(ctx, p, extendedStats...)
+		if e == nil {
+			r.normalizeNode(p, node)
+			r.reportMeta(p, node)
+		}
+		return node, e
+	}
+	if node, ok := r.cache.node(p); ok {
+		r.normalizeNode(p, node)
+		return node, nil
+	}
+	node, e := r.Remote.LoadNode(ctx, p)
+	if e == nil {
+		r.normalizeNode(p, node)
+		r.cache.setNode(p, node)
+		r.reportMeta(p, node)
+	}
+	return node, e
+}
+
+// walkRemote walks the server, serving non-recursive listings from the cache. The metadata of nodes listed on
+// the server is sent to the metadata sink.
+func (r *remoteFS) walkRemote(walknFc model.WalkNodesFunc, root string, recursive bool) error {
+	normalized := walknFc
+	walknFc = func(p string, node *tree.Node, err error) {
+		if err == nil {
+			r.normalizeNode(p, node)
+		}
+		normalized(p, node, err)
+	}
+	if r.metaSink != nil {
+		next := walknFc
+		walknFc = func(p string, node *tree.Node, err error) {
+			if err == nil {
+				r.reportMeta(p, node)
+			}
+			next(p, node, err)
+		}
+	}
+	if r.cache == nil || recursive {
+		return r.Remote.Walk(walknFc, root, recursive)
+	}
+	if l, ok := r.cache.listing(root); ok {
+		for i, p := range l.paths {
+			walknFc(p, proto.Clone(l.nodes[i]).(*tree.Node), nil)
+		}
+		return nil
+	}
+	l := &cachedListing{}
+	failed := false
+	e := r.Remote.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || node == nil {
+			failed = true
+		} else {
+			l.paths = append(l.paths, p)
+			l.nodes = append(l.nodes, proto.Clone(node).(*tree.Node))
+			r.cache.setNode(p, node)
+		}
+		walknFc(p, node, err)
+	}, root, false)
+	if e == nil && !failed {
+		r.cache.setListing(root, l)
+	}
+	return e
+}
+
+// invalidateCache drops the cached metadata of paths modified through the endpoint.
+func (r *remoteFS) invalidateCache(paths ...string) {
+	if r.cache == nil {
+		return
+	}
+	for _, p := range paths {
+		r.cache.invalidate(p)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+)
+
+// NodeLockedError is returned when uploading to a remote file locked by another user, e.g. while it is edited
+// collaboratively in the web interface. The upload is retried once the lock is lifted.
+type NodeLockedError struct {
+	Path     string
+	LockedBy string
+}
+
+func (n *NodeLockedError) Error() string {
+	return n.Path + " is locked by " + n.LockedBy + " on the server, it will be uploaded once unlocked"
+}
+
+// checkLock loads the remote node, bypassing the metadata cache, and returns a NodeLockedError if it is locked by
+// another user than the one of the endpoint. Missing nodes are not locked.
+func (r *remoteFS) checkLock(ctx context.Context, p string) error {
+	node, e := r.Remote.LoadNode(ctx, p)
+	if e != nil || node == nil {
+		return nil
+	}
+	r.reportMeta(p, node)
+	owner := RemoteMeta(node)[MetaRemoteLock]
+	if owner == "" {
+		return nil
+	}
+	if r.uri.User != nil && r.uri.User.Username() == owner {
+		return nil
+	}
+	return &NodeLockedError{Path: p, LockedBy: owner}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// Keys of the node metadata store holding a copy of the server-side metadata of remote nodes.
+const (
+	MetaRemoteTags     = "remote-tags"
+	MetaRemoteBookmark = "remote-bookmark"
+	MetaRemoteLock     = "remote-lock"
+)
+
+// RemoteMetaNamespaces maps the Cells metadata namespaces kept by the client to their node metadata store key.
+// They are managed on the server only, and never sent back with nodes created or updated by the sync.
+var RemoteMetaNamespaces = map[string]string{
+	"usermeta-tags": MetaRemoteTags,
+	"bookmark":      MetaRemoteBookmark,
+	"content_lock":  MetaRemoteLock,
+}
+
+// SetRemoteMetaSink registers a function receiving the server-side metadata of each node loaded or listed on a
+// remote endpoint. Missing namespaces are sent with an empty value. It returns false if the endpoint is not remote.
+func SetRemoteMetaSink(ep model.Endpoint, sink func(p string, meta map[string]string)) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.metaSink = sink
+	return true
+}
+
+// RemoteMeta extracts the values of the preserved namespaces from the metadata of a remote node. JSON strings are
+// decoded, other values are kept as JSON.
+func RemoteMeta(node *tree.Node) map[string]string {
+	meta := make(map[string]string, len(RemoteMetaNamespaces))
+	for ns, key := range RemoteMetaNamespaces {
+		meta[key] = ""
+		raw, ok := node.GetMetaStore()[ns]
+		if !ok || raw == "" || raw == "null" {
+			continue
+		}
+		var s string
+		if json.Unmarshal([]byte(raw), &s) == nil {
+			meta[key] = s
+		} else {
+			meta[key] = raw
+		}
+	}
+	return meta
+}
+
+// reportMeta sends the server-side metadata of a node to the sink.
+func (r *remoteFS) reportMeta(p string, node *tree.Node) {
+	if r.metaSink != nil && node != nil {
+		r.metaSink(p, RemoteMeta(node))
+	}
+}
+
+// withoutRemoteMeta returns a copy of the node without the server-managed namespaces, so that updates do not
+// overwrite them with stale values.
+func withoutRemoteMeta(node *tree.Node) *tree.Node {
+	var found bool
+	for ns := range RemoteMetaNamespaces {
+		if _, ok := node.GetMetaStore()[ns]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return node
+	}
+	clone := proto.Clone(node).(*tree.Node)
+	for ns := range RemoteMetaNamespaces {
+		delete(clone.MetaStore, ns)
+	}
+	return clone
+}
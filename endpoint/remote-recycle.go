@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+const (
+	// recycleBinFolder is the folder created by Cells at the root of a workspace to receive deleted nodes
+	recycleBinFolder = "recycle_bin"
+	// recycleBinRetention is the time during which deletions are remembered for a restore
+	recycleBinRetention = 30 * 24 * time.Hour
+	// recycleBinMaxEntries bounds the number of deletions remembered
+	recycleBinMaxEntries = 1000
+)
+
+var (
+	recycleBins     = make(map[string]*RecycleBin)
+	recycleBinsLock sync.Mutex
+)
+
+// RecycledNode is a deletion sent to the recycle bin of a server.
+type RecycledNode struct {
+	// URI of the remote endpoint
+	URI string
+	// Path relative to the endpoint root
+	Path string
+	// Server path of the node inside the recycle bin
+	Recycled string
+	Deleted  time.Time
+}
+
+// RecycleBin sends the deletions of remote endpoints to the server recycle bin rather than removing nodes
+// permanently, and remembers them so that accidental deletions can be restored. Servers that do not expose the
+// REST delete API fall back to permanent deletions. Deletions are stored in a JSON file, shared by all the
+// users of the same file.
+type RecycleBin struct {
+	file        string
+	lock        sync.Mutex
+	entries     []*RecycledNode
+	unsupported map[string]bool
+}
+
+// OpenRecycleBin loads the deletions recorded in file, or returns the bin already opened on it.
+func OpenRecycleBin(file string) (*RecycleBin, error) {
+	recycleBinsLock.Lock()
+	defer recycleBinsLock.Unlock()
+	if b, ok := recycleBins[file]; ok {
+		return b, nil
+	}
+	b := &RecycleBin{file: file, unsupported: make(map[string]bool)}
+	if data, e := ioutil.ReadFile(file); e == nil {
+		if e := json.Unmarshal(data, &b.entries); e != nil {
+			return nil, e
+		}
+	}
+	recycleBins[file] = b
+	return b, nil
+}
+
+// SetRecycleBin makes a remote endpoint send its deletions to the server recycle bin. It returns false if the
+// endpoint is not remote.
+func SetRecycleBin(ep model.Endpoint, bin *RecycleBin) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.recycle = bin
+	return true
+}
+
+// Entries lists the deletions that can still be restored, most recent first.
+func (b *RecycleBin) Entries() []*RecycledNode {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	out := make([]*RecycledNode, 0, len(b.entries))
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		out = append(out, b.entries[i])
+	}
+	return out
+}
+
+// Restore asks the server to move the most recent deletion of p (or of a node under p) back from its recycle
+// bin. The node comes back at its original location, and is synced again by the next pass.
+func (b *RecycleBin) Restore(p string) ([]*RecycledNode, error) {
+	p = "/" + strings.Trim(p, "/")
+	b.lock.Lock()
+	var restore []*RecycledNode
+	var keep []*RecycledNode
+	seen := make(map[string]bool)
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		entry := b.entries[i]
+		if (entry.Path == p || strings.HasPrefix(entry.Path, p+"/") || p == "/") && !seen[entry.Path] {
+			seen[entry.Path] = true
+			restore = append(restore, entry)
+		} else {
+			keep = append([]*RecycledNode{entry}, keep...)
+		}
+	}
+	b.lock.Unlock()
+	if len(restore) == 0 {
+		return nil, fmt.Errorf("no deletion of %s was sent to the server recycle bin", p)
+	}
+	for _, entry := range restore {
+		if e := recycleRequest(entry.URI, "/a/tree/restore", entry.Recycled); e != nil {
+			return nil, fmt.Errorf("cannot restore %s: %s", entry.Path, e.Error())
+		}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.entries = keep
+	return restore, b.save()
+}
+
+// delete moves a node to the recycle bin of the server. It returns false if the server does not support it, in
+// which case the node must be deleted permanently.
+func (b *RecycleBin) delete(ctx context.Context, uri *url.URL, p string) (bool, error) {
+	b.lock.Lock()
+	unsupported := b.unsupported[uri.Host]
+	b.lock.Unlock()
+	if unsupported {
+		return false, nil
+	}
+	root := strings.Trim(uri.Path, "/")
+	if e := recycleRequest(uri.String(), "/a/tree/delete", path.Join(root, p)); e != nil {
+		if e == errRecycleNotFound {
+			// Let the permanent deletion report the missing node
+			return false, nil
+		}
+		if e == errRecycleUnsupported {
+			log.Logger(ctx).Info("Server does not support recycle bin deletions, files will be deleted permanently")
+			b.lock.Lock()
+			b.unsupported[uri.Host] = true
+			b.lock.Unlock()
+			return false, nil
+		}
+		return true, e
+	}
+	// Nodes are moved to the recycle bin at the root of their workspace
+	workspace := strings.SplitN(root, "/", 2)[0]
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.entries = append(b.entries, &RecycledNode{
+		URI:      uri.String(),
+		Path:     "/" + strings.Trim(p, "/"),
+		Recycled: path.Join(workspace, recycleBinFolder, path.Base(p)),
+		Deleted:  time.Now(),
+	})
+	b.prune(time.Now().Add(-recycleBinRetention))
+	if e := b.save(); e != nil {
+		log.Logger(ctx).Error("Cannot save recycle bin deletions: " + e.Error())
+	}
+	return true, nil
+}
+
+func (b *RecycleBin) prune(before time.Time) {
+	var keep []*RecycledNode
+	for _, entry := range b.entries {
+		if entry.Deleted.After(before) {
+			keep = append(keep, entry)
+		}
+	}
+	if len(keep) > recycleBinMaxEntries {
+		keep = keep[len(keep)-recycleBinMaxEntries:]
+	}
+	b.entries = keep
+}
+
+func (b *RecycleBin) save() error {
+	data, e := json.Marshal(b.entries)
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(b.file, data, 0644)
+}
+
+var (
+	errRecycleUnsupported = fmt.Errorf("recycle bin is not supported by the server")
+	errRecycleNotFound    = fmt.Errorf("node not found on the server")
+)
+
+// recycleRequest posts one node to a tree REST API of the server hosting uri.
+func recycleRequest(uri, api, nodePath string) error {
+	authority := config.Default().AuthorityForURI(uri)
+	if authority == nil {
+		return fmt.Errorf("cannot find authority")
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"Nodes": []map[string]string{{"Path": nodePath}},
+	})
+	req, e := authority.NewAuthenticatedRequest("POST", api, bytes.NewReader(body))
+	if e != nil {
+		return e
+	}
+	resp, e := authority.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errRecycleNotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return errRecycleUnsupported
+	default:
+		return fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pydio/cells/common"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// VerifyReport describes the comparison of a local folder with the checksums returned by the server.
+type VerifyReport struct {
+	Files        int
+	Verified     int
+	Missing      []string
+	SizeMismatch []string
+	HashMismatch []string
+	// Files whose checksum is not provided by the server
+	Unverified []string
+}
+
+// Valid returns true if the local folder matches the remote checksums.
+func (r *VerifyReport) Valid() bool {
+	return len(r.Missing) == 0 && len(r.SizeMismatch) == 0 && len(r.HashMismatch) == 0
+}
+
+// String implements Stringer interface.
+func (r *VerifyReport) String() string {
+	s := fmt.Sprintf("%d remote files, %d verified, %d missing locally, %d with different size, %d with different checksum, %d without remote checksum",
+		r.Files, r.Verified, len(r.Missing), len(r.SizeMismatch), len(r.HashMismatch), len(r.Unverified))
+	for _, l := range [][]string{r.Missing, r.SizeMismatch, r.HashMismatch} {
+		for i, p := range l {
+			if i >= 10 {
+				s += fmt.Sprintf("\n   ... and %d more", len(l)-10)
+				break
+			}
+			s += "\n - " + p
+		}
+	}
+	return s
+}
+
+// VerifyRemote compares the files of a local folder with the checksums computed by the server, so that the
+// remote content is never downloaded. Nodes listed without a checksum, or with a temporary one, are loaded again
+// with extended stats to ask the server to compute it. Local hashes are read from the hash cache when the files
+// did not change since they were hashed. Only paths accepted by keep are verified.
+func VerifyRemote(ctx context.Context, remote model.PathSyncSource, localRoot string, hashes *HashCache, keep func(string) bool) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	var files []*tree.Node
+	e := remote.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || !node.IsLeaf() || !keep(p) {
+			return
+		}
+		n := node.Clone()
+		n.Path = "/" + strings.TrimLeft(p, "/")
+		files = append(files, n)
+	}, "/", true)
+	if e != nil {
+		return nil, e
+	}
+	for _, n := range files {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Files++
+		etag := strings.Trim(n.GetEtag(), "\"")
+		if etag == "" || etag == common.NodeFlagEtagTemporary {
+			if full, er := remote.LoadNode(ctx, n.Path, true); er == nil {
+				etag = strings.Trim(full.GetEtag(), "\"")
+			}
+		}
+		local := filepath.Join(localRoot, filepath.FromSlash(strings.TrimLeft(n.Path, "/")))
+		info, er := os.Stat(local)
+		if er != nil {
+			report.Missing = append(report.Missing, n.Path)
+			continue
+		}
+		if info.Size() != n.GetSize() {
+			report.SizeMismatch = append(report.SizeMismatch, n.Path)
+			continue
+		}
+		if etag == "" || etag == common.NodeFlagEtagTemporary {
+			report.Unverified = append(report.Unverified, n.Path)
+			continue
+		}
+		if match, ok := verifyLocalEtag(local, n.Path, info.Size(), etag, hashes); !ok {
+			report.Unverified = append(report.Unverified, n.Path)
+		} else if !match {
+			report.HashMismatch = append(report.HashMismatch, n.Path)
+		} else {
+			report.Verified++
+		}
+	}
+	return report, nil
+}
+
+// verifyLocalEtag compares a local file with a remote etag. Plain MD5 etags are first looked up in the hash
+// cache. It returns false as second value if the file cannot be read or if the etag format is unknown.
+func verifyLocalEtag(local, p string, size int64, etag string, hashes *HashCache) (match bool, ok bool) {
+	if hashes != nil && !strings.Contains(etag, "-") {
+		if _, cached := hashes.lookup(p); cached != "" {
+			return cached == etag, true
+		}
+	}
+	f, e := os.Open(local)
+	if e != nil {
+		return false, false
+	}
+	defer f.Close()
+	computed, expected, e := computeEtag(f, size, etag)
+	if e != nil || expected == "" {
+		return false, false
+	}
+	return computed == expected, true
+}
@@ -0,0 +1,376 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/minio-go"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/endpoints/cells"
+)
+
+const (
+	chunkedDownloadThreshold = 64 * 1024 * 1024
+	downloadChunkSize        = 16 * 1024 * 1024
+	downloadChunkRetries     = 3
+	gatewaySecret            = "gatewaysecret"
+)
+
+// remoteFS wraps the Cells remote client. It can skip uploads of hidden files or of files blocked by upload
+// rules, sets the content type of uploaded files, downloads large files with parallel ranged requests, and
+// can act as an append-only target.
+type remoteFS struct {
+	*cells.Remote
+	uri *url.URL
+
+	skipHiddenUploads bool
+	uploadGuard       *UploadGuard
+	onBlocked         func(p, reason string)
+	progress          *ProgressTracker
+	appendOnly        *AppendOnlyIndex
+	stash             *Stash
+	safe              *SafeMode
+	cache             *remoteCache
+	contents          *ContentCache
+	metaSink          func(p string, meta map[string]string)
+	sessions          *UploadSessions
+	opKeys            *OperationKeys
+	recycle           *RecycleBin
+	transforms        *Transforms
+	caps              *common.Capabilities
+}
+
+// CreateNode skips hidden folders if required. Server-managed metadata (tags, bookmarks, locks) is never sent.
+// With operation keys, a folder that was already created is not created again.
+func (r *remoteFS) CreateNode(ctx context.Context, node *tree.Node, updateIfExists bool) error {
+	if r.skipHiddenUploads && IsHiddenPath(node.GetPath()) {
+		return nil
+	}
+	defer r.invalidateCache(node.GetPath())
+	send := func() error {
+		return r.Remote.CreateNode(ctx, withoutRemoteMeta(node), updateIfExists)
+	}
+	if r.opKeys == nil || node.IsLeaf() {
+		return send()
+	}
+	p := node.GetPath()
+	return r.opKeys.apply(ctx, OperationKey("mkdir", p, node.GetUuid()), "creation", p, func() bool {
+		n, e := r.Remote.LoadNode(ctx, p)
+		return e == nil && !n.IsLeaf()
+	}, send)
+}
+
+// GetWriterOn discards contents of hidden files and of files blocked by upload rules if required. On append-only
+// targets, existing files are not overwritten: the contents are written to a new version instead. With a stash,
+// the previous version is moved into it. Files locked on the server by another user are not overwritten.
+func (r *remoteFS) GetWriterOn(ctx context.Context, p string, targetSize int64) (io.WriteCloser, chan bool, chan error, error) {
+	skip := r.skipHiddenUploads && IsHiddenPath(p)
+	if !skip && r.uploadGuard != nil {
+		if reason := r.uploadGuard.Check(p, targetSize); reason != "" {
+			skip = true
+			if r.onBlocked != nil {
+				r.onBlocked(p, reason)
+			}
+		}
+	}
+	if !skip {
+		if e := r.checkLock(ctx, p); e != nil {
+			return nil, nil, nil, e
+		}
+		defer r.invalidateCache(p)
+		target := p
+		if r.appendOnly != nil {
+			var e error
+			if target, e = r.versionTarget(ctx, p); e != nil {
+				return nil, nil, nil, e
+			}
+			defer r.invalidateCache(target)
+		}
+		if r.stash != nil {
+			if e := r.stash.keep(ctx, p, StashVersions); e != nil {
+				return nil, nil, nil, e
+			}
+		}
+		var out io.WriteCloser
+		var writeDone chan bool
+		var writeErr chan error
+		var e error
+		if steps := r.transformSteps(p); len(steps) > 0 {
+			out, writeDone, writeErr, e = r.transforms.writer(ctx, r.uri.String(), p, steps, func(size int64) (io.WriteCloser, chan bool, chan error, error) {
+				return r.openWriter(ctx, target, size)
+			}, func() (*tree.Node, error) {
+				return r.Remote.LoadNode(ctx, target)
+			})
+		} else {
+			out, writeDone, writeErr, e = r.openWriter(ctx, target, targetSize)
+		}
+		if e != nil {
+			return out, writeDone, writeErr, e
+		}
+		out, writeDone = trackWriter(r.progress, p, targetSize, out, writeDone, true)
+		out, writeDone = r.detectMimeType(target, out, writeDone)
+		if r.appendOnly != nil {
+			out, writeDone = r.recordVersion(p, target, out, writeDone)
+		}
+		return out, writeDone, writeErr, nil
+	}
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	return &discardWriter{done: done}, done, errs, nil
+}
+
+// GetReaderOn downloads large files in parallel chunks to a temporary file, and returns a reader on it.
+// Smaller files, or files that cannot be downloaded this way, use the default reader. With a content cache,
+// files are read from the cache if their etag did not change, and added to it otherwise.
+func (r *remoteFS) GetReaderOn(p string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	if r.appendOnly != nil {
+		if latest := r.appendOnly.Latest(p); latest != "" {
+			p = latest
+		}
+	}
+	node, e := r.Remote.LoadNode(ctx, p)
+	if e != nil || r.contents == nil {
+		return r.openReader(ctx, p, node, e)
+	}
+	if cached, ok := r.contents.open(node.GetEtag(), node.GetSize()); ok {
+		return cached, nil
+	}
+	reader, e := r.openReader(ctx, p, node, nil)
+	if e != nil {
+		return nil, e
+	}
+	return r.contents.readThrough(node.GetEtag(), node.GetSize(), reader), nil
+}
+
+func (r *remoteFS) gatewayClient() (*minio.Core, error) {
+	var token string
+	base := r.uri
+	for _, a := range config.Default().Authorities {
+		if a.MatchesURI(r.uri.String()) {
+			token = a.AccessToken
+			if u, e := url.Parse(a.BaseURL()); e == nil {
+				base = u
+			}
+			break
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("cannot find authority")
+	}
+	return minio.NewCore(base.Host, token, gatewaySecret, base.Scheme == "https")
+}
+
+// chunkedDownload fetches byte ranges of a file in parallel and writes them at their offset in a temporary file.
+func (r *remoteFS) chunkedDownload(node *tree.Node, p string) (io.ReadCloser, error) {
+	client, e := r.gatewayClient()
+	if e != nil {
+		return nil, e
+	}
+	key := strings.Trim(r.uri.Path, "/") + "/" + strings.TrimLeft(p, "/")
+	tmp, e := ioutil.TempFile("", "cells-sync-download-")
+	if e != nil {
+		return nil, e
+	}
+	clean := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size := node.GetSize()
+	r.progress.Phase(p, FilePhaseTransferring, size)
+	offsets := make(chan int64)
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var failure error
+	wg := &sync.WaitGroup{}
+	// Workers take a slot of the adaptive window before each chunk, so that the actual parallelism follows the
+	// observed latency and errors
+	window := concurrencyFor("download:" + r.uri.Host)
+	for i := 0; i < int(concurrencyMax); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for offset := range offsets {
+				end := offset + downloadChunkSize - 1
+				if end >= size {
+					end = size - 1
+				}
+				var er error
+				for retry := 0; retry < downloadChunkRetries; retry++ {
+					window.acquire(context.Background())
+					start := time.Now()
+					er = downloadChunk(client, key, tmp, offset, end)
+					window.release(start, er != nil)
+					if er == nil {
+						r.progress.Add(p, end-offset+1)
+						r.progress.Transfer(0, end-offset+1)
+						break
+					}
+				}
+				if er != nil {
+					failOnce.Do(func() {
+						failure = er
+						close(failed)
+					})
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(offsets)
+		for offset := int64(0); offset < size; offset += downloadChunkSize {
+			select {
+			case offsets <- offset:
+			case <-failed:
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	if failure != nil {
+		clean()
+		return nil, failure
+	}
+	r.progress.Phase(p, FilePhaseVerifying, 0)
+	if er := verifyEtag(tmp, size, node.GetEtag()); er != nil {
+		clean()
+		return nil, er
+	}
+	if _, er := tmp.Seek(0, io.SeekStart); er != nil {
+		clean()
+		return nil, er
+	}
+	return &tempFileReader{File: tmp}, nil
+}
+
+// downloadChunk fetches one range and writes it at its offset, checking that the expected length was received.
+func downloadChunk(client *minio.Core, key string, f *os.File, start, end int64) error {
+	opts := minio.GetObjectOptions{}
+	if e := opts.SetRange(start, end); e != nil {
+		return e
+	}
+	body, _, e := client.GetObject("io", key, opts)
+	if e != nil {
+		return e
+	}
+	defer body.Close()
+	n, e := io.Copy(&offsetWriter{f: f, offset: start}, body)
+	if e != nil {
+		return e
+	}
+	if n != end-start+1 {
+		return fmt.Errorf("received %d bytes instead of %d for range %d-%d", n, end-start+1, start, end)
+	}
+	return nil
+}
+
+// offsetWriter writes sequentially to a file starting at a given offset.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, e := o.f.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, e
+}
+
+// verifyEtag checks the assembled file against the node etag, either a plain MD5 or a multipart etag
+// ("md5-N", MD5 of the concatenated MD5 of each part). Unknown formats are not checked.
+func verifyEtag(f *os.File, size int64, etag string) error {
+	computed, expected, e := computeEtag(f, size, etag)
+	if e != nil || expected == "" {
+		return e
+	}
+	if computed != expected {
+		return fmt.Errorf("checksum mismatch after download (expected %s, got %s)", expected, computed)
+	}
+	return nil
+}
+
+// computeEtag hashes a file the same way as the etag it is compared to. It returns an empty expected value if
+// the etag format is unknown.
+func computeEtag(f *os.File, size int64, etag string) (computed string, expected string, e error) {
+	etag = strings.Trim(etag, "\"")
+	if etag == "" {
+		return
+	}
+	parts := 1
+	if i := strings.LastIndex(etag, "-"); i > 0 {
+		n, er := strconv.Atoi(etag[i+1:])
+		if er != nil || n <= 0 {
+			return
+		}
+		parts = n
+	}
+	// Guess part size, as uploaders use a fixed size rounded to MB
+	partSize := (size + int64(parts) - 1) / int64(parts)
+	if parts > 1 {
+		partSize = (partSize + 1024*1024 - 1) / (1024 * 1024) * 1024 * 1024
+	} else {
+		partSize = size
+	}
+	var sums []byte
+	for offset := int64(0); offset < size; offset += partSize {
+		h := md5.New()
+		if _, er := io.Copy(h, io.NewSectionReader(f, offset, partSize)); er != nil {
+			return "", "", er
+		}
+		sums = append(sums, h.Sum(nil)...)
+	}
+	if size == 0 {
+		sums = md5.New().Sum(nil)
+	}
+	if parts == 1 {
+		computed = hex.EncodeToString(sums)
+	} else {
+		total := md5.Sum(sums)
+		computed = hex.EncodeToString(total[:]) + "-" + strconv.Itoa(parts)
+	}
+	return computed, etag, nil
+}
+
+// tempFileReader removes the temporary file when closed.
+type tempFileReader struct {
+	*os.File
+}
+
+func (t *tempFileReader) Close() error {
+	e := t.File.Close()
+	os.Remove(t.File.Name())
+	return e
+}
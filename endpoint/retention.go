@@ -0,0 +1,213 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// StashFolder is the folder of a mirror target where deleted and overwritten files are kept
+	StashFolder = ".cells-sync-stash"
+	// StashDeleted holds the files deleted from the target
+	StashDeleted = "deleted"
+	// StashVersions holds the previous versions of overwritten files
+	StashVersions = "versions"
+
+	stashStampFormat = "20060102-150405.000"
+)
+
+// stashClient is the raw client of an endpoint, used to move files into the stash without going through the
+// wrappers.
+type stashClient interface {
+	model.PathSyncTarget
+	Walk(walknFc model.WalkNodesFunc, root string, recursive bool) error
+}
+
+// Stash keeps the files deleted or overwritten on the target of a one-way task in StashFolder, under
+// <kind>/<date>/<original path>, until they are pruned by the retention rules.
+type Stash struct {
+	sync.Mutex
+	client stashClient
+}
+
+// RetentionReport describes the result of a stash pruning.
+type RetentionReport struct {
+	Removed        int
+	ReclaimedBytes int64
+	RemainingBytes int64
+}
+
+// stashEntry is a <kind>/<date> folder of the stash.
+type stashEntry struct {
+	kind  string
+	stamp time.Time
+	size  int64
+}
+
+func (e *stashEntry) path() string {
+	return path.Join(StashFolder, e.kind, e.stamp.Format(stashStampFormat))
+}
+
+// SetStash makes a local or remote endpoint keep deleted and overwritten files in its stash folder. It returns
+// nil if the endpoint does not support it.
+func SetStash(ep model.Endpoint) *Stash {
+	switch v := ep.(type) {
+	case *localFS:
+		v.stash = &Stash{client: v.FSClient}
+		return v.stash
+	case *remoteFS:
+		v.stash = &Stash{client: v.Remote}
+		return v.stash
+	}
+	return nil
+}
+
+// keep moves an existing file or folder into the stash. Missing paths are ignored.
+func (s *Stash) keep(ctx context.Context, p string, kind string) error {
+	return s.keepFrom(ctx, p, p, kind)
+}
+
+// keepFrom moves src into the stash under the original path p. Missing sources are ignored.
+func (s *Stash) keepFrom(ctx context.Context, src string, p string, kind string) error {
+	src, p = strings.Trim(src, "/"), strings.Trim(p, "/")
+	if _, e := s.client.LoadNode(ctx, src); e != nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	target := path.Join(StashFolder, kind, time.Now().Format(stashStampFormat), p)
+	if e := s.ensureFolder(ctx, path.Dir(target)); e != nil {
+		return e
+	}
+	return s.client.MoveNode(ctx, src, target)
+}
+
+func (s *Stash) ensureFolder(ctx context.Context, dir string) error {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	if _, e := s.client.LoadNode(ctx, dir); e == nil {
+		return nil
+	}
+	if e := s.ensureFolder(ctx, path.Dir(dir)); e != nil {
+		return e
+	}
+	return s.client.CreateNode(ctx, &tree.Node{Path: dir, Type: tree.NodeType_COLLECTION}, false)
+}
+
+// entries lists the stash folders with their total size, oldest first.
+func (s *Stash) entries() ([]*stashEntry, error) {
+	byPath := make(map[string]*stashEntry)
+	e := s.client.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || !node.IsLeaf() {
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(strings.Trim(p, "/"), StashFolder+"/"), "/", 3)
+		if len(parts) < 3 {
+			return
+		}
+		stamp, er := time.ParseInLocation(stashStampFormat, parts[1], time.Local)
+		if er != nil {
+			return
+		}
+		key := parts[0] + "/" + parts[1]
+		if _, ok := byPath[key]; !ok {
+			byPath[key] = &stashEntry{kind: parts[0], stamp: stamp}
+		}
+		byPath[key].size += node.GetSize()
+	}, StashFolder, true)
+	if e != nil {
+		return nil, e
+	}
+	var entries []*stashEntry
+	for _, entry := range byPath {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].stamp.Before(entries[j].stamp)
+	})
+	return entries, nil
+}
+
+// Enforce removes the stash entries that are expired, then the oldest ones until the stash fits in the maximum
+// size.
+func (s *Stash) Enforce(ctx context.Context, rules *config.Retention) (*RetentionReport, error) {
+	if _, e := s.client.LoadNode(ctx, StashFolder); e != nil {
+		return &RetentionReport{}, nil
+	}
+	entries, e := s.entries()
+	if e != nil {
+		return nil, e
+	}
+	s.Lock()
+	defer s.Unlock()
+	report := &RetentionReport{}
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	remove := func(entry *stashEntry) error {
+		if e := s.client.DeleteNode(ctx, entry.path()); e != nil {
+			return e
+		}
+		report.Removed++
+		report.ReclaimedBytes += entry.size
+		total -= entry.size
+		return nil
+	}
+	now := time.Now()
+	var kept []*stashEntry
+	for _, entry := range entries {
+		days := rules.KeepVersionsDays
+		if entry.kind == StashDeleted {
+			days = rules.KeepDeletedDays
+		}
+		if days > 0 && now.Sub(entry.stamp) > time.Duration(days)*24*time.Hour {
+			if e := remove(entry); e != nil {
+				return report, e
+			}
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if rules.MaxSizeGB > 0 {
+		max := int64(rules.MaxSizeGB * 1024 * 1024 * 1024)
+		for _, entry := range kept {
+			if total <= max {
+				break
+			}
+			if e := remove(entry); e != nil {
+				return report, e
+			}
+		}
+	}
+	report.RemainingBytes = total
+	return report, nil
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package s3 provides an endpoint syncing a bucket (or a prefix inside a bucket) of an S3-compatible storage,
+// like MinIO or a NAS. Files are compared with their ETag.
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	s3client "github.com/pydio/cells/common/sync/endpoints/s3"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// DefaultPollInterval is the delay between two listings of the bucket when watching by polling.
+const DefaultPollInterval = 30 * time.Second
+
+// Client wraps the S3 client of the sync library, that implements the PathSyncSource, PathSyncTarget,
+// DataSyncSource and DataSyncTarget interfaces. It adds a watcher based on polling, as bucket notifications are
+// only available on MinIO servers.
+type Client struct {
+	*s3client.Client
+	// uri is the URL of the bucket without its API keys, as exposed in logs and states
+	uri           string
+	pollInterval  time.Duration
+	notifications bool
+}
+
+// NewClient parses a URL like s3://key:secret@host/bucket/prefix and opens the bucket. Supported query parameters:
+//   - secure=true: use https (always the case for amazonaws.com hosts)
+//   - normalize=true: the server requires unicode normalization of keys
+//   - notifications=true: watch the bucket using MinIO bucket notifications instead of polling
+//   - poll=30s: interval between two listings of the bucket when polling
+func NewClient(ctx context.Context, uri string, opts model.EndpointOptions) (*Client, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return nil, e
+	}
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, errors.New("please provide a bucket name in URL")
+	}
+	bucket, prefix := parts[0], ""
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+	if u.User == nil {
+		return nil, errors.New("please provide API keys and secret in URL")
+	}
+	secret, _ := u.User.Password()
+	values := u.Query()
+	secure := strings.Contains(u.Hostname(), "amazonaws.com") || values.Get("secure") == "true"
+	c := &Client{
+		uri:           publicURI(u),
+		pollInterval:  DefaultPollInterval,
+		notifications: values.Get("notifications") == "true",
+	}
+	if p := values.Get("poll"); p != "" {
+		d, e := time.ParseDuration(p)
+		if e != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid poll interval %s", p)
+		}
+		c.pollInterval = d
+	}
+	client, e := s3client.NewClient(ctx, u.Host, u.User.Username(), secret, bucket, prefix, secure, opts)
+	if e != nil {
+		return nil, e
+	}
+	if values.Get("normalize") == "true" {
+		client.ServerRequiresNormalization = true
+	}
+	c.Client = client
+	return c, nil
+}
+
+// Watch uses bucket notifications if enabled, or lists the bucket at regular intervals and sends an event for
+// each object created, modified or removed since the previous listing.
+func (c *Client) Watch(recursivePath string) (*model.WatchObject, error) {
+	if c.notifications {
+		return c.Client.Watch(recursivePath)
+	}
+	w := &model.WatchObject{
+		EventInfoChan: make(chan model.EventInfo),
+		ErrorChan:     make(chan error),
+		DoneChan:      make(chan bool),
+	}
+	go c.poll(w, recursivePath)
+	return w, nil
+}
+
+// listedObject is the state of an object at the time of a listing.
+type listedObject struct {
+	etag   string
+	size   int64
+	folder bool
+}
+
+// list walks the bucket from root.
+func (c *Client) list(root string) (map[string]listedObject, error) {
+	objects := make(map[string]listedObject)
+	var mux sync.Mutex
+	e := c.Client.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || node == nil {
+			return
+		}
+		mux.Lock()
+		objects[p] = listedObject{etag: node.GetEtag(), size: node.GetSize(), folder: !node.IsLeaf()}
+		mux.Unlock()
+	}, root, true)
+	return objects, e
+}
+
+// poll compares the listings of the bucket until the watch is closed.
+func (c *Client) poll(w *model.WatchObject, root string) {
+	previous, e := c.list(root)
+	if e != nil {
+		log.Logger(context.Background()).Error("Cannot list bucket for watching: " + e.Error())
+	}
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	send := func(p string, o listedObject, t model.EventType) bool {
+		ev := model.EventInfo{
+			Time:   time.Now().Format(time.RFC3339),
+			Path:   p,
+			Etag:   o.etag,
+			Size:   o.size,
+			Folder: o.folder,
+			Type:   t,
+			Source: c,
+		}
+		select {
+		case w.EventInfoChan <- ev:
+			return true
+		case <-w.Done():
+			return false
+		}
+	}
+	for {
+		select {
+		case <-ticker.C:
+			current, e := c.list(root)
+			if e != nil {
+				select {
+				case w.ErrorChan <- e:
+				case <-w.Done():
+					return
+				}
+				continue
+			}
+			if previous != nil {
+				changed, removed := compareListings(previous, current)
+				for _, p := range changed {
+					if !send(p, current[p], model.EventCreate) {
+						return
+					}
+				}
+				for _, p := range removed {
+					if !send(p, previous[p], model.EventRemove) {
+						return
+					}
+				}
+			}
+			previous = current
+		case <-w.Done():
+			return
+		}
+	}
+}
+
+// compareListings returns the objects created or modified since the previous listing, and the removed ones.
+func compareListings(previous, current map[string]listedObject) (changed, removed []string) {
+	for p, o := range current {
+		if prev, ok := previous[p]; !ok || prev.etag != o.etag || prev.size != o.size {
+			changed = append(changed, p)
+		}
+	}
+	for p := range previous {
+		if _, ok := current[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	return
+}
+
+// GetEndpointInfo keeps the original URI without its API keys, and requires a folders rescan when polling as folders have no
+// events of their own on S3.
+func (c *Client) GetEndpointInfo() model.EndpointInfo {
+	info := c.Client.GetEndpointInfo()
+	info.URI = c.uri
+	if !c.notifications {
+		info.RequiresFoldersRescan = true
+	}
+	return info
+}
+
+// publicURI removes the API keys and the options of a bucket URL, so that it can be displayed. The result matches
+// the URI of the task as compared by the state store.
+func publicURI(u *url.URL) string {
+	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Path)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package s3
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// TestNewClientErrors checks the URLs rejected before connecting to the bucket.
+func TestNewClientErrors(t *testing.T) {
+	cases := []struct {
+		uri   string
+		error string
+	}{
+		{"s3://key:secret@minio.local", "bucket name"},
+		{"s3://key:secret@minio.local/", "bucket name"},
+		{"s3://minio.local/bucket", "API keys"},
+		{"s3://key:secret@minio.local/bucket?poll=fast", "invalid poll interval"},
+		{"s3://key:secret@minio.local/bucket?poll=100ms", "invalid poll interval"},
+	}
+	for _, c := range cases {
+		_, e := NewClient(context.Background(), c.uri, model.EndpointOptions{})
+		if e == nil || !strings.Contains(e.Error(), c.error) {
+			t.Errorf("%s: expected error containing %q, got %v", c.uri, c.error, e)
+		}
+	}
+}
+
+// TestPublicURI checks that API keys and options are never exposed.
+func TestPublicURI(t *testing.T) {
+	cases := []struct {
+		uri      string
+		expected string
+	}{
+		{"s3://key:secret@minio.local:9000/bucket", "s3://minio.local:9000/bucket"},
+		{"s3://key:secret@s3.amazonaws.com/bucket/prefix/sub?secure=true&poll=1m", "s3://s3.amazonaws.com/bucket/prefix/sub"},
+		{"s3://minio.local/bucket", "s3://minio.local/bucket"},
+	}
+	for _, c := range cases {
+		u, e := url.Parse(c.uri)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if out := publicURI(u); out != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.uri, c.expected, out)
+		}
+	}
+}
+
+// TestCompareListings checks the events sent when polling the bucket.
+func TestCompareListings(t *testing.T) {
+	previous := map[string]listedObject{
+		"folder":          {folder: true},
+		"folder/same.txt": {etag: "a", size: 1},
+		"folder/etag.txt": {etag: "a", size: 1},
+		"folder/size.txt": {etag: "a", size: 1},
+		"removed.txt":     {etag: "a", size: 1},
+	}
+	current := map[string]listedObject{
+		"folder":          {folder: true},
+		"folder/same.txt": {etag: "a", size: 1},
+		"folder/etag.txt": {etag: "b", size: 1},
+		"folder/size.txt": {etag: "a", size: 2},
+		"created.txt":     {etag: "c", size: 3},
+	}
+	cases := []struct {
+		name             string
+		previous         map[string]listedObject
+		current          map[string]listedObject
+		changed, removed []string
+	}{
+		{"no change", previous, previous, nil, nil},
+		{"changes", previous, current, []string{"created.txt", "folder/etag.txt", "folder/size.txt"}, []string{"removed.txt"}},
+		{"emptied", previous, map[string]listedObject{}, nil, []string{"folder", "folder/etag.txt", "folder/same.txt", "folder/size.txt", "removed.txt"}},
+	}
+	for _, c := range cases {
+		changed, removed := compareListings(c.previous, c.current)
+		sort.Strings(changed)
+		sort.Strings(removed)
+		if !reflect.DeepEqual(changed, c.changed) || !reflect.DeepEqual(removed, c.removed) {
+			t.Errorf("%s: expected %v / %v, got %v / %v", c.name, c.changed, c.removed, changed, removed)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// DefaultSettleDelay is the time a database file must stay unmodified before it is read.
+const DefaultSettleDelay = 3 * time.Second
+
+// SafeReplacePatterns are the files handled as databases: applications rewrite them often while keeping them
+// open, and a half-written copy is unusable.
+var SafeReplacePatterns = []string{"*.kdbx", "*.kdb", "*.sqlite", "*.sqlite3", "*.db"}
+
+var (
+	kdbxMagic   = []byte{0x03, 0xd9, 0xa2, 0x9a, 0x67, 0xfb, 0x4b, 0xb5}
+	kdbMagic    = []byte{0x03, 0xd9, 0xa2, 0x9a, 0x65, 0xfb, 0x4b, 0xb5}
+	sqliteMagic = []byte("SQLite format 3\x00")
+)
+
+// FileBusyError is returned when a database file is not ready to be read or replaced: it is still being written,
+// or opened by an application. The operation is retried later.
+type FileBusyError struct {
+	Path   string
+	Reason string
+}
+
+func (f *FileBusyError) Error() string {
+	return f.Path + " is not ready (" + f.Reason + "), it will be retried once released"
+}
+
+// safeReplace holds the patterns of the files that must settle before being read, and whose contents are verified
+// before being moved in place.
+type safeReplace struct {
+	patterns []string
+	settle   time.Duration
+}
+
+// SetSafeReplace enables write-settle detection and safe replace for the local files matching the patterns (on the
+// base name). It returns false if the endpoint is not a local folder.
+func SetSafeReplace(ep model.Endpoint, patterns []string) bool {
+	if c, ok := ep.(*localFS); ok {
+		c.databases = &safeReplace{patterns: patterns, settle: DefaultSettleDelay}
+		return true
+	}
+	return false
+}
+
+// matches checks if a path is handled as a database.
+func (s *safeReplace) matches(p string) bool {
+	if s == nil {
+		return false
+	}
+	name := path.Base(p)
+	for _, pattern := range s.patterns {
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readable checks that a local file has settled and is not locked by an application, and that its header is
+// complete.
+func (s *safeReplace) readable(abs string, p string) error {
+	info, e := os.Stat(abs)
+	if e != nil {
+		return nil
+	}
+	if time.Since(info.ModTime()) < s.settle {
+		return &FileBusyError{Path: p, Reason: "being written"}
+	}
+	if reason := lockedBy(abs); reason != "" {
+		return &FileBusyError{Path: p, Reason: reason}
+	}
+	if !validHeader(abs, info.Size()) {
+		return &FileBusyError{Path: p, Reason: "incomplete file"}
+	}
+	return nil
+}
+
+// commitWrite verifies the header of a database file downloaded to a temporary file, and that the local copy is
+// not opened by an application, before moving it in place.
+func (c *localFS) commitWrite(entry *journalRecord, hash string, p string) error {
+	if c.databases.matches(p) {
+		temp := c.abs(entry.Temp)
+		if info, e := os.Stat(temp); e == nil && !validHeader(temp, info.Size()) {
+			os.Remove(temp)
+			return &FileBusyError{Path: p, Reason: "incomplete file"}
+		}
+		if e := c.databases.replaceable(c.abs(p), p); e != nil {
+			return e
+		}
+	}
+	if e := c.stashPrevious(p); e != nil {
+		return e
+	}
+	return c.journal.finish(entry, hash)
+}
+
+// replaceable checks that the local copy of a database is not opened by an application before it is replaced.
+func (s *safeReplace) replaceable(abs string, p string) error {
+	if _, e := os.Stat(abs); e != nil {
+		return nil
+	}
+	if reason := lockedBy(abs); reason != "" {
+		return &FileBusyError{Path: p, Reason: reason}
+	}
+	return nil
+}
+
+// lockedBy detects files opened by an application, from the lock and journal files they leave next to them or
+// from the operating system. It returns an empty string if the file is free.
+func lockedBy(abs string) string {
+	dir, name := filepath.Split(abs)
+	if sideSize(abs+"-journal") > 0 {
+		return "transaction in progress"
+	}
+	if sideSize(abs+"-wal") > 0 {
+		return "opened by an application"
+	}
+	if sideSize(filepath.Join(dir, ".~lock."+name+"#")) >= 0 || sideSize(abs+".lock") >= 0 {
+		return "opened by an application"
+	}
+	if fileInUse(abs) {
+		return "opened by an application"
+	}
+	return ""
+}
+
+// sideSize returns the size of a side file, or -1 if it does not exist.
+func sideSize(abs string) int64 {
+	info, e := os.Stat(abs)
+	if e != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// validHeader verifies the magic bytes of the known database formats. SQLite files must also contain a whole
+// number of pages. Files of other types are always valid.
+func validHeader(abs string, size int64) bool {
+	var magics [][]byte
+	switch strings.ToLower(filepath.Ext(abs)) {
+	case ".kdbx":
+		magics = [][]byte{kdbxMagic}
+	case ".kdb":
+		magics = [][]byte{kdbMagic}
+	case ".sqlite", ".sqlite3", ".db":
+		magics = [][]byte{sqliteMagic}
+	default:
+		return true
+	}
+	f, e := os.Open(abs)
+	if e != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 18)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+	for _, magic := range magics {
+		if !bytes.HasPrefix(header, magic) {
+			continue
+		}
+		if bytes.Equal(magic, sqliteMagic) {
+			if len(header) < 18 {
+				return false
+			}
+			pageSize := int64(binary.BigEndian.Uint16(header[16:18]))
+			if pageSize == 1 {
+				pageSize = 65536
+			}
+			return pageSize > 0 && size%pageSize == 0
+		}
+		return true
+	}
+	// Files named .db are not always SQLite databases
+	return strings.ToLower(filepath.Ext(abs)) == ".db" && n > 0 && !bytes.HasPrefix(sqliteMagic, header)
+}
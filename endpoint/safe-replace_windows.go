@@ -0,0 +1,39 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import "syscall"
+
+// errorSharingViolation is returned when opening a file that another process opened without sharing it.
+const errorSharingViolation syscall.Errno = 32
+
+// fileInUse tries to open the file without sharing it: this fails if an application keeps it open.
+func fileInUse(abs string) bool {
+	p, e := syscall.UTF16PtrFromString(abs)
+	if e != nil {
+		return false
+	}
+	h, e := syscall.CreateFile(p, syscall.GENERIC_READ, 0, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if e != nil {
+		return e == errorSharingViolation
+	}
+	syscall.CloseHandle(h)
+	return false
+}
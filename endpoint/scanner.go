@@ -0,0 +1,276 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// Scanner checks the content of a local file.
+type Scanner interface {
+	// Scan returns clean=false and a reason if the file must not be used.
+	Scan(filePath string) (clean bool, reason string, e error)
+}
+
+// QuarantineError is returned by writers when a downloaded file was moved to quarantine.
+type QuarantineError struct {
+	Path       string
+	Quarantine string
+	Reason     string
+}
+
+func (q *QuarantineError) Error() string {
+	return fmt.Sprintf("%s was moved to quarantine (%s)", q.Path, q.Reason)
+}
+
+// NewScanner creates a scanner from the task configuration.
+func NewScanner(conf *config.Scanner) (Scanner, error) {
+	if len(conf.Command) > 0 {
+		return &commandScanner{command: conf.Command}, nil
+	}
+	if conf.ICAP != "" {
+		u, e := url.Parse(conf.ICAP)
+		if e != nil || u.Scheme != "icap" {
+			return nil, fmt.Errorf("invalid ICAP URL %s", conf.ICAP)
+		}
+		return &icapScanner{service: u}, nil
+	}
+	return nil, fmt.Errorf("scanner requires either a command or an ICAP service")
+}
+
+// SetScanner installs a content scanner on a local endpoint. Downloaded files are written to a temporary file
+// and scanned before being moved into place. Infected files are moved to the quarantine folder.
+func SetScanner(ep model.Endpoint, scanner Scanner, quarantine string) bool {
+	if c, ok := ep.(*localFS); ok {
+		c.scanner = scanner
+		c.quarantine = quarantine
+		return true
+	}
+	return false
+}
+
+// commandScanner runs an external command, following the clamscan convention for exit codes. The command runs
+// as owner if set.
+type commandScanner struct {
+	command []string
+	owner   *Owner
+}
+
+func (s *commandScanner) Scan(filePath string) (bool, string, error) {
+	var args []string
+	for _, a := range s.command[1:] {
+		args = append(args, strings.Replace(a, "{path}", filePath, -1))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command[0], args...)
+	DropPrivileges(cmd, s.owner)
+	out, e := cmd.CombinedOutput()
+	if e == nil {
+		return true, "", nil
+	}
+	if exit, ok := e.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		return false, strings.TrimSpace(string(out)), nil
+	}
+	return false, "", fmt.Errorf("scanner failed: %s %s", e.Error(), strings.TrimSpace(string(out)))
+}
+
+// icapScanner sends the file to an ICAP service with a RESPMOD request.
+type icapScanner struct {
+	service *url.URL
+}
+
+func (s *icapScanner) Scan(filePath string) (bool, string, error) {
+	f, e := os.Open(filePath)
+	if e != nil {
+		return false, "", e
+	}
+	defer f.Close()
+	host := s.service.Host
+	if s.service.Port() == "" {
+		host += ":1344"
+	}
+	conn, e := net.DialTimeout("tcp", host, 30*time.Second)
+	if e != nil {
+		return false, "", e
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Minute))
+
+	resHeader := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\n", s.service.String())
+	fmt.Fprintf(w, "Host: %s\r\n", s.service.Host)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(resHeader))
+	w.WriteString(resHeader)
+	buf := make([]byte, 64*1024)
+	for {
+		n, er := f.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if er == io.EOF {
+			break
+		} else if er != nil {
+			return false, "", er
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if e := w.Flush(); e != nil {
+		return false, "", e
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	status, e := reader.ReadLine()
+	if e != nil {
+		return false, "", e
+	}
+	parts := strings.SplitN(status, " ", 3)
+	if len(parts) < 2 {
+		return false, "", fmt.Errorf("invalid ICAP response: %s", status)
+	}
+	code, _ := strconv.Atoi(parts[1])
+	headers, _ := reader.ReadMIMEHeader()
+	switch code {
+	case 204:
+		return true, "", nil
+	case 200:
+		for _, h := range []string{"X-Infection-Found", "X-Violations-Found", "X-Virus-Id"} {
+			if v := headers.Get(h); v != "" {
+				return false, v, nil
+			}
+		}
+		return true, "", nil
+	default:
+		return false, "", fmt.Errorf("ICAP service returned %s", status)
+	}
+}
+
+// scanWriter buffers a download into a temporary file, scans it on Close, and either moves it into place
+// through the local endpoint or to the quarantine folder.
+type scanWriter struct {
+	*os.File
+	ctx  context.Context
+	c    *localFS
+	p    string
+	size int64
+	done chan bool
+	errs chan error
+}
+
+func (c *localFS) scanningWriter(ctx context.Context, p string, targetSize int64) (io.WriteCloser, chan bool, chan error, error) {
+	tmp, e := ioutil.TempFile("", "cells-sync-scan-")
+	if e != nil {
+		return nil, nil, nil, e
+	}
+	w := &scanWriter{File: tmp, ctx: ctx, c: c, p: p, size: targetSize, done: make(chan bool, 1), errs: make(chan error, 1)}
+	out, done := trackWriter(c.progress, p, targetSize, w, w.done, false)
+	return out, done, w.errs, nil
+}
+
+func (w *scanWriter) Close() error {
+	name := w.File.Name()
+	w.File.Close()
+	defer os.Remove(name)
+	e := w.commit(name)
+	if e != nil {
+		w.errs <- e
+	} else {
+		w.done <- true
+	}
+	close(w.done)
+	close(w.errs)
+	return e
+}
+
+func (w *scanWriter) commit(name string) error {
+	w.c.progress.Phase(w.p, FilePhaseVerifying, 0)
+	clean, reason, e := w.c.scanner.Scan(name)
+	if e != nil {
+		return e
+	}
+	if !clean {
+		if e := os.MkdirAll(w.c.quarantine, 0755); e != nil {
+			return e
+		}
+		target := filepath.Join(w.c.quarantine, fmt.Sprintf("%d-%s", time.Now().Unix(), path.Base(w.p)))
+		if e := moveFile(name, target); e != nil {
+			return e
+		}
+		return &QuarantineError{Path: w.p, Quarantine: target, Reason: reason}
+	}
+	src, e := os.Open(name)
+	if e != nil {
+		return e
+	}
+	defer src.Close()
+	out, writeDone, writeErr, e := w.c.openWriter(w.ctx, w.p, w.size)
+	if e != nil {
+		return e
+	}
+	w.c.progress.Phase(w.p, FilePhaseCommitting, 0)
+	if _, e := io.Copy(out, src); e != nil {
+		out.Close()
+		return e
+	}
+	if e := out.Close(); e != nil {
+		return e
+	}
+	if writeDone == nil {
+		return nil
+	}
+	select {
+	case <-writeDone:
+		return nil
+	case e := <-writeErr:
+		return e
+	}
+}
+
+// moveFile renames a file, falling back to a clone or a copy across volumes.
+func moveFile(from, to string) error {
+	if os.Rename(from, to) == nil {
+		return nil
+	}
+	if e := CloneFile(from, to); e != nil {
+		return e
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/endpoints/snapshot"
+)
+
+const (
+	ExportFormatJSON = "jsonl"
+	ExportFormatCSV  = "csv"
+)
+
+var csvHeader = []string{"path", "type", "size", "etag", "mtime", "uuid"}
+
+// SnapshotEntry is a portable representation of a snapshot node.
+type SnapshotEntry struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Size  int64  `json:"size"`
+	Etag  string `json:"etag"`
+	MTime int64  `json:"mtime"`
+	Uuid  string `json:"uuid,omitempty"`
+}
+
+func entryFromNode(p string, node *tree.Node) SnapshotEntry {
+	t := "file"
+	if !node.IsLeaf() {
+		t = "folder"
+	}
+	return SnapshotEntry{
+		Path:  "/" + strings.TrimLeft(p, "/"),
+		Type:  t,
+		Size:  node.GetSize(),
+		Etag:  node.GetEtag(),
+		MTime: node.GetMTime(),
+		Uuid:  node.GetUuid(),
+	}
+}
+
+func (e SnapshotEntry) node() *tree.Node {
+	t := tree.NodeType_LEAF
+	if e.Type == "folder" {
+		t = tree.NodeType_COLLECTION
+	}
+	return &tree.Node{
+		Path:  strings.TrimLeft(e.Path, "/"),
+		Type:  t,
+		Size:  e.Size,
+		Etag:  e.Etag,
+		MTime: e.MTime,
+		Uuid:  e.Uuid,
+	}
+}
+
+// ExportSnapshot writes all entries of a task snapshot ("left" or "right") in the given format, sorted by path.
+func ExportSnapshot(configPath, name, format string, w io.Writer) (int, error) {
+	entries, e := LoadSnapshotEntries(configPath, name)
+	if e != nil {
+		return 0, e
+	}
+	return len(entries), WriteSnapshotEntries(entries, format, w)
+}
+
+// LoadSnapshotEntries reads all entries of a task snapshot ("left" or "right"), sorted by path.
+func LoadSnapshotEntries(configPath, name string) ([]SnapshotEntry, error) {
+	snap, e := snapshot.NewBoltSnapshot(configPath, name)
+	if e != nil {
+		return nil, e
+	}
+	defer snap.Close()
+	var entries []SnapshotEntry
+	snap.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || strings.Trim(p, "/") == "" {
+			return
+		}
+		entries = append(entries, entryFromNode(p, node))
+	}, "/", true)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// ImportSnapshot seeds a task snapshot from entries, e.g. to initialize a new machine from an existing one.
+func ImportSnapshot(configPath, name string, entries []SnapshotEntry) error {
+	snap, e := snapshot.NewBoltSnapshot(configPath, name)
+	if e != nil {
+		return e
+	}
+	defer snap.Close()
+	ctx := context.Background()
+	// Parents first
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	for _, entry := range entries {
+		if e := snap.CreateNode(ctx, entry.node(), true); e != nil {
+			return fmt.Errorf("cannot import %s: %v", entry.Path, e)
+		}
+	}
+	return nil
+}
+
+// WriteSnapshotEntries encodes entries as JSON lines or CSV.
+func WriteSnapshotEntries(entries []SnapshotEntry, format string, w io.Writer) error {
+	switch format {
+	case ExportFormatJSON:
+		enc := json.NewEncoder(w)
+		for _, entry := range entries {
+			if e := enc.Encode(entry); e != nil {
+				return e
+			}
+		}
+		return nil
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, e := range entries {
+			cw.Write([]string{e.Path, e.Type, strconv.FormatInt(e.Size, 10), e.Etag, strconv.FormatInt(e.MTime, 10), e.Uuid})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported format %s, use %s or %s", format, ExportFormatJSON, ExportFormatCSV)
+	}
+}
+
+// ReadSnapshotEntries decodes entries from JSON lines or CSV.
+func ReadSnapshotEntries(format string, r io.Reader) (entries []SnapshotEntry, e error) {
+	switch format {
+	case ExportFormatJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var entry SnapshotEntry
+			if er := json.Unmarshal([]byte(line), &entry); er != nil {
+				return nil, er
+			}
+			entries = append(entries, entry)
+		}
+		return entries, scanner.Err()
+	case ExportFormatCSV:
+		records, er := csv.NewReader(r).ReadAll()
+		if er != nil {
+			return nil, er
+		}
+		for i, rec := range records {
+			if i == 0 && rec[0] == csvHeader[0] {
+				continue
+			}
+			if len(rec) < len(csvHeader) {
+				return nil, fmt.Errorf("line %d: expected %d columns", i+1, len(csvHeader))
+			}
+			entry := SnapshotEntry{Path: rec[0], Type: rec[1], Etag: rec[3], Uuid: rec[5]}
+			entry.Size, _ = strconv.ParseInt(rec[2], 10, 64)
+			entry.MTime, _ = strconv.ParseInt(rec[4], 10, 64)
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %s, use %s or %s", format, ExportFormatJSON, ExportFormatCSV)
+	}
+}
+
+// FormatFromFilename guesses the export format from a file extension.
+func FormatFromFilename(name string) string {
+	if strings.ToLower(filepath.Ext(name)) == ".csv" {
+		return ExportFormatCSV
+	}
+	return ExportFormatJSON
+}
+
+// DiffSnapshotEntries compares two exports and returns human-readable lines for added, removed and changed paths.
+func DiffSnapshotEntries(a, b []SnapshotEntry) (lines []string) {
+	indexA := make(map[string]SnapshotEntry, len(a))
+	for _, e := range a {
+		indexA[e.Path] = e
+	}
+	seen := make(map[string]bool, len(b))
+	for _, eb := range b {
+		seen[eb.Path] = true
+		ea, ok := indexA[eb.Path]
+		if !ok {
+			lines = append(lines, "+ "+eb.Path)
+			continue
+		}
+		var changes []string
+		if ea.Type != eb.Type {
+			changes = append(changes, "type "+ea.Type+" -> "+eb.Type)
+		}
+		if ea.Type == "file" && ea.Size != eb.Size {
+			changes = append(changes, fmt.Sprintf("size %d -> %d", ea.Size, eb.Size))
+		}
+		if ea.Etag != eb.Etag {
+			changes = append(changes, "etag "+ea.Etag+" -> "+eb.Etag)
+		}
+		if ea.Type == "file" && ea.MTime != eb.MTime {
+			changes = append(changes, "mtime "+time.Unix(ea.MTime, 0).Format(time.RFC3339)+" -> "+time.Unix(eb.MTime, 0).Format(time.RFC3339))
+		}
+		if len(changes) > 0 {
+			lines = append(lines, "~ "+eb.Path+" ("+strings.Join(changes, ", ")+")")
+		}
+	}
+	for _, ea := range a {
+		if !seen[ea.Path] {
+			lines = append(lines, "- "+ea.Path)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][2:] < lines[j][2:]
+	})
+	return
+}
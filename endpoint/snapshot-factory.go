@@ -21,11 +21,16 @@ package endpoint
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
 
 	"github.com/pydio/cells/common/sync/endpoints/snapshot"
 	"github.com/pydio/cells/common/sync/model"
@@ -34,9 +39,10 @@ import (
 // SnapshotFactory implements model.SnapshotProvider interface for persisting snapshots in a BoltDB.
 type SnapshotFactory struct {
 	sync.Mutex
-	snaps      map[string]model.Snapshoter
-	uris       map[string]string
-	configPath string
+	snaps       map[string]model.Snapshoter
+	uris        map[string]string
+	configPath  string
+	onCorrupted func(name string)
 }
 
 // NewSnapshotFactory opens a new SnapshotFactory.
@@ -63,7 +69,18 @@ func (f *SnapshotFactory) Load(source model.PathSyncSource) (model.Snapshoter, e
 
 	s, e := snapshot.NewBoltSnapshot(f.configPath, name)
 	if e != nil {
-		return nil, e
+		// Move the broken snapshot aside and start from an empty one
+		file := filepath.Join(f.configPath, "snapshot-"+name)
+		if er := os.Rename(file, file+".corrupted-"+time.Now().Format("20060102-150405")); er != nil {
+			return nil, e
+		}
+		log.Logger(context.Background()).Error("Cannot load snapshot " + name + ", rebuilding it: " + e.Error())
+		if s, e = snapshot.NewBoltSnapshot(f.configPath, name); e != nil {
+			return nil, e
+		}
+		if f.onCorrupted != nil {
+			f.onCorrupted(name)
+		}
 	}
 	f.snaps[name] = s
 	return s, nil
@@ -80,6 +97,46 @@ func (f *SnapshotFactory) Close(ctx context.Context) error {
 	return nil
 }
 
+// Invalidate removes the entries of both snapshots under folder, folder included, so that the next sync pass
+// compares its contents on both sides again instead of trusting the previous state. It must not run during a pass.
+func (f *SnapshotFactory) Invalidate(ctx context.Context, folder string) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	folder = strings.Trim(folder, "/")
+	var count int
+	for _, name := range []string{"left", "right"} {
+		s, ok := f.snaps[name]
+		if !ok {
+			bs, e := snapshot.NewBoltSnapshot(f.configPath, name)
+			if e != nil {
+				return count, e
+			}
+			defer bs.Close()
+			s = bs
+		}
+		var paths []string
+		s.Walk(func(p string, node *tree.Node, err error) {
+			if err == nil && strings.Trim(p, "/") != "" {
+				paths = append(paths, strings.Trim(p, "/"))
+			}
+		}, "/"+folder, true)
+		if folder != "" {
+			paths = append(paths, folder)
+		}
+		// Children first
+		sort.Slice(paths, func(i, j int) bool {
+			return len(paths[i]) > len(paths[j])
+		})
+		for _, p := range paths {
+			if e := s.DeleteNode(ctx, p); e == nil {
+				count++
+			}
+		}
+	}
+	log.Logger(ctx).Info(fmt.Sprintf("Invalidated %d snapshot entries under /%s", count, folder))
+	return count, nil
+}
+
 // Reset clears all snapshots (left and right)
 func (f *SnapshotFactory) Reset(ctx context.Context) error {
 
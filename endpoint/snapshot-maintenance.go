@@ -0,0 +1,237 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+)
+
+// DefaultIgnores are the filter patterns applied to all tasks.
+var DefaultIgnores = []string{"**/.git**", "**/.pydio", "**/" + JournalTempPrefix + "*", "**/" + StashFolder + "**", "**/" + TrashFolder + "**"}
+
+// SnapshotReport describes the result of a check or compaction of a snapshot DB.
+type SnapshotReport struct {
+	Name       string
+	SizeBefore int64
+	SizeAfter  int64
+	Entries    int
+	Removed    int
+	Errors     []string
+}
+
+// String implements Stringer interface.
+func (r *SnapshotReport) String() string {
+	s := fmt.Sprintf("Snapshot %s: %d entries, size %d bytes", r.Name, r.Entries, r.SizeBefore)
+	if r.SizeAfter > 0 {
+		s += fmt.Sprintf(" -> %d bytes, %d entries removed", r.SizeAfter, r.Removed)
+	}
+	if len(r.Errors) > 0 {
+		s += fmt.Sprintf("\n%d integrity errors:\n - %s", len(r.Errors), strings.Join(r.Errors, "\n - "))
+	} else {
+		s += ", no integrity errors"
+	}
+	return s
+}
+
+// SnapshotFiles lists the snapshot DB files of a task.
+func SnapshotFiles(configPath string) (files map[string]string) {
+	files = make(map[string]string)
+	for _, name := range []string{"left", "right"} {
+		p := filepath.Join(configPath, "snapshot-"+name)
+		if _, e := os.Stat(p); e == nil {
+			files[name] = p
+		}
+	}
+	return
+}
+
+func openSnapshotDB(p string, readOnly bool) (*bbolt.DB, error) {
+	options := BoltOptions(2 * time.Second)
+	options.ReadOnly = readOnly
+	db, e := bbolt.Open(p, 0644, options)
+	if e == bbolt.ErrTimeout {
+		return nil, fmt.Errorf("snapshot %s is in use, please stop cells-sync first", p)
+	}
+	return db, e
+}
+
+// CheckSnapshot verifies the integrity of a snapshot DB and counts its entries.
+func CheckSnapshot(name, p string) (*SnapshotReport, error) {
+	report := &SnapshotReport{Name: name}
+	if info, e := os.Stat(p); e == nil {
+		report.SizeBefore = info.Size()
+	} else {
+		return nil, e
+	}
+	db, e := openSnapshotDB(p, true)
+	if e != nil {
+		return nil, e
+	}
+	defer db.Close()
+	e = db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		return tx.ForEach(func(_ []byte, b *bbolt.Bucket) error {
+			report.Entries += b.Stats().KeyN
+			return nil
+		})
+	})
+	return report, e
+}
+
+// CompactSnapshot rewrites a snapshot DB into a fresh file, which rebuilds its pages and indices. Entries
+// whose key is a path refused by keep are dropped. The original file is replaced only if the copy succeeded.
+func CompactSnapshot(name, p string, keep func(path string) bool) (*SnapshotReport, error) {
+	report, e := CheckSnapshot(name, p)
+	if e != nil {
+		return nil, e
+	}
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("snapshot %s is corrupted, it should be removed to trigger a full resync", name)
+	}
+	src, e := openSnapshotDB(p, true)
+	if e != nil {
+		return nil, e
+	}
+	tmp := p + ".compact"
+	os.Remove(tmp)
+	dst, e := openSnapshotDB(tmp, false)
+	if e != nil {
+		src.Close()
+		return nil, e
+	}
+	e = src.View(func(srcTx *bbolt.Tx) error {
+		return dst.Update(func(dstTx *bbolt.Tx) error {
+			return srcTx.ForEach(func(bName []byte, b *bbolt.Bucket) error {
+				target, er := dstTx.CreateBucketIfNotExists(bName)
+				if er != nil {
+					return er
+				}
+				return copyBucket(b, target, keep, report)
+			})
+		})
+	})
+	src.Close()
+	dst.Close()
+	if e != nil {
+		os.Remove(tmp)
+		return nil, e
+	}
+	if e := os.Rename(tmp, p); e != nil {
+		return nil, e
+	}
+	if info, e := os.Stat(p); e == nil {
+		report.SizeAfter = info.Size()
+	}
+	return report, nil
+}
+
+func copyBucket(src, dst *bbolt.Bucket, keep func(path string) bool, report *SnapshotReport) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			// Nested bucket
+			nested, e := dst.CreateBucketIfNotExists(k)
+			if e != nil {
+				return e
+			}
+			return copyBucket(src.Bucket(k), nested, keep, report)
+		}
+		if keep != nil && !keep(string(k)) {
+			report.Removed++
+			return nil
+		}
+		return dst.Put(k, v)
+	})
+}
+
+// FilterMatcher returns a function checking if a path is inside the selective roots (if any) and not ignored.
+func FilterMatcher(selectiveRoots []string, ignores []string) func(string) bool {
+	var patterns []*regexp.Regexp
+	for _, i := range ignores {
+		if r, e := globToRegexp(i); e == nil {
+			patterns = append(patterns, r)
+		}
+	}
+	return func(p string) bool {
+		p = strings.Trim(p, "/")
+		if p == "" {
+			return true
+		}
+		for _, r := range patterns {
+			if r.MatchString(p) {
+				return false
+			}
+		}
+		if len(selectiveRoots) == 0 {
+			return true
+		}
+		for _, root := range selectiveRoots {
+			root = strings.Trim(root, "/")
+			// Keep the root itself, its parents and its children
+			if p == root || strings.HasPrefix(p, root+"/") || strings.HasPrefix(root, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchGlob checks if a path matches a glob pattern, using the same syntax as ignores.
+func MatchGlob(glob string, p string) bool {
+	r, e := globToRegexp(glob)
+	return e == nil && r.MatchString(strings.Trim(p, "/"))
+}
+
+// globToRegexp converts a filter pattern where "**" matches any number of folders.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.Trim(glob, "/")
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
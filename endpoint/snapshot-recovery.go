@@ -0,0 +1,122 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// SafeMode skips all deletions on an endpoint while the snapshots of a task are rebuilt after a corruption,
+// as the first sync after a rebuild cannot tell deleted files from files missing in the snapshot.
+type SafeMode struct {
+	skipped int32
+}
+
+// Skipped returns the number of deletions skipped so far.
+func (m *SafeMode) Skipped() int {
+	return int(atomic.LoadInt32(&m.skipped))
+}
+
+// skip records a skipped deletion, and returns false if safe mode is not active.
+func (m *SafeMode) skip(ctx context.Context, p string) bool {
+	if m == nil {
+		return false
+	}
+	atomic.AddInt32(&m.skipped, 1)
+	log.Logger(ctx).Info("Safe mode: not deleting " + p)
+	return true
+}
+
+// SetSafeMode enables (or disables with a nil mode) the safe mode on an endpoint. It returns false if the
+// endpoint does not support it.
+func SetSafeMode(ep model.Endpoint, mode *SafeMode) bool {
+	switch c := ep.(type) {
+	case *localFS:
+		c.safe = mode
+	case *remoteFS:
+		c.safe = mode
+	default:
+		return false
+	}
+	return true
+}
+
+// RepairSnapshots checks the snapshots of a task. Snapshots that cannot be opened or fail the consistency check
+// are moved aside, so that they are rebuilt from a fresh walk of both sides. It returns the names of the moved
+// snapshots.
+func RepairSnapshots(configPath string) (moved []string, e error) {
+	for _, name := range []string{"left", "right"} {
+		file := filepath.Join(configPath, "snapshot-"+name)
+		if _, er := os.Stat(file); er != nil {
+			continue
+		}
+		er := checkBoltFile(file)
+		if er == nil || er == bbolt.ErrTimeout {
+			continue
+		}
+		log.Logger(context.Background()).Error("Snapshot " + name + " is corrupted: " + er.Error())
+		if er := os.Rename(file, file+".corrupted-"+time.Now().Format("20060102-150405")); er != nil {
+			return moved, er
+		}
+		moved = append(moved, name)
+	}
+	return
+}
+
+// OnSnapshotCorrupted registers a callback on a snapshot factory, called when a snapshot that failed to load was
+// moved aside and created again.
+func OnSnapshotCorrupted(f model.SnapshotFactory, callback func(name string)) {
+	if sf, ok := f.(*SnapshotFactory); ok {
+		sf.onCorrupted = callback
+	}
+}
+
+// checkBoltFile opens a BoltDB read-only and runs its consistency check. Corrupted pages may panic.
+func checkBoltFile(file string) (e error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e = fmt.Errorf("panic while reading: %v", r)
+		}
+	}()
+	db, e := bbolt.Open(file, 0644, &bbolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+	if e != nil {
+		return e
+	}
+	defer db.Close()
+	return db.View(func(tx *bbolt.Tx) (first error) {
+		// Drain the channel to let the check finish
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		return
+	})
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+)
+
+// SnapshotSchemaVersion is the version of the snapshots layout written by this release. It is raised with each
+// migration added to snapshotMigrations.
+const SnapshotSchemaVersion = 0
+
+const (
+	snapshotSchemaFile    = "snapshot-schema"
+	snapshotMigrationFile = "snapshot-migration.json"
+	snapshotBackupFolder  = "snapshot-backup"
+	// Migrations only rewrite the nodes bucket, other buckets are copied as is
+	snapshotNodesBucket = "snapshot"
+)
+
+// SnapshotSchema records the version of the snapshots of a task, and the release that wrote them.
+type SnapshotSchema struct {
+	Version int
+	Binary  string
+	Updated time.Time
+}
+
+// snapshotMigration upgrades the entries of a snapshot to Version. Rewrite returns the new value of an entry,
+// or false to drop it.
+type snapshotMigration struct {
+	Version     int
+	Description string
+	Rewrite     func(key, value []byte) ([]byte, bool)
+}
+
+// snapshotMigrations lists the migrations from the first schema, ordered by version. Schema 0 is the layout of
+// the snapshots written before the schema was recorded.
+var snapshotMigrations []*snapshotMigration
+
+// SnapshotMigrationReport describes the changes of a migration on one snapshot.
+type SnapshotMigrationReport struct {
+	Name      string
+	From      int
+	To        int
+	Steps     []string
+	Entries   int
+	Dropped   int
+	Rewritten int
+}
+
+// String implements Stringer interface.
+func (r *SnapshotMigrationReport) String() string {
+	s := fmt.Sprintf("Snapshot %s: schema %d -> %d, %d entries, %d dropped, %d rewritten", r.Name, r.From, r.To, r.Entries, r.Dropped, r.Rewritten)
+	for _, step := range r.Steps {
+		s += "\n - " + step
+	}
+	return s
+}
+
+// LoadSnapshotSchema reads the schema of the snapshots of a task. Snapshots written before the schema was recorded
+// are version 0, a task without snapshots is at the current version.
+func LoadSnapshotSchema(configPath string) (*SnapshotSchema, error) {
+	data, e := ioutil.ReadFile(filepath.Join(configPath, snapshotSchemaFile))
+	if os.IsNotExist(e) {
+		if len(SnapshotFiles(configPath)) > 0 {
+			return &SnapshotSchema{}, nil
+		}
+		return &SnapshotSchema{Version: SnapshotSchemaVersion}, nil
+	} else if e != nil {
+		return nil, e
+	}
+	schema := &SnapshotSchema{}
+	if e := json.Unmarshal(data, schema); e != nil {
+		return nil, e
+	}
+	return schema, nil
+}
+
+func saveSnapshotSchema(configPath string, schema *SnapshotSchema) error {
+	data, _ := json.Marshal(schema)
+	return ioutil.WriteFile(filepath.Join(configPath, snapshotSchemaFile), data, 0644)
+}
+
+// LoadSnapshotMigrationReport reads the dry-run report saved before the last migration of the snapshots of a task.
+func LoadSnapshotMigrationReport(configPath string) ([]*SnapshotMigrationReport, error) {
+	data, e := ioutil.ReadFile(filepath.Join(configPath, snapshotMigrationFile))
+	if e != nil {
+		return nil, e
+	}
+	var reports []*SnapshotMigrationReport
+	return reports, json.Unmarshal(data, &reports)
+}
+
+func pendingMigrations(from int) (steps []*snapshotMigration) {
+	for _, m := range snapshotMigrations {
+		if m.Version > from {
+			steps = append(steps, m)
+		}
+	}
+	return
+}
+
+// PlanSnapshotMigration is a dry-run of MigrateSnapshots: it reports the entries that the pending migrations would
+// drop or rewrite in each snapshot of a task, without modifying them.
+func PlanSnapshotMigration(configPath string) ([]*SnapshotMigrationReport, error) {
+	schema, e := LoadSnapshotSchema(configPath)
+	if e != nil {
+		return nil, e
+	}
+	if schema.Version > SnapshotSchemaVersion {
+		return nil, fmt.Errorf("snapshots use schema %d, written by a newer release (%s)", schema.Version, schema.Binary)
+	}
+	steps := pendingMigrations(schema.Version)
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	var reports []*SnapshotMigrationReport
+	for name, p := range SnapshotFiles(configPath) {
+		report := &SnapshotMigrationReport{Name: name, From: schema.Version, To: SnapshotSchemaVersion}
+		for _, step := range steps {
+			report.Steps = append(report.Steps, fmt.Sprintf("%d: %s", step.Version, step.Description))
+		}
+		if e := migrateSnapshot(p, "", steps, report); e != nil {
+			return nil, e
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+	return reports, nil
+}
+
+// MigrateSnapshots upgrades the snapshots of a task to SnapshotSchemaVersion. The dry-run report is saved next to
+// the snapshots, which are backed up with their schema before being rewritten. If a snapshot cannot be migrated,
+// the backup is restored and the error is returned. Snapshots must not be in use.
+func MigrateSnapshots(configPath string, binary string) ([]*SnapshotMigrationReport, error) {
+	schema, e := LoadSnapshotSchema(configPath)
+	if e != nil {
+		return nil, e
+	}
+	if schema.Version == SnapshotSchemaVersion {
+		if _, e := os.Stat(filepath.Join(configPath, snapshotSchemaFile)); os.IsNotExist(e) {
+			// New task, snapshots will be created with the current schema
+			return nil, saveSnapshotSchema(configPath, &SnapshotSchema{Version: SnapshotSchemaVersion, Binary: binary, Updated: time.Now()})
+		}
+		return nil, nil
+	}
+	reports, e := PlanSnapshotMigration(configPath)
+	if e != nil {
+		return nil, e
+	}
+	data, _ := json.MarshalIndent(reports, "", "  ")
+	if e := ioutil.WriteFile(filepath.Join(configPath, snapshotMigrationFile), data, 0644); e != nil {
+		return reports, e
+	}
+	if e := backupSnapshots(configPath, schema); e != nil {
+		return reports, fmt.Errorf("cannot backup snapshots: %v", e)
+	}
+	steps := pendingMigrations(schema.Version)
+	for name, p := range SnapshotFiles(configPath) {
+		tmp := p + ".migrate"
+		e := migrateSnapshot(p, tmp, steps, &SnapshotMigrationReport{Name: name})
+		if e == nil {
+			e = os.Rename(tmp, p)
+		}
+		if e != nil {
+			os.Remove(tmp)
+			if _, er := RestoreSnapshotBackup(configPath); er != nil {
+				return reports, fmt.Errorf("cannot migrate snapshot %s (%v), and cannot restore backup: %v", name, e, er)
+			}
+			return reports, fmt.Errorf("cannot migrate snapshot %s, backup restored: %v", name, e)
+		}
+	}
+	return reports, saveSnapshotSchema(configPath, &SnapshotSchema{Version: SnapshotSchemaVersion, Binary: binary, Updated: time.Now()})
+}
+
+// migrateSnapshot applies the migration steps to the snapshot file p and writes the result to target, or only
+// fills the report if target is empty.
+func migrateSnapshot(p, target string, steps []*snapshotMigration, report *SnapshotMigrationReport) error {
+	src, e := openSnapshotDB(p, true)
+	if e != nil {
+		return e
+	}
+	defer src.Close()
+	if target == "" {
+		return src.View(func(tx *bbolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+				return migrateBucket(b, nil, string(name) == snapshotNodesBucket, steps, report)
+			})
+		})
+	}
+	os.Remove(target)
+	dst, e := openSnapshotDB(target, false)
+	if e != nil {
+		return e
+	}
+	defer dst.Close()
+	return src.View(func(srcTx *bbolt.Tx) error {
+		return dst.Update(func(dstTx *bbolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+				bucket, er := dstTx.CreateBucketIfNotExists(name)
+				if er != nil {
+					return er
+				}
+				return migrateBucket(b, bucket, string(name) == snapshotNodesBucket, steps, report)
+			})
+		})
+	})
+}
+
+// migrateBucket rewrites the entries of src into dst, or only counts the changes if dst is nil.
+func migrateBucket(src, dst *bbolt.Bucket, nodes bool, steps []*snapshotMigration, report *SnapshotMigrationReport) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			var nested *bbolt.Bucket
+			if dst != nil {
+				var e error
+				if nested, e = dst.CreateBucketIfNotExists(k); e != nil {
+					return e
+				}
+			}
+			return migrateBucket(src.Bucket(k), nested, nodes, steps, report)
+		}
+		value := v
+		if nodes {
+			report.Entries++
+			for _, step := range steps {
+				var keep bool
+				if value, keep = step.Rewrite(k, value); !keep {
+					report.Dropped++
+					return nil
+				}
+			}
+			if !bytes.Equal(value, v) {
+				report.Rewritten++
+			}
+		}
+		if dst == nil {
+			return nil
+		}
+		return dst.Put(k, value)
+	})
+}
+
+// backupSnapshots copies the snapshots of a task and their schema to the backup folder, replacing the previous
+// backup.
+func backupSnapshots(configPath string, schema *SnapshotSchema) error {
+	folder := filepath.Join(configPath, snapshotBackupFolder)
+	if e := os.RemoveAll(folder); e != nil {
+		return e
+	}
+	if e := os.MkdirAll(folder, 0755); e != nil {
+		return e
+	}
+	for _, p := range SnapshotFiles(configPath) {
+		if e := copySnapshotFile(p, filepath.Join(folder, filepath.Base(p))); e != nil {
+			return e
+		}
+	}
+	return saveSnapshotSchema(folder, schema)
+}
+
+// RestoreSnapshotBackup replaces the snapshots of a task by the backup taken before their last migration, and
+// returns the restored schema. Snapshots must not be in use.
+func RestoreSnapshotBackup(configPath string) (*SnapshotSchema, error) {
+	folder := filepath.Join(configPath, snapshotBackupFolder)
+	data, e := ioutil.ReadFile(filepath.Join(folder, snapshotSchemaFile))
+	if os.IsNotExist(e) {
+		return nil, fmt.Errorf("no snapshot backup found")
+	} else if e != nil {
+		return nil, e
+	}
+	schema := &SnapshotSchema{}
+	if e := json.Unmarshal(data, schema); e != nil {
+		return nil, e
+	}
+	backups := SnapshotFiles(folder)
+	for name, p := range SnapshotFiles(configPath) {
+		if _, ok := backups[name]; !ok {
+			if e := os.Remove(p); e != nil {
+				return nil, e
+			}
+		}
+	}
+	for _, p := range backups {
+		if e := copySnapshotFile(p, filepath.Join(configPath, filepath.Base(p))); e != nil {
+			return nil, e
+		}
+	}
+	return schema, saveSnapshotSchema(configPath, schema)
+}
+
+func copySnapshotFile(src, dst string) error {
+	in, e := os.Open(src)
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+	tmp := dst + ".copy"
+	out, e := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if e != nil {
+		return e
+	}
+	if _, e := io.Copy(out, in); e != nil {
+		out.Close()
+		os.Remove(tmp)
+		return e
+	}
+	if e := out.Sync(); e != nil {
+		out.Close()
+		os.Remove(tmp)
+		return e
+	}
+	out.Close()
+	return os.Rename(tmp, dst)
+}
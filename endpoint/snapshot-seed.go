@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SeedReport describes the validation of a local copy against an exported snapshot.
+type SeedReport struct {
+	Entries      int
+	Missing      []string
+	Mismatch     []string
+	HashChecked  int
+	HashMismatch []string
+}
+
+// Valid returns true if the local copy matches the export.
+func (r *SeedReport) Valid() bool {
+	return len(r.Missing) == 0 && len(r.Mismatch) == 0 && len(r.HashMismatch) == 0
+}
+
+// String implements Stringer interface.
+func (r *SeedReport) String() string {
+	s := fmt.Sprintf("%d entries, %d missing, %d with different type or size, %d/%d spot-checked hashes differ",
+		r.Entries, len(r.Missing), len(r.Mismatch), len(r.HashMismatch), r.HashChecked)
+	for _, l := range [][]string{r.Missing, r.Mismatch, r.HashMismatch} {
+		for i, p := range l {
+			if i >= 10 {
+				s += fmt.Sprintf("\n   ... and %d more", len(l)-10)
+				break
+			}
+			s += "\n - " + p
+		}
+	}
+	return s
+}
+
+// ValidateSeed checks that a copy of a synced folder matches an exported snapshot: all entries must exist with the
+// same type and size, and a random sample of files is hashed and compared to the exported etags. It returns the
+// entries updated with the local modification times, ready to be imported in the local snapshot.
+func ValidateSeed(localRoot string, entries []SnapshotEntry, sample int) (*SeedReport, []SnapshotEntry) {
+	report := &SeedReport{Entries: len(entries)}
+	local := make([]SnapshotEntry, 0, len(entries))
+	var files []SnapshotEntry
+	for _, e := range entries {
+		info, er := os.Stat(filepath.Join(localRoot, filepath.FromSlash(strings.TrimLeft(e.Path, "/"))))
+		if er != nil {
+			report.Missing = append(report.Missing, e.Path)
+			continue
+		}
+		if info.IsDir() != (e.Type == "folder") || (!info.IsDir() && info.Size() != e.Size) {
+			report.Mismatch = append(report.Mismatch, e.Path)
+			continue
+		}
+		l := e
+		l.MTime = info.ModTime().Unix()
+		local = append(local, l)
+		// Multipart etags are not plain MD5
+		if e.Type == "file" && e.Etag != "" && !strings.Contains(e.Etag, "-") {
+			files = append(files, e)
+		}
+	}
+	rand.Shuffle(len(files), func(i, j int) {
+		files[i], files[j] = files[j], files[i]
+	})
+	if sample < len(files) {
+		files = files[:sample]
+	}
+	for _, e := range files {
+		report.HashChecked++
+		if h, er := fileMD5(filepath.Join(localRoot, filepath.FromSlash(strings.TrimLeft(e.Path, "/")))); er != nil || h != strings.Trim(e.Etag, "\"") {
+			report.HashMismatch = append(report.HashMismatch, e.Path)
+		}
+	}
+	return report, local
+}
+
+func fileMD5(p string) (string, error) {
+	f, e := os.Open(p)
+	if e != nil {
+		return "", e
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, e := io.Copy(h, f); e != nil {
+		return "", e
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
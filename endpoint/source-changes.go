@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHotDelay is the time a file must stay unmodified after it changed during a read, before it is read again.
+const DefaultHotDelay = 30 * time.Second
+
+// SourceChangedError is returned by local readers when a file was modified while it was read, so that a torn
+// version is not committed on the other side. The operation is retried once the file is stable.
+type SourceChangedError struct {
+	Path string
+}
+
+func (s *SourceChangedError) Error() string {
+	return s.Path + " changed while it was read, it will be retried once stable"
+}
+
+// hotPaths keeps track of the files that changed during a read. They are not read again until they have not been
+// modified for the delay.
+type hotPaths struct {
+	sync.Mutex
+	delay time.Duration
+	paths map[string]bool
+}
+
+func newHotPaths(delay time.Duration) *hotPaths {
+	return &hotPaths{delay: delay, paths: make(map[string]bool)}
+}
+
+// mark registers a file that changed during a read.
+func (h *hotPaths) mark(p string) {
+	h.Lock()
+	defer h.Unlock()
+	h.paths[strings.Trim(p, "/")] = true
+}
+
+// isHot checks if a file was marked and modified less than delay ago. Stable files are unmarked.
+func (h *hotPaths) isHot(p string, info os.FileInfo) bool {
+	h.Lock()
+	defer h.Unlock()
+	key := strings.Trim(p, "/")
+	if !h.paths[key] {
+		return false
+	}
+	if time.Since(info.ModTime()) < h.delay {
+		return true
+	}
+	delete(h.paths, key)
+	return false
+}
+
+// checkedReader compares the size and modification time of a file at the end of the read with the values at
+// opening time.
+type checkedReader struct {
+	io.ReadCloser
+	abs     string
+	path    string
+	info    os.FileInfo
+	hot     *hotPaths
+	checked bool
+	changed error
+}
+
+func (r *checkedReader) Read(p []byte) (int, error) {
+	n, e := r.ReadCloser.Read(p)
+	if e == io.EOF {
+		if er := r.check(); er != nil {
+			return n, er
+		}
+	}
+	return n, e
+}
+
+// Close also reports a change, as some clients stop reading at the expected size without reaching EOF.
+func (r *checkedReader) Close() error {
+	e := r.ReadCloser.Close()
+	if er := r.check(); er != nil {
+		return er
+	}
+	return e
+}
+
+func (r *checkedReader) check() error {
+	if r.checked {
+		return r.changed
+	}
+	r.checked = true
+	info, e := os.Stat(r.abs)
+	if e != nil || info.Size() != r.info.Size() || !info.ModTime().Equal(r.info.ModTime()) {
+		r.hot.mark(r.path)
+		r.changed = &SourceChangedError{Path: r.path}
+	}
+	return r.changed
+}
+
+// checkReader wraps a reader on a local file to detect changes during the read. Files that recently changed during a
+// read are refused until they are stable.
+func (c *localFS) checkReader(p string, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if c.hot == nil {
+		return open()
+	}
+	abs := c.abs(p)
+	info, e := os.Stat(abs)
+	if e != nil {
+		return open()
+	}
+	if c.hot.isHot(p, info) {
+		return nil, &SourceChangedError{Path: p}
+	}
+	r, e := open()
+	if e != nil {
+		return r, e
+	}
+	return &checkedReader{ReadCloser: r, abs: abs, path: p, info: info, hot: c.hot}, nil
+}
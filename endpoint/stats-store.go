@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+)
+
+// HourlyStats is an aggregate of the data transferred during one hour.
+type HourlyStats struct {
+	Hour      time.Time
+	UpBytes   int64
+	DownBytes int64
+}
+
+// StatsStore is a persistence layer for transfers statistics in the history of a task.
+type StatsStore struct {
+	history *History
+}
+
+// NewStatsStore opens a new StatsStore
+func NewStatsStore(history *History) (*StatsStore, error) {
+	return &StatsStore{history: history}, nil
+}
+
+// RecordTransfer adds transferred bytes to the aggregate of the hour containing t.
+func (s *StatsStore) RecordTransfer(t time.Time, up, down int64) error {
+	if up == 0 && down == 0 {
+		return nil
+	}
+	hour := t.UTC().Truncate(time.Hour)
+	key := HistoryKey(hour, "")
+	stats := HourlyStats{Hour: hour}
+	data, e := s.history.Get(HistoryStats, key)
+	if e != nil {
+		return e
+	} else if data != nil {
+		if e := json.Unmarshal(data, &stats); e != nil {
+			return e
+		}
+	}
+	stats.UpBytes += up
+	stats.DownBytes += down
+	if data, e = json.Marshal(stats); e != nil {
+		return e
+	}
+	return s.history.Put(HistoryStats, key, data)
+}
+
+// LoadHourly lists all hourly aggregates recorded since the given time.
+func (s *StatsStore) LoadHourly(since time.Time) (stats []*HourlyStats, e error) {
+	e = s.history.Walk(HistoryStats, HistoryKey(since.UTC().Truncate(time.Hour), ""), "", false, func(_ string, value []byte) bool {
+		var h HourlyStats
+		if er := json.Unmarshal(value, &h); er == nil {
+			stats = append(stats, &h)
+		}
+		return true
+	})
+	return
+}
+
+// ImportStatsFile adds the hourly aggregates stored by previous versions in their own BoltDB file to the history,
+// then renames the file so that it is imported only once.
+func (s *StatsStore) ImportStatsFile(file string) (int, error) {
+	if _, e := os.Stat(file); e != nil {
+		return 0, nil
+	}
+	options := BoltOptions(5 * time.Second)
+	options.ReadOnly = true
+	db, e := bbolt.Open(file, 0644, options)
+	if e != nil {
+		return 0, e
+	}
+	var records []HourlyStats
+	e = db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("hourly"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var h HourlyStats
+			if er := json.Unmarshal(v, &h); er == nil {
+				records = append(records, h)
+			}
+			return nil
+		})
+	})
+	db.Close()
+	if e != nil {
+		return 0, e
+	}
+	for _, h := range records {
+		if er := s.RecordTransfer(h.Hour, h.UpBytes, h.DownBytes); er != nil {
+			return 0, er
+		}
+	}
+	return len(records), os.Rename(file, file+".imported")
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// TokenBucket limits the throughput shared by all the transfers of a task. Tokens are bytes, refilled at the
+// current rate, with a burst of one second. A zero rate disables the limit.
+type TokenBucket struct {
+	sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// SetRate changes the rate in bytes per second, 0 for no limit.
+func (b *TokenBucket) SetRate(rate int64) {
+	b.Lock()
+	defer b.Unlock()
+	b.rate = rate
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+}
+
+// chunk returns the maximum size of the next operation.
+func (b *TokenBucket) chunk(size int) int {
+	b.Lock()
+	defer b.Unlock()
+	if b.rate > 0 && int64(size) > b.rate {
+		return int(b.rate)
+	}
+	return size
+}
+
+// take consumes n tokens, and sleeps until they are available.
+func (b *TokenBucket) take(n int) {
+	b.Lock()
+	if b.rate <= 0 {
+		b.Unlock()
+		return
+	}
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+		if b.tokens > float64(b.rate) {
+			b.tokens = float64(b.rate)
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+	}
+	b.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// TransferLimiter holds the upload and download rates and the number of parallel transfers of a task. Limits can
+// be changed while transfers are running.
+type TransferLimiter struct {
+	Upload   *TokenBucket
+	Download *TokenBucket
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	parallel int
+	inFlight int
+}
+
+// NewTransferLimiter creates a limiter without limits.
+func NewTransferLimiter() *TransferLimiter {
+	l := &TransferLimiter{Upload: &TokenBucket{}, Download: &TokenBucket{}}
+	l.cond = sync.NewCond(&l.lock)
+	return l
+}
+
+// Set changes all limits. Rates are in bytes per second, 0 means no limit.
+func (l *TransferLimiter) Set(upload, download int64, parallel int) {
+	l.Upload.SetRate(upload)
+	l.Download.SetRate(download)
+	l.lock.Lock()
+	l.parallel = parallel
+	l.lock.Unlock()
+	l.cond.Broadcast()
+}
+
+// acquire waits for a transfer slot, and returns the function releasing it.
+func (l *TransferLimiter) acquire() func() {
+	l.lock.Lock()
+	for l.parallel > 0 && l.inFlight >= l.parallel {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	l.lock.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			l.inFlight--
+			l.lock.Unlock()
+			l.cond.Signal()
+		})
+	}
+}
+
+// SetTransferLimiter registers the limiter of a task on its local endpoint: reads are uploads and writes are
+// downloads. Each file read or written takes a transfer slot until it is closed. It returns false if the endpoint
+// is not local.
+func SetTransferLimiter(ep model.Endpoint, l *TransferLimiter) bool {
+	if c, ok := ep.(*localFS); ok {
+		c.transfers = l
+		return true
+	}
+	return false
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	bucket  *TokenBucket
+	release func()
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, e := r.ReadCloser.Read(p[:r.bucket.chunk(len(p))])
+	r.bucket.take(n)
+	return n, e
+}
+
+func (r *limitedReader) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
+
+type limitedWriter struct {
+	io.WriteCloser
+	bucket  *TokenBucket
+	release func()
+}
+
+func (w *limitedWriter) Write(p []byte) (written int, e error) {
+	for len(p) > 0 {
+		n, er := w.WriteCloser.Write(p[:w.bucket.chunk(len(p))])
+		written += n
+		w.bucket.take(n)
+		if er != nil {
+			return written, er
+		}
+		p = p[n:]
+	}
+	return
+}
+
+func (w *limitedWriter) Close() error {
+	defer w.release()
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// Names of the transfers, as listed in the endpoint capabilities.
+const (
+	TransferStream    = "stream"
+	TransferMultipart = "multipart"
+	TransferRanged    = "ranged"
+)
+
+// transfer is a way of moving file contents between the agent and a remote endpoint. Transfers are tried in order
+// of preference: the first one supported by the endpoint capabilities and suitable for the file is used, the next
+// ones are fallbacks if it cannot start. New protocols (e.g. tus.io resumable uploads, server-side copies) are
+// added as transfers, without changing the sync logic.
+type transfer interface {
+	name() string
+	// accepts checks if the transfer applies to a file of this size on this endpoint
+	accepts(r *remoteFS, size int64) bool
+}
+
+// uploadTransfer sends contents to a remote endpoint.
+type uploadTransfer interface {
+	transfer
+	openWriter(ctx context.Context, r *remoteFS, p string, size int64) (io.WriteCloser, chan bool, chan error, error)
+}
+
+// downloadTransfer reads contents from a remote endpoint. The node may be nil if it could not be loaded.
+type downloadTransfer interface {
+	transfer
+	openReader(ctx context.Context, r *remoteFS, p string, node *tree.Node) (io.ReadCloser, error)
+}
+
+// Transfers by order of preference, the stream transfer works everywhere and must be last.
+var (
+	uploadTransfers   = []uploadTransfer{&tusTransfer{}, &multipartTransfer{}, &streamTransfer{}}
+	downloadTransfers = []downloadTransfer{&rangedTransfer{}, &streamTransfer{}}
+)
+
+// SetCapabilities restricts the transfers used by a remote endpoint to the ones listed in its capabilities. It
+// returns false if the endpoint is not remote.
+func SetCapabilities(ep model.Endpoint, caps *common.Capabilities) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.caps = caps
+	return true
+}
+
+// supports checks if the endpoint capabilities allow a transfer. Unknown capabilities allow all transfers.
+func (r *remoteFS) supports(t transfer) bool {
+	if r.caps == nil || len(r.caps.Transfers) == 0 {
+		return true
+	}
+	for _, n := range r.caps.Transfers {
+		if n == t.name() {
+			return true
+		}
+	}
+	return false
+}
+
+// openWriter opens a writer with the first transfer that accepts the file and manages to start.
+func (r *remoteFS) openWriter(ctx context.Context, p string, targetSize int64) (io.WriteCloser, chan bool, chan error, error) {
+	err := fmt.Errorf("no transfer available to upload %s", p)
+	for _, t := range uploadTransfers {
+		if !r.supports(t) || !t.accepts(r, targetSize) {
+			continue
+		}
+		out, done, errs, e := t.openWriter(ctx, r, p, targetSize)
+		if e == nil {
+			return out, done, errs, nil
+		}
+		log.Logger(ctx).Warn("Cannot start " + t.name() + " upload for " + p + ", trying next transfer: " + e.Error())
+		err = e
+	}
+	return nil, nil, nil, err
+}
+
+// openReader opens a reader with the first transfer that accepts the file and manages to start.
+func (r *remoteFS) openReader(ctx context.Context, p string, node *tree.Node, loadErr error) (io.ReadCloser, error) {
+	size := int64(-1)
+	if loadErr == nil {
+		size = node.GetSize()
+	} else {
+		node = nil
+	}
+	err := fmt.Errorf("no transfer available to download %s", p)
+	for _, t := range downloadTransfers {
+		if !r.supports(t) || !t.accepts(r, size) {
+			continue
+		}
+		reader, e := t.openReader(ctx, r, p, node)
+		if e == nil {
+			return reader, nil
+		}
+		log.Logger(ctx).Warn("Cannot start " + t.name() + " download for " + p + ", trying next transfer: " + e.Error())
+		err = e
+	}
+	return nil, err
+}
+
+// streamTransfer sends or reads the contents in a single request.
+type streamTransfer struct{}
+
+func (s *streamTransfer) name() string {
+	return TransferStream
+}
+
+func (s *streamTransfer) accepts(r *remoteFS, size int64) bool {
+	return true
+}
+
+func (s *streamTransfer) openWriter(ctx context.Context, r *remoteFS, p string, size int64) (io.WriteCloser, chan bool, chan error, error) {
+	return r.Remote.GetWriterOn(ctx, p, size)
+}
+
+func (s *streamTransfer) openReader(ctx context.Context, r *remoteFS, p string, node *tree.Node) (io.ReadCloser, error) {
+	reader, e := r.Remote.GetReaderOn(p)
+	if e != nil || r.progress == nil {
+		return reader, e
+	}
+	return &downloadReader{ReadCloser: reader, tracker: r.progress}, nil
+}
+
+// multipartTransfer uploads large files in parts through a persisted session, resumed after errors or restarts.
+type multipartTransfer struct{}
+
+func (m *multipartTransfer) name() string {
+	return TransferMultipart
+}
+
+func (m *multipartTransfer) accepts(r *remoteFS, size int64) bool {
+	return r.sessions != nil && size >= resumableUploadThreshold
+}
+
+func (m *multipartTransfer) openWriter(ctx context.Context, r *remoteFS, p string, size int64) (io.WriteCloser, chan bool, chan error, error) {
+	key := strings.Trim(r.uri.Path, "/") + "/" + strings.TrimLeft(p, "/")
+	return r.resumableWriter(ctx, p, key, size)
+}
+
+// rangedTransfer downloads large files with parallel ranged requests to a temporary file.
+type rangedTransfer struct{}
+
+func (c *rangedTransfer) name() string {
+	return TransferRanged
+}
+
+func (c *rangedTransfer) accepts(r *remoteFS, size int64) bool {
+	return size >= chunkedDownloadThreshold
+}
+
+func (c *rangedTransfer) openReader(ctx context.Context, r *remoteFS, p string, node *tree.Node) (io.ReadCloser, error) {
+	return r.chunkedDownload(node, p)
+}
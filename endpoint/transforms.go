@@ -0,0 +1,397 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+
+	"github.com/pydio/cells-sync/config"
+)
+
+// Types of transforms, see config.Transform.
+const (
+	TransformStripGPS    = "strip-gps"
+	TransformLineEndings = "line-endings"
+	TransformCommand     = "command"
+)
+
+var transformsBucket = []byte("transformed")
+
+// transformedUpload is recorded for each file uploaded with a transformed content. The server node is presented
+// with the etag and size of the original file, so that the transformed file is not synced back.
+type transformedUpload struct {
+	Source      string
+	SourceSize  int64
+	Transformed string
+	Remote      string
+}
+
+// transformStep changes the content of a file into another file.
+type transformStep struct {
+	conf       *config.Transform
+	extensions []string
+}
+
+// Transforms is a pipeline changing the content of local files while they are uploaded. The etags of the
+// uploaded files are recorded in a BoltDB index, mapped to the etags of the original files.
+type Transforms struct {
+	steps  []*transformStep
+	db     *bbolt.DB
+	tmpDir string
+}
+
+// NewTransforms checks the task transforms and opens their index in the task folder.
+func NewTransforms(conf []*config.Transform, configPath string) (*Transforms, error) {
+	t := &Transforms{tmpDir: filepath.Join(configPath, "transforms-tmp")}
+	for _, c := range conf {
+		step := &transformStep{conf: c, extensions: c.Extensions}
+		switch c.Type {
+		case TransformStripGPS:
+			if len(step.extensions) == 0 {
+				step.extensions = []string{".jpg", ".jpeg"}
+			}
+		case TransformLineEndings:
+			if c.LineEnding != "" && c.LineEnding != "lf" && c.LineEnding != "crlf" {
+				return nil, fmt.Errorf("unknown line ending %s, use lf or crlf", c.LineEnding)
+			}
+			if len(step.extensions) == 0 {
+				step.extensions = []string{".txt", ".csv", ".md"}
+			}
+		case TransformCommand:
+			if len(c.Command) == 0 {
+				return nil, fmt.Errorf("command transform requires a command")
+			}
+		default:
+			return nil, fmt.Errorf("unknown transform %s", c.Type)
+		}
+		t.steps = append(t.steps, step)
+	}
+	if e := os.RemoveAll(t.tmpDir); e != nil {
+		return nil, e
+	}
+	if e := os.MkdirAll(t.tmpDir, 0700); e != nil {
+		return nil, e
+	}
+	db, e := bbolt.Open(filepath.Join(configPath, "transforms"), 0644, BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	t.db = db
+	return t, nil
+}
+
+// SetTransforms makes a remote endpoint transform the files it uploads. It returns false if the endpoint is not
+// remote.
+func SetTransforms(ep model.Endpoint, t *Transforms) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.transforms = t
+	return true
+}
+
+// Close closes the index.
+func (t *Transforms) Close() {
+	t.db.Close()
+}
+
+func (s *transformStep) applies(p string) bool {
+	if len(s.extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(p))
+	for _, e := range s.extensions {
+		if strings.ToLower(e) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// applies returns the steps transforming a path.
+func (t *Transforms) applies(p string) (steps []*transformStep) {
+	for _, s := range t.steps {
+		if s.applies(p) {
+			steps = append(steps, s)
+		}
+	}
+	return
+}
+
+// run writes the transformed content of in to out.
+func (s *transformStep) run(in, out string) error {
+	switch s.conf.Type {
+	case TransformStripGPS:
+		data, e := ioutil.ReadFile(in)
+		if e != nil {
+			return e
+		}
+		StripJPEGGPS(data)
+		return ioutil.WriteFile(out, data, 0600)
+	case TransformLineEndings:
+		return convertLineEndings(in, out, s.conf.LineEnding == "crlf")
+	default:
+		var args []string
+		for _, a := range s.conf.Command[1:] {
+			a = strings.Replace(a, "{in}", in, -1)
+			args = append(args, strings.Replace(a, "{out}", out, -1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if o, e := exec.CommandContext(ctx, s.conf.Command[0], args...).CombinedOutput(); e != nil {
+			return fmt.Errorf("transform command failed: %s %s", e.Error(), strings.TrimSpace(string(o)))
+		}
+		return nil
+	}
+}
+
+// convertLineEndings copies in to out with LF or CRLF line endings.
+func convertLineEndings(in, out string, crlf bool) error {
+	src, e := os.Open(in)
+	if e != nil {
+		return e
+	}
+	defer src.Close()
+	dst, e := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if e != nil {
+		return e
+	}
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+	var prev byte
+	for {
+		b, er := r.ReadByte()
+		if er == io.EOF {
+			break
+		} else if er != nil {
+			dst.Close()
+			return er
+		}
+		switch {
+		case b == '\n' && crlf && prev != '\r':
+			w.WriteByte('\r')
+		case b == '\r' && !crlf:
+			// Written back if it is not followed by a line feed
+			if next, er := r.Peek(1); er == nil && next[0] == '\n' {
+				prev = b
+				continue
+			}
+		}
+		w.WriteByte(b)
+		prev = b
+	}
+	if e := w.Flush(); e != nil {
+		dst.Close()
+		return e
+	}
+	return dst.Close()
+}
+
+func transformKey(uri, p string) []byte {
+	return []byte(uri + "/" + strings.Trim(p, "/"))
+}
+
+func (t *Transforms) record(uri, p string, upload *transformedUpload) error {
+	return t.db.Update(func(tx *bbolt.Tx) error {
+		b, e := tx.CreateBucketIfNotExists(transformsBucket)
+		if e != nil {
+			return e
+		}
+		if upload == nil {
+			return b.Delete(transformKey(uri, p))
+		}
+		data, _ := json.Marshal(upload)
+		return b.Put(transformKey(uri, p), data)
+	})
+}
+
+// present shows a transformed file with the etag and size of its original file, as long as the server file is
+// the one that was uploaded.
+func (t *Transforms) present(uri, p string, node *tree.Node) {
+	if node == nil || !node.IsLeaf() {
+		return
+	}
+	var upload *transformedUpload
+	t.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(transformsBucket); b != nil {
+			if data := b.Get(transformKey(uri, p)); data != nil {
+				json.Unmarshal(data, &upload)
+			}
+		}
+		return nil
+	})
+	if upload == nil {
+		return
+	}
+	if etag := node.GetEtag(); etag == upload.Remote || etag == upload.Transformed {
+		node.Etag = upload.Source
+		node.Size = upload.SourceSize
+	}
+}
+
+// transformSteps returns the transforms applying to an upload, if any.
+func (r *remoteFS) transformSteps(p string) []*transformStep {
+	if r.transforms == nil {
+		return nil
+	}
+	return r.transforms.applies(p)
+}
+
+// normalizeNode presents empty files with the empty etag, and transformed files with the etag of their original.
+func (r *remoteFS) normalizeNode(p string, node *tree.Node) {
+	NormalizeEmptyFile(node)
+	if r.transforms != nil {
+		r.transforms.present(r.uri.String(), p, node)
+	}
+}
+
+// transformWriter buffers an upload to a temporary file. On close, the file goes through the transforms and
+// the result is uploaded.
+type transformWriter struct {
+	tmp     *os.File
+	hash    hash.Hash
+	size    int64
+	onClose func(tmp string, source string, size int64) error
+}
+
+func (w *transformWriter) Write(p []byte) (int, error) {
+	n, e := w.tmp.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, e
+}
+
+func (w *transformWriter) Close() error {
+	if e := w.tmp.Close(); e != nil {
+		return e
+	}
+	return w.onClose(w.tmp.Name(), hex.EncodeToString(w.hash.Sum(nil)), w.size)
+}
+
+// writer returns a writer transforming the content of p with steps before it is uploaded with open. Once the
+// upload is done, the etag of the server file is loaded with load and recorded.
+func (t *Transforms) writer(ctx context.Context, uri, p string, steps []*transformStep, open func(size int64) (io.WriteCloser, chan bool, chan error, error), load func() (*tree.Node, error)) (io.WriteCloser, chan bool, chan error, error) {
+	tmp, e := ioutil.TempFile(t.tmpDir, "source-")
+	if e != nil {
+		return nil, nil, nil, e
+	}
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	w := &transformWriter{tmp: tmp, hash: md5.New()}
+	w.onClose = func(source, sourceHash string, sourceSize int64) error {
+		fail := func(e error) error {
+			errs <- e
+			close(done)
+			return e
+		}
+		files := []string{source}
+		clean := func() {
+			for _, f := range files {
+				os.Remove(f)
+			}
+		}
+		current := source
+		for _, s := range steps {
+			next := current + "-" + s.conf.Type
+			files = append(files, next)
+			if e := s.run(current, next); e != nil {
+				clean()
+				return fail(fmt.Errorf("cannot transform %s: %s", p, e.Error()))
+			}
+			current = next
+		}
+		transformed, e := fileMD5(current)
+		if e != nil {
+			clean()
+			return fail(e)
+		}
+		st, e := os.Stat(current)
+		if e != nil {
+			clean()
+			return fail(e)
+		}
+		out, writeDone, writeErr, e := open(st.Size())
+		if e != nil {
+			clean()
+			return fail(e)
+		}
+		in, e := os.Open(current)
+		if e != nil {
+			out.Close()
+			clean()
+			return fail(e)
+		}
+		_, e = io.Copy(out, in)
+		in.Close()
+		if er := out.Close(); e == nil {
+			e = er
+		}
+		if e != nil {
+			clean()
+			return fail(e)
+		}
+		go func() {
+			defer clean()
+			defer close(done)
+			select {
+			case d, ok := <-writeDone:
+				if !ok {
+					return
+				}
+				var upload *transformedUpload
+				if transformed != sourceHash {
+					upload = &transformedUpload{Source: sourceHash, SourceSize: sourceSize, Transformed: transformed}
+					if node, er := load(); er == nil {
+						upload.Remote = node.GetEtag()
+					}
+				}
+				if er := t.record(uri, p, upload); er != nil {
+					log.Logger(ctx).Error("Cannot record transformed upload of " + p + ": " + er.Error())
+				}
+				done <- d
+			case er := <-writeErr:
+				errs <- er
+			}
+		}()
+		return nil
+	}
+	return w, done, errs, nil
+}
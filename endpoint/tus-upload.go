@@ -0,0 +1,303 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/log"
+)
+
+const (
+	// TransferTus uploads with the tus.io resumable upload protocol
+	TransferTus = "tus"
+
+	tusVersion = "1.0.0"
+	// tusProbePath is where servers and gateways supporting tus are expected to serve it
+	tusProbePath = "/tus/"
+	// uploadProtocolTus marks the upload sessions using tus, whose UploadID is the upload location
+	uploadProtocolTus = "tus"
+	// statusChecksumMismatch is returned by the checksum extension when a chunk was corrupted in transit
+	statusChecksumMismatch = 460
+)
+
+// probeTus checks if the server of a URI serves the tus protocol. It returns the path of the tus endpoint and the
+// checksum algorithm to use, if the checksum extension is supported.
+func probeTus(uri string) (tusPath string, checksum string) {
+	for _, a := range config.Default().Authorities {
+		if !a.MatchesURI(uri) {
+			continue
+		}
+		req, e := a.NewAuthenticatedRequest("OPTIONS", tusProbePath, nil)
+		if e != nil {
+			return "", ""
+		}
+		resp, e := a.Do(req)
+		if e != nil {
+			return "", ""
+		}
+		resp.Body.Close()
+		if !strings.Contains(resp.Header.Get("Tus-Version"), tusVersion) || !strings.Contains(resp.Header.Get("Tus-Extension"), "creation") {
+			return "", ""
+		}
+		if strings.Contains(resp.Header.Get("Tus-Extension"), "checksum") {
+			algorithms := strings.Split(resp.Header.Get("Tus-Checksum-Algorithm"), ",")
+			for _, preferred := range []string{"sha1", "md5"} {
+				for _, algo := range algorithms {
+					if strings.TrimSpace(algo) == preferred {
+						return tusProbePath, preferred
+					}
+				}
+			}
+		}
+		return tusProbePath, ""
+	}
+	return "", ""
+}
+
+// tusTransfer uploads large files with the tus protocol, on servers announcing it in their capabilities.
+type tusTransfer struct{}
+
+func (t *tusTransfer) name() string {
+	return TransferTus
+}
+
+func (t *tusTransfer) accepts(r *remoteFS, size int64) bool {
+	return r.caps != nil && r.caps.TusPath != "" && r.sessions != nil && size >= resumableUploadThreshold
+}
+
+func (t *tusTransfer) openWriter(ctx context.Context, r *remoteFS, p string, size int64) (io.WriteCloser, chan bool, chan error, error) {
+	key := strings.Trim(r.uri.Path, "/") + "/" + strings.TrimLeft(p, "/")
+	return r.tusWriter(ctx, p, key, size)
+}
+
+// tusRequest sends a request of the tus protocol to the server of the endpoint.
+func (r *remoteFS) tusRequest(method, location string, body []byte, headers map[string]string) (*http.Response, error) {
+	for _, a := range config.Default().Authorities {
+		if !a.MatchesURI(r.uri.String()) {
+			continue
+		}
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, e := a.NewAuthenticatedRequest(method, location, reader)
+		if e != nil {
+			return nil, e
+		}
+		req.Header.Del("Content-Type")
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return a.Do(req)
+	}
+	return nil, fmt.Errorf("cannot find server for %s", r.uri.String())
+}
+
+// tusOffset asks the server how many bytes of an upload it received. It returns -1 if the upload is unknown.
+func (r *remoteFS) tusOffset(location string, size int64) int64 {
+	resp, e := r.tusRequest("HEAD", location, nil, nil)
+	if e != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return -1
+	}
+	if length, e := strconv.ParseInt(resp.Header.Get("Upload-Length"), 10, 64); e == nil && length != size {
+		return -1
+	}
+	offset, e := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if e != nil || offset > size {
+		return -1
+	}
+	return offset
+}
+
+// tusCreate creates an upload on the server, and returns its location as a path relative to the server.
+func (r *remoteFS) tusCreate(key string, size int64) (string, error) {
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte(path.Base(key))) + ",path " + base64.StdEncoding.EncodeToString([]byte(key))
+	resp, e := r.tusRequest("POST", r.caps.TusPath, nil, map[string]string{
+		"Upload-Length":   strconv.FormatInt(size, 10),
+		"Upload-Metadata": metadata,
+	})
+	if e != nil {
+		return "", e
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("cannot create tus upload: server returned %d", resp.StatusCode)
+	}
+	location, e := url.Parse(resp.Header.Get("Location"))
+	if e != nil || location.Path == "" {
+		return "", fmt.Errorf("cannot create tus upload: invalid location %s", resp.Header.Get("Location"))
+	}
+	if !strings.HasPrefix(location.Path, "/") {
+		location.Path = path.Join(r.caps.TusPath, location.Path)
+	}
+	return location.RequestURI(), nil
+}
+
+// tusWriter uploads a file with the tus protocol. An existing session for the same path and size is resumed from
+// the offset acknowledged by the server: the bytes before it are read and discarded. Chunks are sent with their
+// checksum if the server supports it, and retried on a new connection after errors and network changes. The
+// session is kept on errors, and removed once the upload is complete.
+func (r *remoteFS) tusWriter(ctx context.Context, p, key string, size int64) (io.WriteCloser, chan bool, chan error, error) {
+	offset := int64(-1)
+	session := r.sessions.get(p)
+	if session != nil && session.Protocol == uploadProtocolTus && session.Key == key && session.Size == size {
+		if offset = r.tusOffset(session.UploadID, size); offset >= 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Resuming tus upload of %s at %d/%d bytes", p, offset, size))
+		}
+	}
+	if offset < 0 {
+		location, e := r.tusCreate(key, size)
+		if e != nil {
+			return nil, nil, nil, e
+		}
+		session = &UploadSession{Key: key, UploadID: location, Size: size, Started: time.Now(), Protocol: uploadProtocolTus}
+		if e := r.sessions.put(p, session); e != nil {
+			return nil, nil, nil, e
+		}
+		offset = 0
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	go func() {
+		fail := func(er error) {
+			reader.CloseWithError(er)
+			errs <- er
+		}
+		// Contents are always written from the start, skip what the server already has
+		if _, er := io.CopyN(ioutil.Discard, reader, offset); er != nil {
+			fail(er)
+			return
+		}
+		buf := make([]byte, uploadPartSize)
+		for offset < size {
+			read, er := io.ReadFull(reader, buf)
+			if er != nil && er != io.ErrUnexpectedEOF {
+				fail(er)
+				return
+			}
+			if offset, er = r.tusPatch(ctx, session, offset, buf[:read]); er != nil {
+				fail(er)
+				return
+			}
+		}
+		r.sessions.remove(p)
+		done <- true
+		close(done)
+	}()
+	return writer, done, errs, nil
+}
+
+// tusPatch sends a chunk at an offset and returns the new offset. After an error, the offset is negotiated again
+// with the server, and only the part of the chunk it did not receive is sent again.
+func (r *remoteFS) tusPatch(ctx context.Context, session *UploadSession, offset int64, chunk []byte) (int64, error) {
+	end := offset + int64(len(chunk))
+	var lastErr error
+	for retry := 0; retry < uploadPartRetries; retry++ {
+		if retry > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Sending chunk at %d of %s again: %s", offset, session.Key, lastErr.Error()))
+			select {
+			case <-time.After(time.Duration(1<<uint(retry)) * time.Second):
+			case <-networkChanges():
+			case <-ctx.Done():
+				return offset, ctx.Err()
+			}
+			if server := r.tusOffset(session.UploadID, session.Size); server >= offset && server <= end {
+				chunk = chunk[server-offset:]
+				offset = server
+			}
+			if offset == end {
+				return end, nil
+			}
+		}
+		headers := map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": strconv.FormatInt(offset, 10),
+		}
+		switch r.caps.TusChecksum {
+		case "sha1":
+			sum := sha1.Sum(chunk)
+			headers["Upload-Checksum"] = "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+		case "md5":
+			sum := md5.Sum(chunk)
+			headers["Upload-Checksum"] = "md5 " + base64.StdEncoding.EncodeToString(sum[:])
+		}
+		type result struct {
+			resp *http.Response
+			err  error
+		}
+		res := make(chan result, 1)
+		changed := networkChanges()
+		go func() {
+			resp, er := r.tusRequest("PATCH", session.UploadID, chunk, headers)
+			res <- result{resp: resp, err: er}
+		}()
+		select {
+		case rs := <-res:
+			if rs.err != nil {
+				lastErr = rs.err
+				continue
+			}
+			rs.resp.Body.Close()
+			switch rs.resp.StatusCode {
+			case http.StatusNoContent:
+				next, er := strconv.ParseInt(rs.resp.Header.Get("Upload-Offset"), 10, 64)
+				if er != nil || next != end {
+					lastErr = fmt.Errorf("server acknowledged offset %s instead of %d", rs.resp.Header.Get("Upload-Offset"), end)
+					continue
+				}
+				return end, nil
+			case statusChecksumMismatch:
+				lastErr = fmt.Errorf("checksum mismatch")
+			case http.StatusNotFound, http.StatusGone:
+				// Upload expired on the server, it must be started again
+				return offset, fmt.Errorf("tus upload of %s expired on the server", session.Key)
+			default:
+				lastErr = fmt.Errorf("server returned %d", rs.resp.StatusCode)
+			}
+		case <-changed:
+			lastErr = fmt.Errorf("network changed")
+		case <-ctx.Done():
+			return offset, ctx.Err()
+		}
+	}
+	return offset, lastErr
+}
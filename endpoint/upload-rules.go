@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// UploadGuard evaluates upload rules on the files of a local folder, and the upload limits of the server policy.
+type UploadGuard struct {
+	rules      *config.UploadRules
+	root       string
+	signatures [][]byte
+
+	policyLock     sync.RWMutex
+	policyMaxSize  int64
+	policyExcludes []string
+}
+
+// NewUploadGuard prepares the rules for the given local root. Rules may be nil when only the server policy applies.
+func NewUploadGuard(rules *config.UploadRules, root string) (*UploadGuard, error) {
+	if rules == nil {
+		rules = &config.UploadRules{}
+	}
+	g := &UploadGuard{rules: rules, root: root}
+	for _, s := range rules.BlockedSignatures {
+		sig, e := hex.DecodeString(strings.Replace(s, " ", "", -1))
+		if e != nil {
+			return nil, fmt.Errorf("invalid signature %s: %s", s, e.Error())
+		}
+		g.signatures = append(g.signatures, sig)
+	}
+	return g, nil
+}
+
+// SetPolicy replaces the limits set by the server policy: a maximum file size (0 for none) and glob patterns of
+// files that cannot be uploaded. It can be called while the task runs.
+func (g *UploadGuard) SetPolicy(maxSize int64, excludes []string) {
+	g.policyLock.Lock()
+	defer g.policyLock.Unlock()
+	g.policyMaxSize = maxSize
+	g.policyExcludes = excludes
+}
+
+func (g *UploadGuard) checkPolicy(p string, size int64) string {
+	g.policyLock.RLock()
+	defer g.policyLock.RUnlock()
+	if g.policyMaxSize > 0 && size > g.policyMaxSize {
+		return fmt.Sprintf("file exceeds the maximum size of %d bytes set by the server policy", g.policyMaxSize)
+	}
+	for _, glob := range g.policyExcludes {
+		if MatchGlob(glob, p) {
+			return "files matching " + glob + " cannot be uploaded by server policy"
+		}
+	}
+	return ""
+}
+
+// Check returns the reason why a file cannot be uploaded, or an empty string.
+func (g *UploadGuard) Check(p string, size int64) string {
+	if reason := g.checkPolicy(p, size); reason != "" {
+		return reason
+	}
+	if g.rules.MaxSize > 0 && size > g.rules.MaxSize {
+		return fmt.Sprintf("file exceeds the maximum upload size of %d bytes", g.rules.MaxSize)
+	}
+	ext := strings.ToLower(path.Ext(p))
+	for _, e := range g.rules.BlockedExtensions {
+		if ext != "" && strings.ToLower("."+strings.TrimLeft(e, ".")) == ext {
+			return "files with extension " + ext + " cannot be uploaded"
+		}
+	}
+	if len(g.rules.BlockedMimeTypes) == 0 && len(g.signatures) == 0 {
+		return ""
+	}
+	head := make([]byte, 512)
+	f, e := os.Open(filepath.Join(g.root, filepath.FromSlash(strings.TrimLeft(p, "/"))))
+	if e != nil {
+		return ""
+	}
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+	head = head[:n]
+	for _, sig := range g.signatures {
+		if bytes.HasPrefix(head, sig) {
+			return "file content matches a blocked signature"
+		}
+	}
+	mimeTypes := []string{http.DetectContentType(head)}
+	if t := mime.TypeByExtension(ext); t != "" {
+		mimeTypes = append(mimeTypes, t)
+	}
+	for _, blocked := range g.rules.BlockedMimeTypes {
+		for _, t := range mimeTypes {
+			t = strings.TrimSpace(strings.Split(t, ";")[0])
+			if t == blocked || (strings.HasSuffix(blocked, "/*") && strings.HasPrefix(t, strings.TrimSuffix(blocked, "*"))) {
+				return "files of type " + t + " cannot be uploaded"
+			}
+		}
+	}
+	return ""
+}
+
+// BlockedFiles walks the local source and returns the files that cannot be uploaded, with their reason.
+func (g *UploadGuard) BlockedFiles(source model.PathSyncSource) map[string]string {
+	blocked := make(map[string]string)
+	source.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || !node.IsLeaf() {
+			return
+		}
+		if reason := g.Check(p, node.GetSize()); reason != "" {
+			blocked["/"+strings.TrimLeft(p, "/")] = reason
+		}
+	}, "/", true)
+	return blocked
+}
+
+// SetUploadGuard installs upload rules on a remote endpoint. Blocked files are not transferred, and are
+// reported to onBlocked instead.
+func SetUploadGuard(ep model.Endpoint, guard *UploadGuard, onBlocked func(p, reason string)) bool {
+	if r, ok := ep.(*remoteFS); ok {
+		r.uploadGuard = guard
+		r.onBlocked = onBlocked
+		return true
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etcd-io/bbolt"
+	"github.com/pydio/minio-go"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// resumableUploadThreshold is the size above which uploads use a persisted multipart session.
+	resumableUploadThreshold = 64 * 1024 * 1024
+	// uploadPartSize is the size of each part, kept in memory until it is acknowledged by the server.
+	uploadPartSize = 16 * 1024 * 1024
+	// uploadPartRetries is the number of attempts for each part, with a growing delay between them.
+	uploadPartRetries = 6
+)
+
+var uploadSessionsBucket = []byte("uploads")
+
+// UploadSession is a multipart upload in progress, persisted so that it can be resumed after an error or a restart.
+type UploadSession struct {
+	Key      string
+	UploadID string
+	Size     int64
+	Started  time.Time
+	// Protocol is empty for S3 multipart uploads
+	Protocol string `json:"Protocol,omitempty"`
+}
+
+// UploadSessions stores the multipart upload sessions of a task, keyed by path. It is based on BoltDB.
+type UploadSessions struct {
+	db *bbolt.DB
+}
+
+// OpenUploadSessions opens or creates the upload sessions store in the task folder.
+func OpenUploadSessions(configPath string) (*UploadSessions, error) {
+	db, e := bbolt.Open(filepath.Join(configPath, "upload-sessions"), 0644, BoltOptions(5*time.Second))
+	if e != nil {
+		return nil, e
+	}
+	return &UploadSessions{db: db}, nil
+}
+
+// SetUploadSessions makes a remote endpoint upload large files in parts through persisted sessions. It returns
+// false if the endpoint is not remote.
+func SetUploadSessions(ep model.Endpoint, sessions *UploadSessions) bool {
+	r, ok := ep.(*remoteFS)
+	if !ok {
+		return false
+	}
+	r.sessions = sessions
+	return true
+}
+
+func (u *UploadSessions) get(p string) *UploadSession {
+	var s *UploadSession
+	u.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(uploadSessionsBucket); b != nil {
+			if data := b.Get(metaKey(p)); data != nil {
+				s = &UploadSession{}
+				if json.Unmarshal(data, s) != nil {
+					s = nil
+				}
+			}
+		}
+		return nil
+	})
+	return s
+}
+
+func (u *UploadSessions) put(p string, s *UploadSession) error {
+	data, e := json.Marshal(s)
+	if e != nil {
+		return e
+	}
+	return u.db.Update(func(tx *bbolt.Tx) error {
+		b, e := tx.CreateBucketIfNotExists(uploadSessionsBucket)
+		if e != nil {
+			return e
+		}
+		return b.Put(metaKey(p), data)
+	})
+}
+
+func (u *UploadSessions) remove(p string) error {
+	return u.db.Update(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(uploadSessionsBucket); b != nil {
+			return b.Delete(metaKey(p))
+		}
+		return nil
+	})
+}
+
+// Close closes the DB.
+func (u *UploadSessions) Close() error {
+	return u.db.Close()
+}
+
+var networkChange = struct {
+	sync.Mutex
+	ch chan struct{}
+}{ch: make(chan struct{})}
+
+// NetworkChanged is called when the network used to reach the servers changes (e.g. from Wi-Fi to Ethernet). Idle
+// connections are dropped, and parts being uploaded on the previous network are sent again on the new one.
+func NetworkChanged() {
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	networkChange.Lock()
+	close(networkChange.ch)
+	networkChange.ch = make(chan struct{})
+	networkChange.Unlock()
+}
+
+func networkChanges() chan struct{} {
+	networkChange.Lock()
+	defer networkChange.Unlock()
+	return networkChange.ch
+}
+
+// resumableWriter uploads a file in parts. An existing session for the same path and size is resumed: parts already
+// on the server with the same MD5 are not sent again. Each part is retried on a new connection, so that a transfer
+// survives network changes. The session is kept on errors, and removed once the upload is complete.
+func (r *remoteFS) resumableWriter(ctx context.Context, p, key string, size int64) (io.WriteCloser, chan bool, chan error, error) {
+	client, e := r.gatewayClient()
+	if e != nil {
+		return nil, nil, nil, e
+	}
+	uploaded := make(map[int]string)
+	session := r.sessions.get(p)
+	if session != nil && session.Protocol != "" {
+		// Started with another protocol, it is left to expire on the server
+		session = nil
+	}
+	if session != nil && (session.Key != key || session.Size != size) {
+		client.AbortMultipartUpload("io", session.Key, session.UploadID)
+		session = nil
+	}
+	if session != nil {
+		if parts, er := client.ListObjectParts("io", key, session.UploadID, 0, 10000); er == nil {
+			for _, part := range parts.ObjectParts {
+				uploaded[part.PartNumber] = strings.Trim(part.ETag, "\"")
+			}
+			log.Logger(ctx).Info(fmt.Sprintf("Resuming upload of %s, %d parts already sent", p, len(uploaded)))
+		} else {
+			// Session expired on the server
+			session = nil
+		}
+	}
+	if session == nil {
+		id, er := client.NewMultipartUpload("io", key, minio.PutObjectOptions{})
+		if er != nil {
+			return nil, nil, nil, er
+		}
+		session = &UploadSession{Key: key, UploadID: id, Size: size, Started: time.Now()}
+		if er := r.sessions.put(p, session); er != nil {
+			return nil, nil, nil, er
+		}
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan bool, 1)
+	errs := make(chan error, 1)
+	go func() {
+		var complete []minio.CompletePart
+		buf := make([]byte, uploadPartSize)
+		for n := 1; ; n++ {
+			read, er := io.ReadFull(reader, buf)
+			if er == io.EOF && n > 1 {
+				break
+			}
+			if er != nil && er != io.ErrUnexpectedEOF && er != io.EOF {
+				reader.CloseWithError(er)
+				errs <- er
+				return
+			}
+			part := buf[:read]
+			sum := md5.Sum(part)
+			etag := hex.EncodeToString(sum[:])
+			if uploaded[n] != etag {
+				if etag, er = r.uploadPart(ctx, session, n, part, sum[:]); er != nil {
+					reader.CloseWithError(er)
+					errs <- er
+					return
+				}
+			}
+			complete = append(complete, minio.CompletePart{PartNumber: n, ETag: etag})
+			if read < uploadPartSize {
+				break
+			}
+		}
+		c, er := r.gatewayClient()
+		if er == nil {
+			er = c.CompleteMultipartUpload("io", key, session.UploadID, complete)
+		}
+		if er != nil {
+			reader.CloseWithError(er)
+			errs <- er
+			return
+		}
+		r.sessions.remove(p)
+		done <- true
+		close(done)
+	}()
+	return writer, done, errs, nil
+}
+
+// uploadPart sends one part, retrying with a new client after errors and network changes.
+func (r *remoteFS) uploadPart(ctx context.Context, session *UploadSession, n int, data []byte, sum []byte) (string, error) {
+	var lastErr error
+	for retry := 0; retry < uploadPartRetries; retry++ {
+		if retry > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Sending part %d of %s again: %s", n, session.Key, lastErr.Error()))
+			select {
+			case <-time.After(time.Duration(1<<uint(retry)) * time.Second):
+			case <-networkChanges():
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		client, e := r.gatewayClient()
+		if e != nil {
+			lastErr = e
+			continue
+		}
+		type result struct {
+			part minio.ObjectPart
+			err  error
+		}
+		res := make(chan result, 1)
+		changed := networkChanges()
+		go func() {
+			part, er := client.PutObjectPart("io", session.Key, session.UploadID, n, bytes.NewReader(data), int64(len(data)), base64.StdEncoding.EncodeToString(sum), "", nil)
+			res <- result{part: part, err: er}
+		}()
+		select {
+		case rs := <-res:
+			if rs.err == nil {
+				return strings.Trim(rs.part.ETag, "\""), nil
+			}
+			lastErr = rs.err
+		case <-changed:
+			lastErr = fmt.Errorf("network changed")
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	return "", lastErr
+}
@@ -21,7 +21,6 @@ package endpoint
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/url"
 	"os/user"
@@ -32,11 +31,11 @@ import (
 	"github.com/pydio/cells-sync/common"
 
 	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/endpoint/s3"
 
 	"github.com/pydio/cells/common/sync/endpoints/cells"
 	"github.com/pydio/cells/common/sync/endpoints/filesystem"
 	"github.com/pydio/cells/common/sync/endpoints/memory"
-	"github.com/pydio/cells/common/sync/endpoints/s3"
 	"github.com/pydio/cells/common/sync/model"
 )
 
@@ -64,11 +63,18 @@ func EndpointFromURI(uri string, otherUri string, browseOnly ...bool) (ep model.
 				path = filepath.Join(path, u.Path[3:])
 			}
 		}
-		return filesystem.NewFSClient(path, opts)
+		client, e := filesystem.NewFSClient(path, opts)
+		if e != nil || opts.BrowseOnly {
+			return client, e
+		}
+		return &localFS{FSClient: client, root: path, limits: PlatformPathLimits(), readOnly: IsReadOnlyFolder(path), expected: newExpectedChanges(path), hot: newHotPaths(DefaultHotDelay), foldCase: isCaseInsensitive(path)}, nil
 
 	case "db":
 		return memory.NewMemDB(), nil
 
+	case "plugin":
+		return newPluginEndpoint(uri)
+
 	case "router":
 		options := cells.Options{
 			EndpointOptions:   opts,
@@ -93,13 +99,16 @@ func EndpointFromURI(uri string, otherUri string, browseOnly ...bool) (ep model.
 		if auth == nil {
 			return nil, fmt.Errorf("cannot find authority")
 		}
+		if e := auth.VerifyCertificatePin(); e != nil {
+			return nil, e
+		}
 		// Warning, we use the ACCESSS TOKEN as IdToken
 		conf := cells.RemoteConfig{
-			Url:           fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+			Url:           strings.TrimRight(auth.BaseURL(), "/"),
 			IdToken:       auth.AccessToken,
 			RefreshToken:  auth.RefreshToken,
 			ExpiresAt:     auth.ExpiresAt,
-			SkipVerify:    auth.InsecureSkipVerify,
+			SkipVerify:    auth.InsecureSkipVerify || auth.CertificatePin != "",
 			CustomHeaders: map[string]string{"User-Agent": "cells-sync/" + common.Version},
 		}
 		options := cells.Options{
@@ -115,7 +124,10 @@ func EndpointFromURI(uri string, otherUri string, browseOnly ...bool) (ep model.
 						if acUrl.Scheme == u.Scheme && acUrl.Host == u.Host && aC.Authority.Username == u.User.Username() {
 							if aC.Type == "delete" {
 								return
-							} else {
+							} else if aC.Type != "expired" {
+								if aC.Type == "url" {
+									conf.Url = strings.TrimRight(aC.Authority.BaseURL(), "/")
+								}
 								conf.IdToken = aC.Authority.AccessToken
 								conf.RefreshToken = aC.Authority.RefreshToken
 								conf.ExpiresAt = aC.Authority.ExpiresAt
@@ -126,28 +138,16 @@ func EndpointFromURI(uri string, otherUri string, browseOnly ...bool) (ep model.
 				}
 			}()
 		}
-		return ep, nil
+		if opts.BrowseOnly {
+			return ep, nil
+		}
+		return &remoteFS{Remote: ep, uri: u}, nil
 
 	case "s3":
-		fullPath := u.Path
-		parts := strings.Split(fullPath, "/")
-		bucket := parts[1]
-		parts = parts[2:]
-		rootPath := strings.Join(parts, "/")
-		if u.User == nil {
-			return nil, errors.New("please provide API keys and secret in URL")
-		}
-		password, _ := u.User.Password()
-		values := u.Query()
-		normalize := values.Get("normalize") == "true"
-		secure := strings.Contains(u.Hostname(), "amazonaws.com") || values.Get("secure") == "true"
-		client, e := s3.NewClient(context.Background(), u.Host, u.User.Username(), password, bucket, rootPath, secure, opts)
+		client, e := s3.NewClient(context.Background(), uri, opts)
 		if e != nil {
 			return nil, e
 		}
-		if normalize {
-			client.ServerRequiresNormalization = true
-		}
 		return client, nil
 
 	default:
@@ -173,3 +173,17 @@ func DefaultDirForURI(uri string) string {
 	}
 	return ""
 }
+
+// LocalPathForURI returns the local folder of an "fs" endpoint URI.
+func LocalPathForURI(uri string) (string, bool) {
+	u, e := url.Parse(uri)
+	if e != nil || u.Scheme != "fs" || u.Path == "" {
+		return "", false
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" && len(p) > 2 && p[2] == ':' {
+		// Remove leading slash of /C:/path
+		p = p[1:]
+	}
+	return filepath.FromSlash(p), true
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"sync"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// holdMaxEvents is the number of paths buffered by a hold. Beyond, events are dropped and the whole task must be
+// resynced when the hold is released.
+const holdMaxEvents = 100000
+
+type heldEvent struct {
+	first model.EventInfo
+	last  model.EventInfo
+}
+
+// WatchHold buffers the events of local watchers while the user reorganizes a folder. Events are collapsed by
+// path, so that only the net result is processed when the hold is released: files created then removed are
+// forgotten, and the remaining creations and removals are sent together, to be paired as moves.
+type WatchHold struct {
+	lock     sync.Mutex
+	held     bool
+	order    []string
+	events   map[string]*heldEvent
+	overflow bool
+	release  chan []model.EventInfo
+}
+
+// NewWatchHold creates a hold, released by default.
+func NewWatchHold() *WatchHold {
+	return &WatchHold{release: make(chan []model.EventInfo, 1)}
+}
+
+// SetWatchHold installs a hold on the watcher of a local endpoint. It returns false if the endpoint is not local.
+func SetWatchHold(ep model.Endpoint, h *WatchHold) bool {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return false
+	}
+	c.hold = h
+	return true
+}
+
+// Hold starts buffering events. It returns false if events are already held.
+func (h *WatchHold) Hold() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.held {
+		return false
+	}
+	h.held = true
+	h.order = nil
+	h.events = make(map[string]*heldEvent)
+	h.overflow = false
+	return true
+}
+
+// Held tells if events are currently buffered.
+func (h *WatchHold) Held() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.held
+}
+
+// Count returns the number of paths changed since the hold started.
+func (h *WatchHold) Count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.events)
+}
+
+// Release forwards the net result of the buffered events to the watcher. It returns the number of events sent,
+// and overflow=true if events were dropped: the task must then be fully resynced.
+func (h *WatchHold) Release() (count int, overflow bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.held {
+		return 0, false
+	}
+	h.held = false
+	var events []model.EventInfo
+	seen := make(map[string]bool, len(h.events))
+	for _, p := range h.order {
+		held, ok := h.events[p]
+		if !ok || seen[p] {
+			continue
+		}
+		seen[p] = true
+		events = append(events, held.last)
+	}
+	overflow = h.overflow
+	h.order = nil
+	h.events = nil
+	if overflow {
+		return 0, true
+	}
+	select {
+	case h.release <- events:
+	default:
+		return 0, true
+	}
+	return len(events), false
+}
+
+// buffer records an event if events are held.
+func (h *WatchHold) buffer(ev model.EventInfo) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.held {
+		return false
+	}
+	if h.overflow {
+		return true
+	}
+	held, ok := h.events[ev.Path]
+	if !ok {
+		if len(h.events) >= holdMaxEvents {
+			h.overflow = true
+			h.order = nil
+			h.events = make(map[string]*heldEvent)
+			return true
+		}
+		h.events[ev.Path] = &heldEvent{first: ev, last: ev}
+		h.order = append(h.order, ev.Path)
+		return true
+	}
+	if held.first.Type == model.EventCreate && ev.Type == model.EventRemove {
+		// Temporary file, created and removed during the hold
+		delete(h.events, ev.Path)
+		return true
+	}
+	held.last = ev
+	return true
+}
+
+// gate returns a copy of the watch object that buffers events while the hold is active.
+func (h *WatchHold) gate(main *model.WatchObject) *model.WatchObject {
+	out := *main
+	out.EventInfoChan = make(chan model.EventInfo)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-main.EventInfoChan:
+				if !ok {
+					close(out.EventInfoChan)
+					return
+				}
+				if h.buffer(ev) {
+					continue
+				}
+				select {
+				case out.EventInfoChan <- ev:
+				case <-main.Done():
+					return
+				}
+			case events := <-h.release:
+				for _, ev := range events {
+					select {
+					case out.EventInfoChan <- ev:
+					case <-main.Done():
+						return
+					}
+				}
+			case <-main.Done():
+				return
+			}
+		}
+	}()
+	return &out
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/log"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// watchRestartDelay is the delay between two attempts to restart a failed watcher.
+	watchRestartDelay = 5 * time.Second
+	// rescanMargin is subtracted from the time of the last event received before a watcher error, to find the
+	// entries that may have been missed.
+	rescanMargin = 5 * time.Second
+)
+
+// WatcherMetrics counts the errors of the watchers of a local folder.
+type WatcherMetrics struct {
+	Errors       int64
+	Overflows    int64
+	Restarts     int64
+	Rescanned    int64
+	LastError    string    `json:",omitempty"`
+	LastOverflow time.Time `json:",omitempty"`
+}
+
+var watcherMetrics = struct {
+	sync.Mutex
+	roots map[string]*WatcherMetrics
+}{roots: make(map[string]*WatcherMetrics)}
+
+// WatcherMetricsFor returns the watcher counters of a local folder since the application started.
+func WatcherMetricsFor(root string) WatcherMetrics {
+	watcherMetrics.Lock()
+	defer watcherMetrics.Unlock()
+	if m, ok := watcherMetrics.roots[metricsKey(root)]; ok {
+		return *m
+	}
+	return WatcherMetrics{}
+}
+
+// recordWatcher updates the counters of a local folder.
+func recordWatcher(root string, update func(m *WatcherMetrics)) {
+	watcherMetrics.Lock()
+	defer watcherMetrics.Unlock()
+	m, ok := watcherMetrics.roots[metricsKey(root)]
+	if !ok {
+		m = &WatcherMetrics{}
+		watcherMetrics.roots[metricsKey(root)] = m
+	}
+	update(m)
+}
+
+// metricsKey normalizes a root, that may start with a slash before the volume name on Windows.
+func metricsKey(root string) string {
+	return strings.TrimLeft(filepath.ToSlash(root), "/")
+}
+
+// isOverflow checks if a watcher error reports dropped events.
+func isOverflow(e error) bool {
+	return strings.Contains(strings.ToLower(e.Error()), "overflow")
+}
+
+// superviseWatch forwards the events of a watcher of the folder base, restricted to sub. When the watcher reports
+// an error (like a queue overflow), events may have been lost: it is restarted and the subtree is rescanned,
+// sending an event for each entry modified since the last event received, and for each cached file that disappeared.
+func (c *localFS) superviseWatch(first *model.WatchObject, base, sub string, start func() (*model.WatchObject, error)) *model.WatchObject {
+	out := &model.WatchObject{
+		EventInfoChan: make(chan model.EventInfo),
+		ErrorChan:     make(chan error),
+		DoneChan:      make(chan bool),
+	}
+	go func() {
+		ctx := context.Background()
+		current := first
+		lastEvent := time.Now()
+		for {
+			select {
+			case ev, ok := <-current.Events():
+				if !ok {
+					return
+				}
+				lastEvent = time.Now()
+				select {
+				case out.EventInfoChan <- ev:
+				case <-out.Done():
+					current.Close()
+					return
+				}
+			case err, ok := <-current.Errors():
+				if !ok {
+					return
+				}
+				log.Logger(ctx).Error("Watcher error on " + base + ", restarting it and rescanning: " + err.Error())
+				recordWatcher(c.root, func(m *WatcherMetrics) {
+					m.Errors++
+					m.LastError = err.Error()
+					if isOverflow(err) {
+						m.Overflows++
+						m.LastOverflow = time.Now()
+					}
+				})
+				select {
+				case out.ErrorChan <- err:
+				default:
+				}
+				current.Close()
+				if current = c.restartWatch(out, start); current == nil {
+					return
+				}
+				recordWatcher(c.root, func(m *WatcherMetrics) { m.Restarts++ })
+				count := c.rescanSubtree(out, base, sub, lastEvent.Add(-rescanMargin))
+				recordWatcher(c.root, func(m *WatcherMetrics) { m.Rescanned += int64(count) })
+				log.Logger(ctx).Info(fmt.Sprintf("Watcher restarted on %s, %d entries rescanned", base, count))
+			case <-out.Done():
+				current.Close()
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// restartWatch starts a new watcher, retrying until it succeeds or the watch is closed.
+func (c *localFS) restartWatch(out *model.WatchObject, start func() (*model.WatchObject, error)) *model.WatchObject {
+	for {
+		w, e := start()
+		if e == nil {
+			return w
+		}
+		log.Logger(context.Background()).Error("Cannot restart watcher: " + e.Error())
+		select {
+		case <-time.After(watchRestartDelay):
+		case <-out.Done():
+			return nil
+		}
+	}
+}
+
+// rescanSubtree sends the events that may have been missed by a failed watcher of the folder base. It returns the
+// number of events sent. Folders that disappeared are reported too when their identity is known, so that they are
+// paired with the folder found at their new path into a move.
+func (c *localFS) rescanSubtree(out *model.WatchObject, base, sub string, since time.Time) (count int) {
+	send := func(ev model.EventInfo) bool {
+		select {
+		case out.EventInfoChan <- ev:
+			count++
+			return true
+		case <-out.Done():
+			return false
+		}
+	}
+	root := filepath.Join(base, filepath.FromSlash(strings.Trim(sub, "/")))
+	var stop bool
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		if info.ModTime().Before(since) && !c.unknownFolder(p, info) {
+			return nil
+		}
+		rel, er := filepath.Rel(base, p)
+		if er != nil {
+			return nil
+		}
+		stop = !send(model.EventInfo{
+			Time:   info.ModTime().Format(time.RFC3339),
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			Folder: info.IsDir(),
+			Type:   model.EventCreate,
+			Source: c,
+		})
+		if stop {
+			return io.EOF
+		}
+		return nil
+	})
+	if stop || c.hashes == nil {
+		return
+	}
+	// Deleted files are only known if they were cached
+	prefix, e := filepath.Rel(c.root, root)
+	if e != nil {
+		return
+	}
+	for _, p := range c.hashes.pathsUnder(filepath.ToSlash(prefix)) {
+		if _, e := os.Stat(c.abs(p)); !os.IsNotExist(e) {
+			continue
+		}
+		rel, er := filepath.Rel(base, c.abs(p))
+		if er != nil {
+			continue
+		}
+		if !send(model.EventInfo{Time: time.Now().Format(time.RFC3339), Path: filepath.ToSlash(rel), Type: model.EventRemove, Source: c}) {
+			return
+		}
+	}
+	for _, p := range c.hashes.foldersUnder(filepath.ToSlash(prefix)) {
+		if _, e := os.Stat(c.abs(p)); !os.IsNotExist(e) {
+			continue
+		}
+		rel, er := filepath.Rel(base, c.abs(p))
+		if er != nil {
+			continue
+		}
+		if !send(model.EventInfo{Time: time.Now().Format(time.RFC3339), Path: filepath.ToSlash(rel), Folder: true, Type: model.EventRemove, Source: c}) {
+			return
+		}
+	}
+	return
+}
+
+// unknownFolder checks if p is a folder carrying a marker, whose identity is not recorded at this path: a folder
+// moved here keeps its modification time, but must still be reported.
+func (c *localFS) unknownFolder(p string, info os.FileInfo) bool {
+	if c.hashes == nil || !info.IsDir() {
+		return false
+	}
+	rel, e := filepath.Rel(c.root, p)
+	if e != nil {
+		return false
+	}
+	return c.hashes.folderUuid(filepath.ToSlash(rel)) == "" && folderIdentity(p) != ""
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/pydio/cells/common/proto/tree"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+const (
+	// WorkspaceQueryKey is the URI query parameter storing the workspace UUID, as slugs of Cells (shared rooms)
+	// may change over time.
+	WorkspaceQueryKey = "ws"
+
+	WorkspaceScopeRoom = "ROOM"
+)
+
+// ErrWorkspaceUnavailable is returned when a workspace cannot be found anymore in the user workspaces,
+// e.g. a room was deleted or the user was removed from it.
+var ErrWorkspaceUnavailable = errors.New("workspace is not available anymore on the server")
+
+// WorkspaceInfo describes a workspace root as listed by the remote server.
+type WorkspaceInfo struct {
+	Uuid  string
+	Slug  string
+	Label string
+	Scope string
+	// Permissions of the current user on the workspace: "r", "w" or "rw"
+	Permissions string
+}
+
+// ReadOnly checks if the current user cannot write to this workspace.
+func (w WorkspaceInfo) ReadOnly() bool {
+	return w.Permissions != "" && !strings.Contains(w.Permissions, "w")
+}
+
+// workspaceInfoFromNode reads the workspace metadata attached to the root nodes of a remote server.
+func workspaceInfoFromNode(p string, node *tree.Node) (WorkspaceInfo, bool) {
+	info := WorkspaceInfo{Slug: strings.Trim(p, "/")}
+	node.GetMeta("ws_uuid", &info.Uuid)
+	node.GetMeta("ws_label", &info.Label)
+	node.GetMeta("ws_scope", &info.Scope)
+	node.GetMeta("ws_permissions", &info.Permissions)
+	return info, info.Uuid != ""
+}
+
+// ListWorkspaces lists the workspaces (including Cells and templated paths like personal folders) accessible
+// on the remote server of the given URI.
+func ListWorkspaces(uri string) ([]WorkspaceInfo, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return nil, e
+	}
+	u.Path = ""
+	u.RawQuery = ""
+	ep, e := EndpointFromURI(u.String(), "", true)
+	if e != nil {
+		return nil, e
+	}
+	source, ok := model.AsPathSyncSource(ep)
+	if !ok {
+		return nil, errors.New("cannot list workspaces on this endpoint")
+	}
+	var workspaces []WorkspaceInfo
+	e = source.Walk(func(p string, node *tree.Node, err error) {
+		if err != nil || node.IsLeaf() || strings.Contains(strings.Trim(p, "/"), "/") {
+			return
+		}
+		if info, ok := workspaceInfoFromNode(p, node); ok {
+			workspaces = append(workspaces, info)
+		}
+	}, "/", false)
+	return workspaces, e
+}
+
+// ResolveWorkspaceURI finds the current slug of the workspace referenced in a remote URI, and returns an
+// updated URI if it has changed. It returns ErrWorkspaceUnavailable if the workspace cannot be found anymore.
+// URIs without workspace reference are returned untouched.
+func ResolveWorkspaceURI(uri string) (string, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return uri, e
+	}
+	wsUuid := u.Query().Get(WorkspaceQueryKey)
+	if (u.Scheme != "http" && u.Scheme != "https") || wsUuid == "" {
+		return uri, nil
+	}
+	workspaces, e := ListWorkspaces(uri)
+	if e != nil {
+		return uri, e
+	}
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	for _, ws := range workspaces {
+		if ws.Uuid != wsUuid {
+			continue
+		}
+		if ws.Slug == parts[0] {
+			return uri, nil
+		}
+		parts[0] = ws.Slug
+		u.Path = "/" + strings.Join(parts, "/")
+		return u.String(), nil
+	}
+	return uri, ErrWorkspaceUnavailable
+}
+
+// AnnotateWorkspaceURI adds the workspace UUID to a remote URI, so that the task keeps working if the workspace
+// slug changes. URIs that are already annotated or that cannot be resolved are returned untouched.
+func AnnotateWorkspaceURI(uri string) string {
+	u, e := url.Parse(uri)
+	if e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Query().Get(WorkspaceQueryKey) != "" {
+		return uri
+	}
+	slug := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)[0]
+	if slug == "" {
+		return uri
+	}
+	workspaces, e := ListWorkspaces(uri)
+	if e != nil {
+		return uri
+	}
+	for _, ws := range workspaces {
+		if ws.Slug == slug {
+			q := u.Query()
+			q.Set(WorkspaceQueryKey, ws.Uuid)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return uri
+}
+
+// WorkspaceForURI finds the workspace a remote URI points to.
+func WorkspaceForURI(uri string) (WorkspaceInfo, error) {
+	u, e := url.Parse(uri)
+	if e != nil {
+		return WorkspaceInfo{}, e
+	}
+	slug := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)[0]
+	wsUuid := u.Query().Get(WorkspaceQueryKey)
+	workspaces, e := ListWorkspaces(uri)
+	if e != nil {
+		return WorkspaceInfo{}, e
+	}
+	for _, ws := range workspaces {
+		if (wsUuid != "" && ws.Uuid == wsUuid) || (wsUuid == "" && ws.Slug == slug) {
+			return ws, nil
+		}
+	}
+	return WorkspaceInfo{}, ErrWorkspaceUnavailable
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package endpoint
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// JournalTempPrefix marks the temporary files written by the engine before they are moved in place.
+const JournalTempPrefix = ".cells-sync-tmp-"
+
+const (
+	journalBegin  = "begin"
+	journalReady  = "ready"
+	journalCommit = "commit"
+)
+
+// journalRecord is a line of the write journal.
+type journalRecord struct {
+	Op    string
+	Id    int64
+	Temp  string `json:",omitempty"`
+	Final string `json:",omitempty"`
+	Hash  string `json:",omitempty"`
+}
+
+// WriteJournal is a write-ahead journal of local file writes. Contents are written to a temporary file next to
+// the target, which is only moved in place once fully written and flushed to disk. Each step is recorded and
+// synced before it is applied, so that after a power loss the target is either the previous or the new complete
+// version: temporary files are removed, or moved in place if they were complete.
+type WriteJournal struct {
+	sync.Mutex
+	root   string
+	file   string
+	f      *os.File
+	nextId int64
+	open   map[int64]*journalRecord
+	// Recovered counts the writes of a previous run that were recovered when opening the journal
+	Recovered RecoveryReport
+}
+
+// RecoveryReport counts the writes that were interrupted and how they were recovered.
+type RecoveryReport struct {
+	RolledBack    int
+	RolledForward int
+}
+
+// SetWriteJournal makes writes on a local endpoint go through a journal stored in journalFile. Writes that were
+// interrupted in a previous run are recovered first. It returns nil if the endpoint is not local.
+func SetWriteJournal(ep model.Endpoint, journalFile string) (*WriteJournal, error) {
+	c, ok := ep.(*localFS)
+	if !ok {
+		return nil, nil
+	}
+	j := &WriteJournal{root: c.root, file: journalFile, open: make(map[int64]*journalRecord)}
+	if e := j.recover(); e != nil {
+		return nil, e
+	}
+	var e error
+	if j.f, e = os.OpenFile(journalFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); e != nil {
+		return nil, e
+	}
+	c.journal = j
+	return j, nil
+}
+
+func (j *WriteJournal) abs(p string) string {
+	return filepath.Join(j.root, filepath.FromSlash(strings.TrimLeft(p, "/")))
+}
+
+// recover replays the journal left by a previous run.
+func (j *WriteJournal) recover() error {
+	report := &j.Recovered
+	f, e := os.Open(j.file)
+	if os.IsNotExist(e) {
+		return nil
+	} else if e != nil {
+		return e
+	}
+	defer f.Close()
+	entries := make(map[int64]*journalRecord)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r journalRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			// Last line may be truncated
+			continue
+		}
+		switch r.Op {
+		case journalBegin:
+			entries[r.Id] = &r
+		case journalReady:
+			if b, ok := entries[r.Id]; ok {
+				b.Op, b.Hash = journalReady, r.Hash
+			}
+		case journalCommit:
+			delete(entries, r.Id)
+		}
+	}
+	for _, r := range entries {
+		temp, final := j.abs(r.Temp), j.abs(r.Final)
+		if r.Op == journalReady {
+			if h, e := fileMD5(temp); e == nil && h == r.Hash {
+				if e := os.Rename(temp, final); e != nil {
+					return e
+				}
+				report.RolledForward++
+				continue
+			}
+			if h, e := fileMD5(final); e == nil && h == r.Hash {
+				// Move was applied, only the commit record is missing
+				continue
+			}
+		}
+		if e := os.Remove(temp); e != nil && !os.IsNotExist(e) {
+			return e
+		}
+		report.RolledBack++
+	}
+	return nil
+}
+
+// append writes a record and flushes it to disk.
+func (j *WriteJournal) append(r *journalRecord) error {
+	data, e := json.Marshal(r)
+	if e != nil {
+		return e
+	}
+	if _, e := j.f.Write(append(data, '\n')); e != nil {
+		return e
+	}
+	return j.f.Sync()
+}
+
+// begin records a new write and returns the temporary path to write to.
+func (j *WriteJournal) begin(p string) (*journalRecord, error) {
+	j.Lock()
+	defer j.Unlock()
+	j.nextId++
+	r := &journalRecord{
+		Op:    journalBegin,
+		Id:    j.nextId,
+		Temp:  path.Join(path.Dir(p), fmt.Sprintf("%s%d-%d-%s", JournalTempPrefix, time.Now().UnixNano(), j.nextId, path.Base(p))),
+		Final: p,
+	}
+	if e := j.append(r); e != nil {
+		return nil, e
+	}
+	j.open[r.Id] = r
+	return r, nil
+}
+
+// finish flushes the temporary file, records it as ready with its hash, moves it in place and records the commit.
+func (j *WriteJournal) finish(r *journalRecord, hash string) error {
+	temp, final := j.abs(r.Temp), j.abs(r.Final)
+	flag := os.O_RDWR
+	if hash == EmptyEtag {
+		// Nothing was written for a zero-byte file, the temporary file may not exist
+		flag |= os.O_CREATE
+	}
+	if f, e := os.OpenFile(temp, flag, 0644); e == nil {
+		f.Sync()
+		f.Close()
+	}
+	j.Lock()
+	defer j.Unlock()
+	if e := j.append(&journalRecord{Op: journalReady, Id: r.Id, Hash: hash}); e != nil {
+		return e
+	}
+	if e := os.Rename(temp, final); e != nil {
+		return e
+	}
+	syncDir(filepath.Dir(final))
+	if e := j.append(&journalRecord{Op: journalCommit, Id: r.Id}); e != nil {
+		return e
+	}
+	delete(j.open, r.Id)
+	if len(j.open) == 0 {
+		// Nothing in progress, compact the journal
+		if e := j.f.Truncate(0); e == nil {
+			j.f.Seek(0, io.SeekStart)
+		}
+	}
+	return nil
+}
+
+// Close closes the journal file. Writes in progress are recovered at next start.
+func (j *WriteJournal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	return j.f.Close()
+}
+
+// syncDir flushes a directory entry after a rename. It is not supported on all platforms.
+func syncDir(dir string) {
+	if d, e := os.Open(dir); e == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// hashingWriter computes the MD5 of the contents written to a journaled file.
+type hashingWriter struct {
+	io.WriteCloser
+	h hash.Hash
+}
+
+func (w *hashingWriter) Write(p []byte) (int, error) {
+	n, e := w.WriteCloser.Write(p)
+	w.h.Write(p[:n])
+	return n, e
+}
+
+func (w *hashingWriter) sum() string {
+	return hex.EncodeToString(w.h.Sum(nil))
+}
+
+// finishingWriter finishes the journal entry on Close, when the client does not provide a done channel.
+type finishingWriter struct {
+	*hashingWriter
+	finish func() error
+}
+
+func (w *finishingWriter) Close() error {
+	if e := w.hashingWriter.Close(); e != nil {
+		return e
+	}
+	return w.finish()
+}
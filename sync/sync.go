@@ -0,0 +1,331 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package sync embeds the Cells Sync engine in other Go applications, e.g. NAS firmwares or custom agents, without
+// the user interface, the system tray and the control layer of the desktop client.
+//
+// A Task synchronizes two endpoints given by their URI: a local folder (fs:///path/to/folder) or a folder of a
+// Cells server (https://host/workspace/path), whose account must be registered in the Cells Sync configuration.
+// Each pass scans both sides, computes their differences against the snapshots of the previous pass, merges them
+// into a patch and processes it: Diff stops before processing, to preview the changes of a pass, Run applies them.
+// The desktop client prepares its endpoints with the same ParseDirection and OpenEndpoints functions.
+//
+//	task, e := sync.NewTask(sync.Options{
+//		LeftURI:   "fs:///data/share",
+//		RightURI:  "https://cells.example.com/personal-files/share",
+//		StatePath: "/var/lib/agent/share",
+//	})
+//	if e != nil {
+//		return e
+//	}
+//	defer task.Close()
+//	go func() {
+//		for event := range task.Events() {
+//			log.Println(event)
+//		}
+//	}()
+//	return task.Run(ctx)
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	gosync "sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+	"github.com/pydio/cells/common/sync/task"
+
+	"github.com/pydio/cells-sync/common"
+	"github.com/pydio/cells-sync/endpoint"
+)
+
+// Directions of a task, with the same values as the tasks of the desktop client.
+const (
+	// DirectionBi propagates changes both ways.
+	DirectionBi = "Bi"
+	// DirectionLeft propagates changes from the left endpoint to the right one.
+	DirectionLeft = "Left"
+	// DirectionRight propagates changes from the right endpoint to the left one.
+	DirectionRight = "Right"
+)
+
+// eventsBuffer is the number of events kept for a slow reader of Events before new ones are dropped.
+const eventsBuffer = 100
+
+// Options configure a Task.
+type Options struct {
+	// LeftURI and RightURI are the endpoints to synchronize
+	LeftURI  string
+	RightURI string
+	// Direction is DirectionBi by default
+	Direction string
+	// StatePath is the folder storing the snapshots of the task, it is created if needed
+	StatePath string
+	// SelectiveRoots restricts the sync to these folders
+	SelectiveRoots []string
+	// Ignores are gitignore-like patterns excluded from the sync, in addition to endpoint.DefaultIgnores
+	Ignores []string
+	// Watch keeps processing changes in real time after the first pass, until Run context is cancelled
+	Watch bool
+}
+
+// EventType tells which field of an Event is set.
+type EventType int
+
+const (
+	// EventStatus reports the progress of a pass in Status.
+	EventStatus EventType = iota
+	// EventDone is sent at the end of a pass, with the processed operations in Patch.
+	EventDone
+	// EventEndpoint reports a change of connection or activity of an endpoint in Endpoint.
+	EventEndpoint
+)
+
+// Event is sent by a Task while it runs.
+type Event struct {
+	Type     EventType
+	Status   model.Status
+	Patch    merger.Patch
+	Endpoint *model.EndpointStatus
+}
+
+// String implements Stringer interface.
+func (e *Event) String() string {
+	switch e.Type {
+	case EventStatus:
+		return "Status: " + e.Status.String()
+	case EventDone:
+		if e.Patch == nil {
+			return "Pass done"
+		}
+		return fmt.Sprintf("Pass done, %d operation(s)", e.Patch.Size())
+	case EventEndpoint:
+		return "Endpoint " + e.Endpoint.EndpointInfo.URI + " changed"
+	}
+	return ""
+}
+
+// Task synchronizes two endpoints. It is created with NewTask, and released with Close.
+type Task struct {
+	opts      Options
+	sync      *task.Sync
+	snapshots model.SnapshotFactory
+	cmd       *model.Command
+
+	status   chan model.Status
+	done     chan interface{}
+	internal chan interface{}
+	passDone chan interface{}
+	events   chan *Event
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	lock     gosync.Mutex
+	passLock gosync.Mutex
+	started  bool
+	closed   bool
+}
+
+// ParseDirection converts the direction of a task configuration, DirectionBi if empty.
+func ParseDirection(direction string) (model.DirectionType, error) {
+	switch direction {
+	case DirectionBi, "":
+		return model.DirectionBi, nil
+	case DirectionLeft:
+		return model.DirectionLeft, nil
+	case DirectionRight:
+		return model.DirectionRight, nil
+	}
+	return model.DirectionBi, fmt.Errorf("unsupported direction type %s, please use one of Bi, Left, Right", direction)
+}
+
+// OpenEndpoints opens the left and right endpoints of a task from their URIs.
+func OpenEndpoints(leftURI, rightURI string) (left model.Endpoint, right model.Endpoint, e error) {
+	if leftURI == "" || rightURI == "" {
+		return nil, nil, fmt.Errorf("invalid arguments: please provide left and right endpoints using a valid URI")
+	}
+	if left, e = endpoint.EndpointFromURI(leftURI, rightURI); e != nil {
+		return nil, nil, errors.Wrap(e, "cannot start left endpoint")
+	}
+	if right, e = endpoint.EndpointFromURI(rightURI, leftURI); e != nil {
+		return nil, nil, errors.Wrap(e, "cannot start right endpoint")
+	}
+	return left, right, nil
+}
+
+// NewTask opens both endpoints and the snapshots of a task. Snapshots written by a previous release are upgraded
+// to the current schema.
+func NewTask(opts Options) (*Task, error) {
+	if opts.StatePath == "" {
+		return nil, fmt.Errorf("please provide a folder to store the task state")
+	}
+	direction, e := ParseDirection(opts.Direction)
+	if e != nil {
+		return nil, e
+	}
+	if e := endpoint.ValidateIgnorePatterns(opts.Ignores); e != nil {
+		return nil, e
+	}
+	left, right, e := OpenEndpoints(opts.LeftURI, opts.RightURI)
+	if e != nil {
+		return nil, e
+	}
+	if e := os.MkdirAll(opts.StatePath, 0755); e != nil {
+		return nil, e
+	}
+	if _, e := endpoint.MigrateSnapshots(opts.StatePath, common.Version); e != nil {
+		return nil, e
+	}
+
+	t := &Task{
+		opts:     opts,
+		sync:     task.NewSync(left, right, direction),
+		cmd:      model.NewCommand(),
+		status:   make(chan model.Status),
+		done:     make(chan interface{}),
+		internal: make(chan interface{}),
+		passDone: make(chan interface{}, 1),
+		events:   make(chan *Event, eventsBuffer),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	t.snapshots = endpoint.NewSnapshotFactory(opts.StatePath, left, right)
+	t.sync.SetupCmd(t.cmd)
+	t.sync.SetupEventsChan(t.status, t.done, t.internal)
+	t.sync.SetSnapshotFactory(t.snapshots)
+	t.sync.SetFilters(opts.SelectiveRoots, append(append([]string{}, endpoint.DefaultIgnores...), opts.Ignores...))
+	go t.dispatch()
+	return t, nil
+}
+
+// Events returns the channel receiving the events of the task. It is closed by Close. Events are dropped when
+// the channel is full, it should be read continuously.
+func (t *Task) Events() <-chan *Event {
+	return t.events
+}
+
+// Diff scans both endpoints and returns the patch that the next pass would process, without applying it.
+func (t *Task) Diff(ctx context.Context) (merger.Patch, error) {
+	return t.pass(ctx, true)
+}
+
+// Run processes a full pass, and returns the first error of its operations, if any. With Options.Watch, changes
+// are then processed as they happen until ctx is cancelled.
+func (t *Task) Run(ctx context.Context) error {
+	patch, e := t.pass(ctx, false)
+	if e != nil {
+		return e
+	}
+	if patch != nil {
+		if errs, has := patch.HasErrors(); has {
+			return fmt.Errorf("%d operation(s) failed, first error: %v", len(errs), errs[0])
+		}
+	}
+	if !t.opts.Watch {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// pass starts the engine on first use, then runs one pass and waits for its patch.
+func (t *Task) pass(ctx context.Context, dryRun bool) (merger.Patch, error) {
+	t.passLock.Lock()
+	defer t.passLock.Unlock()
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return nil, fmt.Errorf("task is closed")
+	}
+	if !t.started {
+		t.sync.Start(context.Background(), t.opts.Watch)
+		t.started = true
+	}
+	t.lock.Unlock()
+
+	// Forget a pass triggered by the watchers in the meantime
+	select {
+	case <-t.passDone:
+	default:
+	}
+	t.sync.Run(ctx, dryRun, true)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case data := <-t.passDone:
+		patch, _ := data.(merger.Patch)
+		return patch, nil
+	}
+}
+
+// Close stops the engine, releases the snapshots of the task and closes the events channel. Run must have
+// returned.
+func (t *Task) Close() error {
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return nil
+	}
+	t.closed = true
+	started := t.started
+	t.lock.Unlock()
+	if started {
+		t.sync.Shutdown()
+	}
+	close(t.stop)
+	<-t.stopped
+	t.cmd.Stop()
+	close(t.events)
+	return t.snapshots.Close(context.Background())
+}
+
+// dispatch translates the engine channels into events.
+func (t *Task) dispatch() {
+	defer close(t.stopped)
+	for {
+		select {
+		case status := <-t.status:
+			t.publish(&Event{Type: EventStatus, Status: status})
+		case data := <-t.done:
+			patch, _ := data.(merger.Patch)
+			t.publish(&Event{Type: EventDone, Patch: patch})
+			select {
+			case t.passDone <- data:
+			default:
+			}
+		case data := <-t.internal:
+			if status, ok := data.(*model.EndpointStatus); ok {
+				t.publish(&Event{Type: EventEndpoint, Endpoint: status})
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *Task) publish(event *Event) {
+	select {
+	case t.events <- event:
+	default:
+	}
+}
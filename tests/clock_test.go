@@ -0,0 +1,171 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tests
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pydio/cells-sync/config"
+	"github.com/pydio/cells-sync/control"
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/model"
+)
+
+// failAfter bounds the real time waited for a message, so that a broken test fails instead of hanging.
+const failAfter = 5 * time.Second
+
+func TestSimulatedClock(t *testing.T) {
+
+	Convey("Test timers and tickers of a simulated clock", t, func() {
+
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := config.NewSimulatedClock(start)
+
+		timer := clock.NewTimer(10 * time.Minute)
+		clock.Advance(9 * time.Minute)
+		So(clock.Now(), ShouldEqual, start.Add(9*time.Minute))
+		select {
+		case <-timer.C():
+			t.Fatal("timer fired before its deadline")
+		default:
+		}
+		clock.Advance(time.Minute)
+		So(<-timer.C(), ShouldEqual, start.Add(10*time.Minute))
+		So(timer.Stop(), ShouldBeFalse)
+
+		Convey("Test ticker firing on each period", func() {
+			ticker := clock.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for i := 1; i <= 3; i++ {
+				clock.Advance(time.Minute)
+				So(<-ticker.C(), ShouldEqual, start.Add(time.Duration(10+i)*time.Minute))
+			}
+		})
+
+		Convey("Test stopped and reset functions", func() {
+			var calls int32
+			f := clock.AfterFunc(time.Hour, func() { atomic.AddInt32(&calls, 1) })
+			So(f.Stop(), ShouldBeTrue)
+			clock.Advance(2 * time.Hour)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 0)
+			f.Reset(time.Minute)
+			clock.Advance(time.Minute)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestSchedulerOnSimulatedClock(t *testing.T) {
+
+	Convey("Test task loop interval on a simulated clock", t, func() {
+
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := config.NewSimulatedClock(start)
+		previous := config.GetClock()
+		config.SetClock(clock)
+		defer config.SetClock(previous)
+
+		task := &config.Task{
+			Uuid:         "scheduler-clock-test",
+			Label:        "Scheduler Test",
+			LoopInterval: "R/2020-01-01T00:00:00Z/PT10M",
+		}
+		messages := control.GetBus().Sub(control.TopicSync_ + task.Uuid)
+		defer control.GetBus().Unsub(messages)
+		scheduler := control.NewScheduler([]*config.Task{task})
+		go scheduler.Serve()
+		defer scheduler.Stop()
+
+		// Loop timer and pending rescans ticker
+		clock.BlockUntil(2)
+		clock.Advance(9 * time.Minute)
+		select {
+		case <-messages:
+			t.Fatal("loop triggered before its interval")
+		default:
+		}
+		for i := 0; i < 2; i++ {
+			clock.Advance(time.Minute)
+			select {
+			case m := <-messages:
+				So(m, ShouldEqual, control.MessageSyncLoop)
+			case <-time.After(failAfter):
+				t.Fatal("loop was not triggered")
+			}
+			// Wait for the next loop timer
+			clock.BlockUntil(2)
+			clock.Advance(9 * time.Minute)
+		}
+	})
+}
+
+func TestDebounceOnSimulatedClock(t *testing.T) {
+
+	Convey("Test events debouncing on a simulated clock", t, func() {
+
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := config.NewSimulatedClock(start)
+		previous := config.GetClock()
+		config.SetClock(clock)
+		defer config.SetClock(previous)
+
+		main := &model.WatchObject{
+			EventInfoChan: make(chan model.EventInfo),
+			ErrorChan:     make(chan error),
+			DoneChan:      make(chan bool),
+		}
+		defer close(main.DoneChan)
+		out := endpoint.DebounceEvents(main, 5*time.Second)
+		noEvent := func() {
+			select {
+			case <-out.Events():
+				t.Fatal("events forwarded while folder is not quiet")
+			default:
+			}
+		}
+
+		main.EventInfoChan <- model.EventInfo{Path: "a"}
+		clock.BlockUntil(1)
+		clock.Advance(4 * time.Second)
+		noEvent()
+
+		// New event postpones the flush to 5 seconds after it
+		main.EventInfoChan <- model.EventInfo{Path: "b"}
+		clock.BlockUntilDeadline(start.Add(9 * time.Second))
+		clock.Advance(4 * time.Second)
+		noEvent()
+
+		clock.Advance(time.Second)
+		var paths []string
+		for len(paths) < 2 {
+			select {
+			case ev := <-out.Events():
+				paths = append(paths, ev.Path)
+			case <-time.After(failAfter):
+				t.Fatal("events were not forwarded after the quiet period")
+			}
+		}
+		So(paths, ShouldResemble, []string{"a", "b"})
+	})
+}
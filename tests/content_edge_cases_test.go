@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tests
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/proto/tree"
+)
+
+func TestContentEdgeCases(t *testing.T) {
+
+	Convey("Test etag of zero-byte files", t, func() {
+		for _, etag := range []string{"", "-1", "\"\"", "temporary"} {
+			node := &tree.Node{Path: "empty.txt", Type: tree.NodeType_LEAF, Etag: etag}
+			endpoint.NormalizeEmptyFile(node)
+			So(node.Etag, ShouldEqual, endpoint.EmptyEtag)
+		}
+		folder := &tree.Node{Path: "folder", Type: tree.NodeType_COLLECTION}
+		endpoint.NormalizeEmptyFile(folder)
+		So(folder.Etag, ShouldBeEmpty)
+		file := &tree.Node{Path: "file.txt", Type: tree.NodeType_LEAF, Size: 3, Etag: "-1"}
+		endpoint.NormalizeEmptyFile(file)
+		So(file.Etag, ShouldEqual, "-1")
+	})
+
+	Convey("Test byte order mark changes", t, func() {
+		text := []byte("hello")
+		utf8 := append([]byte{0xEF, 0xBB, 0xBF}, text...)
+		stripped, encoding := endpoint.StripBOM(utf8)
+		So(string(stripped), ShouldEqual, "hello")
+		So(encoding, ShouldEqual, "utf-8")
+
+		So(endpoint.BOMOnlyChange(text, utf8), ShouldBeTrue)
+		So(endpoint.BOMOnlyChange(utf8, text), ShouldBeTrue)
+		So(endpoint.BOMOnlyChange(text, text), ShouldBeFalse)
+		So(endpoint.BOMOnlyChange(utf8, append([]byte{0xEF, 0xBB, 0xBF}, []byte("world")...)), ShouldBeFalse)
+
+		utf16 := []byte{0xFF, 0xFE, 'h', 0, 'i', 0}
+		_, encoding = endpoint.StripBOM(utf16)
+		So(encoding, ShouldEqual, "utf-16le")
+		utf32 := []byte{0xFF, 0xFE, 0, 0, 'h', 0, 0, 0}
+		_, encoding = endpoint.StripBOM(utf32)
+		So(encoding, ShouldEqual, "utf-32le")
+		So(endpoint.BOMOnlyChange(utf16, []byte{'h', 0, 'i', 0}), ShouldBeTrue)
+	})
+
+	Convey("Test hashes recorded within the modification time resolution", t, func() {
+		mtime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		// Same size content written again in the same second keeps the same modification time
+		So(endpoint.RacyHash(mtime, mtime.Add(500*time.Millisecond)), ShouldBeTrue)
+		So(endpoint.RacyHash(mtime, mtime.Add(endpoint.MTimeGranularity)), ShouldBeTrue)
+		So(endpoint.RacyHash(mtime, mtime.Add(time.Minute)), ShouldBeFalse)
+		So(endpoint.RacyHash(mtime, time.Time{}), ShouldBeFalse)
+	})
+
+}
@@ -0,0 +1,43 @@
+// +build go1.18
+
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tests
+
+import "testing"
+
+// FuzzBidirectionalSync generates random concurrent mutations on two in-memory endpoints, runs the full sync
+// engine, and checks that both sides converge without losing data. Run it with:
+//
+//	go test ./tests -run '^$' -fuzz FuzzBidirectionalSync -fuzztime 10m
+//
+// Failing inputs are stored in testdata/fuzz/FuzzBidirectionalSync and replayed by "go test".
+func FuzzBidirectionalSync(f *testing.F) {
+	for _, seed := range propertySeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 65 {
+			// Keep sequences short enough for each run to finish quickly
+			data = data[:65]
+		}
+		checkProperties(t, data)
+	})
+}
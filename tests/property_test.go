@@ -0,0 +1,330 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tests
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/pydio/cells-sync/endpoint"
+	"github.com/pydio/cells/common/sync/endpoints/filesystem"
+	"github.com/pydio/cells/common/sync/merger"
+	"github.com/pydio/cells/common/sync/model"
+	"github.com/pydio/cells/common/sync/task"
+)
+
+// Mutations are decoded from a byte string, 4 bytes per operation, so that the fuzzer can explore them. The first
+// byte gives the number of operations applied to the left side before the initial sync, the following ones are
+// applied on both sides between two syncs, as if users were working concurrently.
+const (
+	opWrite = iota
+	opDelete
+	opDeleteFolder
+	opMove
+	opMkdir
+	opCount
+
+	maxPropertyRuns = 3
+)
+
+// propertyPaths is a small pool of paths, so that random operations often hit the same files and folders.
+var propertyPaths = []string{"a.txt", "b.txt", "c.txt", "d/a.txt", "d/b.txt", "d/e/c.txt", "f/a.txt", "f/g/b.txt"}
+
+// propertySeeds are mutation sequences without concurrent changes of the same file, that the engine must handle.
+var propertySeeds = [][]byte{
+	{0, 0, 0, 0, 0, 1, 0, 1, 0},
+	{2, 0, 0, 3, 0, 0, 0, 5, 0, 1, 1, 3, 0, 0, 0, 0, 0},
+	{3, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 6, 0, 0, 3, 0, 1, 1, 1, 4, 0, 1, 0, 7, 0},
+	{2, 0, 0, 3, 0, 0, 0, 4, 0, 1, 2, 3, 0, 0, 0, 6, 0},
+	{1, 0, 0, 2, 0, 0, 3, 2, 6, 1, 0, 1, 0},
+}
+
+// propertyOp is a decoded mutation.
+type propertyOp struct {
+	left   bool
+	kind   int
+	target string
+	dest   string
+}
+
+func decodeOps(data []byte) (initial, concurrent []*propertyOp) {
+	if len(data) == 0 {
+		return
+	}
+	n := int(data[0] % 8)
+	data = data[1:]
+	for i := 0; i+4 <= len(data); i += 4 {
+		op := &propertyOp{
+			left:   data[i]%2 == 0,
+			kind:   int(data[i+1]) % opCount,
+			target: propertyPaths[int(data[i+2])%len(propertyPaths)],
+			dest:   propertyPaths[int(data[i+3])%len(propertyPaths)],
+		}
+		if len(initial) < n {
+			op.left = true
+			initial = append(initial, op)
+		} else {
+			concurrent = append(concurrent, op)
+		}
+	}
+	return
+}
+
+// apply runs an operation on a filesystem and returns the touched paths. Operations that do not make sense in
+// the current state (e.g. deleting a missing file) do nothing.
+func (o *propertyOp) apply(fs afero.Fs, step int) (touched []string) {
+	switch o.kind {
+	case opWrite:
+		fs.MkdirAll(path.Dir(o.target), 0755)
+		content := fmt.Sprintf("%s written at step %d on %v", o.target, step, o.left)
+		if afero.WriteFile(fs, o.target, []byte(content), 0644) == nil {
+			touched = append(touched, o.target)
+		}
+	case opDelete:
+		if fs.Remove(o.target) == nil {
+			touched = append(touched, o.target)
+		}
+	case opDeleteFolder:
+		dir := path.Dir(o.target)
+		if dir == "." {
+			return
+		}
+		files, _ := readTree(fs)
+		if fs.RemoveAll(dir) == nil {
+			for p := range files {
+				if strings.HasPrefix(p, dir+"/") {
+					touched = append(touched, p)
+				}
+			}
+		}
+	case opMove:
+		if o.target == o.dest {
+			return
+		}
+		if _, e := fs.Stat(o.dest); e == nil {
+			return
+		}
+		if s, e := fs.Stat(o.target); e != nil || s.IsDir() {
+			return
+		}
+		fs.MkdirAll(path.Dir(o.dest), 0755)
+		if fs.Rename(o.target, o.dest) == nil {
+			touched = append(touched, o.target, o.dest)
+		}
+	case opMkdir:
+		fs.MkdirAll(path.Dir(o.target), 0755)
+	}
+	return
+}
+
+// readTree lists the files of a filesystem with the MD5 of their contents, ignoring the engine metadata files.
+func readTree(fs afero.Fs) (map[string]string, error) {
+	files := make(map[string]string)
+	e := afero.Walk(fs, "/", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() == ".pydio" {
+			return nil
+		}
+		data, er := afero.ReadFile(fs, p)
+		if er != nil {
+			return er
+		}
+		h := md5.Sum(data)
+		files[strings.TrimLeft(p, "/")] = hex.EncodeToString(h[:])
+		return nil
+	})
+	return files, e
+}
+
+// memEndpoint creates a filesystem endpoint on an in-memory afero filesystem.
+func memEndpoint(t testing.TB) (*filesystem.FSClient, afero.Fs) {
+	root, e := ioutil.TempDir("", "sync-property")
+	if e != nil {
+		t.Fatal(e)
+	}
+	client, e := filesystem.NewFSClient(root, model.EndpointOptions{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	fs := afero.NewMemMapFs()
+	client.FS = fs
+	return client, fs
+}
+
+// syncOnce runs a full bidirectional sync, using the snapshots stored in snapDir as the common ancestor.
+func syncOnce(left, right *filesystem.FSClient, snapDir string) error {
+	s := task.NewSync(left, right, model.DirectionBi)
+	factory := endpoint.NewSnapshotFactory(snapDir, left, right)
+	s.SetSnapshotFactory(factory)
+	defer factory.Close(context.Background())
+
+	statusChan := make(chan model.Status, 100)
+	doneChan := make(chan interface{})
+	s.SetupEventsChan(statusChan, doneChan, nil)
+	s.Start(context.Background(), false)
+	defer s.Shutdown()
+	s.Run(context.Background(), false, true)
+	for {
+		select {
+		case <-statusChan:
+		case p := <-doneChan:
+			if patch, ok := p.(merger.Patch); ok {
+				if errs, has := patch.HasErrors(); has {
+					return fmt.Errorf("patch has errors: %v", errs)
+				}
+			}
+			return nil
+		case <-time.After(30 * time.Second):
+			return fmt.Errorf("sync did not finish after 30s")
+		}
+	}
+}
+
+// checkProperties applies a mutation sequence on two endpoints and checks that both sides converge without losing
+// data. Content conflicts (the same file changed differently on both sides) are left to the agent by the engine,
+// so these files are only required to keep at least one of their versions.
+func checkProperties(t testing.TB, data []byte) {
+	initial, concurrent := decodeOps(data)
+	left, leftFS := memEndpoint(t)
+	right, rightFS := memEndpoint(t)
+	snapDir, e := ioutil.TempDir("", "sync-property-snaps")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(snapDir)
+	defer os.RemoveAll(left.RootPath)
+	defer os.RemoveAll(right.RootPath)
+
+	for i, op := range initial {
+		op.apply(leftFS, i)
+	}
+	if e := syncOnce(left, right, snapDir); e != nil {
+		t.Fatalf("initial sync: %v", e)
+	}
+
+	touched := map[bool]map[string]bool{true: {}, false: {}}
+	for i, op := range concurrent {
+		fs := rightFS
+		if op.left {
+			fs = leftFS
+		}
+		for _, p := range op.apply(fs, len(initial)+i) {
+			touched[op.left][p] = true
+		}
+	}
+	before := make(map[bool]map[string]string)
+	if before[true], e = readTree(leftFS); e != nil {
+		t.Fatal(e)
+	}
+	if before[false], e = readTree(rightFS); e != nil {
+		t.Fatal(e)
+	}
+	conflicts := make(map[string]bool)
+	for p := range touched[true] {
+		if touched[false][p] && before[true][p] != before[false][p] {
+			conflicts[p] = true
+		}
+	}
+
+	var leftFiles, rightFiles map[string]string
+	for run := 0; run < maxPropertyRuns; run++ {
+		if e := syncOnce(left, right, snapDir); e != nil {
+			t.Fatalf("sync %d: %v", run+1, e)
+		}
+		leftFiles, _ = readTree(leftFS)
+		rightFiles, _ = readTree(rightFS)
+		if diff := treeDiff(leftFiles, rightFiles, conflicts); len(diff) == 0 {
+			break
+		} else if run == maxPropertyRuns-1 {
+			t.Fatalf("sides did not converge after %d syncs (ops %v): %s", maxPropertyRuns, data, strings.Join(diff, ", "))
+		}
+	}
+
+	// No data loss: a file changed on one side only must be found at the same path with the same contents,
+	// unless the other side removed it. Conflicting files must keep at least one version.
+	for _, side := range []bool{true, false} {
+		for p, hash := range before[side] {
+			if !touched[side][p] {
+				continue
+			}
+			if conflicts[p] {
+				if leftFiles[p] != before[true][p] && leftFiles[p] != before[false][p] && !containsHash(leftFiles, before[true][p]) && !containsHash(leftFiles, before[false][p]) {
+					t.Errorf("both versions of conflicting file %s were lost (ops %v)", p, data)
+				}
+				continue
+			}
+			if touched[!side][p] {
+				continue
+			}
+			if leftFiles[p] != hash || rightFiles[p] != hash {
+				t.Errorf("changes of %s were lost (ops %v): expected %s, found %s / %s", p, data, hash, leftFiles[p], rightFiles[p])
+			}
+		}
+	}
+}
+
+// treeDiff lists the paths that differ between two trees, ignoring some paths.
+func treeDiff(left, right map[string]string, ignored map[string]bool) (diff []string) {
+	for p, h := range left {
+		if !ignored[p] && right[p] != h {
+			diff = append(diff, p)
+		}
+	}
+	for p := range right {
+		if _, ok := left[p]; !ok && !ignored[p] {
+			diff = append(diff, p)
+		}
+	}
+	sort.Strings(diff)
+	return
+}
+
+func containsHash(files map[string]string, hash string) bool {
+	for _, h := range files {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBidirectionalProperties(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping full engine runs in short mode")
+	}
+	for i, seed := range propertySeeds {
+		t.Run(fmt.Sprintf("seed-%d", i), func(t *testing.T) {
+			checkProperties(t, seed)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Abstrium SAS
+ *
+ *  This file is part of Cells Sync.
+ *
+ *  Cells Sync is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  Cells Sync is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with Cells Sync.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cellsync "github.com/pydio/cells-sync/sync"
+)
+
+// TestEmbeddedTask runs one pass of an embedded task between two local folders.
+func TestEmbeddedTask(t *testing.T) {
+	var dirs []string
+	for _, prefix := range []string{"embedded-left", "embedded-right", "embedded-state"} {
+		dir, e := ioutil.TempDir("", prefix)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer os.RemoveAll(dir)
+		dirs = append(dirs, dir)
+	}
+	if e := os.MkdirAll(filepath.Join(dirs[0], "folder"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	if e := ioutil.WriteFile(filepath.Join(dirs[0], "folder", "file.txt"), []byte("hello world"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	task, e := cellsync.NewTask(cellsync.Options{
+		LeftURI:   "fs://" + filepath.ToSlash(dirs[0]),
+		RightURI:  "fs://" + filepath.ToSlash(dirs[1]),
+		StatePath: dirs[2],
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer task.Close()
+	go func() {
+		for range task.Events() {
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	patch, e := task.Diff(ctx)
+	if e != nil {
+		t.Fatalf("diff: %v", e)
+	}
+	if patch == nil || patch.Size() == 0 {
+		t.Fatal("diff should find the new file")
+	}
+	if _, e := os.Stat(filepath.Join(dirs[1], "folder", "file.txt")); e == nil {
+		t.Fatal("diff should not copy anything")
+	}
+	if e := task.Run(ctx); e != nil {
+		t.Fatalf("run: %v", e)
+	}
+	data, e := ioutil.ReadFile(filepath.Join(dirs[1], "folder", "file.txt"))
+	if e != nil {
+		t.Fatalf("file was not synced: %v", e)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("unexpected content %q", string(data))
+	}
+}